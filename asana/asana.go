@@ -0,0 +1,172 @@
+// Package asana integrates the autoassigner with Asana: it reads tasks by
+// gid or from webhook events and sets their assignee through the REST API.
+package asana
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultApiUrl = "https://app.asana.com/api/1.0"
+
+// Task is an Asana task to assign.
+type Task struct {
+	GID         string   // gid of the task
+	Name        string   // Name of the task
+	Projects    []string // gids of the projects the task is in
+	AssigneeGID string   // gid of the assignee, empty for unassigned tasks
+}
+
+// String returns the gid of the task.
+func (t Task) String() string {
+	return t.GID
+}
+
+// AddedTasks returns the gids of the tasks added to a project by the events
+// of a webhook payload, with the gid of the project, in order.
+func AddedTasks(payload []byte) ([][2]string, error) {
+	var body struct {
+		Events []struct {
+			Action   string `json:"action"`
+			Resource struct {
+				GID          string `json:"gid"`
+				ResourceType string `json:"resource_type"`
+			} `json:"resource"`
+			Parent *struct {
+				GID          string `json:"gid"`
+				ResourceType string `json:"resource_type"`
+			} `json:"parent"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, fmt.Errorf("failed to parse Asana events: %w", err)
+	}
+	var added [][2]string
+	for _, e := range body.Events {
+		if e.Action == "added" && e.Resource.ResourceType == "task" && e.Parent != nil && e.Parent.ResourceType == "project" {
+			added = append(added, [2]string{e.Resource.GID, e.Parent.GID})
+		}
+	}
+	return added, nil
+}
+
+// VerifySignature reports whether signature, the X-Hook-Signature header,
+// is the hex HMAC-SHA256 of payload under the secret of the handshake.
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// GetTask returns the task with the given gid.
+func GetTask(ctx context.Context, gid string) (*Task, error) {
+	var result struct {
+		Data struct {
+			GID      string `json:"gid"`
+			Name     string `json:"name"`
+			Assignee *struct {
+				GID string `json:"gid"`
+			} `json:"assignee"`
+			Memberships []struct {
+				Project struct {
+					GID string `json:"gid"`
+				} `json:"project"`
+			} `json:"memberships"`
+		} `json:"data"`
+	}
+	path := "/tasks/" + url.PathEscape(gid) + "?opt_fields=name,assignee,memberships.project"
+	if err := call(ctx, http.MethodGet, path, nil, &result); err != nil {
+		return nil, err
+	}
+	d := result.Data
+	task := &Task{GID: d.GID, Name: d.Name}
+	if d.Assignee != nil {
+		task.AssigneeGID = d.Assignee.GID
+	}
+	for _, m := range d.Memberships {
+		task.Projects = append(task.Projects, m.Project.GID)
+	}
+	return task, nil
+}
+
+// Assignee returns how a user is assigned in Asana: their gid from the
+// identity mapping, or else their email address, which Asana accepts too.
+func Assignee(ctx context.Context, user string) (string, error) {
+	gid, err := identity.Lookup(ctx, user, identity.Asana)
+	if !errors.Is(err, identity.ErrUnknown) {
+		return gid, err
+	}
+	return identity.Lookup(ctx, user, identity.Email)
+}
+
+// Assign sets the assignee of a task to assignee, a gid or an email address
+// as returned by Assignee.
+func Assign(ctx context.Context, t Task, assignee string) error {
+	body := map[string]interface{}{"data": map[string]string{"assignee": assignee}}
+	return call(ctx, http.MethodPut, "/tasks/"+url.PathEscape(t.GID), body, nil)
+}
+
+// call sends a request to the Asana API and decodes the response into
+// result unless it is nil.
+func call(ctx context.Context, method, path string, body, result interface{}) error {
+	conf := config.Settings.Asana
+	apiUrl := conf.ApiUrl
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(apiUrl, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+conf.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Asana request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if len(apiErr.Errors) > 0 {
+			return fmt.Errorf("Asana request failed: %s: %s", resp.Status, apiErr.Errors[0].Message)
+		}
+		return fmt.Errorf("Asana request failed: unexpected status %s", resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,96 @@
+package asana
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddedTasks(t *testing.T) {
+	payload := `{"events": [
+		{"action": "added", "resource": {"gid": "111", "resource_type": "task"}, "parent": {"gid": "900", "resource_type": "project"}},
+		{"action": "changed", "resource": {"gid": "111", "resource_type": "task"}, "parent": null},
+		{"action": "added", "resource": {"gid": "222", "resource_type": "story"}, "parent": {"gid": "111", "resource_type": "task"}},
+		{"action": "added", "resource": {"gid": "333", "resource_type": "task"}, "parent": {"gid": "111", "resource_type": "task"}},
+		{"action": "added", "resource": {"gid": "444", "resource_type": "task"}, "parent": {"gid": "901", "resource_type": "project"}}
+	]}`
+	got, err := AddedTasks([]byte(payload))
+	if want := [][2]string{{"111", "900"}, {"444", "901"}}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("AddedTasks() = %v, %v, want %v", got, err, want)
+	}
+	if _, err := AddedTasks([]byte(`{`)); err == nil {
+		t.Error("AddedTasks() of invalid JSON error = nil, want an error")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	var updates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer pat" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors": [{"message": "Not Authorized"}]}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/tasks/111":
+			if r.URL.Query().Get("opt_fields") != "name,assignee,memberships.project" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"data": {"gid": "111", "name": "Refund order", "assignee": null, "memberships": [{"project": {"gid": "900"}}, {"project": {"gid": "901"}}]}}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/tasks/111":
+			var body struct {
+				Data map[string]string `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			updates = append(updates, body.Data["assignee"])
+			w.Write([]byte(`{"data": {}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": [{"message": "task: Unknown object: 999"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Asana = config.AsanaConfig{ApiUrl: server.URL, Token: "pat"}
+	config.Settings.Identity = config.IdentityConfig{Users: map[string]map[string]string{
+		"alice": {"asana": "1200"},
+		"bob":   {"email": "bob@example.com"},
+	}}
+	ctx := context.Background()
+
+	task, err := GetTask(ctx, "111")
+	want := &Task{GID: "111", Name: "Refund order", Projects: []string{"900", "901"}}
+	if err != nil || !reflect.DeepEqual(task, want) {
+		t.Fatalf("GetTask() = %+v, %v, want %+v", task, err, want)
+	}
+	if _, err := GetTask(ctx, "999"); err == nil || !strings.Contains(err.Error(), "Unknown object") {
+		t.Errorf("GetTask(999) error = %v, want the API's message", err)
+	}
+
+	// Users without an asana identifier are assigned by email
+	for _, user := range []string{"alice", "bob"} {
+		assignee, err := Assignee(ctx, user)
+		if err != nil {
+			t.Fatalf("Assignee(%s) error = %v", user, err)
+		}
+		if err := Assign(ctx, *task, assignee); err != nil {
+			t.Fatalf("Assign(%s) error = %v", assignee, err)
+		}
+	}
+	if want := []string{"1200", "bob@example.com"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+
+	config.Settings.Asana.Token = "wrong"
+	if _, err := GetTask(ctx, "111"); err == nil || !strings.Contains(err.Error(), "Not Authorized") {
+		t.Errorf("GetTask() error = %v, want the API's message", err)
+	}
+}
@@ -1,7 +1,17 @@
 package availability
 
+import "context"
+
 type AlwaysAvailable struct{}
 
-func (c *AlwaysAvailable) IsAvailable(username string) (bool, error) {
+func (c *AlwaysAvailable) IsAvailable(ctx context.Context, username string) (bool, error) {
 	return true, nil
 }
+
+func (c *AlwaysAvailable) AreAvailable(ctx context.Context, users []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(users))
+	for _, user := range users {
+		result[user] = true
+	}
+	return result, nil
+}
@@ -2,10 +2,16 @@ package availability
 
 import (
 	"autoassigner/config"
+	"autoassigner/inout"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestAlwaysAvailable(t *testing.T) {
@@ -27,13 +33,13 @@ func TestAlwaysAvailable(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			available, err := checker.IsAvailable(tt.username)
+			available, err := checker.IsAvailable(context.Background(), tt.username)
 			if err != nil {
-				t.Errorf("AlwaysAvailable.IsAvailable() error = %v", err)
+				t.Errorf("AlwaysAvailable.IsAvailable(%q) error = %v", tt.username, err)
 				return
 			}
 			if !available {
-				t.Error("AlwaysAvailable.IsAvailable() = false, want true")
+				t.Errorf("AlwaysAvailable.IsAvailable(%q) = false, want true", tt.username)
 			}
 		})
 	}
@@ -113,19 +119,472 @@ func TestInOutChecker(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			available, err := checker.IsAvailable(tt.username)
+			available, err := checker.IsAvailable(context.Background(), tt.username)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("InOutChecker.IsAvailable() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("InOutChecker.IsAvailable(%q) error = %v, wantErr %v", tt.username, err, tt.wantErr)
 				return
 			}
 			if available != tt.want {
-				t.Errorf("InOutChecker.IsAvailable() = %v, want %v", available, tt.want)
+				t.Errorf("InOutChecker.IsAvailable(%q) = %v, want %v", tt.username, available, tt.want)
 			}
 		})
 	}
 }
 
 func TestCheckerInterface(t *testing.T) {
-	var _ Checker = &AlwaysAvailable{} // Verify AlwaysAvailable implements Checker
-	var _ Checker = &InOutChecker{}    // Verify InOutChecker implements Checker
+	var _ Checker = &AlwaysAvailable{}     // Verify AlwaysAvailable implements Checker
+	var _ Checker = &InOutChecker{}        // Verify InOutChecker implements Checker
+	var _ BulkChecker = &AlwaysAvailable{} // Verify AlwaysAvailable implements BulkChecker
+	var _ BulkChecker = &InOutChecker{}    // Verify InOutChecker implements BulkChecker
+	var _ BulkChecker = &BambooHRChecker{} // Verify BambooHRChecker implements BulkChecker
+	var _ BulkChecker = &WorkdayChecker{}  // Verify WorkdayChecker implements BulkChecker
+	var _ UserValidator = &InOutChecker{}  // Verify InOutChecker implements UserValidator
+}
+
+func TestInOutCheckerKnowsUser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status/alice":
+			json.NewEncoder(w).Encode(map[string]string{"inOutLocation": "OFFICE"})
+		case "/status/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+
+	tests := []struct {
+		username string
+		want     bool
+		wantErr  bool
+	}{
+		{"alice", true, false},
+		{"alcie", false, false},
+		{"broken", false, true},
+	}
+	for _, tt := range tests {
+		known, err := (&InOutChecker{}).KnowsUser(context.Background(), tt.username)
+		if (err != nil) != tt.wantErr || known != tt.want {
+			t.Errorf("InOutChecker.KnowsUser(%q) = %v, %v, want %v (error %v)", tt.username, known, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestInOutCheckerAuth(t *testing.T) {
+	var gotAuth, gotHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("X-Team")
+		json.NewEncoder(w).Encode(map[string]interface{}{"inOutLocation": "OFFICE"})
+	}))
+	defer server.Close()
+
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+	config.Settings.Availability.InOutUnavailableStatuses = []string{"OOO"}
+	defer func() { config.Settings.Availability.InOutAuth = config.InOutAuthConfig{} }()
+
+	tests := []struct {
+		name     string
+		auth     config.InOutAuthConfig
+		wantAuth string
+	}{
+		{
+			name:     "anonymous",
+			auth:     config.InOutAuthConfig{},
+			wantAuth: "",
+		},
+		{
+			name:     "bearer token",
+			auth:     config.InOutAuthConfig{BearerToken: "secret"},
+			wantAuth: "Bearer secret",
+		},
+		{
+			name:     "basic auth",
+			auth:     config.InOutAuthConfig{Username: "bot", Password: "pw"},
+			wantAuth: "Basic Ym90OnB3",
+		},
+	}
+
+	// One checker sees every change of the auth, as when secrets are refreshed
+	checker := &InOutChecker{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.auth.Headers = map[string]string{"X-Team": "alpha"}
+			config.Settings.Availability.InOutAuth = tt.auth
+
+			if _, err := checker.IsAvailable(context.Background(), "alice"); err != nil {
+				t.Fatalf("InOutChecker.IsAvailable(%q) error = %v", "alice", err)
+			}
+			if gotAuth != tt.wantAuth {
+				t.Errorf("Authorization header = %q, want %q", gotAuth, tt.wantAuth)
+			}
+			if gotHeader != "alpha" {
+				t.Errorf("X-Team header = %q, want %q", gotHeader, "alpha")
+			}
+		})
+	}
+}
+
+func TestInOutCheckerResponseMapping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Path[len("/status/"):]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"presence": status},
+		})
+	}))
+	defer server.Close()
+
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+	config.Settings.Availability.InOutStatusField = "data.presence"
+
+	tests := []struct {
+		name       string
+		mode       string
+		ignoreCase bool
+		statuses   []string
+		status     string
+		want       bool
+	}{
+		{"exact match", config.MatchExact, false, []string{"OOO"}, "OOO", false},
+		{"exact mismatch on case", config.MatchExact, false, []string{"OOO"}, "ooo", true},
+		{"exact ignore case", config.MatchExact, true, []string{"OOO"}, "ooo", false},
+		{"prefix match", config.MatchPrefix, false, []string{"OOO"}, "OOO-vacation", false},
+		{"prefix ignore case", config.MatchPrefix, true, []string{"away"}, "AWAY-lunch", false},
+		{"regex match", config.MatchRegex, false, []string{"^(OOO|SICK)$"}, "SICK", false},
+		{"regex mismatch", config.MatchRegex, false, []string{"^(OOO|SICK)$"}, "OFFICE", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Settings.Availability.InOutMatchMode = tt.mode
+			config.Settings.Availability.InOutMatchIgnoreCase = tt.ignoreCase
+			config.Settings.Availability.InOutUnavailableStatuses = tt.statuses
+
+			got, err := (&InOutChecker{}).IsAvailable(context.Background(), tt.status)
+			if err != nil {
+				t.Fatalf("InOutChecker.IsAvailable(%q) error = %v", tt.status, err)
+			}
+			if got != tt.want {
+				t.Errorf("InOutChecker.IsAvailable(%q) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInOutCheckerBulk(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := strings.CutPrefix(r.URL.Path, "/status/"); ok {
+			if user == "unknown" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"inOutLocation": "OFFICE"})
+			return
+		}
+		requests++
+		var body struct {
+			Users []string `json:"users"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&body) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		response := map[string]interface{}{}
+		for _, user := range body.Users {
+			if user == "bob" {
+				response[user] = map[string]interface{}{"inOutLocation": "OOO"}
+			} else if user != "unknown" {
+				response[user] = map[string]interface{}{"inOutLocation": "OFFICE"}
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability = config.AvailabilityConfig{
+		InOutApiUrlPrefix:        server.URL + "/status/",
+		InOutBatchApiUrl:         server.URL + "/batch",
+		InOutUnavailableStatuses: []string{"OOO"},
+	}
+
+	checker := &InOutChecker{}
+	got, err := checker.AreAvailable(context.Background(), []string{"alice", "bob"})
+	if err != nil {
+		t.Fatalf("AreAvailable() error = %v", err)
+	}
+	if want := map[string]bool{"alice": true, "bob": false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AreAvailable() = %v, want %v", got, want)
+	}
+	if requests != 1 {
+		t.Errorf("AreAvailable() made %d requests, want 1", requests)
+	}
+
+	// Users unknown to the API fail the batch check like the single one
+	if _, err := checker.IsAvailable(context.Background(), "unknown"); !errors.Is(err, inout.ErrUnknownUser) {
+		t.Errorf("IsAvailable(%q) error = %v, want ErrUnknownUser", "unknown", err)
+	}
+	if got, err := checker.AreAvailable(context.Background(), []string{"alice", "unknown"}); !errors.Is(err, inout.ErrUnknownUser) {
+		t.Errorf("AreAvailable() with an unknown user = %v, %v, want ErrUnknownUser", got, err)
+	}
+}
+
+func TestBambooHRChecker(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if user, _, _ := r.BasicAuth(); user != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"type": "timeOff", "employeeId": 42, "start": today, "end": today},
+			{"type": "timeOff", "employeeId": 43, "start": today, "end": today},
+			{"type": "holiday", "start": today, "end": today},
+		})
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Storage.DataDir = t.TempDir()
+	config.Settings.Availability.HR = config.HRConfig{
+		BambooHRApiUrl:  server.URL,
+		BambooHRCompany: "acme",
+		BambooHRApiKey:  "key",
+		UserMapping:     map[string]string{"alice": "42", "bob": "7"},
+	}
+	// Users without a user_mapping entry are looked up in the shared identities
+	config.Settings.Identity.Users = map[string]map[string]string{"carol": {"bamboohr": "43"}}
+
+	checker := &BambooHRChecker{}
+	got, err := checker.AreAvailable(context.Background(), []string{"alice", "bob", "carol"})
+	if err != nil {
+		t.Fatalf("BambooHRChecker.AreAvailable() error = %v", err)
+	}
+	if got["alice"] || !got["bob"] || got["carol"] {
+		t.Errorf("BambooHRChecker.AreAvailable() = %v, want alice and carol out and bob in", got)
+	}
+
+	// A second check is served from the cache
+	available, err := checker.IsAvailable(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("BambooHRChecker.IsAvailable(%q) error = %v", "alice", err)
+	}
+	if available {
+		t.Errorf("BambooHRChecker.IsAvailable(%q) = true, want false", "alice")
+	}
+	if requests != 1 {
+		t.Errorf("BambooHR API called %d times, want 1", requests)
+	}
+}
+
+func TestTimeOffCovers(t *testing.T) {
+	day := time.Date(2024, 5, 1, 15, 0, 0, 0, time.Local)
+	tests := []struct {
+		name       string
+		start, end string
+		want       bool
+		wantErr    bool
+	}{
+		{"dates", "2024-04-30", "2024-05-01", true, false},
+		{"before", "2024-04-28", "2024-04-30", false, false},
+		{"after", "2024-05-02", "2024-05-03", false, false},
+		{"dates with offset", "2024-05-01-07:00", "2024-05-01-07:00", true, false},
+		{"dates in UTC", "2024-05-01Z", "2024-05-02Z", true, false},
+		{"mixed formats", "2024-04-29", "2024-05-01+02:00", true, false},
+		{"times", "2024-05-01T09:00:00-07:00", "2024-05-01T17:00:00-07:00", true, false},
+		{"ended the day before with offset", "2024-04-29-07:00", "2024-04-30-07:00", false, false},
+		{"invalid", "May 1", "2024-05-01", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := timeOff{Employee: "42", Start: tt.start, End: tt.end}.covers(day)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("covers() = %v, %v, want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInOutCheckerTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := (&InOutChecker{}).IsAvailable(ctx, "alice"); err == nil {
+		t.Error("InOutChecker.IsAvailable() should fail when the context times out")
+	}
+}
+
+func TestZendeskChecker(t *testing.T) {
+	statuses := map[string]string{"1001": "Online", "1002": "Away", "1003": "Transfers only"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, ok := statuses[strings.TrimPrefix(r.URL.Path, "/api/v2/agent_availabilities/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "RecordNotFound", "description": "Not found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"attributes": map[string]interface{}{"agent_status": map[string]string{"name": status}}},
+		})
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Zendesk = config.ZendeskConfig{Url: server.URL}
+	config.Settings.Identity.Users = map[string]map[string]string{
+		"alice": {"zendesk": "1001"},
+		"bob":   {"zendesk": "1002"},
+		"carol": {"zendesk": "1003"},
+	}
+
+	tests := []struct {
+		available []string
+		user      string
+		want      bool
+		wantErr   bool
+	}{
+		{user: "alice", want: true},
+		{user: "bob"},
+		{user: "carol"},
+		{available: []string{"online", "transfers only"}, user: "carol", want: true},
+		// Users without an identity are taken to be agent IDs
+		{user: "1001", want: true},
+		{user: "dave", wantErr: true},
+	}
+	for i, tt := range tests {
+		config.Settings.Zendesk.AvailableStatuses = tt.available
+		got, err := (&ZendeskChecker{}).IsAvailable(context.Background(), tt.user)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d ZendeskChecker.IsAvailable(%s) error = %v, wantErr %v", i, tt.user, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("#%d ZendeskChecker.IsAvailable(%s) = %v, want %v", i, tt.user, got, tt.want)
+		}
+	}
+}
+
+// countingChecker reports the users in available as available and counts
+// the users it is asked about.
+type countingChecker struct {
+	available map[string]bool
+	asked     map[string]int
+	fail      bool
+}
+
+func (c *countingChecker) IsAvailable(ctx context.Context, username string) (bool, error) {
+	c.asked[username]++
+	if c.fail {
+		return false, context.DeadlineExceeded
+	}
+	return c.available[username], nil
+}
+
+// countingBulkChecker is a countingChecker checking many users at once.
+type countingBulkChecker struct {
+	countingChecker
+	calls int
+}
+
+func (c *countingBulkChecker) AreAvailable(ctx context.Context, users []string) (map[string]bool, error) {
+	c.calls++
+	result := map[string]bool{}
+	for _, user := range users {
+		ok, err := c.IsAvailable(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		result[user] = ok
+	}
+	return result, nil
+}
+
+func TestCachedChecker(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	inner := &countingChecker{available: map[string]bool{"alice": true}, asked: map[string]int{}}
+	checker := Cached(inner, time.Minute)
+	if _, ok := checker.(BulkChecker); ok {
+		t.Fatal("Cached() of a checker without bulk checks should not be a BulkChecker")
+	}
+	checker.(*CachedChecker).now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, err := checker.IsAvailable(context.Background(), "alice"); err != nil || !ok {
+			t.Fatalf("IsAvailable(alice) = %v, %v", ok, err)
+		}
+		if ok, err := checker.IsAvailable(context.Background(), "bob"); err != nil || ok {
+			t.Fatalf("IsAvailable(bob) = %v, %v", ok, err)
+		}
+	}
+	if inner.asked["alice"] != 1 || inner.asked["bob"] != 1 {
+		t.Errorf("checker asked %v, want every user once", inner.asked)
+	}
+
+	// Results expire after the TTL
+	now = now.Add(time.Minute)
+	inner.available["bob"] = true
+	if ok, _ := checker.IsAvailable(context.Background(), "bob"); !ok || inner.asked["bob"] != 2 {
+		t.Errorf("IsAvailable(bob) after the TTL = %v, asked %d times", ok, inner.asked["bob"])
+	}
+
+	// Failed checks are not cached
+	inner.fail = true
+	for i := 0; i < 2; i++ {
+		if _, err := checker.IsAvailable(context.Background(), "carol"); err == nil {
+			t.Error("IsAvailable(carol) should fail")
+		}
+	}
+	if inner.asked["carol"] != 2 {
+		t.Errorf("checker asked about carol %d times, want 2", inner.asked["carol"])
+	}
+}
+
+func TestCachedBulkChecker(t *testing.T) {
+	inner := &countingBulkChecker{countingChecker: countingChecker{available: map[string]bool{"alice": true}, asked: map[string]int{}}}
+	checker, ok := Cached(inner, time.Minute).(BulkChecker)
+	if !ok {
+		t.Fatal("Cached() of a BulkChecker should be a BulkChecker")
+	}
+
+	if ok, _ := checker.(Checker).IsAvailable(context.Background(), "alice"); !ok {
+		t.Fatal("IsAvailable(alice) = false")
+	}
+	got, err := checker.AreAvailable(context.Background(), []string{"alice", "bob", "carol"})
+	if err != nil {
+		t.Fatalf("AreAvailable() error = %v", err)
+	}
+	if !got["alice"] || got["bob"] || got["carol"] || len(got) != 3 {
+		t.Errorf("AreAvailable() = %v", got)
+	}
+	if _, err := checker.AreAvailable(context.Background(), []string{"alice", "bob", "carol"}); err != nil {
+		t.Fatalf("AreAvailable() error = %v", err)
+	}
+	// The cached alice is left out of the first call, the second is answered from the cache
+	if inner.calls != 1 || inner.asked["alice"] != 1 || inner.asked["bob"] != 1 {
+		t.Errorf("checker made %d bulk calls and asked %v", inner.calls, inner.asked)
+	}
+	if unwrapped := checker.(interface{ Unwrap() Checker }).Unwrap(); unwrapped != inner {
+		t.Errorf("Unwrap() = %v, want the cached checker", unwrapped)
+	}
 }
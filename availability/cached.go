@@ -0,0 +1,108 @@
+package availability
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CachedChecker reuses the results of another checker for a while, so
+// repeated assignments don't ask its backend about the same users again.
+// Failed checks are not cached.
+type CachedChecker struct {
+	checker Checker
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	results map[string]cachedResult
+}
+
+// cachedResult is the availability of a user and when it expires.
+type cachedResult struct {
+	available bool
+	expires   time.Time
+}
+
+// cachedBulkChecker is a CachedChecker whose checker can check many users at once.
+type cachedBulkChecker struct {
+	*CachedChecker
+}
+
+// Cached returns a checker reusing the results of checker for ttl. Checkers
+// implementing BulkChecker are wrapped into one that does, too, asking
+// checker only about the users without a cached result.
+func Cached(checker Checker, ttl time.Duration) Checker {
+	c := &CachedChecker{checker: checker, ttl: ttl, now: time.Now, results: map[string]cachedResult{}}
+	if _, ok := checker.(BulkChecker); ok {
+		return &cachedBulkChecker{c}
+	}
+	return c
+}
+
+// Unwrap returns the checker whose results are cached.
+func (c *CachedChecker) Unwrap() Checker {
+	return c.checker
+}
+
+func (c *CachedChecker) IsAvailable(ctx context.Context, username string) (bool, error) {
+	if available, ok := c.lookup(username); ok {
+		return available, nil
+	}
+	available, err := c.checker.IsAvailable(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	c.store(map[string]bool{username: available})
+	return available, nil
+}
+
+// AreAvailable returns the cached results and checks the other users in one call.
+func (c *cachedBulkChecker) AreAvailable(ctx context.Context, users []string) (map[string]bool, error) {
+	available := make(map[string]bool, len(users))
+	var missing []string
+	for _, user := range users {
+		if ok, cached := c.lookup(user); cached {
+			available[user] = ok
+		} else {
+			missing = append(missing, user)
+		}
+	}
+	if len(missing) == 0 {
+		return available, nil
+	}
+
+	checked, err := c.checker.(BulkChecker).AreAvailable(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]bool, len(missing))
+	for _, user := range missing {
+		// Users missing from the result are unavailable, as for any BulkChecker
+		results[user] = checked[user]
+		available[user] = checked[user]
+	}
+	c.store(results)
+	return available, nil
+}
+
+// lookup returns the cached result for a user, if it hasn't expired.
+func (c *CachedChecker) lookup(username string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.results[username]
+	if !ok || !c.now().Before(result.expires) {
+		return false, false
+	}
+	return result.available, true
+}
+
+// store caches results, keyed by username.
+func (c *CachedChecker) store(results map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	for user, available := range results {
+		c.results[user] = cachedResult{available: available, expires: expires}
+	}
+}
@@ -2,16 +2,52 @@
 // It includes:
 // - In/Out status checker: Checks external API for member availability
 // - Always Available: Simple implementation that always returns available
+// - BambooHR/Workday: Checks approved time off in an HR system
+// - Zendesk: Checks the agent status of Zendesk agents
 package availability
 
+import "context"
+
 // Checker defines the interface for checking team member availability.
 // Each implementation must provide a way to determine if a team member is available.
 type Checker interface {
 	// IsAvailable checks if a team member is available for assignment.
 	// Parameters:
+	//   - ctx: Context for cancellation and timeouts of the check
 	//   - username: The username of the team member to check
 	// Returns:
 	//   - bool: True if the team member is available, false otherwise
 	//   - error: Any error that occurred during the check
-	IsAvailable(username string) (bool, error)
+	IsAvailable(ctx context.Context, username string) (bool, error)
+}
+
+// BulkChecker is implemented by checkers that can evaluate a whole list of
+// team members in a single call, avoiding one round trip per user.
+// Callers treat users missing from the result as unavailable, so checkers
+// that can't tell about a user, such as one their backend doesn't know,
+// fail the whole check with the error IsAvailable returns for that user
+// rather than leave them out.
+type BulkChecker interface {
+	// AreAvailable checks the availability of several team members at once.
+	// Parameters:
+	//   - ctx: Context for cancellation and timeouts of the check
+	//   - users: The usernames of the team members to check
+	// Returns:
+	//   - map[string]bool: Availability keyed by username; missing users are unavailable
+	//   - error: Any error that occurred during the check, including for a single user
+	AreAvailable(ctx context.Context, users []string) (map[string]bool, error)
+}
+
+// UserValidator is implemented by checkers whose backend can tell whether it
+// knows a team member, so misspelled usernames are found before they make
+// assignments fail.
+type UserValidator interface {
+	// KnowsUser checks whether the backend knows a team member.
+	// Parameters:
+	//   - ctx: Context for cancellation and timeouts of the check
+	//   - username: The username of the team member to look up
+	// Returns:
+	//   - bool: True if the backend knows the team member, false otherwise
+	//   - error: Any error that occurred during the lookup
+	KnowsUser(ctx context.Context, username string) (bool, error)
 }
@@ -0,0 +1,299 @@
+package availability
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultBambooHRApiUrl = "https://api.bamboohr.com/api/gateway.php"
+	defaultHRCacheTTL     = 300
+	hrDateLayout          = "2006-01-02"
+)
+
+// timeOff is a single approved absence reported by an HR system.
+// Employee holds the HR identifier of the absent person.
+type timeOff struct {
+	Employee string `json:"employee"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+}
+
+// hrDateLayouts are the formats HR systems report the days of time off in:
+// a date, a date with a UTC offset as Workday writes it, or a time.
+var hrDateLayouts = []string{hrDateLayout, "2006-01-02Z07:00", time.RFC3339}
+
+// parseHRDate parses a day of time off and returns it at midnight UTC, keeping
+// the date it was reported with, so days reported with any offset compare
+// by their date.
+func parseHRDate(value string) (time.Time, error) {
+	for _, layout := range hrDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return dateOf(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// dateOf returns the date of t at midnight UTC.
+func dateOf(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// covers reports whether the time off includes the date of day.
+func (e timeOff) covers(day time.Time) (bool, error) {
+	start, err := parseHRDate(e.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseHRDate(e.End)
+	if err != nil {
+		return false, err
+	}
+	day = dateOf(day)
+	return !day.Before(start) && !day.After(end), nil
+}
+
+// hrCache is the on-disk representation of previously fetched time-off data.
+type hrCache struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Entries   []timeOff `json:"entries"`
+}
+
+// BambooHRChecker marks users as unavailable while they have approved
+// time off in BambooHR's "who's out" report.
+type BambooHRChecker struct{}
+
+func (c *BambooHRChecker) IsAvailable(ctx context.Context, username string) (bool, error) {
+	return isAvailableFromHR(ctx, username, "bamboohr", fetchBambooHR)
+}
+
+func (c *BambooHRChecker) AreAvailable(ctx context.Context, users []string) (map[string]bool, error) {
+	return areAvailableFromHR(ctx, users, "bamboohr", fetchBambooHR)
+}
+
+// WorkdayChecker marks users as unavailable while they have approved
+// time off in a Workday report.
+type WorkdayChecker struct{}
+
+func (c *WorkdayChecker) IsAvailable(ctx context.Context, username string) (bool, error) {
+	return isAvailableFromHR(ctx, username, "workday", fetchWorkday)
+}
+
+func (c *WorkdayChecker) AreAvailable(ctx context.Context, users []string) (map[string]bool, error) {
+	return areAvailableFromHR(ctx, users, "workday", fetchWorkday)
+}
+
+// hrFetcher retrieves the approved time off for a single day from an HR system.
+type hrFetcher func(ctx context.Context, day string) ([]timeOff, error)
+
+func isAvailableFromHR(ctx context.Context, username, provider string, fetch hrFetcher) (bool, error) {
+	available, err := areAvailableFromHR(ctx, []string{username}, provider, fetch)
+	if err != nil {
+		return false, err
+	}
+	return available[username], nil
+}
+
+func areAvailableFromHR(ctx context.Context, users []string, provider string, fetch hrFetcher) (map[string]bool, error) {
+	now := time.Now()
+	entries, err := loadTimeOff(ctx, provider, now.Format(hrDateLayout), fetch)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]bool)
+	for _, entry := range entries {
+		covers, err := entry.covers(now)
+		if err != nil {
+			log.Printf("Warning: ignoring time off of %s in %s: %v", entry.Employee, provider, err)
+			continue
+		}
+		if covers {
+			out[entry.Employee] = true
+		}
+	}
+
+	available := make(map[string]bool, len(users))
+	for _, user := range users {
+		id, err := hrIdentifier(ctx, user, provider)
+		if err != nil {
+			return nil, err
+		}
+		available[user] = !out[id]
+	}
+	return available, nil
+}
+
+// hrIdentifier maps a username to the identifier used by the HR system:
+// the hr user_mapping, then the user's identity of the provider's kind
+// ("bamboohr" for BambooHR, the email address for Workday), then the username.
+func hrIdentifier(ctx context.Context, username, provider string) (string, error) {
+	if id, ok := config.Settings.Availability.HR.UserMapping[username]; ok {
+		return id, nil
+	}
+	kind := provider
+	if provider == "workday" {
+		kind = identity.Email
+	}
+	id, err := identity.Lookup(ctx, username, kind)
+	if errors.Is(err, identity.ErrUnknown) {
+		return username, nil
+	}
+	return id, err
+}
+
+// loadTimeOff returns the time-off entries for today, reusing the cached copy
+// when it is younger than the configured TTL.
+func loadTimeOff(ctx context.Context, provider, today string, fetch hrFetcher) ([]timeOff, error) {
+	ttl := config.Settings.Availability.HR.CacheTTLSeconds
+	if ttl <= 0 {
+		ttl = defaultHRCacheTTL
+	}
+
+	path := filepath.Join(config.Settings.Storage.DataDir, "hr-cache-"+provider+".json")
+	if data, err := os.ReadFile(path); err == nil {
+		var cache hrCache
+		if json.Unmarshal(data, &cache) == nil &&
+			cache.FetchedAt.Format(hrDateLayout) == today &&
+			time.Since(cache.FetchedAt) < time.Duration(ttl)*time.Second {
+			return cache.Entries, nil
+		}
+	}
+
+	entries, err := fetch(ctx, today)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch time off from %s: %w", provider, err)
+	}
+
+	if err := writeHRCache(path, hrCache{FetchedAt: time.Now(), Entries: entries}); err != nil {
+		log.Printf("Warning: failed to cache time off from %s: %v", provider, err)
+	}
+	return entries, nil
+}
+
+// writeHRCache replaces the cached time off by writing a temporary file and
+// renaming it, so concurrent checks never read a partially written cache.
+func writeHRCache(path string, cache hrCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fetchBambooHR queries BambooHR's "who's out" endpoint for a single day.
+// Company holidays are ignored; only individual time off is returned.
+func fetchBambooHR(ctx context.Context, day string) ([]timeOff, error) {
+	hr := config.Settings.Availability.HR
+	if hr.BambooHRCompany == "" || hr.BambooHRApiKey == "" {
+		return nil, fmt.Errorf("bamboohr_company and bamboohr_api_key are required")
+	}
+	base := hr.BambooHRApiUrl
+	if base == "" {
+		base = defaultBambooHRApiUrl
+	}
+
+	url := fmt.Sprintf("%s/%s/v1/time_off/whos_out/?start=%s&end=%s", base, hr.BambooHRCompany, day, day)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(hr.BambooHRApiKey, "x")
+
+	var results []struct {
+		Type       string      `json:"type"`
+		EmployeeID json.Number `json:"employeeId"`
+		Start      string      `json:"start"`
+		End        string      `json:"end"`
+	}
+	if err := getHRJSON(req, &results); err != nil {
+		return nil, err
+	}
+
+	var entries []timeOff
+	for _, r := range results {
+		if r.Type != "timeOff" {
+			continue
+		}
+		entries = append(entries, timeOff{Employee: r.EmployeeID.String(), Start: r.Start, End: r.End})
+	}
+	return entries, nil
+}
+
+// fetchWorkday reads a Workday RaaS report in JSON format.
+// Each report entry must provide Email, Start_Date and End_Date fields.
+func fetchWorkday(ctx context.Context, day string) ([]timeOff, error) {
+	hr := config.Settings.Availability.HR
+	if hr.WorkdayReportUrl == "" {
+		return nil, fmt.Errorf("workday_report_url is required")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hr.WorkdayReportUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if hr.WorkdayUsername != "" {
+		req.SetBasicAuth(hr.WorkdayUsername, hr.WorkdayPassword)
+	}
+
+	var report struct {
+		Entries []struct {
+			Email     string `json:"Email"`
+			StartDate string `json:"Start_Date"`
+			EndDate   string `json:"End_Date"`
+		} `json:"Report_Entry"`
+	}
+	if err := getHRJSON(req, &report); err != nil {
+		return nil, err
+	}
+
+	var entries []timeOff
+	for _, r := range report.Entries {
+		entries = append(entries, timeOff{Employee: r.Email, Start: r.StartDate, End: r.EndDate})
+	}
+	return entries, nil
+}
+
+func getHRJSON(req *http.Request, v interface{}) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
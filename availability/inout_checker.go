@@ -2,35 +2,140 @@ package availability
 
 import (
 	"autoassigner/config"
-	"encoding/json"
-	"net/http"
+	"autoassigner/inout"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 )
 
-type InOutChecker struct{}
+// InOutChecker checks the status of users in the In/Out API.
+type InOutChecker struct {
+	mu     sync.Mutex
+	client *inout.Client
+}
+
+// inout returns the client of the checker, made from the config on first
+// use and again whenever the config changes, such as when `serve` refreshes
+// the secrets, so every check with the same config reuses its connections.
+func (c *InOutChecker) inout() *inout.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client := inout.NewClient(); c.client == nil || !sameInOutClient(c.client, client) {
+		c.client = client
+	}
+	return c.client
+}
 
-func (c *InOutChecker) IsAvailable(username string) (bool, error) {
-	url := config.Settings.Availability.InOutApiUrlPrefix + username
-	resp, err := http.Get(url)
+// sameInOutClient reports whether two clients call the same endpoints with
+// the same credentials.
+func sameInOutClient(a, b *inout.Client) bool {
+	return a.StatusURL == b.StatusURL && a.BatchURL == b.BatchURL && a.BatchSize == b.BatchSize &&
+		reflect.DeepEqual(a.Auth, b.Auth)
+}
+
+func (c *InOutChecker) IsAvailable(ctx context.Context, username string) (bool, error) {
+	status, err := c.inout().Status(ctx, username)
 	if err != nil {
 		return false, err
 	}
-	defer resp.Body.Close()
+	return statusAvailable(status)
+}
+
+// KnowsUser requests the status of a user and reports whether the API
+// answers it, or responds with 404 Not Found.
+func (c *InOutChecker) KnowsUser(ctx context.Context, username string) (bool, error) {
+	_, err := c.inout().Status(ctx, username)
+	switch {
+	case errors.Is(err, inout.ErrUnknownUser):
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return true, nil
+	}
+}
 
-	var result map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&result)
+// AreAvailable checks all users with as few calls to the configured batch
+// endpoint as inout_batch_size allows. The endpoint receives {"users": [...]}
+// and must return an object keyed by username whose values have the same
+// shape as the single-user response.
+// Without a batch endpoint it falls back to one request per user.
+// Users missing from the response fail the check with an UnknownUserError,
+// like they do in IsAvailable.
+func (c *InOutChecker) AreAvailable(ctx context.Context, users []string) (map[string]bool, error) {
+	statuses, err := c.inout().Statuses(ctx, users)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	available := make(map[string]bool, len(users))
+	for _, user := range users {
+		status, ok := statuses[user]
+		if !ok {
+			return nil, &inout.UnknownUserError{User: user}
+		}
+		ok, err := statusAvailable(status)
+		if err != nil {
+			return nil, err
+		}
+		available[user] = ok
 	}
+	return available, nil
+}
 
-	status, ok := result["inOutLocation"].(string)
+// statusAvailable decides availability from a single decoded status response.
+func statusAvailable(result inout.Status) (bool, error) {
+	status, ok := result.Field(statusField())
 	if !ok {
 		return true, nil
 	}
 
 	for _, unavailable := range config.Settings.Availability.InOutUnavailableStatuses {
-		if status == unavailable {
+		matched, err := matchStatus(status, unavailable)
+		if err != nil {
+			return false, err
+		}
+		if matched {
 			return false, nil
 		}
 	}
 	return true, nil
 }
+
+// statusField returns the configured path of the status field in the API response.
+func statusField() string {
+	if field := config.Settings.Availability.InOutStatusField; field != "" {
+		return field
+	}
+	return "inOutLocation"
+}
+
+// matchStatus reports whether a status matches an unavailable status
+// using the configured match mode.
+func matchStatus(status, unavailable string) (bool, error) {
+	ignoreCase := config.Settings.Availability.InOutMatchIgnoreCase
+	switch config.Settings.Availability.InOutMatchMode {
+	case config.MatchPrefix:
+		if ignoreCase {
+			return strings.HasPrefix(strings.ToLower(status), strings.ToLower(unavailable)), nil
+		}
+		return strings.HasPrefix(status, unavailable), nil
+	case config.MatchRegex:
+		if ignoreCase {
+			unavailable = "(?i)" + unavailable
+		}
+		re, err := regexp.Compile(unavailable)
+		if err != nil {
+			return false, fmt.Errorf("invalid status pattern %q: %w", unavailable, err)
+		}
+		return re.MatchString(status), nil
+	default:
+		if ignoreCase {
+			return strings.EqualFold(status, unavailable), nil
+		}
+		return status == unavailable, nil
+	}
+}
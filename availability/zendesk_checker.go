@@ -0,0 +1,39 @@
+package availability
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"autoassigner/zendesk"
+	"context"
+	"errors"
+	"strings"
+)
+
+// ZendeskChecker marks agents as available while their Zendesk agent status
+// is one of the configured available statuses, "online" by default. Agents
+// are found by the zendesk identifiers of the identity mapping; other
+// usernames are taken to be Zendesk user IDs, e.g. from availability_ids.
+type ZendeskChecker struct{}
+
+func (c *ZendeskChecker) IsAvailable(ctx context.Context, username string) (bool, error) {
+	id, err := identity.Lookup(ctx, username, identity.Zendesk)
+	if errors.Is(err, identity.ErrUnknown) {
+		id = username
+	} else if err != nil {
+		return false, err
+	}
+	status, err := zendesk.AgentStatus(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	available := config.Settings.Zendesk.AvailableStatuses
+	if len(available) == 0 {
+		available = []string{"online"}
+	}
+	for _, s := range available {
+		if strings.EqualFold(s, status) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
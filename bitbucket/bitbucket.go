@@ -0,0 +1,314 @@
+// Package bitbucket integrates the autoassigner with Bitbucket Cloud and
+// Bitbucket Data Center: it reads pull request webhooks and adds the selected
+// users as reviewers through the REST API of either edition.
+package bitbucket
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"autoassigner/vcs"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultApiUrl = "https://api.bitbucket.org/2.0"
+
+// Events opening a pull request, by edition.
+const (
+	cloudCreated     = "pullrequest:created"
+	dataCenterOpened = "pr:opened"
+)
+
+// VerifySignature reports whether the X-Hub-Signature header of a webhook
+// matches the payload signed with secret. Both editions sign payloads the same way.
+func VerifySignature(secret string, payload []byte, header string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(header), []byte(want))
+}
+
+// ParseEvent reads the change from a webhook payload given the X-Event-Key
+// header. It reports false for events that don't open a pull request.
+// Repositories are named workspace/repo on Cloud and PROJECT/repo on Data Center.
+func ParseEvent(eventKey string, payload []byte) (*vcs.Change, bool, error) {
+	switch eventKey {
+	case cloudCreated:
+		var event struct {
+			PullRequest struct {
+				ID     int    `json:"id"`
+				Title  string `json:"title"`
+				Author struct {
+					AccountID string `json:"account_id"`
+				} `json:"author"`
+			} `json:"pullrequest"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		}
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, false, fmt.Errorf("failed to parse %s event: %w", eventKey, err)
+		}
+		if event.PullRequest.ID == 0 || event.Repository.FullName == "" {
+			return nil, false, fmt.Errorf("%s event without a pull request", eventKey)
+		}
+		return &vcs.Change{
+			Repo:        event.Repository.FullName,
+			Number:      event.PullRequest.ID,
+			Title:       event.PullRequest.Title,
+			Author:      event.PullRequest.Author.AccountID,
+			PullRequest: true,
+		}, true, nil
+
+	case dataCenterOpened:
+		var event struct {
+			PullRequest struct {
+				ID     int    `json:"id"`
+				Title  string `json:"title"`
+				Author struct {
+					User struct {
+						Name string `json:"name"`
+					} `json:"user"`
+				} `json:"author"`
+				ToRef struct {
+					Repository struct {
+						Slug    string `json:"slug"`
+						Project struct {
+							Key string `json:"key"`
+						} `json:"project"`
+					} `json:"repository"`
+				} `json:"toRef"`
+			} `json:"pullRequest"`
+		}
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, false, fmt.Errorf("failed to parse %s event: %w", eventKey, err)
+		}
+		pr := event.PullRequest
+		if pr.ID == 0 || pr.ToRef.Repository.Slug == "" {
+			return nil, false, fmt.Errorf("%s event without a pull request", eventKey)
+		}
+		return &vcs.Change{
+			Repo:        pr.ToRef.Repository.Project.Key + "/" + pr.ToRef.Repository.Slug,
+			Number:      pr.ID,
+			Title:       pr.Title,
+			Author:      pr.Author.User.Name,
+			PullRequest: true,
+		}, true, nil
+
+	default:
+		return nil, false, nil
+	}
+}
+
+// Reviewer returns the Bitbucket identifier of a user from the identity
+// mapping: the account ID on Cloud or the username on Data Center.
+// Users without a mapped identifier are assumed to use their username.
+func Reviewer(ctx context.Context, user string) (string, error) {
+	id, err := identity.Lookup(ctx, user, identity.Bitbucket)
+	if errors.Is(err, identity.ErrUnknown) {
+		return user, nil
+	}
+	return id, err
+}
+
+// AddReviewer adds reviewer to the reviewers of the pull request of a change.
+func AddReviewer(ctx context.Context, c vcs.Change, reviewer string) error {
+	if config.Settings.Bitbucket.Edition == config.BitbucketDataCenter {
+		return addDataCenterReviewer(ctx, c, reviewer)
+	}
+	return addCloudReviewer(ctx, c, reviewer)
+}
+
+// ChangedFiles returns the paths of the files changed by the pull request of
+// a change. Renamed files are reported by their new path, deleted files by
+// their old one.
+func ChangedFiles(ctx context.Context, c vcs.Change) ([]string, error) {
+	if config.Settings.Bitbucket.Edition == config.BitbucketDataCenter {
+		return dataCenterChangedFiles(ctx, c)
+	}
+	return cloudChangedFiles(ctx, c)
+}
+
+// cloudChangedFiles reads the diffstat of a pull request on Bitbucket Cloud,
+// following its next links.
+func cloudChangedFiles(ctx context.Context, c vcs.Change) ([]string, error) {
+	type file struct {
+		Path string `json:"path"`
+	}
+	var paths []string
+	next := fmt.Sprintf("/repositories/%s/pullrequests/%d/diffstat", c.Repo, c.Number)
+	for next != "" {
+		var page struct {
+			Values []struct {
+				New *file `json:"new"`
+				Old *file `json:"old"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		if err := call(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, v := range page.Values {
+			if v.New != nil {
+				paths = append(paths, v.New.Path)
+			} else if v.Old != nil {
+				paths = append(paths, v.Old.Path)
+			}
+		}
+		next = page.Next
+	}
+	return paths, nil
+}
+
+// dataCenterChangedFiles reads the changes of a pull request on Bitbucket
+// Data Center page by page.
+func dataCenterChangedFiles(ctx context.Context, c vcs.Change) ([]string, error) {
+	project, repo, ok := strings.Cut(c.Repo, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid Bitbucket repository %s, expected PROJECT/repo", c.Repo)
+	}
+	var paths []string
+	for start := 0; ; {
+		var page struct {
+			Values []struct {
+				Path struct {
+					ToString string `json:"toString"`
+				} `json:"path"`
+			} `json:"values"`
+			IsLastPage    bool `json:"isLastPage"`
+			NextPageStart int  `json:"nextPageStart"`
+		}
+		path := fmt.Sprintf("/rest/api/1.0/projects/%s/repos/%s/pull-requests/%d/changes?limit=500&start=%d", project, repo, c.Number, start)
+		if err := call(ctx, http.MethodGet, path, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, v := range page.Values {
+			paths = append(paths, v.Path.ToString)
+		}
+		if page.IsLastPage {
+			return paths, nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+// addCloudReviewer adds a reviewer on Bitbucket Cloud. The API replaces the
+// whole reviewer list, so the current reviewers are read and sent back along
+// with the new one.
+func addCloudReviewer(ctx context.Context, c vcs.Change, accountID string) error {
+	path := fmt.Sprintf("/repositories/%s/pullrequests/%d", c.Repo, c.Number)
+	var pr struct {
+		Title     string `json:"title"`
+		Reviewers []struct {
+			AccountID string `json:"account_id"`
+		} `json:"reviewers"`
+	}
+	if err := call(ctx, http.MethodGet, path, nil, &pr); err != nil {
+		return err
+	}
+
+	type account struct {
+		AccountID string `json:"account_id"`
+	}
+	reviewers := []account{}
+	for _, r := range pr.Reviewers {
+		if r.AccountID == accountID {
+			return nil
+		}
+		reviewers = append(reviewers, account{AccountID: r.AccountID})
+	}
+	reviewers = append(reviewers, account{AccountID: accountID})
+	body := map[string]interface{}{"title": pr.Title, "reviewers": reviewers}
+	return call(ctx, http.MethodPut, path, body, nil)
+}
+
+// addDataCenterReviewer adds a reviewer on Bitbucket Data Center.
+func addDataCenterReviewer(ctx context.Context, c vcs.Change, username string) error {
+	project, repo, ok := strings.Cut(c.Repo, "/")
+	if !ok {
+		return fmt.Errorf("invalid Bitbucket repository %s, expected PROJECT/repo", c.Repo)
+	}
+	path := fmt.Sprintf("/rest/api/1.0/projects/%s/repos/%s/pull-requests/%d/participants", project, repo, c.Number)
+	body := map[string]interface{}{
+		"user": map[string]string{"name": username},
+		"role": "REVIEWER",
+	}
+	return call(ctx, http.MethodPost, path, body, nil)
+}
+
+// call sends a request to the Bitbucket API, authenticated with the access
+// token or else basic auth, and decodes the response into result unless it is nil.
+// path is relative to the API URL, or an absolute URL taken from a next link.
+func call(ctx context.Context, method, path string, body, result interface{}) error {
+	conf := config.Settings.Bitbucket
+	base := conf.ApiUrl
+	if base == "" {
+		base = defaultApiUrl
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	target := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		target = strings.TrimSuffix(base, "/") + path
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case conf.Token != "":
+		req.Header.Set("Authorization", "Bearer "+conf.Token)
+	case conf.Username != "":
+		req.SetBasicAuth(conf.Username, conf.Password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Bitbucket request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// Cloud reports {"error": {...}}, Data Center {"errors": [...]}
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		msg := apiErr.Error.Message
+		if msg == "" && len(apiErr.Errors) > 0 {
+			msg = apiErr.Errors[0].Message
+		}
+		if msg != "" {
+			return fmt.Errorf("Bitbucket request failed: %s: %s", resp.Status, msg)
+		}
+		return fmt.Errorf("Bitbucket request failed: unexpected status %s", resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,181 @@
+package bitbucket
+
+import (
+	"autoassigner/config"
+	"autoassigner/vcs"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		eventKey string
+		payload  string
+		want     *vcs.Change
+		wantErr  bool
+	}{
+		{
+			eventKey: "pullrequest:created",
+			payload:  `{"pullrequest": {"id": 4, "title": "Add cache", "author": {"account_id": "557058:a1"}}, "repository": {"full_name": "acme/api"}}`,
+			want:     &vcs.Change{Repo: "acme/api", Number: 4, Title: "Add cache", Author: "557058:a1", PullRequest: true},
+		},
+		{
+			eventKey: "pr:opened",
+			payload:  `{"pullRequest": {"id": 9, "title": "Fix", "author": {"user": {"name": "jdoe"}}, "toRef": {"repository": {"slug": "api", "project": {"key": "ACME"}}}}}`,
+			want:     &vcs.Change{Repo: "ACME/api", Number: 9, Title: "Fix", Author: "jdoe", PullRequest: true},
+		},
+		{eventKey: "pullrequest:fulfilled", payload: `{}`},
+		{eventKey: "diagnostics:ping", payload: `{}`},
+		{eventKey: "pr:opened", payload: `{"pullRequest": {}}`, wantErr: true},
+		{eventKey: "pullrequest:created", payload: `[`, wantErr: true},
+	}
+	for i, tt := range tests {
+		got, ok, err := ParseEvent(tt.eventKey, []byte(tt.payload))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d ParseEvent(%s) error = %v, wantErr %v", i, tt.eventKey, err, tt.wantErr)
+			continue
+		}
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d ParseEvent(%s) = %+v, %v, want %+v", i, tt.eventKey, got, ok, tt.want)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"pullrequest": {}}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		secret string
+		header string
+		want   bool
+	}{
+		{"secret", signature, true},
+		{"other", signature, false},
+		{"secret", strings.ToUpper(signature), false},
+		{"secret", "", false},
+	}
+	for i, tt := range tests {
+		if got := VerifySignature(tt.secret, payload, tt.header); got != tt.want {
+			t.Errorf("#%d VerifySignature(%s, %q) = %v, want %v", i, tt.secret, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestAddReviewer(t *testing.T) {
+	var requests []string
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"title": "Add cache", "reviewers": [{"account_id": "557058:b2"}]}`))
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		if strings.Contains(r.URL.Path, "/pull-requests/10/") {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"errors": [{"message": "The user is the author of the pull request."}]}`))
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	ctx := context.Background()
+
+	// Cloud with an app password keeps the reviewers already requested
+	config.Settings.Bitbucket = config.BitbucketConfig{ApiUrl: server.URL, Username: "bot", Password: "app-password"}
+	if err := AddReviewer(ctx, vcs.Change{Repo: "acme/api", Number: 4}, "557058:a1"); err != nil {
+		t.Fatalf("AddReviewer() on cloud error = %v", err)
+	}
+	// Adding a reviewer who is already requested changes nothing
+	if err := AddReviewer(ctx, vcs.Change{Repo: "acme/api", Number: 4}, "557058:b2"); err != nil {
+		t.Fatalf("AddReviewer() on cloud error = %v", err)
+	}
+
+	// Data Center with an HTTP access token
+	config.Settings.Bitbucket = config.BitbucketConfig{Edition: config.BitbucketDataCenter, ApiUrl: server.URL, Token: "token"}
+	if err := AddReviewer(ctx, vcs.Change{Repo: "ACME/api", Number: 9}, "jdoe"); err != nil {
+		t.Fatalf("AddReviewer() on datacenter error = %v", err)
+	}
+	err := AddReviewer(ctx, vcs.Change{Repo: "ACME/api", Number: 10}, "jdoe")
+	if err == nil || !strings.Contains(err.Error(), "author of the pull request") {
+		t.Errorf("AddReviewer() error = %v, want the API's message", err)
+	}
+
+	wantRequests := []string{
+		"GET /repositories/acme/api/pullrequests/4 Basic Ym90OmFwcC1wYXNzd29yZA==",
+		"PUT /repositories/acme/api/pullrequests/4 Basic Ym90OmFwcC1wYXNzd29yZA==",
+		"GET /repositories/acme/api/pullrequests/4 Basic Ym90OmFwcC1wYXNzd29yZA==",
+		"POST /rest/api/1.0/projects/ACME/repos/api/pull-requests/9/participants Bearer token",
+		"POST /rest/api/1.0/projects/ACME/repos/api/pull-requests/10/participants Bearer token",
+	}
+	if !reflect.DeepEqual(requests, wantRequests) {
+		t.Errorf("requests = %q, want %q", requests, wantRequests)
+	}
+	wantCloud := map[string]interface{}{
+		"title": "Add cache",
+		"reviewers": []interface{}{
+			map[string]interface{}{"account_id": "557058:b2"},
+			map[string]interface{}{"account_id": "557058:a1"},
+		},
+	}
+	if len(bodies) < 2 || !reflect.DeepEqual(bodies[0], wantCloud) {
+		t.Fatalf("cloud request bodies = %v, want %v first", bodies, wantCloud)
+	}
+	wantDataCenter := map[string]interface{}{"user": map[string]interface{}{"name": "jdoe"}, "role": "REVIEWER"}
+	if !reflect.DeepEqual(bodies[1], wantDataCenter) {
+		t.Errorf("datacenter request body = %v, want %v", bodies[1], wantDataCenter)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repositories/acme/api/pullrequests/4/diffstat":
+			if r.URL.Query().Get("page") == "2" {
+				w.Write([]byte(`{"values": [{"old": {"path": "old.txt"}, "new": null}]}`))
+				return
+			}
+			w.Write([]byte(`{"values": [{"new": {"path": "api/user.go"}}, {"old": {"path": "a.md"}, "new": {"path": "docs/a.md"}}], "next": "` + server.URL + r.URL.Path + `?page=2"}`))
+		case "/rest/api/1.0/projects/ACME/repos/api/pull-requests/9/changes":
+			if r.URL.Query().Get("start") == "2" {
+				w.Write([]byte(`{"values": [{"path": {"toString": "web/app.ts"}}], "isLastPage": true}`))
+				return
+			}
+			w.Write([]byte(`{"values": [{"path": {"toString": "api/user.go"}}, {"path": {"toString": "README.md"}}], "isLastPage": false, "nextPageStart": 2}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	ctx := context.Background()
+
+	config.Settings.Bitbucket = config.BitbucketConfig{ApiUrl: server.URL}
+	files, err := ChangedFiles(ctx, vcs.Change{Repo: "acme/api", Number: 4})
+	if want := []string{"api/user.go", "docs/a.md", "old.txt"}; err != nil || !reflect.DeepEqual(files, want) {
+		t.Errorf("ChangedFiles() on cloud = %v, %v, want %v", files, err, want)
+	}
+
+	config.Settings.Bitbucket = config.BitbucketConfig{Edition: config.BitbucketDataCenter, ApiUrl: server.URL}
+	files, err = ChangedFiles(ctx, vcs.Change{Repo: "ACME/api", Number: 9})
+	if want := []string{"api/user.go", "README.md", "web/app.ts"}; err != nil || !reflect.DeepEqual(files, want) {
+		t.Errorf("ChangedFiles() on datacenter = %v, %v, want %v", files, err, want)
+	}
+}
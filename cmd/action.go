@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/github"
+	"autoassigner/identity"
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"autoassigner/vcs"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	actionGroup      string
+	actionAssignee   bool
+	actionDryRun     bool
+	actionCodeOwners bool
+)
+
+// actionCmd runs the assignment as a step of a GitHub Actions workflow.
+var actionCmd = &cobra.Command{
+	Use:   "action",
+	Short: "Assign a pull request or issue from a GitHub Actions workflow",
+	Long: `Run as a GitHub Action: read the pull_request, pull_request_target or
+issues event from GITHUB_EVENT_PATH, choose the group with --group or the
+routes in the config, assign a user and request their review of the pull
+request, or make them the assignee of the issue.
+
+The author of a pull request is never assigned. With --codeowners only
+members of the group who own one of the changed files according to the
+repository's CODEOWNERS file are assigned, unless none of them is in
+the group.
+
+The group, assignee and GitHub login are written to GITHUB_OUTPUT as the
+outputs group, assignee and login, and deferred when quiet hours delay
+the assignment.
+
+Example:
+  autoassigner action --group backend-reviewers`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		eventName, eventPath := os.Getenv("GITHUB_EVENT_NAME"), os.Getenv("GITHUB_EVENT_PATH")
+		if eventName == "" || eventPath == "" {
+			return fmt.Errorf("GITHUB_EVENT_NAME and GITHUB_EVENT_PATH must be set; run this command from a GitHub Actions workflow")
+		}
+		payload, err := os.ReadFile(eventPath)
+		if err != nil {
+			return fmt.Errorf("failed to read event: %w", err)
+		}
+		change, err := github.ParseEvent(eventName, payload)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		groupName := actionGroup
+		if groupName == "" {
+			var ok bool
+			if groupName, ok, err = vcs.RouteChange(ctx, config.Settings.Routes, change, github.ChangedFiles); err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Println(l10n.T(l10n.MsgNoRoute, "Change", change))
+				return nil
+			}
+		}
+
+		opts := runner.AssignOptions{DryRun: actionDryRun}
+		if change.PullRequest {
+			// Authors can't review their own pull requests
+			author, err := vcs.AuthorUser(ctx, *change, identity.GitHub)
+			if err != nil {
+				return err
+			}
+			opts.Exclude = []string{author}
+			if actionCodeOwners {
+				if opts.Eligible, err = codeOwnerUsers(ctx, change, groupName); err != nil {
+					return err
+				}
+			}
+		}
+		result, err := runner.AssignUser(ctx, groupName, opts)
+		if err != nil {
+			return assignError(err)
+		}
+		outputs := [][2]string{{"group", groupName}}
+		if result.ID != "" {
+			outputs = append(outputs, [2]string{"id", result.ID})
+		}
+		if result.Deferred != "" {
+			return setActionOutputs(append(outputs, [2]string{"deferred", result.Deferred}))
+		}
+
+		login, err := github.Login(ctx, result.User)
+		if err != nil {
+			return err
+		}
+		if !actionDryRun {
+			if change.PullRequest && !actionAssignee {
+				if err := github.RequestReview(ctx, *change, login); err != nil {
+					return err
+				}
+				fmt.Println(l10n.T(l10n.MsgReviewRequested, "Change", change, "Login", login))
+			} else {
+				if err := github.AddAssignee(ctx, *change, login); err != nil {
+					return err
+				}
+				fmt.Println(l10n.T(l10n.MsgAssigneeAdded, "Change", change, "Login", login))
+			}
+		}
+		return setActionOutputs(append(outputs, [2]string{"assignee", result.User}, [2]string{"login", login}))
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// codeOwnerUsers returns the members of a group who own a file changed by a
+// pull request according to its CODEOWNERS file. When the repository has no
+// CODEOWNERS file or none of the owners is a member, it returns nil, so the
+// whole group is eligible.
+func codeOwnerUsers(ctx context.Context, change *vcs.Change, groupName string) ([]string, error) {
+	owners, err := github.CodeOwners(ctx, *change)
+	if err != nil || owners == nil {
+		return nil, err
+	}
+	if change.Paths == nil {
+		if change.Paths, err = github.ChangedFiles(ctx, *change); err != nil {
+			return nil, err
+		}
+	}
+	users, err := github.OwnerUsers(ctx, owners.OwnersOf(change.Paths))
+	if err != nil {
+		return nil, err
+	}
+
+	_, members, err := runner.GetCounts(groupName)
+	if err != nil {
+		return nil, assignError(err)
+	}
+	isOwner := make(map[string]bool, len(users))
+	for _, user := range users {
+		isOwner[user] = true
+	}
+	var eligible []string
+	for _, member := range members {
+		if isOwner[member] {
+			eligible = append(eligible, member)
+		}
+	}
+	if len(eligible) == 0 {
+		fmt.Println(l10n.T(l10n.MsgNoCodeOwners, "Change", change, "Group", groupName))
+	}
+	return eligible, nil
+}
+
+// setActionOutputs appends step outputs to the file named by GITHUB_OUTPUT.
+// Outside of a workflow, where it is not set, the outputs are dropped.
+func setActionOutputs(outputs [][2]string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write outputs: %w", err)
+	}
+	defer f.Close()
+	for _, output := range outputs {
+		if _, err := fmt.Fprintf(f, "%s=%s\n", output[0], output[1]); err != nil {
+			return fmt.Errorf("failed to write outputs: %w", err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	actionCmd.Flags().StringVar(&actionGroup, "group", "", "Group to assign from instead of the one chosen by the routes")
+	actionCmd.Flags().BoolVar(&actionAssignee, "assignee", false, "Make the user the assignee of pull requests instead of requesting their review")
+	actionCmd.Flags().BoolVar(&actionCodeOwners, "codeowners", false, "Only assign pull requests to members of the group who own a changed file in CODEOWNERS")
+	actionCmd.Flags().BoolVar(&actionDryRun, "dry-run", false, "Select a user and set the outputs without updating state or GitHub")
+	rootCmd.AddCommand(actionCmd)
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"autoassigner/history"
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	anonymizeUser      string
+	anonymizeBefore    string
+	anonymizePseudonym string
+	anonymizeExport    string
+	anonymizeDryRun    bool
+)
+
+// anonymizeCmd replaces a user with a pseudonym in the stored state of every group.
+var anonymizeCmd = &cobra.Command{
+	Use:   "anonymize",
+	Short: "Replace a user with a pseudonym in the logs and counts of every group",
+	Long: `Replace a user with a pseudonym in the stored state of every group, such
+as for a deletion request under the GDPR: the user and actor fields of
+their assignment, skip, decline and duration log records, their open
+assignments and their counts. Counts move to the pseudonym, so totals,
+fairness and statistics stay the same. Names listed as the user's
+aliases are replaced too.
+
+Without --before, the user must no longer be a member of any group, and
+their skip debts, times of last assignment and pauses are dropped. With
+--before, only records and daily counts from before that time are
+replaced, so current members can be anonymized after a retention period.
+
+--export writes the user's records as they were before to a JSON file,
+such as to answer an access request; with --dry-run nothing is rewritten.
+Earlier versions in the git history of the data directory and archives
+of deleted groups are not rewritten.
+
+Example:
+  autoassigner anonymize --user alice --export alice.json
+  autoassigner anonymize --user bob --before 2024-01-01`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		if anonymizeUser == "" {
+			return fmt.Errorf("--user is required")
+		}
+		opts := runner.AnonymizeOptions{Pseudonym: anonymizePseudonym, DryRun: anonymizeDryRun}
+		if anonymizeBefore != "" {
+			before, err := parseAnonymizeBefore(anonymizeBefore, time.Now())
+			if err != nil {
+				return err
+			}
+			opts.Before = before
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		result, err := runner.AnonymizeUser(ctx, anonymizeUser, opts)
+		if err != nil {
+			if errors.Is(err, runner.ErrConfig) {
+				return wrapLocalized(l10n.MsgConfigError, err)
+			}
+			return fmt.Errorf("failed to anonymize user: %w", err)
+		}
+		if anonymizeExport != "" {
+			data, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				return err
+			}
+			// The export holds personal data, readable by the owner only
+			if err := os.WriteFile(anonymizeExport, append(data, '\n'), 0600); err != nil {
+				return fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+		msg := l10n.MsgUserAnonymized
+		if anonymizeDryRun {
+			msg = l10n.MsgUserAnonymizeDryRun
+		}
+		fmt.Println(l10n.T(msg, "User", anonymizeUser, "Pseudonym", result.Pseudonym, "Records", result.RecordCount(), "Groups", len(result.Groups)))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// parseAnonymizeBefore parses the time to anonymize records before: a date
+// such as 2024-01-01, the start of that day in the local time of the host,
+// a time in RFC 3339 format, or an age such as 365d before now.
+func parseAnonymizeBefore(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := history.ParseWindow(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --before %q: use a date such as 2024-01-01, an RFC 3339 time or an age such as 365d", value)
+}
+
+func init() {
+	anonymizeCmd.Flags().StringVar(&anonymizeUser, "user", "", "User to anonymize")
+	anonymizeCmd.Flags().StringVar(&anonymizeBefore, "before", "", "Only anonymize records from before a date, an RFC 3339 time or an age such as 365d")
+	anonymizeCmd.Flags().StringVar(&anonymizePseudonym, "pseudonym", "", "Name to replace the user with; a random one such as anon-3f9a1c2e by default")
+	anonymizeCmd.Flags().StringVar(&anonymizeExport, "export", "", "Write the records of the user as they were before to a JSON file")
+	anonymizeCmd.Flags().BoolVar(&anonymizeDryRun, "dry-run", false, "Find the records of the user without rewriting them")
+	rootCmd.AddCommand(anonymizeCmd)
+}
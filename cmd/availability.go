@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	probeUser    string
+	probeChecker string
+	probeJSON    bool
+)
+
+// availabilityCmd asks the availability checker of a group about its users without assigning.
+var availabilityCmd = &cobra.Command{
+	Use:   "availability <group>",
+	Short: "Ask the availability checker of a group about its users",
+	Long: `Ask the availability checker of a group about every member, or only
+--user, and print whether assignments would take each as available,
+why, and how long the checker took to answer. Nothing is assigned and
+no state changes, so integrations can be debugged without moving the
+rotation.
+
+Users are asked about one by one and without the availability cache;
+checkers that can check the whole group in one call, as assignments
+do, are also timed for that call. Users in always_available or
+never_available aren't asked about, and paused users are reported as
+unavailable along with the checker's answer. Failed checks show their
+error and the availability on_availability_error assumes.
+
+--availability asks another checker instead, e.g. to compare it with
+the configured one before switching.
+
+Examples:
+  autoassigner availability team-alpha
+  autoassigner availability team-alpha --user alice --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		report, err := runner.ProbeAvailability(ctx, args[0], probeUser, probeChecker)
+		if err != nil {
+			switch {
+			case errors.Is(err, runner.ErrInvalidGroup):
+				return withGroupHint(err)
+			case errors.Is(err, runner.ErrInvalidOption):
+				return err
+			default:
+				return fmt.Errorf("failed to probe availability: %w", err)
+			}
+		}
+
+		if probeJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		}
+
+		fmt.Printf("Checker: %s (on_availability_error: %s)\n", report.Checker, report.Policy)
+		if report.Bulk != nil {
+			if report.Bulk.Error != "" {
+				fmt.Printf("Bulk check: failed after %.1fms: %s\n", report.Bulk.LatencyMS, report.Bulk.Error)
+			} else {
+				fmt.Printf("Bulk check: %.1fms\n", report.Bulk.LatencyMS)
+			}
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "USER\tAVAILABLE\tLATENCY\tEXPLANATION")
+		for _, p := range report.Users {
+			latency := "-"
+			if p.Asked {
+				latency = fmt.Sprintf("%.1fms", p.LatencyMS)
+			}
+			fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", p.User, p.Available, latency, p.Explanation)
+		}
+		return w.Flush()
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	availabilityCmd.Flags().StringVar(&probeUser, "user", "", "Only ask about this member")
+	availabilityCmd.Flags().StringVar(&probeChecker, "availability", "", "Availability checker to ask instead of the group's, e.g. inout")
+	availabilityCmd.Flags().BoolVar(&probeJSON, "json", false, "Print the report as JSON")
+	rootCmd.AddCommand(availabilityCmd)
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchCounts   bool
+	watchInterval int
+	countsPeriod  string
+)
+
+// countsCmd displays the assignment counts for a group, optionally refreshing them.
+var countsCmd = &cobra.Command{
+	Use:   "counts [groupname]",
+	Short: "Display assignment counts for a group",
+	Long: `Display the current assignment counts for a group.
+
+A glob pattern, such as 'platform/*' or 'oncall-*', displays the counts of
+every matching group followed by the total of each user across them.
+
+With --watch the display is refreshed every --interval seconds and
+counts that changed since the previous refresh are highlighted.
+
+With --period only the assignments of the current day, week (starting
+Monday) or month are counted.
+
+Example:
+  autoassigner counts team-alpha --watch --interval 10
+  autoassigner counts team-alpha --period week
+  autoassigner counts 'platform/*'`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groups, err := targetGroups(args[0])
+		if err != nil {
+			return err
+		}
+		if !watchCounts {
+			_, err := printGroupsCounts(os.Stdout, groups, nil)
+			return err
+		}
+		if watchInterval <= 0 {
+			return fmt.Errorf("--interval must be a positive number of seconds")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return watchGroupCounts(ctx, os.Stdout, groups, time.Duration(watchInterval)*time.Second)
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	countsCmd.Flags().BoolVarP(&watchCounts, "watch", "w", false, "Refresh the counts display until interrupted")
+	countsCmd.Flags().IntVarP(&watchInterval, "interval", "n", 5, "Seconds between refreshes in watch mode")
+	countsCmd.Flags().StringVar(&countsPeriod, "period", "", "Only count assignments of the current period: day, week or month")
+	rootCmd.AddCommand(countsCmd)
+}
+
+// fetchGroupCounts loads the counts of a group and wraps errors for display.
+func fetchGroupCounts(groupName string) (map[string]int, []string, error) {
+	counts, orderedUsers, err := runner.GetCounts(groupName)
+	if err != nil {
+		if errors.Is(err, runner.ErrInvalidGroup) {
+			return nil, nil, withGroupHint(err)
+		}
+		return nil, nil, fmt.Errorf("failed to get counts: %w", err)
+	}
+	if countsPeriod != "" {
+		if counts, err = runner.PeriodCounts(groupName, countsPeriod); err != nil {
+			return nil, nil, fmt.Errorf("failed to get counts: %w", err)
+		}
+	}
+	return counts, orderedUsers, nil
+}
+
+// showGroupCounts prints the assignment counts for a group once.
+func showGroupCounts(groupName string) error {
+	_, err := printGroupsCounts(os.Stdout, []string{groupName}, nil)
+	return err
+}
+
+// watchGroupCounts redraws the counts for groups every interval until ctx is cancelled.
+func watchGroupCounts(ctx context.Context, w io.Writer, groups []string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous map[string]map[string]int
+	for {
+		// Clear the screen and move the cursor home before redrawing
+		fmt.Fprint(w, "\033[H\033[2J")
+		fmt.Fprintf(w, "Every %s: %s\n\n", interval, time.Now().Format(time.RFC3339))
+		counts, err := printGroupsCounts(w, groups, previous)
+		if err != nil {
+			return err
+		}
+		previous = counts
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// printGroupsCounts writes the counts and declines of each of groups and,
+// for several groups, the total of every user across them. Changes since the
+// previous counts, when given, are highlighted. It returns the counts of
+// every group.
+func printGroupsCounts(w io.Writer, groups []string, previous map[string]map[string]int) (map[string]map[string]int, error) {
+	all := make(map[string]map[string]int, len(groups))
+	for i, group := range groups {
+		counts, orderedUsers, err := fetchGroupCounts(group)
+		if err != nil {
+			if len(groups) > 1 {
+				err = fmt.Errorf("group %s: %w", group, err)
+			}
+			return nil, err
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		var last map[string]int
+		if previous != nil {
+			last = previous[group]
+			if last == nil {
+				last = map[string]int{}
+			}
+		}
+		printCounts(w, group, counts, orderedUsers, last)
+		if err := printDeclines(w, group, orderedUsers); err != nil {
+			return nil, err
+		}
+		all[group] = counts
+	}
+	if len(groups) > 1 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, l10n.T(l10n.MsgCountsTotalHeader, "Count", len(groups)))
+		var last map[string]int
+		if previous != nil {
+			last = sumCounts(previous)
+		}
+		total := sumCounts(all)
+		for _, user := range sortedUsers(total) {
+			if last != nil && total[user] != last[user] {
+				fmt.Fprintf(w, "  \033[1;32m%s: %d (%+d)\033[0m\n", user, total[user], total[user]-last[user])
+				continue
+			}
+			fmt.Fprintf(w, "  %s: %d\n", user, total[user])
+		}
+	}
+	return all, nil
+}
+
+// sumCounts adds up the counts of every user across groups.
+func sumCounts(groups map[string]map[string]int) map[string]int {
+	total := map[string]int{}
+	for _, counts := range groups {
+		for user, n := range counts {
+			total[user] += n
+		}
+	}
+	return total
+}
+
+// sortedUsers returns the users of counts in alphabetical order.
+func sortedUsers(counts map[string]int) []string {
+	users := make([]string, 0, len(counts))
+	for user := range counts {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// printCounts writes the counts for a group in config order.
+// When previous counts are given, changed entries are highlighted with their delta.
+func printCounts(w io.Writer, groupName string, counts map[string]int, orderedUsers []string, previous map[string]int) {
+	fmt.Fprintln(w, l10n.T(l10n.MsgCountsHeader, "Group", groupName))
+	for _, user := range orderedUsers {
+		if previous != nil && counts[user] != previous[user] {
+			fmt.Fprintf(w, "  \033[1;32m%s: %d (%+d)\033[0m\n", user, counts[user], counts[user]-previous[user])
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %d\n", user, counts[user])
+	}
+}
+
+// printDeclines writes the declines of the current period for a group.
+// Nothing is printed when the group has no budget and nobody declined.
+func printDeclines(w io.Writer, groupName string, orderedUsers []string) error {
+	status, err := runner.GetDeclineStatus(context.Background(), groupName)
+	if err != nil {
+		return fmt.Errorf("failed to get declines: %w", err)
+	}
+
+	total := 0
+	for _, used := range status.Used {
+		total += used
+	}
+	if status.Budget.Max == 0 && total == 0 {
+		return nil
+	}
+
+	limit := "-"
+	if status.Budget.Max > 0 {
+		limit = fmt.Sprint(status.Budget.Max)
+	}
+	fmt.Fprintln(w, l10n.T(l10n.MsgDeclinesHeader, "Period", status.Budget.Period, "Max", limit))
+	for _, user := range orderedUsers {
+		fmt.Fprintf(w, "  %s: %d\n", user, status.Used[user])
+	}
+	return nil
+}
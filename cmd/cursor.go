@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cursorUser string
+	cursorLast bool
+)
+
+// setCursorCmd sets the rotation position of a group at a user.
+var setCursorCmd = &cobra.Command{
+	Use:   "set-cursor [groupname]",
+	Short: "Set the rotation position of a group at a user",
+	Long: `Set the rotation position of a group so that the given user is next in
+turn, e.g. to start a new rotation at a specific person or correct one
+after the user list changed. With --last the user counts as the last
+assignee instead, and the user after them is next.
+
+The position is stored with the name of the user, so fsck and
+rebuild-counts keep it until the next assignment.
+
+Example:
+  autoassigner set-cursor team-alpha --user alice
+  autoassigner set-cursor team-alpha --user alice --last`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		groupName := args[0]
+		next, err := runner.SetCursor(ctx, groupName, cursorUser, cursorLast)
+		if err != nil {
+			switch {
+			case errors.Is(err, runner.ErrInvalidGroup):
+				return withGroupHint(err)
+			case errors.Is(err, runner.ErrConfig):
+				return wrapLocalized(l10n.MsgConfigError, err)
+			default:
+				return fmt.Errorf("failed to set cursor: %w", err)
+			}
+		}
+		fmt.Println(l10n.T(l10n.MsgCursorSet, "Group", groupName, "User", next))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	setCursorCmd.Flags().StringVar(&cursorUser, "user", "", "User to set the rotation position at")
+	setCursorCmd.Flags().BoolVar(&cursorLast, "last", false, "Make the user the last assignee rather than the next")
+	setCursorCmd.MarkFlagRequired("user")
+	addLockFlags(setCursorCmd)
+	rootCmd.AddCommand(setCursorCmd)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+var declineReason string
+
+// declineCmd records that a user declined an assignment, enforcing the group's decline budget.
+var declineCmd = &cobra.Command{
+	Use:   "decline [groupname] [user]",
+	Short: "Record that a user declined an assignment",
+	Long: `Record that a user declined or snoozed an assignment.
+
+When the group configures a decline_budget, declines beyond the budget
+for the current period are rejected. Run the assignment again to pick
+a new assignee after a decline.
+
+Example:
+  autoassigner decline team-alpha alice --reason "on call this week"`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		groupName, user := args[0], args[1]
+		status, err := runner.Decline(ctx, groupName, user, declineReason)
+		if err != nil {
+			switch {
+			case errors.Is(err, runner.ErrInvalidGroup):
+				return withGroupHint(err)
+			case errors.Is(err, runner.ErrDeclineBudget):
+				return wrapLocalized(l10n.MsgDeclineBudgetError, err)
+			case errors.Is(err, runner.ErrConfig):
+				return wrapLocalized(l10n.MsgConfigError, err)
+			default:
+				return fmt.Errorf("failed to record decline: %w", err)
+			}
+		}
+
+		fmt.Println(l10n.T(l10n.MsgDeclineRecorded, "User", user, "Group", groupName))
+		if status.Budget.Max > 0 {
+			fmt.Println(l10n.T(l10n.MsgDeclineBudgetStatus, "Used", status.Used[user], "Max", status.Budget.Max, "Period", status.Budget.Period))
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	declineCmd.Flags().StringVar(&declineReason, "reason", "", "Reason for the decline, stored in the declines log")
+	addLockFlags(declineCmd)
+	rootCmd.AddCommand(declineCmd)
+}
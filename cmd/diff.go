@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffOld []string
+	diffNew []string
+	diffRev string
+)
+
+// diffCmd explains how a change of the group configs affects the rotations.
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Explain the rotation impact of a change to group configs",
+	Long: `Compare two versions of the group configs and explain how the change
+affects every group: groups added and removed, users added, removed and
+reordered, other settings changed such as the strategy or its options,
+and for round robin groups who is next in turn before and after the
+change, from the stored rotation position. As the position is the index
+of the last assignee in the user list, adding or removing users before it
+makes someone else next, or the same user again.
+
+The old version is read from --old, or else from the config directories
+at a git revision (--rev, HEAD by default). The new version is read from
+--new, or else from the config directories. Both flags take several
+directories, which are read like a conf_dir list. The command fails when
+a new config is invalid, so it can review rotation changes in CI.
+
+Example:
+  autoassigner diff
+  autoassigner diff --rev origin/main
+  autoassigner diff --old /tmp/main/etc --new etc`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		newDirs := diffNew
+		if len(newDirs) == 0 {
+			newDirs = config.Settings.Storage.ConfDir
+		}
+		newFiles, err := runner.ReadGroupFiles(newDirs)
+		if err != nil {
+			return fmt.Errorf("failed to read new configs: %w", err)
+		}
+		var oldFiles map[string][]byte
+		if len(diffOld) > 0 {
+			oldFiles, err = runner.ReadGroupFiles(diffOld)
+		} else {
+			oldFiles, err = runner.ReadGitGroupFiles(config.Settings.Storage.ConfDir, diffRev)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read old configs: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		diffs, err := runner.DiffGroupConfigs(ctx, oldFiles, newFiles)
+		if err != nil {
+			return err
+		}
+		printDiffs(os.Stdout, diffs)
+
+		invalid := 0
+		for _, d := range diffs {
+			if d.Invalid != "" {
+				invalid++
+			}
+		}
+		if invalid > 0 {
+			return &exitCodeError{code: exitConfig, err: fmt.Errorf("%d changed group config(s) are invalid", invalid)}
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	diffCmd.Flags().StringSliceVar(&diffOld, "old", nil, "Directories of the old group configs (default the config directories at --rev)")
+	diffCmd.Flags().StringSliceVar(&diffNew, "new", nil, "Directories of the new group configs (default the config directories)")
+	diffCmd.Flags().StringVar(&diffRev, "rev", "HEAD", "Git revision of the old group configs when --old is not given")
+	rootCmd.AddCommand(diffCmd)
+}
+
+// printDiffs writes the explanation of each group diff.
+func printDiffs(w io.Writer, diffs []runner.GroupDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "No group configs changed")
+		return
+	}
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%s: %s\n", d.Group, d.Status)
+		if d.Invalid != "" {
+			fmt.Fprintf(w, "  invalid config: %s\n", d.Invalid)
+			continue
+		}
+		if d.Status == runner.DiffRemoved {
+			continue
+		}
+		if len(d.UsersAdded) > 0 {
+			fmt.Fprintf(w, "  users added: %s\n", strings.Join(d.UsersAdded, ", "))
+		}
+		if len(d.UsersRemoved) > 0 {
+			fmt.Fprintf(w, "  users removed: %s\n", strings.Join(d.UsersRemoved, ", "))
+		}
+		if d.Reordered {
+			fmt.Fprintln(w, "  users reordered")
+		}
+		for _, s := range d.Settings {
+			fmt.Fprintf(w, "  %s: %s -> %s\n", s.Key, unsetIfEmpty(s.Old), unsetIfEmpty(s.New))
+		}
+		if c := d.Cursor; c != nil {
+			last := fmt.Sprintf("position %d", c.LastIndex+1)
+			if c.LastUser != "" {
+				last = fmt.Sprintf("%s (position %d)", c.LastUser, c.LastIndex+1)
+			}
+			if c.Shifted() {
+				fmt.Fprintf(w, "  rotation: last assigned %s; next in turn was %s, becomes %s\n", last, c.NextBefore, c.NextAfter)
+			} else {
+				fmt.Fprintf(w, "  rotation: last assigned %s; next in turn stays %s\n", last, c.NextAfter)
+			}
+		}
+	}
+}
+
+func unsetIfEmpty(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
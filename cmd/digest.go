@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/notify"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	sendDigest     bool
+	digestTemplate string
+)
+
+// digestCmd renders the weekly digest of the groups.
+var digestCmd = &cobra.Command{
+	Use:   "digest [group...]",
+	Short: "Summarize the assignments of the groups over the past week",
+	Long: `Summarize the assignments, skips and declines of the groups over the
+past seven days, per user and with how evenly they were spread, and print
+the summary. Groups may be patterns such as team-*; without any, the
+groups of digest.groups in the config are summarized, or every group.
+
+The summary is rendered with the Go template of digest.template, or
+--template, which is executed with the digest: .Since, .Until and
+.Groups, each with .Group, .Assignments, .Skips, .Declines, .Users
+(.User, .Assignments, .Share, .Skips, .Declines) and .Fairness (.Mean,
+.Spread, .Busiest, .MaxAboveMean). date and percent format times and
+shares.
+
+With --send the summary is sent to digest.notifiers instead of printed.
+"autoassigner serve" sends it every week on digest.day at digest.time;
+run this from cron instead when no server runs.
+
+Example:
+  autoassigner digest team-*
+  autoassigner digest --send`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		conf := config.Settings.Digest
+		if len(args) > 0 {
+			conf.Groups = args
+		}
+		if digestTemplate != "" {
+			conf.Template = digestTemplate
+		}
+		if !sendDigest {
+			text, err := renderDigest(ctx, conf)
+			if err != nil {
+				return err
+			}
+			fmt.Print(text)
+			return nil
+		}
+		if len(conf.Notifiers) == 0 {
+			return fmt.Errorf("no digest notifiers in the config")
+		}
+		if err := deliverDigest(ctx, conf); err != nil {
+			return err
+		}
+		fmt.Printf("Sent the digest to %d notifier(s)\n", len(conf.Notifiers))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// renderDigest builds the digest of conf's groups and renders it with its template.
+func renderDigest(ctx context.Context, conf config.DigestConfig) (string, error) {
+	digest, err := runner.BuildDigest(ctx, conf.Groups)
+	if err != nil {
+		if errors.Is(err, runner.ErrInvalidGroup) {
+			return "", withGroupHint(err)
+		}
+		return "", fmt.Errorf("failed to build digest: %w", err)
+	}
+	return runner.RenderDigest(digest, conf.Template)
+}
+
+// deliverDigest renders the digest of conf and sends it to its notifiers.
+func deliverDigest(ctx context.Context, conf config.DigestConfig) error {
+	notifiers, err := notify.NewAll(conf.Notifiers)
+	if err != nil {
+		return fmt.Errorf("invalid digest: %w", err)
+	}
+	text, err := renderDigest(ctx, conf)
+	if err != nil {
+		return err
+	}
+	if err := notify.Send(ctx, notifiers, text); err != nil {
+		return fmt.Errorf("failed to send digest: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	digestCmd.Flags().BoolVar(&sendDigest, "send", false, "Send the digest to the notifiers of the config instead of printing it")
+	digestCmd.Flags().StringVar(&digestTemplate, "template", "", "Go template file rendering the digest, instead of digest.template")
+	rootCmd.AddCommand(digestCmd)
+}
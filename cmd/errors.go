@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// Exit codes returned by the CLI, so scripts can branch on the failure type.
+const (
+	exitFailure             = 1 // Any error without a more specific class
+	exitConfig              = 2 // Invalid or missing configuration, or unknown group
+	exitNoAvailableAssignee = 3 // Every member of the group is unavailable
+	exitAvailability        = 4 // The availability backend could not be queried
+	exitTimeout             = 5 // The operation was cancelled or timed out
+	exitDeclineBudget       = 6 // The user has no declines left for the period
+	exitCallback            = 7 // The group's assignment callback failed
+	exitGroupDisabled       = 8 // The group is disabled with enabled: false
+	exitPreflight           = 9 // A check of --require-all-checks failed before selecting
+)
+
+// exitCodeError attaches an exit code to errors that don't come from the runner.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// exitCode maps an error to the exit code of its class.
+func exitCode(err error) int {
+	var codeErr *exitCodeError
+	switch {
+	case errors.As(err, &codeErr):
+		return codeErr.code
+	case errors.Is(err, runner.ErrAvailability):
+		return exitAvailability
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled), errors.Is(err, runner.ErrLockTimeout):
+		return exitTimeout
+	case errors.Is(err, runner.ErrConfig):
+		return exitConfig
+	case errors.Is(err, runner.ErrNoAvailableAssignee):
+		return exitNoAvailableAssignee
+	case errors.Is(err, runner.ErrDeclineBudget):
+		return exitDeclineBudget
+	case errors.Is(err, runner.ErrCallback):
+		return exitCallback
+	case errors.Is(err, runner.ErrGroupDisabled):
+		return exitGroupDisabled
+	case errors.Is(err, runner.ErrPreflight):
+		return exitPreflight
+	default:
+		return exitFailure
+	}
+}
+
+// withGroupHint points the user at --list-groups when err reports an unknown group.
+func withGroupHint(err error) error {
+	if errors.Is(err, runner.ErrInvalidGroup) {
+		return fmt.Errorf("%w\n%s", err, l10n.T(l10n.MsgListGroupsHint))
+	}
+	return err
+}
+
+// localizedError replaces the message of an error with a translated one
+// while keeping the original inspectable with errors.Is and errors.As.
+type localizedError struct {
+	msg string
+	err error
+}
+
+func (e *localizedError) Error() string { return e.msg }
+
+func (e *localizedError) Unwrap() error { return e.err }
+
+// wrapLocalized wraps err in a translated message whose {{.Error}} field is err's text.
+func wrapLocalized(msg *i18n.Message, err error) error {
+	return &localizedError{msg: l10n.T(msg, "Error", err.Error()), err: err}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/notify"
+	"autoassigner/runner"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// escalateCmd takes the due steps of the escalation chains of every group.
+var escalateCmd = &cobra.Command{
+	Use:   "escalate",
+	Short: "Escalate open assignments that weren't acknowledged in time",
+	Long: `Take the steps of the escalation chains of every group that are due for
+open assignments nobody acknowledged: notify the contact of a step, or
+the user the group of the step would assign next, or reassign the
+assignment with reassign. Escalations are sent to escalations.notifiers
+in the config and printed.
+
+"autoassigner serve" takes the steps as they become due; run this from
+cron instead when no server runs.
+
+Example:
+  autoassigner escalate`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		taken, err := escalate(ctx, config.Settings.Escalations)
+		for _, e := range taken {
+			fmt.Println(e.Message())
+		}
+		return err
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// escalate takes the due escalation steps and sends them to the notifiers of conf.
+func escalate(ctx context.Context, conf config.EscalationsConfig) ([]runner.Escalation, error) {
+	notifiers, err := notify.NewAll(conf.Notifiers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid escalations: %w", err)
+	}
+	return runner.Escalate(ctx, time.Now(), func(e runner.Escalation) error {
+		return notify.Send(ctx, notifiers, e.Message())
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(escalateCmd)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// explainResult prints the trace of an assignment on stderr with --explain,
+// unless --json prints it with the assignment.
+func explainResult(result *runner.AssignResult) {
+	if explain && !outputJSON {
+		printTrace(os.Stderr, result.Trace)
+	}
+}
+
+// explainFailure prints on stderr, with --explain, how every candidate of an
+// assignment that found nobody was ruled out.
+func explainFailure(err error) {
+	var none *runner.NoAvailableAssigneeError
+	if explain && errors.As(err, &none) {
+		printTrace(os.Stderr, none.Trace)
+	}
+}
+
+// printTrace prints a selection trace for people, one stage of the pipeline
+// per line.
+func printTrace(w io.Writer, trace *runner.SelectionTrace) {
+	if trace == nil {
+		return
+	}
+	fmt.Fprintf(w, "Strategy: %s\n", trace.Strategy)
+	fmt.Fprintf(w, "Candidates: %s\n", strings.Join(trace.Candidates, ", "))
+	for _, r := range trace.Removed {
+		fmt.Fprintf(w, "Removed %s: %s (%s)\n", r.User, r.Reason, r.Filter)
+	}
+	for _, step := range trace.Ranking {
+		var scores []string
+		for _, user := range trace.Candidates {
+			if score, ok := step.Scores[user]; ok {
+				scores = append(scores, fmt.Sprintf("%s=%s", user, score))
+			}
+		}
+		if len(scores) > 0 {
+			fmt.Fprintf(w, "Ranked by %s: %s, kept %s\n", step.Strategy, strings.Join(scores, " "), strings.Join(step.Kept, ", "))
+		} else {
+			fmt.Fprintf(w, "Ranked by %s: kept %s\n", step.Strategy, strings.Join(step.Kept, ", "))
+		}
+	}
+	if trace.Picked != "" {
+		fmt.Fprintf(w, "Picked: %s\n", trace.Picked)
+	}
+	for _, r := range trace.Skipped {
+		fmt.Fprintf(w, "Skipped %s: %s (%s)\n", r.User, r.Reason, r.Filter)
+	}
+	if trace.Selected != "" {
+		fmt.Fprintf(w, "Selected: %s\n", trace.Selected)
+	} else {
+		fmt.Fprintln(w, "Selected: nobody")
+	}
+}
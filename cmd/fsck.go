@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	fsckGroup string
+	fsckFix   bool
+)
+
+// fsckCmd cross-verifies the stored state of one or all groups.
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check stored assignment state for inconsistencies",
+	Long: `Cross-verify the stored counts and last index of every group (or only
+the one given with --group) with its assignments.log and report
+inconsistencies such as counts that don't match the log, an index pointing past the user list,
+or orphaned users. The counts of a group reset with --reset-counts are compared with the
+assignments logged since the reset. With --fix, state is repaired from the assignment log
+under the lock of each group.
+
+Example:
+  autoassigner fsck --group team-alpha --fix`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+
+		groups := []string{fsckGroup}
+		if fsckGroup == "" {
+			groups, err = config.ListGroups()
+			if err != nil {
+				return fmt.Errorf("failed to list groups: %w", err)
+			}
+			sort.Strings(groups)
+		}
+
+		remaining := 0
+		for _, group := range groups {
+			issues, err := runner.CheckGroup(group)
+			if err != nil {
+				if errors.Is(err, runner.ErrInvalidGroup) {
+					return withGroupHint(err)
+				}
+				return fmt.Errorf("failed to check group %s: %w", group, err)
+			}
+			if len(issues) == 0 {
+				fmt.Printf("%s: ok\n", group)
+				continue
+			}
+
+			fmt.Printf("%s: %d issue(s)\n", group, len(issues))
+			for _, issue := range issues {
+				fmt.Printf("  %s\n", issue)
+			}
+			if !fsckFix {
+				remaining += len(issues)
+				continue
+			}
+			if err := runner.RepairGroup(ctx, group); err != nil {
+				return fmt.Errorf("failed to repair group %s: %w", group, err)
+			}
+			fmt.Printf("  repaired from assignments.log\n")
+		}
+
+		if remaining > 0 {
+			return fmt.Errorf("found %d issue(s); run with --fix to repair", remaining)
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	fsckCmd.Flags().StringVarP(&fsckGroup, "group", "g", "", "Only check the given group")
+	fsckCmd.Flags().BoolVar(&fsckFix, "fix", false, "Repair inconsistencies from the assignment log")
+	addLockFlags(fsckCmd)
+	rootCmd.AddCommand(fsckCmd)
+}
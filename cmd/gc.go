@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var applyGC bool
+
+// gcCmd removes state that no group config refers to any more.
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove state of deleted groups and removed users",
+	Long: `Find data directories without a matching group config, left behind by
+deleted or renamed groups, and stored counts and skip debts of users that
+are no longer in their group.
+
+What would be removed is listed without changing anything unless --apply
+is given. Archived groups are never touched.
+
+Example:
+  autoassigner gc --apply`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		report, err := runner.FindGarbage()
+		if err != nil {
+			return fmt.Errorf("failed to scan data directory: %w", err)
+		}
+		if report.Empty() {
+			fmt.Println("No orphaned state found")
+			return nil
+		}
+
+		for _, dir := range report.OrphanedDirs {
+			fmt.Printf("data directory %s has no group config\n", dir)
+		}
+		groups := make([]string, 0, len(report.OrphanedUsers))
+		for group := range report.OrphanedUsers {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+		for _, group := range groups {
+			fmt.Printf("%s: stored state for removed users %s\n", group, strings.Join(report.OrphanedUsers[group], ", "))
+		}
+
+		if !applyGC {
+			fmt.Println("Run again with --apply to remove it")
+			return nil
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err = lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		if err := runner.CollectGarbage(ctx, report); err != nil {
+			return fmt.Errorf("failed to remove orphaned state: %w", err)
+		}
+		fmt.Println("Removed orphaned state")
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	gcCmd.Flags().BoolVar(&applyGC, "apply", false, "Remove the orphaned state instead of only listing it")
+	addLockFlags(gcCmd)
+	rootCmd.AddCommand(gcCmd)
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/gerrit"
+	"autoassigner/identity"
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"autoassigner/vcs"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	gerritGroup    string
+	gerritInterval time.Duration
+	gerritOnce     bool
+)
+
+// gerritCmd groups the commands of the Gerrit integration.
+var gerritCmd = &cobra.Command{
+	Use:   "gerrit",
+	Short: "Assign reviewers to Gerrit changes",
+}
+
+// gerritPollCmd polls Gerrit for changes without reviewers and assigns them.
+var gerritPollCmd = &cobra.Command{
+	Use:   "poll",
+	Short: "Add reviewers to open Gerrit changes that have none",
+	Long: `Query Gerrit for open changes matching gerrit.poll_query that have no
+reviewer besides their owner, and add a reviewer from the group given
+with --group or chosen by the routes in the config, matching the
+project. Changes without a matching route are left alone.
+
+Polls every --interval until interrupted, or once with --once. Servers
+with the webhooks plugin can send events to "autoassigner serve" instead.
+
+Example:
+  autoassigner gerrit poll --interval 2m`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		for {
+			if err := pollGerrit(ctx); err != nil {
+				if gerritOnce {
+					return err
+				}
+				log.Printf("Warning: %v", err)
+			}
+			if gerritOnce {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(gerritInterval):
+			}
+		}
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// pollGerrit adds a reviewer to every unreviewed change. A change that
+// cannot be assigned is reported and the remaining changes are still tried.
+func pollGerrit(ctx context.Context) error {
+	changes, err := gerrit.UnreviewedChanges(ctx)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		groupName := gerritGroup
+		if groupName == "" {
+			var ok bool
+			if groupName, ok, err = vcs.RouteChange(ctx, config.Settings.Routes, &change, gerrit.ChangedFiles); err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		author, err := vcs.AuthorUser(ctx, change, identity.Gerrit)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		// Changes polled during quiet hours are picked up by a later poll
+		result, err := runner.AssignUser(ctx, groupName, runner.AssignOptions{NoQueue: true, Exclude: []string{author}})
+		if err != nil {
+			log.Printf("Warning: failed to assign %s: %v", change, assignError(err))
+			continue
+		}
+		if result.Deferred != "" {
+			continue
+		}
+		reviewer, err := gerrit.Reviewer(ctx, result.User)
+		if err == nil {
+			err = gerrit.AddReviewer(ctx, change, reviewer)
+		}
+		if err != nil {
+			log.Printf("Warning: assigned %s to %s but failed to add them as reviewer: %v", result.User, change, err)
+			continue
+		}
+		log.Print(l10n.T(l10n.MsgReviewRequested, "Change", change, "Login", reviewer))
+	}
+	return nil
+}
+
+func init() {
+	gerritPollCmd.Flags().StringVar(&gerritGroup, "group", "", "Group to assign from instead of the one chosen by the routes")
+	gerritPollCmd.Flags().DurationVar(&gerritInterval, "interval", time.Minute, "Time between polls")
+	gerritPollCmd.Flags().BoolVar(&gerritOnce, "once", false, "Poll once and exit")
+	gerritCmd.AddCommand(gerritPollCmd)
+	rootCmd.AddCommand(gerritCmd)
+}
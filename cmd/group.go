@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	groupYes       bool
+	groupPurgeData bool
+	groupAddUsers  []string
+	groupDelUsers  []string
+)
+
+// groupCmd groups the commands managing whole groups.
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Create, update, archive, delete, rename, enable or disable groups",
+}
+
+// groupArchiveCmd moves a group's config and data into the archive.
+var groupArchiveCmd = &cobra.Command{
+	Use:   "archive [groupname]",
+	Short: "Move a group's config and data into the archive",
+	Long: `Move the config file and data directory of a group into
+<data_dir>/.archive/<group>-<timestamp>/, so the group stops being
+assigned while its history is kept. Restore it by moving group.yaml
+and data/ back.
+
+Example:
+  autoassigner group archive team-alpha --yes`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groupName := args[0]
+		if !confirm(l10n.T(l10n.MsgConfirmArchive, "Group", groupName)) {
+			fmt.Println(l10n.T(l10n.MsgAborted))
+			return nil
+		}
+		dir, err := runner.ArchiveGroup(groupName)
+		if err != nil {
+			return groupError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgGroupArchived, "Group", groupName, "Dir", dir))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// groupDeleteCmd removes a group's config and optionally its data.
+var groupDeleteCmd = &cobra.Command{
+	Use:   "delete [groupname]",
+	Short: "Delete a group",
+	Long: `Delete the config file of a group. Its data directory is kept
+unless --purge-data is given.
+
+Example:
+  autoassigner group delete team-alpha --purge-data`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groupName := args[0]
+		prompt := l10n.MsgConfirmDelete
+		if groupPurgeData {
+			prompt = l10n.MsgConfirmPurge
+		}
+		if !confirm(l10n.T(prompt, "Group", groupName)) {
+			fmt.Println(l10n.T(l10n.MsgAborted))
+			return nil
+		}
+		if err := runner.DeleteGroup(groupName, groupPurgeData); err != nil {
+			return groupError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgGroupDeleted, "Group", groupName))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// groupRenameCmd renames a group, carrying over its state and history.
+var groupRenameCmd = &cobra.Command{
+	Use:   "rename [oldname] [newname]",
+	Short: "Rename a group, keeping its counts and history",
+	Long: `Rename the config file and data directory of a group and rewrite the
+group field of its assignment log, skip log and deferred assignments,
+so counts and history continue under the new name.
+
+Example:
+  autoassigner group rename team-alpha team-platform`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		if err := runner.RenameGroup(ctx, args[0], args[1]); err != nil {
+			return groupError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgGroupRenamed, "Group", args[0], "NewGroup", args[1]))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// groupEnableCmd lets a disabled group be assigned again.
+var groupEnableCmd = &cobra.Command{
+	Use:   "enable [groupname]",
+	Short: "Enable assignments in a disabled group",
+	Long: `Remove enabled: false from the config file of a group, so it is
+assigned again.
+
+Example:
+  autoassigner group enable team-alpha`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		if err := runner.SetGroupEnabled(args[0], true); err != nil {
+			return groupError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgGroupEnabled, "Group", args[0]))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// groupDisableCmd freezes the rotation of a group.
+var groupDisableCmd = &cobra.Command{
+	Use:   "disable [groupname]",
+	Short: "Reject assignments in a group, e.g. during a reorg",
+	Long: `Set enabled: false in the config file of a group. Assignments in the
+group then fail with exit code 8, or exit successfully without
+assigning anyone with --ignore-disabled, until the group is enabled
+again. Its counts, history and rotation position are kept.
+
+Example:
+  autoassigner group disable team-alpha`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		if err := runner.SetGroupEnabled(args[0], false); err != nil {
+			return groupError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgGroupDisabled, "Group", args[0]))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// groupUpdateCmd creates or replaces the config of a group after validating it.
+var groupUpdateCmd = &cobra.Command{
+	Use:   "update [groupname] [file]",
+	Short: "Create or replace the config of a group",
+	Long: `Validate a group config and write it as the config file of the group,
+creating the group if it doesn't exist. The file is read from stdin
+when it is -. A config that doesn't pass the checks of "validate" is
+rejected with every problem found and the group is left unchanged.
+The lock of the group is held while the file is written, like for
+PUT /groups/{group} of the webhook server.
+
+Example:
+  autoassigner group update team-alpha team-alpha.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		var data []byte
+		var err error
+		if args[1] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[1])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read group config: %w", err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err = lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		created, err := runner.UpdateGroupConfig(ctx, args[0], data)
+		if err != nil {
+			return groupError(err)
+		}
+		msg := l10n.MsgGroupUpdated
+		if created {
+			msg = l10n.MsgGroupCreated
+		}
+		fmt.Println(l10n.T(msg, "Group", args[0]))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// groupUsersCmd adds users to and removes users from a group.
+var groupUsersCmd = &cobra.Command{
+	Use:   "users [groupname]",
+	Short: "Add users to or remove users from a group",
+	Long: `Edit the users list in the config file of a group, keeping the rest of
+the file and its comments. Removed users lose their settings in the
+group, such as aliases and never_available; their counts and history
+are kept. Adding a member or removing a non-member changes nothing.
+The lock of the group is held while the file is edited, like for
+PATCH /groups/{group}/users of the webhook server.
+
+Example:
+  autoassigner group users team-alpha --add carol --remove bob`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		if len(groupAddUsers) == 0 && len(groupDelUsers) == 0 {
+			return fmt.Errorf("--add or --remove is required")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		update, err := runner.UpdateGroupUsers(ctx, args[0], groupAddUsers, groupDelUsers)
+		if err != nil {
+			return groupError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgGroupUsers, "Group", args[0], "Users", strings.Join(update.Users, ", ")))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// confirm asks the user a yes/no question on stdin unless --yes was given.
+func confirm(prompt string) bool {
+	if groupYes {
+		return true
+	}
+	fmt.Print(prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// groupError adds context to an error from managing a group.
+func groupError(err error) error {
+	if errors.Is(err, runner.ErrInvalidGroup) {
+		return withGroupHint(err)
+	}
+	return err
+}
+
+func init() {
+	groupCmd.PersistentFlags().BoolVarP(&groupYes, "yes", "y", false, "Don't ask for confirmation")
+	groupDeleteCmd.Flags().BoolVar(&groupPurgeData, "purge-data", false, "Also remove the group's data directory")
+	groupUsersCmd.Flags().StringSliceVar(&groupAddUsers, "add", nil, "Users to add, e.g. --add carol,dave")
+	groupUsersCmd.Flags().StringSliceVar(&groupDelUsers, "remove", nil, "Users to remove")
+	addLockFlags(groupUpdateCmd)
+	addLockFlags(groupUsersCmd)
+	addLockFlags(groupRenameCmd)
+	groupCmd.AddCommand(groupUpdateCmd, groupUsersCmd, groupArchiveCmd, groupDeleteCmd, groupRenameCmd, groupEnableCmd, groupDisableCmd)
+	rootCmd.AddCommand(groupCmd)
+}
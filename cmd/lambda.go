@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/lambda"
+	"autoassigner/server"
+	"autoassigner/tracing"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// lambdaCmd runs the server as an AWS Lambda function.
+var lambdaCmd = &cobra.Command{
+	Use:   "lambda",
+	Short: "Handle AWS Lambda invocations on a custom runtime",
+	Long: `Handle the invocations of an AWS Lambda function on a custom runtime
+(provided.al2023), so the assigner runs serverlessly.
+
+Requests of API Gateway REST APIs, HTTP APIs and function URLs are served
+like requests to "autoassigner serve", with the same endpoints, auth and
+audit sinks. SQS messages are assignment requests like those consumed by
+server.consumer; enable ReportBatchItemFailures on the event source
+mapping, so only the messages that failed are delivered again.
+
+Deploy the binary with a bootstrap script such as:
+  #!/bin/sh
+  exec ./autoassigner lambda --config config.json
+
+Only /tmp is writable in Lambda, so set storage.data_dir below it and
+storage.s3 to keep the state in a bucket. The state is pulled before
+every invocation and pushed with conditional writes, so concurrent
+instances don't overwrite each other's assignments.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			lambda.InitError(err)
+			return err
+		}
+		authorizer, err := server.NewAuthorizer(config.Settings.Server)
+		if err != nil {
+			err = fmt.Errorf("invalid server auth: %w", err)
+			lambda.InitError(err)
+			return err
+		}
+		sinks, err := server.NewAuditSinks(config.Settings.Server)
+		if err != nil {
+			err = fmt.Errorf("invalid server audit: %w", err)
+			lambda.InitError(err)
+			return err
+		}
+		handler := server.Protect(server.Handler(), authorizer, config.Settings.Server.Auth.Policies)
+		handler = server.Trace(server.Audit(handler, sinks...))
+		// Requests to other systems continue the trace of the request they are made for
+		tracing.Install()
+
+		// Lambda sends SIGTERM before shutting down the execution environment
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		return lambda.Start(ctx, server.LambdaHandler(handler, sinks...))
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	rootCmd.AddCommand(lambdaCmd)
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"autoassigner/version"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var lintFormat string
+
+// lintCmd reports likely mistakes in the configs of groups, with fixes.
+var lintCmd = &cobra.Command{
+	Use:   "lint [groupname]",
+	Short: "Find likely mistakes in group configs and suggest fixes",
+	Long: `Check the configs of every group (or only the given ones) for the
+problems autoassigner validate reports and for likely mistakes beyond
+them, and suggest how to fix each:
+
+  - counts stored for users who are no longer in the group
+  - least_assigned or open_load choosing from a single user
+  - groups, priorities and roles whose users are all never_available
+  - priorities routing to users outside the group
+  - daily and weekly limits of which one is never reached
+  - user_limits of users outside the group
+  - routes to groups that don't exist, and routes that never match
+    because an earlier route matches every change they do
+
+Routes are only checked when every group is linted. The command fails
+when it finds an error; warnings are reported without failing.
+
+With --format sarif the findings are written as a SARIF log, which CI
+systems such as GitHub code scanning show as annotations of the files.
+
+Example:
+  autoassigner lint
+  autoassigner lint 'platform/*'
+  autoassigner lint --format sarif > lint.sarif`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if lintFormat != "text" && lintFormat != "sarif" {
+			return fmt.Errorf("unknown format %s, expected text or sarif", lintFormat)
+		}
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		var groups []string
+		var findings []runner.LintFinding
+		if len(args) == 1 {
+			var err error
+			if groups, err = targetGroups(args[0]); err != nil {
+				return err
+			}
+		} else {
+			var err error
+			if groups, err = config.ListGroups(); err != nil {
+				return fmt.Errorf("failed to list groups: %w", err)
+			}
+			if findings, err = runner.LintRoutes(); err != nil {
+				return fmt.Errorf("failed to lint routes: %w", err)
+			}
+		}
+		for _, group := range groups {
+			found, err := runner.LintGroup(group)
+			if err != nil {
+				if errors.Is(err, runner.ErrInvalidGroup) {
+					return withGroupHint(err)
+				}
+				return fmt.Errorf("failed to lint group %s: %w", group, err)
+			}
+			findings = append(findings, found...)
+		}
+
+		if lintFormat == "sarif" {
+			if err := writeSARIF(os.Stdout, findings); err != nil {
+				return err
+			}
+		} else {
+			printFindings(os.Stdout, findings)
+		}
+		errs := 0
+		for _, finding := range findings {
+			if finding.Level == runner.LintError {
+				errs++
+			}
+		}
+		if errs > 0 {
+			return &exitCodeError{code: exitConfig, err: fmt.Errorf("found %d error(s)", errs)}
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	lintCmd.Flags().StringVar(&lintFormat, "format", "text", "Output format: text or sarif")
+	rootCmd.AddCommand(lintCmd)
+}
+
+// findingFile returns the file a finding is in: the config of its group, or
+// the main configuration for routes.
+func findingFile(finding runner.LintFinding) string {
+	if finding.Group == "" {
+		return configFile
+	}
+	path, _ := config.GroupConfigPath(finding.Group)
+	return path
+}
+
+// printFindings writes findings as file:line: level: message [rule], each
+// followed by its suggestion.
+func printFindings(w io.Writer, findings []runner.LintFinding) {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "no problems found")
+		return
+	}
+	for _, finding := range findings {
+		location := findingFile(finding)
+		if finding.Line > 0 {
+			location += fmt.Sprintf(":%d", finding.Line)
+		}
+		fmt.Fprintf(w, "%s: %s: %s [%s]\n", location, finding.Level, finding.Message, finding.Rule)
+		if finding.Suggestion != "" {
+			fmt.Fprintf(w, "  suggestion: %s\n", finding.Suggestion)
+		}
+	}
+}
+
+// sarifLog is the subset of a SARIF 2.1.0 log written by lint.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIF writes findings as a SARIF log, with suggestions appended to
+// the messages and files relative to the working directory where possible.
+func writeSARIF(w io.Writer, findings []runner.LintFinding) error {
+	driver := sarifDriver{Name: "autoassigner", Version: version.Version}
+	ids := make([]string, 0, len(runner.LintRules))
+	for id := range runner.LintRules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		driver.Rules = append(driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: runner.LintRules[id]}})
+	}
+
+	cwd, _ := os.Getwd()
+	results := []sarifResult{}
+	for _, finding := range findings {
+		text := finding.Message
+		if finding.Suggestion != "" {
+			text += "; suggestion: " + finding.Suggestion
+		}
+		var location sarifLocation
+		file := findingFile(finding)
+		if abs, err := filepath.Abs(file); err == nil && cwd != "" {
+			if rel, err := filepath.Rel(cwd, abs); err == nil && filepath.IsLocal(rel) {
+				file = rel
+			}
+		}
+		location.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(file)
+		if finding.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: finding.Line}
+		}
+		results = append(results, sarifResult{RuleID: finding.Rule, Level: finding.Level, Message: sarifMessage{Text: text}, Locations: []sarifLocation{location}})
+	}
+
+	out, err := json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	maintainArchive bool
+	maintainDryRun  bool
+)
+
+// maintainCmd enforces the history retention of every group.
+var maintainCmd = &cobra.Command{
+	Use:   "maintain",
+	Short: "Prune assignment history older than the retention of each group",
+	Long: `Prune the records older than the history retention of every group from
+its assignment, skip, decline and duration logs. The retention is
+history_retention of the group, or maintenance.history_retention in the
+config; groups without one keep their records forever.
+
+Counts are kept: the pruned assignments are recorded per day in the
+group's pruned.json, which "autoassigner rebuild-counts" and
+"autoassigner fsck" take into account. With --archive, or
+maintenance.archive in the config, the pruned records are moved to
+<data_dir>/.archive/history/<group>/ instead of being deleted, and to the
+bucket of storage.s3 when it is configured.
+
+"autoassigner serve" prunes the records once a day; run this from cron
+instead when no server runs.
+
+Example:
+  autoassigner maintain --dry-run
+  autoassigner maintain --archive`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		opts := runner.MaintainOptions{Archive: maintainArchive || config.Settings.Maintenance.Archive, DryRun: maintainDryRun}
+		maintained, err := runner.Maintain(ctx, time.Now(), opts)
+		for _, m := range maintained {
+			fmt.Println(describeMaintenance(m, opts.DryRun))
+		}
+		if err == nil && len(maintained) == 0 {
+			fmt.Println("No records older than the history retention")
+		}
+		return err
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// describeMaintenance describes the records pruned from a group, e.g.
+// "team-alpha: pruned 120 assignments.log, 4 skips.log records before 2024-05-27T09:00:00Z".
+func describeMaintenance(m runner.Maintenance, dryRun bool) string {
+	logs := make([]string, 0, len(m.Pruned))
+	for name := range m.Pruned {
+		logs = append(logs, name)
+	}
+	sort.Strings(logs)
+	counts := make([]string, len(logs))
+	for i, name := range logs {
+		counts[i] = fmt.Sprintf("%d %s", m.Pruned[name], name)
+	}
+	verb := "pruned"
+	if dryRun {
+		verb = "would prune"
+	}
+	msg := fmt.Sprintf("%s: %s %s records before %s", m.Group, verb, strings.Join(counts, ", "), m.Before)
+	if m.Archive != "" {
+		msg += ", archived to " + m.Archive
+	}
+	return msg
+}
+
+func init() {
+	maintainCmd.Flags().BoolVar(&maintainArchive, "archive", false, "Move the pruned records to the archive instead of deleting them")
+	maintainCmd.Flags().BoolVar(&maintainDryRun, "dry-run", false, "List the records that would be pruned without changing anything")
+	rootCmd.AddCommand(maintainCmd)
+}
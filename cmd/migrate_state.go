@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+var applyMigration bool
+
+// migrateStateCmd rewrites state stored in the old layout in the current one.
+var migrateStateCmd = &cobra.Command{
+	Use:   "migrate-state",
+	Short: "Move the state of every group to the current storage layout",
+	Long: `Find groups whose last index and counts are still stored in index.log
+and counts.json, the layout of earlier versions, and rewrite them as
+state.json. Groups are migrated by their next assignment anyway, and the
+old files are still read until then; this migrates every group at once,
+e.g. before upgrading to a version that no longer reads them.
+
+What would be migrated is listed without changing anything unless --apply
+is given.
+
+Example:
+  autoassigner migrate-state --apply`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groups, err := runner.FindLegacyState()
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			fmt.Println("No state to migrate")
+			return nil
+		}
+		for _, group := range groups {
+			fmt.Printf("%s: state stored in index.log and counts.json\n", group)
+		}
+
+		if !applyMigration {
+			fmt.Println("Run again with --apply to migrate it")
+			return nil
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err = lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if _, err := runner.MigrateState(ctx, group); err != nil {
+				return fmt.Errorf("failed to migrate state of group %s: %w", group, err)
+			}
+		}
+		fmt.Printf("Migrated the state of %d group(s)\n", len(groups))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	migrateStateCmd.Flags().BoolVar(&applyMigration, "apply", false, "Migrate the state instead of only listing it")
+	addLockFlags(migrateStateCmd)
+	rootCmd.AddCommand(migrateStateCmd)
+}
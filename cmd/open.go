@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// openCmd lists the assignments of a group that have not been closed.
+var openCmd = &cobra.Command{
+	Use:   "open [groupname]",
+	Short: "List open assignments of a group",
+	Long: `List the assignments of a group that have not been closed yet.
+Only groups with track_open enabled record open assignments.
+
+Example:
+  autoassigner open team-alpha`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groupName := args[0]
+		ledger, err := runner.OpenAssignments(groupName)
+		if err != nil {
+			return ledgerError(err)
+		}
+		if len(ledger) == 0 {
+			fmt.Println(l10n.T(l10n.MsgNoOpenAssignments, "Group", groupName))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSER\tASSIGNED AT\tACKNOWLEDGED AT")
+		for _, open := range ledger {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", open.ID, open.User, open.AssignedAt, open.AcknowledgedAt)
+		}
+		return w.Flush()
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// ackCmd marks an open assignment as acknowledged by its assignee.
+var ackCmd = &cobra.Command{
+	Use:   "ack [groupname] [assignment-id]",
+	Short: "Acknowledge an open assignment",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		open, err := runner.AcknowledgeAssignment(ctx, args[0], args[1])
+		if err != nil {
+			return ledgerError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgAcknowledged, "ID", open.ID, "User", open.User))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// closeCmd removes an assignment from the open assignments of a group.
+var closeCmd = &cobra.Command{
+	Use:   "close [groupname] [assignment-id]",
+	Short: "Close an open assignment",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		open, err := runner.CloseAssignment(ctx, args[0], args[1])
+		if err != nil {
+			return ledgerError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgClosed, "ID", open.ID, "User", open.User))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	addLockFlags(ackCmd)
+	addLockFlags(closeCmd)
+	rootCmd.AddCommand(openCmd, ackCmd, closeCmd)
+}
+
+// ledgerError adds the group hint to unknown groups and context to storage failures.
+func ledgerError(err error) error {
+	switch {
+	case errors.Is(err, runner.ErrInvalidGroup):
+		return withGroupHint(err)
+	case errors.Is(err, runner.ErrAssignmentNotFound):
+		return err
+	default:
+		return fmt.Errorf("failed to access open assignments: %w", err)
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"autoassigner/kube"
+	"autoassigner/operator"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	operatorNamespace string
+	operatorAPIServer string
+	operatorTokenFile string
+)
+
+// operatorCmd reconciles AssigneeGroup and Assignment resources.
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Run as a Kubernetes operator for AssigneeGroup and Assignment resources",
+	Long: `Run as a Kubernetes operator, so rotations are managed with GitOps.
+
+AssigneeGroup resources define groups: their spec has the keys of a group
+config file and is validated and written to conf_dir, and their status
+reports whether it was applied, the counts and the last assignee.
+Assignment resources request an assignment from a group; the assignee is
+written to their status. Assignments that can't be made yet, such as
+during quiet hours or before their group exists, stay Pending and are
+retried.
+
+The operator watches the namespace of its pod, or --namespace. Install
+the CRDs from etc/kubernetes/crds.yaml first. Outside of a cluster, point
+--api-server at "kubectl proxy".
+
+Example:
+  autoassigner operator --api-server http://localhost:8001 --namespace teams`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		client, namespace := &kube.Client{URL: operatorAPIServer, TokenFile: operatorTokenFile}, operatorNamespace
+		if operatorAPIServer == "" {
+			inCluster, podNamespace, err := kube.InCluster()
+			if err != nil {
+				return fmt.Errorf("%w; use --api-server outside of a cluster", err)
+			}
+			client = inCluster
+			if namespace == "" {
+				namespace = podNamespace
+			}
+		}
+		if namespace == "" {
+			return fmt.Errorf("--namespace is required with --api-server")
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		log.Printf("Reconciling AssigneeGroups and Assignments in namespace %s", namespace)
+		return (&operator.Operator{Client: client, Namespace: namespace}).Run(ctx)
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	operatorCmd.Flags().StringVar(&operatorNamespace, "namespace", "", "Namespace to watch (default the namespace of the pod)")
+	operatorCmd.Flags().StringVar(&operatorAPIServer, "api-server", "", "URL of the Kubernetes API, e.g. of kubectl proxy (default the cluster the pod runs in)")
+	operatorCmd.Flags().StringVar(&operatorTokenFile, "token-file", "", "File with a bearer token for --api-server")
+	rootCmd.AddCommand(operatorCmd)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"autoassigner/identity"
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	outputField string
+	outputJSON  bool
+)
+
+// outputFieldAliases maps the names accepted by --output-field to identity kinds.
+var outputFieldAliases = map[string]string{
+	"slack_id": identity.Slack,
+	"user":     identity.Username,
+}
+
+// assignmentOutput is an assignment as printed with --json.
+type assignmentOutput struct {
+	Group      string                 `json:"group"`
+	ID         string                 `json:"id,omitempty"`
+	Assignee   string                 `json:"assignee,omitempty"`
+	Deferred   string                 `json:"deferred,omitempty"`
+	DryRun     bool                   `json:"dry_run,omitempty"`
+	Reason     string                 `json:"reason,omitempty"`     // Why the assignee was selected, e.g. "least_assigned count=3"
+	Identities map[string]string      `json:"identities,omitempty"` // Every known identifier of the assignee keyed by kind, e.g. slack or email
+	Trace      *runner.SelectionTrace `json:"trace,omitempty"`      // How the assignee was selected, with --explain
+}
+
+// customOutput reports whether --output-field or --json replace the
+// assignee printed by the runner.
+func customOutput() bool {
+	return outputField != "" || outputJSON
+}
+
+// printAssignment prints an assignment as selected with --output-field or
+// --json: the identifier of the assignee of that kind, or the assignment
+// with all identifiers of the assignee.
+func printAssignment(ctx context.Context, group string, result *runner.AssignResult, dryRun bool) error {
+	if outputJSON {
+		out := assignmentOutput{Group: group, ID: result.ID, Assignee: result.User, Deferred: result.Deferred, DryRun: dryRun, Reason: result.Reason}
+		if explain {
+			out.Trace = result.Trace
+		}
+		if result.User != "" {
+			ids, err := identity.All(ctx, result.User)
+			if errors.Is(err, identity.ErrUnknown) {
+				ids, err = map[string]string{identity.Username: result.User}, nil
+			}
+			if err != nil {
+				return fmt.Errorf("assigned %s but failed to look up their identities: %w", result.User, err)
+			}
+			out.Identities = ids
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	if result.Deferred != "" {
+		fmt.Fprintln(os.Stderr, l10n.T(l10n.MsgDeferred, "Group", group, "Time", result.Deferred))
+		return nil
+	}
+	kind := outputField
+	if alias, ok := outputFieldAliases[kind]; ok {
+		kind = alias
+	}
+	id, err := identity.Lookup(ctx, result.User, kind)
+	if err != nil {
+		return fmt.Errorf("assigned %s but failed to look up their %s: %w", result.User, outputField, err)
+	}
+	fmt.Println(id)
+	return nil
+}
+
+// addOutputFlags adds the flags selecting how the assignment is printed.
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputField, "output-field", "", "Print only this identifier of the assignee, e.g. slack_id or email (see identity in the configuration)")
+	cmd.Flags().BoolVar(&outputJSON, "json", false, "Print the assignment as JSON, including every known identifier of the assignee")
+	cmd.MarkFlagsMutuallyExclusive("output-field", "json", "roles")
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pauseFrom  string
+	pauseUntil string
+	pauseList  bool
+)
+
+// pauseCmd takes a user out of the rotation of every group for a while.
+var pauseCmd = &cobra.Command{
+	Use:   "pause [username]",
+	Short: "Take a user out of every rotation until a given time",
+	Long: `Pause a user in every group until --until, such as during a vacation,
+without editing the group files. Paused users are skipped like users
+listed in never_available and are back in the rotation once the pause
+ends, or when resumed with 'resume'. Pausing a paused user replaces the
+end of their pause.
+
+--until takes a weekday (the start of its next occurrence), tomorrow, a
+date such as 2024-05-20, a time in RFC 3339 format or a duration such as
+3d or 2w, in the local time of the host. --from schedules the pause to
+start later, such as for a vacation, and takes the same values.
+
+Example:
+  autoassigner pause alice --until monday
+  autoassigner pause bob --until 2w
+  autoassigner pause carol --from 2024-07-01 --until 2024-07-15
+  autoassigner pause --list
+  autoassigner resume alice`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if pauseList {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		if pauseList {
+			return listPauses()
+		}
+		if pauseUntil == "" {
+			return fmt.Errorf("--until is required")
+		}
+		now := time.Now()
+		until, err := runner.ParsePauseEnd(pauseUntil, now)
+		if err != nil {
+			return err
+		}
+		var from time.Time
+		if pauseFrom != "" {
+			if from, err = runner.ParsePauseEnd(pauseFrom, now); err != nil {
+				return err
+			}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err = lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		if err := runner.SchedulePause(ctx, args[0], from, until, ""); err != nil {
+			return err
+		}
+		if from.After(now) {
+			fmt.Println(l10n.T(l10n.MsgUserPauseScheduled, "User", args[0], "From", from.Format(time.RFC3339), "Time", until.Format(time.RFC3339)))
+			return nil
+		}
+		fmt.Println(l10n.T(l10n.MsgUserPaused, "User", args[0], "Time", until.Format(time.RFC3339)))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// resumeCmd ends the pause of a user.
+var resumeCmd = &cobra.Command{
+	Use:   "resume [username]",
+	Short: "End the pause of a user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		resumed, err := runner.ResumeUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if !resumed {
+			fmt.Println(l10n.T(l10n.MsgUserNotPaused, "User", args[0]))
+			return nil
+		}
+		fmt.Println(l10n.T(l10n.MsgUserResumed, "User", args[0]))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// listPauses prints the pauses that haven't ended.
+func listPauses() error {
+	pauses, err := runner.ListPauses()
+	if err != nil {
+		return err
+	}
+	if len(pauses) == 0 {
+		fmt.Println(l10n.T(l10n.MsgNoPauses))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tFROM\tUNTIL\tPAUSED BY")
+	for _, p := range pauses {
+		from, actor := p.From, p.Actor
+		if from == "" {
+			from = "-"
+		}
+		if actor == "" {
+			actor = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.User, from, p.Until, actor)
+	}
+	return w.Flush()
+}
+
+func init() {
+	pauseCmd.Flags().StringVar(&pauseFrom, "from", "", "Start of the pause, in the same formats; at once when empty")
+	pauseCmd.Flags().StringVar(&pauseUntil, "until", "", "End of the pause: a weekday, tomorrow, a date, an RFC 3339 time or a duration such as 3d")
+	pauseCmd.Flags().BoolVar(&pauseList, "list", false, "List the paused users instead")
+	addLockFlags(pauseCmd)
+	addLockFlags(resumeCmd)
+	rootCmd.AddCommand(pauseCmd, resumeCmd)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"autoassigner/history"
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	queryLimit int
+	queryJSON  bool
+)
+
+// queryCmd lists the assignments of the logs matching a query.
+var queryCmd = &cobra.Command{
+	Use:   "query [expression]",
+	Short: "Search the assignment history",
+	Long: `List the logged assignments matching a query, oldest first, across every
+group or the groups named by group conditions. A query is a list of
+conditions joined by AND:
+
+  field=value     the field is value, or one of a comma-separated list
+  field!=value    the field is none of the values
+
+Fields are user, group, role, actor, strategy, id and metadata.<key>,
+and since and until, which take a window before now (90d, 2w, 12h), a
+date (2024-05-01) or an RFC 3339 time. Without an expression every
+assignment is listed.
+
+Examples:
+  autoassigner query "user=alice AND since=90d"
+  autoassigner query "group=team-alpha,team-beta AND actor!=ci" --limit 20
+  autoassigner query "since=2024-01-01 AND until=2024-04-01" --json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		q, err := history.ParseQuery(strings.Join(args, " "), time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid query: %w", err)
+		}
+		records, err := runner.QueryHistory(context.Background(), q, runner.QueryOptions{Limit: queryLimit})
+		if err != nil {
+			if errors.Is(err, runner.ErrInvalidGroup) {
+				return withGroupHint(err)
+			}
+			return fmt.Errorf("failed to query history: %w", err)
+		}
+
+		if queryJSON {
+			// The records as logged, one per line
+			enc := json.NewEncoder(os.Stdout)
+			for _, record := range records {
+				if err := enc.Encode(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if len(records) == 0 {
+			fmt.Println(l10n.T(l10n.MsgNoMatchingAssignments))
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIMESTAMP\tGROUP\tUSER\tROLE\tID\tACTOR")
+		for _, r := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Timestamp, r.Group, r.User, r.Role, r.ID, r.Actor)
+		}
+		return w.Flush()
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	queryCmd.Flags().IntVar(&queryLimit, "limit", 0, "List only the most recent matches")
+	queryCmd.Flags().BoolVar(&queryJSON, "json", false, "Print the matching records as JSON lines")
+	rootCmd.AddCommand(queryCmd)
+}
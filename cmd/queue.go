@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var flushAll bool
+
+// queueCmd groups the commands managing assignments deferred during quiet hours.
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Manage assignments deferred during quiet hours",
+	Long: `Manage assignments that were requested during a group's quiet hours.
+
+Deferred assignments are made by 'queue flush' once the quiet hours have
+ended; run it from cron or a systemd timer to process them automatically.`,
+}
+
+// queueListCmd prints the deferred assignments.
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List deferred assignments",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		queue, err := runner.ListQueue()
+		if err != nil {
+			return err
+		}
+		if len(queue) == 0 {
+			fmt.Println(l10n.T(l10n.MsgQueueEmpty))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tGROUP\tPRIORITY\tQUEUED AT\tNOT BEFORE")
+		for _, qa := range queue {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", qa.ID, qa.Group, qa.Priority, qa.QueuedAt, qa.NotBefore)
+		}
+		return w.Flush()
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// queueFlushCmd makes the deferred assignments that are due.
+var queueFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Make deferred assignments whose quiet hours have ended",
+	Long: `Make the deferred assignments whose quiet hours have ended.
+Assignments that fail stay queued for the next flush.
+
+Example:
+  autoassigner queue flush --all`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		results, err := runner.FlushQueue(ctx, flushAll)
+
+		failed := 0
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "%s (%s): %v\n", r.Assignment.ID, r.Assignment.Group, r.Err)
+			}
+		}
+		fmt.Println(l10n.T(l10n.MsgQueueFlushed, "Done", len(results)-failed, "Failed", failed))
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d queued assignments failed", failed)
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	queueFlushCmd.Flags().BoolVar(&flushAll, "all", false, "Also make assignments whose quiet hours have not ended")
+	addLockFlags(queueFlushCmd)
+	queueCmd.AddCommand(queueListCmd, queueFlushCmd)
+	rootCmd.AddCommand(queueCmd)
+}
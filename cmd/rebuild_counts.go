@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+var applyRebuild bool
+
+// rebuildCountsCmd recomputes the stored counts and last index from assignments.log.
+var rebuildCountsCmd = &cobra.Command{
+	Use:   "rebuild-counts [groupname]",
+	Short: "Recompute assignment counts and last index from the assignment log",
+	Long: `Recompute the stored counts and last index of a group from its assignments.log,
+for recovery after state corruption or manual edits.
+
+Differences are reported without changing anything unless --apply is given.
+With --apply, the counts are rebuilt again under the lock of the group, so
+assignments made in the meantime are not undone; the differences written
+are reported.
+
+Example:
+  autoassigner rebuild-counts team-alpha --apply`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groupName := args[0]
+		var rebuild *runner.CountsRebuild
+		var err error
+		if applyRebuild {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			ctx, err = lockContext(ctx, cmd)
+			if err != nil {
+				return err
+			}
+			rebuild, err = runner.ApplyRebuild(ctx, groupName)
+		} else {
+			rebuild, err = runner.RebuildCounts(groupName)
+		}
+		if err != nil {
+			if errors.Is(err, runner.ErrInvalidGroup) {
+				return withGroupHint(err)
+			}
+			return fmt.Errorf("failed to rebuild counts: %w", err)
+		}
+
+		diffs := rebuild.Differences()
+		fmt.Printf("Rebuilt state for group %s from %d log records\n", groupName, rebuild.LogRecordCount)
+		if len(diffs) == 0 {
+			fmt.Println("Stored state matches the assignment log")
+			return nil
+		}
+		for _, diff := range diffs {
+			fmt.Printf("  %s\n", diff)
+		}
+
+		if !applyRebuild {
+			fmt.Println("Run again with --apply to write these changes")
+			return nil
+		}
+		fmt.Printf("Successfully rebuilt assignment counts for group %s\n", groupName)
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	rebuildCountsCmd.Flags().BoolVar(&applyRebuild, "apply", false, "Write the rebuilt counts and last index")
+	addLockFlags(rebuildCountsCmd)
+	rootCmd.AddCommand(rebuildCountsCmd)
+}
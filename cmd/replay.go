@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayLog   string
+	applyReplay bool
+)
+
+// replayCmd reconstructs the state of a group from a historical assignment log.
+var replayCmd = &cobra.Command{
+	Use:   "replay [groupname]",
+	Short: "Reconstruct group state by replaying an assignment log",
+	Long: `Reconstruct the counts and last index of a group by replaying an
+assignment log against the group's current config, for example to
+migrate state from another machine.
+
+Every logged assignment is compared with what the current strategy selects
+for the replayed state, so strategy changes after an upgrade show up as
+divergences. Users skipped as unavailable at the time, and selections of
+an unseeded random strategy, also diverge.
+
+Nothing is changed unless --apply is given, which also makes the replayed
+log the group's assignment log, under the lock of the group.
+
+Example:
+  autoassigner replay team-alpha --log /backup/team-alpha/assignments.log --apply`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groupName := args[0]
+		result, err := runner.Replay(context.Background(), groupName, replayLog)
+		if err != nil {
+			if errors.Is(err, runner.ErrInvalidGroup) {
+				return withGroupHint(err)
+			}
+			return fmt.Errorf("failed to replay assignment log: %w", err)
+		}
+
+		fmt.Printf("Replayed %d log records for group %s\n", result.Rebuild.LogRecordCount, groupName)
+		for _, user := range result.UnknownUsers {
+			fmt.Printf("  user %s is not in the current config\n", user)
+		}
+		if len(result.Divergences) == 0 {
+			fmt.Println("Every assignment matches the current strategy")
+		} else {
+			fmt.Printf("%d assignments differ from the current strategy:\n", len(result.Divergences))
+			for _, d := range result.Divergences {
+				fmt.Printf("  record %d: logged %s, strategy selects %s\n", d.Record, d.Recorded, d.Expected)
+			}
+		}
+
+		diffs := result.Rebuild.Differences()
+		if len(diffs) == 0 {
+			fmt.Println("Stored state matches the replayed log")
+		} else {
+			fmt.Println("Stored state differs from the replayed log:")
+			for _, diff := range diffs {
+				fmt.Printf("  %s\n", diff)
+			}
+		}
+
+		if !applyReplay {
+			fmt.Println("Run again with --apply to write the replayed state")
+			return nil
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err = lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		if err := runner.ApplyReplay(ctx, result); err != nil {
+			return fmt.Errorf("failed to apply replayed state: %w", err)
+		}
+		fmt.Printf("Successfully replayed state for group %s\n", groupName)
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayLog, "log", "", "Assignment log to replay")
+	replayCmd.Flags().BoolVar(&applyReplay, "apply", false, "Write the replayed counts, last index and log")
+	replayCmd.MarkFlagRequired("log")
+	addLockFlags(replayCmd)
+	rootCmd.AddCommand(replayCmd)
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reserveTTL          time.Duration
+	reservePriority     string
+	reserveCallbackData map[string]string
+	reserveList         bool
+)
+
+// reserveCmd holds the next assignee of a group until the assignment is committed or released.
+var reserveCmd = &cobra.Command{
+	Use:   "reserve [groupname]",
+	Short: "Reserve the next assignee of a group",
+	Long: `Select the next available user of a group and hold them for --ttl
+without updating the rotation or counts. Make the assignment in the
+external system, then record it with 'commit', or give the user back
+with 'release' if that failed. Reservations that are neither committed
+nor released lapse after the TTL.
+
+Reserved users are not selected by other reservations or assignments of
+the group while the reservation is held. During quiet hours nothing is
+reserved.
+
+Example:
+  autoassigner reserve team-alpha --ttl 2m
+  autoassigner commit team-alpha lq3v8x2k0
+  autoassigner reserve team-alpha --list`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groupName := args[0]
+		if reserveList {
+			return listReservations(groupName)
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		r, err := runner.Reserve(ctx, groupName, reserveTTL, runner.AssignOptions{Priority: reservePriority, CallbackData: reserveCallbackData})
+		if err != nil {
+			return assignError(err)
+		}
+		if r.Deferred != "" {
+			fmt.Println(l10n.T(l10n.MsgReservationDeferred, "Group", groupName, "Time", r.Deferred))
+			return nil
+		}
+		fmt.Println(l10n.T(l10n.MsgReserved, "User", r.User, "ID", r.ID, "Time", r.ExpiresAt))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// commitCmd records a reservation as an assignment.
+var commitCmd = &cobra.Command{
+	Use:   "commit [groupname] [reservation-id]",
+	Short: "Record a reserved assignee as assigned",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		result, err := runner.CommitReservation(ctx, args[0], args[1])
+		if err != nil {
+			return reservationError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgAssigned, "User", result.User))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// releaseCmd gives up a reservation.
+var releaseCmd = &cobra.Command{
+	Use:   "release [groupname] [reservation-id]",
+	Short: "Give up a reservation without assigning",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, err := lockContext(context.Background(), cmd)
+		if err != nil {
+			return err
+		}
+		r, err := runner.ReleaseReservation(ctx, args[0], args[1])
+		if err != nil {
+			return reservationError(err)
+		}
+		fmt.Println(l10n.T(l10n.MsgReservationReleased, "ID", r.ID, "User", r.User))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// listReservations prints the active reservations of a group.
+func listReservations(group string) error {
+	reservations, err := runner.Reservations(group)
+	if err != nil {
+		return reservationError(err)
+	}
+	if len(reservations) == 0 {
+		fmt.Println(l10n.T(l10n.MsgNoReservations, "Group", group))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tRESERVED AT\tEXPIRES AT")
+	for _, r := range reservations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ID, r.User, r.ReservedAt, r.ExpiresAt)
+	}
+	return w.Flush()
+}
+
+// reservationError adds context to an error from committing or releasing a reservation.
+func reservationError(err error) error {
+	if errors.Is(err, runner.ErrReservationNotFound) {
+		return err
+	}
+	return assignError(err)
+}
+
+func init() {
+	reserveCmd.Flags().DurationVar(&reserveTTL, "ttl", runner.DefaultReservationTTL, "How long the user is held before the reservation lapses")
+	reserveCmd.Flags().StringVar(&reservePriority, "priority", "", "Priority of the assignment, e.g. P1, routed by the group's priorities")
+	reserveCmd.Flags().StringToStringVar(&reserveCallbackData, "callback-data", nil, "Data passed to the group's callback when the reservation is committed (repeatable)")
+	reserveCmd.Flags().BoolVar(&reserveList, "list", false, "List the active reservations of the group instead")
+	for _, cmd := range []*cobra.Command{reserveCmd, commitCmd, releaseCmd} {
+		addLockFlags(cmd)
+	}
+	rootCmd.AddCommand(reserveCmd, commitCmd, releaseCmd)
+}
@@ -4,23 +4,43 @@ package cmd
 
 import (
 	"autoassigner/config"
+	"autoassigner/l10n"
 	"autoassigner/runner"
 	"autoassigner/version"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	dryRun      bool
-	showCounts  bool
-	resetCounts bool
-	configFile  string
-	listGroups  bool
-	showVersion bool
+	dryRun         bool
+	showCounts     bool
+	resetCounts    bool
+	configFile     string
+	listGroups     bool
+	showVersion    bool
+	seed           int64
+	timeout        time.Duration
+	lang           string
+	priority       string
+	strategy       string
+	availability   string
+	requireChecks  bool
+	explain        bool
+	linearIssue    string
+	asanaTask      string
+	callbackData   map[string]string
+	roles          string
+	assignmentID   string
+	ignoreDisabled bool
+	allMatching    string
 )
 
 // rootCmd represents the base command when called without any subcommands.
@@ -30,12 +50,58 @@ var rootCmd = &cobra.Command{
 	Long: `Autoassigner is a tool for automatically assigning tasks to team members.
 It uses various selection strategies and availability checks to determine the next assignee.
 
+With --linear-issue or --asana-task the assigned user is also set as the
+assignee of that Linear issue or Asana task.
+
+With --roles several users are selected in one assignment, each from the
+pool of their role in the group config.
+
+With --output-field only the given identifier of the assignee is printed,
+such as their Slack member ID or email from the identity mapping, and with
+--json the assignment is printed as JSON with every known identifier.
+
+Assignments in a group disabled with "autoassigner group disable" fail
+with exit code 8, or exit successfully without assigning anyone when
+--ignore-disabled is given.
+
+With --strategy the group's strategy is replaced for this assignment only,
+e.g. to pick someone at random without editing the group file. The
+assignment log notes the override, and a round robin rotation stays where
+it was. Likewise --availability replaces the group's availability checker,
+e.g. with always_available to bypass a failing availability backend in an
+emergency; the assignment log notes the checker it replaced.
+
+With --require-all-checks the state storage is verified to accept writes
+and the availability checker to answer for every candidate before a user
+is selected, so a broken backend fails the assignment up front, with exit
+code 9 or 4, instead of after part of the state was written.
+
+With --explain a trace of the selection is printed on stderr: who the
+filters took out or skipped and why, and how the strategy ranked the
+candidates, also when nobody could be assigned. With --json the trace is
+part of the printed assignment.
+
+With --all-matching instead of a group, an assignment is made in every
+group matching a glob pattern, such as 'oncall-*' or 'platform/*'. Groups
+that fail don't stop the others; their errors are reported together.
+
 Example:
-  autoassigner team-alpha`,
+  autoassigner team-alpha
+  autoassigner --all-matching 'oncall-*'
+  autoassigner team-alpha --strategy random
+  autoassigner team-alpha --availability always_available
+  autoassigner team-alpha --require-all-checks
+  autoassigner team-alpha --dry-run --explain
+  autoassigner team-alpha --linear-issue ENG-123
+  autoassigner team-alpha --roles reviewer:2,qa:1
+  autoassigner team-alpha --output-field slack_id`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if listGroups || showVersion {
 			return nil
 		}
+		if allMatching != "" {
+			return cobra.NoArgs(cmd, args)
+		}
 		if len(args) != 1 {
 			return fmt.Errorf("requires exactly one argument")
 		}
@@ -48,16 +114,8 @@ Example:
 			return nil
 		}
 
-		if err := config.LoadConfig(configFile); err != nil {
-			// Provide more user-friendly error messages for common config issues
-			errMsg := err.Error()
-			if strings.Contains(errMsg, "does not exist") {
-				return fmt.Errorf("configuration file not found: %s\nPlease create a config.json file or specify a different path with --config", configFile)
-			}
-			if strings.Contains(errMsg, "invalid config") {
-				return fmt.Errorf("invalid configuration: %s\nPlease check your config file format and required fields", errMsg)
-			}
-			return fmt.Errorf("failed to load configuration: %w", err)
+		if err := loadConfig(); err != nil {
+			return err
 		}
 
 		// Handle list-groups flag
@@ -67,65 +125,66 @@ Example:
 				return fmt.Errorf("failed to list groups: %w", err)
 			}
 			if len(groups) == 0 {
-				fmt.Println("No groups found in config directory")
+				fmt.Println(l10n.T(l10n.MsgNoGroups))
 				return nil
 			}
 			sort.Strings(groups)
-			fmt.Println("Available groups:")
+			fmt.Println(l10n.T(l10n.MsgAvailableGroups))
 			for _, group := range groups {
 				fmt.Printf("  %s\n", group)
 			}
 			return nil
 		}
 
+		if allMatching != "" {
+			groups, err := targetGroups(allMatching)
+			if err != nil {
+				return err
+			}
+			if showCounts {
+				_, err := printGroupsCounts(os.Stdout, groups, nil)
+				return err
+			}
+			return assignGroups(cmd, groups)
+		}
+
 		groupName := args[0]
 
 		// Handle show-counts flag
 		if showCounts {
-			counts, orderedUsers, err := runner.GetCounts(groupName)
-			if err != nil {
-				if _, ok := err.(*runner.InvalidGroupError); ok {
-					return fmt.Errorf("%v\nUse --list-groups to see available groups", err)
-				}
-				return fmt.Errorf("failed to get counts: %w", err)
-			}
-			fmt.Printf("Assignment counts for group %s:\n", groupName)
-			for _, user := range orderedUsers {
-				fmt.Printf("  %s: %d\n", user, counts[user])
-			}
-			return nil
+			return showGroupCounts(groupName)
 		}
 
 		// Handle reset-counts flag
 		if resetCounts {
-			if err := runner.ResetCounts(groupName); err != nil {
-				if _, ok := err.(*runner.InvalidGroupError); ok {
-					return fmt.Errorf("%v\nUse --list-groups to see available groups", err)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			ctx, err := lockContext(ctx, cmd)
+			if err != nil {
+				return err
+			}
+			if err := runner.ResetCounts(ctx, groupName); err != nil {
+				if errors.Is(err, runner.ErrInvalidGroup) {
+					return withGroupHint(err)
 				}
 				return fmt.Errorf("failed to reset counts: %w", err)
 			}
-			fmt.Printf("Successfully reset assignment counts for group %s\n", groupName)
+			fmt.Println(l10n.T(l10n.MsgCountsReset, "Group", groupName))
 			return nil
 		}
 
 		// Normal assignment with optional dry-run
-		if err := runner.Assign(groupName, dryRun); err != nil {
-			switch e := err.(type) {
-			case *runner.InvalidGroupError:
-				return fmt.Errorf("%v\nUse --list-groups to see available groups", e)
-			case *runner.ConfigError:
-				return fmt.Errorf("configuration error: %w", e)
-			case *runner.SelectionError:
-				return fmt.Errorf("selection error: %w", e)
-			case *runner.AvailabilityError:
-				return fmt.Errorf("availability error: %w", e)
-			case *runner.NoAvailableAssigneeError:
-				return fmt.Errorf("no available assignee: %w", e)
-			default:
-				return fmt.Errorf("unexpected error: %w", err)
-			}
+		ctx, cancel, err := assignContext(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		return assignGroup(ctx, cmd, groupName)
+	},
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if lang != "" {
+			l10n.SetLanguage(lang)
 		}
-		return nil
 	},
 	SilenceUsage:  true, // Don't show usage on error
 	SilenceErrors: true, // Don't show errors (we'll handle them)
@@ -135,16 +194,202 @@ func init() {
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Simulate assignment without updating logs or counts")
 	rootCmd.Flags().BoolVar(&showCounts, "show-counts", false, "Display current assignment counts for the group")
 	rootCmd.Flags().BoolVar(&resetCounts, "reset-counts", false, "Reset assignment counts for the group")
-	rootCmd.Flags().StringVarP(&configFile, "config", "c", "config.json", "Path to the configuration file")
+	rootCmd.PersistentFlags().StringVar(&lang, "lang", "", "Language of the output, e.g. de or es (default from AUTOASSIGNER_LANG or LANG)")
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config.json", "Path to the configuration file")
 	rootCmd.Flags().BoolVarP(&listGroups, "list-groups", "l", false, "List all available groups")
 	rootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "Display version information")
+	rootCmd.Flags().Int64Var(&seed, "seed", 0, "Seed randomized strategies for reproducible selections")
+	rootCmd.Flags().StringVar(&priority, "priority", "", "Priority of the assignment, e.g. P1, routed by the group's priorities")
+	rootCmd.Flags().StringVar(&strategy, "strategy", "", "Strategy replacing the group's for this assignment, e.g. random, or a chain such as least_assigned,round_robin")
+	rootCmd.Flags().StringVar(&availability, "availability", "", "Availability checker replacing the group's for this assignment, e.g. always_available")
+	rootCmd.Flags().BoolVar(&requireChecks, "require-all-checks", false, "Verify that the state storage is writable and the availability backend answers for every candidate before selecting")
+	rootCmd.Flags().BoolVar(&explain, "explain", false, "Print how the assignee was selected: the users filtered out and why, and the strategy's ranking")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 0, "Abort the assignment after this duration, e.g. 10s (0 means no timeout)")
+	rootCmd.Flags().StringVar(&linearIssue, "linear-issue", "", "Set the assigned user as assignee of this Linear issue, e.g. ENG-123")
+	rootCmd.Flags().StringVar(&asanaTask, "asana-task", "", "Set the assigned user as assignee of the Asana task with this gid")
+	rootCmd.Flags().StringVar(&assignmentID, "id", "", "ID of the assignment, e.g. to retry a request safely; an ID already logged for the group is not assigned again")
+	rootCmd.Flags().StringVar(&roles, "roles", "", "Select users for several roles of the group at once, e.g. reviewer:2,qa:1")
+	rootCmd.MarkFlagsMutuallyExclusive("linear-issue", "asana-task", "roles")
+	rootCmd.Flags().BoolVar(&ignoreDisabled, "ignore-disabled", false, "Exit successfully without assigning anyone when the group is disabled")
+	rootCmd.Flags().StringVar(&allMatching, "all-matching", "", "Assign in every group matching this glob pattern, e.g. 'oncall-*', instead of a single group")
+	rootCmd.MarkFlagsMutuallyExclusive("all-matching", "linear-issue", "asana-task", "reset-counts")
+	rootCmd.Flags().StringToStringVar(&callbackData, "callback-data", nil, "Data passed to the group's callback, e.g. ticket=OPS-42 (repeatable)")
+	addLockFlags(rootCmd)
+	addOutputFlags(rootCmd)
+}
+
+// assignContext returns the context of assignments: cancelled on interrupt
+// or after --timeout, and holding the options of the lock flags.
+func assignContext(cmd *cobra.Command) (context.Context, context.CancelFunc, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	cancel := stop
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancel = func() { cancelTimeout(); stop() }
+	}
+	ctx, err := lockContext(ctx, cmd)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return ctx, cancel, nil
+}
+
+// assignGroup makes an assignment in a group as selected by the flags of the
+// root command and prints it.
+func assignGroup(ctx context.Context, cmd *cobra.Command, groupName string) error {
+	opts := runner.AssignOptions{ID: assignmentID, DryRun: dryRun, Priority: priority, Strategy: strategy, Availability: availability, RequireAllChecks: requireChecks, Explain: explain, CallbackData: callbackData, Silent: customOutput()}
+	if cmd.Flags().Changed("seed") {
+		opts.Seed = &seed
+	}
+	if linearIssue != "" || asanaTask != "" {
+		return skipDisabled(groupName, assignTask(ctx, groupName, opts))
+	}
+	if roles != "" {
+		requests, err := runner.ParseRoleRequests(roles)
+		if err != nil {
+			return fmt.Errorf("invalid --roles: %w", err)
+		}
+		result, err := runner.AssignRoles(ctx, groupName, requests, opts)
+		if err != nil {
+			explainFailure(err)
+			return skipDisabled(groupName, assignError(err))
+		}
+		if explain {
+			for _, s := range result.Selections {
+				fmt.Fprintf(os.Stderr, "Role %s:\n", s.Role)
+				printTrace(os.Stderr, s.Trace)
+			}
+		}
+		if result.Deferred != "" {
+			fmt.Println(l10n.T(l10n.MsgRolesDeferred, "Group", groupName, "Time", result.Deferred))
+		}
+		printAssignmentID(result.ID)
+		return nil
+	}
+	result, err := runner.AssignUser(ctx, groupName, opts)
+	if err != nil {
+		explainFailure(err)
+		return skipDisabled(groupName, assignError(err))
+	}
+	printAssignmentID(result.ID)
+	explainResult(result)
+	if customOutput() {
+		return printAssignment(ctx, groupName, result, opts.DryRun)
+	}
+	return nil
+}
+
+// assignGroups makes an assignment in each of groups, going on after groups
+// that fail. The output of each group follows its name, except with
+// --output-field or --json, whose JSON names the group. It reports how many
+// succeeded on stderr and returns the errors of the others together, so the
+// exit code is that of the first.
+func assignGroups(cmd *cobra.Command, groups []string) error {
+	ctx, cancel, err := assignContext(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	var errs []error
+	for _, group := range groups {
+		if !customOutput() {
+			fmt.Println(l10n.T(l10n.MsgGroupHeader, "Group", group))
+		}
+		if err := assignGroup(ctx, cmd, group); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", group, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	fmt.Fprintln(os.Stderr, l10n.T(l10n.MsgGroupsAssigned, "Assigned", len(groups)-len(errs), "Count", len(groups), "Pattern", allMatching))
+	return errors.Join(errs...)
+}
+
+// targetGroups returns the groups a command operates on: the group named,
+// or every group matching it when it is a glob pattern.
+func targetGroups(name string) ([]string, error) {
+	if !config.IsGroupPattern(name) {
+		return []string{name}, nil
+	}
+	groups, err := config.MatchGroups(name)
+	if err == nil && len(groups) == 0 {
+		err = fmt.Errorf("no group matches %s\n%s", name, l10n.T(l10n.MsgListGroupsHint))
+	}
+	if err != nil {
+		return nil, &exitCodeError{code: exitConfig, err: err}
+	}
+	return groups, nil
+}
+
+// printAssignmentID reports the ID of an assignment on stderr, keeping
+// stdout to the assignee for scripts and chat.
+func printAssignmentID(id string) {
+	if id != "" {
+		fmt.Fprintln(os.Stderr, l10n.T(l10n.MsgAssignmentID, "ID", id))
+	}
+}
+
+// assignError translates an error from an assignment into a message for the user.
+func assignError(err error) error {
+	switch {
+	case errors.Is(err, runner.ErrInvalidGroup):
+		return withGroupHint(err)
+	case errors.Is(err, runner.ErrGroupDisabled):
+		return wrapLocalized(l10n.MsgGroupDisabledError, err)
+	case errors.Is(err, runner.ErrInvalidOption), errors.Is(err, runner.ErrPreflight):
+		return err
+	case errors.Is(err, runner.ErrConfig):
+		return wrapLocalized(l10n.MsgConfigError, err)
+	case errors.Is(err, runner.ErrSelection):
+		return wrapLocalized(l10n.MsgSelectionError, err)
+	case errors.Is(err, runner.ErrAvailability):
+		return wrapLocalized(l10n.MsgAvailabilityError, err)
+	case errors.Is(err, runner.ErrNoAvailableAssignee):
+		return wrapLocalized(l10n.MsgNoAvailableAssignee, err)
+	case errors.Is(err, runner.ErrCallback):
+		return wrapLocalized(l10n.MsgCallbackError, err)
+	default:
+		return wrapLocalized(l10n.MsgUnexpectedError, err)
+	}
+}
+
+// skipDisabled turns the error of an assignment in a disabled group into a
+// notice on stderr when --ignore-disabled is given.
+func skipDisabled(group string, err error) error {
+	if ignoreDisabled && errors.Is(err, runner.ErrGroupDisabled) {
+		fmt.Fprintln(os.Stderr, l10n.T(l10n.MsgGroupDisabledSkipped, "Group", group))
+		return nil
+	}
+	return err
+}
+
+// loadConfig loads the configuration file selected with --config and
+// turns common failures into user-friendly messages.
+func loadConfig() error {
+	if err := config.LoadConfig(configFile); err != nil {
+		// Provide more user-friendly error messages for common config issues
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "does not exist") {
+			err = fmt.Errorf("configuration file not found: %s\nPlease create a config.json file or specify a different path with --config", configFile)
+		} else if strings.Contains(errMsg, "invalid config") {
+			err = fmt.Errorf("invalid configuration: %s\nPlease check your config file format and required fields", errMsg)
+		} else {
+			err = fmt.Errorf("failed to load configuration: %w", err)
+		}
+		return &exitCodeError{code: exitConfig, err: err}
+	}
+	return nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, l10n.T(l10n.MsgErrorPrefix, "Error", err.Error()))
+		os.Exit(exitCode(err))
 	}
 }
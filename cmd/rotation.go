@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/notify"
+	"autoassigner/runner"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotationTurns  int
+	rotationRemind bool
+	rotationJSON   bool
+)
+
+// rotationCmd lists the upcoming turns of the rotation of a group, or sends
+// the reminders of the turns of every group that are due.
+var rotationCmd = &cobra.Command{
+	Use:   "rotation [groupname]",
+	Short: "List the upcoming turns of a group's rotation or send their reminders",
+	Long: `List the turn in progress and the upcoming turns of the rotation of a
+group, as set by rotation in its config: who takes on its duty, such
+as support engineer of the week, when, and who passed their turn on as
+they are paused. Turns take the recorded pauses into account, including
+scheduled ones.
+
+With --remind, the members of the turns of every group starting within
+their group's rotation.remind_hours are sent a reminder through
+reminders.notifiers in the config, once per turn. "autoassigner serve"
+sends them as they become due; run this from cron instead when no
+server runs.
+
+Example:
+  autoassigner rotation team-alpha --turns 8
+  autoassigner rotation --remind`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		if rotationRemind {
+			if len(args) > 0 {
+				return fmt.Errorf("--remind sends the reminders of every group and takes no group")
+			}
+			if len(config.Settings.Reminders.Notifiers) == 0 {
+				return fmt.Errorf("no reminder notifiers in the config")
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			sent, err := deliverReminders(ctx, config.Settings.Reminders)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Sent %d reminder(s)\n", sent)
+			return nil
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("requires a group, or --remind")
+		}
+
+		turns, err := runner.ProjectRotation(args[0], time.Now(), rotationTurns)
+		if err != nil {
+			if errors.Is(err, runner.ErrInvalidGroup) {
+				return withGroupHint(err)
+			}
+			return fmt.Errorf("failed to project rotation: %w", err)
+		}
+		if rotationJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(turns)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TURN\tUSER\tSTART\tEND\tPAUSED")
+		for _, t := range turns {
+			user := t.User
+			if user == "" {
+				user = "-"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", t.Turn, user, t.Start.Format("Mon 2006-01-02 15:04"), t.End.Format("Mon 2006-01-02 15:04"), strings.Join(t.Skipped, ", "))
+		}
+		return w.Flush()
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// deliverReminders sends the reminders that are due to the notifiers of
+// conf and returns how many were sent. A reminder that fails is due again
+// the next time.
+func deliverReminders(ctx context.Context, conf config.RemindersConfig) (int, error) {
+	notifiers, err := notify.NewAll(conf.Notifiers)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reminders: %w", err)
+	}
+	due, err := runner.DueReminders(time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due reminders: %w", err)
+	}
+	sent := 0
+	for _, turn := range due {
+		if err := notify.Send(ctx, notifiers, turn.Reminder()); err != nil {
+			return sent, fmt.Errorf("failed to remind %s of their turn in %s: %w", turn.User, turn.Group, err)
+		}
+		if err := runner.MarkReminded(ctx, turn); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func init() {
+	rotationCmd.Flags().IntVar(&rotationTurns, "turns", 4, "Number of turns to list")
+	rotationCmd.Flags().BoolVar(&rotationRemind, "remind", false, "Send the reminders of every group that are due instead of listing turns")
+	rotationCmd.Flags().BoolVar(&rotationJSON, "json", false, "Print the turns as JSON")
+	rootCmd.AddCommand(rotationCmd)
+}
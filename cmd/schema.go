@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"autoassigner/schema"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// schemaCmd prints the JSON Schema for config.json or the group YAML files.
+var schemaCmd = &cobra.Command{
+	Use:   "schema [config|group]",
+	Short: "Print the JSON Schema for the configuration files",
+	Long: `Print the JSON Schema for config.json ("config") or for group YAML files ("group").
+The output can be used by editors to validate configuration as you type.
+
+Example:
+  autoassigner schema group > group.schema.json`,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"config", "group"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var s map[string]interface{}
+		switch args[0] {
+		case "config":
+			s = schema.Generate(config.Config{}, "autoassigner configuration", "json")
+		case "group":
+			s = schema.Generate(runner.AssigneeGroupConfig{}, "autoassigner group configuration", "yaml")
+		}
+
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal schema: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"autoassigner/server"
+	"autoassigner/tracing"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var serveListen string
+
+// serveCmd runs the webhook server.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the webhook server for integrations",
+	Long: `Serve webhooks from integrated systems and assign a user to every
+pull request, change, record, ticket, issue or task they report, from
+the group given in the group query parameter or chosen by the routes in
+the config (ServiceNow, Zendesk, Linear and Asana map their own groups
+instead).
+
+Endpoints:
+  POST /bitbucket  Bitbucket Cloud (pullrequest:created) and Data Center (pr:opened)
+  POST /gerrit     Gerrit patchset-created events of new changes (webhooks plugin)
+  POST /servicenow ServiceNow records sent by an outbound REST message
+  POST /zendesk    Zendesk tickets sent by a trigger webhook
+  POST /linear     Linear issue events (issue created)
+  POST /asana      Asana project events (task added)
+  GET  /state      Snapshot of the state of every group
+  GET  /groups/{group}/stats?window=30d
+                   Assignments, shares, skips and declines per user, for Grafana
+  PUT  /groups/{group}
+                   Create or replace the config of a group with the YAML body
+  PATCH /groups/{group}/users
+                   Add and remove users, e.g. {"add": ["carol"], "remove": ["bob"]}
+  POST /groups/{group}/assignments/{id}/ack
+  POST /groups/{group}/assignments/{id}/close
+                   Acknowledge or close an open assignment of a group with track_open
+  GET  /history    Assignments matching a query, e.g. ?user=alice&since=90d
+  GET  /healthz    Health and role of the replica (standalone, leader or follower)
+  GET  /version    Build information, like "autoassigner version --json"
+  GET  /metrics    Time to acknowledge and close assignments and open work, for Prometheus
+
+Callers are identified and restricted to routes and groups as set by
+server.auth in the config, and server.tls_cert serves HTTPS. Every request
+is logged to stderr as JSON (see server.access_log) and recorded in the
+audit sinks of server.audit. The X-Request-ID and W3C traceparent of a
+request, or generated IDs, are logged with it, passed on to the systems
+called while handling it and stored as request_id and trace_id in the
+metadata of the assignment it makes.
+
+With server.consumer in the config, the server also consumes assignment
+requests such as {"group": "team-alpha", "metadata": {"ticket": "T-1"}}
+from a Kafka topic (through a Kafka REST Proxy) or a NATS subject, and
+publishes the results to server.consumer.reply_subject, or to the reply
+subject of NATS requests.
+
+With slack.app_token in the config, the server also runs a Slack bot in
+socket mode, which answers mentions, direct messages and slash commands
+such as "assign team-alpha for INC-123", "who's next on team-alpha" and
+"pause me until monday". Slack users are mapped to usernames through the
+identity config.
+
+With server.ui.client_id in the config, the server also serves a web UI at
+/ui, where people log in through the OpenID Connect provider of
+server.auth.oidc to pause themselves, schedule a vacation and see their
+assignments of the past 30 days.
+
+With reminders.notifiers in the config, the members of group rotations
+are reminded of their turns rotation.remind_hours before they start (see
+"autoassigner rotation").
+
+Open assignments of groups with an escalation chain that weren't
+acknowledged in time are escalated every minute, and the escalations sent
+to escalations.notifiers in the config (see "autoassigner escalate").
+
+With server.flush_queue_seconds in the config, assignments deferred by
+quiet hours are made at that interval once their quiet hours end.
+
+The records older than the history retention of the groups are pruned
+once a day (see "autoassigner maintain").
+
+With digest.notifiers in the config, a digest of the past week of the
+groups is sent to them every week on digest.day at digest.time (see
+"autoassigner digest").
+
+Several replicas can serve the same groups with server.replicas enabled:
+every assignment then takes the lock of its group from storage.lock, and
+the replicas elect a leader through the same Redis, which alone flushes
+the deferral queue, escalates, prunes the history and sends the digest
+and reminders.
+
+The server runs until interrupted or terminated. With
+secrets.refresh_seconds in the config, secret references are resolved
+again at that interval, so rotated tokens are picked up without a
+restart.
+
+Example:
+  autoassigner serve --listen :8080`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		authorizer, err := server.NewAuthorizer(config.Settings.Server)
+		if err != nil {
+			return fmt.Errorf("invalid server auth: %w", err)
+		}
+		handler := server.Protect(server.Handler(), authorizer, config.Settings.Server.Auth.Policies)
+		if config.Settings.Server.UI.ClientID != "" {
+			// Browsers log in to the UI with a session cookie rather than a bearer token
+			ui := server.NewUI()
+			mux := http.NewServeMux()
+			mux.Handle("/", handler)
+			mux.Handle("/ui", ui)
+			mux.Handle("/ui/", ui)
+			handler = mux
+			log.Printf("Serving the web UI at /ui")
+		}
+		if seconds := config.Settings.Secrets.RefreshSeconds; seconds > 0 {
+			handler = refreshSecrets(ctx, handler, time.Duration(seconds)*time.Second)
+		}
+		sinks, err := server.NewAuditSinks(config.Settings.Server)
+		if err != nil {
+			return fmt.Errorf("invalid server audit: %w", err)
+		}
+		handler = server.Trace(server.Audit(handler, sinks...))
+		// Requests to other systems continue the trace of the request they are made for
+		tracing.Install()
+		if consumer := config.Settings.Server.Consumer; consumer.Type != "" {
+			go func() {
+				if err := server.Consume(ctx, settingsMu.RLocker(), sinks...); err != nil {
+					log.Printf("Consumer stopped: %v", err)
+				}
+			}()
+			log.Printf("Consuming assignment requests from %s %s", consumer.Type, consumer.Subject)
+		}
+		if config.Settings.Slack.AppToken != "" {
+			go func() {
+				if err := server.ServeSlack(ctx, settingsMu.RLocker(), sinks...); err != nil {
+					log.Printf("Slack bot stopped: %v", err)
+				}
+			}()
+			log.Printf("Running the Slack bot in socket mode")
+		}
+		if len(config.Settings.Digest.Notifiers) > 0 {
+			if _, err := runner.NextDigest(config.Settings.Digest, time.Now()); err != nil {
+				return fmt.Errorf("invalid digest: %w", err)
+			}
+		}
+		elector, err := runner.NewElector()
+		if err != nil {
+			return fmt.Errorf("invalid server replicas: %w", err)
+		}
+		server.SetElector(elector)
+		lead := func(ctx context.Context) {
+			var wg sync.WaitGroup
+			if seconds := config.Settings.Server.FlushQueueSeconds; seconds > 0 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					flushQueue(ctx, time.Duration(seconds)*time.Second)
+				}()
+			}
+			if len(config.Settings.Digest.Notifiers) > 0 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sendDigests(ctx)
+				}()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				escalateAssignments(ctx)
+			}()
+			if len(config.Settings.Reminders.Notifiers) > 0 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sendReminders(ctx)
+				}()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				maintainHistory(ctx)
+			}()
+			wg.Wait()
+		}
+		led := make(chan struct{})
+		go func() {
+			defer close(led)
+			if elector != nil {
+				elector.Run(ctx, lead)
+			} else {
+				lead(ctx)
+			}
+		}()
+		// The leadership is released before exiting, so another replica takes over at once
+		defer func() {
+			cancel()
+			<-led
+		}()
+		srv := &http.Server{Addr: serveListen, Handler: handler}
+		conf := config.Settings.Server
+		if conf.ClientCA != "" {
+			pem, err := os.ReadFile(conf.ClientCA)
+			if err != nil {
+				return fmt.Errorf("failed to read client_ca: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in client_ca %s", conf.ClientCA)
+			}
+			// Callers without a certificate can still be let in by other policies, e.g. webhooks
+			srv.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+		}
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdown)
+		}()
+
+		log.Printf("Listening on %s", serveListen)
+		if conf.TLSCert != "" {
+			err = srv.ListenAndServeTLS(conf.TLSCert, conf.TLSKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("server failed: %w", err)
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// settingsMu is held for reading while a request is handled and for
+// writing while refreshSecrets replaces the settings.
+var settingsMu sync.RWMutex
+
+// refreshSecrets resolves the secret references of the config every interval
+// until ctx is done and replaces the settings with the result. Requests to
+// handler read the settings, so they are replaced between requests; a
+// failed refresh is logged and keeps the previous secrets.
+func refreshSecrets(ctx context.Context, handler http.Handler, interval time.Duration) http.Handler {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			refreshed, err := config.RefreshSecrets(ctx)
+			if err != nil {
+				log.Printf("Failed to refresh secrets: %v", err)
+				continue
+			}
+			settingsMu.Lock()
+			config.Settings = *refreshed
+			settingsMu.Unlock()
+		}
+	}()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settingsMu.RLock()
+		defer settingsMu.RUnlock()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// flushQueue makes the deferred assignments that are due every interval
+// until ctx is done, logging those that fail; they stay queued.
+func flushQueue(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		settingsMu.RLock()
+		results, err := runner.FlushQueue(ctx, false)
+		settingsMu.RUnlock()
+		for _, result := range results {
+			if result.Err != nil {
+				log.Printf("Failed to make deferred assignment %s of %s: %v", result.Assignment.ID, result.Assignment.Group, result.Err)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to flush queue: %v", err)
+		}
+	}
+}
+
+// sendDigests sends the digest to its notifiers every week when it is due,
+// until ctx is done, logging digests that fail.
+func sendDigests(ctx context.Context) {
+	for {
+		settingsMu.RLock()
+		next, err := runner.NextDigest(config.Settings.Digest, time.Now())
+		settingsMu.RUnlock()
+		if err != nil {
+			log.Printf("Failed to schedule digest: %v", err)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		settingsMu.RLock()
+		err = deliverDigest(ctx, config.Settings.Digest)
+		settingsMu.RUnlock()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to send digest: %v", err)
+		}
+		// Wait for the minute to pass, so the digest isn't due again at once
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+// sendReminders sends the reminders of the turns of group rotations as they
+// become due, checking every minute until ctx is done, and logs reminders
+// that fail; they are due again at the next check.
+func sendReminders(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		settingsMu.RLock()
+		_, err := deliverReminders(ctx, config.Settings.Reminders)
+		settingsMu.RUnlock()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to send reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// escalateAssignments takes the steps of the escalation chains of the
+// groups as they become due, checking every minute until ctx is done, and
+// logs the steps taken and those that fail.
+func escalateAssignments(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		settingsMu.RLock()
+		taken, err := escalate(ctx, config.Settings.Escalations)
+		settingsMu.RUnlock()
+		for _, e := range taken {
+			log.Print(e.Message())
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to escalate assignments: %v", err)
+		}
+	}
+}
+
+// maintainHistory prunes the records older than the history retention of
+// the groups once a day, starting an hour after the server, until ctx is
+// done, and logs the records pruned and the groups that fail.
+func maintainHistory(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		settingsMu.RLock()
+		maintained, err := runner.Maintain(ctx, time.Now(), runner.MaintainOptions{Archive: config.Settings.Maintenance.Archive})
+		settingsMu.RUnlock()
+		for _, m := range maintained {
+			log.Print(describeMaintenance(m, false))
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to prune history: %v", err)
+		}
+		timer.Reset(24 * time.Hour)
+	}
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", ":8080", "Address to listen on")
+	rootCmd.AddCommand(serveCmd)
+}
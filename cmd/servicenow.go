@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"autoassigner/servicenow"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	servicenowGroup    string
+	servicenowInterval time.Duration
+	servicenowOnce     bool
+)
+
+// servicenowCmd groups the commands of the ServiceNow integration.
+var servicenowCmd = &cobra.Command{
+	Use:   "servicenow",
+	Short: "Assign ServiceNow incidents",
+}
+
+// servicenowPollCmd polls ServiceNow for unassigned records and assigns them.
+var servicenowPollCmd = &cobra.Command{
+	Use:   "poll",
+	Short: "Assign unassigned ServiceNow records",
+	Long: `Query ServiceNow for records matching servicenow.poll_query, by default
+active incidents without an assignee, and set their assignee to a user
+from the group given with --group or mapped to the record's assignment
+group in servicenow.groups. Records of unmapped groups are left alone.
+
+Polls every --interval until interrupted, or once with --once. Instances
+can send records to "autoassigner serve" with an outbound REST message
+instead.
+
+Example:
+  autoassigner servicenow poll --interval 2m`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		for {
+			if err := pollServiceNow(ctx); err != nil {
+				if servicenowOnce {
+					return err
+				}
+				log.Printf("Warning: %v", err)
+			}
+			if servicenowOnce {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(servicenowInterval):
+			}
+		}
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// pollServiceNow assigns every unassigned record. A record that cannot be
+// assigned is reported and the remaining records are still tried.
+func pollServiceNow(ctx context.Context) error {
+	records, err := servicenow.UnassignedRecords(ctx)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		groupName := servicenowGroup
+		if groupName == "" {
+			var ok bool
+			if groupName, ok = servicenow.Group(record); !ok {
+				continue
+			}
+		}
+
+		// Records polled during quiet hours are picked up by a later poll
+		result, err := runner.AssignUser(ctx, groupName, runner.AssignOptions{NoQueue: true})
+		if err != nil {
+			log.Printf("Warning: failed to assign %s: %v", record, assignError(err))
+			continue
+		}
+		if result.Deferred != "" {
+			continue
+		}
+		userID, err := servicenow.UserID(ctx, result.User)
+		if err == nil {
+			err = servicenow.Assign(ctx, record, userID)
+		}
+		if err != nil {
+			log.Printf("Warning: assigned %s to %s but failed to update it: %v", result.User, record, err)
+			continue
+		}
+		log.Print(l10n.T(l10n.MsgAssigneeAdded, "Change", record, "Login", result.User))
+	}
+	return nil
+}
+
+func init() {
+	servicenowPollCmd.Flags().StringVar(&servicenowGroup, "group", "", "Group to assign from instead of the one mapped to the record's group")
+	servicenowPollCmd.Flags().DurationVar(&servicenowInterval, "interval", time.Minute, "Time between polls")
+	servicenowPollCmd.Flags().BoolVar(&servicenowOnce, "once", false, "Poll once and exit")
+	servicenowCmd.AddCommand(servicenowPollCmd)
+	rootCmd.AddCommand(servicenowCmd)
+}
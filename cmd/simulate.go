@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	simulateRuns         int
+	simulateOverride     string
+	simulateAvailability map[string]string
+	simulatePriority     string
+	simulateSeed         int64
+)
+
+// simulateCmd reports how many simulated assignments would be distributed over a group.
+var simulateCmd = &cobra.Command{
+	Use:   "simulate [groupname]",
+	Short: "Simulate many assignments and report the distribution",
+	Long: `Simulate many assignments of a group in memory and report how they
+would be distributed, without changing any stored state.
+
+Everyone is treated as available unless --availability gives users a
+probability of being available. --config-override simulates a proposed
+group file instead of the current one.
+
+Example:
+  autoassigner simulate team-alpha --runs 1000 --config-override proposed.yaml --availability alice=0.8`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		opts := runner.SimulateOptions{
+			Runs:         simulateRuns,
+			ConfigPath:   simulateOverride,
+			Availability: make(map[string]float64, len(simulateAvailability)),
+			Priority:     simulatePriority,
+		}
+		for user, value := range simulateAvailability {
+			p, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return &exitCodeError{code: exitConfig, err: fmt.Errorf("invalid availability for %s: %s", user, value)}
+			}
+			opts.Availability[user] = p
+		}
+		if cmd.Flags().Changed("seed") {
+			opts.Seed = &simulateSeed
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		result, err := runner.Simulate(ctx, args[0], opts)
+		if err != nil {
+			switch {
+			case errors.Is(err, runner.ErrInvalidGroup):
+				return withGroupHint(err)
+			case errors.Is(err, runner.ErrConfig):
+				return wrapLocalized(l10n.MsgConfigError, err)
+			default:
+				return err
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "USER\tASSIGNED\tSHARE\tSKIPPED")
+		for _, user := range result.Users {
+			share := 100 * float64(result.Assignments[user]) / float64(result.Runs)
+			fmt.Fprintf(w, "%s\t%d\t%.1f%%\t%d\n", user, result.Assignments[user], share, result.Skips[user])
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if result.Unassigned > 0 {
+			fmt.Printf("Unassigned: %d of %d runs\n", result.Unassigned, result.Runs)
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	simulateCmd.Flags().IntVar(&simulateRuns, "runs", 1000, "Number of assignments to simulate")
+	simulateCmd.Flags().StringVar(&simulateOverride, "config-override", "", "Group file to simulate instead of the group's current config")
+	simulateCmd.Flags().StringToStringVar(&simulateAvailability, "availability", nil, "Probability of users being available, e.g. alice=0.8,bob=0.5")
+	simulateCmd.Flags().StringVar(&simulatePriority, "priority", "", "Priority of the simulated assignments")
+	simulateCmd.Flags().Int64Var(&simulateSeed, "seed", 0, "Seed for reproducible simulations")
+	rootCmd.AddCommand(simulateCmd)
+}
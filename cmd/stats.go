@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// statsCmd displays per-user assignment, skip and decline statistics for a group.
+var statsCmd = &cobra.Command{
+	Use:   "stats [groupname]",
+	Short: "Display assignment statistics for a group",
+	Long: `Display per-user statistics for a group: assignment counts overall and
+in the current day, week (starting Monday) and month, how often
+each user was skipped as unavailable and when, declines in the
+current decline budget period and, for groups with track_open, their
+open assignments, the oldest one, and the median time they took to
+acknowledge and to close assignments.
+
+Example:
+  autoassigner stats team-alpha`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		stats, err := runner.GetStats(context.Background(), args[0])
+		if err != nil {
+			if errors.Is(err, runner.ErrInvalidGroup) {
+				return withGroupHint(err)
+			}
+			return fmt.Errorf("failed to get statistics: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "USER\tASSIGNED\tTODAY\tWEEK\tMONTH\tSKIPPED\tLAST SKIPPED\tDECLINES\tOPEN\tOLDEST OPEN\tMEDIAN ACK\tMEDIAN CLOSE")
+		for _, s := range stats {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t%s\t%s\t%s\n", s.User, s.Assignments, s.Today, s.Week, s.Month, s.Skips, s.LastSkipped, s.Declines,
+				s.Open, s.OldestOpen, durationCell(s.MedianAck), durationCell(s.MedianClose))
+		}
+		return w.Flush()
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// durationCell formats a duration for a table cell, "-" when it is zero.
+func durationCell(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.String()
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+}
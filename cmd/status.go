@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusAll  bool
+	statusJSON bool
+)
+
+// statusCmd prints a snapshot of the state of one or all groups.
+var statusCmd = &cobra.Command{
+	Use:   "status [groupname]",
+	Short: "Show the state of a group or of all groups",
+	Long: `Show a snapshot of the state of a group, or with --all of every group:
+the position of the rotation, the last assignment, paused users
+(never_available or "autoassigner pause"), reserved users and whether the group is locked.
+
+With --json the snapshot is printed as JSON, including the assignment
+counts of every user, as served by GET /state of "autoassigner serve".
+
+Examples:
+  autoassigner status team-alpha
+  autoassigner status --all --json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		if statusAll == (len(args) == 1) {
+			return fmt.Errorf("either a group or --all is required")
+		}
+
+		ctx := context.Background()
+		var states []runner.GroupState
+		if statusAll {
+			var err error
+			if states, err = runner.GetState(ctx); err != nil {
+				return err
+			}
+		} else {
+			state, err := runner.GetGroupState(ctx, args[0])
+			if err != nil {
+				if errors.Is(err, runner.ErrInvalidGroup) {
+					return withGroupHint(err)
+				}
+				return fmt.Errorf("failed to get state: %w", err)
+			}
+			states = []runner.GroupState{*state}
+		}
+
+		if statusJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if statusAll {
+				return enc.Encode(map[string]interface{}{"groups": states})
+			}
+			return enc.Encode(states[0])
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "GROUP\tLAST INDEX\tLAST ASSIGNEE\tLAST ASSIGNED\tPAUSED\tRESERVED\tLOCK")
+		for _, s := range states {
+			if s.Error != "" {
+				fmt.Fprintf(w, "%s\terror: %s\n", s.Group, s.Error)
+				continue
+			}
+			assignee, assigned := "-", "-"
+			if s.LastAssignment != nil {
+				assignee, assigned = s.LastAssignment.User, s.LastAssignment.Timestamp
+			}
+			lock := "-"
+			switch {
+			case s.Locked:
+				lock = "held by " + s.LockHolder
+			case s.LockBackend != "":
+				lock = "free"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", s.Group, s.LastIndex, assignee, assigned, userList(pausedList(s)), userList(s.Reserved), lock)
+		}
+		return w.Flush()
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// userList joins users for a table cell, "-" when there are none.
+func userList(users []string) string {
+	if len(users) == 0 {
+		return "-"
+	}
+	return strings.Join(users, ",")
+}
+
+// pausedList returns the members of a group out of the rotation, whether
+// listed in never_available or paused with "autoassigner pause".
+func pausedList(s runner.GroupState) []string {
+	paused := append([]string{}, s.Paused...)
+	for _, user := range s.Users {
+		if _, ok := s.PausedUntil[user]; ok && !slices.Contains(paused, user) {
+			paused = append(paused, user)
+		}
+	}
+	return paused
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusAll, "all", false, "Show every group")
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the snapshot as JSON")
+	rootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"autoassigner/asana"
+	"autoassigner/l10n"
+	"autoassigner/linear"
+	"autoassigner/runner"
+	"context"
+	"fmt"
+)
+
+// assignTask assigns a user from a group to the Linear issue or Asana task
+// given with --linear-issue or --asana-task and sets them as its assignee.
+// Dry runs and deferred assignments leave the issue or task unchanged.
+func assignTask(ctx context.Context, groupName string, opts runner.AssignOptions) error {
+	var item fmt.Stringer
+	var lookup func(context.Context, string) (string, error)
+	var update func(context.Context, string) error
+	if linearIssue != "" {
+		issue, err := linear.GetIssue(ctx, linearIssue)
+		if err != nil {
+			return err
+		}
+		item, lookup = issue, linear.UserID
+		update = func(ctx context.Context, id string) error { return linear.Assign(ctx, *issue, id) }
+	} else {
+		task, err := asana.GetTask(ctx, asanaTask)
+		if err != nil {
+			return err
+		}
+		item, lookup = task, asana.Assignee
+		update = func(ctx context.Context, id string) error { return asana.Assign(ctx, *task, id) }
+	}
+
+	result, err := runner.AssignUser(ctx, groupName, opts)
+	if err != nil {
+		explainFailure(err)
+		return assignError(err)
+	}
+	printAssignmentID(result.ID)
+	explainResult(result)
+	if result.Deferred != "" || opts.DryRun {
+		if customOutput() {
+			return printAssignment(ctx, groupName, result, opts.DryRun)
+		}
+		return nil
+	}
+	id, err := lookup(ctx, result.User)
+	if err == nil {
+		err = update(ctx, id)
+	}
+	if err != nil {
+		return fmt.Errorf("assigned %s but failed to update %s: %w", result.User, item, err)
+	}
+	if customOutput() {
+		return printAssignment(ctx, groupName, result, false)
+	}
+	fmt.Println(l10n.T(l10n.MsgAssigneeAdded, "Change", item, "Login", result.User))
+	return nil
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"autoassigner/testutil"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	testServerAddr     string
+	testServerDir      string
+	testServerUsers    []string
+	testServerStatuses map[string]string
+
+	webhookURL    string
+	webhookSecret string
+	webhookRepo   string
+	webhookNumber int
+	webhookAuthor string
+)
+
+// testServerCmd runs a fake In/Out API together with a matching config tree.
+var testServerCmd = &cobra.Command{
+	Use:   "testserver",
+	Short: "Run a fake In/Out API and config tree for integration tests",
+	Long: `Start a fake In/Out status API and write a config tree that uses it,
+so pipelines integrating autoassigner can run end-to-end tests without
+real services. The server runs until interrupted.
+
+A group named "example" using the inout checker is created with --users.
+Statuses are set with --status; users without one are in the office.
+Pull request events of GitHub, GitLab and Bitbucket are sent to a running
+"autoassigner serve" with "autoassigner testserver webhook".
+
+Example:
+  autoassigner testserver --users alice,bob --status bob=OOO`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := testServerDir
+		if dir == "" {
+			tmp, err := os.MkdirTemp("", "autoassigner-testserver")
+			if err != nil {
+				return fmt.Errorf("failed to create temp dir: %w", err)
+			}
+			defer os.RemoveAll(tmp)
+			dir = tmp
+		}
+
+		server, err := testutil.NewInOutServerAt(testServerAddr, testServerStatuses)
+		if err != nil {
+			return fmt.Errorf("failed to start fake In/Out API: %w", err)
+		}
+		defer server.Close()
+
+		tree, err := testutil.NewConfigTree(dir, server.URL())
+		if err != nil {
+			return fmt.Errorf("failed to write config tree: %w", err)
+		}
+		if err := tree.AddGroup("example", "round_robin", "inout", testServerUsers...); err != nil {
+			return fmt.Errorf("failed to write example group: %w", err)
+		}
+
+		fmt.Printf("Fake In/Out API: %s\n", server.URL())
+		fmt.Printf("Batch endpoint:  %s\n", server.BatchURL())
+		fmt.Printf("Config file:     %s\n", tree.ConfigPath)
+		fmt.Printf("Try:             autoassigner --config %s example\n", tree.ConfigPath)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		<-ctx.Done()
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// testWebhookCmd sends a pull request event shaped like those of a VCS host.
+var testWebhookCmd = &cobra.Command{
+	Use:   "webhook <github|gitlab|bitbucket>",
+	Short: "Send a pull request event of a VCS host to a webhook server",
+	Long: `Send an opened pull request event shaped like those of GitHub, GitLab or
+Bitbucket Cloud to --url, such as the endpoint of "autoassigner serve", to
+test webhook integrations end to end. With --secret the event is signed,
+or for GitLab carries the token, as the host would send it.
+
+Example:
+  autoassigner testserver webhook github --url http://localhost:8080/github --secret s3cr3t --repo org/repo --number 7 --author alice`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"github", "gitlab", "bitbucket"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var resp *http.Response
+		var err error
+		switch args[0] {
+		case "github":
+			resp, err = testutil.SendGitHubPullRequest(webhookURL, webhookSecret, webhookRepo, webhookNumber, webhookAuthor)
+		case "gitlab":
+			resp, err = testutil.SendGitLabMergeRequest(webhookURL, webhookSecret, webhookRepo, webhookNumber, webhookAuthor)
+		case "bitbucket":
+			resp, err = testutil.SendBitbucketPullRequest(webhookURL, webhookSecret, webhookRepo, webhookNumber, webhookAuthor)
+		default:
+			return fmt.Errorf("unknown VCS host %q; use github, gitlab or bitbucket", args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to send webhook: %w", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("%s\n%s", resp.Status, body)
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook was answered with %s", resp.Status)
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	testWebhookCmd.Flags().StringVar(&webhookURL, "url", "", "URL the event is sent to, e.g. http://localhost:8080/github")
+	testWebhookCmd.Flags().StringVar(&webhookSecret, "secret", "", "Secret the event is signed with, or the token sent with GitLab events")
+	testWebhookCmd.Flags().StringVar(&webhookRepo, "repo", "example/repo", "Repository or project of the pull request")
+	testWebhookCmd.Flags().IntVar(&webhookNumber, "number", 1, "Number of the pull request")
+	testWebhookCmd.Flags().StringVar(&webhookAuthor, "author", "alice", "Author of the pull request")
+	testWebhookCmd.MarkFlagRequired("url")
+	testServerCmd.AddCommand(testWebhookCmd)
+
+	testServerCmd.Flags().StringVar(&testServerAddr, "addr", "127.0.0.1:0", "Address for the fake In/Out API")
+	testServerCmd.Flags().StringVar(&testServerDir, "dir", "", "Directory for the config tree (default: a temporary directory removed on exit)")
+	testServerCmd.Flags().StringSliceVar(&testServerUsers, "users", []string{"alice", "bob", "charlie"}, "Users of the example group")
+	testServerCmd.Flags().StringToStringVar(&testServerStatuses, "status", nil, "In/Out status per user, e.g. bob=OOO")
+	rootCmd.AddCommand(testServerCmd)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"autoassigner/l10n"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+)
+
+// userCmd groups the commands managing users of a group.
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage the stored state of users",
+}
+
+// userRenameCmd merges the stored state of a renamed user into their new name.
+var userRenameCmd = &cobra.Command{
+	Use:   "rename [groupname] [oldname] [newname]",
+	Short: "Merge the counts and history of a renamed user",
+	Long: `Merge the stored state of a user who was renamed in the group config:
+their count and skip debt are added to the new name, and the user field
+of the assignment, skip and decline logs and of open assignments is
+rewritten. Update the group config first, so that it lists the new name
+and no longer the old one.
+
+To keep the old name in the logs instead, list it under the user's
+aliases in the group config.
+
+Example:
+  autoassigner user rename team-alpha asmith alice`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, err := lockContext(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		groupName, oldName, newName := args[0], args[1], args[2]
+		if err := runner.RenameUser(ctx, groupName, oldName, newName); err != nil {
+			switch {
+			case errors.Is(err, runner.ErrInvalidGroup):
+				return withGroupHint(err)
+			case errors.Is(err, runner.ErrConfig):
+				return wrapLocalized(l10n.MsgConfigError, err)
+			default:
+				return fmt.Errorf("failed to rename user: %w", err)
+			}
+		}
+		fmt.Println(l10n.T(l10n.MsgUserRenamed, "User", oldName, "NewUser", newName, "Group", groupName))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	addLockFlags(userRenameCmd)
+	userCmd.AddCommand(userRenameCmd)
+	rootCmd.AddCommand(userCmd)
+}
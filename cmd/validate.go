@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCheckUsers bool
+
+// validateCmd checks the config of one or all groups.
+var validateCmd = &cobra.Command{
+	Use:   "validate [groupname]",
+	Short: "Check group configs for mistakes",
+	Long: `Check the config of every group (or only the given one) and report
+problems such as unknown strategies or availability checkers and roles
+without members.
+
+With --check-users the availability backend is asked about every user,
+for checkers that can look users up (inout), and users are looked up in
+the identity mapping if one is configured. Misspelled usernames are
+reported instead of failing assignments later.
+
+Example:
+  autoassigner validate team-alpha --check-users`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		groups := args
+		if len(groups) == 0 {
+			var err error
+			groups, err = config.ListGroups()
+			if err != nil {
+				return fmt.Errorf("failed to list groups: %w", err)
+			}
+			sort.Strings(groups)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		found := 0
+		for _, group := range groups {
+			issues, err := runner.ValidateGroup(ctx, group, validateCheckUsers)
+			if err != nil {
+				if errors.Is(err, runner.ErrInvalidGroup) {
+					return withGroupHint(err)
+				}
+				return fmt.Errorf("failed to validate group %s: %w", group, err)
+			}
+			if len(issues) == 0 {
+				fmt.Printf("%s: ok\n", group)
+				continue
+			}
+
+			fmt.Printf("%s: %d issue(s)\n", group, len(issues))
+			for _, issue := range issues {
+				fmt.Printf("  %s\n", issue)
+			}
+			found += len(issues)
+		}
+
+		if found > 0 {
+			return &exitCodeError{code: exitConfig, err: fmt.Errorf("found %d issue(s)", found)}
+		}
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	validateCmd.Flags().BoolVar(&validateCheckUsers, "check-users", false, "Look up every user in the availability backend and identity mapping")
+	rootCmd.AddCommand(validateCmd)
+}
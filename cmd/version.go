@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"autoassigner/runner"
+	"autoassigner/version"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var versionJSON bool
+
+// versionCmd prints version information, optionally as JSON for tooling.
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Display version information",
+	Long: `Display version information.
+
+With --json the output is machine-readable and includes the Go version,
+platform and enabled backends, so deployment tooling can assert versions.
+
+Example:
+  autoassigner version --json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !versionJSON {
+			fmt.Println(version.String())
+			return nil
+		}
+		data, err := versionInfo().JSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal version information: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "Print version information as JSON")
+	rootCmd.AddCommand(versionCmd)
+}
+
+// versionInfo returns the build information together with the compiled-in backends.
+func versionInfo() version.Info {
+	info := version.Get()
+	info.Backends = runner.Backends()
+	return info
+}
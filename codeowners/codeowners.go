@@ -0,0 +1,88 @@
+// Package codeowners reads CODEOWNERS files, which assign owners to the
+// files of a repository by path pattern, as used by GitHub and GitLab.
+package codeowners
+
+import (
+	"autoassigner/vcs"
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// Rule assigns owners to the files matching a pattern.
+type Rule struct {
+	Pattern string   // Pattern as written in the file
+	Owners  []string // Owners as written, e.g. @alice, @acme/backend or alice@example.com
+}
+
+// File is a parsed CODEOWNERS file.
+type File struct {
+	Rules []Rule
+}
+
+// Parse reads a CODEOWNERS file. Comments, blank lines and GitLab section
+// headers are skipped.
+func Parse(data []byte) *File {
+	f := &File{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 && (i == 0 || line[i-1] != '\\') {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "[") || strings.HasPrefix(fields[0], "^[") {
+			continue
+		}
+		f.Rules = append(f.Rules, Rule{Pattern: strings.ReplaceAll(fields[0], `\#`, "#"), Owners: fields[1:]})
+	}
+	return f
+}
+
+// Owners returns the owners of a file: those of the last rule matching it.
+func (f *File) Owners(file string) []string {
+	for i := len(f.Rules) - 1; i >= 0; i-- {
+		if Match(f.Rules[i].Pattern, file) {
+			return f.Rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// OwnersOf returns the owners of any of the files, each once, in the order
+// they are first found.
+func (f *File) OwnersOf(files []string) []string {
+	seen := map[string]bool{}
+	var owners []string
+	for _, file := range files {
+		for _, owner := range f.Owners(file) {
+			if !seen[owner] {
+				seen[owner] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// Match reports whether a CODEOWNERS pattern matches a file, following the
+// gitignore rules GitHub documents: patterns without a slash other than a
+// trailing one match at any depth, other patterns are relative to the root,
+// and patterns match the contents of the directories they name, except that
+// a trailing /* matches only the files directly in a directory.
+func Match(pattern, file string) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	if !dirOnly && vcs.MatchPath(pattern, file) {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return false
+	}
+	return vcs.MatchPath(pattern+"/*/**", file)
+}
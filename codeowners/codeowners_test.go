@@ -0,0 +1,63 @@
+package codeowners
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{"*", "any/file.txt", true},
+		{"*.js", "web/app.js", true},
+		{"*.js", "web/app.jsx", false},
+		{"/build/logs/", "build/logs/x.log", true},
+		{"/build/logs/", "src/build/logs/x.log", false},
+		{"docs/*", "docs/getting-started.md", true},
+		{"docs/*", "docs/build-app/troubleshooting.md", false},
+		{"apps/", "apps/web/main.go", true},
+		{"apps/", "src/apps/main.go", true},
+		{"apps/", "apps", false},
+		{"/scripts", "scripts/deploy.sh", true},
+		{"/scripts", "tools/scripts/deploy.sh", false},
+		{"**/logs", "deep/in/logs/today.log", true},
+		{"Makefile", "sub/Makefile", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.file); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestOwners(t *testing.T) {
+	f := Parse([]byte(`# Default owners
+*       @acme/everyone
+
+[Backend]
+/api/   @alice @acme/backend   # team and lead
+*.proto @bob
+/api/internal/
+docs/\#notes.md carol@example.com
+`))
+
+	tests := []struct {
+		files []string
+		want  []string
+	}{
+		{[]string{"README.md"}, []string{"@acme/everyone"}},
+		{[]string{"api/user.go"}, []string{"@alice", "@acme/backend"}},
+		{[]string{"api/user.proto", "api/user.go", "web/x.proto"}, []string{"@bob", "@alice", "@acme/backend"}},
+		// A rule without owners leaves its files unowned
+		{[]string{"api/internal/db.go"}, nil},
+		{[]string{"docs/#notes.md"}, []string{"carol@example.com"}},
+	}
+	for _, tt := range tests {
+		if got := f.OwnersOf(tt.files); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("OwnersOf(%v) = %v, want %v", tt.files, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"autoassigner/aws"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AWSSecretsConfig defines how awssm: references are read from AWS Secrets
+// Manager. Credentials are taken from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type AWSSecretsConfig struct {
+	Region   string `json:"region"`   // Region of the secrets; AWS_REGION when empty, or the region of an ARN
+	Endpoint string `json:"endpoint"` // URL of the Secrets Manager API, e.g. of a VPC endpoint (default https://secretsmanager.<region>.amazonaws.com)
+}
+
+// awsSecrets resolves awssm:<secret-id>#<key> to a secret of AWS Secrets
+// Manager, given by name or ARN. With a key the secret must be a JSON
+// object and the field is returned, otherwise the whole secret string.
+type awsSecrets struct{}
+
+func (awsSecrets) Resolve(ctx context.Context, ref string) (string, error) {
+	id, key, _ := strings.Cut(ref, "#")
+	conf := secretsConfig(ctx).AWS
+	region := aws.Region(conf.Region)
+	// ARNs name their region: arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" && conf.Region == "" {
+		region = parts[3]
+	}
+	if region == "" {
+		return "", fmt.Errorf("no aws region configured")
+	}
+	creds, err := aws.CredentialsFromEnv()
+	if err != nil {
+		return "", err
+	}
+	endpoint := firstNonEmpty(conf.Endpoint, "https://secretsmanager."+region+".amazonaws.com")
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid aws endpoint: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	aws.SignRequest(req, body, creds, region, "secretsmanager", time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("secrets manager responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to parse secrets manager response: %w", err)
+	}
+	if key == "" {
+		return secret.SecretString, nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(secret.SecretString), &data); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, so #%s can't be selected", key)
+	}
+	return secretField(data, key)
+}
@@ -2,67 +2,590 @@
 // It handles loading and parsing of configuration files, including:
 // - Storage configuration (data directory and config directory)
 // - Availability configuration (API endpoints and status settings)
+// - Secret references (env:, file:, vault: and awssm:) resolved on load
 package config
 
 import (
+	"autoassigner/history"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 )
 
 // StorageConfig defines the storage-related configuration settings.
 type StorageConfig struct {
-	DataDir string `json:"data_dir"` // Base directory for all data files
-	ConfDir string `json:"conf_dir"` // Directory for group configuration files
+	DataDir  string         `json:"data_dir" jsonschema:"required"` // Base directory for all data files
+	ConfDir  DirList        `json:"conf_dir" jsonschema:"required"` // Directory for group configuration files, or several in order of precedence
+	Git      GitConfig      `json:"git"`                            // Keep the data directory under git
+	Consul   ConsulConfig   `json:"consul"`                         // Share rotation state through Consul
+	DynamoDB DynamoDBConfig `json:"dynamodb"`                       // Share rotation state through DynamoDB
+	S3       S3Config       `json:"s3"`                             // Mirror the data directory to an S3 bucket
+	Lock     LockConfig     `json:"lock"`                           // Serialize assignments across hosts
+}
+
+// DirList is a list of directories, written in JSON as a list or as a
+// single directory.
+type DirList []string
+
+func (d *DirList) UnmarshalJSON(data []byte) error {
+	var dir string
+	if err := json.Unmarshal(data, &dir); err == nil {
+		*d = DirList{dir}
+		if dir == "" {
+			*d = nil
+		}
+		return nil
+	}
+	var dirs []string
+	if err := json.Unmarshal(data, &dirs); err != nil {
+		return fmt.Errorf("expected a directory or a list of directories: %w", err)
+	}
+	*d = dirs
+	return nil
+}
+
+// MarshalJSON writes a single directory as a string.
+func (d DirList) MarshalJSON() ([]byte, error) {
+	if len(d) == 1 {
+		return json.Marshal(d[0])
+	}
+	return json.Marshal([]string(d))
+}
+
+// JSONSchema describes a directory or a list of directories.
+func (DirList) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{"oneOf": []interface{}{
+		map[string]interface{}{"type": "string"},
+		map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+	}}
+}
+
+// LockConfig controls a distributed lock held around every assignment of a
+// group, for hosts sharing a data directory on NFS or similar storage.
+type LockConfig struct {
+	Backend     string `json:"backend" jsonschema:"enum=redis"` // Lock service to use; empty disables locking
+	Address     string `json:"address"`                         // Address of the lock service, e.g. localhost:6379
+	Password    string `json:"password"`                        // Password for the lock service
+	Prefix      string `json:"prefix"`                          // Key prefix for the locks, "autoassigner" by default
+	TTLSeconds  int    `json:"ttl_seconds"`                     // Time after which a lock held by a crashed host expires (default 30)
+	WaitSeconds int    `json:"wait_seconds"`                    // How long to wait for a lock held by another host (default 10)
+}
+
+// Supported values for LockConfig.Backend.
+const (
+	LockRedis = "redis"
+)
+
+// ConsulConfig controls storing the rotation state of groups in the Consul KV
+// store, so that several hosts or replicas can assign from the same state.
+type ConsulConfig struct {
+	Address string `json:"address"` // URL of the Consul HTTP API, e.g. http://127.0.0.1:8500; empty disables Consul
+	Token   string `json:"token"`   // ACL token sent with every request
+	Prefix  string `json:"prefix"`  // Key prefix for all groups, "autoassigner" by default
+}
+
+// DynamoDBConfig controls storing the rotation state of groups in a DynamoDB
+// table, so that several hosts, replicas or Lambda instances can assign from
+// the same state. Credentials are taken from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type DynamoDBConfig struct {
+	Table    string `json:"table"`    // Table with the string partition key "pk" and sort key "sk"; empty disables DynamoDB
+	Prefix   string `json:"prefix"`   // Prefix of the partition keys, "autoassigner" by default, so the table can be shared
+	Region   string `json:"region"`   // Region of the table; AWS_REGION when empty
+	Endpoint string `json:"endpoint"` // URL of a DynamoDB-compatible API such as DynamoDB Local (default https://dynamodb.<region>.amazonaws.com)
+}
+
+// S3Config controls mirroring the data directory to an S3 bucket, so hosts
+// without a durable disk, such as AWS Lambda functions, keep their state
+// there. Credentials are taken from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3Config struct {
+	Bucket   string `json:"bucket"`   // Bucket the data directory is mirrored to; empty disables the mirror
+	Prefix   string `json:"prefix"`   // Key prefix of the mirrored files, "autoassigner" by default
+	Region   string `json:"region"`   // Region of the bucket; AWS_REGION when empty
+	Endpoint string `json:"endpoint"` // URL of an S3-compatible API such as MinIO, addressed path-style (default https://<bucket>.s3.<region>.amazonaws.com)
+}
+
+// GitConfig controls recording every state change as a commit in a git
+// repository at the data directory, which is initialized when missing.
+type GitConfig struct {
+	Enabled     bool   `json:"enabled"`      // Commit the data directory after every state change
+	Push        bool   `json:"push"`         // Push each commit to Remote
+	Remote      string `json:"remote"`       // Remote to push to, "origin" by default
+	AuthorEmail string `json:"author_email"` // Email of the commit author; the author name is the actor
 }
 
 // AvailabilityConfig defines the availability-related configuration settings.
 type AvailabilityConfig struct {
-	InOutApiUrlPrefix        string   `json:"inout_api_url_prefix"`       // Base URL for the In/Out API
-	InOutUnavailableStatuses []string `json:"inout_unavailable_statuses"` // List of statuses indicating unavailability
+	InOutApiUrlPrefix        string             `json:"inout_api_url_prefix" jsonschema:"required"`            // Base URL for the In/Out API
+	InOutUnavailableStatuses []string           `json:"inout_unavailable_statuses" jsonschema:"required"`      // List of statuses indicating unavailability
+	InOutAuth                InOutAuthConfig    `json:"inout_auth"`                                            // Authentication settings for the In/Out API
+	InOutStatusField         string             `json:"inout_status_field"`                                    // Dot-separated path to the status field (default "inOutLocation")
+	InOutMatchMode           string             `json:"inout_match_mode" jsonschema:"enum=exact|prefix|regex"` // How statuses are compared: exact (default), prefix or regex
+	InOutMatchIgnoreCase     bool               `json:"inout_match_ignore_case"`                               // Compare statuses case-insensitively
+	InOutBatchApiUrl         string             `json:"inout_batch_api_url"`                                   // Optional endpoint returning statuses for many users at once
+	InOutBatchSize           int                `json:"inout_batch_size"`                                      // Most users sent in one batch request (default no limit)
+	HR                       HRConfig           `json:"hr"`                                                    // Settings for the HR time-off checkers
+	Cache                    CheckerCacheConfig `json:"cache"`                                                 // How long results of the availability checkers are reused
+}
+
+// CheckerCacheConfig defines how long the results of availability checkers
+// are reused by a process, such as the server, before asking again.
+type CheckerCacheConfig struct {
+	TTLSeconds int            `json:"ttl_seconds"` // Seconds the results of every checker are reused (default 0, not cached)
+	Checkers   map[string]int `json:"checkers"`    // Seconds per checker name, overriding ttl_seconds; 0 disables caching for the checker
+}
+
+// HRConfig defines the settings for the BambooHR and Workday time-off checkers.
+type HRConfig struct {
+	BambooHRApiUrl   string            `json:"bamboohr_api_url"`   // Base URL of the BambooHR API (default https://api.bamboohr.com/api/gateway.php)
+	BambooHRCompany  string            `json:"bamboohr_company"`   // BambooHR company subdomain
+	BambooHRApiKey   string            `json:"bamboohr_api_key"`   // BambooHR API key
+	WorkdayReportUrl string            `json:"workday_report_url"` // URL of a Workday RaaS report listing approved time off
+	WorkdayUsername  string            `json:"workday_username"`   // Username for the Workday report
+	WorkdayPassword  string            `json:"workday_password"`   // Password for the Workday report
+	UserMapping      map[string]string `json:"user_mapping"`       // Maps usernames to HR identifiers (BambooHR employee ID or Workday email)
+	CacheTTLSeconds  int               `json:"cache_ttl_seconds"`  // How long fetched time-off data is reused (default 300)
+}
+
+// Supported values for AvailabilityConfig.InOutMatchMode.
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchRegex  = "regex"
+)
+
+// InOutAuthConfig defines how requests to the In/Out API are authenticated.
+// All fields are optional; an empty config results in anonymous requests.
+type InOutAuthConfig struct {
+	BearerToken string            `json:"bearer_token"` // Static token sent as "Authorization: Bearer <token>"
+	Username    string            `json:"username"`     // Username for HTTP basic auth
+	Password    string            `json:"password"`     // Password for HTTP basic auth
+	Headers     map[string]string `json:"headers"`      // Additional headers sent with every request
+	ClientCert  string            `json:"client_cert"`  // Path to a PEM client certificate for mTLS
+	ClientKey   string            `json:"client_key"`   // Path to the PEM private key for the client certificate
+	CACert      string            `json:"ca_cert"`      // Path to a PEM CA bundle used to verify the server
+}
+
+// IdentityConfig maps usernames to the identifiers the same people have in
+// other systems, such as their email address, Slack ID or GitHub login.
+type IdentityConfig struct {
+	Users       map[string]map[string]string `json:"users"`        // Identifiers of each user keyed by kind, e.g. {"alice": {"email": "alice@example.com"}}
+	LookupURL   string                       `json:"lookup_url"`   // Service queried for identities not listed in users
+	LookupToken string                       `json:"lookup_token"` // Bearer token sent to the lookup service
+}
+
+// RouteConfig chooses the group that assigns a pull request or issue
+// received from a VCS integration. Routes are tried in order and the
+// first one matching the change is used; a route matches when all the
+// conditions it sets hold.
+type RouteConfig struct {
+	Repo   string   `json:"repo"`                        // Repository full name, or a pattern such as acme/*
+	Labels []string `json:"labels"`                      // Labels of which the change must carry at least one
+	Paths  []string `json:"paths"`                       // Patterns such as api/** of which a changed file must match at least one
+	Title  string   `json:"title"`                       // Regular expression the title must match
+	Group  string   `json:"group" jsonschema:"required"` // Group assigning matching changes
+}
+
+// GitHubConfig defines how the GitHub integration talks to the GitHub API.
+type GitHubConfig struct {
+	ApiUrl string `json:"api_url"` // Base URL of the GitHub API (default https://api.github.com)
+	Token  string `json:"token"`   // Token used for API requests; GITHUB_TOKEN is used when empty
+}
+
+// BitbucketConfig defines how the Bitbucket integration talks to Bitbucket
+// Cloud or to a Bitbucket Data Center server.
+type BitbucketConfig struct {
+	Edition       string `json:"edition" jsonschema:"enum=cloud|datacenter"` // Bitbucket edition: cloud (default) or datacenter
+	ApiUrl        string `json:"api_url"`                                    // Base URL of the API (default https://api.bitbucket.org/2.0); the server URL for datacenter
+	Username      string `json:"username"`                                   // Username for basic auth, with an app password on cloud
+	Password      string `json:"password"`                                   // App password (cloud) or password (datacenter) for basic auth
+	Token         string `json:"token"`                                      // Access token sent as a bearer token instead of basic auth
+	WebhookSecret string `json:"webhook_secret"`                             // Secret webhook payloads are signed with; unsigned payloads are accepted when empty
+}
+
+// Supported values for BitbucketConfig.Edition.
+const (
+	BitbucketCloud      = "cloud"
+	BitbucketDataCenter = "datacenter"
+)
+
+// GerritConfig defines how the Gerrit integration talks to a Gerrit server.
+type GerritConfig struct {
+	Url       string `json:"url"`        // Base URL of the Gerrit server, e.g. https://review.example.com
+	Username  string `json:"username"`   // Username for the REST API
+	Password  string `json:"password"`   // HTTP password of the user, as generated in the Gerrit settings
+	PollQuery string `json:"poll_query"` // Query selecting the changes polled for assignment (default "status:open -is:wip")
+}
+
+// ServiceNowConfig defines how the ServiceNow integration reads incidents
+// and writes assignments through the Table API.
+type ServiceNowConfig struct {
+	InstanceUrl     string            `json:"instance_url"`      // URL of the instance, e.g. https://acme.service-now.com
+	Username        string            `json:"username"`          // Username for basic auth
+	Password        string            `json:"password"`          // Password for basic auth
+	Token           string            `json:"token"`             // OAuth access token sent as a bearer token instead of basic auth
+	WebhookToken    string            `json:"webhook_token"`     // Bearer token the instance sends with webhooks; unauthenticated webhooks are accepted when empty
+	Table           string            `json:"table"`             // Table of the records to assign (default "incident")
+	GroupField      string            `json:"group_field"`       // Field selecting the autoassigner group (default "assignment_group")
+	AssignedToField string            `json:"assigned_to_field"` // Field receiving the assignee (default "assigned_to")
+	TitleField      string            `json:"title_field"`       // Field shown as the record's title (default "short_description")
+	SetFields       map[string]string `json:"set_fields"`        // Further fields written with every assignment, e.g. {"state": "2"}
+	Groups          map[string]string `json:"groups"`            // Groups keyed by the sys_id or display value of the group field
+	PollQuery       string            `json:"poll_query"`        // Encoded query selecting the records polled for assignment (default "active=true^<assigned_to_field>ISEMPTY")
+}
+
+// ZendeskConfig defines how the Zendesk integration authenticates webhooks
+// and calls the Zendesk API.
+type ZendeskConfig struct {
+	Url               string            `json:"url"`                // URL of the account, e.g. https://acme.zendesk.com
+	Email             string            `json:"email"`              // Email of the agent the API token belongs to
+	ApiToken          string            `json:"api_token"`          // API token, used with email for basic auth
+	Token             string            `json:"token"`              // OAuth access token sent as a bearer token instead
+	WebhookSecret     string            `json:"webhook_secret"`     // Signing secret of the webhook; unsigned webhooks are accepted when empty
+	Groups            map[string]string `json:"groups"`             // Groups keyed by the ID or name of the ticket's Zendesk group
+	AvailableStatuses []string          `json:"available_statuses"` // Agent statuses counted as available by the zendesk checker (default ["online"])
+}
+
+// LinearConfig defines how the Linear integration calls the GraphQL API.
+type LinearConfig struct {
+	ApiUrl        string            `json:"api_url"`        // URL of the GraphQL API (default https://api.linear.app/graphql)
+	ApiKey        string            `json:"api_key"`        // Personal API key
+	Token         string            `json:"token"`          // OAuth access token sent as a bearer token instead of the API key
+	WebhookSecret string            `json:"webhook_secret"` // Signing secret of the webhook; unsigned webhooks are accepted when empty
+	Teams         map[string]string `json:"teams"`          // Groups keyed by the key or ID of the issue's team, e.g. {"ENG": "engineers"}
+}
+
+// AsanaConfig defines how the Asana integration calls the REST API.
+type AsanaConfig struct {
+	ApiUrl        string            `json:"api_url"`        // URL of the API (default https://app.asana.com/api/1.0)
+	Token         string            `json:"token"`          // Personal access token or OAuth access token
+	WebhookSecret string            `json:"webhook_secret"` // Secret of the webhook handshake; the secret of the last handshake is used when empty
+	Projects      map[string]string `json:"projects"`       // Groups keyed by the gid of a project the task is in
+}
+
+// JiraConfig defines how the workload of users is read from Jira for the
+// open_load strategy.
+type JiraConfig struct {
+	Url         string `json:"url"`          // URL of the Jira site, e.g. https://acme.atlassian.net
+	Email       string `json:"email"`        // Email (Jira Cloud) or username (Jira Data Center) the API token belongs to
+	ApiToken    string `json:"api_token"`    // API token, used with email for basic auth
+	Token       string `json:"token"`        // Personal access token or OAuth access token sent as a bearer token instead
+	WorkloadJQL string `json:"workload_jql"` // Query counting the issues of a user, {user} replaced by the user (default "assignee = {user} AND statusCategory != Done")
+}
+
+// SlackConfig defines how the Slack bot connects to Slack in socket mode.
+type SlackConfig struct {
+	ApiUrl   string `json:"api_url"`   // URL of the Web API (default https://slack.com/api)
+	AppToken string `json:"app_token"` // App-level token with the connections:write scope (xapp-...); the bot runs when set
+	BotToken string `json:"bot_token"` // Bot token posting the replies (xoxb-...)
 }
 
 // Config represents the complete configuration for the autoassigner.
 type Config struct {
-	Storage      StorageConfig      `json:"storage"`      // Storage-related settings
-	Availability AvailabilityConfig `json:"availability"` // Availability-related settings
+	Storage      StorageConfig      `json:"storage" jsonschema:"required"`      // Storage-related settings
+	Availability AvailabilityConfig `json:"availability" jsonschema:"required"` // Availability-related settings
+	Identity     IdentityConfig     `json:"identity"`                           // Identifiers of users in other systems
+	Routes       []RouteConfig      `json:"routes"`                             // Groups for pull requests and issues from VCS integrations
+	GitHub       GitHubConfig       `json:"github"`                             // Settings for the GitHub integration
+	Bitbucket    BitbucketConfig    `json:"bitbucket"`                          // Settings for the Bitbucket integration
+	Gerrit       GerritConfig       `json:"gerrit"`                             // Settings for the Gerrit integration
+	ServiceNow   ServiceNowConfig   `json:"servicenow"`                         // Settings for the ServiceNow integration
+	Zendesk      ZendeskConfig      `json:"zendesk"`                            // Settings for the Zendesk integration
+	Linear       LinearConfig       `json:"linear"`                             // Settings for the Linear integration
+	Asana        AsanaConfig        `json:"asana"`                              // Settings for the Asana integration
+	Jira         JiraConfig         `json:"jira"`                               // Settings for reading workloads from Jira
+	Slack        SlackConfig        `json:"slack"`                              // Settings for the Slack bot of "autoassigner serve"
+	Secrets      SecretsConfig      `json:"secrets"`                            // Providers of secret references such as vault:secret/data/app#token
+	Server       ServerConfig       `json:"server"`                             // Settings for the API served by "autoassigner serve"
+	Digest       DigestConfig       `json:"digest"`                             // Weekly digest of the groups sent by "autoassigner serve"
+	Reminders    RemindersConfig    `json:"reminders"`                          // Reminders of the upcoming turns of group rotations sent by "autoassigner serve"
+	Escalations  EscalationsConfig  `json:"escalations"`                        // Notifications of the escalation steps of unacknowledged assignments taken by "autoassigner serve"
+	Maintenance  MaintenanceConfig  `json:"maintenance"`                        // Retention of the assignment history, enforced daily by "autoassigner serve"
+}
+
+// MaintenanceConfig sets how long the records of the group logs are kept.
+// "autoassigner serve" prunes the records older than that once a day;
+// "autoassigner maintain" prunes them on demand, e.g. from cron.
+type MaintenanceConfig struct {
+	HistoryRetention string `json:"history_retention"` // Age after which log records are pruned, e.g. 365d; groups may set their own, and records are kept forever when empty
+	Archive          bool   `json:"archive"`           // Move pruned records to <data_dir>/.archive/history/ instead of deleting them
+}
+
+// RemindersConfig sends the members of the rotations of groups a reminder
+// remind_hours before their turn starts. "autoassigner serve" checks for
+// due reminders every minute; "autoassigner rotation --remind" sends them
+// on demand, e.g. from cron.
+type RemindersConfig struct {
+	Notifiers []NotifierConfig `json:"notifiers"` // Where reminders are sent; the server sends none without notifiers
+}
+
+// EscalationsConfig sends the steps of the escalation chains of groups,
+// taken when open assignments aren't acknowledged in time, such as
+// "escalating to dave". "autoassigner serve" takes the due steps every
+// minute; "autoassigner escalate" takes them on demand, e.g. from cron.
+type EscalationsConfig struct {
+	Notifiers []NotifierConfig `json:"notifiers"` // Where escalations are sent; without notifiers they are only logged
+}
+
+// DigestConfig schedules the weekly digest summarizing the assignments,
+// skips and fairness of the groups over the past week. "autoassigner
+// serve" sends it to the notifiers at the given day and time;
+// "autoassigner digest" renders it on demand, e.g. from cron.
+type DigestConfig struct {
+	Day       string           `json:"day" jsonschema:"enum=monday|tuesday|wednesday|thursday|friday|saturday|sunday"` // Weekday the digest is sent (default monday)
+	Time      string           `json:"time"`                                                                           // Time of day it is sent as HH:MM (default 09:00)
+	Timezone  string           `json:"timezone"`                                                                       // IANA time zone of day and time, local time by default
+	Groups    []string         `json:"groups"`                                                                         // Groups summarized, which may be patterns such as team-*; every group when empty
+	Template  string           `json:"template"`                                                                       // File with a Go text/template of the message; a built-in summary when empty
+	Notifiers []NotifierConfig `json:"notifiers"`                                                                      // Where the digest is sent; the server sends none without notifiers
+}
+
+// NotifierConfig defines where a message, such as the weekly digest, is sent.
+type NotifierConfig struct {
+	Type    string            `json:"type" jsonschema:"enum=slack|http|command"` // slack, http or command
+	Channel string            `json:"channel"`                                   // Channel the slack notifier posts to as the bot of slack.bot_token
+	URL     string            `json:"url"`                                       // URL the http notifier posts {"text": "<message>"} to, e.g. an incoming webhook
+	Headers map[string]string `json:"headers"`                                   // Headers of the http notifier's requests, e.g. {"Authorization": "env:DIGEST_AUTH"}
+	Command []string          `json:"command"`                                   // Executable and arguments the command notifier runs with the message on stdin, e.g. a mail script
+}
+
+// Supported values for NotifierConfig.Type.
+const (
+	NotifySlack   = "slack"
+	NotifyHTTP    = "http"
+	NotifyCommand = "command"
+)
+
+// ServerConfig defines how "autoassigner serve" serves its API.
+type ServerConfig struct {
+	TLSCert   string            `json:"tls_cert"`                                       // PEM certificate to serve HTTPS with; plain HTTP when empty
+	TLSKey    string            `json:"tls_key"`                                        // PEM private key of the certificate
+	ClientCA  string            `json:"client_ca"`                                      // PEM CA bundle verifying client certificates, as required by the mtls method
+	Auth      AuthConfig        `json:"auth"`                                           // Who may call the API
+	AccessLog string            `json:"access_log" jsonschema:"enum=stderr|stdout|off"` // Where the JSON access log of every request is written: stderr (default), stdout or off
+	Audit     []AuditSinkConfig `json:"audit"`                                          // Sinks recording every request for auditing, in addition to the access log
+	Consumer  ConsumerConfig    `json:"consumer"`                                       // Message broker subject assignment requests are consumed from, in addition to the webhooks
+	Replicas  ReplicasConfig    `json:"replicas"`                                       // Coordination of several replicas of the server, e.g. behind a Kubernetes Service
+	UI        UIConfig          `json:"ui"`                                             // Self-service web UI where people log in to pause themselves and see their stats
+
+	FlushQueueSeconds int `json:"flush_queue_seconds"` // How often the server flushes the deferral queue; 0 leaves it to "autoassigner queue flush"
+}
+
+// ReplicasConfig lets several replicas of "autoassigner serve" share the
+// same groups. Every assignment takes the lock of its group from
+// storage.lock, and the replicas elect a leader with a lease in the same
+// Redis, which alone does the work that must not run twice, such as
+// flushing the deferral queue.
+type ReplicasConfig struct {
+	Enabled      bool `json:"enabled"`       // Whether several replicas serve the same groups
+	LeaseSeconds int  `json:"lease_seconds"` // Time after which the leadership of a crashed replica expires (default 15)
+}
+
+// Supported values for ServerConfig.AccessLog.
+const (
+	AccessLogStderr = "stderr"
+	AccessLogStdout = "stdout"
+	AccessLogOff    = "off"
+)
+
+// AuditSinkConfig defines a sink receiving the access log entries of the API.
+type AuditSinkConfig struct {
+	Type    string            `json:"type" jsonschema:"enum=file|syslog|http"`         // file, syslog or http
+	Path    string            `json:"path"`                                            // File the file sink appends JSON lines to
+	Network string            `json:"network" jsonschema:"enum=udp|tcp|unix|unixgram"` // Network of the syslog server (default udp)
+	Address string            `json:"address"`                                         // Address of the syslog server, e.g. syslog.example.com:514; the local syslog daemon when empty
+	Tag     string            `json:"tag"`                                             // App name of syslog messages (default autoassigner)
+	URL     string            `json:"url"`                                             // URL the http sink posts every entry to as JSON
+	Headers map[string]string `json:"headers"`                                         // Headers of the http sink's requests, e.g. {"Authorization": "env:AUDIT_AUTH"}
+}
+
+// Supported values for AuditSinkConfig.Type.
+const (
+	AuditFile   = "file"
+	AuditSyslog = "syslog"
+	AuditHTTP   = "http"
+)
+
+// ConsumerConfig defines the Kafka topic or NATS subject "autoassigner
+// serve" consumes assignment requests from.
+type ConsumerConfig struct {
+	Type         string            `json:"type" jsonschema:"enum=kafka|nats"` // kafka (through a Kafka REST Proxy) or nats; no consumer when empty
+	URL          string            `json:"url"`                               // nats://host:4222 (tls:// for TLS, user:password@ to log in) or the base URL of the REST Proxy
+	Subject      string            `json:"subject"`                           // NATS subject or Kafka topic of the requests
+	ReplySubject string            `json:"reply_subject"`                     // NATS subject or Kafka topic results are published to; NATS requests with a reply subject of their own are answered there
+	Group        string            `json:"group"`                             // NATS queue group or Kafka consumer group shared by the replicas of the server (default autoassigner)
+	Token        string            `json:"token"`                             // Auth token of the NATS server, e.g. "env:NATS_TOKEN"
+	Headers      map[string]string `json:"headers"`                           // Headers of requests to the REST Proxy, e.g. {"Authorization": "env:KAFKA_REST_AUTH"}
+}
+
+// Supported values for ConsumerConfig.Type.
+const (
+	ConsumerKafka = "kafka"
+	ConsumerNATS  = "nats"
+)
+
+// AuthConfig defines how callers of the API are identified and which
+// routes and groups they may use.
+type AuthConfig struct {
+	Method   string            `json:"method" jsonschema:"enum=none|token|oidc|mtls"` // How callers are identified: none (default, everyone is anonymous), token, oidc or mtls
+	Tokens   map[string]string `json:"tokens"`                                        // Bearer tokens of the token method keyed by the name of their principal, e.g. {"ci": "env:CI_API_TOKEN"}
+	OIDC     OIDCConfig        `json:"oidc"`                                          // Settings of the oidc method
+	Policies []PolicyConfig    `json:"policies"`                                      // Rules allowing requests; any identified caller may use every route and group when empty
+}
+
+// Supported values for AuthConfig.Method.
+const (
+	AuthNone  = "none"
+	AuthToken = "token"
+	AuthOIDC  = "oidc"
+	AuthMTLS  = "mtls"
+)
+
+// OIDCConfig defines how the bearer tokens of the oidc method, ID or access
+// tokens issued by an OpenID Connect provider, are verified.
+type OIDCConfig struct {
+	Issuer   string `json:"issuer"`   // Issuer URL the tokens must name, e.g. https://login.example.com
+	Audience string `json:"audience"` // Audience the tokens must be issued for, e.g. the client ID
+	JWKSURL  string `json:"jwks_url"` // URL of the signing keys (default from the issuer's discovery document)
+	Claim    string `json:"claim"`    // Claim naming the principal, e.g. email (default sub)
+}
+
+// UIConfig enables the self-service web UI at /ui, where people log in
+// with the OpenID Connect provider of auth.oidc to pause and resume
+// themselves, schedule vacations and see their own stats.
+type UIConfig struct {
+	ClientID      string `json:"client_id"`      // Client ID registered with the provider; the UI is disabled when empty
+	ClientSecret  string `json:"client_secret"`  // Client secret registered with the provider, e.g. "env:UI_CLIENT_SECRET"
+	RedirectURL   string `json:"redirect_url"`   // Address of /ui/callback as registered with the provider, e.g. https://autoassigner.example.com/ui/callback
+	SessionSecret string `json:"session_secret"` // Key signing the session cookies, at least 32 characters, e.g. "env:UI_SESSION_SECRET"
+	SessionHours  int    `json:"session_hours"`  // Hours a login lasts (default 12)
+	IdentityKind  string `json:"identity_kind"`  // Kind of identifier the claim of auth.oidc holds, mapped to a username by the identity config, e.g. email (default username)
+}
+
+// PolicyConfig allows requests matching all of its conditions. A request is
+// allowed when a policy matches it.
+type PolicyConfig struct {
+	Routes     []string `json:"routes"`     // Path patterns such as /state or /*; every route when empty
+	Groups     []string `json:"groups"`     // Group patterns such as team-*; every group when empty
+	Principals []string `json:"principals"` // Names of callers; every identified caller when empty, and "anonymous" for requests without credentials
 }
 
 // Settings holds the global configuration settings.
 var Settings Config
 
-// GetGroupDataDir returns the data directory for a specific group.
+// GetGroupDataDir returns the data directory for a specific group, nested
+// like its config file for groups in subdirectories.
 // It creates the directory if it doesn't exist.
 func GetGroupDataDir(group string) (string, error) {
-	dir := filepath.Join(Settings.Storage.DataDir, group)
+	dir := filepath.Join(Settings.Storage.DataDir, filepath.FromSlash(group))
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", err
 	}
 	return dir, nil
 }
 
-// ListGroups returns a list of all valid group names from the config directory.
-// A valid group is one that has a .yaml configuration file.
-func ListGroups() ([]string, error) {
-	entries, err := os.ReadDir(Settings.Storage.ConfDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config directory: %w", err)
+// GroupConfigPath returns the config file of a group: the group's .yaml file
+// in the first of the config directories that has one. It reports false
+// when none has, with the path the file is created at in the first directory.
+// Groups in subdirectories are named by their path, e.g. platform/oncall.
+func GroupConfigPath(group string) (string, bool) {
+	name := filepath.FromSlash(group) + ".yaml"
+	for _, dir := range Settings.Storage.ConfDir {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, true
+		}
+	}
+	if len(Settings.Storage.ConfDir) == 0 {
+		return name, false
 	}
+	return filepath.Join(Settings.Storage.ConfDir[0], name), false
+}
+
+// ListGroups returns a list of all valid group names from the config directories.
+// A valid group is one that has a .yaml configuration file. Files in
+// subdirectories are groups named by their path, such as platform/oncall for
+// platform/oncall.yaml; hidden directories are skipped. Groups defined in
+// several directories are listed once.
+func ListGroups() ([]string, error) {
+	return ListGroupsIn(Settings.Storage.ConfDir)
+}
 
+// ListGroupsIn returns the groups defined in dirs like ListGroups does for
+// the config directories, e.g. for a proposed copy of them.
+func ListGroupsIn(dirs []string) ([]string, error) {
 	var groups []string
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".yaml") {
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if path != dir && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(entry.Name(), ".yaml") {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
 			// Remove .yaml extension to get group name
-			groupName := strings.TrimSuffix(entry.Name(), ".yaml")
-			groups = append(groups, groupName)
+			groupName := strings.TrimSuffix(filepath.ToSlash(rel), ".yaml")
+			if !seen[groupName] {
+				seen[groupName] = true
+				groups = append(groups, groupName)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config directory: %w", err)
 		}
 	}
+	sort.Strings(groups)
 
 	return groups, nil
 }
 
+// IsGroupPattern reports whether name is a glob pattern rather than the name
+// of a group.
+func IsGroupPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// MatchGroups returns the groups whose name matches the glob pattern, such as
+// oncall-* or platform/*. Patterns have the syntax of path.Match, so * doesn't
+// match the / of groups in subdirectories.
+func MatchGroups(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid group pattern %q: %w", pattern, err)
+	}
+	groups, err := ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, group := range groups {
+		if ok, _ := path.Match(pattern, group); ok {
+			matched = append(matched, group)
+		}
+	}
+	return matched, nil
+}
+
 // LoadConfig loads the configuration from the specified config file.
 // It reads the file, parses the JSON content, and populates the Settings variable.
 // Returns an error if the file cannot be read or parsed.
@@ -94,10 +617,19 @@ func LoadConfig(configPath string) error {
 	defer file.Close()
 
 	// Parse JSON content
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&Settings); err != nil {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := json.Unmarshal(data, &Settings); err != nil {
 		return fmt.Errorf("failed to parse config file: %w", err)
 	}
+	loadedConfig = data
+
+	// Replace references such as env:GITHUB_TOKEN with the secrets they point to
+	if err := resolveSecrets(context.Background(), &Settings); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
+	}
 
 	// Validate required fields
 	if err := validateConfig(&Settings); err != nil {
@@ -112,14 +644,191 @@ func validateConfig(cfg *Config) error {
 	if cfg.Storage.DataDir == "" {
 		return fmt.Errorf("data_dir is required in storage configuration")
 	}
-	if cfg.Storage.ConfDir == "" {
+	if len(cfg.Storage.ConfDir) == 0 {
 		return fmt.Errorf("conf_dir is required in storage configuration")
 	}
+	for _, dir := range cfg.Storage.ConfDir {
+		if dir == "" {
+			return fmt.Errorf("conf_dir must not list an empty directory")
+		}
+	}
+	if cfg.Storage.Git.Push && !cfg.Storage.Git.Enabled {
+		return fmt.Errorf("git push requires git to be enabled in storage configuration")
+	}
+	if cfg.Storage.Consul.Address != "" && cfg.Storage.DynamoDB.Table != "" {
+		return fmt.Errorf("storage configuration cannot use both consul and dynamodb")
+	}
+	switch cfg.Storage.Lock.Backend {
+	case "":
+	case LockRedis:
+		if cfg.Storage.Lock.Address == "" {
+			return fmt.Errorf("address is required in lock configuration")
+		}
+	default:
+		return fmt.Errorf("unknown lock backend: %s", cfg.Storage.Lock.Backend)
+	}
+	for i, route := range cfg.Routes {
+		if route.Group == "" {
+			return fmt.Errorf("group is required in route %d", i+1)
+		}
+		if _, err := path.Match(route.Repo, ""); err != nil {
+			return fmt.Errorf("invalid repo pattern %q in route %d: %w", route.Repo, i+1, err)
+		}
+		for _, pattern := range route.Paths {
+			for _, elem := range strings.Split(pattern, "/") {
+				if _, err := path.Match(elem, ""); err != nil {
+					return fmt.Errorf("invalid paths pattern %q in route %d: %w", pattern, i+1, err)
+				}
+			}
+		}
+		if _, err := regexp.Compile(route.Title); err != nil {
+			return fmt.Errorf("invalid title pattern %q in route %d: %w", route.Title, i+1, err)
+		}
+	}
+	switch cfg.Bitbucket.Edition {
+	case "", BitbucketCloud:
+	case BitbucketDataCenter:
+		if cfg.Bitbucket.ApiUrl == "" {
+			return fmt.Errorf("api_url is required in bitbucket configuration for datacenter")
+		}
+	default:
+		return fmt.Errorf("unknown bitbucket edition: %s", cfg.Bitbucket.Edition)
+	}
+	if cfg.Bitbucket.Token != "" && cfg.Bitbucket.Username != "" {
+		return fmt.Errorf("bitbucket configuration cannot set both token and username")
+	}
 	if cfg.Availability.InOutApiUrlPrefix == "" {
 		return fmt.Errorf("inout_api_url_prefix is required in availability configuration")
 	}
 	if len(cfg.Availability.InOutUnavailableStatuses) == 0 {
 		return fmt.Errorf("inout_unavailable_statuses is required in availability configuration")
 	}
+	switch cfg.Availability.InOutMatchMode {
+	case "", MatchExact, MatchPrefix:
+	case MatchRegex:
+		for _, pattern := range cfg.Availability.InOutUnavailableStatuses {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid inout_unavailable_statuses pattern %q: %w", pattern, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown inout_match_mode: %s", cfg.Availability.InOutMatchMode)
+	}
+	switch cfg.Secrets.Vault.AuthMethod {
+	case "", VaultAuthToken, VaultAuthAppRole, VaultAuthKubernetes:
+	default:
+		return fmt.Errorf("unknown vault auth_method: %s", cfg.Secrets.Vault.AuthMethod)
+	}
+	if cfg.Secrets.RefreshSeconds < 0 {
+		return fmt.Errorf("secrets refresh_seconds must not be negative")
+	}
+	switch cfg.Server.Auth.Method {
+	case "", AuthNone, AuthToken:
+	case AuthOIDC:
+		if cfg.Server.Auth.OIDC.Issuer == "" {
+			return fmt.Errorf("issuer is required in server auth oidc configuration")
+		}
+	case AuthMTLS:
+		if cfg.Server.ClientCA == "" || cfg.Server.TLSCert == "" {
+			return fmt.Errorf("server auth method mtls requires tls_cert and client_ca")
+		}
+	default:
+		return fmt.Errorf("unknown server auth method: %s", cfg.Server.Auth.Method)
+	}
+	if ui := cfg.Server.UI; ui.ClientID != "" {
+		switch {
+		case cfg.Server.Auth.OIDC.Issuer == "":
+			return fmt.Errorf("server ui requires the issuer of server auth oidc")
+		case ui.RedirectURL == "":
+			return fmt.Errorf("redirect_url is required in server ui configuration")
+		case len(ui.SessionSecret) < 32:
+			return fmt.Errorf("session_secret of server ui must have at least 32 characters")
+		case ui.SessionHours < 0:
+			return fmt.Errorf("session_hours of server ui must not be negative")
+		}
+	}
+	switch cfg.Server.AccessLog {
+	case "", AccessLogStderr, AccessLogStdout, AccessLogOff:
+	default:
+		return fmt.Errorf("unknown server access_log: %s", cfg.Server.AccessLog)
+	}
+	for i, sink := range cfg.Server.Audit {
+		switch {
+		case sink.Type == AuditFile && sink.Path == "":
+			return fmt.Errorf("path is required for server audit sink %d", i+1)
+		case sink.Type == AuditHTTP && sink.URL == "":
+			return fmt.Errorf("url is required for server audit sink %d", i+1)
+		case sink.Type != AuditFile && sink.Type != AuditSyslog && sink.Type != AuditHTTP:
+			return fmt.Errorf("unknown type %q of server audit sink %d", sink.Type, i+1)
+		}
+	}
+	switch consumer := cfg.Server.Consumer; consumer.Type {
+	case "":
+	case ConsumerKafka, ConsumerNATS:
+		if consumer.URL == "" || consumer.Subject == "" {
+			return fmt.Errorf("server consumer requires url and subject")
+		}
+	default:
+		return fmt.Errorf("unknown server consumer type: %s", consumer.Type)
+	}
+	if cfg.Slack.AppToken != "" && cfg.Slack.BotToken == "" {
+		return fmt.Errorf("slack app_token requires bot_token")
+	}
+	if err := validateNotifiers(cfg, "digest", cfg.Digest.Notifiers); err != nil {
+		return err
+	}
+	if err := validateNotifiers(cfg, "reminder", cfg.Reminders.Notifiers); err != nil {
+		return err
+	}
+	if err := validateNotifiers(cfg, "escalation", cfg.Escalations.Notifiers); err != nil {
+		return err
+	}
+	if retention := cfg.Maintenance.HistoryRetention; retention != "" {
+		if _, err := history.ParseWindow(retention); err != nil {
+			return fmt.Errorf("invalid maintenance history_retention %q, want an age such as 365d", retention)
+		}
+	}
+	if (cfg.Server.TLSCert == "") != (cfg.Server.TLSKey == "") {
+		return fmt.Errorf("server configuration requires both tls_cert and tls_key")
+	}
+	if cfg.Server.Replicas.Enabled && cfg.Storage.Lock.Backend == "" {
+		return fmt.Errorf("server replicas require a lock backend in storage configuration")
+	}
+	if cfg.Server.Replicas.LeaseSeconds < 0 || cfg.Server.FlushQueueSeconds < 0 {
+		return fmt.Errorf("server lease_seconds and flush_queue_seconds must not be negative")
+	}
+	for i, policy := range cfg.Server.Auth.Policies {
+		for _, pattern := range append(append([]string{}, policy.Routes...), policy.Groups...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q in server auth policy %d: %w", pattern, i+1, err)
+			}
+		}
+	}
+	auth := cfg.Availability.InOutAuth
+	if auth.BearerToken != "" && auth.Username != "" {
+		return fmt.Errorf("inout_auth cannot set both bearer_token and username")
+	}
+	if (auth.ClientCert == "") != (auth.ClientKey == "") {
+		return fmt.Errorf("inout_auth requires both client_cert and client_key for mTLS")
+	}
+	return nil
+}
+
+// validateNotifiers checks the notifiers of a kind of message, such as the digest.
+func validateNotifiers(cfg *Config, kind string, notifiers []NotifierConfig) error {
+	for i, notifier := range notifiers {
+		switch {
+		case notifier.Type == NotifySlack && notifier.Channel == "":
+			return fmt.Errorf("channel is required for %s notifier %d", kind, i+1)
+		case notifier.Type == NotifySlack && cfg.Slack.BotToken == "":
+			return fmt.Errorf("%s notifier %d requires slack bot_token", kind, i+1)
+		case notifier.Type == NotifyHTTP && notifier.URL == "":
+			return fmt.Errorf("url is required for %s notifier %d", kind, i+1)
+		case notifier.Type == NotifyCommand && len(notifier.Command) == 0:
+			return fmt.Errorf("command is required for %s notifier %d", kind, i+1)
+		case notifier.Type != NotifySlack && notifier.Type != NotifyHTTP && notifier.Type != NotifyCommand:
+			return fmt.Errorf("unknown type %q of %s notifier %d", notifier.Type, kind, i+1)
+		}
+	}
 	return nil
 }
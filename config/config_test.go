@@ -0,0 +1,360 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_GITHUB_TOKEN", "gh-secret")
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	cfg := Config{
+		GitHub: GitHubConfig{ApiUrl: "https://api.github.com", Token: "env:TEST_GITHUB_TOKEN"},
+		Availability: AvailabilityConfig{
+			InOutAuth: InOutAuthConfig{BearerToken: "file:" + tokenFile, Headers: map[string]string{"X-Key": "env:TEST_GITHUB_TOKEN"}},
+		},
+		Identity: IdentityConfig{Users: map[string]map[string]string{"alice": {"slack": "U123"}}},
+	}
+	if err := resolveSecrets(context.Background(), &cfg); err != nil {
+		t.Fatalf("resolveSecrets() error = %v", err)
+	}
+	if cfg.GitHub.Token != "gh-secret" || cfg.GitHub.ApiUrl != "https://api.github.com" {
+		t.Errorf("github = %+v, want the token resolved and the URL unchanged", cfg.GitHub)
+	}
+	if auth := cfg.Availability.InOutAuth; auth.BearerToken != "file-secret" || auth.Headers["X-Key"] != "gh-secret" {
+		t.Errorf("inout_auth = %+v, want secrets from the file and environment", auth)
+	}
+	if cfg.Identity.Users["alice"]["slack"] != "U123" {
+		t.Errorf("identity = %v, want plain values unchanged", cfg.Identity.Users)
+	}
+
+	cfg = Config{Linear: LinearConfig{ApiKey: "env:TEST_MISSING_SECRET"}}
+	err := resolveSecrets(context.Background(), &cfg)
+	if err == nil || !strings.Contains(err.Error(), "linear.api_key") {
+		t.Errorf("resolveSecrets() with a missing variable error = %v, want it to name linear.api_key", err)
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/autoassigner":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"slack_token": "xoxb-1", "github_token": "ghp-1"},
+				"metadata": map[string]interface{}{"version": 3},
+			}})
+		case "/v1/kv/autoassigner":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"token": "kv1-token"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	saved := Settings
+	defer func() { Settings = saved }()
+	t.Setenv("TEST_VAULT_TOKEN", "vault-token")
+
+	cfg := Config{
+		Secrets: SecretsConfig{Vault: VaultConfig{Address: server.URL, Token: "env:TEST_VAULT_TOKEN"}},
+		GitHub:  GitHubConfig{Token: "vault:secret/data/autoassigner#github_token"},
+		Asana:   AsanaConfig{Token: "vault:kv/autoassigner"},
+	}
+	Settings = cfg
+	if err := resolveSecrets(context.Background(), &Settings); err != nil {
+		t.Fatalf("resolveSecrets() error = %v", err)
+	}
+	if Settings.GitHub.Token != "ghp-1" || Settings.Asana.Token != "kv1-token" {
+		t.Errorf("tokens = %q, %q, want ghp-1 from KV version 2 and kv1-token from version 1", Settings.GitHub.Token, Settings.Asana.Token)
+	}
+
+	for _, ref := range []string{"vault:secret/data/autoassigner", "vault:secret/data/autoassigner#missing", "vault:secret/data/other#token"} {
+		if _, err := ResolveSecret(context.Background(), ref); err == nil {
+			t.Errorf("ResolveSecret(%q) error = nil, want an error", ref)
+		}
+	}
+}
+
+func TestAWSSecrets(t *testing.T) {
+	var target, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, auth = r.Header.Get("X-Amz-Target"), r.Header.Get("Authorization")
+		var body struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&body)
+		switch body.SecretId {
+		case "prod/autoassigner":
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"pagerduty_token":"pd-1"}`})
+		case "plain":
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": "plain-secret"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	saved := Settings.Secrets
+	defer func() { Settings.Secrets = saved }()
+	Settings.Secrets.AWS = AWSSecretsConfig{Region: "eu-west-1", Endpoint: server.URL}
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"awssm:prod/autoassigner#pagerduty_token", "pd-1", false},
+		{"awssm:plain", "plain-secret", false},
+		{"awssm:plain#key", "", true},
+		{"awssm:missing", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveSecret(context.Background(), tt.ref)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ResolveSecret(%q) = %q, %v, want %q (error %v)", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if target != "secretsmanager.GetSecretValue" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request") {
+		t.Errorf("request target = %q, authorization = %q, want a signed GetSecretValue", target, auth)
+	}
+}
+
+func TestVaultAuth(t *testing.T) {
+	var logins, renewals int
+	var revoked string
+	secret := "xoxb-1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := func(token string) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": 60, "renewable": true}})
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			if body["role_id"] != "role" || body["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			logins++
+			auth(fmt.Sprintf("approle-%d", logins))
+		case "/v1/auth/k8s/login":
+			if body["role"] != "autoassigner" || body["jwt"] != "service-account-jwt" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			logins++
+			auth(fmt.Sprintf("k8s-%d", logins))
+		case "/v1/auth/token/renew-self":
+			renewals++
+			auth(r.Header.Get("X-Vault-Token"))
+		case "/v1/secret/data/autoassigner":
+			if token := r.Header.Get("X-Vault-Token"); token == "" || token == revoked {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"slack_token": secret},
+				"metadata": map[string]interface{}{"version": 1},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	saved := Settings.Secrets
+	defer func() { Settings.Secrets = saved }()
+	defer func() { timeNow = time.Now }()
+	now := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	Settings.Secrets.Vault = VaultConfig{Address: server.URL, AuthMethod: VaultAuthAppRole, RoleID: "role", SecretID: "secret"}
+	resolve := func(step string) {
+		t.Helper()
+		got, err := ResolveSecret(context.Background(), "vault:secret/data/autoassigner#slack_token")
+		if err != nil || got != secret {
+			t.Fatalf("%s: ResolveSecret() = %q, %v, want %q", step, got, err, secret)
+		}
+	}
+
+	// The token of the login is reused, renewed after two thirds of its TTL
+	// and replaced by a new login once it expired
+	steps := []struct {
+		step     string
+		after    time.Duration
+		logins   int
+		renewals int
+	}{
+		{"first read", 0, 1, 0},
+		{"second read", 10 * time.Second, 1, 0},
+		{"near expiry", 35 * time.Second, 1, 1},
+		{"after expiry", 2 * time.Minute, 2, 1},
+	}
+	for _, s := range steps {
+		now = now.Add(s.after)
+		resolve(s.step)
+		if logins != s.logins || renewals != s.renewals {
+			t.Errorf("%s: %d logins and %d renewals, want %d and %d", s.step, logins, renewals, s.logins, s.renewals)
+		}
+	}
+
+	// A revoked token is replaced by logging in again
+	revoked = "approle-2"
+	secret = "xoxb-2"
+	resolve("revoked token")
+	if logins != 3 {
+		t.Errorf("logins after revocation = %d, want 3", logins)
+	}
+
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwtPath, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+	Settings.Secrets.Vault = VaultConfig{Address: server.URL, AuthMethod: VaultAuthKubernetes, AuthMount: "k8s", Role: "autoassigner", JWTPath: jwtPath}
+	resolve("kubernetes")
+	if logins != 4 {
+		t.Errorf("logins after switching to kubernetes = %d, want 4", logins)
+	}
+}
+
+func TestRefreshSecrets(t *testing.T) {
+	saved := Settings
+	defer func() { Settings = saved }()
+	dir := t.TempDir()
+	t.Setenv("TEST_ASANA_TOKEN", "token-1")
+	configPath := filepath.Join(dir, "config.json")
+	configData := `{
+		"storage": {"data_dir": "data", "conf_dir": "etc"},
+		"availability": {"inout_api_url_prefix": "https://inout.example.com/", "inout_unavailable_statuses": ["OOO"]},
+		"asana": {"token": "env:TEST_ASANA_TOKEN"},
+		"secrets": {"refresh_seconds": 60}
+	}`
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	Settings = Config{}
+	if err := LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	t.Setenv("TEST_ASANA_TOKEN", "token-2")
+	refreshed, err := RefreshSecrets(context.Background())
+	if err != nil || refreshed.Asana.Token != "token-2" || refreshed.Secrets.RefreshSeconds != 60 {
+		t.Fatalf("RefreshSecrets() = %+v, %v, want the rotated token", refreshed, err)
+	}
+	if Settings.Asana.Token != "token-1" {
+		t.Errorf("Settings.Asana.Token = %q, want it unchanged until replaced", Settings.Asana.Token)
+	}
+}
+
+func TestConfDirs(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		want DirList
+	}{
+		{`"etc"`, DirList{"etc"}},
+		{`["team", "/etc/company"]`, DirList{"team", "/etc/company"}},
+		{`""`, nil},
+	} {
+		var got DirList
+		if err := json.Unmarshal([]byte(tt.data), &got); err != nil || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Unmarshal(%s) = %q, %v, want %q", tt.data, got, err, tt.want)
+		}
+	}
+	if err := json.Unmarshal([]byte(`3`), new(DirList)); err == nil {
+		t.Errorf("Unmarshal(3) succeeded, want an error")
+	}
+
+	dir := t.TempDir()
+	team, company := filepath.Join(dir, "team"), filepath.Join(dir, "company")
+	files := map[string]string{
+		filepath.Join(company, "oncall.yaml"):          "company",
+		filepath.Join(company, "support.yaml"):         "company",
+		filepath.Join(team, "oncall.yaml"):             "team",
+		filepath.Join(team, "backend.yaml"):            "team",
+		filepath.Join(team, "notes.txt"):               "",
+		filepath.Join(team, "platform", "oncall.yaml"): "team",
+		filepath.Join(team, ".git", "HEAD.yaml"):       "",
+		filepath.Join(company, "platform", "db.yaml"):  "company",
+	}
+	for path, data := range files {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	saved := Settings
+	defer func() { Settings = saved }()
+	Settings.Storage.ConfDir = DirList{team, company}
+
+	groups, err := ListGroups()
+	if err != nil || strings.Join(groups, ",") != "backend,oncall,platform/db,platform/oncall,support" {
+		t.Errorf("ListGroups() = %v, %v, want backend, oncall, platform/db, platform/oncall and support", groups, err)
+	}
+	for _, tt := range []struct {
+		group string
+		want  string
+		ok    bool
+	}{
+		{"oncall", filepath.Join(team, "oncall.yaml"), true},
+		{"support", filepath.Join(company, "support.yaml"), true},
+		{"new", filepath.Join(team, "new.yaml"), false},
+		{"platform/db", filepath.Join(company, "platform", "db.yaml"), true},
+		{"platform/new", filepath.Join(team, "platform", "new.yaml"), false},
+	} {
+		if got, ok := GroupConfigPath(tt.group); got != tt.want || ok != tt.ok {
+			t.Errorf("GroupConfigPath(%s) = %s, %v, want %s, %v", tt.group, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMatchGroups(t *testing.T) {
+	dir := t.TempDir()
+	for _, group := range []string{"oncall-a", "oncall-b", "support", "platform/oncall", "platform/db"} {
+		path := filepath.Join(dir, filepath.FromSlash(group)+".yaml")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	saved := Settings
+	defer func() { Settings = saved }()
+	Settings.Storage.ConfDir = DirList{dir}
+
+	for _, tt := range []struct {
+		pattern string
+		want    string
+	}{
+		{"oncall-*", "oncall-a,oncall-b"},
+		{"platform/*", "platform/db,platform/oncall"},
+		{"*", "oncall-a,oncall-b,support"},
+		{"*/oncall", "platform/oncall"},
+		{"oncall-[b-z]", "oncall-b"},
+		{"team-*", ""},
+	} {
+		if got, err := MatchGroups(tt.pattern); err != nil || strings.Join(got, ",") != tt.want {
+			t.Errorf("MatchGroups(%s) = %v, %v, want %s", tt.pattern, got, err, tt.want)
+		}
+	}
+	if _, err := MatchGroups("oncall-["); err == nil {
+		t.Errorf("MatchGroups(oncall-[) succeeded, want an error")
+	}
+	if IsGroupPattern("platform/oncall") || !IsGroupPattern("oncall-?") {
+		t.Errorf("IsGroupPattern() mistook a group for a pattern or a pattern for a group")
+	}
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// SecretsConfig configures the providers resolving secret references such
+// as vault:secret/data/autoassigner#slack_token in the configuration.
+type SecretsConfig struct {
+	Vault          VaultConfig      `json:"vault"`           // Settings for vault: references
+	AWS            AWSSecretsConfig `json:"aws"`             // Settings for awssm: references
+	RefreshSeconds int              `json:"refresh_seconds"` // How often serve resolves the references again to pick up rotated secrets (default 0, only at startup)
+}
+
+// secretsContextKey is the context key of the SecretsConfig used by a resolution.
+type secretsContextKey struct{}
+
+// secretsConfig returns the SecretsConfig of the configuration being
+// resolved, or that of Settings.
+func secretsConfig(ctx context.Context) SecretsConfig {
+	if conf, ok := ctx.Value(secretsContextKey{}).(SecretsConfig); ok {
+		return conf
+	}
+	return Settings.Secrets
+}
+
+// loadedConfig is the file last read by LoadConfig, whose references
+// RefreshSecrets resolves again.
+var loadedConfig []byte
+
+// RefreshSecrets resolves the secret references of the configuration last
+// loaded by LoadConfig again and returns the resulting settings, for
+// long-running processes such as the server to pick up rotated secrets.
+// Settings itself is left unchanged, so callers can replace it while
+// nothing reads it.
+func RefreshSecrets(ctx context.Context) (*Config, error) {
+	if loadedConfig == nil {
+		return nil, fmt.Errorf("no configuration loaded")
+	}
+	var cfg Config
+	if err := json.Unmarshal(loadedConfig, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if err := resolveSecrets(ctx, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+	if err := validateConfig(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// SecretProvider resolves the secret references of one scheme.
+type SecretProvider interface {
+	// Resolve returns the secret a reference points to; ref is the
+	// reference without its scheme, such as secret/data/app#token.
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// secretProviders holds the providers keyed by scheme.
+var secretProviders = struct {
+	sync.Mutex
+	byScheme map[string]SecretProvider
+}{byScheme: map[string]SecretProvider{
+	"env":   envSecrets{},
+	"file":  fileSecrets{},
+	"vault": vaultSecrets{},
+	"awssm": awsSecrets{},
+}}
+
+// RegisterSecretProvider makes references of the form <scheme>:<ref>
+// resolve through p, replacing any provider of the scheme.
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProviders.Lock()
+	defer secretProviders.Unlock()
+	secretProviders.byScheme[scheme] = p
+}
+
+// secretProvider returns the provider of a value's scheme, if it is a reference.
+func secretProvider(value string) (SecretProvider, string, bool) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, "", false
+	}
+	secretProviders.Lock()
+	defer secretProviders.Unlock()
+	p, ok := secretProviders.byScheme[scheme]
+	return p, ref, ok
+}
+
+// ResolveSecret returns the secret a reference such as env:SLACK_TOKEN
+// points to. Values without the scheme of a provider are returned as they are.
+func ResolveSecret(ctx context.Context, value string) (string, error) {
+	p, ref, ok := secretProvider(value)
+	if !ok {
+		return value, nil
+	}
+	secret, err := p.Resolve(ctx, ref)
+	if err != nil {
+		// The reference itself names no secret, so it is safe to report
+		return "", fmt.Errorf("failed to resolve %s: %w", value, err)
+	}
+	return secret, nil
+}
+
+// resolveSecrets replaces the secret references in every string of cfg.
+// The secrets section is resolved first, as the vault and awssm providers
+// use its settings, and it can only refer to env: and file: secrets.
+func resolveSecrets(ctx context.Context, cfg *Config) error {
+	if err := resolveValue(ctx, reflect.ValueOf(&cfg.Secrets).Elem(), "secrets"); err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, secretsContextKey{}, cfg.Secrets)
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Name == "Secrets" {
+			continue
+		}
+		if err := resolveValue(ctx, v.Field(i), jsonName(field)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveValue replaces the secret references in the strings of v, which is
+// found at path in the configuration, recursing into structs, slices and maps.
+func resolveValue(ctx context.Context, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		secret, err := ResolveSecret(ctx, v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(secret)
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return resolveValue(ctx, v.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := resolveValue(ctx, v.Field(i), path+"."+jsonName(v.Type().Field(i))); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values aren't addressable, so resolve a copy and store it back
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			if err := resolveValue(ctx, elem, path+"."+fmt.Sprint(iter.Key())); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+	return nil
+}
+
+// jsonName returns the name of a field in the configuration file.
+func jsonName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// envSecrets resolves env:NAME to the value of an environment variable.
+type envSecrets struct{}
+
+func (envSecrets) Resolve(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// fileSecrets resolves file:PATH to the contents of a file without the
+// trailing newline, as written by secret mounts of Docker and Kubernetes.
+type fileSecrets struct{}
+
+func (fileSecrets) Resolve(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// secretField returns a field of a secret stored as a JSON object, as
+// selected by the #key of a reference. Without a key the secret must have
+// a single field, which is returned.
+func secretField(data map[string]interface{}, key string) (string, error) {
+	if key == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("secret has %d fields, select one with #key", len(data))
+		}
+		for k := range data {
+			key = k
+		}
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %s", key)
+	}
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	default:
+		// Numbers and nested values are passed on in their JSON form
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	}
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultConfig defines how vault: references are read from HashiCorp Vault.
+type VaultConfig struct {
+	Address    string `json:"address"`                                                // URL of the Vault server, e.g. https://vault.example.com:8200; VAULT_ADDR when empty
+	Namespace  string `json:"namespace"`                                              // Vault Enterprise namespace; VAULT_NAMESPACE when empty
+	AuthMethod string `json:"auth_method" jsonschema:"enum=token|approle|kubernetes"` // How to log in: token (default), approle or kubernetes
+	AuthMount  string `json:"auth_mount"`                                             // Path the auth method is mounted at (default approle or kubernetes)
+	Token      string `json:"token"`                                                  // Token of the token method; VAULT_TOKEN when empty
+	RoleID     string `json:"role_id"`                                                // Role ID of the approle method
+	SecretID   string `json:"secret_id"`                                              // Secret ID of the approle method, e.g. file:/run/secrets/vault-secret-id
+	Role       string `json:"role"`                                                   // Role of the kubernetes method
+	JWTPath    string `json:"jwt_path"`                                               // Service account token of the kubernetes method (default /var/run/secrets/kubernetes.io/serviceaccount/token)
+}
+
+// Supported values for VaultConfig.AuthMethod.
+const (
+	VaultAuthToken      = "token"
+	VaultAuthAppRole    = "approle"
+	VaultAuthKubernetes = "kubernetes"
+)
+
+// errVaultForbidden is returned for reads rejected with 403, such as with an
+// expired or revoked token.
+var errVaultForbidden = errors.New("vault responded with 403 Forbidden")
+
+// vaultSecrets resolves vault:<path>#<key> to a field of the secret read
+// from <path>, such as secret/data/autoassigner#slack_token for the KV
+// version 2 engine mounted at secret/.
+type vaultSecrets struct{}
+
+func (vaultSecrets) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, _ := strings.Cut(ref, "#")
+	conf := secretsConfig(ctx).Vault
+	address := firstNonEmpty(conf.Address, os.Getenv("VAULT_ADDR"))
+	if address == "" {
+		return "", fmt.Errorf("no vault address configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	token, err := vaultLogin.token(ctx, conf, address)
+	if err != nil {
+		return "", err
+	}
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = vaultRequest(ctx, conf, address, http.MethodGet, path, token, nil, &secret)
+	if errors.Is(err, errVaultForbidden) && vaultLogin.forget(token) {
+		// The token was revoked or expired early, so log in again once
+		if token, err = vaultLogin.token(ctx, conf, address); err != nil {
+			return "", err
+		}
+		err = vaultRequest(ctx, conf, address, http.MethodGet, path, token, nil, &secret)
+	}
+	if err != nil {
+		return "", err
+	}
+	data := secret.Data
+	// The KV version 2 engine nests the fields with the metadata of the version
+	if nested, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = nested
+	}
+	return secretField(data, key)
+}
+
+// timeNow is replaced in tests to expire tokens.
+var timeNow = time.Now
+
+// vaultLogin holds the token of the process, shared by all vault: references.
+var vaultLogin vaultSession
+
+// vaultSession is a Vault token obtained by logging in, which is renewed
+// while it is renewable and replaced by logging in again otherwise.
+type vaultSession struct {
+	mu        sync.Mutex
+	conf      VaultConfig // Settings the token was obtained with
+	value     string
+	renewable bool
+	ttl       time.Duration
+	expires   time.Time // Zero for tokens without a TTL
+}
+
+// vaultAuth is the auth block of Vault's login and renew responses.
+type vaultAuth struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// token returns a valid token, logging in or renewing the current token
+// once two thirds of its lifetime have passed.
+func (s *vaultSession) token(ctx context.Context, conf VaultConfig, address string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	method := firstNonEmpty(conf.AuthMethod, VaultAuthToken)
+	if method == VaultAuthToken {
+		token := firstNonEmpty(conf.Token, os.Getenv("VAULT_TOKEN"))
+		if token == "" {
+			return "", fmt.Errorf("no vault token configured")
+		}
+		return token, nil
+	}
+
+	now := timeNow()
+	if s.value != "" && s.conf == conf {
+		if s.expires.IsZero() || now.Before(s.expires.Add(-s.ttl/3)) {
+			return s.value, nil
+		}
+		if s.renewable && now.Before(s.expires) {
+			var renewed vaultAuth
+			if err := vaultRequest(ctx, conf, address, http.MethodPost, "auth/token/renew-self", s.value, nil, &renewed); err == nil {
+				s.set(conf, renewed, now)
+				return s.value, nil
+			}
+			// Log in again when the token can't be renewed, e.g. after reaching its max TTL
+		}
+	}
+
+	var login map[string]string
+	switch method {
+	case VaultAuthAppRole:
+		if conf.RoleID == "" || conf.SecretID == "" {
+			return "", fmt.Errorf("role_id and secret_id are required for the vault approle method")
+		}
+		login = map[string]string{"role_id": conf.RoleID, "secret_id": conf.SecretID}
+	case VaultAuthKubernetes:
+		if conf.Role == "" {
+			return "", fmt.Errorf("role is required for the vault kubernetes method")
+		}
+		jwt, err := os.ReadFile(firstNonEmpty(conf.JWTPath, "/var/run/secrets/kubernetes.io/serviceaccount/token"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read service account token: %w", err)
+		}
+		login = map[string]string{"role": conf.Role, "jwt": strings.TrimSpace(string(jwt))}
+	default:
+		return "", fmt.Errorf("unknown vault auth_method: %s", method)
+	}
+	var auth vaultAuth
+	if err := vaultRequest(ctx, conf, address, http.MethodPost, "auth/"+firstNonEmpty(conf.AuthMount, method)+"/login", "", login, &auth); err != nil {
+		return "", fmt.Errorf("vault login failed: %w", err)
+	}
+	if auth.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault login returned no token")
+	}
+	s.set(conf, auth, now)
+	return s.value, nil
+}
+
+// set stores the token of a login or renew response received at now.
+func (s *vaultSession) set(conf VaultConfig, auth vaultAuth, now time.Time) {
+	s.conf = conf
+	s.value = auth.Auth.ClientToken
+	s.renewable = auth.Auth.Renewable
+	s.ttl = time.Duration(auth.Auth.LeaseDuration) * time.Second
+	s.expires = time.Time{}
+	if s.ttl > 0 {
+		s.expires = now.Add(s.ttl)
+	}
+}
+
+// forget drops token if it is the token of the session, so the next call
+// logs in again. It reports whether the token was dropped; configured
+// tokens can't be replaced and are kept.
+func (s *vaultSession) forget(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value == "" || s.value != token {
+		return false
+	}
+	s.value = ""
+	return true
+}
+
+// vaultRequest calls the Vault API at /v1/<path> and decodes the response into out.
+func vaultRequest(ctx context.Context, conf VaultConfig, address, method, path, token string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if namespace := firstNonEmpty(conf.Namespace, os.Getenv("VAULT_NAMESPACE")); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return errVaultForbidden
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("vault responded with %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse vault response: %w", err)
+	}
+	return nil
+}
+
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
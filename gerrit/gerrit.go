@@ -0,0 +1,210 @@
+// Package gerrit integrates the autoassigner with Gerrit Code Review: it
+// reads change events sent by the webhooks plugin, finds open changes
+// without reviewers by polling, and adds reviewers through the REST API.
+package gerrit
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"autoassigner/vcs"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const defaultPollQuery = "status:open -is:wip"
+
+// xssiPrefix precedes every JSON response of the Gerrit REST API.
+const xssiPrefix = ")]}'"
+
+// account is an account as reported in events and by the REST API.
+type account struct {
+	AccountID int    `json:"_account_id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+}
+
+// ParseEvent reads the change from an event of the webhooks plugin. It
+// reports false for events other than the upload of a change's first
+// patch set, which is when a change is created.
+func ParseEvent(payload []byte) (*vcs.Change, bool, error) {
+	var event struct {
+		Type   string `json:"type"`
+		Change struct {
+			Project string  `json:"project"`
+			Number  int     `json:"number"`
+			Subject string  `json:"subject"`
+			Owner   account `json:"owner"`
+			WIP     bool    `json:"wip"`
+		} `json:"change"`
+		PatchSet struct {
+			Number int `json:"number"`
+		} `json:"patchSet"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, false, fmt.Errorf("failed to parse Gerrit event: %w", err)
+	}
+	if event.Type != "patchset-created" || event.PatchSet.Number != 1 || event.Change.WIP {
+		return nil, false, nil
+	}
+	if event.Change.Project == "" || event.Change.Number == 0 {
+		return nil, false, fmt.Errorf("patchset-created event without a change")
+	}
+	return &vcs.Change{
+		Repo:        event.Change.Project,
+		Number:      event.Change.Number,
+		Title:       event.Change.Subject,
+		Author:      event.Change.Owner.Username,
+		PullRequest: true,
+	}, true, nil
+}
+
+// Reviewer returns the Gerrit account of a user from the identity mapping.
+// Users without a mapped account are assumed to use their username.
+func Reviewer(ctx context.Context, user string) (string, error) {
+	id, err := identity.Lookup(ctx, user, identity.Gerrit)
+	if errors.Is(err, identity.ErrUnknown) {
+		return user, nil
+	}
+	return id, err
+}
+
+// AddReviewer adds reviewer to the reviewers of a change.
+func AddReviewer(ctx context.Context, c vcs.Change, reviewer string) error {
+	path := fmt.Sprintf("/changes/%s/reviewers", changeID(c))
+	var result struct {
+		Error string `json:"error"`
+	}
+	if err := call(ctx, http.MethodPost, path, map[string]string{"reviewer": reviewer}, &result); err != nil {
+		return err
+	}
+	// Unknown or ambiguous reviewers are reported with status 200
+	if result.Error != "" {
+		return fmt.Errorf("Gerrit rejected reviewer %s: %s", reviewer, result.Error)
+	}
+	return nil
+}
+
+// ChangedFiles returns the paths of the files changed by the current patch
+// set of a change, leaving out the commit message and merge list.
+func ChangedFiles(ctx context.Context, c vcs.Change) ([]string, error) {
+	var files map[string]json.RawMessage
+	if err := call(ctx, http.MethodGet, fmt.Sprintf("/changes/%s/revisions/current/files", changeID(c)), nil, &files); err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		if path != "/COMMIT_MSG" && path != "/MERGE_LIST" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// UnreviewedChanges returns the changes matching the poll query that have
+// no reviewer other than their owner.
+func UnreviewedChanges(ctx context.Context) ([]vcs.Change, error) {
+	query := config.Settings.Gerrit.PollQuery
+	if query == "" {
+		query = defaultPollQuery
+	}
+	path := "/changes/?o=DETAILED_LABELS&o=DETAILED_ACCOUNTS&q=" + url.QueryEscape(query)
+
+	var changes []struct {
+		Project   string               `json:"project"`
+		Number    int                  `json:"_number"`
+		Subject   string               `json:"subject"`
+		Owner     account              `json:"owner"`
+		Reviewers map[string][]account `json:"reviewers"`
+	}
+	if err := call(ctx, http.MethodGet, path, nil, &changes); err != nil {
+		return nil, err
+	}
+
+	var unreviewed []vcs.Change
+	for _, ch := range changes {
+		reviewed := false
+		for _, r := range ch.Reviewers["REVIEWER"] {
+			if r.AccountID != ch.Owner.AccountID {
+				reviewed = true
+			}
+		}
+		if !reviewed {
+			unreviewed = append(unreviewed, vcs.Change{
+				Repo:        ch.Project,
+				Number:      ch.Number,
+				Title:       ch.Subject,
+				Author:      ch.Owner.Username,
+				PullRequest: true,
+			})
+		}
+	}
+	return unreviewed, nil
+}
+
+// changeID returns the identifier of a change in REST API paths.
+func changeID(c vcs.Change) string {
+	return fmt.Sprintf("%s~%d", url.PathEscape(c.Repo), c.Number)
+}
+
+// call sends an authenticated request to the Gerrit REST API and decodes
+// the response, without its XSSI prefix, into result.
+func call(ctx context.Context, method, path string, body, result interface{}) error {
+	conf := config.Settings.Gerrit
+	if conf.Url == "" {
+		return fmt.Errorf("url is required in gerrit configuration")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	// Authenticated endpoints live below /a/
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(conf.Url, "/")+"/a"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if conf.Username != "" {
+		req.SetBasicAuth(conf.Username, conf.Password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Gerrit request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// Errors are plain text
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if text := strings.TrimSpace(string(msg)); text != "" {
+			return fmt.Errorf("Gerrit request failed: %s: %s", resp.Status, text)
+		}
+		return fmt.Errorf("Gerrit request failed: unexpected status %s", resp.Status)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	if prefix, err := r.Peek(len(xssiPrefix)); err == nil && string(prefix) == xssiPrefix {
+		r.Discard(len(xssiPrefix))
+	}
+	if err := json.NewDecoder(r).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse Gerrit response: %w", err)
+	}
+	return nil
+}
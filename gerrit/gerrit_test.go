@@ -0,0 +1,108 @@
+package gerrit
+
+import (
+	"autoassigner/config"
+	"autoassigner/vcs"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    *vcs.Change
+		wantErr bool
+	}{
+		{
+			payload: `{"type": "patchset-created", "change": {"project": "platform/api", "number": 1234, "subject": "Add cache", "owner": {"username": "jdoe"}}, "patchSet": {"number": 1}}`,
+			want:    &vcs.Change{Repo: "platform/api", Number: 1234, Title: "Add cache", Author: "jdoe", PullRequest: true},
+		},
+		// Later patch sets and work in progress are not assigned
+		{payload: `{"type": "patchset-created", "change": {"project": "platform/api", "number": 1234}, "patchSet": {"number": 2}}`},
+		{payload: `{"type": "patchset-created", "change": {"project": "platform/api", "number": 1234, "wip": true}, "patchSet": {"number": 1}}`},
+		{payload: `{"type": "comment-added", "change": {"project": "platform/api", "number": 1234}}`},
+		{payload: `{"type": "patchset-created", "patchSet": {"number": 1}}`, wantErr: true},
+		{payload: `{`, wantErr: true},
+	}
+	for i, tt := range tests {
+		got, ok, err := ParseEvent([]byte(tt.payload))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d ParseEvent() error = %v, wantErr %v", i, err, tt.wantErr)
+			continue
+		}
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d ParseEvent() = %+v, %v, want %+v", i, got, ok, tt.want)
+		}
+	}
+}
+
+func TestReviewers(t *testing.T) {
+	var added []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "bot" || pass != "http-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/a/changes/":
+			if r.URL.Query().Get("q") != "status:open -is:wip" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(")]}'\n" + `[
+				{"project": "platform/api", "_number": 1, "subject": "One", "owner": {"_account_id": 100, "username": "jdoe"}, "reviewers": {"REVIEWER": [{"_account_id": 100}]}},
+				{"project": "platform/api", "_number": 2, "subject": "Two", "owner": {"_account_id": 100, "username": "jdoe"}, "reviewers": {"REVIEWER": [{"_account_id": 101}]}},
+				{"project": "platform/web", "_number": 3, "subject": "Three", "owner": {"_account_id": 102, "username": "asmith"}}
+			]`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/reviewers"):
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(")]}'\n"))
+			if body["reviewer"] == "nobody" {
+				w.Write([]byte(`{"input": "nobody", "error": "nobody does not identify a registered user or group"}`))
+				return
+			}
+			added = append(added, r.URL.EscapedPath()+" "+body["reviewer"])
+			w.Write([]byte(`{"input": "` + body["reviewer"] + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Not found"))
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Gerrit = config.GerritConfig{Url: server.URL, Username: "bot", Password: "http-password"}
+	ctx := context.Background()
+
+	// Reviewing their own change doesn't count as a review by the owner
+	changes, err := UnreviewedChanges(ctx)
+	want := []vcs.Change{
+		{Repo: "platform/api", Number: 1, Title: "One", Author: "jdoe", PullRequest: true},
+		{Repo: "platform/web", Number: 3, Title: "Three", Author: "asmith", PullRequest: true},
+	}
+	if err != nil || !reflect.DeepEqual(changes, want) {
+		t.Fatalf("UnreviewedChanges() = %+v, %v, want %+v", changes, err, want)
+	}
+
+	if err := AddReviewer(ctx, changes[0], "alice"); err != nil {
+		t.Fatalf("AddReviewer() error = %v", err)
+	}
+	if want := []string{"/a/changes/platform%2Fapi~1/reviewers alice"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("reviewers added = %v, want %v", added, want)
+	}
+	if err := AddReviewer(ctx, changes[1], "nobody"); err == nil || !strings.Contains(err.Error(), "registered user") {
+		t.Errorf("AddReviewer(nobody) error = %v, want Gerrit's error", err)
+	}
+
+	config.Settings.Gerrit.Url = server.URL + "/missing"
+	if _, err := UnreviewedChanges(ctx); err == nil || !strings.Contains(err.Error(), "Not found") {
+		t.Errorf("UnreviewedChanges() error = %v, want the server's message", err)
+	}
+}
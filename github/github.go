@@ -0,0 +1,279 @@
+// Package github integrates the autoassigner with GitHub: it reads the
+// pull request and issue events GitHub delivers and requests reviews from
+// or assigns the selected users through the GitHub REST API.
+package github
+
+import (
+	"autoassigner/codeowners"
+	"autoassigner/config"
+	"autoassigner/identity"
+	"autoassigner/vcs"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const defaultApiUrl = "https://api.github.com"
+
+// ParseEvent reads the change from the payload of a GitHub event.
+// Supported events are pull_request, pull_request_target and issues.
+func ParseEvent(name string, payload []byte) (*vcs.Change, error) {
+	var event struct {
+		PullRequest *item `json:"pull_request"`
+		Issue       *item `json:"issue"`
+		Repository  struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse %s event: %w", name, err)
+	}
+
+	var it *item
+	switch name {
+	case "pull_request", "pull_request_target":
+		it = event.PullRequest
+	case "issues":
+		it = event.Issue
+	default:
+		return nil, fmt.Errorf("unsupported event %s, expected pull_request, pull_request_target or issues", name)
+	}
+	if it == nil || event.Repository.FullName == "" {
+		return nil, fmt.Errorf("%s event without a pull request or issue", name)
+	}
+
+	c := &vcs.Change{
+		Repo:        event.Repository.FullName,
+		Number:      it.Number,
+		Title:       it.Title,
+		Author:      it.User.Login,
+		Base:        it.Base.Ref,
+		PullRequest: name != "issues",
+	}
+	for _, label := range it.Labels {
+		c.Labels = append(c.Labels, label.Name)
+	}
+	return c, nil
+}
+
+// item holds the fields pull requests and issues share in event payloads.
+type item struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	User   struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// Login returns the GitHub login of a user from the identity mapping.
+// Users without a mapped login are assumed to use their username.
+func Login(ctx context.Context, user string) (string, error) {
+	login, err := identity.Lookup(ctx, user, identity.GitHub)
+	if errors.Is(err, identity.ErrUnknown) {
+		return user, nil
+	}
+	return login, err
+}
+
+// ChangedFiles returns the paths of the files changed by the pull request
+// of a change. Issues change no files.
+func ChangedFiles(ctx context.Context, c vcs.Change) ([]string, error) {
+	if !c.PullRequest {
+		return nil, nil
+	}
+	var paths []string
+	for page := 1; ; page++ {
+		var files []struct {
+			Filename string `json:"filename"`
+		}
+		path := fmt.Sprintf("/repos/%s/pulls/%d/files?per_page=100&page=%d", c.Repo, c.Number, page)
+		if err := call(ctx, http.MethodGet, path, nil, &files); err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			paths = append(paths, f.Filename)
+		}
+		if len(files) < 100 {
+			return paths, nil
+		}
+	}
+}
+
+// codeOwnersPaths are the places GitHub looks for a CODEOWNERS file, in order.
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// CodeOwners reads the CODEOWNERS file of the branch a pull request merges
+// into. It returns nil when the repository has none.
+func CodeOwners(ctx context.Context, c vcs.Change) (*codeowners.File, error) {
+	for _, path := range codeOwnersPaths {
+		var data []byte
+		p := fmt.Sprintf("/repos/%s/contents/%s", c.Repo, path)
+		if c.Base != "" {
+			p += "?ref=" + url.QueryEscape(c.Base)
+		}
+		err := call(ctx, http.MethodGet, p, nil, &data)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return codeowners.Parse(data), nil
+	}
+	return nil, nil
+}
+
+// OwnerUsers returns the usernames of code owners: users given by GitHub
+// login or email, and the members of teams. Owners given by an email
+// without a mapped user are left out.
+func OwnerUsers(ctx context.Context, owners []string) ([]string, error) {
+	var users []string
+	for _, owner := range owners {
+		login, isLogin := strings.CutPrefix(owner, "@")
+		if !isLogin {
+			user, err := identity.User(ctx, identity.Email, owner)
+			if errors.Is(err, identity.ErrUnknown) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, user)
+			continue
+		}
+
+		logins := []string{login}
+		if org, team, isTeam := strings.Cut(login, "/"); isTeam {
+			members, err := teamMembers(ctx, org, team)
+			if err != nil {
+				return nil, err
+			}
+			logins = members
+		}
+		for _, login := range logins {
+			user, err := identity.User(ctx, identity.GitHub, login)
+			if errors.Is(err, identity.ErrUnknown) {
+				user, err = login, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// teamMembers returns the logins of the members of a team.
+func teamMembers(ctx context.Context, org, team string) ([]string, error) {
+	var logins []string
+	for page := 1; ; page++ {
+		var members []struct {
+			Login string `json:"login"`
+		}
+		path := fmt.Sprintf("/orgs/%s/teams/%s/members?per_page=100&page=%d", org, team, page)
+		if err := call(ctx, http.MethodGet, path, nil, &members); err != nil {
+			return nil, fmt.Errorf("failed to get members of team @%s/%s: %w", org, team, err)
+		}
+		for _, m := range members {
+			logins = append(logins, m.Login)
+		}
+		if len(members) < 100 {
+			return logins, nil
+		}
+	}
+}
+
+// RequestReview asks login to review the pull request of a change.
+func RequestReview(ctx context.Context, c vcs.Change, login string) error {
+	path := fmt.Sprintf("/repos/%s/pulls/%d/requested_reviewers", c.Repo, c.Number)
+	return call(ctx, http.MethodPost, path, map[string][]string{"reviewers": {login}}, nil)
+}
+
+// AddAssignee adds login to the assignees of a pull request or issue.
+func AddAssignee(ctx context.Context, c vcs.Change, login string) error {
+	path := fmt.Sprintf("/repos/%s/issues/%d/assignees", c.Repo, c.Number)
+	return call(ctx, http.MethodPost, path, map[string][]string{"assignees": {login}}, nil)
+}
+
+// errNotFound is returned by call for resources that don't exist.
+var errNotFound = errors.New("not found")
+
+// call sends a request to the GitHub API, checks that it succeeded and
+// decodes the response into result unless it is nil. A result of type
+// *[]byte receives the raw response, such as the content of a file.
+func call(ctx context.Context, method, path string, body, result interface{}) error {
+	conf := config.Settings.GitHub
+	base := conf.ApiUrl
+	if base == "" {
+		base = defaultApiUrl
+	}
+	token := conf.Token
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(base, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if _, raw := result.(*[]byte); raw {
+		req.Header.Set("Accept", "application/vnd.github.raw")
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("GitHub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("GitHub request failed: %s %w", path, errNotFound)
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Message != "" {
+			return fmt.Errorf("GitHub request failed: %s: %s", resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("GitHub request failed: unexpected status %s", resp.Status)
+	}
+	switch result := result.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*result, err = io.ReadAll(resp.Body)
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+}
@@ -0,0 +1,178 @@
+package github
+
+import (
+	"autoassigner/config"
+	"autoassigner/vcs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    *vcs.Change
+		wantErr string
+	}{
+		{
+			name:    "pull_request",
+			payload: `{"action": "opened", "pull_request": {"number": 7, "title": "Fix login", "user": {"login": "alice-gh"}, "labels": [{"name": "auth"}]}, "repository": {"full_name": "acme/api"}}`,
+			want:    &vcs.Change{Repo: "acme/api", Number: 7, Title: "Fix login", Author: "alice-gh", Labels: []string{"auth"}, PullRequest: true},
+		},
+		{
+			name:    "issues",
+			payload: `{"action": "opened", "issue": {"number": 3, "title": "Crash", "user": {"login": "bob"}}, "repository": {"full_name": "acme/web"}}`,
+			want:    &vcs.Change{Repo: "acme/web", Number: 3, Title: "Crash", Author: "bob"},
+		},
+		{name: "push", payload: `{}`, wantErr: "unsupported event"},
+		{name: "pull_request", payload: `{"repository": {"full_name": "acme/api"}}`, wantErr: "without a pull request"},
+		{name: "issues", payload: `{`, wantErr: "failed to parse"},
+	}
+	for i, tt := range tests {
+		got, err := ParseEvent(tt.name, []byte(tt.payload))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("#%d ParseEvent(%s) error = %v, want %q", i, tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d ParseEvent(%s) = %+v, %v, want %+v", i, tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestReviewAndAssign(t *testing.T) {
+	requests := map[string]map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/repos/acme/api/pulls/8/requested_reviewers" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message": "Reviews may only be requested from collaborators."}`))
+			return
+		}
+		var body map[string][]string
+		json.NewDecoder(r.Body).Decode(&body)
+		requests[r.URL.Path] = body
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.GitHub = config.GitHubConfig{ApiUrl: server.URL, Token: "secret"}
+	config.Settings.Identity.Users = map[string]map[string]string{"alice": {"github": "alice-gh"}}
+
+	ctx := context.Background()
+	login, err := Login(ctx, "alice")
+	if err != nil || login != "alice-gh" {
+		t.Errorf("Login(alice) = %q, %v, want alice-gh", login, err)
+	}
+	if login, err := Login(ctx, "bob"); err != nil || login != "bob" {
+		t.Errorf("Login(bob) = %q, %v, want bob", login, err)
+	}
+
+	pr := vcs.Change{Repo: "acme/api", Number: 7, PullRequest: true}
+	if err := RequestReview(ctx, pr, login); err != nil {
+		t.Fatalf("RequestReview() error = %v", err)
+	}
+	issue := vcs.Change{Repo: "acme/web", Number: 3}
+	if err := AddAssignee(ctx, issue, "bob"); err != nil {
+		t.Fatalf("AddAssignee() error = %v", err)
+	}
+	want := map[string]map[string][]string{
+		"/repos/acme/api/pulls/7/requested_reviewers": {"reviewers": {"alice-gh"}},
+		"/repos/acme/web/issues/3/assignees":          {"assignees": {"bob"}},
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+
+	pr.Number = 8
+	if err := RequestReview(ctx, pr, login); err == nil || !strings.Contains(err.Error(), "collaborators") {
+		t.Errorf("RequestReview() error = %v, want the API's message", err)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/api/pulls/7/files" || r.URL.Query().Get("per_page") != "100" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// A full first page and a partial second one
+		var files []map[string]string
+		count := 100
+		if r.URL.Query().Get("page") == "2" {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			files = append(files, map[string]string{"filename": fmt.Sprintf("api/file%s-%d.go", r.URL.Query().Get("page"), i)})
+		}
+		json.NewEncoder(w).Encode(files)
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.GitHub = config.GitHubConfig{ApiUrl: server.URL}
+
+	ctx := context.Background()
+	files, err := ChangedFiles(ctx, vcs.Change{Repo: "acme/api", Number: 7, PullRequest: true})
+	if err != nil || len(files) != 101 || files[100] != "api/file2-0.go" {
+		t.Errorf("ChangedFiles() = %d files, %v, want 101 across two pages", len(files), err)
+	}
+	if files, err := ChangedFiles(ctx, vcs.Change{Repo: "acme/api", Number: 8}); err != nil || files != nil {
+		t.Errorf("ChangedFiles() of an issue = %v, %v, want none", files, err)
+	}
+}
+
+func TestCodeOwners(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/acme/api/contents/CODEOWNERS" && r.URL.Query().Get("ref") == "main":
+			if r.Header.Get("Accept") != "application/vnd.github.raw" {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			w.Write([]byte("*.go @acme/backend carol@example.com\n/docs/ @dave-gh\n"))
+		case r.URL.Path == "/orgs/acme/teams/backend/members":
+			w.Write([]byte(`[{"login": "alice-gh"}, {"login": "bob"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.GitHub = config.GitHubConfig{ApiUrl: server.URL}
+	config.Settings.Identity.Users = map[string]map[string]string{
+		"alice": {"github": "alice-gh"},
+		"carol": {"email": "carol@example.com"},
+	}
+
+	ctx := context.Background()
+	// .github/CODEOWNERS is missing, so the one at the root is used
+	owners, err := CodeOwners(ctx, vcs.Change{Repo: "acme/api", Number: 7, Base: "main", PullRequest: true})
+	if err != nil || owners == nil {
+		t.Fatalf("CodeOwners() = %v, %v", owners, err)
+	}
+	users, err := OwnerUsers(ctx, owners.OwnersOf([]string{"api/user.go", "docs/index.md"}))
+	if want := []string{"alice", "bob", "carol", "dave-gh"}; err != nil || !reflect.DeepEqual(users, want) {
+		t.Errorf("OwnerUsers() = %v, %v, want %v", users, err, want)
+	}
+
+	if owners, err := CodeOwners(ctx, vcs.Change{Repo: "acme/web", Number: 1, PullRequest: true}); err != nil || owners != nil {
+		t.Errorf("CodeOwners() without a CODEOWNERS file = %v, %v, want nil", owners, err)
+	}
+}
@@ -3,7 +3,9 @@ module autoassigner
 go 1.21
 
 require (
+	github.com/nicksnyder/go-i18n/v2 v2.4.0
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/text v0.14.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
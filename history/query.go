@@ -0,0 +1,185 @@
+package history
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query selects assignment log records, as parsed by ParseQuery from
+// expressions such as "user=alice AND since=90d".
+type Query struct {
+	Conditions []Condition // Conditions a record must all meet
+}
+
+// Condition compares a field of a record with a list of values.
+type Condition struct {
+	Field  string    // user, group, role, actor, strategy, id, since, until or metadata.<key>
+	Negate bool      // Whether the field must match none of Values, for !=
+	Values []string  // Alternatives the field is compared with
+	Time   time.Time // Bound of since and until
+}
+
+// queryFields are the fields conditions may compare, besides metadata.<key>.
+var queryFields = map[string]func(r *Record) string{
+	"user":     func(r *Record) string { return r.User },
+	"group":    func(r *Record) string { return r.Group },
+	"role":     func(r *Record) string { return r.Role },
+	"actor":    func(r *Record) string { return r.Actor },
+	"strategy": func(r *Record) string { return r.Strategy },
+	"id":       func(r *Record) string { return r.ID },
+}
+
+// andPattern separates the conditions of a query.
+var andPattern = regexp.MustCompile(`(?i)\s+AND\s+`)
+
+// ParseQuery parses a query of conditions joined by AND. A condition is
+// field=value or field!=value, where value may list alternatives separated
+// by commas, such as user=alice,bob. since and until take a window before
+// now, such as 90d, a date such as 2024-05-01 or an RFC 3339 time. An empty
+// query matches every record.
+func ParseQuery(query string, now time.Time) (*Query, error) {
+	q := &Query{}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return q, nil
+	}
+	for _, expr := range andPattern.Split(query, -1) {
+		field, value, ok := strings.Cut(expr, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid condition %q: expected field=value", expr)
+		}
+		cond, err := NewCondition(strings.TrimSuffix(field, "!"), strings.HasSuffix(field, "!"), value, now)
+		if err != nil {
+			return nil, err
+		}
+		q.Conditions = append(q.Conditions, cond)
+	}
+	return q, nil
+}
+
+// NewCondition returns the condition comparing field with value, a list of
+// alternatives separated by commas, like a condition of ParseQuery.
+func NewCondition(field string, negate bool, value string, now time.Time) (Condition, error) {
+	field = strings.ToLower(strings.TrimSpace(field))
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	cond := Condition{Field: field, Negate: negate}
+	switch {
+	case field == "since" || field == "until":
+		if negate {
+			return cond, fmt.Errorf("%s does not support !=", field)
+		}
+		t, err := parseTime(value, now)
+		if err != nil {
+			return cond, fmt.Errorf("invalid %s: %w", field, err)
+		}
+		cond.Time = t
+		return cond, nil
+	case queryFields[field] == nil && !strings.HasPrefix(field, "metadata."):
+		return cond, fmt.Errorf("unknown query field %q", field)
+	}
+	for _, v := range strings.Split(value, ",") {
+		cond.Values = append(cond.Values, strings.TrimSpace(v))
+	}
+	return cond, nil
+}
+
+// parseTime parses the bound of since and until: a window before now, a
+// date or an RFC 3339 time.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	d, err := ParseWindow(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a window such as 90d nor a date", value)
+	}
+	return now.Add(-d), nil
+}
+
+// ParseWindow parses a time window such as 30d, 2w or 12h. Besides the
+// units of time.ParseDuration it accepts d for days and w for weeks.
+func ParseWindow(window string) (time.Duration, error) {
+	unit := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, d := range unit {
+		if n, ok := strings.CutSuffix(window, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count <= 0 {
+				return 0, fmt.Errorf("invalid window %q", window)
+			}
+			return time.Duration(count) * d, nil
+		}
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", window)
+	}
+	return d, nil
+}
+
+// Match reports whether record meets every condition of the query.
+func (q *Query) Match(record *Record) bool {
+	for _, cond := range q.Conditions {
+		if !cond.match(record) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) match(record *Record) bool {
+	switch c.Field {
+	case "since", "until":
+		t, err := time.Parse(time.RFC3339, record.Timestamp)
+		if err != nil {
+			return false
+		}
+		if c.Field == "since" {
+			return !t.Before(c.Time)
+		}
+		return t.Before(c.Time)
+	}
+	var value string
+	if key, ok := strings.CutPrefix(c.Field, "metadata."); ok {
+		value = record.Metadata[key]
+	} else {
+		value = queryFields[c.Field](record)
+	}
+	for _, v := range c.Values {
+		if v == value {
+			return !c.Negate
+		}
+	}
+	return c.Negate
+}
+
+// Groups returns the groups the query is limited to by group conditions.
+// ok is false when records of any group may match.
+func (q *Query) Groups() (groups []string, ok bool) {
+	for _, cond := range q.Conditions {
+		if cond.Field != "group" || cond.Negate {
+			continue
+		}
+		if !ok {
+			groups, ok = append([]string{}, cond.Values...), true
+			continue
+		}
+		// Several conditions leave the groups all of them list
+		kept := groups[:0]
+		for _, g := range groups {
+			for _, v := range cond.Values {
+				if g == v {
+					kept = append(kept, g)
+					break
+				}
+			}
+		}
+		groups = kept
+	}
+	return groups, ok
+}
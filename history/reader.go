@@ -0,0 +1,89 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reader reads assignment log records from a stream of JSON lines.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader creates a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next record in the log, upgraded to the current schema.
+// It returns io.EOF when there are no more records. Blank lines are skipped.
+func (r *Reader) Next() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record, err := parseRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// ReadAll returns all remaining records in the log.
+func (r *Reader) ReadAll() ([]Record, error) {
+	var records []Record
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+}
+
+// ReadFile reads all records from the log file at path.
+// A missing file is treated as an empty log.
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return NewReader(f).ReadAll()
+}
+
+// parseRecord decodes a single log line of any supported schema version.
+func parseRecord(line []byte) (*Record, error) {
+	var record Record
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse log record: %w", err)
+	}
+
+	// Version 1 records predate the schema_version field
+	if record.SchemaVersion == 0 {
+		record.SchemaVersion = 1
+	}
+	if record.SchemaVersion > CurrentSchemaVersion {
+		return nil, fmt.Errorf("unsupported log schema version %d", record.SchemaVersion)
+	}
+	return &record, nil
+}
@@ -0,0 +1,212 @@
+package history
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	log := strings.Join([]string{
+		`{"timestamp":"2024-01-01T10:00:00Z","group":"g","user":"alice","strategy":"round_robin","last_index":-1,"next_index":0,"total_count":2,"user_count":1}`,
+		``,
+		`{"schema_version":2,"timestamp":"2024-01-02T10:00:00Z","group":"g","user":"bob","strategy":"round_robin","last_index":0,"next_index":1,"total_count":2,"user_count":1,"actor":"ci","metadata":{"host":"h"},"availability_check_ms":12}`,
+		`{"schema_version":3,"id":"a1","timestamp":"2024-01-03T10:00:00Z","group":"g","user":"alice","strategy":"round_robin","last_index":1,"next_index":0,"total_count":2,"user_count":2}`,
+	}, "\n")
+
+	r := NewReader(strings.NewReader(log))
+
+	first, err := r.Next()
+	if err != nil {
+		t.Fatalf("Reader.Next() error = %v", err)
+	}
+	if first.SchemaVersion != 1 || first.User != "alice" || first.Actor != "" {
+		t.Errorf("Reader.Next() v1 record = %+v", first)
+	}
+
+	second, err := r.Next()
+	if err != nil {
+		t.Fatalf("Reader.Next() error = %v", err)
+	}
+	if second.SchemaVersion != 2 || second.Actor != "ci" || second.Metadata["host"] != "h" || second.AvailabilityCheckMs != 12 {
+		t.Errorf("Reader.Next() v2 record = %+v", second)
+	}
+
+	third, err := r.Next()
+	if err != nil {
+		t.Fatalf("Reader.Next() error = %v", err)
+	}
+	if third.SchemaVersion != 3 || third.ID != "a1" {
+		t.Errorf("Reader.Next() v3 record = %+v", third)
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Reader.Next() at end error = %v, want io.EOF", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{"invalid json", `{"user":`},
+		{"future schema version", `{"schema_version":99,"user":"alice"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReader(strings.NewReader(tt.log)).ReadAll(); err == nil {
+				t.Error("Reader.ReadAll() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+
+	records, err := ReadFile(filepath.Join(dir, "missing.log"))
+	if err != nil || len(records) != 0 {
+		t.Errorf("ReadFile() on missing file = %v, %v, want no records", records, err)
+	}
+
+	path := filepath.Join(dir, "assignments.log")
+	if err := os.WriteFile(path, []byte(`{"user":"alice"}`+"\n"+`{"user":"bob"}`+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+	records, err = ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if len(records) != 2 || records[1].User != "bob" {
+		t.Errorf("ReadFile() = %+v, want alice and bob", records)
+	}
+}
+
+func TestReadSkipFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skips.log")
+	if records, err := ReadSkipFile(path); err != nil || records != nil {
+		t.Errorf("ReadSkipFile() on missing file = %v, %v, want nil, nil", records, err)
+	}
+
+	log := `{"timestamp":"2024-01-01T10:00:00Z","group":"g","user":"alice","reason":"unavailable","checker":"inout","assignment_id":"a1"}` + "\n\n" +
+		`{"timestamp":"2024-01-02T10:00:00Z","group":"g","user":"bob","reason":"unavailable"}` + "\n"
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatalf("failed to write skip log: %v", err)
+	}
+	records, err := ReadSkipFile(path)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("ReadSkipFile() = %v, %v, want 2 records", records, err)
+	}
+	if records[0].User != "alice" || records[0].AssignmentID != "a1" || records[1].Checker != "" {
+		t.Errorf("ReadSkipFile() = %+v", records)
+	}
+
+	if err := os.WriteFile(path, []byte("not json\n"), 0644); err != nil {
+		t.Fatalf("failed to write skip log: %v", err)
+	}
+	if _, err := ReadSkipFile(path); err == nil {
+		t.Error("ReadSkipFile() on invalid log error = nil, want error")
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		window  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"month", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			got, err := ParseWindow(tt.window)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseWindow(%q) = %v, %v, want %v", tt.window, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{ID: "a1", Timestamp: "2024-01-10T09:00:00Z", Group: "alpha", User: "alice", Actor: "ci"},
+		{ID: "a2", Timestamp: "2024-05-01T09:00:00Z", Group: "alpha", User: "bob", Actor: "cli", Metadata: map[string]string{"host": "h1"}},
+		{ID: "a3", Timestamp: "2024-05-10T09:00:00Z", Group: "beta", User: "alice", Role: "lead", Actor: "ci"},
+	}
+	tests := []struct {
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{"a1", "a2", "a3"}, false},
+		{"user=alice", []string{"a1", "a3"}, false},
+		{"user=alice AND since=90d", []string{"a3"}, false},
+		{"user=alice and since=90d", []string{"a3"}, false},
+		{"user=alice,bob AND actor!=ci", []string{"a2"}, false},
+		{"since=2024-05-01 AND until=2024-05-10T09:00:00Z", []string{"a2"}, false},
+		{"metadata.host=h1", []string{"a2"}, false},
+		{"role=lead AND group=beta", []string{"a3"}, false},
+		{`user="bob"`, []string{"a2"}, false},
+		{"name=alice", nil, true},
+		{"user alice", nil, true},
+		{"since=forever", nil, true},
+		{"since!=90d", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuery(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for i := range records {
+				if q.Match(&records[i]) {
+					got = append(got, records[i].ID)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery(%q) matches %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryGroups(t *testing.T) {
+	tests := []struct {
+		query  string
+		want   []string
+		wantOK bool
+	}{
+		{"user=alice", nil, false},
+		{"group!=alpha", nil, false},
+		{"group=alpha,beta", []string{"alpha", "beta"}, true},
+		{"group=alpha,beta AND group=beta,gamma", []string{"beta"}, true},
+		{"group=alpha AND group=beta", []string{}, true},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query, time.Now())
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+		}
+		if got, ok := q.Groups(); ok != tt.wantOK || (ok && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("Groups() of %q = %v, %v, want %v, %v", tt.query, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
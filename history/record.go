@@ -0,0 +1,32 @@
+// Package history provides access to the assignment log written by the runner.
+// It defines the log record format and a reader that transparently handles
+// every schema version ever written, so tools don't reimplement log parsing.
+package history
+
+// CurrentSchemaVersion is the schema version written for new log records.
+//
+// Version history:
+//   - 1: timestamp, group, user, strategy, indices and counts (no schema_version field)
+//   - 2: adds schema_version, actor, metadata and availability_check_ms
+//   - 3: adds id
+//   - 4: adds role
+const CurrentSchemaVersion = 4
+
+// Record represents a single assignment entry in the log file.
+// Fields introduced after version 1 are zero-valued when reading older records.
+type Record struct {
+	SchemaVersion       int               `json:"schema_version"`        // Log format version of this record
+	ID                  string            `json:"id,omitempty"`          // Identifier of the assignment, e.g. for acknowledgements (v3)
+	Timestamp           string            `json:"timestamp"`             // Time of the assignment in RFC 3339 format
+	Group               string            `json:"group"`                 // Group the assignment was made for
+	User                string            `json:"user"`                  // Selected assignee
+	Role                string            `json:"role,omitempty"`        // Role the assignee was selected for in a multi-role assignment (v4)
+	Strategy            string            `json:"strategy"`              // Strategy used for the selection
+	LastIndex           int               `json:"last_index"`            // Index of the previous assignee
+	NextIndex           int               `json:"next_index"`            // Index of the selected assignee
+	TotalCount          int               `json:"total_count"`           // Number of users in the group
+	UserCount           int               `json:"user_count"`            // Assignment count of the user after this assignment
+	Actor               string            `json:"actor,omitempty"`       // Who triggered the assignment (v2)
+	Metadata            map[string]string `json:"metadata,omitempty"`    // Free-form context such as host and version (v2)
+	AvailabilityCheckMs int64             `json:"availability_check_ms"` // Time spent checking availability in milliseconds (v2)
+}
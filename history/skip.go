@@ -0,0 +1,50 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SkipRecord is an entry of a group's skips.log, written whenever a user
+// is passed over because they were unavailable.
+type SkipRecord struct {
+	Timestamp    string `json:"timestamp"`               // Time of the skip in RFC 3339 format
+	Group        string `json:"group"`                   // Group the assignment was made for
+	User         string `json:"user"`                    // Skipped user
+	Reason       string `json:"reason"`                  // Why the user was skipped
+	Checker      string `json:"checker,omitempty"`       // Availability checker that reported the user unavailable
+	AssignmentID string `json:"assignment_id,omitempty"` // Assignment made instead, empty when nobody was available
+}
+
+// ReadSkipFile reads all records from the skip log at path.
+// A missing file is treated as an empty log.
+func ReadSkipFile(path string) ([]SkipRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []SkipRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record SkipRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse skip record: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
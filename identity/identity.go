@@ -0,0 +1,189 @@
+// Package identity maps autoassigner usernames to the identifiers the same
+// people have in other systems and back, so availability checkers and
+// integrations share one mapping instead of each keeping its own.
+//
+// Identifiers come from the "identity" section of the configuration and,
+// for people not listed there, from an optional lookup service.
+package identity
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Common kinds of identifiers. Any other kind, such as the identifier of a
+// user in an HR system, can be configured as well.
+const (
+	Username   = "username"   // The name a user has in group files
+	Email      = "email"      // Email address
+	Slack      = "slack"      // Slack member ID
+	GitHub     = "github"     // GitHub login
+	Jira       = "jira"       // Jira accountId
+	Bitbucket  = "bitbucket"  // Bitbucket Cloud account ID or Bitbucket Data Center username
+	Gerrit     = "gerrit"     // Gerrit username or email
+	ServiceNow = "servicenow" // ServiceNow user sys_id
+	Zendesk    = "zendesk"    // Zendesk user ID
+	Linear     = "linear"     // Linear user ID
+	Asana      = "asana"      // Asana user gid
+)
+
+// ErrUnknown is matched by errors for identities that are not mapped.
+var ErrUnknown = errors.New("unknown identity")
+
+// UnknownError is reported when no mapping exists for an identifier.
+type UnknownError struct {
+	Kind  string
+	Value string
+}
+
+func (e *UnknownError) Error() string {
+	return fmt.Sprintf("no identity known for %s %s", e.Kind, e.Value)
+}
+
+func (e *UnknownError) Is(target error) bool { return target == ErrUnknown }
+
+// Lookup returns the identifier of the given kind for a user.
+func Lookup(ctx context.Context, user, kind string) (string, error) {
+	if kind == Username {
+		return user, nil
+	}
+	ids, err := find(ctx, Username, user)
+	if err != nil {
+		return "", err
+	}
+	if id, ok := ids[kind]; ok && id != "" {
+		return id, nil
+	}
+	return "", &UnknownError{Kind: kind, Value: user}
+}
+
+// User returns the username of the person with the given identifier,
+// for example the user a GitHub login belongs to.
+func User(ctx context.Context, kind, id string) (string, error) {
+	if kind == Username {
+		return id, nil
+	}
+	ids, err := find(ctx, kind, id)
+	if err != nil {
+		return "", err
+	}
+	if user := ids[Username]; user != "" {
+		return user, nil
+	}
+	return "", &UnknownError{Kind: kind, Value: id}
+}
+
+// All returns every known identifier of a user keyed by kind, including the username.
+func All(ctx context.Context, user string) (map[string]string, error) {
+	ids, err := find(ctx, Username, user)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]string, len(ids))
+	for kind, id := range ids {
+		all[kind] = id
+	}
+	return all, nil
+}
+
+// Kinds returns the kinds of a set of identifiers in a stable order.
+func Kinds(ids map[string]string) []string {
+	kinds := make([]string, 0, len(ids))
+	for kind := range ids {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// find returns the identifiers of the person whose identifier of the given
+// kind is value, from the configuration or else the lookup service.
+func find(ctx context.Context, kind, value string) (map[string]string, error) {
+	conf := config.Settings.Identity
+	for user, ids := range conf.Users {
+		if (kind == Username && user == value) || (kind != Username && ids[kind] == value) {
+			found := map[string]string{Username: user}
+			for k, id := range ids {
+				found[k] = id
+			}
+			return found, nil
+		}
+	}
+	if conf.LookupURL == "" {
+		if kind == Username {
+			return map[string]string{Username: value}, nil
+		}
+		return nil, &UnknownError{Kind: kind, Value: value}
+	}
+	return lookupService(ctx, conf, kind, value)
+}
+
+// lookupCache holds the answers of the lookup service for the lifetime of the process.
+var lookupCache = struct {
+	sync.Mutex
+	entries map[string]map[string]string
+}{entries: map[string]map[string]string{}}
+
+// lookupService asks the lookup service for the identifiers of a person.
+// The service is called as GET <lookup_url>?<kind>=<value> and answers with a
+// JSON object of identifiers keyed by kind, including the username, or 404.
+func lookupService(ctx context.Context, conf config.IdentityConfig, kind, value string) (map[string]string, error) {
+	key := kind + "=" + value
+	lookupCache.Lock()
+	cached, ok := lookupCache.entries[key]
+	lookupCache.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	u, err := url.Parse(conf.LookupURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity lookup_url: %w", err)
+	}
+	q := u.Query()
+	q.Set(kind, value)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if conf.LookupToken != "" {
+		req.Header.Set("Authorization", "Bearer "+conf.LookupToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("identity lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var ids map[string]string
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&ids); err != nil {
+			return nil, fmt.Errorf("failed to parse identity lookup response: %w", err)
+		}
+	case http.StatusNotFound:
+		if kind != Username {
+			return nil, &UnknownError{Kind: kind, Value: value}
+		}
+		ids = map[string]string{}
+	default:
+		return nil, fmt.Errorf("identity lookup failed: unexpected status %s", resp.Status)
+	}
+	if kind == Username {
+		ids[Username] = value
+	}
+
+	lookupCache.Lock()
+	lookupCache.entries[key] = ids
+	lookupCache.Unlock()
+	return ids, nil
+}
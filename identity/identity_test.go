@@ -0,0 +1,103 @@
+package identity
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	// The lookup service knows dave, who is not configured
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("username") == "dave" || r.URL.Query().Get("github") == "dave-gh" {
+			json.NewEncoder(w).Encode(map[string]string{"username": "dave", "github": "dave-gh", "slack": "U4"})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Identity = config.IdentityConfig{
+		Users: map[string]map[string]string{
+			"alice": {Email: "alice@example.com", GitHub: "alice-gh"},
+			"bob":   {Slack: "U2"},
+		},
+		LookupURL:   server.URL,
+		LookupToken: "token",
+	}
+
+	ctx := context.Background()
+	lookups := []struct {
+		user    string
+		kind    string
+		want    string
+		unknown bool
+	}{
+		{"alice", GitHub, "alice-gh", false},
+		{"alice", Username, "alice", false},
+		{"bob", Email, "", true},
+		{"dave", Slack, "U4", false},
+		{"erin", Slack, "", true},
+	}
+	for _, tt := range lookups {
+		got, err := Lookup(ctx, tt.user, tt.kind)
+		if tt.unknown {
+			if !errors.Is(err, ErrUnknown) {
+				t.Errorf("Lookup(%s, %s) error = %v, want ErrUnknown", tt.user, tt.kind, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Lookup(%s, %s) = %q, %v, want %q", tt.user, tt.kind, got, err, tt.want)
+		}
+	}
+
+	users := []struct {
+		kind    string
+		id      string
+		want    string
+		unknown bool
+	}{
+		{Email, "alice@example.com", "alice", false},
+		{Slack, "U2", "bob", false},
+		{GitHub, "dave-gh", "dave", false},
+		{GitHub, "nobody", "", true},
+	}
+	for _, tt := range users {
+		got, err := User(ctx, tt.kind, tt.id)
+		if tt.unknown {
+			if !errors.Is(err, ErrUnknown) {
+				t.Errorf("User(%s, %s) error = %v, want ErrUnknown", tt.kind, tt.id, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("User(%s, %s) = %q, %v, want %q", tt.kind, tt.id, got, err, tt.want)
+		}
+	}
+
+	before := requests
+	if _, err := Lookup(ctx, "dave", GitHub); err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if requests != before {
+		t.Errorf("lookup service called again for a cached identity")
+	}
+
+	all, err := All(ctx, "alice")
+	if err != nil || len(all) != 3 || all[Username] != "alice" {
+		t.Errorf("All(alice) = %v, %v, want username, email and github", all, err)
+	}
+}
@@ -0,0 +1,241 @@
+// Package inout is a client for the In/Out API, which reports where users
+// are, such as in the office, away or out of office. The availability
+// checker decides availability from the statuses it returns.
+package inout
+
+import (
+	"autoassigner/config"
+	"autoassigner/tracing"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownUser is matched by errors.Is for users the API responds to with 404 Not Found.
+var ErrUnknownUser = errors.New("unknown user")
+
+// UnknownUserError is returned for users the API doesn't know.
+type UnknownUserError struct {
+	User string
+}
+
+func (e *UnknownUserError) Error() string {
+	return fmt.Sprintf("user %s is unknown to the In/Out API (404 Not Found)", e.User)
+}
+
+func (e *UnknownUserError) Is(target error) bool {
+	return target == ErrUnknownUser
+}
+
+// Status is the response for one user: the decoded JSON object, whose shape
+// depends on the deployment of the API.
+type Status map[string]interface{}
+
+// Field walks a dot-separated path through the status, such as
+// "data.presence", and returns the string found at the end of it.
+func (s Status) Field(path string) (string, bool) {
+	parts := strings.Split(path, ".")
+	current := map[string]interface{}(s)
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		current = next
+	}
+	value, ok := current[parts[len(parts)-1]].(string)
+	return value, ok
+}
+
+// BatchRequest is the body posted to the batch endpoint. It responds with
+// an object keyed by username whose values are statuses.
+type BatchRequest struct {
+	Users []string `json:"users"`
+}
+
+// Client calls the In/Out API.
+type Client struct {
+	StatusURL  string                 // Prefix the username is appended to for the status of one user
+	BatchURL   string                 // Endpoint returning the statuses of many users, empty to request them one by one
+	BatchSize  int                    // Most users sent in one batch request, zero without a limit
+	Auth       config.InOutAuthConfig // Credentials and extra headers sent with every request
+	HTTPClient *http.Client           // Client sending the requests, nil to build one from the mTLS settings of Auth
+
+	mu     sync.Mutex
+	client *http.Client // Client built from the mTLS settings of Auth on first use
+}
+
+// NewClient returns a client for the In/Out API as configured in the
+// availability section of the config.
+func NewClient() *Client {
+	conf := config.Settings.Availability
+	return &Client{
+		StatusURL: conf.InOutApiUrlPrefix,
+		BatchURL:  conf.InOutBatchApiUrl,
+		BatchSize: conf.InOutBatchSize,
+		Auth:      conf.InOutAuth,
+	}
+}
+
+// Status returns the status of a user. Users the API doesn't know fail with
+// an UnknownUserError.
+func (c *Client) Status(ctx context.Context, user string) (Status, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.StatusURL+user, nil)
+	if err != nil {
+		return nil, err
+	}
+	var status Status
+	if err := c.do(req, &status); err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, &UnknownUserError{User: user}
+		}
+		return nil, err
+	}
+	return status, nil
+}
+
+// Statuses returns the statuses of users, keyed by username. With a batch
+// endpoint the users are sent in requests of at most BatchSize users each,
+// and users missing from its responses are missing from the result.
+// Otherwise their statuses are requested one by one, failing for unknown users.
+func (c *Client) Statuses(ctx context.Context, users []string) (map[string]Status, error) {
+	statuses := make(map[string]Status, len(users))
+	if c.BatchURL == "" {
+		for _, user := range users {
+			status, err := c.Status(ctx, user)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: %w", user, err)
+			}
+			statuses[user] = status
+		}
+		return statuses, nil
+	}
+
+	for _, page := range pages(users, c.BatchSize) {
+		body, err := json.Marshal(BatchRequest{Users: page})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BatchURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		var result map[string]Status
+		if err := c.do(req, &result); err != nil {
+			return nil, err
+		}
+		for _, user := range page {
+			if status, ok := result[user]; ok {
+				statuses[user] = status
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// pages splits users into slices of at most size users, or returns them
+// as one slice when size isn't positive.
+func pages(users []string, size int) [][]string {
+	if size <= 0 || len(users) <= size {
+		return [][]string{users}
+	}
+	var pages [][]string
+	for len(users) > size {
+		pages = append(pages, users[:size])
+		users = users[size:]
+	}
+	return append(pages, users)
+}
+
+// errNotFound is returned by do for responses with 404 Not Found.
+var errNotFound = errors.New("not found")
+
+// do sends an authenticated request and decodes the JSON response into v.
+func (c *Client) do(req *http.Request, v interface{}) error {
+	client, err := c.httpClient()
+	if err != nil {
+		return err
+	}
+	for name, value := range c.Auth.Headers {
+		req.Header.Set(name, value)
+	}
+	if c.Auth.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Auth.BearerToken)
+	}
+	if c.Auth.Username != "" {
+		req.SetBasicAuth(c.Auth.Username, c.Auth.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("In/Out request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("In/Out request failed: unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode In/Out response: %w", err)
+	}
+	return nil
+}
+
+// httpClient returns the client sending requests. Unless one is set, it
+// uses the client certificates or CA bundle of Auth for mTLS if configured.
+// That client is built once, so its connections are reused by later
+// requests; building it is tried again when it failed.
+func (c *Client) httpClient() (*http.Client, error) {
+	if c.HTTPClient != nil {
+		return c.HTTPClient, nil
+	}
+	auth := c.Auth
+	if auth.ClientCert == "" && auth.CACert == "" {
+		return http.DefaultClient, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if auth.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(auth.ClientCert, auth.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if auth.CACert != "" {
+		pem, err := os.ReadFile(auth.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in %s", auth.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Keep the proxy settings and timeouts of the default transport, which
+	// closes connections once they were idle for a while
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	// Like http.DefaultClient, pass on the IDs of the request being handled
+	c.client = &http.Client{Transport: &tracing.Transport{Base: transport}}
+	return c.client, nil
+}
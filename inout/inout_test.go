@@ -0,0 +1,237 @@
+package inout
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newServer starts a fake In/Out API reporting statuses and records the
+// users of every batch request it receives.
+func newServer(t *testing.T, statuses map[string]string, batches *[][]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Team") != "alpha" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/batch" {
+			var req BatchRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			*batches = append(*batches, req.Users)
+			result := map[string]Status{}
+			for _, user := range req.Users {
+				if status, ok := statuses[user]; ok {
+					result[user] = Status{"data": map[string]interface{}{"presence": status}}
+				}
+			}
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+		user := strings.TrimPrefix(r.URL.Path, "/status/")
+		if user == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		status, ok := statuses[user]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(Status{"data": map[string]interface{}{"presence": status}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientStatus(t *testing.T) {
+	server := newServer(t, map[string]string{"alice": "OFFICE"}, nil)
+	client := &Client{
+		StatusURL: server.URL + "/status/",
+		Auth:      config.InOutAuthConfig{BearerToken: "secret", Headers: map[string]string{"X-Team": "alpha"}},
+	}
+
+	tests := []struct {
+		user        string
+		want        string
+		wantErr     bool
+		wantUnknown bool
+	}{
+		{user: "alice", want: "OFFICE"},
+		{user: "bob", wantErr: true, wantUnknown: true},
+		{user: "broken", wantErr: true},
+	}
+	for _, tt := range tests {
+		status, err := client.Status(context.Background(), tt.user)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Status(%s) error = %v, wantErr %v", tt.user, err, tt.wantErr)
+			continue
+		}
+		if errors.Is(err, ErrUnknownUser) != tt.wantUnknown {
+			t.Errorf("Status(%s) error = %v, wantUnknown %v", tt.user, err, tt.wantUnknown)
+		}
+		if err != nil {
+			continue
+		}
+		if got, _ := status.Field("data.presence"); got != tt.want {
+			t.Errorf("Status(%s) presence = %q, want %q", tt.user, got, tt.want)
+		}
+	}
+
+	client.Auth = config.InOutAuthConfig{}
+	if _, err := client.Status(context.Background(), "alice"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Status() without credentials error = %v, want 401", err)
+	}
+}
+
+func TestClientStatuses(t *testing.T) {
+	statuses := map[string]string{"alice": "OFFICE", "bob": "OOO", "carol": "AWAY"}
+	auth := config.InOutAuthConfig{BearerToken: "secret", Headers: map[string]string{"X-Team": "alpha"}}
+
+	tests := []struct {
+		name        string
+		batch       bool
+		size        int
+		users       []string
+		want        map[string]string
+		wantBatches [][]string
+		wantErr     bool
+	}{
+		{
+			name:        "one batch",
+			batch:       true,
+			users:       []string{"alice", "bob", "dave"},
+			want:        map[string]string{"alice": "OFFICE", "bob": "OOO"},
+			wantBatches: [][]string{{"alice", "bob", "dave"}},
+		},
+		{
+			name:        "pages",
+			batch:       true,
+			size:        2,
+			users:       []string{"alice", "bob", "carol"},
+			want:        map[string]string{"alice": "OFFICE", "bob": "OOO", "carol": "AWAY"},
+			wantBatches: [][]string{{"alice", "bob"}, {"carol"}},
+		},
+		{
+			name:  "one by one",
+			users: []string{"alice", "carol"},
+			want:  map[string]string{"alice": "OFFICE", "carol": "AWAY"},
+		},
+		{
+			name:    "one by one with unknown user",
+			users:   []string{"alice", "dave"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batches [][]string
+			server := newServer(t, statuses, &batches)
+			client := &Client{StatusURL: server.URL + "/status/", BatchSize: tt.size, Auth: auth}
+			if tt.batch {
+				client.BatchURL = server.URL + "/batch"
+			}
+
+			got, err := client.Statuses(context.Background(), tt.users)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Statuses() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			presences := map[string]string{}
+			for user, status := range got {
+				presences[user], _ = status.Field("data.presence")
+			}
+			if !reflect.DeepEqual(presences, tt.want) {
+				t.Errorf("Statuses() = %v, want %v", presences, tt.want)
+			}
+			if !reflect.DeepEqual(batches, tt.wantBatches) {
+				t.Errorf("batch requests = %v, want %v", batches, tt.wantBatches)
+			}
+		})
+	}
+}
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClientTransport(t *testing.T) {
+	var requested string
+	client := &Client{
+		StatusURL: "http://inout.invalid/status/",
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			requested = req.URL.String()
+			rec := httptest.NewRecorder()
+			rec.WriteString(`{"inOutLocation": "AWAY"}`)
+			return rec.Result(), nil
+		})},
+	}
+
+	status, err := client.Status(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if requested != "http://inout.invalid/status/alice" {
+		t.Errorf("requested %s", requested)
+	}
+	if got, ok := status.Field("inOutLocation"); !ok || got != "AWAY" {
+		t.Errorf("Field() = %q, %v", got, ok)
+	}
+	if _, ok := status.Field("data.presence"); ok {
+		t.Error("Field() should report missing fields")
+	}
+}
+
+func TestClientReusesTLSConnections(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"inOutLocation": "OFFICE"}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	client := &Client{StatusURL: server.URL + "/status/", Auth: config.InOutAuthConfig{CACert: caFile}}
+	for i := 0; i < 3; i++ {
+		if _, err := client.Status(context.Background(), "alice"); err != nil {
+			t.Fatalf("Status() error = %v", err)
+		}
+		// The CA bundle is read once, when the first request is sent
+		os.Remove(caFile)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Errorf("requests opened %d connections, want 1", conns)
+	}
+}
@@ -0,0 +1,113 @@
+// Package jira reads the workload of users from Jira: the number of issues a
+// JQL query finds for each of them, such as their unresolved issues, so the
+// open_load strategy balances the real backlog of a team.
+package jira
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultWorkloadJQL is the query counting the workload of a user when
+// jira.workload_jql is empty. {user} is replaced by the quoted user.
+const DefaultWorkloadJQL = "assignee = {user} AND statusCategory != Done"
+
+// WorkloadProvider counts the issues of users in Jira with the query of
+// jira.workload_jql.
+type WorkloadProvider struct{}
+
+// Workload returns the number of issues found for each of users. Users are
+// found by the jira identifiers of the identity mapping, their accountId on
+// Jira Cloud; other usernames are taken to be Jira usernames.
+func (p *WorkloadProvider) Workload(ctx context.Context, group string, users []string) (map[string]int, error) {
+	workload := make(map[string]int, len(users))
+	for _, user := range users {
+		n, err := UserWorkload(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		workload[user] = n
+	}
+	return workload, nil
+}
+
+// UserWorkload returns the number of issues jira.workload_jql finds for user.
+func UserWorkload(ctx context.Context, user string) (int, error) {
+	id, err := identity.Lookup(ctx, user, identity.Jira)
+	if errors.Is(err, identity.ErrUnknown) {
+		id = user
+	} else if err != nil {
+		return 0, err
+	}
+	jql := config.Settings.Jira.WorkloadJQL
+	if jql == "" {
+		jql = DefaultWorkloadJQL
+	}
+	return CountIssues(ctx, WorkloadQuery(jql, id))
+}
+
+// WorkloadQuery replaces {user} in jql by the quoted Jira user.
+func WorkloadQuery(jql, user string) string {
+	quoted := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(user) + `"`
+	return strings.ReplaceAll(jql, "{user}", quoted)
+}
+
+// CountIssues returns the number of issues found by jql, using a search that
+// returns no issues but their total.
+func CountIssues(ctx context.Context, jql string) (int, error) {
+	conf := config.Settings.Jira
+	if conf.Url == "" {
+		return 0, fmt.Errorf("url is required in jira configuration")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"jql": jql, "maxResults": 0, "fields": []string{}})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(conf.Url, "/")+"/rest/api/2/search", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case conf.Token != "":
+		req.Header.Set("Authorization", "Bearer "+conf.Token)
+	case conf.ApiToken != "":
+		req.SetBasicAuth(conf.Email, conf.ApiToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("Jira request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Errors are {"errorMessages": ["..."], "errors": {}}
+		var apiErr struct {
+			ErrorMessages []string `json:"errorMessages"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if len(apiErr.ErrorMessages) > 0 {
+			return 0, fmt.Errorf("Jira request failed: %s: %s", resp.Status, strings.Join(apiErr.ErrorMessages, "; "))
+		}
+		return 0, fmt.Errorf("Jira request failed: unexpected status %s", resp.Status)
+	}
+	var result struct {
+		Total *int `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("invalid response from Jira: %w", err)
+	}
+	if result.Total == nil {
+		return 0, fmt.Errorf("invalid response from Jira: no total")
+	}
+	return *result.Total, nil
+}
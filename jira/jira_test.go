@@ -0,0 +1,77 @@
+package jira
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWorkloadQuery(t *testing.T) {
+	tests := []struct {
+		jql, user, want string
+	}{
+		{DefaultWorkloadJQL, "5b10a2844c20165700ede21g", `assignee = "5b10a2844c20165700ede21g" AND statusCategory != Done`},
+		{"project = OPS AND assignee = {user}", `o"brien\`, `project = OPS AND assignee = "o\"brien\\"`},
+		{"assignee in ({user})", "alice", `assignee in ("alice")`},
+	}
+	for _, tt := range tests {
+		if got := WorkloadQuery(tt.jql, tt.user); got != tt.want {
+			t.Errorf("WorkloadQuery(%q, %q) = %q, want %q", tt.jql, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestWorkloadProvider(t *testing.T) {
+	totals := map[string]int{`assignee = "acc-alice" AND statusCategory != Done`: 3, `assignee = "bob" AND statusCategory != Done`: 0}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/search" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if user, password, _ := r.BasicAuth(); user != "bot@example.com" || password != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var search struct {
+			JQL        string `json:"jql"`
+			MaxResults int    `json:"maxResults"`
+		}
+		json.NewDecoder(r.Body).Decode(&search)
+		total, ok := totals[search.JQL]
+		if !ok || search.MaxResults != 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorMessages": ["The value 'carol' does not exist for the field 'assignee'."], "errors": {}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"startAt": 0, "maxResults": 0, "total": total, "issues": []string{}})
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Jira = config.JiraConfig{Url: server.URL + "/", Email: "bot@example.com", ApiToken: "token"}
+	config.Settings.Identity = config.IdentityConfig{Users: map[string]map[string]string{"alice": {"jira": "acc-alice"}}}
+
+	ctx := context.Background()
+	got, err := (&WorkloadProvider{}).Workload(ctx, "support", []string{"alice", "bob"})
+	if want := map[string]int{"alice": 3, "bob": 0}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Workload() = %v, %v, want %v", got, err, want)
+	}
+	if _, err := (&WorkloadProvider{}).Workload(ctx, "support", []string{"alice", "carol"}); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Workload() with an unknown user error = %v, want the Jira error message", err)
+	}
+
+	config.Settings.Jira.ApiToken = "wrong"
+	if _, err := UserWorkload(ctx, "alice"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("UserWorkload() with a wrong token error = %v, want 401", err)
+	}
+	config.Settings.Jira.Url = ""
+	if _, err := CountIssues(ctx, "assignee = bob"); err == nil {
+		t.Errorf("CountIssues() without a url succeeded, want an error")
+	}
+}
@@ -0,0 +1,211 @@
+// Package kafka produces and consumes Kafka records through a Confluent
+// REST Proxy (API v2), so Kafka can be used without a client library or
+// access to the brokers' protocol.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Content types of the REST Proxy API v2.
+const (
+	contentTypeJSON   = "application/vnd.kafka.json.v2+json"
+	contentTypeBinary = "application/vnd.kafka.binary.v2+json"
+	contentTypeV2     = "application/vnd.kafka.v2+json"
+)
+
+// Client sends requests to a REST Proxy.
+type Client struct {
+	URL     string            // Base URL of the REST Proxy, e.g. https://kafka-rest.example.com:8082
+	Headers map[string]string // Headers sent with every request, such as Authorization
+}
+
+// Message is a record to produce.
+type Message struct {
+	Key   string      // Key of the record, which selects its partition; no key when empty
+	Value interface{} // Value of the record, encoded as JSON
+}
+
+// Produce appends messages to topic.
+func (c *Client) Produce(ctx context.Context, topic string, messages ...Message) error {
+	type record struct {
+		Key   *string     `json:"key,omitempty"`
+		Value interface{} `json:"value"`
+	}
+	var body struct {
+		Records []record `json:"records"`
+	}
+	for _, m := range messages {
+		r := record{Value: m.Value}
+		if m.Key != "" {
+			key := m.Key
+			r.Key = &key
+		}
+		body.Records = append(body.Records, r)
+	}
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.url("/topics/"+url.PathEscape(topic)), contentTypeJSON, body, &result); err != nil {
+		return err
+	}
+	// Records are produced one by one, so some may fail while the request succeeds
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil || offset.Error != "" {
+			return fmt.Errorf("failed to produce record to %s: %s", topic, offset.Error)
+		}
+	}
+	return nil
+}
+
+// Record is a record consumed from a topic.
+type Record struct {
+	Topic     string
+	Key       []byte
+	Value     []byte
+	Partition int
+	Offset    int64
+}
+
+// Consumer is a consumer instance of the REST Proxy, which belongs to a
+// consumer group and polls the topics it subscribed to. Offsets are only
+// committed by Commit.
+type Consumer struct {
+	client  *Client
+	baseURI string // URL of the instance
+}
+
+// NewConsumer creates a consumer instance in group subscribed to topics. A
+// group without committed offsets starts with the records produced after
+// it subscribed.
+func (c *Client) NewConsumer(ctx context.Context, group string, topics ...string) (*Consumer, error) {
+	// Binary records let values that aren't JSON be read and reported
+	// instead of failing every poll
+	create := map[string]string{"format": "binary", "auto.offset.reset": "latest", "auto.commit.enable": "false"}
+	var instance struct {
+		BaseURI string `json:"base_uri"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.url("/consumers/"+url.PathEscape(group)), contentTypeV2, create, &instance); err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+	consumer := &Consumer{client: c, baseURI: instance.BaseURI}
+	subscription := map[string][]string{"topics": topics}
+	if err := c.do(ctx, http.MethodPost, consumer.baseURI+"/subscription", contentTypeV2, subscription, nil); err != nil {
+		consumer.Close(ctx)
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", strings.Join(topics, ", "), err)
+	}
+	return consumer, nil
+}
+
+// Poll returns the records received within timeout, which may be none.
+func (c *Consumer) Poll(ctx context.Context, timeout time.Duration) ([]Record, error) {
+	var records []struct {
+		Topic     string `json:"topic"`
+		Key       []byte `json:"key"` // Base64 in binary format
+		Value     []byte `json:"value"`
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+	}
+	uri := fmt.Sprintf("%s/records?timeout=%d", c.baseURI, timeout.Milliseconds())
+	if err := c.client.do(ctx, http.MethodGet, uri, contentTypeBinary, nil, &records); err != nil {
+		return nil, err
+	}
+	result := make([]Record, len(records))
+	for i, r := range records {
+		result[i] = Record{Topic: r.Topic, Key: r.Key, Value: r.Value, Partition: r.Partition, Offset: r.Offset}
+	}
+	return result, nil
+}
+
+// Commit commits the offsets of records, which were handled.
+func (c *Consumer) Commit(ctx context.Context, records ...Record) error {
+	type offset struct {
+		Topic     string `json:"topic"`
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"` // Of the last handled record; the proxy commits the next one
+	}
+	var body struct {
+		Offsets []offset `json:"offsets"`
+	}
+	for _, r := range records {
+		body.Offsets = append(body.Offsets, offset{Topic: r.Topic, Partition: r.Partition, Offset: r.Offset})
+	}
+	if len(body.Offsets) == 0 {
+		return nil
+	}
+	return c.client.do(ctx, http.MethodPost, c.baseURI+"/offsets", contentTypeV2, body, nil)
+}
+
+// Close deletes the consumer instance, so its partitions are reassigned to
+// the other members of its group right away.
+func (c *Consumer) Close(ctx context.Context) error {
+	return c.client.do(ctx, http.MethodDelete, c.baseURI, contentTypeV2, nil, nil)
+}
+
+func (c *Client) url(path string) string {
+	return strings.TrimSuffix(c.URL, "/") + path
+}
+
+// do sends a request with body encoded as JSON, unless nil, and decodes
+// the response into result, unless nil. contentType is the content type of
+// the body or, without one, the type accepted.
+func (c *Client) do(ctx context.Context, method, uri, contentType string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", contentTypeV2)
+	} else {
+		req.Header.Set("Accept", contentType)
+	}
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		// Errors of the REST Proxy carry a message
+		var proxyErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &proxyErr) == nil && proxyErr.Message != "" {
+			return fmt.Errorf("unexpected status %s: %s", resp.Status, proxyErr.Message)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("invalid response from REST Proxy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProduce(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		wantErr  string
+	}{
+		{"produced", http.StatusOK, `{"offsets": [{"partition": 0, "offset": 7}, {"partition": 1, "offset": 3}]}`, ""},
+		{"record failed", http.StatusOK, `{"offsets": [{"partition": 0, "offset": 7}, {"error_code": 50003, "error": "Leader not available"}]}`, "Leader not available"},
+		{"proxy error", http.StatusNotFound, `{"error_code": 40403, "message": "Topic not found"}`, "Topic not found"},
+		{"plain error", http.StatusBadGateway, `<html>Bad Gateway</html>`, "502 Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/topics/assignments" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" || r.Header.Get("Authorization") != "Basic abc" {
+					t.Errorf("request = %s %s %v", r.Method, r.URL.Path, r.Header)
+				}
+				var decoded interface{}
+				json.NewDecoder(r.Body).Decode(&decoded)
+				data, _ := json.Marshal(decoded)
+				body = string(data)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer proxy.Close()
+
+			client := &Client{URL: proxy.URL + "/", Headers: map[string]string{"Authorization": "Basic abc"}}
+			err := client.Produce(context.Background(), "assignments",
+				Message{Key: "01HX", Value: map[string]string{"user": "alice"}}, Message{Value: "unkeyed"})
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Produce() error = %v, want %q", err, tt.wantErr)
+			}
+			if want := `{"records":[{"key":"01HX","value":{"user":"alice"}},{"value":"unkeyed"}]}`; body != want {
+				t.Errorf("request body = %s, want %s", body, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Package kube is a minimal client of the Kubernetes API for the operator:
+// it lists and watches custom resources and updates their status, which is
+// all the operator needs without client-go.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// serviceAccountDir holds the token, CA and namespace of the pod's service
+// account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// ErrGone is matched by the StatusError of a watch whose resource version is
+// too old, after which the resources must be listed again.
+var ErrGone = errors.New("resource version expired")
+
+// Client sends requests to the API server.
+type Client struct {
+	URL       string       // Base URL of the API server, e.g. https://10.0.0.1:443 or http://localhost:8001 for kubectl proxy
+	TokenFile string       // File with the bearer token, read for every request since service account tokens are rotated; empty sends no token
+	HTTP      *http.Client // Client to send requests with; http.DefaultClient when nil
+}
+
+// InCluster returns a client of the API server of the cluster the process
+// runs in, authenticated as the pod's service account, and the namespace of
+// the pod.
+func InCluster() (*Client, string, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, "", fmt.Errorf("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set; not running in a cluster")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, "", fmt.Errorf("no certificates found in service account CA")
+	}
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read service account namespace: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &Client{
+		URL:       "https://" + net.JoinHostPort(host, port),
+		TokenFile: filepath.Join(serviceAccountDir, "token"),
+		HTTP:      &http.Client{Transport: transport},
+	}, strings.TrimSpace(string(namespace)), nil
+}
+
+// Path returns the API path of the resources of a namespace, or of one of
+// them when name is given.
+func Path(group, version, namespace, resource, name string) string {
+	path := "/apis/" + group + "/" + version + "/namespaces/" + url.PathEscape(namespace) + "/" + resource
+	if name != "" {
+		path += "/" + url.PathEscape(name)
+	}
+	return path
+}
+
+// ObjectMeta holds the metadata of a resource the operator uses.
+type ObjectMeta struct {
+	Name              string `json:"name"`
+	Namespace         string `json:"namespace"`
+	UID               string `json:"uid"`
+	ResourceVersion   string `json:"resourceVersion"`
+	Generation        int64  `json:"generation"`
+	DeletionTimestamp string `json:"deletionTimestamp,omitempty"`
+}
+
+// List is a list of resources.
+type List struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// Event is a change of a watched resource: ADDED, MODIFIED or DELETED,
+// with the resource, or BOOKMARK, with only its resource version.
+type Event struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// StatusError is an error response of the API server.
+type StatusError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("kubernetes API responded with %d %s", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("kubernetes API responded with %d: %s", e.Code, e.Message)
+}
+
+func (e *StatusError) Is(target error) bool { return target == ErrGone && e.Code == http.StatusGone }
+
+// List returns the resources at path.
+func (c *Client) List(ctx context.Context, path string) (*List, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list List
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid list of %s: %w", path, err)
+	}
+	return &list, nil
+}
+
+// Watch calls handle for every change of the resources at path after
+// resourceVersion, until the API server ends the watch, ctx is done or
+// handle fails. A watch from an expired resource version fails with an
+// error matching ErrGone.
+func (c *Client) Watch(ctx context.Context, path, resourceVersion string, handle func(Event) error) error {
+	query := url.Values{"watch": {"1"}, "resourceVersion": {resourceVersion}, "allowWatchBookmarks": {"true"}}
+	resp, err := c.do(ctx, http.MethodGet, path+"?"+query.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("watch of %s failed: %w", path, err)
+		}
+		if event.Type == "ERROR" {
+			statusErr := &StatusError{}
+			json.Unmarshal(event.Object, statusErr)
+			return statusErr
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
+
+// PatchStatus replaces the status of the resource at path with status.
+// Unlike a merge patch, this also drops keys that status no longer has.
+func (c *Client) PatchStatus(ctx context.Context, path string, status interface{}) error {
+	data, err := json.Marshal([]map[string]interface{}{{"op": "add", "path": "/status", "value": status}})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPatch, path+"/status", "application/json-patch+json", data)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends a request and returns the response when it succeeded.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.TokenFile != "" {
+		token, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach kubernetes API: %w", err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	statusErr := &StatusError{}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	json.Unmarshal(data, statusErr)
+	statusErr.Code = resp.StatusCode
+	return nil, statusErr
+}
@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("t1\n"), 0600); err != nil {
+		t.Fatalf("failed to write token: %v", err)
+	}
+	path := Path("autoassigner.io", "v1alpha1", "teams", "assignments", "")
+	var patch string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"kind": "Status", "code": 401, "message": "Unauthorized"}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("watch") == "1" && r.URL.Query().Get("resourceVersion") == "10":
+			w.Write([]byte(`{"type": "ADDED", "object": {"metadata": {"name": "a"}}}
+{"type": "BOOKMARK", "object": {"metadata": {"resourceVersion": "12"}}}
+{"type": "ERROR", "object": {"kind": "Status", "code": 410, "reason": "Expired", "message": "too old resource version: 10 (12)"}}
+`))
+		case r.Method == http.MethodGet && r.URL.Query().Get("watch") == "1":
+			w.Write([]byte(`{"type": "DELETED", "object": {"metadata": {"name": "a"}}}`))
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"metadata": {"resourceVersion": "10"}, "items": [{"metadata": {"name": "a"}}]}`))
+		case r.Method == http.MethodPatch && r.URL.Path == path+"/a/status" && r.Header.Get("Content-Type") == "application/json-patch+json":
+			body, _ := io.ReadAll(r.Body)
+			patch = string(body)
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+	client := &Client{URL: api.URL, TokenFile: tokenFile}
+	ctx := context.Background()
+
+	list, err := client.List(ctx, path)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if list.Metadata.ResourceVersion != "10" || len(list.Items) != 1 {
+		t.Errorf("List() = %+v, want one item at resource version 10", list)
+	}
+
+	var events []string
+	record := func(event Event) error {
+		events = append(events, event.Type)
+		return nil
+	}
+	if err := client.Watch(ctx, path, "10", record); !errors.Is(err, ErrGone) {
+		t.Errorf("Watch() error = %v, want ErrGone", err)
+	}
+	if err := client.Watch(ctx, path, "12", record); err != nil {
+		t.Errorf("Watch() of a watch ended by the server error = %v", err)
+	}
+	if want := []string{"ADDED", "BOOKMARK", "DELETED"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	if err := client.PatchStatus(ctx, path+"/a", map[string]string{"phase": "Assigned"}); err != nil {
+		t.Fatalf("PatchStatus() error = %v", err)
+	}
+	if want := `[{"op":"add","path":"/status","value":{"phase":"Assigned"}}]`; patch != want {
+		t.Errorf("patch = %s, want %s", patch, want)
+	}
+
+	// Rotated tokens are picked up
+	os.WriteFile(tokenFile, []byte("t2"), 0600)
+	var statusErr *StatusError
+	if _, err := client.List(ctx, path); !errors.As(err, &statusErr) || statusErr.Code != http.StatusUnauthorized || statusErr.Message != "Unauthorized" {
+		t.Errorf("List() with a rotated token error = %v, want 401 from the server", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package l10n localizes user-facing CLI output.
+// Message catalogs live in catalogs/ and are embedded in the binary;
+// English is the source language and the fallback for missing translations.
+package l10n
+
+import (
+	"embed"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+//go:embed catalogs/active.*.json
+var catalogs embed.FS
+
+var (
+	bundle    *i18n.Bundle
+	localizer *i18n.Localizer
+	mu        sync.RWMutex
+)
+
+func init() {
+	bundle = i18n.NewBundle(language.English)
+	bundle.RegisterUnmarshalFunc("json", json.Unmarshal)
+
+	entries, err := catalogs.ReadDir("catalogs")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		if _, err := bundle.LoadMessageFileFS(catalogs, "catalogs/"+entry.Name()); err != nil {
+			panic(err)
+		}
+	}
+	SetLanguage(EnvLanguage())
+}
+
+// SetLanguage selects the language used by T. Languages are given in order
+// of preference as BCP 47 tags such as "de" or "pt-BR"; unknown languages
+// fall back to English.
+func SetLanguage(langs ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	localizer = i18n.NewLocalizer(bundle, langs...)
+}
+
+// EnvLanguage returns the preferred language from AUTOASSIGNER_LANG, LC_ALL,
+// LC_MESSAGES or LANG, converting POSIX locales like "de_DE.UTF-8" to "de-DE".
+func EnvLanguage() string {
+	for _, name := range []string{"AUTOASSIGNER_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" || value == "C" || value == "POSIX" {
+			continue
+		}
+		value = strings.SplitN(value, ".", 2)[0]
+		return strings.ReplaceAll(value, "_", "-")
+	}
+	return ""
+}
+
+// T returns the message translated into the selected language, with the
+// template fields replaced by data. Pairs of key and value may be passed:
+//
+//	l10n.T(l10n.MsgCountsHeader, "Group", group)
+func T(msg *i18n.Message, data ...interface{}) string {
+	fields := make(map[string]interface{}, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if key, ok := data[i].(string); ok {
+			fields[key] = data[i+1]
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	text, err := localizer.Localize(&i18n.LocalizeConfig{DefaultMessage: msg, TemplateData: fields})
+	if err != nil && text == "" {
+		// Fall back to the untranslated source text
+		text, _ = i18n.NewLocalizer(bundle).Localize(&i18n.LocalizeConfig{DefaultMessage: msg, TemplateData: fields})
+	}
+	return text
+}
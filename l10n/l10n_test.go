@@ -0,0 +1,50 @@
+package l10n
+
+import "testing"
+
+func TestT(t *testing.T) {
+	defer SetLanguage("en")
+
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"en", "Assignment counts for group alpha:"},
+		{"de", "Zuweisungszähler für Gruppe alpha:"},
+		{"es-MX", "Recuento de asignaciones del grupo alpha:"},
+		{"fr", "Assignment counts for group alpha:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			SetLanguage(tt.lang)
+			if got := T(MsgCountsHeader, "Group", "alpha"); got != tt.want {
+				t.Errorf("T() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"nothing set", map[string]string{}, ""},
+		{"posix locale", map[string]string{"LANG": "de_DE.UTF-8"}, "de-DE"},
+		{"C locale ignored", map[string]string{"LC_ALL": "C", "LANG": "es_ES"}, "es-ES"},
+		{"explicit override", map[string]string{"AUTOASSIGNER_LANG": "es", "LANG": "de_DE"}, "es"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"AUTOASSIGNER_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+				t.Setenv(name, tt.env[name])
+			}
+			if got := EnvLanguage(); got != tt.want {
+				t.Errorf("EnvLanguage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
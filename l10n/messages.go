@@ -0,0 +1,281 @@
+package l10n
+
+import "github.com/nicksnyder/go-i18n/v2/i18n"
+
+// Messages shown to users. The English text here is the source for
+// catalogs/active.en.json; run `make i18n-extract` after changing it.
+var (
+	MsgAssigned = &i18n.Message{
+		ID:          "Assigned",
+		Description: "Announcement of the selected assignee, often pasted into chat",
+		Other:       "{{.User}}",
+	}
+	MsgDryRunAssigned = &i18n.Message{
+		ID:          "DryRunAssigned",
+		Description: "Announcement of the assignee a dry run would select",
+		Other:       "[DRY RUN] Would assign to: {{.User}}",
+	}
+	MsgCountsHeader = &i18n.Message{
+		ID:    "CountsHeader",
+		Other: "Assignment counts for group {{.Group}}:",
+	}
+	MsgCountsReset = &i18n.Message{
+		ID:    "CountsReset",
+		Other: "Successfully reset assignment counts for group {{.Group}}",
+	}
+	MsgAvailableGroups = &i18n.Message{
+		ID:    "AvailableGroups",
+		Other: "Available groups:",
+	}
+	MsgNoGroups = &i18n.Message{
+		ID:    "NoGroups",
+		Other: "No groups found in config directory",
+	}
+	MsgListGroupsHint = &i18n.Message{
+		ID:    "ListGroupsHint",
+		Other: "Use --list-groups to see available groups",
+	}
+	MsgErrorPrefix = &i18n.Message{
+		ID:          "ErrorPrefix",
+		Description: "Prefix of every error printed by the CLI",
+		Other:       "Error: {{.Error}}",
+	}
+	MsgConfigError = &i18n.Message{
+		ID:    "ConfigError",
+		Other: "configuration error: {{.Error}}",
+	}
+	MsgSelectionError = &i18n.Message{
+		ID:    "SelectionError",
+		Other: "selection error: {{.Error}}",
+	}
+	MsgAvailabilityError = &i18n.Message{
+		ID:    "AvailabilityError",
+		Other: "availability error: {{.Error}}",
+	}
+	MsgNoAvailableAssignee = &i18n.Message{
+		ID:    "NoAvailableAssignee",
+		Other: "no available assignee: {{.Error}}",
+	}
+	MsgUnexpectedError = &i18n.Message{
+		ID:    "UnexpectedError",
+		Other: "unexpected error: {{.Error}}",
+	}
+	MsgDeclineRecorded = &i18n.Message{
+		ID:    "DeclineRecorded",
+		Other: "Recorded decline by {{.User}} in group {{.Group}}",
+	}
+	MsgDeclineBudgetStatus = &i18n.Message{
+		ID:          "DeclineBudgetStatus",
+		Description: "Period is one of the untranslated words day, week or month",
+		Other:       "{{.Used}} of {{.Max}} declines used this {{.Period}}",
+	}
+	MsgDeclinesHeader = &i18n.Message{
+		ID:    "DeclinesHeader",
+		Other: "Declines this {{.Period}} (budget {{.Max}}):",
+	}
+	MsgDeclineBudgetError = &i18n.Message{
+		ID:    "DeclineBudgetError",
+		Other: "decline rejected: {{.Error}}",
+	}
+	MsgDeferred = &i18n.Message{
+		ID:    "Deferred",
+		Other: "Quiet hours for group {{.Group}}: assignment queued until {{.Time}}",
+	}
+	MsgQueueEmpty = &i18n.Message{
+		ID:    "QueueEmpty",
+		Other: "No queued assignments",
+	}
+	MsgQueueFlushed = &i18n.Message{
+		ID:    "QueueFlushed",
+		Other: "Flushed {{.Done}} queued assignments, {{.Failed}} failed",
+	}
+	MsgNoOpenAssignments = &i18n.Message{
+		ID:    "NoOpenAssignments",
+		Other: "No open assignments for group {{.Group}}",
+	}
+	MsgAcknowledged = &i18n.Message{
+		ID:    "Acknowledged",
+		Other: "Assignment {{.ID}} acknowledged by {{.User}}",
+	}
+	MsgClosed = &i18n.Message{
+		ID:    "Closed",
+		Other: "Closed assignment {{.ID}} of {{.User}}",
+	}
+	MsgConfirmArchive = &i18n.Message{
+		ID:    "ConfirmArchive",
+		Other: "Archive group {{.Group}} and its data? [y/N] ",
+	}
+	MsgConfirmDelete = &i18n.Message{
+		ID:    "ConfirmDelete",
+		Other: "Delete the config of group {{.Group}}? [y/N] ",
+	}
+	MsgConfirmPurge = &i18n.Message{
+		ID:    "ConfirmPurge",
+		Other: "Delete group {{.Group}} and all of its data? [y/N] ",
+	}
+	MsgAborted = &i18n.Message{
+		ID:    "Aborted",
+		Other: "Aborted",
+	}
+	MsgGroupArchived = &i18n.Message{
+		ID:    "GroupArchived",
+		Other: "Archived group {{.Group}} to {{.Dir}}",
+	}
+	MsgGroupDeleted = &i18n.Message{
+		ID:    "GroupDeleted",
+		Other: "Deleted group {{.Group}}",
+	}
+	MsgGroupRenamed = &i18n.Message{
+		ID:    "GroupRenamed",
+		Other: "Renamed group {{.Group}} to {{.NewGroup}}",
+	}
+	MsgUserRenamed = &i18n.Message{
+		ID:    "UserRenamed",
+		Other: "Renamed user {{.User}} to {{.NewUser}} in group {{.Group}}",
+	}
+	MsgUserAnonymized = &i18n.Message{
+		ID:    "UserAnonymized",
+		Other: "Replaced {{.User}} with {{.Pseudonym}} in {{.Records}} records of {{.Groups}} groups",
+	}
+	MsgUserAnonymizeDryRun = &i18n.Message{
+		ID:    "UserAnonymizeDryRun",
+		Other: "Found {{.Records}} records of {{.User}} in {{.Groups}} groups, nothing was changed",
+	}
+	MsgNoRoute = &i18n.Message{
+		ID:    "NoRoute",
+		Other: "No route matches {{.Change}}, nothing to assign",
+	}
+	MsgReviewRequested = &i18n.Message{
+		ID:    "ReviewRequested",
+		Other: "Requested a review of {{.Change}} from {{.Login}}",
+	}
+	MsgAssigneeAdded = &i18n.Message{
+		ID:    "AssigneeAdded",
+		Other: "Assigned {{.Login}} to {{.Change}}",
+	}
+	MsgNoCodeOwners = &i18n.Message{
+		ID:    "NoCodeOwners",
+		Other: "No code owner of {{.Change}} is a member of {{.Group}}, assigning from the whole group",
+	}
+	MsgCallbackError = &i18n.Message{
+		ID:    "CallbackError",
+		Other: "callback error: {{.Error}}",
+	}
+	MsgReserved = &i18n.Message{
+		ID:    "Reserved",
+		Other: "Reserved {{.User}} as {{.ID}} until {{.Time}}",
+	}
+	MsgReservationDeferred = &i18n.Message{
+		ID:    "ReservationDeferred",
+		Other: "Quiet hours for group {{.Group}} until {{.Time}}, nobody was reserved",
+	}
+	MsgReservationReleased = &i18n.Message{
+		ID:    "ReservationReleased",
+		Other: "Released reservation {{.ID}} of {{.User}}",
+	}
+	MsgNoReservations = &i18n.Message{
+		ID:    "NoReservations",
+		Other: "No active reservations in group {{.Group}}",
+	}
+	MsgAssignedRole = &i18n.Message{
+		ID:          "AssignedRole",
+		Description: "Announcement of a user selected for a role, one line per selection",
+		Other:       "{{.Role}}: {{.User}}",
+	}
+	MsgDryRunAssignedRole = &i18n.Message{
+		ID:    "DryRunAssignedRole",
+		Other: "[DRY RUN] Would assign as {{.Role}}: {{.User}}",
+	}
+	MsgRolesDeferred = &i18n.Message{
+		ID:    "RolesDeferred",
+		Other: "Quiet hours for group {{.Group}} until {{.Time}}, nobody was assigned",
+	}
+	MsgAssignmentID = &i18n.Message{
+		ID:    "AssignmentID",
+		Other: "Assignment ID: {{.ID}}",
+	}
+	MsgLockDisabled = &i18n.Message{
+		ID:    "LockDisabled",
+		Other: "No lock is configured; assignments of group {{.Group}} are not serialized across hosts",
+	}
+	MsgLockSettings = &i18n.Message{
+		ID:    "LockSettings",
+		Other: "Lock backend {{.Backend}}: locks expire after {{.TTL}}, held locks are waited for up to {{.Wait}}",
+	}
+	MsgLockFree = &i18n.Message{
+		ID:    "LockFree",
+		Other: "Group {{.Group}} is not locked",
+	}
+	MsgLockHeld = &i18n.Message{
+		ID:    "LockHeld",
+		Other: "Group {{.Group}} is locked by {{.Holder}}, expiring in {{.Time}}",
+	}
+	MsgGroupEnabled = &i18n.Message{
+		ID:    "GroupEnabled",
+		Other: "Enabled group {{.Group}}",
+	}
+	MsgGroupDisabled = &i18n.Message{
+		ID:    "GroupDisabled",
+		Other: "Disabled group {{.Group}}; assignments are rejected until it is enabled again",
+	}
+	MsgGroupDisabledError = &i18n.Message{
+		ID:    "GroupDisabledError",
+		Other: "{{.Error}}; enable it with \"autoassigner group enable\" or pass --ignore-disabled",
+	}
+	MsgGroupDisabledSkipped = &i18n.Message{
+		ID:    "GroupDisabledSkipped",
+		Other: "Group {{.Group}} is disabled, nobody was assigned",
+	}
+	MsgGroupCreated = &i18n.Message{
+		ID:    "GroupCreated",
+		Other: "Created group {{.Group}}",
+	}
+	MsgGroupUpdated = &i18n.Message{
+		ID:    "GroupUpdated",
+		Other: "Updated group {{.Group}}",
+	}
+	MsgGroupUsers = &i18n.Message{
+		ID:    "GroupUsers",
+		Other: "Users of group {{.Group}}: {{.Users}}",
+	}
+	MsgNoMatchingAssignments = &i18n.Message{
+		ID:    "NoMatchingAssignments",
+		Other: "No assignments match the query",
+	}
+	MsgUserPauseScheduled = &i18n.Message{
+		ID:    "UserPauseScheduled",
+		Other: "Paused {{.User}} from {{.From}} until {{.Time}}",
+	}
+	MsgUserPaused = &i18n.Message{
+		ID:    "UserPaused",
+		Other: "Paused {{.User}} until {{.Time}}",
+	}
+	MsgUserResumed = &i18n.Message{
+		ID:    "UserResumed",
+		Other: "Resumed {{.User}}",
+	}
+	MsgUserNotPaused = &i18n.Message{
+		ID:    "UserNotPaused",
+		Other: "{{.User}} is not paused",
+	}
+	MsgNoPauses = &i18n.Message{
+		ID:    "NoPauses",
+		Other: "No paused users",
+	}
+	MsgCountsTotalHeader = &i18n.Message{
+		ID:    "CountsTotalHeader",
+		Other: "Assignment counts across {{.Count}} groups:",
+	}
+	MsgGroupsAssigned = &i18n.Message{
+		ID:    "GroupsAssigned",
+		Other: "Assigned in {{.Assigned}} of {{.Count}} groups matching {{.Pattern}}",
+	}
+	MsgGroupHeader = &i18n.Message{
+		ID:    "GroupHeader",
+		Other: "Group {{.Group}}:",
+	}
+	MsgCursorSet = &i18n.Message{
+		ID:    "CursorSet",
+		Other: "{{.User}} is next in turn in group {{.Group}}",
+	}
+)
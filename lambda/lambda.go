@@ -0,0 +1,134 @@
+// Package lambda runs a handler as an AWS Lambda function on a custom
+// runtime (provided.al2023), talking to the Lambda Runtime API directly
+// rather than through the aws-lambda-go library.
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Handler handles the event of an invocation. Its result is encoded as the
+// JSON response of the invocation; an error fails the invocation.
+type Handler func(ctx context.Context, event json.RawMessage) (interface{}, error)
+
+// apiVersion prefixes the paths of the Runtime API.
+const apiVersion = "/2018-06-01/runtime"
+
+// runtimeAPI returns the base URL of the Runtime API, which Lambda sets in
+// AWS_LAMBDA_RUNTIME_API.
+func runtimeAPI() (string, error) {
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if api == "" {
+		return "", fmt.Errorf("AWS_LAMBDA_RUNTIME_API is not set; not running in AWS Lambda")
+	}
+	return "http://" + api + apiVersion, nil
+}
+
+// Start handles invocations with handler until ctx is done or the Runtime
+// API fails, which ends the execution environment.
+func Start(ctx context.Context, handler Handler) error {
+	api, err := runtimeAPI()
+	if err != nil {
+		return err
+	}
+	for {
+		if err := invoke(ctx, api, handler); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// invoke waits for the next invocation, handles it and reports its result.
+func invoke(ctx context.Context, api string, handler Handler) error {
+	// The request waits until there is an invocation, so it has no timeout
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"/invocation/next", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get next invocation: %w", err)
+	}
+	event, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read invocation: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get next invocation: %s", resp.Status)
+	}
+	id := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+	if trace := resp.Header.Get("Lambda-Runtime-Trace-Id"); trace != "" {
+		os.Setenv("_X_AMZN_TRACE_ID", trace)
+	}
+
+	invocationCtx, cancel := ctx, context.CancelFunc(func() {})
+	if ms, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+		invocationCtx, cancel = context.WithDeadline(ctx, time.UnixMilli(ms))
+	}
+	result, err := call(invocationCtx, handler, event)
+	cancel()
+	if err != nil {
+		return post(ctx, api+"/invocation/"+id+"/error", errorBody(err))
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return post(ctx, api+"/invocation/"+id+"/error", errorBody(err))
+	}
+	return post(ctx, api+"/invocation/"+id+"/response", data)
+}
+
+// call runs handler, turning a panic into an error so the execution
+// environment survives it.
+func call(ctx context.Context, handler Handler, event json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, event)
+}
+
+// InitError reports that the function failed to initialize, such as when
+// its configuration is invalid, so Lambda shows err instead of a timeout.
+func InitError(err error) error {
+	api, apiErr := runtimeAPI()
+	if apiErr != nil {
+		return apiErr
+	}
+	return post(context.Background(), api+"/init/error", errorBody(err))
+}
+
+// errorBody returns the error document of the Runtime API.
+func errorBody(err error) []byte {
+	data, _ := json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": fmt.Sprintf("%T", err)})
+	return data
+}
+
+func post(ctx context.Context, url string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("runtime API responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStart(t *testing.T) {
+	events := []string{`{"n": 1}`, `{"n": 2}`, `{"n": 3}`}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var posted []string
+	var invocations int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := strings.TrimPrefix(r.URL.Path, apiVersion)
+		if r.Method == http.MethodGet && path == "/invocation/next" {
+			if len(events) == 0 {
+				// Stop once every event was handled, like Lambda freezing the environment
+				cancel()
+				<-r.Context().Done()
+				return
+			}
+			invocations++
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", fmt.Sprintf("req-%d", invocations))
+			w.Header().Set("Lambda-Runtime-Deadline-Ms", "4102444800000")
+			w.Write([]byte(events[0]))
+			events = events[1:]
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		posted = append(posted, r.Method+" "+path+" "+string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer api.Close()
+	os.Setenv("AWS_LAMBDA_RUNTIME_API", strings.TrimPrefix(api.URL, "http://"))
+	defer os.Unsetenv("AWS_LAMBDA_RUNTIME_API")
+
+	err := Start(ctx, func(ctx context.Context, event json.RawMessage) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("invocation has no deadline")
+		}
+		var e struct{ N int }
+		json.Unmarshal(event, &e)
+		switch e.N {
+		case 2:
+			return nil, errors.New("boom")
+		case 3:
+			panic("oops")
+		}
+		return map[string]int{"n": e.N}, nil
+	})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	want := []string{
+		`POST /invocation/req-1/response {"n":1}`,
+		`POST /invocation/req-2/error {"errorMessage":"boom","errorType":"*errors.errorString"}`,
+		`POST /invocation/req-3/error {"errorMessage":"panic: oops","errorType":"*errors.errorString"}`,
+	}
+	if strings.Join(posted, "\n") != strings.Join(want, "\n") {
+		t.Errorf("posted:\n%s\nwant:\n%s", strings.Join(posted, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,216 @@
+// Package linear integrates the autoassigner with Linear: it reads issues
+// by identifier or from webhooks and sets their assignee through the
+// GraphQL API.
+package linear
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultApiUrl = "https://api.linear.app/graphql"
+
+// Issue is a Linear issue to assign.
+type Issue struct {
+	ID         string // UUID of the issue
+	Identifier string // Identifier shown to users, e.g. ENG-123
+	Title      string // Title of the issue
+	TeamID     string // ID of the issue's team
+	TeamKey    string // Key of the issue's team, e.g. ENG
+	AssigneeID string // ID of the assignee, empty for unassigned issues
+}
+
+// String returns the identifier of the issue.
+func (i Issue) String() string {
+	return i.Identifier
+}
+
+// ParseEvent reads the issue from a webhook payload. It reports false for
+// events other than the creation of an issue.
+func ParseEvent(payload []byte) (*Issue, bool, error) {
+	var event struct {
+		Action string `json:"action"`
+		Type   string `json:"type"`
+		Data   struct {
+			ID         string `json:"id"`
+			Identifier string `json:"identifier"`
+			Title      string `json:"title"`
+			TeamID     string `json:"teamId"`
+			Team       struct {
+				Key string `json:"key"`
+			} `json:"team"`
+			AssigneeID string `json:"assigneeId"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, false, fmt.Errorf("failed to parse Linear event: %w", err)
+	}
+	if event.Type != "Issue" || event.Action != "create" {
+		return nil, false, nil
+	}
+	d := event.Data
+	if d.ID == "" {
+		return nil, false, fmt.Errorf("Linear issue event without an issue id")
+	}
+	return &Issue{ID: d.ID, Identifier: d.Identifier, Title: d.Title, TeamID: d.TeamID, TeamKey: d.Team.Key, AssigneeID: d.AssigneeID}, true, nil
+}
+
+// VerifySignature reports whether signature, the Linear-Signature header,
+// is the hex HMAC-SHA256 of payload under secret.
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// Group returns the autoassigner group mapped to the team of an issue, by
+// key or ID. It reports false for unmapped issues.
+func Group(i Issue) (string, bool) {
+	teams := config.Settings.Linear.Teams
+	for _, key := range []string{i.TeamKey, i.TeamID} {
+		if group, ok := teams[key]; ok && key != "" {
+			return group, true
+		}
+	}
+	return "", false
+}
+
+// GetIssue returns the issue with the given identifier or ID.
+func GetIssue(ctx context.Context, id string) (*Issue, error) {
+	var data struct {
+		Issue *struct {
+			ID         string `json:"id"`
+			Identifier string `json:"identifier"`
+			Title      string `json:"title"`
+			Team       struct {
+				ID  string `json:"id"`
+				Key string `json:"key"`
+			} `json:"team"`
+			Assignee *struct {
+				ID string `json:"id"`
+			} `json:"assignee"`
+		} `json:"issue"`
+	}
+	query := `query($id: String!) { issue(id: $id) { id identifier title team { id key } assignee { id } } }`
+	if err := call(ctx, query, map[string]interface{}{"id": id}, &data); err != nil {
+		return nil, err
+	}
+	if data.Issue == nil {
+		return nil, fmt.Errorf("Linear issue %s not found", id)
+	}
+	d := data.Issue
+	issue := &Issue{ID: d.ID, Identifier: d.Identifier, Title: d.Title, TeamID: d.Team.ID, TeamKey: d.Team.Key}
+	if d.Assignee != nil {
+		issue.AssigneeID = d.Assignee.ID
+	}
+	return issue, nil
+}
+
+// UserID returns the Linear user ID of a user from the identity mapping, or
+// else of the Linear user with their email address.
+func UserID(ctx context.Context, user string) (string, error) {
+	id, err := identity.Lookup(ctx, user, identity.Linear)
+	if !errors.Is(err, identity.ErrUnknown) {
+		return id, err
+	}
+	email, err := identity.Lookup(ctx, user, identity.Email)
+	if err != nil {
+		return "", err
+	}
+	var data struct {
+		Users struct {
+			Nodes []struct {
+				ID string `json:"id"`
+			} `json:"nodes"`
+		} `json:"users"`
+	}
+	query := `query($email: String!) { users(filter: {email: {eq: $email}}) { nodes { id } } }`
+	if err := call(ctx, query, map[string]interface{}{"email": email}, &data); err != nil {
+		return "", err
+	}
+	if len(data.Users.Nodes) == 0 {
+		return "", &identity.UnknownError{Kind: identity.Linear, Value: user}
+	}
+	return data.Users.Nodes[0].ID, nil
+}
+
+// Assign sets the assignee of an issue to the Linear user userID.
+func Assign(ctx context.Context, i Issue, userID string) error {
+	var data struct {
+		IssueUpdate struct {
+			Success bool `json:"success"`
+		} `json:"issueUpdate"`
+	}
+	query := `mutation($id: String!, $assigneeId: String) { issueUpdate(id: $id, input: {assigneeId: $assigneeId}) { success } }`
+	if err := call(ctx, query, map[string]interface{}{"id": i.ID, "assigneeId": userID}, &data); err != nil {
+		return err
+	}
+	if !data.IssueUpdate.Success {
+		return fmt.Errorf("Linear did not update issue %s", i)
+	}
+	return nil
+}
+
+// call runs a GraphQL query, authenticated with the OAuth token or else the
+// API key, and decodes its data into result.
+func call(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error {
+	conf := config.Settings.Linear
+	apiUrl := conf.ApiUrl
+	if apiUrl == "" {
+		apiUrl = defaultApiUrl
+	}
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case conf.Token != "":
+		req.Header.Set("Authorization", "Bearer "+conf.Token)
+	case conf.ApiKey != "":
+		// Personal API keys are sent without a scheme
+		req.Header.Set("Authorization", conf.ApiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Linear request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+	if len(response.Errors) > 0 {
+		messages := make([]string, len(response.Errors))
+		for i, e := range response.Errors {
+			messages[i] = e.Message
+		}
+		return fmt.Errorf("Linear request failed: %s", strings.Join(messages, "; "))
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Linear request failed: unexpected status %s", resp.Status)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failed to parse Linear response: %w", decodeErr)
+	}
+	return json.Unmarshal(response.Data, result)
+}
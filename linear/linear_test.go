@@ -0,0 +1,132 @@
+package linear
+
+import (
+	"autoassigner/config"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    *Issue
+		wantErr bool
+	}{
+		{
+			payload: `{"action": "create", "type": "Issue", "data": {"id": "9cfb482a", "identifier": "ENG-123", "title": "Fix login", "teamId": "72b2a2dc", "team": {"key": "ENG"}}}`,
+			want:    &Issue{ID: "9cfb482a", Identifier: "ENG-123", Title: "Fix login", TeamID: "72b2a2dc", TeamKey: "ENG"},
+		},
+		{
+			payload: `{"action": "create", "type": "Issue", "data": {"id": "9cfb482a", "identifier": "ENG-124", "assigneeId": "f2b1c8e5"}}`,
+			want:    &Issue{ID: "9cfb482a", Identifier: "ENG-124", AssigneeID: "f2b1c8e5"},
+		},
+		{payload: `{"action": "update", "type": "Issue", "data": {"id": "9cfb482a"}}`},
+		{payload: `{"action": "create", "type": "Comment", "data": {"id": "5d2e"}}`},
+		{payload: `{"action": "create", "type": "Issue", "data": {}}`, wantErr: true},
+		{payload: `{`, wantErr: true},
+	}
+	for i, tt := range tests {
+		got, ok, err := ParseEvent([]byte(tt.payload))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d ParseEvent() error = %v, wantErr %v", i, err, tt.wantErr)
+			continue
+		}
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d ParseEvent() = %+v, %v, want %+v", i, got, ok, tt.want)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"action": "create"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+	valid := hex.EncodeToString(mac.Sum(nil))
+
+	for signature, want := range map[string]bool{valid: true, strings.ToUpper(valid): false, "": false} {
+		if got := VerifySignature("secret", payload, signature); got != want {
+			t.Errorf("VerifySignature(%q) = %v, want %v", signature, got, want)
+		}
+	}
+}
+
+func TestAPI(t *testing.T) {
+	var updates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "lin_api_key" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": [{"message": "Authentication required, not authenticated"}]}`))
+			return
+		}
+		var req struct {
+			Query     string            `json:"query"`
+			Variables map[string]string `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case strings.Contains(req.Query, "issue(id:"):
+			if req.Variables["id"] != "ENG-123" {
+				w.Write([]byte(`{"errors": [{"message": "Entity not found: Issue"}], "data": null}`))
+				return
+			}
+			w.Write([]byte(`{"data": {"issue": {"id": "9cfb482a", "identifier": "ENG-123", "title": "Fix login", "team": {"id": "72b2a2dc", "key": "ENG"}, "assignee": null}}}`))
+		case strings.Contains(req.Query, "users("):
+			if req.Variables["email"] != "bob@example.com" {
+				w.Write([]byte(`{"data": {"users": {"nodes": []}}}`))
+				return
+			}
+			w.Write([]byte(`{"data": {"users": {"nodes": [{"id": "b0b"}]}}}`))
+		case strings.Contains(req.Query, "issueUpdate"):
+			updates = append(updates, req.Variables["id"]+" "+req.Variables["assigneeId"])
+			w.Write([]byte(`{"data": {"issueUpdate": {"success": true}}}`))
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Linear = config.LinearConfig{ApiUrl: server.URL, ApiKey: "lin_api_key"}
+	config.Settings.Identity = config.IdentityConfig{Users: map[string]map[string]string{
+		"alice": {"linear": "a11ce"},
+		"bob":   {"email": "bob@example.com"},
+		"carol": {"email": "carol@example.com"},
+	}}
+	ctx := context.Background()
+
+	issue, err := GetIssue(ctx, "ENG-123")
+	want := &Issue{ID: "9cfb482a", Identifier: "ENG-123", Title: "Fix login", TeamID: "72b2a2dc", TeamKey: "ENG"}
+	if err != nil || !reflect.DeepEqual(issue, want) {
+		t.Fatalf("GetIssue() = %+v, %v, want %+v", issue, err, want)
+	}
+	if _, err := GetIssue(ctx, "ENG-999"); err == nil || !strings.Contains(err.Error(), "Entity not found") {
+		t.Errorf("GetIssue(ENG-999) error = %v, want the API's message", err)
+	}
+
+	// Users without a linear identifier are found by email
+	for user, want := range map[string]string{"alice": "a11ce", "bob": "b0b", "carol": ""} {
+		id, err := UserID(ctx, user)
+		if id != want || (err != nil) != (want == "") {
+			t.Errorf("UserID(%s) = %q, %v, want %q", user, id, err, want)
+		}
+	}
+
+	if err := Assign(ctx, *issue, "a11ce"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if want := []string{"9cfb482a a11ce"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+
+	config.Settings.Linear.ApiKey = "wrong"
+	if _, err := GetIssue(ctx, "ENG-123"); err == nil || !strings.Contains(err.Error(), "not authenticated") {
+		t.Errorf("GetIssue() error = %v, want the API's message", err)
+	}
+}
@@ -0,0 +1,129 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer accepts one connection and answers the handshake like a NATS
+// server, rejecting CONNECTs without want. It returns the lines the client
+// sends after the handshake.
+func fakeServer(t *testing.T, want string, serve func(conn net.Conn)) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		connect, _ := r.ReadString('\n')
+		r.ReadString('\n') // PING
+		if !strings.Contains(connect, want) {
+			fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+			return
+		}
+		fmt.Fprint(conn, "+OK\r\nPONG\r\n")
+		serve(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	}()
+	return listener.Addr().String(), lines
+}
+
+func TestConn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("credentials", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			user  string
+			token string
+			want  string
+		}{
+			{"user and password", "alice:pw@", "", `"pass":"pw","pedantic":false,"protocol":1,"user":"alice"`},
+			{"token in URL", "tok@", "", `"auth_token":"tok"`},
+			{"token", "alice:pw@", "tok", `"auth_token":"tok"`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				addr, _ := fakeServer(t, tt.want, func(net.Conn) {})
+				conn, err := Dial(ctx, "nats://"+tt.user+addr, tt.token)
+				if err != nil {
+					t.Fatalf("Dial() error = %v", err)
+				}
+				conn.Close()
+			})
+		}
+	})
+
+	t.Run("authorization violation", func(t *testing.T) {
+		addr, _ := fakeServer(t, "never", func(net.Conn) {})
+		if _, err := Dial(ctx, "nats://"+addr, "wrong"); !errors.Is(err, ErrServer) || !strings.Contains(err.Error(), "Authorization Violation") {
+			t.Errorf("Dial() error = %v, want authorization violation", err)
+		}
+	})
+
+	t.Run("invalid URL", func(t *testing.T) {
+		if _, err := Dial(ctx, "http://localhost:4222", ""); err == nil {
+			t.Error("Dial() error = nil, want invalid scheme")
+		}
+	})
+
+	t.Run("messages", func(t *testing.T) {
+		addr, lines := fakeServer(t, "", func(conn net.Conn) {
+			fmt.Fprint(conn, "MSG jobs.a 1 _INBOX.1 5\r\nhello\r\nPING\r\nMSG jobs.b 1 0\r\n\r\n")
+		})
+		conn, err := Dial(ctx, "nats://"+addr, "")
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		if err := conn.Subscribe("jobs.*", "workers"); err != nil {
+			t.Fatalf("Subscribe() error = %v", err)
+		}
+		for _, want := range []Msg{{Subject: "jobs.a", Reply: "_INBOX.1", Data: []byte("hello")}, {Subject: "jobs.b", Data: []byte{}}} {
+			msg, err := conn.Next(ctx)
+			if err != nil || msg.Subject != want.Subject || msg.Reply != want.Reply || string(msg.Data) != string(want.Data) {
+				t.Errorf("Next() = %+v, %v, want %+v", msg, err, want)
+			}
+		}
+		if err := conn.Publish("_INBOX.1", []byte("done")); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if err := conn.Publish("jobs.*", nil); err == nil {
+			t.Error("Publish() to a wildcard error = nil")
+		}
+		var got []string
+		for len(got) < 4 {
+			got = append(got, <-lines)
+		}
+		// The PONG answering the server's PING may come before or after the SUB
+		want := "SUB jobs.* workers 1|PONG|PUB _INBOX.1 4|done"
+		if strings.Join(got, "|") != want && strings.Join(got, "|") != "PONG|SUB jobs.* workers 1|PUB _INBOX.1 4|done" {
+			t.Errorf("client sent %q, want %q", got, want)
+		}
+		conn.Close()
+		if _, err := conn.Next(ctx); err == nil {
+			t.Error("Next() after Close error = nil")
+		}
+	})
+}
@@ -0,0 +1,149 @@
+// Package notify sends messages, such as the weekly digest, to the
+// notifiers of the config: Slack channels, HTTP endpoints such as incoming
+// webhooks, and commands such as a mail script.
+package notify
+
+import (
+	"autoassigner/config"
+	"autoassigner/slack"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// timeout is the time a notifier may take to deliver a message.
+const timeout = 30 * time.Second
+
+// Notifier delivers a message.
+type Notifier interface {
+	Notify(ctx context.Context, text string) error
+}
+
+// New creates the notifier described by conf.
+func New(conf config.NotifierConfig) (Notifier, error) {
+	switch conf.Type {
+	case config.NotifySlack:
+		if conf.Channel == "" {
+			return nil, fmt.Errorf("slack notifier requires a channel")
+		}
+		return slackNotifier{channel: conf.Channel}, nil
+	case config.NotifyHTTP:
+		if conf.URL == "" {
+			return nil, fmt.Errorf("http notifier requires a url")
+		}
+		return httpNotifier{url: conf.URL, headers: conf.Headers}, nil
+	case config.NotifyCommand:
+		if len(conf.Command) == 0 {
+			return nil, fmt.Errorf("command notifier requires a command")
+		}
+		return commandNotifier{command: conf.Command}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type: %s", conf.Type)
+	}
+}
+
+// NewAll creates the notifiers described by confs.
+func NewAll(confs []config.NotifierConfig) ([]Notifier, error) {
+	notifiers := make([]Notifier, 0, len(confs))
+	for i, conf := range confs {
+		n, err := New(conf)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %d: %w", i+1, err)
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+// Send delivers text with every notifier. A failing notifier doesn't keep
+// the message from the others; the returned error joins their errors.
+func Send(ctx context.Context, notifiers []Notifier, text string) error {
+	var errs []error
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, text); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// slackNotifier posts messages to a channel as the bot of config.Settings.Slack,
+// read when a message is sent so refreshed tokens are used.
+type slackNotifier struct {
+	channel string
+}
+
+func (n slackNotifier) Notify(ctx context.Context, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client := &slack.Client{URL: config.Settings.Slack.ApiUrl, BotToken: config.Settings.Slack.BotToken}
+	if err := client.PostMessage(ctx, slack.Message{Channel: n.channel, Text: text}); err != nil {
+		return fmt.Errorf("failed to post to Slack channel %s: %w", n.channel, err)
+	}
+	return nil
+}
+
+// httpNotifier posts messages as {"text": "<message>"}, the payload of
+// Slack and Mattermost incoming webhooks.
+type httpNotifier struct {
+	url     string
+	headers map[string]string
+}
+
+func (n httpNotifier) Notify(ctx context.Context, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	data, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range n.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to notify %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return fmt.Errorf("failed to notify %s: unexpected status %s: %s", req.URL.Host, resp.Status, msg)
+		}
+		return fmt.Errorf("failed to notify %s: unexpected status %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// commandNotifier runs a command with messages on stdin.
+type commandNotifier struct {
+	command []string
+}
+
+func (n commandNotifier) Notify(ctx context.Context, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, n.command[0], n.command[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", n.command[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", n.command[0], err)
+	}
+	return nil
+}
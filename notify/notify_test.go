@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNotifiers(t *testing.T) {
+	dir := t.TempDir()
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			posted = append(posted, r.Header.Get("Authorization")+" "+body["channel"]+" "+body["text"])
+			w.Write([]byte(`{"ok": true}`))
+		case "/hook":
+			posted = append(posted, r.Header.Get("X-Token")+" "+body["text"])
+		default:
+			http.Error(w, "gone", http.StatusGone)
+		}
+	}))
+	defer server.Close()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Slack = config.SlackConfig{ApiUrl: server.URL, BotToken: "xoxb-1"}
+
+	out := filepath.Join(dir, "mail.txt")
+	notifiers, err := NewAll([]config.NotifierConfig{
+		{Type: config.NotifySlack, Channel: "C1"},
+		{Type: config.NotifyHTTP, URL: server.URL + "/hook", Headers: map[string]string{"X-Token": "t0k"}},
+		{Type: config.NotifyCommand, Command: []string{"sh", "-c", "cat > " + out}},
+	})
+	if err != nil {
+		t.Fatalf("NewAll() error = %v", err)
+	}
+	if err := Send(context.Background(), notifiers, "Weekly digest"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	want := []string{"Bearer xoxb-1 C1 Weekly digest", "t0k Weekly digest"}
+	if strings.Join(posted, "|") != strings.Join(want, "|") {
+		t.Errorf("posted = %q, want %q", posted, want)
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != "Weekly digest" {
+		t.Errorf("command received %q, %v, want the message", data, err)
+	}
+
+	// A failing notifier doesn't keep the message from the others
+	posted = nil
+	failing, err := NewAll([]config.NotifierConfig{
+		{Type: config.NotifyHTTP, URL: server.URL + "/gone"},
+		{Type: config.NotifyCommand, Command: []string{"sh", "-c", "echo no mail >&2; exit 1"}},
+		{Type: config.NotifySlack, Channel: "C2"},
+	})
+	if err != nil {
+		t.Fatalf("NewAll() error = %v", err)
+	}
+	err = Send(context.Background(), failing, "Weekly digest")
+	if err == nil || !strings.Contains(err.Error(), "410 Gone: gone") || !strings.Contains(err.Error(), "no mail") {
+		t.Errorf("Send() error = %v, want the errors of both failing notifiers", err)
+	}
+	if len(posted) != 1 {
+		t.Errorf("posted = %q, want the Slack message", posted)
+	}
+
+	for _, conf := range []config.NotifierConfig{{Type: "pigeon"}, {Type: config.NotifySlack}, {Type: config.NotifyHTTP}, {Type: config.NotifyCommand}} {
+		if _, err := New(conf); err == nil {
+			t.Errorf("New(%+v) should fail", conf)
+		}
+	}
+}
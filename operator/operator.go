@@ -0,0 +1,411 @@
+// Package operator runs the assigner as a Kubernetes operator: groups are
+// defined as AssigneeGroup resources, whose specs are written to the group
+// config files, and assignments are requested with Assignment resources,
+// whose status receives the result.
+package operator
+
+import (
+	"autoassigner/config"
+	"autoassigner/kube"
+	"autoassigner/runner"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// API group and version of the custom resources.
+const (
+	APIGroup   = "autoassigner.io"
+	APIVersion = "v1alpha1"
+)
+
+// Phases of an Assignment.
+const (
+	PhasePending  = "Pending"  // Not assigned yet; retried, e.g. once the quiet hours of the group end
+	PhaseAssigned = "Assigned" // Assigned; final
+	PhaseFailed   = "Failed"   // Can't be assigned as requested, e.g. without a group; final
+)
+
+// AssigneeGroup defines a group. Its spec has the keys of a group config
+// file, such as strategy and users.
+type AssigneeGroup struct {
+	Metadata kube.ObjectMeta     `json:"metadata"`
+	Spec     json.RawMessage     `json:"spec"`
+	Status   AssigneeGroupStatus `json:"status"`
+}
+
+// AssigneeGroupStatus reports whether the spec of a group was applied, and
+// the state of its rotation.
+type AssigneeGroupStatus struct {
+	ObservedGeneration int64          `json:"observedGeneration,omitempty"` // Generation of the spec the status describes
+	Ready              bool           `json:"ready"`                        // Whether the spec was written to the group's config file
+	Message            string         `json:"message,omitempty"`            // Why the spec wasn't applied, such as the problems found by validation
+	LastAssignee       string         `json:"lastAssignee,omitempty"`       // User of the most recent assignment
+	LastAssignedAt     string         `json:"lastAssignedAt,omitempty"`     // Time of the most recent assignment, in RFC 3339 format
+	Counts             map[string]int `json:"counts,omitempty"`             // Lifetime assignment count per member
+}
+
+// Assignment requests the assignment of a user from a group.
+type Assignment struct {
+	Metadata kube.ObjectMeta  `json:"metadata"`
+	Spec     AssignmentSpec   `json:"spec"`
+	Status   AssignmentStatus `json:"status"`
+}
+
+// AssignmentSpec describes the requested assignment, like the requests of
+// the consumer.
+type AssignmentSpec struct {
+	Group    string            `json:"group"`              // AssigneeGroup in the same namespace to assign a user from
+	Priority string            `json:"priority,omitempty"` // Selects a route from the group's priorities, e.g. "P1"
+	Exclude  []string          `json:"exclude,omitempty"`  // Users never selected, such as the reporter of a ticket
+	Metadata map[string]string `json:"metadata,omitempty"` // Context such as the ticket to assign, passed to the group's callback
+}
+
+// AssignmentStatus is the result of an Assignment.
+type AssignmentStatus struct {
+	Phase      string `json:"phase,omitempty"`      // Pending, Assigned or Failed
+	Assignee   string `json:"assignee,omitempty"`   // Assigned user
+	ID         string `json:"id,omitempty"`         // ID of the assignment in the group's log
+	AssignedAt string `json:"assignedAt,omitempty"` // Time of the assignment, in RFC 3339 format
+	Message    string `json:"message,omitempty"`    // Why the assignment is pending or failed
+}
+
+// managedHeader starts the config files written from AssigneeGroups, so the
+// operator only ever replaces or removes files it wrote.
+const managedHeader = "# Managed by the autoassigner operator from AssigneeGroup %s/%s; edit the resource instead\n"
+
+// Delays between attempts of an assignment that failed for reasons that may
+// pass.
+var (
+	minRetry = 10 * time.Second
+	maxRetry = 5 * time.Minute
+)
+
+// Operator reconciles the AssigneeGroups and Assignments of a namespace.
+// Changes are handled one at a time, so assignments made by the operator
+// never race each other.
+type Operator struct {
+	Client    *kube.Client
+	Namespace string
+
+	work        chan func(ctx context.Context)
+	groups      map[string]*AssigneeGroup // Last seen version of each group, by name
+	assignments map[string]*Assignment    // Last seen version of each unfinished assignment, by name
+	attempts    map[string]int            // Failed attempts of each pending assignment, by UID
+}
+
+// Run reconciles the resources until ctx is done.
+func (o *Operator) Run(ctx context.Context) error {
+	o.work = make(chan func(ctx context.Context))
+	o.groups = map[string]*AssigneeGroup{}
+	o.assignments = map[string]*Assignment{}
+	o.attempts = map[string]int{}
+
+	// Groups are listed first, so assignments of existing groups don't fail for lack of them
+	informing := false
+	go o.inform(ctx, "assigneegroups", o.groupChanged, func(ctx context.Context, names map[string]bool) {
+		o.groupsListed(ctx, names)
+		if !informing {
+			informing = true
+			go o.inform(ctx, "assignments", o.assignmentChanged, nil)
+		}
+	})
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case fn := <-o.work:
+			fn(ctx)
+		}
+	}
+}
+
+// enqueue schedules fn to run on the operator's goroutine, unless ctx is done.
+func (o *Operator) enqueue(ctx context.Context, fn func(ctx context.Context)) {
+	select {
+	case o.work <- fn:
+	case <-ctx.Done():
+	}
+}
+
+// inform lists the resources of a kind and watches them, passing every
+// version seen to changed, until ctx is done. After every list, listed gets
+// the names of the resources, unless it is nil.
+func (o *Operator) inform(ctx context.Context, resource string, changed func(ctx context.Context, eventType string, data json.RawMessage), listed func(ctx context.Context, names map[string]bool)) {
+	path := kube.Path(APIGroup, APIVersion, o.Namespace, resource, "")
+	backoff := time.Second
+	for ctx.Err() == nil {
+		list, err := o.Client.List(ctx, path)
+		if err != nil {
+			log.Printf("Failed to list %s, retrying in %s: %v", resource, backoff, err)
+			sleep(ctx, backoff)
+			if backoff *= 2; backoff > time.Minute {
+				backoff = time.Minute
+			}
+			continue
+		}
+		backoff = time.Second
+		names := map[string]bool{}
+		for _, item := range list.Items {
+			var meta struct {
+				Metadata kube.ObjectMeta `json:"metadata"`
+			}
+			json.Unmarshal(item, &meta)
+			names[meta.Metadata.Name] = true
+			item := item
+			o.enqueue(ctx, func(ctx context.Context) { changed(ctx, "ADDED", item) })
+		}
+		if listed != nil {
+			o.enqueue(ctx, func(ctx context.Context) { listed(ctx, names) })
+		}
+
+		version := list.Metadata.ResourceVersion
+		for ctx.Err() == nil {
+			err := o.Client.Watch(ctx, path, version, func(event kube.Event) error {
+				var meta struct {
+					Metadata kube.ObjectMeta `json:"metadata"`
+				}
+				json.Unmarshal(event.Object, &meta)
+				version = meta.Metadata.ResourceVersion
+				if event.Type != "BOOKMARK" {
+					o.enqueue(ctx, func(ctx context.Context) { changed(ctx, event.Type, event.Object) })
+				}
+				return nil
+			})
+			if errors.Is(err, kube.ErrGone) {
+				break
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Watch of %s failed, listing again: %v", resource, err)
+				sleep(ctx, time.Second)
+				break
+			}
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// groupChanged applies the spec of a group to its config file and updates
+// its status.
+func (o *Operator) groupChanged(ctx context.Context, eventType string, data json.RawMessage) {
+	var group AssigneeGroup
+	if err := json.Unmarshal(data, &group); err != nil {
+		log.Printf("Invalid AssigneeGroup: %v", err)
+		return
+	}
+	name := group.Metadata.Name
+	if eventType == "DELETED" {
+		delete(o.groups, name)
+		o.removeGroup(name)
+		return
+	}
+	o.groups[name] = &group
+	status := AssigneeGroupStatus{ObservedGeneration: group.Metadata.Generation, Ready: true}
+	if err := o.applyGroup(&group); err != nil {
+		status.Ready, status.Message = false, err.Error()
+	}
+	o.updateGroupStatus(ctx, &group, status)
+}
+
+// groupsListed removes the config files of groups deleted while the
+// operator wasn't watching.
+func (o *Operator) groupsListed(ctx context.Context, names map[string]bool) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return
+	}
+	for _, name := range groups {
+		if !names[name] {
+			o.removeGroup(name)
+		}
+	}
+}
+
+// applyGroup writes the spec of a group to its config file, unless the file
+// exists and wasn't written by the operator.
+func (o *Operator) applyGroup(group *AssigneeGroup) error {
+	name := group.Metadata.Name
+	header := fmt.Sprintf(managedHeader, o.Namespace, name)
+	confPath, _ := config.GroupConfigPath(name)
+	if existing, err := os.ReadFile(confPath); err == nil && !bytes.HasPrefix(existing, []byte(header)) {
+		return fmt.Errorf("group %s is already defined by a config file not managed by the operator", name)
+	}
+	data, err := specYAML(group.Spec)
+	if err != nil {
+		return fmt.Errorf("invalid spec: %w", err)
+	}
+	return runner.SaveGroupConfig(name, append([]byte(header), data...))
+}
+
+// removeGroup removes the config file of a group written by the operator.
+// Its data is kept, so a group created again continues its rotation.
+func (o *Operator) removeGroup(name string) {
+	confPath, _ := config.GroupConfigPath(name)
+	data, err := os.ReadFile(confPath)
+	if err != nil || !bytes.HasPrefix(data, []byte(fmt.Sprintf(managedHeader, o.Namespace, name))) {
+		return
+	}
+	if err := runner.DeleteGroup(name, false); err != nil {
+		log.Printf("Failed to remove group %s: %v", name, err)
+		return
+	}
+	log.Printf("Removed group %s", name)
+}
+
+// specYAML converts the spec of a group to the YAML of a config file. Its
+// values are kept as written, so large numbers such as seeds stay exact.
+func specYAML(spec json.RawMessage) ([]byte, error) {
+	// JSON is YAML in flow style; switch it to the block style of config files
+	var doc yaml.Node
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	var blockStyle func(node *yaml.Node)
+	blockStyle = func(node *yaml.Node) {
+		if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode || node.Style == yaml.DoubleQuotedStyle {
+			node.Style = 0
+		}
+		for _, child := range node.Content {
+			blockStyle(child)
+		}
+	}
+	blockStyle(&doc)
+	return yaml.Marshal(&doc)
+}
+
+// updateGroupStatus adds the state of a ready group to status and writes
+// it, unless the group already has it.
+func (o *Operator) updateGroupStatus(ctx context.Context, group *AssigneeGroup, status AssigneeGroupStatus) {
+	if status.Ready {
+		if state, err := runner.GetGroupState(ctx, group.Metadata.Name); err == nil {
+			status.Counts = state.Counts
+			if last := state.LastAssignment; last != nil {
+				status.LastAssignee, status.LastAssignedAt = last.User, last.Timestamp
+			}
+		}
+	}
+	if reflect.DeepEqual(status, group.Status) {
+		return
+	}
+	path := kube.Path(APIGroup, APIVersion, o.Namespace, "assigneegroups", group.Metadata.Name)
+	if err := o.Client.PatchStatus(ctx, path, status); err != nil {
+		log.Printf("Failed to update status of AssigneeGroup %s: %v", group.Metadata.Name, err)
+		return
+	}
+	group.Status = status
+}
+
+// assignmentChanged assigns a user for a new or pending assignment.
+func (o *Operator) assignmentChanged(ctx context.Context, eventType string, data json.RawMessage) {
+	var a Assignment
+	if err := json.Unmarshal(data, &a); err != nil {
+		log.Printf("Invalid Assignment: %v", err)
+		return
+	}
+	if eventType == "DELETED" || a.Status.Phase == PhaseAssigned || a.Status.Phase == PhaseFailed {
+		delete(o.assignments, a.Metadata.Name)
+		delete(o.attempts, a.Metadata.UID)
+		return
+	}
+	if previous, ok := o.assignments[a.Metadata.Name]; ok && previous.Metadata.UID == a.Metadata.UID && previous.Metadata.Generation == a.Metadata.Generation {
+		// Only the status changed, such as by the operator itself; a retry is scheduled
+		previous.Status = a.Status
+		return
+	}
+	o.assignments[a.Metadata.Name] = &a
+	o.assign(ctx, &a)
+}
+
+// result assigns a user for an assignment and returns its status, and when
+// to try again if it is pending.
+func (o *Operator) result(ctx context.Context, a *Assignment, opts runner.AssignOptions) (AssignmentStatus, time.Duration) {
+	if a.Spec.Group == "" {
+		return AssignmentStatus{Phase: PhaseFailed, Message: "group is required"}, 0
+	}
+	result, err := runner.AssignUser(ctx, a.Spec.Group, opts)
+	switch {
+	case err == nil && result.Deferred != "":
+		status := AssignmentStatus{Phase: PhasePending, Message: "deferred by the quiet hours of the group until " + result.Deferred}
+		until, err := time.Parse(time.RFC3339, result.Deferred)
+		if err != nil {
+			return status, maxRetry
+		}
+		return status, time.Until(until)
+	case err == nil:
+		return AssignmentStatus{Phase: PhaseAssigned, Assignee: result.User, ID: result.ID, AssignedAt: time.Now().UTC().Format(time.RFC3339)}, 0
+	case errors.Is(err, runner.ErrInvalidGroup):
+		// The group may be created after its assignments
+	case errors.Is(err, runner.ErrConfig), errors.Is(err, runner.ErrSelection):
+		return AssignmentStatus{Phase: PhaseFailed, Message: err.Error()}, 0
+	}
+	// Retry until the group exists or users are available
+	o.attempts[a.Metadata.UID]++
+	retry := minRetry << (o.attempts[a.Metadata.UID] - 1)
+	if retry > maxRetry || retry <= 0 {
+		retry = maxRetry
+	}
+	return AssignmentStatus{Phase: PhasePending, Message: err.Error()}, retry
+}
+
+// assign assigns a user for an assignment and writes the result to its
+// status. Assignments are identified by the UID of their resource, so an
+// assignment made before the status could be written isn't made again.
+func (o *Operator) assign(ctx context.Context, a *Assignment) {
+	opts := runner.AssignOptions{
+		ID:           a.Metadata.UID,
+		Priority:     a.Spec.Priority,
+		Exclude:      a.Spec.Exclude,
+		CallbackData: a.Spec.Metadata,
+		NoQueue:      true,
+		Silent:       true,
+	}
+	status, retry := o.result(ctx, a, opts)
+	if status.Phase != a.Status.Phase || status.Message != a.Status.Message || status.Assignee != a.Status.Assignee {
+		path := kube.Path(APIGroup, APIVersion, o.Namespace, "assignments", a.Metadata.Name)
+		if err := o.Client.PatchStatus(ctx, path, status); err != nil {
+			log.Printf("Failed to update status of Assignment %s: %v", a.Metadata.Name, err)
+			// Assigning again returns the logged assignment
+			retry = minRetry
+		} else {
+			a.Status = status
+		}
+	}
+	if status.Phase == PhaseAssigned {
+		log.Printf("Assigned %s to Assignment %s", status.Assignee, a.Metadata.Name)
+		if group, ok := o.groups[a.Spec.Group]; ok {
+			o.updateGroupStatus(ctx, group, AssigneeGroupStatus{ObservedGeneration: group.Status.ObservedGeneration, Ready: group.Status.Ready, Message: group.Status.Message})
+		}
+	}
+	if status.Phase != PhasePending && retry == 0 {
+		delete(o.assignments, a.Metadata.Name)
+		delete(o.attempts, a.Metadata.UID)
+		return
+	}
+	if retry <= 0 {
+		// The quiet hours just ended
+		retry = time.Second
+	}
+	name, uid := a.Metadata.Name, a.Metadata.UID
+	time.AfterFunc(retry, func() {
+		o.enqueue(ctx, func(ctx context.Context) {
+			// Skip assignments deleted, finished or replaced meanwhile
+			if current, ok := o.assignments[name]; ok && current.Metadata.UID == uid {
+				o.assign(ctx, current)
+			}
+		})
+	})
+}
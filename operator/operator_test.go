@@ -0,0 +1,133 @@
+package operator
+
+import (
+	"autoassigner/config"
+	"autoassigner/kube"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOperator(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{filepath.Join(dir, "conf")}}}
+	os.MkdirAll(config.Settings.Storage.ConfDir[0], 0755)
+	// A group of the config tree, and one of a deleted AssigneeGroup
+	os.WriteFile(filepath.Join(dir, "conf", "legacy.yaml"), []byte("strategy: random\nusers: [dave]\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "conf", "old.yaml"), []byte(fmt.Sprintf(managedHeader, "teams", "old")+"strategy: random\nusers: [erin]\n"), 0644)
+
+	groups := `{"metadata": {"resourceVersion": "5"}, "items": [
+		{"metadata": {"name": "support", "namespace": "teams", "generation": 2},
+		 "spec": {"strategy": "round_robin", "availability_checker": "always_available", "users": ["alice", "bob"], "strategy_options": {"seed": 9007199254740993}}},
+		{"metadata": {"name": "broken", "namespace": "teams", "generation": 1}, "spec": {"strategy": "bogus", "users": ["carol"]}},
+		{"metadata": {"name": "legacy", "namespace": "teams", "generation": 1}, "spec": {"strategy": "random", "users": ["dave"]}}
+	]}`
+	assignments := `{"metadata": {"resourceVersion": "7"}, "items": [
+		{"metadata": {"name": "t-1", "uid": "u1", "generation": 1}, "spec": {"group": "support", "metadata": {"ticket": "T-1"}}},
+		{"metadata": {"name": "t-2", "uid": "u2", "generation": 1}, "spec": {"group": "support"}, "status": {"phase": "Assigned", "assignee": "zed"}},
+		{"metadata": {"name": "t-3", "uid": "u3", "generation": 1}, "spec": {}},
+		{"metadata": {"name": "t-4", "uid": "u4", "generation": 1}, "spec": {"group": "missing"}}
+	]}`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	statuses := map[string]json.RawMessage{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := kube.Path(APIGroup, APIVersion, "teams", "", "")
+		resource, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, base), "/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("watch") == "1":
+			<-r.Context().Done()
+		case r.Method == http.MethodGet && resource == "assigneegroups":
+			w.Write([]byte(groups))
+		case r.Method == http.MethodGet && resource == "assignments":
+			w.Write([]byte(assignments))
+		case r.Method == http.MethodPatch && strings.HasSuffix(name, "/status"):
+			var patch []struct {
+				Value json.RawMessage `json:"value"`
+			}
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &patch)
+			mu.Lock()
+			statuses[resource+"/"+strings.TrimSuffix(name, "/status")] = patch[0].Value
+			// Every group and assignment is patched, the support group twice
+			if len(statuses) == 6 && strings.Contains(string(statuses["assigneegroups/support"]), "lastAssignee") {
+				cancel()
+			}
+			mu.Unlock()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	o := &Operator{Client: &kube.Client{URL: api.URL}, Namespace: "teams"}
+	if err := o.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	var support AssigneeGroupStatus
+	json.Unmarshal(statuses["assigneegroups/support"], &support)
+	if !support.Ready || support.ObservedGeneration != 2 || support.LastAssignee != "alice" || !reflect.DeepEqual(support.Counts, map[string]int{"alice": 1, "bob": 0}) {
+		t.Errorf("status of support = %s", statuses["assigneegroups/support"])
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "conf", "support.yaml"))
+	if err != nil || !strings.HasPrefix(string(data), "# Managed by the autoassigner operator from AssigneeGroup teams/support") ||
+		!strings.Contains(string(data), "users:\n    - alice\n    - bob\n") || !strings.Contains(string(data), "seed: 9007199254740993\n") {
+		t.Errorf("config of support = %q, %v", data, err)
+	}
+
+	for name, want := range map[string]string{
+		"broken": "unknown strategy",
+		"legacy": "not managed by the operator",
+	} {
+		var status AssigneeGroupStatus
+		json.Unmarshal(statuses["assigneegroups/"+name], &status)
+		if status.Ready || !strings.Contains(status.Message, want) {
+			t.Errorf("status of %s = %s, want not ready with %q", name, statuses["assigneegroups/"+name], want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "conf", "broken.yaml")); err == nil {
+		t.Error("invalid spec of broken was written")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "conf", "legacy.yaml")); string(data) != "strategy: random\nusers: [dave]\n" {
+		t.Errorf("unmanaged legacy.yaml = %q, want it kept", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "conf", "old.yaml")); !os.IsNotExist(err) {
+		t.Errorf("config of the deleted group old was kept: %v", err)
+	}
+
+	for name, want := range map[string]AssignmentStatus{
+		"t-1": {Phase: PhaseAssigned, Assignee: "alice", ID: "u1"},
+		"t-3": {Phase: PhaseFailed, Message: "group is required"},
+		"t-4": {Phase: PhasePending},
+	} {
+		var got AssignmentStatus
+		json.Unmarshal(statuses["assignments/"+name], &got)
+		got.AssignedAt = ""
+		if name == "t-4" && strings.Contains(got.Message, "missing") {
+			got.Message = ""
+		}
+		if got != want {
+			t.Errorf("status of %s = %s, want %+v", name, statuses["assignments/"+name], want)
+		}
+	}
+	if _, ok := statuses["assignments/t-2"]; ok {
+		t.Error("status of the finished assignment t-2 was updated")
+	}
+}
@@ -0,0 +1,341 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// userSettings are the settings of a user given inline in the users list:
+//
+//	users:
+//	  - alice: {aliases: [alice.smith, asmith], availability_id: alice.smith@example.com, tags: [qa]}
+//	  - bob
+type userSettings struct {
+	Aliases        []string `yaml:"aliases"`
+	AvailabilityID string   `yaml:"availability_id"`
+	Tags           []string `yaml:"tags"`
+}
+
+// UserList is the list of users of a group. Entries in the config are user
+// names, or a user name mapped to its inline settings; parsing leaves only
+// the names.
+type UserList []string
+
+// JSONSchema describes the entries of a users list, user names or inline
+// user settings.
+func (UserList) JSONSchema() map[string]interface{} {
+	names := map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	settings := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"aliases":         names,
+			"availability_id": map[string]interface{}{"type": "string"},
+			"tags":            names,
+		},
+		"additionalProperties": false,
+	}
+	inline := map[string]interface{}{"type": "object", "minProperties": 1, "maxProperties": 1, "additionalProperties": settings}
+	return map[string]interface{}{"type": "array", "items": map[string]interface{}{"oneOf": []interface{}{
+		map[string]interface{}{"type": "string"},
+		inline,
+	}}}
+}
+
+// inlineUserSettings replaces the inline user entries of a group config with
+// plain user names and returns the rewritten config with their settings.
+// Configs without inline entries are returned unchanged, so parse errors
+// keep pointing at the lines of the original file.
+func inlineUserSettings(data []byte) ([]byte, map[string]userSettings, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return data, nil, nil
+	}
+
+	var users *yaml.Node
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "users" && root.Content[i+1].Kind == yaml.SequenceNode {
+			users = root.Content[i+1]
+		}
+	}
+	if users == nil {
+		return data, nil, nil
+	}
+
+	settings := map[string]userSettings{}
+	for i, entry := range users.Content {
+		if entry.Kind != yaml.MappingNode {
+			continue
+		}
+		if len(entry.Content) != 2 {
+			return nil, nil, fmt.Errorf("failed to parse config file: line %d: a user entry must have exactly one name", entry.Line)
+		}
+		name, value := entry.Content[0], entry.Content[1]
+		var s userSettings
+		if value.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				if key := value.Content[j]; key.Value != "aliases" && key.Value != "availability_id" && key.Value != "tags" {
+					return nil, nil, fmt.Errorf("failed to parse config file: line %d: unknown user setting %s", key.Line, key.Value)
+				}
+			}
+		}
+		if err := value.Decode(&s); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+		settings[name.Value] = s
+		users.Content[i] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name.Value}
+	}
+	if len(settings) == 0 {
+		return data, nil, nil
+	}
+
+	rewritten, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return rewritten, settings, nil
+}
+
+// applyUserSettings merges inline user settings into the group-level maps
+// and checks that every alias belongs to exactly one member and that aliases,
+// availability IDs and tags are only given for members.
+func (c *AssigneeGroupConfig) applyUserSettings(settings map[string]userSettings) error {
+	for user, s := range settings {
+		if len(s.Aliases) > 0 {
+			if c.Aliases == nil {
+				c.Aliases = map[string][]string{}
+			}
+			c.Aliases[user] = append(c.Aliases[user], s.Aliases...)
+		}
+		if s.AvailabilityID != "" {
+			if c.AvailabilityIDs == nil {
+				c.AvailabilityIDs = map[string]string{}
+			}
+			c.AvailabilityIDs[user] = s.AvailabilityID
+		}
+		if len(s.Tags) > 0 {
+			if c.Tags == nil {
+				c.Tags = map[string][]string{}
+			}
+			c.Tags[user] = append(c.Tags[user], s.Tags...)
+		}
+	}
+
+	members := make(map[string]bool, len(c.Users))
+	for _, user := range c.Users {
+		members[user] = true
+	}
+	owner := map[string]string{}
+	for user, aliases := range c.Aliases {
+		if !members[user] {
+			return fmt.Errorf("aliases are given for %s, who is not a member of the group", user)
+		}
+		for _, alias := range aliases {
+			if members[alias] {
+				return fmt.Errorf("alias %s of %s is also a member of the group", alias, user)
+			}
+			if other, ok := owner[alias]; ok && other != user {
+				return fmt.Errorf("alias %s is given for both %s and %s", alias, other, user)
+			}
+			owner[alias] = user
+		}
+	}
+	for user := range c.AvailabilityIDs {
+		if !members[user] {
+			return fmt.Errorf("an availability_id is given for %s, who is not a member of the group", user)
+		}
+	}
+	for user := range c.Tags {
+		if !members[user] {
+			return fmt.Errorf("tags are given for %s, who is not a member of the group", user)
+		}
+	}
+	return nil
+}
+
+// canonicalUser returns the member a name in stored counts or logs refers
+// to: the member an alias belongs to, or the name itself.
+func (c *AssigneeGroupConfig) canonicalUser(name string) string {
+	for user, aliases := range c.Aliases {
+		for _, alias := range aliases {
+			if alias == name {
+				return user
+			}
+		}
+	}
+	return name
+}
+
+// mergeAliasCounts moves the counts stored under aliases to their members.
+func (c *AssigneeGroupConfig) mergeAliasCounts(counts map[string]int) {
+	for name, count := range counts {
+		if user := c.canonicalUser(name); user != name {
+			counts[user] += count
+			delete(counts, name)
+		}
+	}
+}
+
+// availabilityID returns the identifier the availability checker knows a user by.
+func (c *AssigneeGroupConfig) availabilityID(user string) string {
+	if id, ok := c.AvailabilityIDs[user]; ok {
+		return id
+	}
+	return user
+}
+
+// RenameUser merges the stored state of a user who was renamed into the
+// member they are now configured as: their counts, including those of
+// pruned records, skip debts and time of their last assignment are added
+// to the new name, and the user field of the assignment, skip and decline
+// logs and of the open assignments is rewritten. The group config must
+// already list the new name and no longer the old one. The lock of the
+// group is held throughout, so no assignment is appended while the logs are
+// rewritten.
+func RenameUser(ctx context.Context, group, oldName, newName string) error {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return &InvalidGroupError{Group: group}
+	}
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	members := make(map[string]bool, len(groupConf.Users))
+	for _, user := range groupConf.Users {
+		members[user] = true
+	}
+	if !members[newName] {
+		return &ConfigError{Group: group, Err: fmt.Errorf("user %s is not a member of the group", newName)}
+	}
+	if members[oldName] {
+		return &ConfigError{Group: group, Err: fmt.Errorf("user %s is still a member of the group", oldName)}
+	}
+
+	// Every step skips what an earlier attempt already renamed, so a failed rename can be run again
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	for _, name := range []string{"assignments.log", "skips.log", "declines.log"} {
+		if err := rewriteLog(filepath.Join(groupDir, name), renameUserField(oldName, newName)); err != nil {
+			return fmt.Errorf("failed to rewrite %s: %w", name, err)
+		}
+	}
+
+	ledger, err := readLedger(group)
+	if err != nil {
+		return err
+	}
+	renamed := false
+	for i := range ledger {
+		if ledger[i].User == oldName {
+			ledger[i].User = newName
+			renamed = true
+		}
+	}
+	if renamed {
+		if err := writeLedger(group, ledger); err != nil {
+			return err
+		}
+	}
+
+	debts, err := readDebts(group)
+	if err != nil {
+		return fmt.Errorf("failed to read skip debts: %w", err)
+	}
+	if debt, ok := debts[oldName]; ok {
+		// Debt is at most one turn per user
+		if debts[newName] < debt {
+			debts[newName] = debt
+		}
+		delete(debts, oldName)
+		if err := writeDebts(group, debts); err != nil {
+			return err
+		}
+	}
+
+	last, err := readLastAssigned(group)
+	if err != nil {
+		return fmt.Errorf("failed to read last assignments: %w", err)
+	}
+	if t, ok := last[oldName]; ok {
+		if t.After(last[newName]) {
+			last[newName] = t
+		}
+		delete(last, oldName)
+		if err := writeLastAssigned(group, last); err != nil {
+			return err
+		}
+	}
+
+	state, err := readStoredState(group)
+	if err != nil {
+		return fmt.Errorf("failed to read counts: %w", err)
+	}
+	renamed = false
+	if _, ok := state.Counts.totals()[oldName]; ok {
+		state.Counts.renameUser(oldName, newName)
+		renamed = true
+	}
+	if state.Reset != nil && state.Reset.renameUser(oldName, newName) {
+		renamed = true
+	}
+	if renamed {
+		if err := writeStoredState(group, state); err != nil {
+			return fmt.Errorf("failed to write counts: %w", err)
+		}
+	}
+	pruned, err := readPrunedCounts(group)
+	if err != nil {
+		return err
+	}
+	if _, ok := pruned.totals()[oldName]; ok {
+		pruned.renameUser(oldName, newName)
+		if err := writePrunedCounts(group, pruned); err != nil {
+			return err
+		}
+	}
+
+	err = syncSharedState(group, func(lastIndex *int, counts map[string]int) {
+		if count, ok := counts[oldName]; ok {
+			counts[newName] += count
+			delete(counts, oldName)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	recordStateChange(fmt.Sprintf("Rename user %s to %s in %s", oldName, newName, group))
+	return nil
+}
+
+// renameUserField returns a log record edit replacing the user oldName with newName.
+func renameUserField(oldName, newName string) func(record map[string]json.RawMessage) error {
+	return func(record map[string]json.RawMessage) error {
+		var user string
+		if err := json.Unmarshal(record["user"], &user); err != nil || user != oldName {
+			return nil
+		}
+		value, err := json.Marshal(newName)
+		if err != nil {
+			return err
+		}
+		record["user"] = value
+		return nil
+	}
+}
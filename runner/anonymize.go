@@ -0,0 +1,400 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// userLogs are the logs of a group whose records name their user.
+var userLogs = []string{"assignments.log", "skips.log", "declines.log", "durations.log"}
+
+// AnonymizeOptions controls AnonymizeUser.
+type AnonymizeOptions struct {
+	Pseudonym string    // Name that replaces the user; a random one such as anon-3f9a1c2e when empty
+	Before    time.Time // Only records and counts from before this time are anonymized; all of them when zero
+	DryRun    bool      // Find the records of the user without rewriting them
+}
+
+// AnonymizeResult describes the records of a user that AnonymizeUser
+// pseudonymized, as they were before, e.g. to answer an access request.
+type AnonymizeResult struct {
+	User      string            `json:"user"`
+	Pseudonym string            `json:"pseudonym"`
+	Before    string            `json:"before,omitempty"` // Time records were anonymized before, in RFC 3339 format
+	Groups    []AnonymizedGroup `json:"groups"`
+	Pauses    []Pause           `json:"pauses,omitempty"` // Pauses of the user, which are dropped
+}
+
+// AnonymizedGroup is the part of an AnonymizeResult in one group.
+type AnonymizedGroup struct {
+	Group   string                       `json:"group"`
+	Records map[string][]json.RawMessage `json:"records,omitempty"` // Records naming the user, keyed by log
+	Open    []OpenAssignment             `json:"open,omitempty"`    // Open assignments of the user
+	Count   int                          `json:"count"`             // Assignments counted for the user that are now counted for the pseudonym
+}
+
+// RecordCount returns the number of log records of the user in every group.
+func (r *AnonymizeResult) RecordCount() int {
+	n := 0
+	for _, g := range r.Groups {
+		for _, records := range g.Records {
+			n += len(records)
+		}
+	}
+	return n
+}
+
+// AnonymizeUser replaces a user with a pseudonym in the stored state of
+// every group, such as for a deletion request: the user and actor fields of
+// their assignment, skip, decline and duration log records, their open
+// assignments and their counts, which keep counting for the pseudonym so
+// that totals, fairness and statistics stay the same. Names listed as the
+// user's aliases are replaced too. Their skip debts, times of last
+// assignment and pauses are dropped.
+//
+// Without a time to anonymize before, the user must no longer be a member of
+// any group. With one, only log records, open assignments and daily counts
+// from before it are replaced and the rest of their state is kept, so
+// members can be anonymized too.
+//
+// Earlier versions of the state kept in the git history of the data
+// directory and in archives of deleted groups are not rewritten.
+func AnonymizeUser(ctx context.Context, user string, opts AnonymizeOptions) (*AnonymizeResult, error) {
+	if user == "" {
+		return nil, fmt.Errorf("user is required")
+	}
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	confs := make(map[string]*AssigneeGroupConfig, len(groups))
+	for _, group := range groups {
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil {
+			return nil, &ConfigError{Group: group, Err: err}
+		}
+		for _, member := range groupConf.Users {
+			if member == user && opts.Before.IsZero() {
+				return nil, &ConfigError{Group: group, Err: fmt.Errorf("user %s is still a member of the group", user)}
+			}
+			if opts.Pseudonym != "" && member == opts.Pseudonym {
+				return nil, &ConfigError{Group: group, Err: fmt.Errorf("pseudonym %s is a member of the group", opts.Pseudonym)}
+			}
+		}
+		confs[group] = groupConf
+	}
+
+	result := &AnonymizeResult{User: user, Pseudonym: opts.Pseudonym, Groups: []AnonymizedGroup{}}
+	if result.Pseudonym == "" {
+		if result.Pseudonym, err = newPseudonym(); err != nil {
+			return nil, err
+		}
+	}
+	if !opts.Before.IsZero() {
+		result.Before = opts.Before.Format(time.RFC3339)
+	}
+	for _, group := range groups {
+		names := map[string]bool{user: true}
+		for _, alias := range confs[group].Aliases[user] {
+			names[alias] = true
+		}
+		anonymized, err := anonymizeGroup(ctx, group, confs[group], names, result.Pseudonym, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to anonymize %s in %s: %w", user, group, err)
+		}
+		if anonymized != nil {
+			result.Groups = append(result.Groups, *anonymized)
+		}
+	}
+
+	if result.Pauses, err = dropPauses(user, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// newPseudonym returns a random name to replace a user with.
+func newPseudonym() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate pseudonym: %w", err)
+	}
+	return "anon-" + hex.EncodeToString(b), nil
+}
+
+// anonymizeGroup replaces the names of a user with the pseudonym in the
+// stored state of a group. It returns nil when the group has no state of the user.
+func anonymizeGroup(ctx context.Context, group string, groupConf *AssigneeGroupConfig, names map[string]bool, pseudonym string, opts AnonymizeOptions) (*AnonymizedGroup, error) {
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	// Counts as they were, so only the counts moved here change the shared state
+	countsBefore := readCounts(group)
+
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	loc, err := groupConf.location()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	before := func(timestamp string) bool {
+		if opts.Before.IsZero() {
+			return true
+		}
+		t, err := time.Parse(time.RFC3339, timestamp)
+		return err == nil && t.Before(opts.Before)
+	}
+
+	anonymized := &AnonymizedGroup{Group: group, Records: map[string][]json.RawMessage{}}
+	changed := false
+	for _, name := range userLogs {
+		path := filepath.Join(groupDir, name)
+		records, err := readLogRecords(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for _, record := range records {
+			var timestamp, user string
+			json.Unmarshal(record["timestamp"], &timestamp)
+			json.Unmarshal(record["user"], &user)
+			if !names[user] || !before(timestamp) {
+				continue
+			}
+			original, err := json.Marshal(record)
+			if err != nil {
+				return nil, err
+			}
+			anonymized.Records[name] = append(anonymized.Records[name], original)
+		}
+		if len(anonymized.Records[name]) == 0 || opts.DryRun {
+			continue
+		}
+		if err := rewriteLog(path, anonymizeRecord(names, pseudonym, before)); err != nil {
+			return nil, fmt.Errorf("failed to rewrite %s: %w", name, err)
+		}
+		changed = true
+	}
+
+	ledger, err := readLedger(group)
+	if err != nil {
+		return nil, err
+	}
+	rewritten := false
+	for i := range ledger {
+		if !before(ledger[i].AssignedAt) {
+			continue
+		}
+		if names[ledger[i].User] {
+			anonymized.Open = append(anonymized.Open, ledger[i])
+			ledger[i].User = pseudonym
+			rewritten = true
+		}
+		if names[ledger[i].AcknowledgedBy] {
+			ledger[i].AcknowledgedBy = pseudonym
+			rewritten = true
+		}
+	}
+	if rewritten && !opts.DryRun {
+		if err := writeLedger(group, ledger); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+
+	buckets, err := readCountBuckets(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read counts: %w", err)
+	}
+	for name := range names {
+		anonymized.Count += buckets.anonymizeUser(name, pseudonym, opts.Before, loc)
+	}
+	if anonymized.Count > 0 && !opts.DryRun {
+		if err := writeCountBuckets(group, buckets); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	pruned, err := readPrunedCounts(group)
+	if err != nil {
+		return nil, err
+	}
+	moved := 0
+	for name := range names {
+		moved += pruned.anonymizeUser(name, pseudonym, opts.Before, loc)
+	}
+	if moved > 0 && !opts.DryRun {
+		if err := writePrunedCounts(group, pruned); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+
+	if opts.Before.IsZero() && !opts.DryRun {
+		debts, err := readDebts(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read skip debts: %w", err)
+		}
+		last, err := readLastAssigned(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read last assignments: %w", err)
+		}
+		droppedDebt, droppedLast := false, false
+		for name := range names {
+			if _, ok := debts[name]; ok {
+				delete(debts, name)
+				droppedDebt = true
+			}
+			if _, ok := last[name]; ok {
+				delete(last, name)
+				droppedLast = true
+			}
+		}
+		if droppedDebt {
+			if err := writeDebts(group, debts); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+		if droppedLast {
+			if err := writeLastAssigned(group, last); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+
+		// The assignments logged before a reset moved to the pseudonym with the log
+		state, err := readStoredState(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read counts: %w", err)
+		}
+		if state.Reset != nil {
+			renamed := false
+			for name := range names {
+				if state.Reset.renameUser(name, pseudonym) {
+					renamed = true
+				}
+			}
+			if renamed {
+				if err := writeStoredState(group, state); err != nil {
+					return nil, fmt.Errorf("failed to write counts: %w", err)
+				}
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		if err := syncSharedState(group, stateChange(-1, countsBefore, -1, readCounts(group))); err != nil {
+			return nil, err
+		}
+		// The message names the pseudonym only, as it is kept in the git history
+		recordStateChange(fmt.Sprintf("Anonymize a user as %s in %s", pseudonym, group))
+	}
+	if len(anonymized.Records) == 0 && len(anonymized.Open) == 0 && anonymized.Count == 0 && moved == 0 {
+		return nil, nil
+	}
+	return anonymized, nil
+}
+
+// anonymizeRecord returns a log record edit replacing the names of a user
+// with the pseudonym in the user and actor fields of records with a time
+// that before accepts. An actor such as slack:alice becomes slack:anon-3f9a1c2e.
+func anonymizeRecord(names map[string]bool, pseudonym string, before func(timestamp string) bool) func(record map[string]json.RawMessage) error {
+	return func(record map[string]json.RawMessage) error {
+		var timestamp, user, actor string
+		if err := json.Unmarshal(record["timestamp"], &timestamp); err != nil || !before(timestamp) {
+			return nil
+		}
+		if err := json.Unmarshal(record["user"], &user); err != nil || !names[user] {
+			return nil
+		}
+		value, err := json.Marshal(pseudonym)
+		if err != nil {
+			return err
+		}
+		record["user"] = value
+		if json.Unmarshal(record["actor"], &actor) != nil {
+			return nil
+		}
+		prefix, name := "", actor
+		if i := strings.LastIndex(actor, ":"); i >= 0 {
+			prefix, name = actor[:i+1], actor[i+1:]
+		}
+		if names[name] {
+			if record["actor"], err = json.Marshal(prefix + pseudonym); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// anonymizeUser moves the counts of name to the pseudonym and returns how
+// many were moved: those of the days before the one containing before, in
+// loc, or every count, including the base, when before is zero.
+func (b *countBuckets) anonymizeUser(name, pseudonym string, before time.Time, loc *time.Location) int {
+	moved := 0
+	if before.IsZero() {
+		if count, ok := b.Base[name]; ok {
+			b.Base[pseudonym] += count
+			delete(b.Base, name)
+			moved += count
+		}
+	}
+	for date, day := range b.Days {
+		if !before.IsZero() && date >= dayOf(before.In(loc)) {
+			continue
+		}
+		if count, ok := day[name]; ok {
+			day[pseudonym] += count
+			delete(day, name)
+			moved += count
+		}
+	}
+	return moved
+}
+
+// dropPauses drops the pauses of a user and returns them, unless only
+// records from before a time are anonymized.
+func dropPauses(user string, opts AnonymizeOptions) ([]Pause, error) {
+	if !opts.Before.IsZero() {
+		return nil, nil
+	}
+	pauses, err := readPauses()
+	if err != nil {
+		return nil, err
+	}
+	var dropped []Pause
+	kept := pauses[:0]
+	for _, p := range pauses {
+		if p.User == user {
+			dropped = append(dropped, p)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if len(dropped) == 0 || opts.DryRun {
+		return dropped, nil
+	}
+	if err := writePauses(kept); err != nil {
+		return nil, err
+	}
+	recordStateChange("Drop the pauses of an anonymized user")
+	return dropped, nil
+}
@@ -0,0 +1,256 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Policies for failed availability checks, set with on_availability_error.
+const (
+	AvailabilityErrorFail              = "fail"               // Fail the assignment (default)
+	AvailabilityErrorAssumeAvailable   = "assume_available"   // Treat users whose check failed as available
+	AvailabilityErrorAssumeUnavailable = "assume_unavailable" // Skip users whose check failed
+)
+
+// availabilityErrorPolicy returns the group's policy for failed availability checks.
+func (c *AssigneeGroupConfig) availabilityErrorPolicy() (string, error) {
+	switch c.OnAvailabilityError {
+	case "":
+		return AvailabilityErrorFail, nil
+	case AvailabilityErrorFail, AvailabilityErrorAssumeAvailable, AvailabilityErrorAssumeUnavailable:
+		return c.OnAvailabilityError, nil
+	default:
+		return "", fmt.Errorf("unknown on_availability_error policy: %s", c.OnAvailabilityError)
+	}
+}
+
+// availabilityBudget returns the time the availability checks of one
+// assignment may take in total, or zero without a limit.
+func (c *AssigneeGroupConfig) availabilityBudget() (time.Duration, error) {
+	if c.AvailabilityBudget == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.AvailabilityBudget)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid availability_budget: %s", c.AvailabilityBudget)
+	}
+	return d, nil
+}
+
+// availabilityOverride returns the availability of a user listed in
+// never_available or always_available, and false when it is up to the
+// checker. never_available takes precedence.
+func (c *AssigneeGroupConfig) availabilityOverride(user string) (bool, bool) {
+	for _, u := range c.NeverAvailable {
+		if u == user {
+			return false, true
+		}
+	}
+	for _, u := range c.AlwaysAvailable {
+		if u == user {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// overrideChecker returns a copy of conf checking availability with checker
+// instead of its own, and the checker it replaced. Without a checker, or with
+// the configured one, conf itself is returned and nothing was replaced.
+func overrideChecker(conf *AssigneeGroupConfig, checker string) (*AssigneeGroupConfig, string, error) {
+	if checker == "" || checker == conf.AvailabilityChecker {
+		return conf, "", nil
+	}
+	known := false
+	for _, name := range AvailabilityCheckerNames {
+		known = known || name == checker
+	}
+	if !known {
+		return nil, "", &InvalidOptionError{Option: "availability checker", Value: checker, Err: fmt.Errorf("expected one of %s", strings.Join(AvailabilityCheckerNames, ", "))}
+	}
+	replaced := conf.AvailabilityChecker
+	conf = conf.clone()
+	conf.AvailabilityChecker = checker
+	return conf, replaced, nil
+}
+
+// availabilityCheck checks the users of a group with its availability
+// checker, applying the group's policy to checks that fail and to the
+// remaining users once the availability budget is spent.
+type availabilityCheck struct {
+	group    string
+	conf     *AssigneeGroupConfig
+	checker  AvailabilityChecker
+	policy   string
+	budget   time.Duration   // Total time the checks may take, zero without a limit
+	deadline time.Time       // End of the budget
+	exceeded bool            // The budget was spent and the policy applies to every further user
+	bulk     map[string]bool // Results of a bulk check, nil when users are checked one by one
+	failed   []string        // Users whose check failed and who were handled by the policy
+}
+
+// newAvailabilityCheck prepares checking users of a group, checking them all
+// in one call when the checker supports it. When that call fails and the
+// policy doesn't fail the assignment, users are checked one by one instead.
+func newAvailabilityCheck(ctx context.Context, group string, conf *AssigneeGroupConfig, checker AvailabilityChecker, users []string) (*availabilityCheck, error) {
+	policy, err := conf.availabilityErrorPolicy()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	budget, err := conf.availabilityBudget()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	c := &availabilityCheck{group: group, conf: conf, checker: checker, policy: policy, budget: budget}
+	if budget > 0 {
+		c.deadline = time.Now().Add(budget)
+	}
+
+	bulk, ok := checker.(BulkAvailabilityChecker)
+	if !ok {
+		return c, nil
+	}
+	var checked, ids []string
+	for _, user := range users {
+		if _, ok := conf.availabilityOverride(user); !ok {
+			checked = append(checked, user)
+			ids = append(ids, conf.availabilityID(user))
+		}
+	}
+	if len(checked) == 0 {
+		c.bulk = map[string]bool{}
+		return c, nil
+	}
+	checkCtx, cancel := c.withBudget(ctx)
+	byID, err := bulk.AreAvailable(checkCtx, ids)
+	cancel()
+	if err != nil {
+		err = &AvailabilityError{User: strings.Join(checked, ","), Err: c.budgetError(ctx, err)}
+		if policy == AvailabilityErrorFail || ctx.Err() != nil {
+			return nil, err
+		}
+		if c.exceeded {
+			log.Printf("Warning: %v; assuming every user %s as configured for group %s", err, c.assumption(), group)
+			return c, nil
+		}
+		// Check users one by one, so the policy only applies to those whose check fails
+		log.Printf("Warning: %v; checking users one by one", err)
+		return c, nil
+	}
+	c.bulk = make(map[string]bool, len(checked))
+	for _, user := range checked {
+		c.bulk[user] = byID[conf.availabilityID(user)]
+	}
+	return c, nil
+}
+
+// available reports whether a user is available. Users listed in
+// always_available or never_available aren't checked.
+func (c *availabilityCheck) available(ctx context.Context, user string) (bool, error) {
+	if available, ok := c.conf.availabilityOverride(user); ok {
+		return available, nil
+	}
+	if c.bulk != nil {
+		return c.bulk[user], nil
+	}
+	if c.exceeded {
+		// The budget was already reported when it ran out
+		return c.assume(ctx, &AvailabilityError{User: user, Err: c.budgetError(ctx, nil)}, user)
+	}
+	if c.budget > 0 && !time.Now().Before(c.deadline) {
+		return c.recover(ctx, &AvailabilityError{User: user, Err: c.budgetError(ctx, nil)}, user)
+	}
+
+	checkCtx, cancel := c.withBudget(ctx)
+	defer cancel()
+	ok, err := c.checker.IsAvailable(checkCtx, c.conf.availabilityID(user))
+	if err != nil {
+		return c.recover(ctx, &AvailabilityError{User: user, Err: c.budgetError(ctx, err)}, user)
+	}
+	return ok, nil
+}
+
+// skipReason returns the reason an unavailable user is recorded with in skips.log.
+func (c *availabilityCheck) skipReason(user string) string {
+	if available, ok := c.conf.availabilityOverride(user); ok && !available {
+		return skipNever
+	}
+	for _, f := range c.failed {
+		if f == user {
+			return skipCheckFailed
+		}
+	}
+	return skipUnavailable
+}
+
+// withBudget returns ctx limited to the rest of the budget.
+func (c *availabilityCheck) withBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, c.deadline)
+}
+
+// budgetError returns the error of a check that failed with err, which is
+// replaced when the check failed because the budget ran out. A nil err
+// describes a check skipped because the budget was spent before.
+func (c *availabilityCheck) budgetError(ctx context.Context, err error) error {
+	if ctx.Err() != nil && err == nil {
+		return ctx.Err()
+	}
+	if c.budget <= 0 || ctx.Err() != nil || time.Now().Before(c.deadline) {
+		return err
+	}
+	c.exceeded = true
+	return fmt.Errorf("availability budget of %s exceeded", c.budget)
+}
+
+// recover applies the policy to the failed check of a user, logging the
+// error: it returns the availability assumed for them, or err when the
+// policy is to fail. Cancellation of ctx always fails the check.
+func (c *availabilityCheck) recover(ctx context.Context, err error, user string) (bool, error) {
+	if c.policy == AvailabilityErrorFail || ctx.Err() != nil {
+		return false, err
+	}
+	if c.exceeded {
+		log.Printf("Warning: %v; assuming the remaining users %s as configured for group %s", err, c.assumption(), c.group)
+	} else {
+		log.Printf("Warning: %v; assuming %s as configured for group %s", err, c.assumption(), c.group)
+	}
+	return c.assume(ctx, err, user)
+}
+
+// assume applies the policy to a user without logging.
+func (c *availabilityCheck) assume(ctx context.Context, err error, user string) (bool, error) {
+	if c.policy == AvailabilityErrorFail || ctx.Err() != nil {
+		return false, err
+	}
+	c.failed = append(c.failed, user)
+	return c.policy == AvailabilityErrorAssumeAvailable, nil
+}
+
+// assumption describes the availability the policy assumes.
+func (c *availabilityCheck) assumption() string {
+	if c.policy == AvailabilityErrorAssumeAvailable {
+		return "available"
+	}
+	return "unavailable"
+}
+
+// checkFailed returns the users of skipped whose check failed.
+func (c *availabilityCheck) checkFailed(skipped []string) []string {
+	failed := make(map[string]bool, len(c.failed))
+	for _, user := range c.failed {
+		failed[user] = true
+	}
+	var users []string
+	for _, user := range skipped {
+		if failed[user] {
+			users = append(users, user)
+		}
+	}
+	return users
+}
@@ -0,0 +1,233 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// countsSchemaVersion is the version of the counts format read by this version.
+// Version 1 was a flat map of lifetime counts keyed by user. Counts stored in
+// state.json are versioned by the state and leave the version out.
+const countsSchemaVersion = 2
+
+// dayLayout formats the dates counts are bucketed by, in the time zone of the group.
+const dayLayout = "2006-01-02"
+
+// countBuckets are the counts of a group, as stored in state.json and in
+// counts.json of layout version 1: assignments per day and user,
+// so counts over any period can be computed, plus counts that can't be
+// attributed to a day, such as those migrated from the flat format.
+//
+//	{"version": 2, "base": {"alice": 12}, "days": {"2024-05-15": {"alice": 1, "bob": 2}}}
+//
+// The count of a user is their base plus their counts of every day.
+type countBuckets struct {
+	Version int                       `json:"version,omitempty"`
+	Base    map[string]int            `json:"base"`
+	Days    map[string]map[string]int `json:"days"`
+}
+
+// newCountBuckets returns empty counts.
+func newCountBuckets() *countBuckets {
+	return &countBuckets{Version: countsSchemaVersion, Base: map[string]int{}, Days: map[string]map[string]int{}}
+}
+
+// parseCountBuckets decodes counts.json of layout version 1 in either format. Flat counts of
+// version 1 become the base, as the days they were made on are unknown.
+func parseCountBuckets(data []byte) (*countBuckets, error) {
+	b := newCountBuckets()
+	var flat map[string]int
+	if err := json.Unmarshal(data, &flat); err == nil {
+		for user, count := range flat {
+			b.Base[user] = count
+		}
+		return b, nil
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Version > countsSchemaVersion {
+		return nil, fmt.Errorf("unsupported counts version %d", b.Version)
+	}
+	if b.Base == nil {
+		b.Base = map[string]int{}
+	}
+	if b.Days == nil {
+		b.Days = map[string]map[string]int{}
+	}
+	return b, nil
+}
+
+// totals returns the lifetime count of every stored user.
+func (b *countBuckets) totals() map[string]int {
+	totals := make(map[string]int, len(b.Base))
+	for user, count := range b.Base {
+		totals[user] += count
+	}
+	for _, day := range b.Days {
+		for user, count := range day {
+			totals[user] += count
+		}
+	}
+	return totals
+}
+
+// since returns the counts of the days from the one containing t on.
+func (b *countBuckets) since(t time.Time) map[string]int {
+	from := dayOf(t)
+	counts := map[string]int{}
+	for date, day := range b.Days {
+		if date < from {
+			continue
+		}
+		for user, count := range day {
+			counts[user] += count
+		}
+	}
+	return counts
+}
+
+// increment counts an assignment of user at time t.
+func (b *countBuckets) increment(user string, t time.Time) {
+	date := dayOf(t)
+	if b.Days[date] == nil {
+		b.Days[date] = map[string]int{}
+	}
+	b.Days[date][user]++
+}
+
+// setTotals makes the lifetime counts equal counts, keeping the daily
+// counts where possible: the base of each user absorbs the difference,
+// users counted less than their daily counts lose them, and users missing
+// from counts are removed.
+func (b *countBuckets) setTotals(counts map[string]int) {
+	days := map[string]int{}
+	for _, day := range b.Days {
+		for user, count := range day {
+			days[user] += count
+		}
+	}
+	for date, day := range b.Days {
+		for user := range day {
+			if count, ok := counts[user]; !ok || count < days[user] {
+				delete(day, user)
+			}
+		}
+		if len(day) == 0 {
+			delete(b.Days, date)
+		}
+	}
+
+	b.Base = make(map[string]int, len(counts))
+	for user, count := range counts {
+		if count >= days[user] {
+			b.Base[user] = count - days[user]
+		} else {
+			b.Base[user] = count
+		}
+	}
+}
+
+// dayOf returns the date of t that its counts are bucketed by, in the
+// location of t, which callers set to the time zone of the group.
+func dayOf(t time.Time) string {
+	return t.Format(dayLayout)
+}
+
+// location returns the time zone of the group's days and weeks, the local
+// time zone of the host by default.
+func (c *AssigneeGroupConfig) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return loc, nil
+}
+
+// groupLocation returns the time zone of a group, or the local one when
+// its config can't be read or names an invalid time zone, which ValidateGroup
+// reports. It is used where counting an assignment must not fail.
+func groupLocation(group string) *time.Location {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return time.Local
+	}
+	loc, err := groupConf.location()
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// renameUser moves the counts of oldName to newName.
+func (b *countBuckets) renameUser(oldName, newName string) {
+	if count, ok := b.Base[oldName]; ok {
+		b.Base[newName] += count
+		delete(b.Base, oldName)
+	}
+	for _, day := range b.Days {
+		if count, ok := day[oldName]; ok {
+			day[newName] += count
+			delete(day, oldName)
+		}
+	}
+}
+
+// readCountBuckets reads the counts of a group from its stored state.
+// A group without stored state has empty counts.
+func readCountBuckets(group string) (*countBuckets, error) {
+	s, err := readStoredState(group)
+	if err != nil {
+		return nil, err
+	}
+	return s.Counts, nil
+}
+
+// writeCountBuckets replaces the counts of a group, keeping its rotation
+// position. Stored state that can't be read is replaced entirely, as the
+// counts are then rewritten from scratch, e.g. by a repair.
+func writeCountBuckets(group string, b *countBuckets) error {
+	s, err := readStoredState(group)
+	if err != nil {
+		s = newStoredState()
+	}
+	s.Counts = b
+	if err := writeStoredState(group, s); err != nil {
+		return fmt.Errorf("failed to write counts: %w", err)
+	}
+	return nil
+}
+
+// PeriodCounts returns the assignments of every user of a group in the
+// current day, week (starting Monday) or month, in the group's time zone.
+func PeriodCounts(group, period string) (map[string]int, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	loc, err := groupConf.location()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	start, err := periodStart(period, timeNow().In(loc))
+	if err != nil {
+		return nil, err
+	}
+	b, err := readCountBuckets(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read counts: %w", err)
+	}
+
+	counts := b.since(start)
+	groupConf.mergeAliasCounts(counts)
+	for _, user := range groupConf.Users {
+		if _, ok := counts[user]; !ok {
+			counts[user] = 0
+		}
+	}
+	return counts, nil
+}
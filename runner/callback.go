@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultCallbackTimeout = 30 * time.Second
+
+// Callback hands every assignment of a group to an external program or
+// HTTP endpoint, e.g. to set the assignee of a ticket in a system without
+// a built-in integration:
+//
+//	callback:
+//	  command: [/usr/local/bin/assign-ticket, --project, OPS]
+//	  timeout: 10s
+//	  rollback: true
+type Callback struct {
+	Command  []string          `yaml:"command"`  // Executable and arguments, run with the payload on stdin
+	Url      string            `yaml:"url"`      // Endpoint the payload is POSTed to instead
+	Headers  map[string]string `yaml:"headers"`  // Headers sent to url, e.g. Authorization
+	Timeout  string            `yaml:"timeout"`  // Time the callback may take, e.g. 10s (default 30s)
+	Rollback bool              `yaml:"rollback"` // Undo the assignment when the callback fails
+	Trace    bool              `yaml:"trace"`    // Trace every selection and pass the trace in the payload
+}
+
+// CallbackPayload is the JSON document a callback receives.
+type CallbackPayload struct {
+	ID        string            `json:"id"`                 // ID of the assignment
+	Group     string            `json:"group"`              // Group the user was assigned from
+	User      string            `json:"user"`               // The assigned user
+	Role      string            `json:"role,omitempty"`     // Role the user was assigned for in a multi-role assignment
+	Timestamp string            `json:"timestamp"`          // Time of the assignment in RFC 3339 format
+	Priority  string            `json:"priority,omitempty"` // Priority the assignment was made for
+	Reason    string            `json:"reason,omitempty"`   // Why the user was selected, e.g. "round_robin next"
+	Data      map[string]string `json:"data,omitempty"`     // AssignOptions.CallbackData, such as the ticket to assign
+	Trace     *SelectionTrace   `json:"trace,omitempty"`    // How the user was selected, with trace: true or AssignOptions.Explain
+}
+
+// enabled reports whether a callback is configured.
+func (c Callback) enabled() bool {
+	return len(c.Command) > 0 || c.Url != ""
+}
+
+// timeout validates the callback and returns the time it may take.
+func (c Callback) timeout() (time.Duration, error) {
+	if len(c.Command) > 0 && c.Url != "" {
+		return 0, fmt.Errorf("callback needs either command or url, not both")
+	}
+	if len(c.Headers) > 0 && c.Url == "" {
+		return 0, fmt.Errorf("callback headers need a url")
+	}
+	if c.Timeout == "" {
+		return defaultCallbackTimeout, nil
+	}
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid callback timeout: %s", c.Timeout)
+	}
+	return d, nil
+}
+
+// run invokes the callback with payload. A command fails when it exits
+// with a non-zero status, an endpoint when it answers with a status other
+// than 2xx; the error includes the command's stderr or the response body.
+func (c Callback) run(ctx context.Context, payload CallbackPayload) error {
+	timeout, err := c.timeout()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if len(c.Command) > 0 {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stderr = &stderr
+		cmd.Env = append(os.Environ(),
+			"AUTOASSIGNER_ASSIGNMENT_ID="+payload.ID,
+			"AUTOASSIGNER_GROUP="+payload.Group,
+			"AUTOASSIGNER_USER="+payload.User,
+			"AUTOASSIGNER_ROLE="+payload.Role,
+		)
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%s: %w: %s", c.Command[0], err, msg)
+			}
+			return fmt.Errorf("%s: %w", c.Command[0], err)
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return fmt.Errorf("unexpected status %s: %s", resp.Status, msg)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"autoassigner/selector"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StrategyChain is the strategy of a group or route: a single strategy, or
+// a list of strategies where each breaks the ties of the ones before it,
+// such as [least_assigned, least_recently_assigned, round_robin]. A chain is
+// held as its strategy names joined by commas, the form AssignOptions.Strategy
+// and the assignment log use.
+type StrategyChain string
+
+// UnmarshalYAML reads a single strategy or a list of strategies.
+func (s *StrategyChain) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = StrategyChain(value.Value)
+		return nil
+	}
+	var names []string
+	if err := value.Decode(&names); err != nil {
+		return fmt.Errorf("expected a strategy or a list of strategies: %w", err)
+	}
+	*s = StrategyChain(strings.Join(names, ","))
+	return nil
+}
+
+// MarshalYAML writes a chain as a list and a single strategy as a string.
+func (s StrategyChain) MarshalYAML() (interface{}, error) {
+	if names := s.names(); len(names) > 1 {
+		return names, nil
+	}
+	return string(s), nil
+}
+
+// JSONSchema describes a strategy or a list of strategies.
+func (StrategyChain) JSONSchema() map[string]interface{} {
+	name := map[string]interface{}{"type": "string", "enum": StrategyNames}
+	return map[string]interface{}{"oneOf": []interface{}{
+		name,
+		map[string]interface{}{"type": "array", "items": name, "minItems": 1},
+	}}
+}
+
+// names returns the strategies of the chain in order.
+func (s StrategyChain) names() []string {
+	return strategyNames(string(s))
+}
+
+// strategyNames splits a strategy, which may be a comma-separated chain,
+// into the names of its strategies.
+func strategyNames(strategy string) []string {
+	if strategy == "" {
+		return nil
+	}
+	names := strings.Split(strategy, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names
+}
+
+// chainUses reports whether strategy, which may be a chain, includes name.
+func chainUses(strategy, name string) bool {
+	for _, n := range strategyNames(strategy) {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// chainStrategies returns the strategies making up strategy: the members of
+// a chain, or strategy itself.
+func chainStrategies(strategy AssignmentStrategy) []AssignmentStrategy {
+	c, ok := strategy.(*selector.Composite)
+	if !ok {
+		return []AssignmentStrategy{strategy}
+	}
+	members := make([]AssignmentStrategy, len(c.Strategies))
+	for i, s := range c.Strategies {
+		members[i] = s
+	}
+	return members
+}
+
+// setLastAssigned gives the least_recently_assigned strategies of strategy
+// the time each user was last assigned.
+func setLastAssigned(strategy AssignmentStrategy, last map[string]time.Time) {
+	for _, s := range chainStrategies(strategy) {
+		if lra, ok := s.(*selector.LeastRecentlyAssigned); ok {
+			lra.Last = last
+		}
+	}
+}
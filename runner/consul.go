@@ -0,0 +1,330 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// consulState is the rotation state of a group, kept under a single key so
+// that it is updated with one check-and-set.
+type consulState struct {
+	LastIndex int            `json:"last_index"`
+	Counts    map[string]int `json:"counts"`
+}
+
+// consulRead is the state of a group as last read, together with the modify
+// index its check-and-set is made against. A zero index means the key did not exist.
+type consulRead struct {
+	state       consulState
+	modifyIndex uint64
+}
+
+// ConsulStorageManager implements StorageManager and CountManager on the
+// Consul KV store. Each assignment is committed with a check-and-set against
+// the state it was selected from, so two hosts or replicas assigning at the
+// same time cannot both commit the same turn; the slower one fails with a
+// StateConflictError. The files in the data directory are still written and
+// mirror the state for the commands that read them.
+type ConsulStorageManager struct {
+	DefaultStorageManager
+	Address string
+	Token   string
+	Prefix  string
+	Client  *http.Client
+
+	reads map[string]*consulRead // Working copy of each group's state since it was read
+}
+
+// NewConsulStorageManager returns a ConsulStorageManager for the given settings.
+func NewConsulStorageManager(conf config.ConsulConfig) *ConsulStorageManager {
+	prefix := conf.Prefix
+	if prefix == "" {
+		prefix = "autoassigner"
+	}
+	return &ConsulStorageManager{
+		Address: strings.TrimSuffix(conf.Address, "/"),
+		Token:   conf.Token,
+		Prefix:  strings.Trim(prefix, "/"),
+		Client:  http.DefaultClient,
+		reads:   map[string]*consulRead{},
+	}
+}
+
+func (m *ConsulStorageManager) ReadLastIndex(ctx context.Context, group string) (int, error) {
+	read, err := m.read(ctx, group)
+	if err != nil {
+		return -1, err
+	}
+	return read.state.LastIndex, nil
+}
+
+func (m *ConsulStorageManager) WriteLastIndex(ctx context.Context, group string, index int) error {
+	read, err := m.read(ctx, group)
+	if err != nil {
+		return err
+	}
+	if err := writeLastIndex(group, index); err != nil {
+		return err
+	}
+	read.state.LastIndex = index
+	return nil
+}
+
+func (m *ConsulStorageManager) GetCounts(ctx context.Context, group string) (map[string]int, error) {
+	read, err := m.read(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if len(read.state.Counts) == 0 {
+		return nil, fmt.Errorf("no counts found for group %s", group)
+	}
+	counts := make(map[string]int, len(read.state.Counts))
+	for user, count := range read.state.Counts {
+		counts[user] = count
+	}
+	return counts, nil
+}
+
+func (m *ConsulStorageManager) IncrementCount(ctx context.Context, group, user string) error {
+	read, err := m.read(ctx, group)
+	if err != nil {
+		return err
+	}
+	read.state.Counts[user]++
+
+	// Consul holds the lifetime counts; the daily buckets are kept in the local file
+	if err := incrementCount(group, user); err != nil {
+		return err
+	}
+	return writeCounts(group, read.state.Counts)
+}
+
+func (m *ConsulStorageManager) ResetCounts(ctx context.Context, group string) error {
+	return ResetCounts(ctx, group)
+}
+
+// BeginTransaction snapshots the local files of a group. Its Commit stores
+// the working copy of the group's state in Consul with a check-and-set.
+func (m *ConsulStorageManager) BeginTransaction(ctx context.Context, group string) (StateTransaction, error) {
+	if _, err := m.read(ctx, group); err != nil {
+		return nil, err
+	}
+	files, err := beginFileTransaction(group)
+	if err != nil {
+		return nil, err
+	}
+	return &consulTransaction{ctx: ctx, m: m, group: group, files: files}, nil
+}
+
+// CheckWritable checks the data directory of the group, whose files mirror
+// the state, and writes and deletes a probe key next to its state in Consul.
+func (m *ConsulStorageManager) CheckWritable(ctx context.Context, group string) error {
+	if err := m.DefaultStorageManager.CheckWritable(ctx, group); err != nil {
+		return err
+	}
+	key := "/v1/kv/" + m.Prefix + "/" + group + "/preflight"
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		resp, err := m.do(ctx, method, key, []byte("preflight"))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to write to consul: unexpected status %s", resp.Status)
+		}
+	}
+	return nil
+}
+
+// read returns the working copy of a group's state, fetching it on first use.
+// A group without a key in Consul starts from its local files.
+func (m *ConsulStorageManager) read(ctx context.Context, group string) (*consulRead, error) {
+	if read, ok := m.reads[group]; ok {
+		return read, nil
+	}
+	read, err := m.fetch(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if read == nil {
+		read = &consulRead{state: consulState{LastIndex: readLastIndex(group), Counts: readCounts(group)}}
+	}
+	if read.state.Counts == nil {
+		read.state.Counts = map[string]int{}
+	}
+	if m.reads == nil {
+		m.reads = map[string]*consulRead{}
+	}
+	m.reads[group] = read
+	return read, nil
+}
+
+// fetch reads the state of a group from Consul, or nil when it has none.
+func (m *ConsulStorageManager) fetch(ctx context.Context, group string) (*consulRead, error) {
+	resp, err := m.do(ctx, http.MethodGet, m.key(group), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read state from consul: unexpected status %s", resp.Status)
+	}
+
+	var entries []struct {
+		Value       string
+		ModifyIndex uint64
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil || len(entries) == 0 {
+		return nil, fmt.Errorf("failed to parse consul response: %v", err)
+	}
+	value, err := base64.StdEncoding.DecodeString(entries[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse consul response: %w", err)
+	}
+	read := &consulRead{modifyIndex: entries[0].ModifyIndex}
+	if err := json.Unmarshal(value, &read.state); err != nil {
+		return nil, fmt.Errorf("failed to parse state of group %s in consul: %w", group, err)
+	}
+	return read, nil
+}
+
+// store writes the state of a group if its key is still at modifyIndex,
+// and reports whether it was written.
+func (m *ConsulStorageManager) store(ctx context.Context, group string, state consulState, modifyIndex uint64) (bool, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal state: %w", err)
+	}
+	resp, err := m.do(ctx, http.MethodPut, m.key(group)+"?cas="+strconv.FormatUint(modifyIndex, 10), data)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("failed to write state to consul: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to write state to consul: unexpected status %s", resp.Status)
+	}
+	return strings.TrimSpace(string(body)) == "true", nil
+}
+
+// key returns the KV API path of a group's state.
+func (m *ConsulStorageManager) key(group string) string {
+	return "/v1/kv/" + m.Prefix + "/" + group + "/state"
+}
+
+func (m *ConsulStorageManager) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, m.Address+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if m.Token != "" {
+		req.Header.Set("X-Consul-Token", m.Token)
+	}
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach consul: %w", err)
+	}
+	return resp, nil
+}
+
+// consulTransaction implements StateTransaction for ConsulStorageManager.
+type consulTransaction struct {
+	ctx   context.Context
+	m     *ConsulStorageManager
+	group string
+	files *fileTransaction
+}
+
+// Commit stores the working copy of the group's state with a check-and-set.
+// If another writer changed the state since it was read, the local files are
+// restored and a StateConflictError is returned.
+func (tx *consulTransaction) Commit() error {
+	read := tx.m.reads[tx.group]
+	delete(tx.m.reads, tx.group)
+
+	stored, err := tx.m.store(tx.ctx, tx.group, read.state, read.modifyIndex)
+	if err == nil && !stored {
+		err = &StateConflictError{Group: tx.group}
+	}
+	if err != nil {
+		if rbErr := tx.files.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return tx.files.Commit()
+}
+
+// Rollback restores the local files and discards the working copy.
+func (tx *consulTransaction) Rollback() error {
+	delete(tx.m.reads, tx.group)
+	return tx.files.Rollback()
+}
+
+// syncConsulState applies edit to the state of a group in Consul with a
+// check-and-set, after its local files were changed outside of an assignment.
+// A group Consul holds no state for gets its local files. It does nothing
+// unless Consul is configured.
+func syncConsulState(group string, edit stateEdit) error {
+	if config.Settings.Storage.Consul.Address == "" {
+		return nil
+	}
+	m := NewConsulStorageManager(config.Settings.Storage.Consul)
+
+	// Retry while assignments race the change
+	for attempt := 0; attempt < 3; attempt++ {
+		current, err := m.fetch(context.Background(), group)
+		if err != nil {
+			return err
+		}
+		state := consulState{LastIndex: readLastIndex(group), Counts: readCounts(group)}
+		var modifyIndex uint64
+		if current != nil {
+			state, modifyIndex = current.state, current.modifyIndex
+			if state.Counts == nil {
+				state.Counts = map[string]int{}
+			}
+			edit(&state.LastIndex, state.Counts)
+		}
+		stored, err := m.store(context.Background(), group, state, modifyIndex)
+		if err != nil || stored {
+			return err
+		}
+	}
+	return &StateConflictError{Group: group}
+}
+
+// renameConsulState copies the state of a group in Consul to its new name.
+// It does nothing unless Consul is configured.
+func renameConsulState(oldName, newName string) error {
+	if config.Settings.Storage.Consul.Address == "" {
+		return nil
+	}
+	m := NewConsulStorageManager(config.Settings.Storage.Consul)
+	old, err := m.fetch(context.Background(), oldName)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return syncConsulState(newName, func(lastIndex *int, counts map[string]int) {})
+	}
+	return syncConsulState(newName, replaceState(old.state.LastIndex, old.state.Counts))
+}
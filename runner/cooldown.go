@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// readLastAssigned reads when each user of a group was last assigned.
+// A missing file is treated as nobody assigned yet.
+func readLastAssigned(group string) (map[string]time.Time, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	last := map[string]time.Time{}
+	data, err := os.ReadFile(filepath.Join(groupDir, "last_assigned.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return last, nil
+		}
+		return nil, err
+	}
+	var stored map[string]string
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	for user, ts := range stored {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of %s: %w", user, err)
+		}
+		last[user] = t
+	}
+	return last, nil
+}
+
+// writeLastAssigned replaces the times each user of a group was last assigned.
+func writeLastAssigned(group string, last map[string]time.Time) error {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	stored := make(map[string]string, len(last))
+	for user, t := range last {
+		stored[user] = t.Format(time.RFC3339)
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(groupDir, "last_assigned.json"), data)
+}
+
+// recordLastAssigned stores that user was assigned at t.
+func recordLastAssigned(group, user string, t time.Time) error {
+	last, err := readLastAssigned(group)
+	if err != nil {
+		return err
+	}
+	last[user] = t
+	return writeLastAssigned(group, last)
+}
+
+// mergeAliasTimes moves the times of former names in last to the members
+// they belong to, keeping the latest.
+func (c *AssigneeGroupConfig) mergeAliasTimes(last map[string]time.Time) {
+	for name, t := range last {
+		if user := c.canonicalUser(name); user != name {
+			if t.After(last[user]) {
+				last[user] = t
+			}
+			delete(last, name)
+		}
+	}
+}
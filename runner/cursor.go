@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// SetCursor sets the rotation position of a group so that user is next in
+// turn, or with last so that user counts as the last assignee and the user
+// after them is next. Aliases of members are accepted. The index is stored
+// with the name of the user, so fsck and rebuild-counts keep it until the
+// next assignment. It returns the user next in turn. The cursor is written
+// under the lock of the group, so it doesn't overwrite the index and counts
+// of a concurrent assignment.
+func SetCursor(ctx context.Context, group, user string, last bool) (string, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", &InvalidGroupError{Group: group}
+		}
+		return "", &ConfigError{Group: group, Err: err}
+	}
+
+	user = groupConf.canonicalUser(user)
+	position := -1
+	for i, member := range groupConf.Users {
+		if member == user {
+			position = i
+		}
+	}
+	if position < 0 {
+		return "", fmt.Errorf("user %s is not in group %s", user, group)
+	}
+
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	n := len(groupConf.Users)
+	index := position
+	if !last {
+		// The last index is the one before the next user
+		index = (position + n - 1) % n
+	}
+	if err := writeCursor(group, index, user); err != nil {
+		return "", err
+	}
+	err = syncSharedState(group, func(lastIndex *int, counts map[string]int) {
+		*lastIndex = index
+	})
+	if err != nil {
+		return "", err
+	}
+	recordStateChange(fmt.Sprintf("Set cursor of %s to %s", group, user))
+	return groupConf.Users[(index+1)%n], nil
+}
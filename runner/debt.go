@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// settleDebts returns the skip debts after an assignment to assignee.
+// Skipped users are owed a turn, unless they are already owed one, and
+// the assignee's debt is reduced by the turn they just received.
+// Users without debt are omitted.
+func settleDebts(debts map[string]int, skipped []string, assignee string) map[string]int {
+	settled := make(map[string]int, len(debts)+len(skipped))
+	for user, debt := range debts {
+		settled[user] = debt
+	}
+	for _, user := range skipped {
+		if debts[user] == 0 {
+			settled[user] = 1
+		}
+	}
+	if settled[assignee] > 0 {
+		settled[assignee]--
+	}
+	for user, debt := range settled {
+		if debt <= 0 {
+			delete(settled, user)
+		}
+	}
+	return settled
+}
+
+// readDebts reads the skip debts of a group. A missing file is treated as no debts.
+func readDebts(group string) (map[string]int, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	debts := map[string]int{}
+	data, err := os.ReadFile(filepath.Join(groupDir, "debts.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return debts, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &debts); err != nil {
+		return nil, err
+	}
+	return debts, nil
+}
+
+// writeDebts replaces the skip debts of a group.
+func writeDebts(group string, debts map[string]int) error {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(debts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(groupDir, "debts.json"), data)
+}
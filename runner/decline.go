@@ -0,0 +1,228 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Periods over which decline budgets and period counts are counted.
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// DeclineBudget limits how often each user of a group may decline an assignment.
+// A zero Max means declines are unlimited.
+type DeclineBudget struct {
+	Max    int    `yaml:"max"`                                     // Declines allowed per user and period
+	Period string `yaml:"period" jsonschema:"enum=day|week|month"` // Period the budget applies to, "month" by default
+}
+
+// DeclineRecord is a single entry in a group's declines.log.
+type DeclineRecord struct {
+	Timestamp string `json:"timestamp"`
+	User      string `json:"user"`
+	Reason    string `json:"reason,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+}
+
+// DeclineStatus reports how much of the decline budget each user has used.
+type DeclineStatus struct {
+	Budget DeclineBudget  // Budget of the group, with the period defaulted
+	Used   map[string]int // Declines per configured user in the current period
+}
+
+// Decline records that user declined an assignment in group.
+// It returns a DeclineBudgetError without recording anything once the user
+// has used all declines of the current period. The lock of the group is
+// held from counting the declines until the new one is written, so
+// concurrent declines can't exceed the budget.
+func Decline(ctx context.Context, group, user, reason string) (*DeclineStatus, error) {
+	groupConf, err := loadDeclineConfig(group)
+	if err != nil {
+		return nil, err
+	}
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	status, err := declineStatus(ctx, group, groupConf)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := status.Used[user]; !ok {
+		return nil, &ConfigError{Group: group, Err: fmt.Errorf("user %s is not a member of the group", user)}
+	}
+
+	budget := status.Budget
+	if budget.Max > 0 && status.Used[user] >= budget.Max {
+		return nil, &DeclineBudgetError{Group: group, User: user, Max: budget.Max, Period: budget.Period}
+	}
+
+	record := DeclineRecord{
+		Timestamp: time.Now().Format(time.RFC3339),
+		User:      user,
+		Reason:    reason,
+		Actor:     currentActor(),
+	}
+	if err := appendDecline(group, record); err != nil {
+		return nil, err
+	}
+	recordStateChange(fmt.Sprintf("Record decline of %s in %s", user, group))
+	status.Used[user]++
+	return status, nil
+}
+
+// GetDeclineStatus returns the decline budget of a group and the declines
+// each configured user has made in the current period.
+func GetDeclineStatus(ctx context.Context, group string) (*DeclineStatus, error) {
+	groupConf, err := loadDeclineConfig(group)
+	if err != nil {
+		return nil, err
+	}
+	return declineStatus(ctx, group, groupConf)
+}
+
+// loadDeclineConfig loads the config of a group, returning an
+// InvalidGroupError when it has none and a ConfigError when it can't be read.
+func loadDeclineConfig(group string) (*AssigneeGroupConfig, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &InvalidGroupError{Group: group}
+		}
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	return groupConf, nil
+}
+
+// declineStatus counts the declines of the current period in the
+// declines.log of a group.
+func declineStatus(ctx context.Context, group string, groupConf *AssigneeGroupConfig) (*DeclineStatus, error) {
+	budget := groupConf.DeclineBudget
+	if budget.Period == "" {
+		budget.Period = PeriodMonth
+	}
+	loc, err := groupConf.location()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	since, err := periodStart(budget.Period, time.Now().In(loc))
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	records, err := readDeclines(group)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]int, len(groupConf.Users))
+	for _, user := range groupConf.Users {
+		used[user] = 0
+	}
+	for _, record := range records {
+		ts, err := time.Parse(time.RFC3339, record.Timestamp)
+		if err != nil || ts.Before(since) {
+			continue
+		}
+		user := groupConf.canonicalUser(record.User)
+		if _, ok := used[user]; ok {
+			used[user]++
+		}
+	}
+	return &DeclineStatus{Budget: budget, Used: used}, nil
+}
+
+// periodStart returns the start of the period containing now, in the
+// location of now.
+// Weeks start on Monday.
+func periodStart(period string, now time.Time) (time.Time, error) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case PeriodDay:
+		return day, nil
+	case PeriodWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), nil
+	case PeriodMonth:
+		return day.AddDate(0, 0, 1-day.Day()), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown period: %s", period)
+	}
+}
+
+// readDeclines reads every record of a group's declines.log.
+// A missing file is treated as empty.
+func readDeclines(group string) ([]DeclineRecord, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	f, err := os.Open(filepath.Join(groupDir, "declines.log"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open declines log: %w", err)
+	}
+	defer f.Close()
+
+	var records []DeclineRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record DeclineRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse declines log: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read declines log: %w", err)
+	}
+	return records, nil
+}
+
+// appendDecline appends a record to a group's declines.log.
+func appendDecline(group string, record DeclineRecord) error {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(groupDir, "declines.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open declines log: %w", err)
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal decline: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write decline: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package runner
 
 import (
 	"autoassigner/config"
+	"context"
 	"fmt"
 )
 
@@ -15,22 +16,136 @@ func (l *DefaultConfigLoader) LoadConfig(group string) (*AssigneeGroupConfig, er
 // DefaultStorageManager implements StorageManager using the filesystem
 type DefaultStorageManager struct{}
 
-func (m *DefaultStorageManager) GetGroupDataDir(group string) (string, error) {
+func (m *DefaultStorageManager) GetGroupDataDir(ctx context.Context, group string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	return config.GetGroupDataDir(group)
 }
 
-func (m *DefaultStorageManager) ReadLastIndex(group string) (int, error) {
+func (m *DefaultStorageManager) ReadLastIndex(ctx context.Context, group string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
 	return readLastIndex(group), nil
 }
 
-func (m *DefaultStorageManager) WriteLastIndex(group string, index int) error {
+func (m *DefaultStorageManager) WriteLastIndex(ctx context.Context, group string, index int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return writeLastIndex(group, index)
 }
 
+func (m *DefaultStorageManager) BeginTransaction(ctx context.Context, group string) (StateTransaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return beginFileTransaction(group)
+}
+
+// CheckWritable creates and removes a file in the data directory of the group.
+func (m *DefaultStorageManager) CheckWritable(ctx context.Context, group string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return checkDataDirWritable(group)
+}
+
+// newStateBackend returns the storage and count managers selected by the configuration.
+func newStateBackend() (StorageManager, CountManager) {
+	var storage StorageManager = &DefaultStorageManager{}
+	var counts CountManager = &DefaultCountManager{}
+	if config.Settings.Storage.Consul.Address != "" {
+		consul := NewConsulStorageManager(config.Settings.Storage.Consul)
+		storage, counts = consul, consul
+	}
+	if config.Settings.Storage.DynamoDB.Table != "" {
+		dynamo := NewDynamoDBStorageManager(config.Settings.Storage.DynamoDB)
+		storage, counts = dynamo, dynamo
+	}
+	if config.Settings.Storage.Git.Enabled {
+		storage = &GitStorageManager{StorageManager: storage}
+	}
+	if config.Settings.Storage.S3.Bucket != "" {
+		storage = &S3StorageManager{StorageManager: storage}
+	}
+	return storage, counts
+}
+
+// stateEdit applies a change a command made to the local files of a group to
+// its state in the shared backend.
+type stateEdit func(lastIndex *int, counts map[string]int)
+
+// syncSharedState applies edit to the state of a group in the configured
+// shared backend, Consul or DynamoDB, after its local files were changed
+// outside of an assignment. The edit is applied to the state read from the
+// backend, not the local files, which only mirror the assignments of this
+// host, so assignments other hosts committed are kept. The local files are
+// stored as they are when the backend holds no state for the group yet.
+func syncSharedState(group string, edit stateEdit) error {
+	if err := syncConsulState(group, edit); err != nil {
+		return err
+	}
+	return syncDynamoDBState(group, edit)
+}
+
+// renameSharedState copies the state of a renamed group in the configured
+// shared backend to its new name, since the local files of this host may lag
+// behind it. A group the backend holds no state for gets its local files.
+func renameSharedState(oldName, newName string) error {
+	if err := renameConsulState(oldName, newName); err != nil {
+		return err
+	}
+	return renameDynamoDBState(oldName, newName)
+}
+
+// replaceState returns the edit replacing the shared state with the given
+// last index and counts.
+func replaceState(index int, replacement map[string]int) stateEdit {
+	return func(lastIndex *int, counts map[string]int) {
+		*lastIndex = index
+		for user := range counts {
+			delete(counts, user)
+		}
+		for user, count := range replacement {
+			counts[user] = count
+		}
+	}
+}
+
+// stateChange returns the edit that changes the shared state the way the
+// local state of a group changed from one index and counts to another: each
+// count moves by the same amount, users that were dropped are dropped, and
+// the last index is set when it changed.
+func stateChange(beforeIndex int, before map[string]int, afterIndex int, after map[string]int) stateEdit {
+	return func(lastIndex *int, counts map[string]int) {
+		if afterIndex != beforeIndex {
+			*lastIndex = afterIndex
+		}
+		for user, count := range before {
+			if _, ok := after[user]; !ok {
+				delete(counts, user)
+			} else {
+				counts[user] -= count
+			}
+		}
+		for user, count := range after {
+			counts[user] += count
+			if counts[user] < 0 {
+				counts[user] = 0
+			}
+		}
+	}
+}
+
 // DefaultCountManager implements CountManager using JSON files
 type DefaultCountManager struct{}
 
-func (m *DefaultCountManager) GetCounts(group string) (map[string]int, error) {
+func (m *DefaultCountManager) GetCounts(ctx context.Context, group string) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	counts := readCounts(group)
 	if len(counts) == 0 {
 		return nil, fmt.Errorf("no counts found for group %s", group)
@@ -38,17 +153,23 @@ func (m *DefaultCountManager) GetCounts(group string) (map[string]int, error) {
 	return counts, nil
 }
 
-func (m *DefaultCountManager) IncrementCount(group, user string) error {
+func (m *DefaultCountManager) IncrementCount(ctx context.Context, group, user string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return incrementCount(group, user)
 }
 
-func (m *DefaultCountManager) ResetCounts(group string) error {
-	return ResetCounts(group)
+func (m *DefaultCountManager) ResetCounts(ctx context.Context, group string) error {
+	return ResetCounts(ctx, group)
 }
 
 // DefaultAssignmentLogger implements AssignmentLogger using JSON files
 type DefaultAssignmentLogger struct{}
 
-func (l *DefaultAssignmentLogger) LogAssignment(group, user, strategy string, lastIndex, nextIndex int, counts map[string]int) error {
-	return logAssignment(group, user, strategy, lastIndex, nextIndex, counts)
+func (l *DefaultAssignmentLogger) LogAssignment(ctx context.Context, entry AssignmentLog) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return logAssignment(entry)
 }
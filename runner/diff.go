@@ -0,0 +1,327 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Status of a group in a GroupDiff.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// GroupDiff explains the effect of a change to the config of a group on its
+// rotation.
+type GroupDiff struct {
+	Group        string
+	Status       string          // DiffAdded, DiffRemoved or DiffChanged
+	Invalid      string          // Why the new config doesn't parse or is invalid, empty when it is valid
+	UsersAdded   []string        // Users of the new config missing from the old one
+	UsersRemoved []string        // Users of the old config missing from the new one
+	Reordered    bool            // The users kept by both configs are in a different order
+	Settings     []SettingChange // Other settings that changed, by their key
+	Cursor       *CursorShift    // Effect on the rotation position of round robin groups with stored state
+}
+
+// SettingChange is a setting of a group config with different values in
+// the old and new config, such as strategy or strategy_options.workload.
+type SettingChange struct {
+	Key string
+	Old string // Value in the old config, empty when unset
+	New string // Value in the new config, empty when unset
+}
+
+// CursorShift tells who round robin assigns next from the stored rotation
+// position of a group, which is the index of the last assignee in the user
+// list, before and after a change of the list.
+type CursorShift struct {
+	LastIndex  int
+	LastUser   string // User at the stored index in the old config
+	NextBefore string // Next in turn with the old config
+	NextAfter  string // Next in turn with the new config
+}
+
+// Shifted reports whether the change makes someone else next in turn.
+func (c *CursorShift) Shifted() bool {
+	return c.NextBefore != c.NextAfter
+}
+
+// DiffGroupConfigs compares the group config files of two versions of the
+// config directories, keyed by group, and explains how the rotation of every
+// group added, removed or changed is affected. The rotation position is read
+// from the stored state of the groups. Groups are returned in order.
+func DiffGroupConfigs(ctx context.Context, old, new map[string][]byte) ([]GroupDiff, error) {
+	groups := make([]string, 0, len(old)+len(new))
+	for group := range old {
+		groups = append(groups, group)
+	}
+	for group := range new {
+		if _, ok := old[group]; !ok {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+
+	var diffs []GroupDiff
+	for _, group := range groups {
+		oldData, inOld := old[group]
+		newData, inNew := new[group]
+		if inOld && inNew && string(oldData) == string(newData) {
+			continue
+		}
+		d := GroupDiff{Group: group, Status: DiffChanged}
+		var oldConf, newConf *AssigneeGroupConfig
+		if inOld {
+			// An old config that doesn't parse is treated as empty
+			oldConf, _ = parseAssigneeGroupConfig(oldData)
+		} else {
+			d.Status = DiffAdded
+		}
+		if inNew {
+			conf, err := parseAssigneeGroupConfig(newData)
+			if err == nil {
+				if issues := conf.issues(); len(issues) > 0 {
+					err = errors.New(strings.Join(issues, "; "))
+				}
+			}
+			if err != nil {
+				d.Invalid = err.Error()
+				diffs = append(diffs, d)
+				continue
+			}
+			newConf = conf
+		} else {
+			d.Status = DiffRemoved
+		}
+		if oldConf == nil {
+			oldConf = &AssigneeGroupConfig{}
+		}
+		if newConf == nil {
+			newConf = &AssigneeGroupConfig{}
+		}
+
+		d.UsersAdded, d.UsersRemoved, d.Reordered = diffUsers(oldConf.Users, newConf.Users)
+		settings, err := diffSettings(oldConf, newConf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare settings of group %s: %w", group, err)
+		}
+		d.Settings = settings
+		if d.Status == DiffChanged && chainUses(string(newConf.Strategy), "round_robin") && len(oldConf.Users) > 0 && len(newConf.Users) > 0 {
+			lastIndex, err := newStateFactory().GetStorageManager().ReadLastIndex(ctx, group)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read last index of group %s: %w", group, err)
+			}
+			if lastIndex >= 0 {
+				d.Cursor = &CursorShift{
+					LastIndex:  lastIndex,
+					NextBefore: oldConf.Users[(lastIndex+1)%len(oldConf.Users)],
+					NextAfter:  newConf.Users[(lastIndex+1)%len(newConf.Users)],
+				}
+				if lastIndex < len(oldConf.Users) {
+					d.Cursor.LastUser = oldConf.Users[lastIndex]
+				}
+			}
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// diffUsers returns the users added and removed by a change of a user list,
+// and whether the users in both are in a different order.
+func diffUsers(old, new []string) (added, removed []string, reordered bool) {
+	inOld := make(map[string]bool, len(old))
+	for _, user := range old {
+		inOld[user] = true
+	}
+	inNew := make(map[string]bool, len(new))
+	for _, user := range new {
+		inNew[user] = true
+		if !inOld[user] {
+			added = append(added, user)
+		}
+	}
+	var kept []string
+	for _, user := range old {
+		if !inNew[user] {
+			removed = append(removed, user)
+		} else {
+			kept = append(kept, user)
+		}
+	}
+	i := 0
+	for _, user := range new {
+		if inOld[user] {
+			reordered = reordered || kept[i] != user
+			i++
+		}
+	}
+	return added, removed, reordered
+}
+
+// diffSettings compares every setting but the user list of two configs, by
+// the keys of their YAML form, with nested settings such as
+// strategy_options.workload compared one by one.
+func diffSettings(old, new *AssigneeGroupConfig) ([]SettingChange, error) {
+	oldValues, err := flatSettings(old)
+	if err != nil {
+		return nil, err
+	}
+	newValues, err := flatSettings(new)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(oldValues)+len(newValues))
+	for key := range oldValues {
+		keys = append(keys, key)
+	}
+	for key := range newValues {
+		if _, ok := oldValues[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []SettingChange
+	for _, key := range keys {
+		if key == "users" || reflect.DeepEqual(oldValues[key], newValues[key]) {
+			continue
+		}
+		changes = append(changes, SettingChange{Key: key, Old: formatSetting(oldValues[key]), New: formatSetting(newValues[key])})
+	}
+	return changes, nil
+}
+
+// flatSettings returns the settings of a config keyed by their dotted path,
+// leaving out empty strings, lists and zero numbers, which mean unset.
+func flatSettings(conf *AssigneeGroupConfig) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	flat := map[string]interface{}{}
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		if m, ok := value.(map[string]interface{}); ok {
+			for key, v := range m {
+				walk(prefix+key+".", v)
+			}
+			return
+		}
+		switch v := value.(type) {
+		case nil:
+			return
+		case string:
+			if v == "" {
+				return
+			}
+		case int:
+			if v == 0 {
+				return
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				return
+			}
+		}
+		flat[strings.TrimSuffix(prefix, ".")] = value
+	}
+	walk("", doc)
+	return flat, nil
+}
+
+// formatSetting formats the value of a setting for a SettingChange.
+func formatSetting(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return ""
+	case []interface{}, map[string]interface{}:
+		data, err := json.Marshal(value)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// ReadGroupFiles reads the group config files of dirs, keyed by group. A
+// group defined in several directories is read from the first, as it is for
+// the config directories.
+func ReadGroupFiles(dirs []string) (map[string][]byte, error) {
+	groups, err := config.ListGroupsIn(dirs)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte, len(groups))
+	for _, group := range groups {
+		for _, dir := range dirs {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(group)+".yaml"))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			files[group] = data
+			break
+		}
+	}
+	return files, nil
+}
+
+// ReadGitGroupFiles reads the group config files of dirs as they are in a
+// git revision, such as HEAD, of the repositories they are in, keyed by
+// group like ReadGroupFiles.
+func ReadGitGroupFiles(dirs []string, rev string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, dir := range dirs {
+		// Paths are listed relative to dir, and only those below it
+		list, err := runGit(dir, "ls-tree", "-r", "-z", "--name-only", rev)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range strings.Split(list, "\x00") {
+			if !strings.HasSuffix(path, ".yaml") || hiddenPath(path) {
+				continue
+			}
+			group := strings.TrimSuffix(path, ".yaml")
+			if _, ok := files[group]; ok {
+				continue
+			}
+			data, err := runGit(dir, "show", rev+":./"+path)
+			if err != nil {
+				return nil, err
+			}
+			files[group] = []byte(data + "\n")
+		}
+	}
+	return files, nil
+}
+
+// hiddenPath reports whether a slash-separated path is in a hidden
+// directory, which ListGroups skips.
+func hiddenPath(path string) bool {
+	parts := strings.Split(path, "/")
+	for _, part := range parts[:len(parts)-1] {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// digestWindow is the period summarized by the weekly digest.
+const digestWindow = "7d"
+
+// Digest summarizes the assignments of groups over the past week, as
+// rendered by RenderDigest.
+type Digest struct {
+	Since  time.Time     // Start of the week summarized, in the time zone shared by the groups
+	Until  time.Time     // End of the week summarized, when the digest was built, in the time zone shared by the groups
+	Groups []GroupDigest // Summarized groups in the order they were requested
+}
+
+// GroupDigest summarizes the week of one group.
+type GroupDigest struct {
+	Group       string
+	Assignments int               // Assignments in the week
+	Skips       int               // Users skipped in the week
+	Declines    int               // Assignments declined in the week
+	Users       []WindowUserStats // Members in config order, followed by former members assigned in the week
+	Fairness    DigestFairness    // How evenly the week's assignments were spread over the members
+}
+
+// DigestFairness tells how evenly the assignments of a week were spread
+// over the members of a group.
+type DigestFairness struct {
+	Mean         float64 // Assignments per member
+	Spread       int     // Assignments of the busiest member minus those of the least busy one
+	Busiest      string  // Member with the most assignments; empty without assignments
+	MaxAboveMean float64 // Assignments of the busiest member above the mean
+}
+
+// BuildDigest summarizes the past week of the groups, which may be patterns
+// such as team-*, or of every group when none are given. Groups found by a
+// pattern or listed as every group are left out with a warning when their
+// config can't be loaded; those named fail the digest.
+func BuildDigest(ctx context.Context, groups []string) (*Digest, error) {
+	names, named, err := digestGroups(groups)
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow().In(digestLocation(names))
+	digest := &Digest{Since: now.AddDate(0, 0, -7), Until: now}
+	for _, group := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil && !named[group] {
+			log.Printf("Warning: leaving group %s out of the digest: %v", group, err)
+			continue
+		}
+		if err != nil {
+			return nil, &InvalidGroupError{Group: group}
+		}
+		stats, err := GetWindowStats(ctx, group, digestWindow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize group %s: %w", group, err)
+		}
+		digest.Groups = append(digest.Groups, GroupDigest{
+			Group:       group,
+			Assignments: stats.Assignments,
+			Skips:       stats.Skips,
+			Declines:    stats.Declines,
+			Users:       stats.Users,
+			Fairness:    digestFairness(stats.Users[:len(groupConf.Users)]),
+		})
+	}
+	return digest, nil
+}
+
+// digestGroups expands the groups of a digest into group names, every group
+// when none are given, and returns which of them were named rather than
+// matched by a pattern.
+func digestGroups(groups []string) ([]string, map[string]bool, error) {
+	named := map[string]bool{}
+	if len(groups) == 0 {
+		all, err := config.ListGroups()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list groups: %w", err)
+		}
+		return all, named, nil
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, group := range groups {
+		matched := []string{group}
+		if config.IsGroupPattern(group) {
+			var err error
+			if matched, err = config.MatchGroups(group); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			named[group] = true
+		}
+		for _, name := range matched {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, named, nil
+}
+
+// digestLocation returns the time zone the groups share, or the local one
+// when their time zones differ or can't be read.
+func digestLocation(groups []string) *time.Location {
+	var shared *time.Location
+	for _, group := range groups {
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil {
+			continue
+		}
+		loc, err := groupConf.location()
+		if err != nil {
+			return time.Local
+		}
+		if shared != nil && shared.String() != loc.String() {
+			return time.Local
+		}
+		shared = loc
+	}
+	if shared == nil {
+		return time.Local
+	}
+	return shared
+}
+
+// digestFairness measures how evenly assignments were spread over members.
+func digestFairness(members []WindowUserStats) DigestFairness {
+	var f DigestFairness
+	if len(members) == 0 {
+		return f
+	}
+	total, most, least := 0, members[0].Assignments, members[0].Assignments
+	for _, m := range members {
+		total += m.Assignments
+		if m.Assignments > most {
+			most = m.Assignments
+		}
+		if m.Assignments < least {
+			least = m.Assignments
+		}
+	}
+	f.Mean = float64(total) / float64(len(members))
+	f.Spread = most - least
+	if total > 0 {
+		for _, m := range members {
+			if m.Assignments == most {
+				f.Busiest = m.User
+				break
+			}
+		}
+		f.MaxAboveMean = float64(most) - f.Mean
+	}
+	return f
+}
+
+// defaultDigestTemplate renders the digest as plain text, readable in Slack
+// and mail alike.
+const defaultDigestTemplate = `Assignments from {{date .Since}} to {{date .Until}}
+{{range .Groups}}
+{{.Group}}: {{.Assignments}} assigned, {{.Skips}} skipped, {{.Declines}} declined
+{{range .Users}}{{if or .Assignments .Skips .Declines}}  {{.User}}: {{.Assignments}} ({{percent .Share}}){{if .Skips}}, skipped {{.Skips}}{{end}}{{if .Declines}}, declined {{.Declines}}{{end}}
+{{end}}{{end}}{{if .Fairness.Busiest}}  Fairness: {{.Fairness.Busiest}} had {{printf "%.1f" .Fairness.MaxAboveMean}} above the mean of {{printf "%.1f" .Fairness.Mean}}, spread {{.Fairness.Spread}}
+{{end}}{{else}}
+No groups to summarize
+{{end}}`
+
+// digestFuncs are the functions available to digest templates besides the
+// builtins of text/template.
+var digestFuncs = template.FuncMap{
+	"date":    func(t time.Time) string { return t.Format("Mon Jan 2") },
+	"percent": func(share float64) string { return fmt.Sprintf("%.0f%%", share*100) },
+}
+
+// RenderDigest renders a digest with the Go text/template in the file at
+// templatePath, or the built-in summary when it is empty. Templates are
+// executed with the Digest and can use date and percent to format its times
+// and shares.
+func RenderDigest(digest *Digest, templatePath string) (string, error) {
+	text := defaultDigestTemplate
+	if templatePath != "" {
+		data, err := os.ReadFile(templatePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read digest template: %w", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("digest").Funcs(digestFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid digest template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, digest); err != nil {
+		return "", fmt.Errorf("failed to render digest: %w", err)
+	}
+	return b.String(), nil
+}
+
+// NextDigest returns the first time at or after now the digest of conf is
+// due, on its day at its time. Without a time zone of its own, the digest
+// is due in the time zone its groups share, or else the local one. It fails
+// when the day, time or time zone is invalid.
+func NextDigest(conf config.DigestConfig, now time.Time) (time.Time, error) {
+	day, clock, loc := time.Monday, 9*60, time.Local
+	if conf.Day != "" {
+		wd, ok := weekdays[strings.ToLower(conf.Day)]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unknown digest day: %s", conf.Day)
+		}
+		day = wd
+	}
+	if conf.Time != "" {
+		t, err := time.Parse("15:04", conf.Time)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid digest time %q, want HH:MM", conf.Time)
+		}
+		clock = t.Hour()*60 + t.Minute()
+	}
+	if conf.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(conf.Timezone); err != nil {
+			return time.Time{}, fmt.Errorf("invalid digest timezone: %w", err)
+		}
+	} else if names, _, err := digestGroups(conf.Groups); err == nil {
+		loc = digestLocation(names)
+	}
+
+	now = now.In(loc)
+	days := (int(day) - int(now.Weekday()) + 7) % 7
+	next := time.Date(now.Year(), now.Month(), now.Day()+days, clock/60, clock%60, 0, 0, loc)
+	if next.Before(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next, nil
+}
@@ -0,0 +1,166 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Events recorded in durations.log.
+const (
+	EventAcknowledged = "acknowledged" // The assignee acknowledged the assignment
+	EventClosed       = "closed"       // The assignment was closed
+)
+
+// DurationRecord is an entry of a group's durations.log, written when an
+// open assignment is acknowledged or closed, with the time it took.
+type DurationRecord struct {
+	Timestamp  string  `json:"timestamp"`      // Time of the event in RFC 3339 format
+	ID         string  `json:"id"`             // ID of the assignment
+	User       string  `json:"user"`           // Assignee
+	Role       string  `json:"role,omitempty"` // Role of the user in a multi-role assignment
+	Event      string  `json:"event"`          // acknowledged or closed
+	AssignedAt string  `json:"assigned_at"`    // Time of the assignment in RFC 3339 format
+	Seconds    float64 `json:"seconds"`        // Time from the assignment to the event: time to acknowledge or time to close
+}
+
+// Duration returns the time from the assignment to the event.
+func (r DurationRecord) Duration() time.Duration {
+	return time.Duration(r.Seconds * float64(time.Second))
+}
+
+// durationRecords describes an event of open assignments at the given time.
+func durationRecords(entries []OpenAssignment, event string, at time.Time) []DurationRecord {
+	records := make([]DurationRecord, 0, len(entries))
+	for _, open := range entries {
+		seconds := 0.0
+		if assigned, err := time.Parse(time.RFC3339, open.AssignedAt); err == nil {
+			seconds = at.Sub(assigned).Seconds()
+		}
+		records = append(records, DurationRecord{
+			Timestamp:  at.Format(time.RFC3339),
+			ID:         open.ID,
+			User:       open.User,
+			Role:       open.Role,
+			Event:      event,
+			AssignedAt: open.AssignedAt,
+			Seconds:    seconds,
+		})
+	}
+	return records
+}
+
+// ReadDurations returns the acknowledgements and closings of the open
+// assignments of a group, oldest first.
+func ReadDurations(group string) ([]DurationRecord, error) {
+	if _, err := loadAssigneeGroupConfig(group); err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	return readDurations(group)
+}
+
+// readDurations reads every record of a group's durations.log.
+// A missing file is treated as empty.
+func readDurations(group string) ([]DurationRecord, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	f, err := os.Open(filepath.Join(groupDir, "durations.log"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open durations log: %w", err)
+	}
+	defer f.Close()
+
+	var records []DurationRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record DurationRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse durations log: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read durations log: %w", err)
+	}
+	return records, nil
+}
+
+// logDurations appends records to a group's durations.log.
+func logDurations(group string, records []DurationRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(groupDir, "durations.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open durations log: %w", err)
+	}
+	defer f.Close()
+
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal duration: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write durations log: %w", err)
+	}
+	return nil
+}
+
+// medianSeconds returns the median of durations in seconds, 0 when there
+// are none.
+func medianSeconds(seconds []float64) float64 {
+	if len(seconds) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), seconds...)
+	sort.Float64s(sorted)
+	if n := len(sorted); n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[len(sorted)/2]
+}
+
+// OpenWork returns the number of open assignments of each user of a group and
+// the time of the oldest one, the work they have yet to close.
+func OpenWork(group string) (map[string]int, map[string]time.Time, error) {
+	ledger, err := readLedger(group)
+	if err != nil {
+		return nil, nil, err
+	}
+	counts := make(map[string]int)
+	oldest := make(map[string]time.Time)
+	for _, open := range ledger {
+		counts[open.User]++
+		assigned, err := time.Parse(time.RFC3339, open.AssignedAt)
+		if err != nil {
+			continue
+		}
+		if t, ok := oldest[open.User]; !ok || assigned.Before(t) {
+			oldest[open.User] = assigned
+		}
+	}
+	return counts, oldest, nil
+}
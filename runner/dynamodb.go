@@ -0,0 +1,494 @@
+package runner
+
+import (
+	"autoassigner/aws"
+	"autoassigner/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The items of a group share the partition key "<prefix>/<group>" in a single
+// table: the cursor item holds the last index and a version that every
+// commit increments, and one item per user holds the user's count.
+const (
+	dynamoCursorKey   = "cursor"
+	dynamoCountPrefix = "count#"
+)
+
+// dynamoCursorNames names the attributes of the cursor item in expressions.
+var dynamoCursorNames = map[string]string{"#index": "last_index", "#version": "version"}
+
+// dynamoRead is the state of a group as last read, together with the version
+// of its cursor item that the commit is conditional on. A zero version means
+// the group had no items.
+type dynamoRead struct {
+	lastIndex int
+	counts    map[string]int // Working copy of the counts
+	stored    map[string]int // Counts as read, so only the differences are added
+	version   int64
+}
+
+// DynamoDBStorageManager implements StorageManager and CountManager on a
+// DynamoDB table. Each assignment is committed in one transaction that writes
+// the cursor on condition that it is still at the version the assignment was
+// selected from, and adds to the counts of the assigned users atomically, so
+// two hosts or Lambda instances assigning at the same time cannot both commit
+// the same turn; the slower one fails with a StateConflictError. The files in
+// the data directory are still written and mirror the state for the commands
+// that read them.
+type DynamoDBStorageManager struct {
+	DefaultStorageManager
+	Table    string
+	Prefix   string
+	Region   string
+	Endpoint string
+	Client   *http.Client
+
+	reads map[string]*dynamoRead // Working copy of each group's state since it was read
+}
+
+// NewDynamoDBStorageManager returns a DynamoDBStorageManager for the given settings.
+func NewDynamoDBStorageManager(conf config.DynamoDBConfig) *DynamoDBStorageManager {
+	prefix := conf.Prefix
+	if prefix == "" {
+		prefix = "autoassigner"
+	}
+	region := aws.Region(conf.Region)
+	endpoint := strings.TrimSuffix(conf.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://dynamodb." + region + ".amazonaws.com"
+	}
+	return &DynamoDBStorageManager{
+		Table:    conf.Table,
+		Prefix:   strings.Trim(prefix, "/"),
+		Region:   region,
+		Endpoint: endpoint,
+		Client:   http.DefaultClient,
+		reads:    map[string]*dynamoRead{},
+	}
+}
+
+func (m *DynamoDBStorageManager) ReadLastIndex(ctx context.Context, group string) (int, error) {
+	read, err := m.read(ctx, group)
+	if err != nil {
+		return -1, err
+	}
+	return read.lastIndex, nil
+}
+
+func (m *DynamoDBStorageManager) WriteLastIndex(ctx context.Context, group string, index int) error {
+	read, err := m.read(ctx, group)
+	if err != nil {
+		return err
+	}
+	if err := writeLastIndex(group, index); err != nil {
+		return err
+	}
+	read.lastIndex = index
+	return nil
+}
+
+func (m *DynamoDBStorageManager) GetCounts(ctx context.Context, group string) (map[string]int, error) {
+	read, err := m.read(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if len(read.counts) == 0 {
+		return nil, fmt.Errorf("no counts found for group %s", group)
+	}
+	counts := make(map[string]int, len(read.counts))
+	for user, count := range read.counts {
+		counts[user] = count
+	}
+	return counts, nil
+}
+
+func (m *DynamoDBStorageManager) IncrementCount(ctx context.Context, group, user string) error {
+	read, err := m.read(ctx, group)
+	if err != nil {
+		return err
+	}
+	read.counts[user]++
+
+	// DynamoDB holds the lifetime counts; the daily buckets are kept in the local file
+	if err := incrementCount(group, user); err != nil {
+		return err
+	}
+	return writeCounts(group, read.counts)
+}
+
+func (m *DynamoDBStorageManager) ResetCounts(ctx context.Context, group string) error {
+	return ResetCounts(ctx, group)
+}
+
+// BeginTransaction snapshots the local files of a group. Its Commit writes
+// the working copy of the group's state to DynamoDB in one transaction.
+func (m *DynamoDBStorageManager) BeginTransaction(ctx context.Context, group string) (StateTransaction, error) {
+	if _, err := m.read(ctx, group); err != nil {
+		return nil, err
+	}
+	files, err := beginFileTransaction(group)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamoTransaction{ctx: ctx, m: m, group: group, files: files}, nil
+}
+
+// read returns the working copy of a group's state, fetching it on first use.
+// A group without items in DynamoDB starts from its local files.
+func (m *DynamoDBStorageManager) read(ctx context.Context, group string) (*dynamoRead, error) {
+	if read, ok := m.reads[group]; ok {
+		return read, nil
+	}
+	read, err := m.fetch(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if read.version == 0 {
+		read.lastIndex, read.counts = readLastIndex(group), readCounts(group)
+		read.stored = map[string]int{}
+	}
+	if read.counts == nil {
+		read.counts = map[string]int{}
+	}
+	if m.reads == nil {
+		m.reads = map[string]*dynamoRead{}
+	}
+	m.reads[group] = read
+	return read, nil
+}
+
+// CheckWritable checks the data directory of the group, whose files mirror
+// the state, and writes and deletes a probe item next to its state in the table.
+func (m *DynamoDBStorageManager) CheckWritable(ctx context.Context, group string) error {
+	if err := m.DefaultStorageManager.CheckWritable(ctx, group); err != nil {
+		return err
+	}
+	key := m.itemKey(group, "preflight")
+	for _, action := range []map[string]interface{}{
+		{"Put": map[string]interface{}{"TableName": m.Table, "Item": key}},
+		{"Delete": map[string]interface{}{"TableName": m.Table, "Key": key}},
+	} {
+		if err := m.transact(ctx, []map[string]interface{}{action}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch reads the items of a group with a strongly consistent query.
+func (m *DynamoDBStorageManager) fetch(ctx context.Context, group string) (*dynamoRead, error) {
+	items, err := m.query(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	read := &dynamoRead{lastIndex: -1, counts: map[string]int{}, stored: map[string]int{}}
+	for _, item := range items {
+		sk := item["sk"].S
+		switch {
+		case sk == dynamoCursorKey:
+			if read.lastIndex, err = strconv.Atoi(item["last_index"].N); err != nil {
+				return nil, fmt.Errorf("invalid last index of group %s in dynamodb: %w", group, err)
+			}
+			if read.version, err = strconv.ParseInt(item["version"].N, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid version of group %s in dynamodb: %w", group, err)
+			}
+		case strings.HasPrefix(sk, dynamoCountPrefix):
+			count, err := strconv.Atoi(item["count"].N)
+			if err != nil {
+				return nil, fmt.Errorf("invalid count of %s in group %s in dynamodb: %w", item["user"].S, group, err)
+			}
+			read.counts[item["user"].S] = count
+			read.stored[item["user"].S] = count
+		}
+	}
+	return read, nil
+}
+
+// query returns every item of a group.
+func (m *DynamoDBStorageManager) query(ctx context.Context, group string) ([]dynamoItem, error) {
+	input := map[string]interface{}{
+		"TableName":                 m.Table,
+		"KeyConditionExpression":    "pk = :pk",
+		"ExpressionAttributeValues": dynamoItem{":pk": dynamoString(m.key(group))},
+		"ConsistentRead":            true,
+	}
+	var items []dynamoItem
+	for {
+		var output struct {
+			Items            []dynamoItem `json:"Items"`
+			LastEvaluatedKey dynamoItem   `json:"LastEvaluatedKey"`
+		}
+		if err := m.do(ctx, "Query", input, &output); err != nil {
+			return nil, fmt.Errorf("failed to read state from dynamodb: %w", err)
+		}
+		items = append(items, output.Items...)
+		if len(output.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		input["ExclusiveStartKey"] = output.LastEvaluatedKey
+	}
+}
+
+// store writes the working copy of a group's state in one transaction, on
+// condition that the cursor is still at the version it was read at. Users
+// removed from the working copy are deleted.
+func (m *DynamoDBStorageManager) store(ctx context.Context, group string, read *dynamoRead) error {
+	values := dynamoItem{
+		":index": dynamoNumber(int64(read.lastIndex)),
+		":next":  dynamoNumber(read.version + 1),
+	}
+	condition := "attribute_not_exists(pk)"
+	if read.version != 0 {
+		condition = "#version = :version"
+		values[":version"] = dynamoNumber(read.version)
+	}
+	cursor := map[string]interface{}{
+		"TableName":                 m.Table,
+		"Key":                       m.itemKey(group, dynamoCursorKey),
+		"UpdateExpression":          "SET #index = :index, #version = :next",
+		"ConditionExpression":       condition,
+		"ExpressionAttributeNames":  dynamoCursorNames,
+		"ExpressionAttributeValues": values,
+	}
+	actions := []map[string]interface{}{{"Update": cursor}}
+	for user, count := range read.counts {
+		if delta := count - read.stored[user]; delta != 0 {
+			actions = append(actions, map[string]interface{}{"Update": m.countUpdate(group, user, delta)})
+		}
+	}
+	for user := range read.stored {
+		if _, ok := read.counts[user]; !ok {
+			actions = append(actions, map[string]interface{}{"Delete": map[string]interface{}{
+				"TableName": m.Table,
+				"Key":       m.itemKey(group, dynamoCountPrefix+user),
+			}})
+		}
+	}
+	return m.transact(ctx, actions)
+}
+
+// countUpdate returns the update adding delta to the count of a user.
+func (m *DynamoDBStorageManager) countUpdate(group, user string, delta int) map[string]interface{} {
+	return map[string]interface{}{
+		"TableName":                m.Table,
+		"Key":                      m.itemKey(group, dynamoCountPrefix+user),
+		"UpdateExpression":         "SET #user = :user ADD #count :delta",
+		"ExpressionAttributeNames": map[string]string{"#user": "user", "#count": "count"},
+		"ExpressionAttributeValues": dynamoItem{
+			":user":  dynamoString(user),
+			":delta": dynamoNumber(int64(delta)),
+		},
+	}
+}
+
+// transact runs TransactWriteItems and returns a StateConflictError when a
+// condition failed or another transaction wrote the same items.
+func (m *DynamoDBStorageManager) transact(ctx context.Context, actions []map[string]interface{}) error {
+	err := m.do(ctx, "TransactWriteItems", map[string]interface{}{"TransactItems": actions}, nil)
+	var dynamoErr *dynamoError
+	if errors.As(err, &dynamoErr) && dynamoErr.conflict() {
+		return errDynamoConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write state to dynamodb: %w", err)
+	}
+	return nil
+}
+
+// errDynamoConflict is returned by transact when the items changed since
+// they were read.
+var errDynamoConflict = errors.New("state was changed by another writer")
+
+// key returns the partition key of a group's items.
+func (m *DynamoDBStorageManager) key(group string) string {
+	return m.Prefix + "/" + group
+}
+
+func (m *DynamoDBStorageManager) itemKey(group, sk string) dynamoItem {
+	return dynamoItem{"pk": dynamoString(m.key(group)), "sk": dynamoString(sk)}
+}
+
+// do calls an action of the DynamoDB API and decodes its output into out.
+func (m *DynamoDBStorageManager) do(ctx context.Context, action string, input, out interface{}) error {
+	if m.Region == "" {
+		return fmt.Errorf("no aws region configured for storage.dynamodb")
+	}
+	creds, err := aws.CredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+action)
+	aws.SignRequest(req, body, creds, m.Region, "dynamodb", time.Now())
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach dynamodb: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		dynamoErr := &dynamoError{Status: resp.Status}
+		json.Unmarshal(data, dynamoErr)
+		return dynamoErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// dynamoError is an error response of the DynamoDB API.
+type dynamoError struct {
+	Status              string
+	Type                string `json:"__type"`
+	Message             string `json:"message"`
+	CancellationReasons []struct {
+		Code string `json:"Code"`
+	} `json:"CancellationReasons"`
+}
+
+func (e *dynamoError) Error() string {
+	if e.Type == "" {
+		return "dynamodb responded with " + e.Status
+	}
+	// Types are qualified, e.g. com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException
+	name := e.Type[strings.LastIndex(e.Type, "#")+1:]
+	return fmt.Sprintf("dynamodb responded with %s: %s: %s", e.Status, name, e.Message)
+}
+
+// conflict reports whether a transaction was canceled by a failed condition
+// or by another transaction writing the same items.
+func (e *dynamoError) conflict() bool {
+	if strings.HasSuffix(e.Type, "TransactionConflictException") {
+		return true
+	}
+	if !strings.HasSuffix(e.Type, "TransactionCanceledException") {
+		return false
+	}
+	for _, reason := range e.CancellationReasons {
+		if reason.Code == "ConditionalCheckFailed" || reason.Code == "TransactionConflict" {
+			return true
+		}
+	}
+	return false
+}
+
+// dynamoItem is an item, key or set of expression values in the JSON of the
+// DynamoDB API; only strings and numbers are used.
+type dynamoItem map[string]dynamoValue
+
+type dynamoValue struct {
+	S string `json:"S,omitempty"`
+	N string `json:"N,omitempty"`
+}
+
+func dynamoString(s string) dynamoValue { return dynamoValue{S: s} }
+
+func dynamoNumber(n int64) dynamoValue { return dynamoValue{N: strconv.FormatInt(n, 10)} }
+
+// dynamoTransaction implements StateTransaction for DynamoDBStorageManager.
+type dynamoTransaction struct {
+	ctx   context.Context
+	m     *DynamoDBStorageManager
+	group string
+	files *fileTransaction
+}
+
+// Commit writes the working copy of the group's state to DynamoDB. If another
+// writer changed the state since it was read, the local files are restored
+// and a StateConflictError is returned.
+func (tx *dynamoTransaction) Commit() error {
+	read := tx.m.reads[tx.group]
+	delete(tx.m.reads, tx.group)
+
+	err := tx.m.store(tx.ctx, tx.group, read)
+	if errors.Is(err, errDynamoConflict) {
+		err = &StateConflictError{Group: tx.group}
+	}
+	if err != nil {
+		if rbErr := tx.files.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return tx.files.Commit()
+}
+
+// Rollback restores the local files and discards the working copy.
+func (tx *dynamoTransaction) Rollback() error {
+	delete(tx.m.reads, tx.group)
+	return tx.files.Rollback()
+}
+
+// syncDynamoDBState applies edit to the state of a group in DynamoDB, after
+// its local files were changed outside of an assignment. A group DynamoDB
+// holds no cursor for gets its local files. The version of the cursor is
+// incremented, so assignments selected from the previous state fail to
+// commit. It does nothing unless DynamoDB is configured.
+func syncDynamoDBState(group string, edit stateEdit) error {
+	if config.Settings.Storage.DynamoDB.Table == "" {
+		return nil
+	}
+	ctx := context.Background()
+	m := NewDynamoDBStorageManager(config.Settings.Storage.DynamoDB)
+
+	// Retry while assignments race the change
+	for attempt := 0; attempt < 3; attempt++ {
+		current, err := m.fetch(ctx, group)
+		if err != nil {
+			return err
+		}
+		if current.version == 0 {
+			current.lastIndex, current.counts = readLastIndex(group), readCounts(group)
+		} else {
+			edit(&current.lastIndex, current.counts)
+		}
+		if err := m.store(ctx, group, current); !errors.Is(err, errDynamoConflict) {
+			return err
+		}
+	}
+	return &StateConflictError{Group: group}
+}
+
+// renameDynamoDBState copies the state of a group in DynamoDB to its new
+// name. It does nothing unless DynamoDB is configured.
+func renameDynamoDBState(oldName, newName string) error {
+	if config.Settings.Storage.DynamoDB.Table == "" {
+		return nil
+	}
+	m := NewDynamoDBStorageManager(config.Settings.Storage.DynamoDB)
+	old, err := m.fetch(context.Background(), oldName)
+	if err != nil {
+		return err
+	}
+	if old.version == 0 {
+		return syncDynamoDBState(newName, func(lastIndex *int, counts map[string]int) {})
+	}
+	return syncDynamoDBState(newName, replaceState(old.lastIndex, old.counts))
+}
@@ -1,6 +1,31 @@
 package runner
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sentinel errors classifying runner failures. Every typed error below matches
+// its class with errors.Is, so callers can branch without type switches:
+//
+//	if errors.Is(err, runner.ErrNoAvailableAssignee) { ... }
+var (
+	ErrConfig              = errors.New("configuration error")
+	ErrInvalidGroup        = errors.New("invalid group")
+	ErrSelection           = errors.New("selection error")
+	ErrAvailability        = errors.New("availability check failed")
+	ErrNoAvailableAssignee = errors.New("no available assignee")
+	ErrDeclineBudget       = errors.New("decline budget exhausted")
+	ErrAssignmentNotFound  = errors.New("assignment not found")
+	ErrStateConflict       = errors.New("state changed concurrently")
+	ErrLockTimeout         = errors.New("timed out waiting for lock")
+	ErrCallback            = errors.New("assignment callback failed")
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrGroupDisabled       = errors.New("group disabled")
+	ErrInvalidOption       = errors.New("invalid assignment option")
+	ErrPreflight           = errors.New("pre-flight check failed")
+)
 
 type ConfigError struct {
 	Group string
@@ -11,6 +36,10 @@ func (e *ConfigError) Error() string {
 	return fmt.Sprintf("configuration error for group %s: %v", e.Group, e.Err)
 }
 
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+func (e *ConfigError) Is(target error) bool { return target == ErrConfig }
+
 type SelectionError struct {
 	Group string
 	Err   error
@@ -20,6 +49,10 @@ func (e *SelectionError) Error() string {
 	return fmt.Sprintf("selection error for group %s: %v", e.Group, e.Err)
 }
 
+func (e *SelectionError) Unwrap() error { return e.Err }
+
+func (e *SelectionError) Is(target error) bool { return target == ErrSelection }
+
 type AvailabilityError struct {
 	User string
 	Err  error
@@ -29,14 +62,23 @@ func (e *AvailabilityError) Error() string {
 	return fmt.Sprintf("availability check error for user %s: %v", e.User, e.Err)
 }
 
+func (e *AvailabilityError) Unwrap() error { return e.Err }
+
+func (e *AvailabilityError) Is(target error) bool { return target == ErrAvailability }
+
 type NoAvailableAssigneeError struct {
 	Group string
+	Trace *SelectionTrace // Who was ruled out and why, with AssignOptions.Explain
 }
 
 func (e *NoAvailableAssigneeError) Error() string {
 	return fmt.Sprintf("no available assignee found for group %s", e.Group)
 }
 
+func (e *NoAvailableAssigneeError) Is(target error) bool { return target == ErrNoAvailableAssignee }
+
+// InvalidGroupError is reported for groups without a configuration file.
+// It matches both ErrInvalidGroup and ErrConfig.
 type InvalidGroupError struct {
 	Group string
 }
@@ -44,3 +86,149 @@ type InvalidGroupError struct {
 func (e *InvalidGroupError) Error() string {
 	return fmt.Sprintf("group %s does not exist", e.Group)
 }
+
+func (e *InvalidGroupError) Is(target error) bool {
+	return target == ErrInvalidGroup || target == ErrConfig
+}
+
+// DeclineBudgetError is reported when a user has used up their declines for the period.
+type DeclineBudgetError struct {
+	Group  string
+	User   string
+	Max    int
+	Period string
+}
+
+func (e *DeclineBudgetError) Error() string {
+	return fmt.Sprintf("user %s has used all %d declines for this %s in group %s", e.User, e.Max, e.Period, e.Group)
+}
+
+func (e *DeclineBudgetError) Is(target error) bool { return target == ErrDeclineBudget }
+
+// AssignmentNotFoundError is reported for assignment IDs that are not open in a group.
+type AssignmentNotFoundError struct {
+	Group string
+	ID    string
+}
+
+func (e *AssignmentNotFoundError) Error() string {
+	return fmt.Sprintf("no open assignment %s in group %s", e.ID, e.Group)
+}
+
+func (e *AssignmentNotFoundError) Is(target error) bool { return target == ErrAssignmentNotFound }
+
+// ReservationNotFoundError is reported for reservation IDs that are not held
+// in a group, because they were committed, released or have expired.
+type ReservationNotFoundError struct {
+	Group string
+	ID    string
+}
+
+func (e *ReservationNotFoundError) Error() string {
+	return fmt.Sprintf("no active reservation %s in group %s", e.ID, e.Group)
+}
+
+func (e *ReservationNotFoundError) Is(target error) bool { return target == ErrReservationNotFound }
+
+// StateConflictError is reported when the shared state of a group changed
+// between reading it and committing an assignment made from it.
+type StateConflictError struct {
+	Group string
+}
+
+func (e *StateConflictError) Error() string {
+	return fmt.Sprintf("state of group %s was changed by another assignment; try again", e.Group)
+}
+
+func (e *StateConflictError) Is(target error) bool { return target == ErrStateConflict }
+
+// LockTimeoutError is reported when the distributed lock of a group stays
+// held by another host for longer than the configured wait.
+type LockTimeoutError struct {
+	Group string
+	Wait  time.Duration
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("group %s is locked by another assignment (waited %s)", e.Group, e.Wait)
+}
+
+func (e *LockTimeoutError) Is(target error) bool { return target == ErrLockTimeout }
+
+// CallbackError is reported when the callback of a group fails. Unless
+// RolledBack is set, the assignment itself was made and stays recorded.
+type CallbackError struct {
+	Group      string
+	User       string
+	ID         string
+	RolledBack bool
+	Err        error
+}
+
+func (e *CallbackError) Error() string {
+	outcome := "the assignment was kept"
+	if e.RolledBack {
+		outcome = "the assignment was rolled back"
+	}
+	return fmt.Sprintf("callback for the assignment of %s in group %s failed: %v; %s", e.User, e.Group, e.Err, outcome)
+}
+
+func (e *CallbackError) Unwrap() error { return e.Err }
+
+func (e *CallbackError) Is(target error) bool { return target == ErrCallback }
+
+// GroupDisabledError is reported for assignments in a group whose config
+// sets enabled: false.
+type GroupDisabledError struct {
+	Group string
+}
+
+func (e *GroupDisabledError) Error() string {
+	return fmt.Sprintf("group %s is disabled", e.Group)
+}
+
+func (e *GroupDisabledError) Is(target error) bool { return target == ErrGroupDisabled }
+
+// InvalidOptionError is reported for per-call assignment options that can't
+// be applied, such as an unknown strategy override.
+type InvalidOptionError struct {
+	Option string
+	Value  string
+	Err    error
+}
+
+func (e *InvalidOptionError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %v", e.Option, e.Value, e.Err)
+}
+
+func (e *InvalidOptionError) Unwrap() error { return e.Err }
+
+func (e *InvalidOptionError) Is(target error) bool { return target == ErrInvalidOption }
+
+// Checks made before selecting with AssignOptions.RequireAllChecks, as
+// reported in PreflightError.Check.
+const (
+	PreflightStorage      = "storage"      // The state storage accepts writes
+	PreflightAvailability = "availability" // The availability checker answers for every candidate
+)
+
+// PreflightError is reported when a check of AssignOptions.RequireAllChecks
+// fails. It is reported before a user is selected, so nothing was changed.
+// A failed availability check also matches ErrAvailability.
+type PreflightError struct {
+	Group string
+	Check string // PreflightStorage or PreflightAvailability
+	Err   error
+}
+
+func (e *PreflightError) Error() string {
+	hint := "check that the data directory and the state backend are reachable and writable"
+	if e.Check == PreflightAvailability {
+		hint = "check the availability backend, or assign with another availability checker"
+	}
+	return fmt.Sprintf("pre-flight %s check failed for group %s, nothing was assigned: %v; %s", e.Check, e.Group, e.Err, hint)
+}
+
+func (e *PreflightError) Unwrap() error { return e.Err }
+
+func (e *PreflightError) Is(target error) bool { return target == ErrPreflight }
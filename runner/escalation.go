@@ -0,0 +1,250 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// EscalationStep is a step of the escalation chain of a group, taken when
+// an open assignment wasn't acknowledged within its time:
+//
+//	track_open: true
+//	escalation:
+//	  - after: 30m
+//	    contact: dave
+//	  - after: 2h
+//	    group: team-leads
+//	  - after: 4h
+//	    reassign: true
+//
+// A step notifies its contact, or the user its group would assign next, or
+// with reassign assigns a user other than the assignee from its group, or
+// from the group of the assignment, in place of the assignee.
+type EscalationStep struct {
+	After    string `yaml:"after" jsonschema:"required"` // Time after the assignment the step is taken without acknowledgement, e.g. 30m, 2h or 1d; later steps need later times
+	Contact  string `yaml:"contact"`                     // User escalated to, such as the lead of the team
+	Group    string `yaml:"group"`                       // Group escalated to: the user it would assign next is notified, or assigned with reassign
+	Reassign bool   `yaml:"reassign"`                    // Assign a user from group, or another user of this group, and drop the unacknowledged assignment
+}
+
+// validate checks the step and returns its time after the assignment.
+func (s EscalationStep) validate() (time.Duration, error) {
+	after, err := history.ParseWindow(s.After)
+	if err != nil {
+		return 0, fmt.Errorf("invalid escalation after %q, want a duration such as 30m or 1d", s.After)
+	}
+	if s.Contact == "" && s.Group == "" && !s.Reassign {
+		return 0, fmt.Errorf("escalation step needs contact, group or reassign")
+	}
+	if s.Contact != "" && (s.Group != "" || s.Reassign) {
+		return 0, fmt.Errorf("escalation step with contact takes no group or reassign")
+	}
+	return after, nil
+}
+
+// validateEscalation checks the escalation chain of a group.
+func (c *AssigneeGroupConfig) validateEscalation() error {
+	if len(c.Escalation) == 0 {
+		return nil
+	}
+	if !c.TrackOpen {
+		return fmt.Errorf("escalation requires track_open")
+	}
+	var last time.Duration
+	for i, step := range c.Escalation {
+		after, err := step.validate()
+		if err != nil {
+			return fmt.Errorf("escalation[%d]: %w", i, err)
+		}
+		if after <= last {
+			return fmt.Errorf("escalation[%d]: after %s is not later than the step before", i, step.After)
+		}
+		last = after
+	}
+	return nil
+}
+
+// Escalation is a step of an escalation chain taken by Escalate.
+type Escalation struct {
+	Group      string `json:"group"`                // Group of the unacknowledged assignment
+	ID         string `json:"id"`                   // ID of the unacknowledged assignment
+	User       string `json:"user"`                 // Assignee who didn't acknowledge
+	Step       int    `json:"step"`                 // Index of the step in the group's escalation
+	After      string `json:"after"`                // Time the assignment went unacknowledged, as configured for the step
+	Contact    string `json:"contact,omitempty"`    // User escalated to: the contact of the step, or the next of its group
+	Target     string `json:"target,omitempty"`     // Group the contact or new assignee was selected from
+	Reassigned string `json:"reassigned,omitempty"` // New assignee of a step with reassign
+}
+
+// Message returns the notification of the escalation, e.g. "Assignment
+// 01HX... of team-alpha to alice wasn't acknowledged within 30m, escalating to dave".
+func (e Escalation) Message() string {
+	msg := fmt.Sprintf("Assignment %s of %s to %s wasn't acknowledged within %s", e.ID, e.Group, e.User, e.After)
+	switch {
+	case e.Reassigned != "" && e.Target != e.Group:
+		return msg + fmt.Sprintf(", reassigned to %s from %s", e.Reassigned, e.Target)
+	case e.Reassigned != "":
+		return msg + fmt.Sprintf(", reassigned to %s", e.Reassigned)
+	case e.Target != "":
+		return msg + fmt.Sprintf(", escalating to %s of %s", e.Contact, e.Target)
+	default:
+		return msg + fmt.Sprintf(", escalating to %s", e.Contact)
+	}
+}
+
+// Escalate takes the steps of the escalation chains of every group that
+// are due at now for open assignments that weren't acknowledged, and
+// passes each step to send, such as to notify its contact. A step is taken
+// again at the next call when send fails, unless it already reassigned the
+// assignment. It returns the steps taken; steps that failed are joined in
+// the error and don't keep the others from being taken.
+func Escalate(ctx context.Context, now time.Time, send func(Escalation) error) ([]Escalation, error) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	var taken []Escalation
+	var errs []error
+	for _, group := range groups {
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil || len(groupConf.Escalation) == 0 || !groupConf.TrackOpen {
+			continue
+		}
+		if err := groupConf.validateEscalation(); err != nil {
+			errs = append(errs, &ConfigError{Group: group, Err: err})
+			continue
+		}
+		escalations, err := escalateGroup(ctx, group, groupConf, now, send)
+		taken = append(taken, escalations...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return taken, errors.Join(errs...)
+}
+
+// escalateGroup takes the due escalation steps of the open assignments of a group.
+func escalateGroup(ctx context.Context, group string, groupConf *AssigneeGroupConfig, now time.Time, send func(Escalation) error) ([]Escalation, error) {
+	ledger, err := readLedger(group)
+	if err != nil {
+		return nil, err
+	}
+	var taken []Escalation
+	var errs []error
+	// Steps taken and assignments reassigned, keyed by ID and user, applied
+	// to the ledger once the steps are taken, as reassigning writes it
+	steps := map[[2]string]int{}
+	dropped := map[[2]string]bool{}
+	for _, open := range ledger {
+		if open.Acknowledged() {
+			continue
+		}
+		assignedAt, err := time.Parse(time.RFC3339, open.AssignedAt)
+		if err != nil {
+			continue
+		}
+		key := [2]string{open.ID, open.User}
+		for i := open.Escalated; i < len(groupConf.Escalation); i++ {
+			step := groupConf.Escalation[i]
+			after, _ := step.validate()
+			if assignedAt.Add(after).After(now) {
+				break
+			}
+			e, err := takeEscalationStep(ctx, group, open, i, step)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to escalate assignment %s of %s: %w", open.ID, group, err))
+				break
+			}
+			if err := send(e); err != nil && e.Reassigned == "" {
+				errs = append(errs, fmt.Errorf("failed to send escalation of assignment %s of %s: %w", open.ID, group, err))
+				break
+			}
+			taken = append(taken, e)
+			steps[key] = i + 1
+			to := e.Contact
+			if e.Reassigned != "" {
+				to = e.Reassigned
+				dropped[key] = true
+			}
+			notifyGroup(ctx, group, groupConf.Webhooks, GroupEvent{Event: EventEscalated, ID: open.ID, User: open.User, Role: open.Role, To: to, Reason: e.Message()})
+			if e.Reassigned != "" {
+				break
+			}
+		}
+	}
+	if len(steps) > 0 {
+		if err := recordEscalations(ctx, group, steps, dropped); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return taken, errors.Join(errs...)
+}
+
+// takeEscalationStep takes a step of the escalation chain of group for an
+// open assignment, selecting the contact or assigning the new assignee.
+func takeEscalationStep(ctx context.Context, group string, open OpenAssignment, index int, step EscalationStep) (Escalation, error) {
+	e := Escalation{Group: group, ID: open.ID, User: open.User, Step: index, After: step.After, Contact: step.Contact}
+	if step.Contact != "" {
+		return e, nil
+	}
+	e.Target = step.Group
+	if e.Target == "" {
+		e.Target = group
+	}
+	opts := AssignOptions{Exclude: []string{open.User}, Silent: true, DryRun: !step.Reassign}
+	if step.Reassign {
+		opts.CallbackData = map[string]string{"escalated_from": open.ID}
+	}
+	result, err := AssignUser(ctx, e.Target, opts)
+	if err != nil {
+		return e, err
+	}
+	if result.User == "" {
+		return e, fmt.Errorf("assignment from %s was deferred until %s", e.Target, result.Deferred)
+	}
+	if step.Reassign {
+		e.Reassigned = result.User
+	} else {
+		e.Contact = result.User
+	}
+	return e, nil
+}
+
+// recordEscalations records in the ledger of a group the number of steps
+// taken for its open assignments, and drops the reassigned ones.
+func recordEscalations(ctx context.Context, group string, steps map[[2]string]int, dropped map[[2]string]bool) error {
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	ledger, err := readLedger(group)
+	if err != nil {
+		return err
+	}
+	kept := ledger[:0]
+	for _, open := range ledger {
+		key := [2]string{open.ID, open.User}
+		if dropped[key] {
+			continue
+		}
+		if n, ok := steps[key]; ok && n > open.Escalated {
+			open.Escalated = n
+		}
+		kept = append(kept, open)
+	}
+	if err := writeLedger(group, kept); err != nil {
+		return err
+	}
+	recordStateChange(fmt.Sprintf("Escalate %d assignment(s) in %s", len(steps), group))
+	return nil
+}
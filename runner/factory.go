@@ -2,8 +2,13 @@ package runner
 
 import (
 	"autoassigner/availability"
+	"autoassigner/config"
+	"autoassigner/jira"
 	"autoassigner/selector"
+	"context"
 	"fmt"
+	"sync"
+	"time"
 )
 
 // ComponentFactory creates components for the runner
@@ -29,27 +34,144 @@ func NewComponentFactory(
 	}
 }
 
-// CreateAssignmentStrategy creates an assignment strategy based on the strategy name
-func (f *ComponentFactory) CreateAssignmentStrategy(strategy string) (AssignmentStrategy, error) {
+// StrategyNames lists the strategies understood by CreateAssignmentStrategy
+var StrategyNames = []string{"random", "least_assigned", "round_robin", "open_load", "least_recently_assigned"}
+
+// WorkloadProviderNames lists the providers understood by CreateWorkloadProvider
+var WorkloadProviderNames = []string{"open", "jira"}
+
+// AvailabilityCheckerNames lists the checkers understood by CreateAvailabilityChecker
+var AvailabilityCheckerNames = []string{"inout", "always_available", "bamboohr", "workday", "zendesk"}
+
+// Backends returns the compiled-in components by kind, as reported in the
+// backends of version.Info.
+func Backends() map[string][]string {
+	return map[string][]string{
+		"strategies":            StrategyNames,
+		"availability_checkers": AvailabilityCheckerNames,
+		"workload_providers":    WorkloadProviderNames,
+	}
+}
+
+// CreateAssignmentStrategy creates an assignment strategy based on the strategy name and options.
+// A comma-separated chain of names, as held by StrategyChain, creates a
+// selector.Composite applying the strategies in order.
+func (f *ComponentFactory) CreateAssignmentStrategy(strategy string, opts StrategyOptions) (AssignmentStrategy, error) {
+	if names := strategyNames(strategy); len(names) > 1 {
+		chain := &selector.Composite{}
+		for _, name := range names {
+			s, err := f.CreateAssignmentStrategy(name, opts)
+			if err != nil {
+				return nil, err
+			}
+			chain.Strategies = append(chain.Strategies, s)
+		}
+		return chain, nil
+	}
 	switch strategy {
 	case "random":
+		if opts.Seed != nil {
+			return selector.NewRandom(*opts.Seed), nil
+		}
 		return &selector.Random{}, nil
 	case "least_assigned":
 		return &selector.LeastAssigned{}, nil
 	case "round_robin":
 		return &selector.RoundRobin{}, nil
+	case "open_load":
+		// The open assignments are filled in by the runner, which knows the group
+		return &selector.OpenLoad{}, nil
+	case "least_recently_assigned":
+		// The times of the last assignments are filled in by the runner
+		return &selector.LeastRecentlyAssigned{}, nil
 	default:
 		return nil, fmt.Errorf("unknown strategy: %s", strategy)
 	}
 }
 
-// CreateAvailabilityChecker creates an availability checker based on the checker name
+// CreateWorkloadProvider creates the provider of the workload balanced by
+// the open_load strategy; an empty name selects the open assignments.
+func (f *ComponentFactory) CreateWorkloadProvider(provider string) (WorkloadProvider, error) {
+	switch provider {
+	case "", "open":
+		return ledgerWorkload{}, nil
+	case "jira":
+		return &jira.WorkloadProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown workload provider: %s", provider)
+	}
+}
+
+// ledgerWorkload takes the open assignments of the ledger of a group as
+// the workload of its users.
+type ledgerWorkload struct{}
+
+func (ledgerWorkload) Workload(ctx context.Context, group string, users []string) (map[string]int, error) {
+	open, _, err := OpenWork(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read open assignments: %w", err)
+	}
+	return open, nil
+}
+
+// CreateAvailabilityChecker creates an availability checker based on the checker name.
+// When availability.cache configures a TTL for it, the checker reuses its
+// results for that long; the cache is shared by every factory of the process.
 func (f *ComponentFactory) CreateAvailabilityChecker(checker string) (AvailabilityChecker, error) {
+	ttl := checkerCacheTTL(checker)
+	if ttl <= 0 {
+		return newAvailabilityChecker(checker)
+	}
+
+	cachedCheckersMu.Lock()
+	defer cachedCheckersMu.Unlock()
+	key := cachedCheckerKey{name: checker, ttl: ttl}
+	if cached, ok := cachedCheckers[key]; ok {
+		return cached, nil
+	}
+	c, err := newAvailabilityChecker(checker)
+	if err != nil {
+		return nil, err
+	}
+	cached := availability.Cached(c, ttl)
+	cachedCheckers[key] = cached
+	return cached, nil
+}
+
+// cachedCheckerKey identifies a cached checker, so changing its TTL in the config starts a new cache.
+type cachedCheckerKey struct {
+	name string
+	ttl  time.Duration
+}
+
+var (
+	cachedCheckersMu sync.Mutex
+	cachedCheckers   = map[cachedCheckerKey]availability.Checker{}
+)
+
+// checkerCacheTTL returns how long the results of a checker are reused.
+func checkerCacheTTL(checker string) time.Duration {
+	conf := config.Settings.Availability.Cache
+	seconds, ok := conf.Checkers[checker]
+	if !ok {
+		seconds = conf.TTLSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// newAvailabilityChecker creates the availability checker with the given name.
+func newAvailabilityChecker(checker string) (AvailabilityChecker, error) {
 	switch checker {
 	case "inout":
 		return &availability.InOutChecker{}, nil
 	case "always_available":
 		return &availability.AlwaysAvailable{}, nil
+	case "bamboohr":
+		return &availability.BambooHRChecker{}, nil
+	case "workday":
+		return &availability.WorkdayChecker{}, nil
+	case "zendesk":
+		return &availability.ZendeskChecker{}, nil
 	default:
 		return nil, fmt.Errorf("unknown availability checker: %s", checker)
 	}
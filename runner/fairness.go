@@ -0,0 +1,75 @@
+package runner
+
+import "fmt"
+
+// Supported values for Fairness.Action.
+const (
+	FairnessReject = "reject"
+	FairnessWarn   = "warn"
+)
+
+// Fairness is a guardrail against selections that put a user far above the
+// others, such as those of a misconfigured or pathological strategy.
+type Fairness struct {
+	MaxAboveMean int    `yaml:"max_above_mean"`                       // Assignments a user may have above the mean of the group once assigned; 0 disables the guardrail
+	Action       string `yaml:"action" jsonschema:"enum=reject|warn"` // reject (default) skips the user for the next candidate, warn assigns them with a warning
+}
+
+// enabled reports whether the guardrail is configured.
+func (f Fairness) enabled() bool {
+	return f.MaxAboveMean != 0
+}
+
+// validate returns an error for a negative threshold or an unknown action.
+func (f Fairness) validate() error {
+	if f.MaxAboveMean < 0 {
+		return fmt.Errorf("fairness max_above_mean must not be negative")
+	}
+	switch f.Action {
+	case "", FairnessReject, FairnessWarn:
+		return nil
+	default:
+		return fmt.Errorf("unknown fairness action: %s", f.Action)
+	}
+}
+
+// fairnessGuard tells which users of a group an assignment would put more
+// than max_above_mean assignments above the mean of the group's counts.
+type fairnessGuard struct {
+	conf   Fairness
+	counts map[string]int
+	mean   float64 // Mean of the members' counts after one more assignment
+}
+
+// newFairnessGuard checks selections against the counts of a group. It
+// returns nil when the group has no guardrail.
+func newFairnessGuard(group string, conf *AssigneeGroupConfig, counts map[string]int) (*fairnessGuard, error) {
+	if !conf.Fairness.enabled() {
+		return nil, nil
+	}
+	if err := conf.Fairness.validate(); err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	total := 1
+	for _, user := range conf.Users {
+		total += counts[user]
+	}
+	return &fairnessGuard{conf: conf.Fairness, counts: counts, mean: float64(total) / float64(len(conf.Users))}, nil
+}
+
+// exceeded returns how many assignments above the mean the user would have
+// beyond the threshold once assigned, 0 when within it.
+func (g *fairnessGuard) exceeded(user string) float64 {
+	if g == nil {
+		return 0
+	}
+	if above := float64(g.counts[user]+1) - g.mean; above > float64(g.conf.MaxAboveMean) {
+		return above
+	}
+	return 0
+}
+
+// rejects reports whether the user is skipped by the guardrail.
+func (g *fairnessGuard) rejects(user string) bool {
+	return g != nil && g.conf.Action != FairnessWarn && g.exceeded(user) > 0
+}
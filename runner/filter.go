@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// registeredFilters holds the filters added with RegisterFilter, in the
+// order they were first registered.
+var registeredFilters = struct {
+	sync.Mutex
+	names  []string
+	byName map[string]Filter
+}{byName: map[string]Filter{}}
+
+// RegisterFilter adds f under name to the admission filters of every group,
+// after the built-in ones and before availability, replacing any filter
+// registered under name; a nil f removes it. Candidates f rejects are skipped
+// like unavailable users, with the reason it returns in skips.log, and an
+// error of f fails the assignment.
+func RegisterFilter(name string, f Filter) {
+	registeredFilters.Lock()
+	defer registeredFilters.Unlock()
+	if _, ok := registeredFilters.byName[name]; !ok && f != nil {
+		registeredFilters.names = append(registeredFilters.names, name)
+	}
+	if f != nil {
+		registeredFilters.byName[name] = f
+		return
+	}
+	delete(registeredFilters.byName, name)
+	for i, n := range registeredFilters.names {
+		if n == name {
+			registeredFilters.names = append(registeredFilters.names[:i:i], registeredFilters.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// FilterFunc adapts a function to the Filter interface.
+type FilterFunc func(ctx context.Context, group, user string) (string, error)
+
+// Admit calls f.
+func (f FilterFunc) Admit(ctx context.Context, group, user string) (string, error) {
+	return f(ctx, group, user)
+}
+
+// namedFilter is a filter of the selection pipeline with the name selection
+// traces give it.
+type namedFilter struct {
+	name string
+	Filter
+}
+
+// customFilters returns the registered filters in order.
+func customFilters() []namedFilter {
+	registeredFilters.Lock()
+	defer registeredFilters.Unlock()
+	filters := make([]namedFilter, 0, len(registeredFilters.names))
+	for _, name := range registeredFilters.names {
+		filters = append(filters, namedFilter{name, registeredFilters.byName[name]})
+	}
+	return filters
+}
+
+// candidateFilters returns the filters narrowing a route before the strategy
+// picks: the excluded users and, when eligible is not empty, every user not
+// in it. Names may be aliases of members.
+func candidateFilters(conf *AssigneeGroupConfig, exclude, eligible []string) []namedFilter {
+	var filters []namedFilter
+	if len(exclude) > 0 {
+		excluded := make(userSet, len(exclude))
+		for _, name := range exclude {
+			excluded[conf.canonicalUser(name)] = true
+		}
+		filters = append(filters, namedFilter{"exclude", exclusionFilter{excluded}})
+	}
+	if len(eligible) > 0 {
+		allowed := make(userSet, len(eligible))
+		for _, name := range eligible {
+			allowed[conf.canonicalUser(name)] = true
+		}
+		filters = append(filters, namedFilter{"eligible", eligibilityFilter{allowed}})
+	}
+	return filters
+}
+
+// admissionFilters returns the filters asked about the candidates the
+// strategy picks, in the order they apply. Nil parts are left out.
+func admissionFilters(paused map[string]time.Time, limits *assignmentLimits, fairness *fairnessGuard, check *availabilityCheck) []namedFilter {
+	filters := []namedFilter{{"pause", pauseFilter{paused}}}
+	if limits != nil {
+		filters = append(filters, namedFilter{"capacity", capacityFilter{limits}}, namedFilter{"cooldown", cooldownFilter{limits}})
+	}
+	if fairness != nil {
+		filters = append(filters, namedFilter{"fairness", fairnessFilter{fairness}})
+	}
+	filters = append(filters, customFilters()...)
+	return append(filters, namedFilter{"availability", availabilityFilter{check}})
+}
+
+// admit returns the name of the first of filters rejecting user and the
+// reason it gives, or "" when they all admit the user.
+func admit(ctx context.Context, filters []namedFilter, group, user string) (string, string, error) {
+	for _, f := range filters {
+		reason, err := f.Admit(ctx, group, user)
+		if err != nil || reason != "" {
+			return f.name, reason, err
+		}
+	}
+	return "", "", nil
+}
+
+// userSet is a set of user names.
+type userSet map[string]bool
+
+// exclusionFilter rejects the users excluded from an assignment.
+type exclusionFilter struct{ excluded userSet }
+
+func (f exclusionFilter) Admit(ctx context.Context, group, user string) (string, error) {
+	if f.excluded[user] {
+		return "excluded", nil
+	}
+	return "", nil
+}
+
+// eligibilityFilter rejects the users not eligible for an assignment.
+type eligibilityFilter struct{ allowed userSet }
+
+func (f eligibilityFilter) Admit(ctx context.Context, group, user string) (string, error) {
+	if !f.allowed[user] {
+		return "not eligible", nil
+	}
+	return "", nil
+}
+
+// pauseFilter rejects paused users.
+type pauseFilter struct{ paused map[string]time.Time }
+
+func (f pauseFilter) Admit(ctx context.Context, group, user string) (string, error) {
+	if _, ok := f.paused[user]; ok {
+		return skipPaused, nil
+	}
+	return "", nil
+}
+
+// capacityFilter rejects users who reached their daily or weekly limit.
+type capacityFilter struct{ limits *assignmentLimits }
+
+func (f capacityFilter) Admit(ctx context.Context, group, user string) (string, error) {
+	return f.limits.capacityReached(user), nil
+}
+
+// cooldownFilter rejects users still cooling down from their last assignment.
+type cooldownFilter struct{ limits *assignmentLimits }
+
+func (f cooldownFilter) Admit(ctx context.Context, group, user string) (string, error) {
+	if f.limits.coolingDown(user) {
+		return skipCooldown, nil
+	}
+	return "", nil
+}
+
+// fairnessFilter rejects users the fairness guardrail rejects.
+type fairnessFilter struct{ guard *fairnessGuard }
+
+func (f fairnessFilter) Admit(ctx context.Context, group, user string) (string, error) {
+	if f.guard.rejects(user) {
+		return skipFairness, nil
+	}
+	return "", nil
+}
+
+// availabilityFilter rejects unavailable users.
+type availabilityFilter struct{ check *availabilityCheck }
+
+func (f availabilityFilter) Admit(ctx context.Context, group, user string) (string, error) {
+	available, err := f.check.available(ctx, user)
+	if err != nil || available {
+		return "", err
+	}
+	return f.check.skipReason(user), nil
+}
@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+// CheckGroup cross-verifies the stored counts and last index of a group with its assignments.log
+// and returns a description of every inconsistency found.
+// Counts are compared with the log totals, or for a group whose counts were
+// reset, with the assignments logged since the reset.
+func CheckGroup(group string) ([]string, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	configured := make(map[string]bool, len(groupConf.Users))
+	for _, user := range groupConf.Users {
+		configured[user] = true
+	}
+
+	var issues []string
+	records, logErr := history.ReadFile(filepath.Join(groupDir, "assignments.log"))
+	if logErr != nil {
+		issues = append(issues, fmt.Sprintf("assignments.log is unreadable: %v", logErr))
+	}
+	stored, countsErr := readCountsFile(group)
+	if countsErr != nil {
+		issues = append(issues, fmt.Sprintf("stored state is unreadable: %v", countsErr))
+	}
+
+	groupConf.mergeAliasCounts(stored)
+	var storedUsers []string
+	for user := range stored {
+		storedUsers = append(storedUsers, user)
+	}
+	sort.Strings(storedUsers)
+	for _, user := range storedUsers {
+		if !configured[user] {
+			issues = append(issues, fmt.Sprintf("stored counts have orphaned user %s that is not in the group config", user))
+		}
+	}
+
+	if logErr == nil && countsErr == nil {
+		logCounts, err := loggedCounts(group, groupConf, records)
+		if err != nil {
+			issues = append(issues, err.Error())
+		}
+		reset := readReset(group)
+		for _, user := range groupConf.Users {
+			if reset == nil {
+				if stored[user] != logCounts[user] {
+					issues = append(issues, fmt.Sprintf("count for %s is %d but assignments.log has %d", user, stored[user], logCounts[user]))
+				}
+			} else if since := logCounts[user] - reset.Logged[user]; stored[user] != since {
+				issues = append(issues, fmt.Sprintf("count for %s is %d but assignments.log has %d since the counts were reset on %s", user, stored[user], since, reset.At.Format("2006-01-02")))
+			}
+		}
+	}
+
+	// A cursor set after the last assignment differs from the log on purpose
+	lastIndex, cursor := readCursor(group)
+	if lastIndex < -1 || lastIndex >= len(groupConf.Users) {
+		issues = append(issues, fmt.Sprintf("last index %d is outside the user list (%d users)", lastIndex, len(groupConf.Users)))
+	} else if logErr == nil && len(records) > 0 && cursor == "" && lastIndex != records[len(records)-1].NextIndex {
+		issues = append(issues, fmt.Sprintf("last index %d does not match assignments.log (%d)", lastIndex, records[len(records)-1].NextIndex))
+	}
+
+	return issues, nil
+}
+
+// loggedCounts returns the assignments of each user in the log records of a
+// group and the records pruned from it. The counts of the log are returned
+// even when the pruned counts can't be read.
+func loggedCounts(group string, groupConf *AssigneeGroupConfig, records []history.Record) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, record := range records {
+		counts[groupConf.canonicalUser(record.User)]++
+	}
+	// Records pruned by maintenance are still counted
+	pruned, err := readPrunedCounts(group)
+	if err != nil {
+		return counts, err
+	}
+	for user, count := range pruned.totals() {
+		counts[groupConf.canonicalUser(user)] += count
+	}
+	return counts, nil
+}
+
+// readReset reads when the counts of a group were last reset, nil if never
+// or when the state can't be read.
+func readReset(group string) *stateReset {
+	s, err := readStoredState(group)
+	if err != nil {
+		return nil
+	}
+	return s.Reset
+}
+
+// RepairGroup rewrites the stored counts and last index of a group from its assignment log,
+// dropping users that are no longer configured and clamping the last index to the user list.
+// The counts of a group whose counts were reset are repaired to the assignments logged since.
+func RepairGroup(ctx context.Context, group string) error {
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	rebuild, err := RebuildCounts(group)
+	if err != nil {
+		return err
+	}
+
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return &InvalidGroupError{Group: group}
+	}
+	rebuild.reset = readReset(group)
+	counts := make(map[string]int, len(groupConf.Users))
+	for _, user := range groupConf.Users {
+		counts[user] = rebuild.RebuiltCounts[user]
+		if rebuild.reset != nil {
+			if counts[user] -= rebuild.reset.Logged[user]; counts[user] < 0 {
+				counts[user] = 0
+			}
+		}
+	}
+	rebuild.RebuiltCounts = counts
+	if rebuild.RebuiltIndex >= len(groupConf.Users) {
+		rebuild.RebuiltIndex = -1
+	}
+
+	if err := applyRebuild(rebuild); err != nil {
+		return err
+	}
+	if err := syncSharedState(group, rebuild.edit()); err != nil {
+		return err
+	}
+	recordStateChange(fmt.Sprintf("Repair state of %s", group))
+	return nil
+}
+
+// readCountsFile reads the stored lifetime counts, without adding configured users.
+// A group without stored state has none.
+func readCountsFile(group string) (map[string]int, error) {
+	b, err := readCountBuckets(group)
+	if err != nil {
+		return nil, err
+	}
+	return b.totals(), nil
+}
@@ -0,0 +1,224 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GarbageReport lists stored state that no group config refers to any more.
+type GarbageReport struct {
+	OrphanedDirs  []string            // Data directories without a group config
+	OrphanedUsers map[string][]string // Users with stored counts or skip debts, per group, that the group no longer configures
+}
+
+// Empty reports whether there is nothing to collect.
+func (r *GarbageReport) Empty() bool {
+	return len(r.OrphanedDirs) == 0 && len(r.OrphanedUsers) == 0
+}
+
+// FindGarbage scans the data directory for state left behind by deleted
+// or renamed groups and removed users, without changing anything.
+// Hidden directories, such as the archive, are never reported.
+func FindGarbage() (*GarbageReport, error) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	configured := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		configured[group] = true
+	}
+
+	// Directories of groups in subdirectories are nested in those of their namespaces
+	namespaces := map[string]bool{}
+	for _, group := range groups {
+		for i := strings.LastIndex(group, "/"); i > 0; i = strings.LastIndex(group[:i], "/") {
+			namespaces[group[:i]] = true
+		}
+	}
+
+	report := &GarbageReport{OrphanedUsers: map[string][]string{}}
+	var scan func(prefix string) error
+	scan = func(prefix string) error {
+		entries, err := os.ReadDir(filepath.Join(config.Settings.Storage.DataDir, filepath.FromSlash(prefix)))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read data directory: %w", err)
+		}
+		for _, entry := range entries {
+			name := prefix + entry.Name()
+			if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || configured[name] {
+				continue
+			}
+			if namespaces[name] {
+				if err := scan(name + "/"); err != nil {
+					return err
+				}
+				continue
+			}
+			report.OrphanedDirs = append(report.OrphanedDirs, name)
+		}
+		return nil
+	}
+	if err := scan(""); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(groups)
+	for _, group := range groups {
+		users, err := orphanedUsers(group)
+		if err != nil {
+			return nil, err
+		}
+		if len(users) > 0 {
+			report.OrphanedUsers[group] = users
+		}
+	}
+	return report, nil
+}
+
+// dropUsersEdit returns the edit dropping the counts of users from the shared state.
+func dropUsersEdit(users []string) stateEdit {
+	return func(lastIndex *int, counts map[string]int) {
+		for _, user := range users {
+			delete(counts, user)
+		}
+	}
+}
+
+// CollectGarbage removes the orphaned data directories of a report and the
+// stored counts and skip debts of its orphaned users, each under the lock of
+// its group.
+func CollectGarbage(ctx context.Context, r *GarbageReport) error {
+	for _, dir := range r.OrphanedDirs {
+		if err := removeDataDir(ctx, dir); err != nil {
+			return err
+		}
+	}
+
+	groups := make([]string, 0, len(r.OrphanedUsers))
+	for group := range r.OrphanedUsers {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		if err := dropOrphanedUsers(ctx, group, r.OrphanedUsers[group]); err != nil {
+			return err
+		}
+	}
+
+	if !r.Empty() {
+		recordStateChange("Collect orphaned state")
+	}
+	return nil
+}
+
+// orphanedUsers returns the users with stored counts or skip debts in a
+// group that are not in its config, sorted by name.
+func orphanedUsers(group string) ([]string, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	configured := make(map[string]bool, len(groupConf.Users))
+	for _, user := range groupConf.Users {
+		configured[user] = true
+	}
+
+	counts, err := readCountsFile(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read counts of group %s: %w", group, err)
+	}
+	debts, err := readDebts(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read skip debts of group %s: %w", group, err)
+	}
+
+	orphaned := map[string]bool{}
+	for _, stored := range []map[string]int{counts, debts} {
+		for user := range stored {
+			if !configured[groupConf.canonicalUser(user)] {
+				orphaned[user] = true
+			}
+		}
+	}
+	users := make([]string, 0, len(orphaned))
+	for user := range orphaned {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// removeDataDir removes the data directory of a deleted group under its lock.
+func removeDataDir(ctx context.Context, dir string) error {
+	release, err := takeLock(ctx, dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	if err := os.RemoveAll(filepath.Join(config.Settings.Storage.DataDir, filepath.FromSlash(dir))); err != nil {
+		return fmt.Errorf("failed to remove data directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// dropOrphanedUsers removes users from the stored state of a group, locally
+// and in the shared backend, under the group's lock.
+func dropOrphanedUsers(ctx context.Context, group string, users []string) error {
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	if err := dropUsers(group, users); err != nil {
+		return fmt.Errorf("failed to clean group %s: %w", group, err)
+	}
+	return syncSharedState(group, dropUsersEdit(users))
+}
+
+// dropUsers removes users from the stored counts and skip debts of a group.
+func dropUsers(group string, users []string) error {
+	counts, err := readCountsFile(group)
+	if err != nil {
+		return err
+	}
+	debts, err := readDebts(group)
+	if err != nil {
+		return err
+	}
+
+	countsChanged, debtsChanged := false, false
+	for _, user := range users {
+		if _, ok := counts[user]; ok {
+			delete(counts, user)
+			countsChanged = true
+		}
+		if _, ok := debts[user]; ok {
+			delete(debts, user)
+			debtsChanged = true
+		}
+	}
+	if countsChanged {
+		if err := writeCounts(group, counts); err != nil {
+			return err
+		}
+	}
+	if debtsChanged {
+		return writeDebts(group, debts)
+	}
+	return nil
+}
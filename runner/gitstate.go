@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitIgnore keeps caches and temporary files out of the state repository.
+const gitIgnore = "hr-cache-*.json\n.*.tmp*\n"
+
+// GitStorageManager decorates a StorageManager so that every committed
+// transaction is also committed to a git repository at the data directory.
+type GitStorageManager struct {
+	StorageManager
+}
+
+// BeginTransaction begins a transaction of the decorated storage whose
+// Commit also creates a git commit.
+func (m *GitStorageManager) BeginTransaction(ctx context.Context, group string) (StateTransaction, error) {
+	tx, err := m.StorageManager.BeginTransaction(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	return &gitTransaction{StateTransaction: tx, group: group}, nil
+}
+
+// CheckWritable checks the decorated storage; the data directory is the
+// work tree of the repository.
+func (m *GitStorageManager) CheckWritable(ctx context.Context, group string) error {
+	return checkWritable(ctx, m.StorageManager, group)
+}
+
+// gitTransaction commits the data directory to git after the wrapped transaction commits.
+type gitTransaction struct {
+	StateTransaction
+	group string
+}
+
+func (tx *gitTransaction) Commit() error {
+	if err := tx.StateTransaction.Commit(); err != nil {
+		return err
+	}
+	recordStateChange(fmt.Sprintf("Record assignment in %s", tx.group))
+	return nil
+}
+
+// recordStateChange commits the data directory when git-backed state is enabled
+// and pushes it when it is mirrored to S3. The state change has already
+// happened, so failures are logged rather than returned.
+func recordStateChange(message string) {
+	logPushFailure(pushState(context.Background(), ""))
+	if !config.Settings.Storage.Git.Enabled {
+		return
+	}
+	if err := commitDataDir(message); err != nil {
+		log.Printf("Warning: failed to commit state to git: %v", err)
+	}
+}
+
+// commitDataDir commits every change in the data directory with the given
+// message, initializing the repository first if needed, and pushes when configured.
+func commitDataDir(message string) error {
+	gitConf := config.Settings.Storage.Git
+	dir := config.Settings.Storage.DataDir
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if _, err := runGit(dir, "init", "-q"); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte(gitIgnore), 0644); err != nil {
+			return err
+		}
+	}
+
+	if _, err := runGit(dir, "add", "-A"); err != nil {
+		return err
+	}
+	status, err := runGit(dir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		return nil
+	}
+
+	author := currentActor()
+	if author == "" {
+		author = "autoassigner"
+	}
+	email := gitConf.AuthorEmail
+	if email == "" {
+		email = "autoassigner@localhost"
+	}
+	if _, err := runGit(dir, "-c", "user.name="+author, "-c", "user.email="+email, "commit", "-q", "-m", message); err != nil {
+		return err
+	}
+
+	if gitConf.Push {
+		remote := gitConf.Remote
+		if remote == "" {
+			remote = "origin"
+		}
+		if _, err := runGit(dir, "push", "-q", remote, "HEAD"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runGit runs git in dir and returns its trimmed standard output.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,607 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// archiveDirName is the directory of the data directory that archived groups are moved to.
+// It is hidden so it can never clash with the data directory of a group.
+const archiveDirName = ".archive"
+
+// ArchiveGroup moves the config file and data directory of a group into
+// <data_dir>/.archive/<group>-<timestamp>/, as group.yaml and data/, and
+// drops its deferred assignments. It returns the archive directory.
+func ArchiveGroup(group string) (string, error) {
+	confPath, err := groupConfigPath(group)
+	if err != nil {
+		return "", err
+	}
+
+	archiveDir := filepath.Join(config.Settings.Storage.DataDir, archiveDirName,
+		group+"-"+timeNow().UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	// Move the data first, so a failure leaves the group configured rather than orphaning its state
+	dataDir := filepath.Join(config.Settings.Storage.DataDir, group)
+	if _, err := os.Stat(dataDir); err == nil {
+		if err := os.Rename(dataDir, filepath.Join(archiveDir, "data")); err != nil {
+			return "", fmt.Errorf("failed to archive data directory: %w", err)
+		}
+	}
+	if err := os.Rename(confPath, filepath.Join(archiveDir, "group.yaml")); err != nil {
+		return "", fmt.Errorf("failed to archive config file: %w", err)
+	}
+
+	if err := dropQueuedAssignments(group); err != nil {
+		return archiveDir, err
+	}
+	recordStateChange(fmt.Sprintf("Archive group %s", group))
+	return archiveDir, nil
+}
+
+// DeleteGroup removes the config file of a group and drops its deferred
+// assignments. Its data directory is removed too when purgeData is true,
+// and otherwise kept.
+func DeleteGroup(group string, purgeData bool) error {
+	confPath, err := groupConfigPath(group)
+	if err != nil {
+		return err
+	}
+
+	if purgeData {
+		if err := os.RemoveAll(filepath.Join(config.Settings.Storage.DataDir, group)); err != nil {
+			return fmt.Errorf("failed to remove data directory: %w", err)
+		}
+	}
+	if err := os.Remove(confPath); err != nil {
+		return fmt.Errorf("failed to remove config file: %w", err)
+	}
+
+	if err := dropQueuedAssignments(group); err != nil {
+		return err
+	}
+	recordStateChange(fmt.Sprintf("Delete group %s", group))
+	return nil
+}
+
+// RenameGroup renames a group: its config file and data directory are
+// moved to the new name and the group field of its assignment and skip
+// logs and of its deferred assignments is rewritten, so counts and history
+// carry over. It fails if a group or data directory with the new name exists.
+// The locks of both names are held throughout, and the steps already taken
+// are undone when a later one fails, so a failed rename leaves the group
+// under its old name.
+func RenameGroup(ctx context.Context, oldName, newName string) (err error) {
+	oldConf, err := groupConfigPath(oldName)
+	if err != nil {
+		return err
+	}
+	if !validGroupName(newName) {
+		return fmt.Errorf("invalid group name: %q", newName)
+	}
+	release, err := lockGroups(ctx, oldName, newName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	if path, ok := config.GroupConfigPath(newName); ok {
+		return fmt.Errorf("group %s already exists: %s", newName, path)
+	}
+	if err := checkNamespace(newName); err != nil {
+		return err
+	}
+	// The config file stays in its config directory
+	confDir := strings.TrimSuffix(oldConf, filepath.FromSlash(oldName)+".yaml")
+	newConf := filepath.Join(confDir, filepath.FromSlash(newName)+".yaml")
+	oldData := filepath.Join(config.Settings.Storage.DataDir, oldName)
+	newData := filepath.Join(config.Settings.Storage.DataDir, newName)
+	for _, path := range []string{newConf, newData} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("group %s already exists: %s", newName, path)
+		}
+	}
+
+	// undo holds the steps reverting what was done so far, run in reverse
+	// order when a later step fails
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undoErr := undo[i](); undoErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to roll back renaming group %s: %w", oldName, undoErr))
+			}
+		}
+	}()
+
+	if _, err := os.Stat(oldData); err == nil {
+		setGroup := func(group string) func(record map[string]json.RawMessage) error {
+			return func(record map[string]json.RawMessage) error {
+				value, err := json.Marshal(group)
+				record["group"] = value
+				return err
+			}
+		}
+		for _, name := range []string{"assignments.log", "skips.log"} {
+			path := filepath.Join(oldData, name)
+			if err := rewriteLog(path, setGroup(newName)); err != nil {
+				return fmt.Errorf("failed to rewrite %s: %w", name, err)
+			}
+			undo = append(undo, func() error { return rewriteLog(path, setGroup(oldName)) })
+		}
+		if err := os.MkdirAll(filepath.Dir(newData), 0755); err != nil {
+			return fmt.Errorf("failed to create data directory: %w", err)
+		}
+		if err := os.Rename(oldData, newData); err != nil {
+			return fmt.Errorf("failed to move data directory: %w", err)
+		}
+		undo = append(undo, func() error { return os.Rename(newData, oldData) })
+	}
+	if err := os.MkdirAll(filepath.Dir(newConf), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.Rename(oldConf, newConf); err != nil {
+		return fmt.Errorf("failed to rename config file: %w", err)
+	}
+	undo = append(undo, func() error { return os.Rename(newConf, oldConf) })
+
+	err = updateQueue(context.Background(), func(queue []QueuedAssignment) ([]QueuedAssignment, bool) {
+		renamed := false
+		for i := range queue {
+			if queue[i].Group == oldName {
+				queue[i].Group = newName
+				renamed = true
+			}
+		}
+		return queue, renamed
+	})
+	if err != nil {
+		return err
+	}
+	undo = nil
+
+	if err := renameSharedState(oldName, newName); err != nil {
+		return err
+	}
+	recordStateChange(fmt.Sprintf("Rename group %s to %s", oldName, newName))
+	return nil
+}
+
+// rewriteLog applies edit to every record of a JSON lines log, keeping the
+// fields it doesn't change, and replaces the log atomically.
+// A missing log is left alone.
+func rewriteLog(path string, edit func(record map[string]json.RawMessage) error) error {
+	records, err := readLogRecords(path)
+	if err != nil || records == nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	for _, record := range records {
+		if err := edit(record); err != nil {
+			return err
+		}
+		rewritten, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		out.Write(rewritten)
+		out.WriteByte('\n')
+	}
+	return writeFileAtomic(path, out.Bytes())
+}
+
+// readLogRecords reads every record of a JSON lines log with all of its
+// fields. A missing log has no records.
+func readLogRecords(path string) ([]map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	records := []map[string]json.RawMessage{}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// validGroupName reports whether name can be used as a group name: it must
+// be a plain file name that doesn't start with a dot, or several separated
+// by slashes for a group in a subdirectory, such as platform/oncall. Glob
+// characters are reserved for patterns matching several groups.
+func validGroupName(name string) bool {
+	if config.IsGroupPattern(name) {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part != filepath.Base(part) || part[0] == '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkNamespace returns an error when a new group would be named like the
+// subdirectory of other groups, or be in a subdirectory named like a group,
+// since the data directory of one would hold that of the other.
+func checkNamespace(group string) error {
+	groups, err := config.ListGroups()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, other := range groups {
+		if strings.HasPrefix(other, group+"/") || strings.HasPrefix(group, other+"/") {
+			return fmt.Errorf("group %s can't be created next to group %s", group, other)
+		}
+	}
+	return nil
+}
+
+// groupConfigPath returns the path of a group's config file, or an
+// InvalidGroupError when the group has none.
+func groupConfigPath(group string) (string, error) {
+	if !validGroupName(group) {
+		return "", &InvalidGroupError{Group: group}
+	}
+	confPath, ok := config.GroupConfigPath(group)
+	if !ok {
+		return "", &InvalidGroupError{Group: group}
+	}
+	return confPath, nil
+}
+
+// dropQueuedAssignments removes the deferred assignments of a group from the queue.
+func dropQueuedAssignments(group string) error {
+	return updateQueue(context.Background(), func(queue []QueuedAssignment) ([]QueuedAssignment, bool) {
+		var remaining []QueuedAssignment
+		for _, qa := range queue {
+			if qa.Group != group {
+				remaining = append(remaining, qa)
+			}
+		}
+		return remaining, len(remaining) != len(queue)
+	})
+}
+
+// disabled reports whether the config of the group sets enabled: false.
+func (c *AssigneeGroupConfig) disabled() bool {
+	return c.Enabled != nil && !*c.Enabled
+}
+
+// enabledLine matches the top-level enabled key of a group config.
+var enabledLine = regexp.MustCompile(`(?m)^enabled:.*(\n|$)`)
+
+// SetGroupEnabled enables or disables assignments in a group by editing
+// its config file: disabling sets enabled: false at the top, enabling
+// removes the key. The rest of the file, including comments, is kept.
+func SetGroupEnabled(group string, enabled bool) error {
+	confPath, err := groupConfigPath(group)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	edited := enabledLine.ReplaceAll(data, nil)
+	if !enabled {
+		edited = append([]byte("enabled: false\n"), edited...)
+	}
+	// Make sure the edit had the intended effect before replacing the file
+	var conf AssigneeGroupConfig
+	if err := yaml.Unmarshal(edited, &conf); err != nil {
+		return &ConfigError{Group: group, Err: err}
+	}
+	if conf.disabled() == enabled {
+		return &ConfigError{Group: group, Err: fmt.Errorf("failed to set enabled in %s", confPath)}
+	}
+	if err := writeFileAtomic(confPath, edited); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// SaveGroupConfig creates or replaces the config file of a group with data,
+// once it parses and passes the checks of ValidateGroup that don't ask
+// external services; otherwise it returns a ConfigError describing every
+// problem and leaves the file alone.
+func SaveGroupConfig(group string, data []byte) error {
+	if !validGroupName(group) {
+		return &InvalidGroupError{Group: group}
+	}
+	conf, err := parseAssigneeGroupConfig(data)
+	if err != nil {
+		return &ConfigError{Group: group, Err: err}
+	}
+	issues := conf.issues()
+	if len(conf.Users) == 0 {
+		issues = append([]string{"users is required"}, issues...)
+	}
+	if len(issues) > 0 {
+		return &ConfigError{Group: group, Err: errors.New(strings.Join(issues, "; "))}
+	}
+	// Groups are changed where they are defined and created in the first config directory
+	confPath, exists := config.GroupConfigPath(group)
+	if !exists {
+		if err := checkNamespace(group); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(confPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := writeFileAtomic(confPath, data); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// UpdateGroupConfig creates or replaces the config file of a group like
+// SaveGroupConfig, while holding the lock of the group so concurrent
+// updates from other hosts apply one after the other, and records the
+// change. It reports whether the group was created.
+func UpdateGroupConfig(ctx context.Context, group string, data []byte) (bool, error) {
+	if !validGroupName(group) {
+		return false, &InvalidGroupError{Group: group}
+	}
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	_, err = groupConfigPath(group)
+	created := err != nil
+	if err := SaveGroupConfig(group, data); err != nil {
+		return false, err
+	}
+	recordStateChange(fmt.Sprintf("Update group %s", group))
+	return created, nil
+}
+
+// UsersUpdate is the outcome of UpdateGroupUsers.
+type UsersUpdate struct {
+	Users   []string // Users of the group after the update
+	Added   []string // Users that weren't in the group before
+	Removed []string // Users that were in the group before
+}
+
+// UpdateGroupUsers adds users to and removes users from the users list of
+// a group's config while holding the lock of the group. Users already in
+// the list aren't added again and users not in it are ignored, so
+// repeating an update changes nothing. The settings of removed users, such
+// as their aliases or never_available, are removed with them; the rest of
+// the file, including comments, is kept. The result must pass the checks
+// of SaveGroupConfig.
+func UpdateGroupUsers(ctx context.Context, group string, add, remove []string) (*UsersUpdate, error) {
+	confPath, err := groupConfigPath(group)
+	if err != nil {
+		return nil, err
+	}
+	removed := make(map[string]bool, len(remove))
+	for _, user := range remove {
+		removed[user] = true
+	}
+	for _, user := range append(append([]string{}, add...), remove...) {
+		if user == "" {
+			return nil, &ConfigError{Group: group, Err: errors.New("user names must not be empty")}
+		}
+	}
+	for _, user := range add {
+		if removed[user] {
+			return nil, &ConfigError{Group: group, Err: fmt.Errorf("user %s is both added and removed", user)}
+		}
+	}
+
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	before, err := parseAssigneeGroupConfig(data)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	edited, err := editGroupUsers(data, add, removed)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	update := &UsersUpdate{Users: before.Users}
+	if bytes.Equal(edited, data) {
+		return update, nil
+	}
+	if err := SaveGroupConfig(group, edited); err != nil {
+		return nil, err
+	}
+	after, err := parseAssigneeGroupConfig(edited)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	update.Users = after.Users
+	update.Added, update.Removed = subtractUsers(after.Users, before.Users), subtractUsers(before.Users, after.Users)
+	recordStateChange(fmt.Sprintf("Update users of group %s", group))
+	return update, nil
+}
+
+// subtractUsers returns the users of a that aren't in b.
+func subtractUsers(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, user := range b {
+		in[user] = true
+	}
+	var rest []string
+	for _, user := range a {
+		if !in[user] {
+			rest = append(rest, user)
+		}
+	}
+	return rest
+}
+
+// userKeyedSettings are the top-level keys of a group config holding
+// settings of single users, which are removed along with the user.
+var userKeyedSettings = map[string]bool{
+	"always_available": true, "never_available": true,
+	"aliases": true, "availability_ids": true, "tags": true, "user_limits": true,
+}
+
+// editGroupUsers returns a group config with add appended to its users list
+// and the removed users and their settings dropped. data is returned
+// unchanged when there is nothing to do.
+func editGroupUsers(data []byte, add []string, removed map[string]bool) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file is not a mapping")
+	}
+	root := doc.Content[0]
+
+	var users *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "users" {
+			users = root.Content[i+1]
+		}
+	}
+	if users == nil {
+		users = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "users"}, users)
+	}
+	if users.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: users is not a list", users.Line)
+	}
+
+	changed := false
+	members := map[string]bool{}
+	kept := users.Content[:0]
+	for _, entry := range users.Content {
+		// Inline entries such as "- alice: {aliases: [asmith]}" are named by their key
+		name := entry.Value
+		if entry.Kind == yaml.MappingNode && len(entry.Content) > 0 {
+			name = entry.Content[0].Value
+		}
+		if removed[name] {
+			changed = true
+			continue
+		}
+		members[name] = true
+		kept = append(kept, entry)
+	}
+	users.Content = kept
+	for _, user := range add {
+		if !members[user] {
+			users.Content = append(users.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: user})
+			members[user] = true
+			changed = true
+		}
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if !userKeyedSettings[root.Content[i].Value] {
+			continue
+		}
+		switch settings := root.Content[i+1]; settings.Kind {
+		case yaml.SequenceNode:
+			kept := settings.Content[:0]
+			for _, user := range settings.Content {
+				if removed[user.Value] {
+					changed = true
+				} else {
+					kept = append(kept, user)
+				}
+			}
+			settings.Content = kept
+		case yaml.MappingNode:
+			var kept []*yaml.Node
+			for j := 0; j+1 < len(settings.Content); j += 2 {
+				if removed[settings.Content[j].Value] {
+					changed = true
+				} else {
+					kept = append(kept, settings.Content[j], settings.Content[j+1])
+				}
+			}
+			settings.Content = kept
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// MemberGroups returns the groups a user is a member of, under their name
+// or an alias. Groups whose config can't be loaded are left out.
+func MemberGroups(user string) ([]string, error) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	var member []string
+	for _, group := range groups {
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil {
+			continue
+		}
+		if slices.Contains(groupConf.Users, groupConf.canonicalUser(user)) {
+			member = append(member, group)
+		}
+	}
+	return member, nil
+}
@@ -1,31 +1,73 @@
 package runner
 
+import "context"
+
 // AssignmentStrategy defines how tasks are assigned to team members
 type AssignmentStrategy interface {
 	// SelectNext chooses the next team member to assign a task to
-	SelectNext(users []string, lastIndex int, counts map[string]int) (int, error)
+	SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error)
+}
+
+// OutOfTurnStrategy is an optional extension of AssignmentStrategy
+// for strategies that sometimes select a user outside the normal rotation
+type OutOfTurnStrategy interface {
+	// OutOfTurn reports whether assigning users[index] is out of turn,
+	// in which case the stored last index is left unchanged
+	OutOfTurn(users []string, index int) bool
+}
+
+// Filter is a constraint on who can be assigned, applied by the selection
+// pipeline to the candidates of every assignment; see RegisterFilter
+type Filter interface {
+	// Admit returns "" when user may be assigned in group, and else the reason
+	// they can't, which is recorded in skips.log
+	Admit(ctx context.Context, group, user string) (string, error)
 }
 
 // AvailabilityChecker defines how to check if a team member is available
 type AvailabilityChecker interface {
 	// IsAvailable checks if a team member is available for assignment
-	IsAvailable(username string) (bool, error)
+	IsAvailable(ctx context.Context, username string) (bool, error)
+}
+
+// BulkAvailabilityChecker is an optional extension of AvailabilityChecker
+// for checkers that can evaluate a whole group in one call
+type BulkAvailabilityChecker interface {
+	// AreAvailable checks the availability of several team members at once.
+	// Users missing from the result are unavailable; checks that fail for
+	// a user fail as a whole, and the users are then checked one by one
+	AreAvailable(ctx context.Context, users []string) (map[string]bool, error)
+}
+
+// WorkloadProvider reports the current workload of team members, such as
+// their open assignments, for the open_load strategy
+type WorkloadProvider interface {
+	// Workload returns the number of open work items of each of the users of a group
+	Workload(ctx context.Context, group string, users []string) (map[string]int, error)
+}
+
+// GroupLocker serializes the assignments of a group across processes and hosts
+type GroupLocker interface {
+	// Lock waits until the lock of a group is held and returns a function releasing it
+	Lock(ctx context.Context, group string) (func() error, error)
+	// Status reports whether the lock of a group is held and by whom
+	Status(ctx context.Context, group string) (*LockStatus, error)
 }
 
 // AssignmentLogger defines how assignments are logged
 type AssignmentLogger interface {
 	// LogAssignment records an assignment in the log
-	LogAssignment(group, user, strategy string, lastIndex, nextIndex int, counts map[string]int) error
+	LogAssignment(ctx context.Context, entry AssignmentLog) error
 }
 
 // CountManager defines how assignment counts are managed
 type CountManager interface {
 	// GetCounts retrieves the current assignment counts for a group
-	GetCounts(group string) (map[string]int, error)
+	GetCounts(ctx context.Context, group string) (map[string]int, error)
 	// IncrementCount increments the assignment count for a user
-	IncrementCount(group, user string) error
+	IncrementCount(ctx context.Context, group, user string) error
 	// ResetCounts resets the assignment counts for a group
-	ResetCounts(group string) error
+	ResetCounts(ctx context.Context, group string) error
 }
 
 // ConfigLoader defines how group configurations are loaded
@@ -37,9 +79,27 @@ type ConfigLoader interface {
 // StorageManager defines how data is stored and retrieved
 type StorageManager interface {
 	// GetGroupDataDir returns the data directory for a group
-	GetGroupDataDir(group string) (string, error)
+	GetGroupDataDir(ctx context.Context, group string) (string, error)
 	// ReadLastIndex reads the last assigned index for a group
-	ReadLastIndex(group string) (int, error)
+	ReadLastIndex(ctx context.Context, group string) (int, error)
 	// WriteLastIndex writes the last assigned index for a group
-	WriteLastIndex(group string, index int) error
+	WriteLastIndex(ctx context.Context, group string, index int) error
+	// BeginTransaction snapshots the stored state of a group so the mutations of one assignment can be rolled back
+	BeginTransaction(ctx context.Context, group string) (StateTransaction, error)
+}
+
+// WritableChecker is an optional extension of StorageManager for backends
+// that can verify they accept writes, as assignments with RequireAllChecks do
+// before selecting
+type WritableChecker interface {
+	// CheckWritable writes and removes a probe in the storage of a group
+	CheckWritable(ctx context.Context, group string) error
+}
+
+// StateTransaction groups the state mutations (index, counts, log) of one assignment
+type StateTransaction interface {
+	// Commit makes the mutations made since the transaction began final
+	Commit() error
+	// Rollback restores the state captured when the transaction began
+	Rollback() error
 }
@@ -0,0 +1,165 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultLeaseTTL is the default of config.ReplicasConfig.LeaseSeconds.
+const defaultLeaseTTL = 15 * time.Second
+
+// Roles of a replica reported by ReplicaStatus.
+const (
+	RoleStandalone = "standalone" // The only replica; no leader is elected
+	RoleLeader     = "leader"
+	RoleFollower   = "follower"
+)
+
+// ReplicaStatus describes the role of a replica of the server.
+type ReplicaStatus struct {
+	Role    string `json:"role"`             // standalone, leader or follower
+	Replica string `json:"replica"`          // Host and process ID of the replica, e.g. autoassigner-7d9f-x2kq:1
+	Leader  string `json:"leader,omitempty"` // Host and process ID of the leader, when one is elected
+}
+
+// Elector elects one leader among the replicas of the server with a lease
+// in the Redis of storage.lock: the replica that sets the lease key leads
+// until it fails to renew the lease, after which another one takes over.
+// The methods of a nil Elector report a standalone replica.
+type Elector struct {
+	locker *RedisLocker
+	key    string
+	lease  time.Duration
+	token  string
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// NewElector returns an Elector for the replicas configured in
+// config.Settings.Server.Replicas, or nil when replicas are disabled.
+func NewElector() (*Elector, error) {
+	conf := config.Settings.Server.Replicas
+	if !conf.Enabled {
+		return nil, nil
+	}
+	if backend := config.Settings.Storage.Lock.Backend; backend != config.LockRedis {
+		return nil, fmt.Errorf("leader election requires the redis lock backend, not %q", backend)
+	}
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	e := &Elector{
+		locker: NewRedisLocker(config.Settings.Storage.Lock),
+		lease:  time.Duration(conf.LeaseSeconds) * time.Second,
+		token:  token,
+	}
+	if e.lease <= 0 {
+		e.lease = defaultLeaseTTL
+	}
+	e.key = e.locker.Prefix + ":leader"
+	return e, nil
+}
+
+// Run campaigns for the leadership until ctx is done, renewing the lease
+// three times per lease period. While this replica leads, lead runs with a
+// context that is cancelled as soon as the leadership is lost; Run waits
+// for it to return before campaigning again. The lease is released when
+// Run returns, so another replica takes over at once.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	var stop context.CancelFunc
+	var done chan struct{}
+	stepDown := func() {
+		if stop != nil {
+			stop()
+			<-done
+			stop = nil
+		}
+	}
+	defer func() {
+		stepDown()
+		if _, err := e.locker.command(context.Background(), "EVAL", releaseScript, "1", e.key, e.token); err != nil {
+			log.Printf("Failed to release leadership: %v", err)
+		}
+	}()
+
+	for {
+		leader := e.campaign(ctx)
+		e.mu.Lock()
+		changed := leader != e.leader
+		e.leader = leader
+		e.mu.Unlock()
+		if changed && leader {
+			log.Printf("Elected leader of the replicas")
+			leadCtx, cancel := context.WithCancel(ctx)
+			stop, done = cancel, make(chan struct{})
+			go func() {
+				defer close(done)
+				lead(leadCtx)
+			}()
+		} else if changed {
+			if ctx.Err() == nil {
+				log.Printf("Lost the leadership of the replicas")
+			}
+			stepDown()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.lease / 3):
+		}
+	}
+}
+
+// campaign renews the lease of a leader or tries to take a free one, and
+// reports whether this replica leads. A replica that can't reach Redis
+// steps down, since its lease may expire meanwhile.
+func (e *Elector) campaign(ctx context.Context) bool {
+	e.mu.Lock()
+	leader := e.leader
+	e.mu.Unlock()
+
+	ttl := strconv.FormatInt(e.lease.Milliseconds(), 10)
+	var reply string
+	var err error
+	if leader {
+		reply, err = e.locker.command(ctx, "EVAL", renewScript, "1", e.key, e.token, ttl)
+	} else {
+		reply, err = e.locker.command(ctx, "SET", e.key, e.token, "NX", "PX", ttl)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to campaign for leadership: %v", err)
+		}
+		return false
+	}
+	return reply == "OK" || reply == "1"
+}
+
+// Status returns the role of this replica and the leader known to Redis.
+// The leader is left empty when Redis can't be reached.
+func (e *Elector) Status(ctx context.Context) *ReplicaStatus {
+	if e == nil {
+		return &ReplicaStatus{Role: RoleStandalone, Replica: hostProcess()}
+	}
+
+	status := &ReplicaStatus{Role: RoleFollower, Replica: lockHolder(e.token)}
+	e.mu.Lock()
+	if e.leader {
+		status.Role, status.Leader = RoleLeader, status.Replica
+	}
+	e.mu.Unlock()
+	if status.Role == RoleFollower {
+		if holder, err := e.locker.command(ctx, "GET", e.key); err == nil && holder != "" {
+			status.Leader = lockHolder(holder)
+		}
+	}
+	return status
+}
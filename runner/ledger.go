@@ -0,0 +1,212 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OpenAssignment is an assignment that has not been closed yet.
+type OpenAssignment struct {
+	ID             string `json:"id"`
+	User           string `json:"user"`
+	Role           string `json:"role,omitempty"`            // Role of the user in a multi-role assignment
+	AssignedAt     string `json:"assigned_at"`               // Time of the assignment in RFC 3339 format
+	AcknowledgedAt string `json:"acknowledged_at,omitempty"` // Time of the acknowledgement, empty while pending
+	AcknowledgedBy string `json:"acknowledged_by,omitempty"`
+	Escalated      int    `json:"escalated,omitempty"` // Steps of the group's escalation chain taken while it went unacknowledged
+}
+
+// Acknowledged reports whether the assignee has acknowledged the assignment.
+func (a OpenAssignment) Acknowledged() bool {
+	return a.AcknowledgedAt != ""
+}
+
+// OpenAssignments returns the assignments of a group that have not been closed,
+// oldest first.
+func OpenAssignments(group string) ([]OpenAssignment, error) {
+	if _, err := loadAssigneeGroupConfig(group); err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	return readLedger(group)
+}
+
+// AcknowledgeAssignment marks an open assignment as acknowledged, together
+// with the other users of a multi-role assignment, and returns its first user's entry.
+// Acknowledging it again keeps the original acknowledgement. The time to
+// acknowledge is recorded in durations.log. The lock of the group is held
+// from reading the open assignments until they are written.
+func AcknowledgeAssignment(ctx context.Context, group, id string) (*OpenAssignment, error) {
+	if _, err := loadAssigneeGroupConfig(group); err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	ledger, err := readLedger(group)
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow()
+	first := -1
+	var acknowledged []OpenAssignment
+	for i := range ledger {
+		if ledger[i].ID != id {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if !ledger[i].Acknowledged() {
+			ledger[i].AcknowledgedAt = now.Format(time.RFC3339)
+			ledger[i].AcknowledgedBy = currentActor()
+			acknowledged = append(acknowledged, ledger[i])
+		}
+	}
+	if first < 0 {
+		return nil, &AssignmentNotFoundError{Group: group, ID: id}
+	}
+	if len(acknowledged) > 0 {
+		if err := writeLedger(group, ledger); err != nil {
+			return nil, err
+		}
+		if err := logDurations(group, durationRecords(acknowledged, EventAcknowledged, now)); err != nil {
+			return nil, err
+		}
+		recordStateChange(fmt.Sprintf("Acknowledge assignment %s in %s", id, group))
+	}
+	return &ledger[first], nil
+}
+
+// CloseAssignment removes an assignment from the open assignments of a group,
+// with every user of a multi-role assignment, and returns its first user's entry.
+// The time to close is recorded in durations.log. The lock of the group is
+// held from reading the open assignments until they are written.
+func CloseAssignment(ctx context.Context, group, id string) (*OpenAssignment, error) {
+	if _, err := loadAssigneeGroupConfig(group); err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	ledger, err := readLedger(group)
+	if err != nil {
+		return nil, err
+	}
+	var closed []OpenAssignment
+	remaining := ledger[:0:0]
+	for _, open := range ledger {
+		if open.ID != id {
+			remaining = append(remaining, open)
+		} else {
+			closed = append(closed, open)
+		}
+	}
+	if len(closed) == 0 {
+		return nil, &AssignmentNotFoundError{Group: group, ID: id}
+	}
+	if err := writeLedger(group, remaining); err != nil {
+		return nil, err
+	}
+	if err := logDurations(group, durationRecords(closed, EventClosed, timeNow())); err != nil {
+		return nil, err
+	}
+	recordStateChange(fmt.Sprintf("Close assignment %s in %s", id, group))
+	return &closed[0], nil
+}
+
+// newAssignmentID returns a new identifier for an assignment, a ULID.
+// IDs logged before ULIDs were introduced are base36 timestamps.
+func newAssignmentID() string {
+	return newULID(time.Now())
+}
+
+// loggedAssignment returns the records of a group's assignment log with the
+// given ID, one per user of the assignment, or nil when none was logged.
+func loggedAssignment(group, id string) ([]AssignmentLog, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	records, err := history.ReadFile(filepath.Join(groupDir, "assignments.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assignment log: %w", err)
+	}
+	var logged []AssignmentLog
+	for _, record := range records {
+		if record.ID == id {
+			logged = append(logged, record)
+		}
+	}
+	return logged, nil
+}
+
+// openAssignment adds a logged assignment to the open assignments of its group.
+func openAssignment(entry AssignmentLog) error {
+	ledger, err := readLedger(entry.Group)
+	if err != nil {
+		return err
+	}
+	ledger = append(ledger, OpenAssignment{ID: entry.ID, User: entry.User, Role: entry.Role, AssignedAt: entry.Timestamp})
+	return writeLedger(entry.Group, ledger)
+}
+
+// readLedger reads open.json of a group. A missing file is treated as empty.
+func readLedger(group string) ([]OpenAssignment, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(groupDir, "open.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read open assignments: %w", err)
+	}
+
+	var ledger []OpenAssignment
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("failed to parse open assignments: %w", err)
+	}
+	return ledger, nil
+}
+
+// writeLedger replaces open.json of a group.
+func writeLedger(group string, ledger []OpenAssignment) error {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	if ledger == nil {
+		ledger = []OpenAssignment{}
+	}
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal open assignments: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(groupDir, "open.json"), data); err != nil {
+		return fmt.Errorf("failed to write open assignments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+)
+
+// UserLimits caps the assignments a user receives. A zero limit means unlimited.
+type UserLimits struct {
+	MaxPerDay  int    `yaml:"max_per_day"`  // Assignments per day, in the group's time zone
+	MaxPerWeek int    `yaml:"max_per_week"` // Assignments per week, starting Monday
+	Cooldown   string `yaml:"cooldown"`     // Time after an assignment during which the user is skipped, e.g. 2h
+}
+
+// userLimits returns the limits of a user: those of user_limits, with the
+// limits of the group for those not set there.
+func (c *AssigneeGroupConfig) userLimits(user string) UserLimits {
+	limits := c.Limits
+	if own, ok := c.UserLimits[user]; ok {
+		if own.MaxPerDay != 0 {
+			limits.MaxPerDay = own.MaxPerDay
+		}
+		if own.MaxPerWeek != 0 {
+			limits.MaxPerWeek = own.MaxPerWeek
+		}
+		if own.Cooldown != "" {
+			limits.Cooldown = own.Cooldown
+		}
+	}
+	return limits
+}
+
+// limited reports whether any limit is configured.
+func (c *AssigneeGroupConfig) limited() bool {
+	if c.Limits != (UserLimits{}) {
+		return true
+	}
+	for _, limits := range c.UserLimits {
+		if limits != (UserLimits{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// cooldown returns the cool-down of the limits, zero without one.
+func (l UserLimits) cooldown() (time.Duration, error) {
+	if l.Cooldown == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(l.Cooldown)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid cooldown: %s", l.Cooldown)
+	}
+	return d, nil
+}
+
+// validateLimits returns an error for negative limits and invalid cool-downs.
+func (c *AssigneeGroupConfig) validateLimits() error {
+	if c.Limits.MaxPerDay < 0 || c.Limits.MaxPerWeek < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if _, err := c.Limits.cooldown(); err != nil {
+		return err
+	}
+	for user, limits := range c.UserLimits {
+		if limits.MaxPerDay < 0 || limits.MaxPerWeek < 0 {
+			return fmt.Errorf("user_limits of %s must not be negative", user)
+		}
+		if _, err := limits.cooldown(); err != nil {
+			return fmt.Errorf("user_limits of %s: %w", user, err)
+		}
+	}
+	return nil
+}
+
+// assignmentLimits tells which users of a group reached a limit, from the
+// counts of the current day and week, or are cooling down after their last
+// assignment.
+type assignmentLimits struct {
+	conf *AssigneeGroupConfig
+	now  time.Time
+	day  map[string]int
+	week map[string]int
+	last map[string]time.Time
+}
+
+// newAssignmentLimits reads the counts and last assignments the limits of a
+// group are checked against. It returns nil when the group has no limits.
+func newAssignmentLimits(group string, conf *AssigneeGroupConfig) (*assignmentLimits, error) {
+	if !conf.limited() {
+		return nil, nil
+	}
+	if err := conf.validateLimits(); err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	b, err := readCountBuckets(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read counts: %w", err)
+	}
+
+	last, err := readLastAssigned(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last assignments: %w", err)
+	}
+
+	loc, err := conf.location()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	now := timeNow().In(loc)
+	day, _ := periodStart(PeriodDay, now)
+	week, _ := periodStart(PeriodWeek, now)
+	l := &assignmentLimits{conf: conf, now: now, day: b.since(day), week: b.since(week), last: last}
+	conf.mergeAliasCounts(l.day)
+	conf.mergeAliasCounts(l.week)
+	conf.mergeAliasTimes(l.last)
+	return l, nil
+}
+
+// capacityReached returns the skip reason of a user who reached their daily
+// or weekly limit, or "".
+func (l *assignmentLimits) capacityReached(user string) string {
+	limits := l.conf.userLimits(user)
+	if limits.MaxPerDay > 0 && l.day[user] >= limits.MaxPerDay {
+		return skipDayLimit
+	}
+	if limits.MaxPerWeek > 0 && l.week[user] >= limits.MaxPerWeek {
+		return skipWeekLimit
+	}
+	return ""
+}
+
+// coolingDown reports whether a user was assigned less than their cool-down ago.
+func (l *assignmentLimits) coolingDown(user string) bool {
+	// Cool-downs were validated when the limits were read
+	if cooldown, _ := l.conf.userLimits(user).cooldown(); cooldown > 0 {
+		if last, ok := l.last[user]; ok && l.now.Before(last.Add(cooldown)) {
+			return true
+		}
+	}
+	return false
+}
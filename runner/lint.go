@@ -0,0 +1,336 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Levels of lint findings.
+const (
+	LintError   = "error"   // Assignments fail or go wrong
+	LintWarning = "warning" // The config works, but likely not as intended
+)
+
+// LintRules describes the rules of lint findings, keyed by their ID.
+var LintRules = map[string]string{
+	"invalid-config":      "The group config has a problem autoassigner validate reports",
+	"priority-route":      "A priority route can't be used for assignments",
+	"stale-counts":        "Counts are stored for a user who is not in the group",
+	"nothing-to-balance":  "A strategy balancing assignments has a single user to choose from",
+	"nobody-available":    "Every user a group, priority or role selects from is never_available",
+	"ineffective-limit":   "A daily or weekly limit is never reached because of the other one",
+	"unknown-limit-user":  "user_limits names a user who is not in the group",
+	"unknown-route-group": "A route sends changes to a group that doesn't exist",
+	"unreachable-route":   "A route never matches because an earlier route matches every change it does",
+}
+
+// LintFinding is a likely mistake found in a config, with a suggested fix.
+type LintFinding struct {
+	Rule       string // ID of the rule, one of LintRules
+	Level      string // LintError or LintWarning
+	Group      string // Group whose config has the mistake, empty for the routes of the main configuration
+	Line       int    // Line of the group config the mistake is at, 0 when unknown
+	Message    string
+	Suggestion string // How to fix the mistake, empty when there is no obvious fix
+}
+
+// balancingStrategies are the strategies choosing between users by their
+// assignments, which are pointless with a single user.
+var balancingStrategies = map[string]bool{"least_assigned": true, "open_load": true, "least_recently_assigned": true}
+
+// balancing reports whether strategy, which may be a chain, includes a
+// balancing strategy.
+func balancing(strategy string) bool {
+	for _, name := range strategyNames(strategy) {
+		if balancingStrategies[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// LintGroup checks the config and stored counts of a group for the problems
+// ValidateGroup reports and for likely mistakes beyond them: counts of users
+// no longer in the group, balancing strategies with a single user, routes and
+// roles without any user who can be available, and limits that are never
+// reached.
+func LintGroup(group string) ([]LintFinding, error) {
+	confPath, _ := config.GroupConfigPath(group)
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &InvalidGroupError{Group: group}
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	conf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return []LintFinding{{Rule: "invalid-config", Level: LintError, Group: group, Message: err.Error()}}, nil
+	}
+	var doc yaml.Node
+	yaml.Unmarshal(data, &doc)
+	line := func(keys ...string) int { return keyLine(&doc, keys...) }
+
+	var findings []LintFinding
+	add := func(rule, level string, at int, suggestion, format string, args ...interface{}) {
+		findings = append(findings, LintFinding{Rule: rule, Level: level, Group: group, Line: at, Message: fmt.Sprintf(format, args...), Suggestion: suggestion})
+	}
+
+	for _, issue := range conf.issues() {
+		add("invalid-config", LintError, 0, "", "%s", issue)
+	}
+
+	if balancing(string(conf.Strategy)) && len(conf.Users) == 1 {
+		add("nothing-to-balance", LintWarning, line("strategy"), "add users to the group or use round_robin",
+			"strategy %s always selects %s, the only user of the group", conf.Strategy, conf.Users[0])
+	}
+	if len(conf.Users) > 0 && len(conf.neverAvailable(conf.Users)) == len(conf.Users) {
+		add("nobody-available", LintError, line("never_available"), "remove a user from never_available",
+			"every user of the group is never_available")
+	}
+
+	priorities := make([]string, 0, len(conf.Priorities))
+	for priority := range conf.Priorities {
+		priorities = append(priorities, priority)
+	}
+	sort.Strings(priorities)
+	for _, priority := range priorities {
+		r, err := routeAssignment(conf, priority)
+		if err != nil {
+			add("priority-route", LintError, line("priorities", priority), "", "%v", err)
+			continue
+		}
+		if balancing(r.strategy) && len(r.users) == 1 && len(conf.Users) > 1 {
+			add("nothing-to-balance", LintWarning, line("priorities", priority), "add users to the priority or set its strategy to round_robin",
+				"strategy %s of priority %s always selects %s, the only user of the priority", r.strategy, priority, r.users[0])
+		}
+		if never := conf.neverAvailable(r.users); len(never) == len(r.users) && len(r.users) < len(conf.Users) {
+			add("nobody-available", LintError, line("priorities", priority), "add available users to the priority",
+				"priority %s can't assign anyone: %s never_available", priority, listUsers(never))
+		}
+	}
+	roles := make([]string, 0, len(conf.Roles))
+	for role := range conf.Roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		pool, err := conf.rolePool(role)
+		if err != nil {
+			// Reported by issues
+			continue
+		}
+		if never := conf.neverAvailable(pool); len(never) == len(pool) && len(pool) < len(conf.Users) {
+			add("nobody-available", LintError, line("roles", role), "add available users to the role",
+				"role %s can't assign anyone: %s never_available", role, listUsers(never))
+		}
+	}
+
+	members := make(map[string]bool, len(conf.Users))
+	for _, user := range conf.Users {
+		members[user] = true
+	}
+	if msg := limitsMistake(conf.Limits); msg != "" {
+		add("ineffective-limit", LintWarning, line("limits"), "lower or remove the higher limit", "limits: %s", msg)
+	}
+	limited := make([]string, 0, len(conf.UserLimits))
+	for user := range conf.UserLimits {
+		limited = append(limited, user)
+	}
+	sort.Strings(limited)
+	for _, user := range limited {
+		if !members[user] {
+			add("unknown-limit-user", LintWarning, line("user_limits", user), "remove the user_limits of "+user,
+				"user_limits of %s, who is not in the group", user)
+		} else if msg := limitsMistake(conf.UserLimits[user]); msg != "" {
+			add("ineffective-limit", LintWarning, line("user_limits", user), "lower or remove the higher limit", "user_limits of %s: %s", user, msg)
+		}
+	}
+
+	stale, err := orphanedUsers(group)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range stale {
+		suggestion := "run autoassigner gc --apply to drop their counts"
+		if member := similarName(user, conf.Users); member != "" {
+			suggestion = fmt.Sprintf("if %s was renamed to %s, run autoassigner user rename %s %s %s to keep their counts; otherwise %s", user, member, group, user, member, suggestion)
+		}
+		add("stale-counts", LintWarning, line("users"), suggestion, "%s has stored counts but is not in the group", user)
+	}
+	return findings, nil
+}
+
+// LintRoutes checks the routes of the main configuration for groups that
+// don't exist and for routes that never match because an earlier one
+// matches every change they do.
+func LintRoutes() ([]LintFinding, error) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		known[group] = true
+	}
+
+	var findings []LintFinding
+	routes := config.Settings.Routes
+	for i, route := range routes {
+		if !known[route.Group] {
+			suggestion := "create the group or fix the name"
+			if group := similarName(route.Group, groups); group != "" {
+				suggestion = "did you mean " + group + "?"
+			}
+			findings = append(findings, LintFinding{Rule: "unknown-route-group", Level: LintError, Suggestion: suggestion,
+				Message: fmt.Sprintf("route %d sends changes to group %s, which doesn't exist", i+1, route.Group)})
+		}
+		for j := 0; j < i; j++ {
+			if routeCovers(routes[j], route) {
+				findings = append(findings, LintFinding{Rule: "unreachable-route", Level: LintWarning,
+					Suggestion: fmt.Sprintf("move route %d before route %d or remove it", i+1, j+1),
+					Message:    fmt.Sprintf("route %d to group %s never matches: route %d matches every change it does", i+1, route.Group, j+1)})
+				break
+			}
+		}
+	}
+	return findings, nil
+}
+
+// routeCovers reports whether route a matches every change route b does.
+func routeCovers(a, b config.RouteConfig) bool {
+	if a.Repo != "" && a.Repo != b.Repo {
+		if b.Repo == "" || strings.ContainsAny(b.Repo, "*?[") {
+			return false
+		}
+		if ok, _ := path.Match(a.Repo, b.Repo); !ok {
+			return false
+		}
+	}
+	return subset(b.Labels, a.Labels) && subset(b.Paths, a.Paths) && (a.Title == "" || a.Title == b.Title)
+}
+
+// subset reports whether a change matching one of b also matches one of
+// a: a is empty, or b is a non-empty subset of a.
+func subset(b, a []string) bool {
+	if len(a) == 0 {
+		return true
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, x := range b {
+		found := false
+		for _, y := range a {
+			found = found || x == y
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// limitsMistake describes a daily limit never reached because of a lower
+// weekly limit, or a weekly limit never reached because of the daily limit.
+func limitsMistake(l UserLimits) string {
+	switch {
+	case l.MaxPerDay == 0 || l.MaxPerWeek == 0:
+		return ""
+	case l.MaxPerWeek < l.MaxPerDay:
+		return fmt.Sprintf("max_per_day of %d is never reached with max_per_week of %d", l.MaxPerDay, l.MaxPerWeek)
+	case l.MaxPerWeek > 7*l.MaxPerDay:
+		return fmt.Sprintf("max_per_week of %d is never reached with max_per_day of %d", l.MaxPerWeek, l.MaxPerDay)
+	}
+	return ""
+}
+
+// neverAvailable returns the users that are never_available.
+func (c *AssigneeGroupConfig) neverAvailable(users []string) []string {
+	var never []string
+	for _, user := range users {
+		if available, ok := c.availabilityOverride(user); ok && !available {
+			never = append(never, user)
+		}
+	}
+	return never
+}
+
+// listUsers names users for a message, e.g. "alice is" or "alice and bob are".
+func listUsers(users []string) string {
+	if len(users) == 1 {
+		return users[0] + " is"
+	}
+	return strings.Join(users[:len(users)-1], ", ") + " and " + users[len(users)-1] + " are"
+}
+
+// keyLine returns the line of the value at the path of mapping keys in a
+// YAML document, or of the deepest key found; 0 when the first isn't found.
+func keyLine(doc *yaml.Node, keys ...string) int {
+	if len(doc.Content) == 0 {
+		return 0
+	}
+	node, line := doc.Content[0], 0
+	for _, key := range keys {
+		var next *yaml.Node
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					line, next = node.Content[i].Line, node.Content[i+1]
+				}
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+// similarName returns the name of names closest to name if it differs by
+// case or at most two edits, such as a misspelling or a renamed user.
+func similarName(name string, names []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range names {
+		d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if d < bestDistance && d < len(name) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,477 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for config.LockConfig.
+const (
+	defaultLockTTL  = 30 * time.Second
+	defaultLockWait = 10 * time.Second
+)
+
+// lockRetryInterval is how often a held lock is tried again.
+var lockRetryInterval = 100 * time.Millisecond
+
+// lockWaitKey is the context key of a wait set with WithLockWait.
+type lockWaitKey struct{}
+
+// WithLockWait returns a context in which the lock of a group is waited for
+// up to wait instead of the configured storage.lock.wait_seconds. A zero wait
+// gives up at once when the lock is held; a negative wait waits until the
+// lock is free or the context is done.
+func WithLockWait(ctx context.Context, wait time.Duration) context.Context {
+	return context.WithValue(ctx, lockWaitKey{}, wait)
+}
+
+// LockStatus describes the distributed lock of a group.
+type LockStatus struct {
+	Group     string
+	Backend   string        // Configured lock backend; empty when locking is disabled
+	TTL       time.Duration // Expiry of a lock taken by a host
+	Wait      time.Duration // How long a held lock is waited for by default
+	Held      bool          // Whether the lock is currently held
+	Holder    string        // Host and process ID of the holder, e.g. build-1:4242
+	ExpiresIn time.Duration // Time until a held lock expires unless released before
+}
+
+// releaseScript deletes a lock only while it is still held with the given token,
+// so a host never releases a lock that expired and was taken by another host.
+const releaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// renewScript extends the expiry of a lock or the lease of the leader only
+// while it is still held with the given token, so a holder whose lock expired
+// doesn't take back the lock of another.
+const renewScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+// RedisLocker implements GroupLocker with Redis, using SET NX with an expiry
+// to take a lock and a compare-and-delete script to release it. A held lock
+// is renewed three times per TTL, so it only expires when its holder crashed
+// or can't reach Redis.
+type RedisLocker struct {
+	Address  string
+	Password string
+	Prefix   string
+	TTL      time.Duration // Expiry of a lock unless renewed, so a crashed host doesn't hold it forever
+	Wait     time.Duration // How long Lock waits for a lock held by another host
+}
+
+// NewRedisLocker returns a RedisLocker for the given settings.
+func NewRedisLocker(conf config.LockConfig) *RedisLocker {
+	l := &RedisLocker{
+		Address:  conf.Address,
+		Password: conf.Password,
+		Prefix:   conf.Prefix,
+		TTL:      time.Duration(conf.TTLSeconds) * time.Second,
+		Wait:     time.Duration(conf.WaitSeconds) * time.Second,
+	}
+	if l.Prefix == "" {
+		l.Prefix = "autoassigner"
+	}
+	if l.TTL <= 0 {
+		l.TTL = defaultLockTTL
+	}
+	if l.Wait <= 0 {
+		l.Wait = defaultLockWait
+	}
+	return l
+}
+
+func (l *RedisLocker) Lock(ctx context.Context, group string) (func() error, error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	key := l.Prefix + ":lock:" + group
+	ttl := strconv.FormatInt(l.TTL.Milliseconds(), 10)
+
+	wait := l.Wait
+	if w, ok := ctx.Value(lockWaitKey{}).(time.Duration); ok {
+		wait = w
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		reply, err := l.command(ctx, "SET", key, token, "NX", "PX", ttl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		if reply == "OK" {
+			break
+		}
+		if wait >= 0 && !time.Now().Before(deadline) {
+			return nil, &LockTimeoutError{Group: group, Wait: wait}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	go l.renew(key, token, ttl, stop, done)
+	var stopOnce sync.Once
+	release := func() error {
+		stopOnce.Do(func() {
+			close(stop)
+			<-done
+		})
+		if _, err := l.command(context.Background(), "EVAL", releaseScript, "1", key, token); err != nil {
+			return fmt.Errorf("failed to release lock: %w", err)
+		}
+		return nil
+	}
+	return release, nil
+}
+
+// renew extends the expiry of a held lock three times per TTL until stop is
+// closed, so a transaction outlasting the TTL, such as one waiting on slow
+// callbacks, keeps its lock. It gives up once the lock was lost.
+func (l *RedisLocker) renew(key, token, ttl string, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.TTL/3)
+		reply, err := l.command(ctx, "EVAL", renewScript, "1", key, token, ttl)
+		cancel()
+		if err != nil {
+			log.Printf("Warning: failed to renew lock %s: %v", key, err)
+			continue
+		}
+		if reply != "1" {
+			log.Printf("Warning: lock %s expired before it was renewed", key)
+			return
+		}
+	}
+}
+
+func (l *RedisLocker) Status(ctx context.Context, group string) (*LockStatus, error) {
+	status := &LockStatus{Group: group, Backend: config.LockRedis, TTL: l.TTL, Wait: l.Wait}
+	key := l.Prefix + ":lock:" + group
+	token, err := l.command(ctx, "GET", key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock: %w", err)
+	}
+	if token == "" {
+		return status, nil
+	}
+	ttl, err := l.command(ctx, "PTTL", key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock: %w", err)
+	}
+
+	status.Held = true
+	status.Holder = lockHolder(token)
+	// PTTL is negative when the key expired since GET or has no expiry
+	if ms, err := strconv.ParseInt(ttl, 10, 64); err == nil && ms > 0 {
+		status.ExpiresIn = time.Duration(ms) * time.Millisecond
+	}
+	return status, nil
+}
+
+// command runs one Redis command on a new connection and returns its reply,
+// which is empty for a nil reply.
+func (l *RedisLocker) command(ctx context.Context, args ...string) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", l.Address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	r := bufio.NewReader(conn)
+	if l.Password != "" {
+		if _, err := redisCall(conn, r, "AUTH", l.Password); err != nil {
+			return "", err
+		}
+	}
+	return redisCall(conn, r, args...)
+}
+
+// redisCall writes a command in the Redis protocol and reads a simple,
+// integer or bulk string reply.
+func redisCall(w io.Writer, r *bufio.Reader, args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return "", err
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply from redis")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid reply from redis: %q", line)
+		}
+		if n < 0 {
+			return "", nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		return string(data[:n]), nil
+	default:
+		return "", fmt.Errorf("unexpected reply from redis: %q", line)
+	}
+}
+
+// lockToken returns a value identifying one holder of a lock: the host and
+// process ID, for lock status, followed by a random part.
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	return hostProcess() + "/" + hex.EncodeToString(b), nil
+}
+
+// hostProcess returns the host and process ID of this process, e.g. build-1:4242.
+func hostProcess() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// lockHolder returns the host and process ID part of a lock token, or the
+// token itself when it has none.
+func lockHolder(token string) string {
+	if i := strings.LastIndex(token, "/"); i >= 0 {
+		return token[:i]
+	}
+	return token
+}
+
+// GetLockStatus reports whether the lock of a group is held and by whom.
+// Without a configured lock the status has no backend.
+func GetLockStatus(ctx context.Context, group string) (*LockStatus, error) {
+	if _, err := loadAssigneeGroupConfig(group); err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	locker, err := groupLocker()
+	if err != nil {
+		return nil, err
+	}
+	if locker == nil {
+		return &LockStatus{Group: group}, nil
+	}
+	return locker.Status(ctx, group)
+}
+
+// lockGroup takes the lock of a group and returns a function releasing it.
+// The state mirrored to S3, if any, is pulled once the lock is held, so it
+// is read as the previous holder left it.
+func lockGroup(ctx context.Context, group string) (func() error, error) {
+	release, err := takeLock(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if err := PullState(ctx); err != nil {
+		release()
+		return nil, fmt.Errorf("failed to pull state from S3: %w", err)
+	}
+	return release, nil
+}
+
+// lockGroups takes the locks of two groups, such as the old and new name of
+// a renamed group, and returns a function releasing both. The locks are
+// taken in name order, so callers locking the same groups can't deadlock.
+func lockGroups(ctx context.Context, group, other string) (func() error, error) {
+	if other < group {
+		group, other = other, group
+	}
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	releaseOther, err := takeLock(ctx, other)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return func() error {
+		return errors.Join(releaseOther(), release())
+	}, nil
+}
+
+// takeLock takes the lock of a name, a group or one of the names state
+// shared by all groups is locked under, and returns a function releasing
+// it. The lock is taken in layers: a mutex serializing the goroutines of
+// this process, such as the concurrent requests of the webhook server, a
+// file lock on <data_dir>/.locks/<name>.lock serializing the processes
+// sharing the data directory, and the configured distributed lock, if any,
+// serializing the hosts.
+func takeLock(ctx context.Context, name string) (func() error, error) {
+	locker, err := groupLocker()
+	if err != nil {
+		return nil, err
+	}
+	wait := time.Duration(config.Settings.Storage.Lock.WaitSeconds) * time.Second
+	if wait <= 0 {
+		wait = defaultLockWait
+	}
+	if w, ok := ctx.Value(lockWaitKey{}).(time.Duration); ok {
+		wait = w
+	}
+
+	unlock, err := lockLocal(ctx, name, wait)
+	if err != nil {
+		return nil, err
+	}
+	unlockFile, err := lockGroupFile(ctx, name, wait)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	release := func() error {
+		err := unlockFile()
+		unlock()
+		return err
+	}
+	if locker != nil {
+		unlockRemote, err := locker.Lock(ctx, name)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		unlockLocal := release
+		release = func() error {
+			return errors.Join(unlockRemote(), unlockLocal())
+		}
+	}
+	return release, nil
+}
+
+// localLocks holds a semaphore per group, taken by the goroutine holding
+// the lock of the group in this process.
+var localLocks = struct {
+	sync.Mutex
+	groups map[string]chan struct{}
+}{groups: map[string]chan struct{}{}}
+
+// lockLocal takes the in-process lock of a group, waiting for up to wait,
+// and returns a function releasing it.
+func lockLocal(ctx context.Context, group string, wait time.Duration) (func(), error) {
+	localLocks.Lock()
+	sem, ok := localLocks.groups[group]
+	if !ok {
+		sem = make(chan struct{}, 1)
+		localLocks.groups[group] = sem
+	}
+	localLocks.Unlock()
+
+	var timeout <-chan time.Time
+	if wait >= 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	default:
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-timeout:
+		return nil, &LockTimeoutError{Group: group, Wait: wait}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lockGroupFile takes the file lock of a group in the data directory,
+// waiting for up to wait, and returns a function releasing it.
+func lockGroupFile(ctx context.Context, group string, wait time.Duration) (func() error, error) {
+	path := filepath.Join(config.Settings.Storage.DataDir, ".locks", filepath.FromSlash(group)+".lock")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if locked {
+			break
+		}
+		if wait >= 0 && !time.Now().Before(deadline) {
+			file.Close()
+			return nil, &LockTimeoutError{Group: group, Wait: wait}
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+	return func() error {
+		// Closing the file releases the lock as well
+		if err := unlockFile(file); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to release lock: %w", err)
+		}
+		return file.Close()
+	}, nil
+}
+
+// groupLocker returns the configured lock, or nil when locking is disabled.
+func groupLocker() (GroupLocker, error) {
+	switch conf := config.Settings.Storage.Lock; conf.Backend {
+	case "":
+		return nil, nil
+	case config.LockRedis:
+		return NewRedisLocker(conf), nil
+	default:
+		return nil, fmt.Errorf("unknown lock backend: %s", conf.Backend)
+	}
+}
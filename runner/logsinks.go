@@ -0,0 +1,229 @@
+package runner
+
+import (
+	"autoassigner/history"
+	"autoassigner/kafka"
+	"autoassigner/syslog"
+	"autoassigner/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported values for LogSink.Type.
+const (
+	LogSinkSyslog   = "syslog"
+	LogSinkKafka    = "kafka"
+	LogSinkHTTPBulk = "http_bulk"
+)
+
+const defaultLogSinkTimeout = 10 * time.Second
+
+// LogSink ships the assignments of a group to an external system once they
+// are made, in addition to the group's assignments.log:
+//
+//	log_sinks:
+//	  - type: kafka
+//	    url: https://kafka-rest.example.com:8082
+//	    topic: assignments
+//	  - type: http_bulk
+//	    url: https://elasticsearch.example.com:9200
+//	    index: assignments
+//	    headers: {Authorization: "env:ES_AUTH"}
+type LogSink struct {
+	Type    string            `yaml:"type" jsonschema:"enum=syslog|kafka|http_bulk"` // syslog, kafka (through a Kafka REST Proxy) or http_bulk (Elasticsearch-compatible bulk API)
+	URL     string            `yaml:"url"`                                           // Base URL of the REST Proxy or the bulk API
+	Topic   string            `yaml:"topic"`                                         // Kafka topic the records are produced to
+	Index   string            `yaml:"index"`                                         // Index of http_bulk documents (default autoassigner-assignments)
+	Network string            `yaml:"network"`                                       // Network of the syslog server: udp (default), tcp, unix or unixgram
+	Address string            `yaml:"address"`                                       // Address of the syslog server, e.g. syslog.example.com:514; the local syslog daemon when empty
+	Tag     string            `yaml:"tag"`                                           // App name of syslog messages (default autoassigner)
+	Headers map[string]string `yaml:"headers"`                                       // Headers of kafka and http_bulk requests; values may be secret references such as env:ES_AUTH
+	Timeout string            `yaml:"timeout"`                                       // Time shipping an assignment may take, e.g. 5s (default 10s)
+}
+
+// validate checks the settings of the sink and returns its timeout.
+func (s LogSink) validate() (time.Duration, error) {
+	switch s.Type {
+	case LogSinkSyslog:
+		if _, err := syslog.New(s.Network, s.Address, syslog.FacilityUser, s.Tag); err != nil {
+			return 0, err
+		}
+	case LogSinkKafka:
+		if s.URL == "" || s.Topic == "" {
+			return 0, fmt.Errorf("kafka log sink needs url and topic")
+		}
+	case LogSinkHTTPBulk:
+		if s.URL == "" {
+			return 0, fmt.Errorf("http_bulk log sink needs url")
+		}
+	default:
+		return 0, fmt.Errorf("unknown log sink type: %q", s.Type)
+	}
+	if s.Timeout == "" {
+		return defaultLogSinkTimeout, nil
+	}
+	d, err := time.ParseDuration(s.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid log sink timeout: %s", s.Timeout)
+	}
+	return d, nil
+}
+
+// shipAssignments sends the log records of committed assignments to the log
+// sinks of their group. The records are already in the assignment log, so
+// sinks that fail are logged as warnings rather than failing the assignment.
+func shipAssignments(ctx context.Context, written []assignmentChanges) {
+	if len(written) == 0 || len(written[0].sinks) == 0 {
+		return
+	}
+	// Multi-role assignments are shipped together, like they were made
+	records := make([]AssignmentLog, len(written))
+	for i, changes := range written {
+		records[i] = changes.entry
+		records[i].SchemaVersion = history.CurrentSchemaVersion // As logged
+	}
+	for _, sink := range written[0].sinks {
+		if err := sink.ship(ctx, records); err != nil {
+			tracing.Printf(ctx, "Warning: failed to ship assignment %s of %s to %s log sink: %v", records[0].ID, records[0].Group, sink.Type, err)
+		}
+	}
+}
+
+// ship sends records to the sink.
+func (s LogSink) ship(ctx context.Context, records []AssignmentLog) error {
+	timeout, err := s.validate()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch s.Type {
+	case LogSinkSyslog:
+		writer, err := syslogWriter(s)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			t, err := time.Parse(time.RFC3339, record.Timestamp)
+			if err != nil {
+				t = timeNow()
+			}
+			if err := writer.Send(ctx, syslog.SeverityInfo, t, data); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case LogSinkKafka:
+		headers, err := s.headers(ctx)
+		if err != nil {
+			return err
+		}
+		// Keyed by assignment ID so the records of one assignment land in the same partition
+		messages := make([]kafka.Message, len(records))
+		for i, record := range records {
+			messages[i] = kafka.Message{Key: record.ID, Value: record}
+		}
+		client := &kafka.Client{URL: s.URL, Headers: headers}
+		return client.Produce(ctx, s.Topic, messages...)
+
+	default: // LogSinkHTTPBulk
+		index := s.Index
+		if index == "" {
+			index = "autoassigner-assignments"
+		}
+		var body bytes.Buffer
+		for _, record := range records {
+			// IDs of the documents make shipping an assignment again harmless
+			action := map[string]map[string]string{"index": {"_index": index, "_id": record.ID + "-" + record.User}}
+			for _, v := range []interface{}{action, record} {
+				data, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				body.Write(append(data, '\n'))
+			}
+		}
+		resp, err := s.post(ctx, "/_bulk", "application/x-ndjson", body.Bytes())
+		if err != nil {
+			return err
+		}
+		// The bulk API answers 200 even when documents failed
+		var result struct {
+			Errors bool `json:"errors"`
+		}
+		if json.Unmarshal(resp, &result) == nil && result.Errors {
+			return fmt.Errorf("bulk request failed for some records: %.512s", strings.TrimSpace(string(resp)))
+		}
+		return nil
+	}
+}
+
+// post sends data to path of the sink's URL and returns the response body.
+func (s LogSink) post(ctx context.Context, path, contentType string, data []byte) ([]byte, error) {
+	headers, err := s.headers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.URL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return nil, fmt.Errorf("unexpected status %s: %.512s", resp.Status, msg)
+		}
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return body, nil
+}
+
+// headers returns the headers of the sink's requests with their secret
+// references resolved.
+func (s LogSink) headers(ctx context.Context) (map[string]string, error) {
+	return resolveHeaders(ctx, s.Headers)
+}
+
+var (
+	syslogWritersMu sync.Mutex
+	syslogWriters   = map[string]*syslog.Writer{}
+)
+
+// syslogWriter returns the writer of a syslog sink, shared by every
+// assignment of the process so its connection is reused.
+func syslogWriter(s LogSink) (*syslog.Writer, error) {
+	key := s.Network + "|" + s.Address + "|" + s.Tag
+	syslogWritersMu.Lock()
+	defer syslogWritersMu.Unlock()
+	if w, ok := syslogWriters[key]; ok {
+		return w, nil
+	}
+	w, err := syslog.New(s.Network, s.Address, syslog.FacilityUser, s.Tag)
+	if err != nil {
+		return nil, err
+	}
+	syslogWriters[key] = w
+	return w, nil
+}
@@ -0,0 +1,241 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pause takes a user out of the rotation of every group until a time, such
+// as during a vacation, without editing the group files.
+type Pause struct {
+	User  string `json:"user"`
+	From  string `json:"from,omitempty"`  // Start of a scheduled pause in RFC 3339 format; the pause started when it was made without one
+	Until string `json:"until"`           // End of the pause in RFC 3339 format
+	Actor string `json:"actor,omitempty"` // Who paused the user, e.g. the Slack user of the bot
+}
+
+// until returns the end of the pause; a pause with an invalid end has ended.
+func (p Pause) until() time.Time {
+	t, _ := time.Parse(time.RFC3339, p.Until)
+	return t
+}
+
+// Started reports whether the pause has started at now.
+func (p Pause) Started(now time.Time) bool {
+	if p.From == "" {
+		return true
+	}
+	from, err := time.Parse(time.RFC3339, p.From)
+	return err != nil || !from.After(now)
+}
+
+// PauseUser pauses a user in every group until the given time, replacing
+// an earlier pause of the user. Paused users are unavailable like users
+// listed in never_available.
+func PauseUser(ctx context.Context, user string, until time.Time, actor string) error {
+	return SchedulePause(ctx, user, time.Time{}, until, actor)
+}
+
+// SchedulePause pauses a user in every group from one time until another,
+// such as for a vacation, like PauseUser. A zero from, or one that has
+// passed, starts the pause at once.
+func SchedulePause(ctx context.Context, user string, from, until time.Time, actor string) error {
+	if user == "" {
+		return fmt.Errorf("user is required")
+	}
+	now := timeNow()
+	if !until.After(now) {
+		return fmt.Errorf("the end of the pause %s is not in the future", until.Format(time.RFC3339))
+	}
+	if !from.Before(until) {
+		return fmt.Errorf("the start of the pause %s is not before its end %s", from.Format(time.RFC3339), until.Format(time.RFC3339))
+	}
+	pause := Pause{User: user, Until: until.Format(time.RFC3339), Actor: actor}
+	if from.After(now) {
+		pause.From = from.Format(time.RFC3339)
+	}
+	err := updatePauses(ctx, func(pauses []Pause) ([]Pause, bool) {
+		kept := pauses[:0]
+		for _, p := range pauses {
+			if p.User != user {
+				kept = append(kept, p)
+			}
+		}
+		return append(kept, pause), true
+	})
+	if err != nil {
+		return err
+	}
+	if pause.From != "" {
+		recordStateChange(fmt.Sprintf("Pause %s from %s until %s", user, pause.From, pause.Until))
+	} else {
+		recordStateChange(fmt.Sprintf("Pause %s until %s", user, pause.Until))
+	}
+	notifyMember(context.WithoutCancel(ctx), user, GroupEvent{Event: EventPaused, From: pause.From, Until: pause.Until, Actor: actor})
+	return nil
+}
+
+// ResumeUser ends the pause of a user and reports whether they were paused.
+func ResumeUser(ctx context.Context, user string) (bool, error) {
+	resumed := false
+	err := updatePauses(ctx, func(pauses []Pause) ([]Pause, bool) {
+		kept := pauses[:0]
+		for _, p := range pauses {
+			if p.User != user {
+				kept = append(kept, p)
+			}
+		}
+		resumed = len(kept) < len(pauses)
+		return kept, resumed
+	})
+	if err != nil || !resumed {
+		return false, err
+	}
+	recordStateChange(fmt.Sprintf("Resume %s", user))
+	notifyMember(context.WithoutCancel(ctx), user, GroupEvent{Event: EventResumed})
+	return true, nil
+}
+
+// ListPauses returns the pauses that haven't ended, including scheduled
+// pauses that haven't started, by user.
+func ListPauses() ([]Pause, error) {
+	pauses, err := readPauses()
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow()
+	var active []Pause
+	for _, p := range pauses {
+		if p.until().After(now) {
+			active = append(active, p)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].User < active[j].User })
+	return active, nil
+}
+
+// pausedUsers returns the users whose pause has started and hasn't ended,
+// with its end.
+func pausedUsers() (map[string]time.Time, error) {
+	pauses, err := ListPauses()
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow()
+	paused := make(map[string]time.Time, len(pauses))
+	for _, p := range pauses {
+		if p.Started(now) {
+			paused[p.User] = p.until()
+		}
+	}
+	return paused, nil
+}
+
+// ParsePauseEnd parses the end of a pause relative to now, in the local
+// time of the host: a weekday such as monday, the start of its next
+// occurrence after today; tomorrow; a date such as 2024-05-20, the start of
+// that day; a time in RFC 3339 format; or a duration such as 3d, 2w or 4h.
+func ParsePauseEnd(value string, now time.Time) (time.Time, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if value == "tomorrow" {
+		return midnight.AddDate(0, 0, 1), nil
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if name := strings.ToLower(day.String()); value == name || value == name[:3] {
+			days := (int(day)-int(now.Weekday())+6)%7 + 1
+			return midnight.AddDate(0, 0, days), nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, strings.ToUpper(value)); err == nil {
+		return t, nil
+	}
+	if d, err := history.ParseWindow(value); err == nil {
+		return now.Add(d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid end of pause %q: use a weekday, tomorrow, a date such as 2024-05-20 or a duration such as 3d", value)
+}
+
+// pausesLockName is the name of the lock of the pauses shared by all
+// groups, held from reading pauses.json until it is written.
+const pausesLockName = ".pauses"
+
+// updatePauses applies edit to the pauses under their lock and writes them
+// when edit reports a change, so concurrent pauses and resumes, such as
+// from the Slack bot and the web UI, don't overwrite each other.
+func updatePauses(ctx context.Context, edit func(pauses []Pause) ([]Pause, bool)) error {
+	release, err := takeLock(ctx, pausesLockName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	pauses, err := readPauses()
+	if err != nil {
+		return err
+	}
+	pauses, changed := edit(pauses)
+	if !changed {
+		return nil
+	}
+	return writePauses(pauses)
+}
+
+// pausesPath returns the path of the pauses shared by all groups.
+func pausesPath() string {
+	return filepath.Join(config.Settings.Storage.DataDir, "pauses.json")
+}
+
+// readPauses reads every recorded pause, including those that have ended.
+// A missing file is treated as empty.
+func readPauses() ([]Pause, error) {
+	data, err := os.ReadFile(pausesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read pauses: %w", err)
+	}
+	var pauses []Pause
+	if err := json.Unmarshal(data, &pauses); err != nil {
+		return nil, fmt.Errorf("failed to parse pauses: %w", err)
+	}
+	return pauses, nil
+}
+
+// writePauses replaces the pauses, dropping those that have ended.
+func writePauses(pauses []Pause) error {
+	now := timeNow()
+	active := []Pause{}
+	for _, p := range pauses {
+		if p.until().After(now) {
+			active = append(active, p)
+		}
+	}
+	data, err := json.MarshalIndent(active, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pauses: %w", err)
+	}
+	if err := os.MkdirAll(config.Settings.Storage.DataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := writeFileAtomic(pausesPath(), data); err != nil {
+		return fmt.Errorf("failed to write pauses: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// preflight verifies, before a user is selected or anything is written,
+// that the state storage of a group accepts writes and that its availability
+// checker answers for every candidate, for assignments with RequireAllChecks.
+// Dry runs write nothing, so only their availability is checked. A failed
+// check returns a PreflightError.
+func preflight(ctx context.Context, factory *ComponentFactory, group string, conf *AssigneeGroupConfig, users []string, dryRun bool) error {
+	if !dryRun {
+		if err := checkWritable(ctx, factory.GetStorageManager(), group); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &PreflightError{Group: group, Check: PreflightStorage, Err: err}
+		}
+	}
+
+	checker, err := factory.CreateAvailabilityChecker(conf.AvailabilityChecker)
+	if err != nil {
+		return &ConfigError{Group: group, Err: err}
+	}
+	budget, err := conf.availabilityBudget()
+	if err != nil {
+		return &ConfigError{Group: group, Err: err}
+	}
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+	var checked, ids []string
+	for _, user := range users {
+		if _, ok := conf.availabilityOverride(user); !ok {
+			checked = append(checked, user)
+			ids = append(ids, conf.availabilityID(user))
+		}
+	}
+	if len(checked) == 0 {
+		return nil
+	}
+	if bulk, ok := checker.(BulkAvailabilityChecker); ok {
+		if _, err := bulk.AreAvailable(ctx, ids); err != nil {
+			return preflightAvailabilityError(group, strings.Join(checked, ","), err)
+		}
+		return nil
+	}
+	for i, user := range checked {
+		if _, err := checker.IsAvailable(ctx, ids[i]); err != nil {
+			return preflightAvailabilityError(group, user, err)
+		}
+	}
+	return nil
+}
+
+// preflightAvailabilityError reports the failed availability check of
+// users in the pre-flight checks of a group.
+func preflightAvailabilityError(group, users string, err error) error {
+	return &PreflightError{Group: group, Check: PreflightAvailability, Err: &AvailabilityError{User: users, Err: err}}
+}
+
+// checkWritable verifies that storage accepts writes for a group, with the
+// check of the backend when it has one and else by writing to the group's
+// data directory.
+func checkWritable(ctx context.Context, storage StorageManager, group string) error {
+	if checker, ok := storage.(WritableChecker); ok {
+		return checker.CheckWritable(ctx, group)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return checkDataDirWritable(group)
+}
+
+// checkDataDirWritable creates and removes a file in the data directory of a group.
+func checkDataDirWritable(group string) error {
+	dir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove probe from data directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package runner
+
+import (
+	"autoassigner/availability"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// AvailabilityReport is the outcome of asking the availability checker of
+// a group about its users, as returned by ProbeAvailability. Nothing is
+// assigned and no state is changed.
+type AvailabilityReport struct {
+	Group   string              `json:"group"`
+	Checker string              `json:"checker"`        // Availability checker asked
+	Policy  string              `json:"policy"`         // on_availability_error of the group, applied to failed checks
+	Bulk    *BulkProbe          `json:"bulk,omitempty"` // Bulk check of every probed user, made by assignments when the checker supports it
+	Users   []AvailabilityProbe `json:"users"`          // Probed users in config order
+}
+
+// BulkProbe is the outcome of checking every probed user in one call.
+type BulkProbe struct {
+	LatencyMS float64 `json:"latency_ms"`      // Time the checker took to answer
+	Error     string  `json:"error,omitempty"` // Error of a failed check
+}
+
+// AvailabilityProbe is the outcome of asking the checker about one user.
+type AvailabilityProbe struct {
+	User        string  `json:"user"`
+	ID          string  `json:"id"`              // Identifier the checker is asked about, from availability_ids
+	Asked       bool    `json:"asked"`           // Whether the checker was asked, which it isn't about always_available and never_available users
+	Available   bool    `json:"available"`       // Whether assignments take the user as available
+	Explanation string  `json:"explanation"`     // Why the user is or isn't available
+	LatencyMS   float64 `json:"latency_ms"`      // Time the checker took to answer
+	Error       string  `json:"error,omitempty"` // Error of a failed check
+}
+
+// ProbeAvailability asks the availability checker of a group about every
+// member, or only user when it isn't empty, one by one and without its
+// cache, timing every answer and explaining the availability assignments
+// would take from it. checker replaces the group's checker when not empty,
+// as AssignOptions.Availability does. Users listed in always_available or
+// never_available aren't asked about, as in assignments.
+func ProbeAvailability(ctx context.Context, group, user, checker string) (*AvailabilityReport, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	if groupConf, _, err = overrideChecker(groupConf, checker); err != nil {
+		return nil, err
+	}
+	policy, err := groupConf.availabilityErrorPolicy()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	availChecker, err := newStateFactory().CreateAvailabilityChecker(groupConf.AvailabilityChecker)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	if cached, ok := availChecker.(interface{ Unwrap() availability.Checker }); ok {
+		// Ask the backend rather than the cache
+		availChecker = cached.Unwrap()
+	}
+
+	users := groupConf.Users
+	if user != "" {
+		user = groupConf.canonicalUser(user)
+		if !slices.Contains(groupConf.Users, user) {
+			return nil, &ConfigError{Group: group, Err: fmt.Errorf("user %s is not a member of the group", user)}
+		}
+		users = []string{user}
+	}
+	paused, err := pausedUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AvailabilityReport{Group: group, Checker: groupConf.AvailabilityChecker, Policy: policy}
+	if bulk, ok := availChecker.(BulkAvailabilityChecker); ok {
+		var ids []string
+		for _, u := range users {
+			if _, ok := groupConf.availabilityOverride(u); !ok {
+				ids = append(ids, groupConf.availabilityID(u))
+			}
+		}
+		if len(ids) > 0 {
+			start := time.Now()
+			_, err := bulk.AreAvailable(ctx, ids)
+			report.Bulk = &BulkProbe{LatencyMS: milliseconds(time.Since(start))}
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				report.Bulk.Error = err.Error()
+			}
+		}
+	}
+
+	for _, u := range users {
+		probe := AvailabilityProbe{User: u, ID: groupConf.availabilityID(u)}
+		if available, ok := groupConf.availabilityOverride(u); ok {
+			probe.Available = available
+			probe.Explanation = "listed in always_available, the checker isn't asked"
+			if !available {
+				probe.Explanation = "listed in never_available, the checker isn't asked"
+			}
+		} else if err := probeUser(ctx, availChecker, policy, report.Checker, &probe); err != nil {
+			return nil, err
+		}
+		if until, ok := paused[u]; ok {
+			probe.Available = false
+			probe.Explanation += fmt.Sprintf("; paused until %s", until.Format(time.RFC3339))
+		}
+		report.Users = append(report.Users, probe)
+	}
+	return report, nil
+}
+
+// probeUser asks checker about the user of probe and fills in the answer,
+// its latency and the availability policy takes from it. It only fails when
+// ctx is done.
+func probeUser(ctx context.Context, checker AvailabilityChecker, policy, name string, probe *AvailabilityProbe) error {
+	start := time.Now()
+	available, err := checker.IsAvailable(ctx, probe.ID)
+	probe.Asked = true
+	probe.LatencyMS = milliseconds(time.Since(start))
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil:
+		probe.Error = err.Error()
+		probe.Available = policy == AvailabilityErrorAssumeAvailable
+		switch policy {
+		case AvailabilityErrorAssumeAvailable:
+			probe.Explanation = fmt.Sprintf("check failed (%v), assumed available as on_availability_error is assume_available", err)
+		case AvailabilityErrorAssumeUnavailable:
+			probe.Explanation = fmt.Sprintf("check failed (%v), assumed unavailable as on_availability_error is assume_unavailable", err)
+		default:
+			probe.Explanation = fmt.Sprintf("check failed (%v), which fails assignments reaching the user", err)
+		}
+	case available:
+		probe.Available = true
+		probe.Explanation = fmt.Sprintf("%s reports %s available", name, probe.ID)
+	default:
+		probe.Explanation = fmt.Sprintf("%s reports %s unavailable", name, probe.ID)
+	}
+	return nil
+}
+
+// milliseconds converts d into fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// QueryOptions holds the options of QueryHistory.
+type QueryOptions struct {
+	Limit int                     // Return only the most recent records; all when zero
+	Allow func(group string) bool // Groups that may be read; all when nil
+}
+
+// QueryHistory returns the records of the assignment logs matching q,
+// oldest first. Only the logs of the groups q is limited to are read, one
+// record at a time, so only the matches are held in memory.
+func QueryHistory(ctx context.Context, q *history.Query, opts QueryOptions) ([]AssignmentLog, error) {
+	configured, err := config.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+	groups, ok := q.Groups()
+	if !ok {
+		groups = configured
+	}
+	known := make(map[string]bool, len(configured))
+	for _, group := range configured {
+		known[group] = true
+	}
+	for _, group := range groups {
+		if !known[group] {
+			return nil, &InvalidGroupError{Group: group}
+		}
+	}
+
+	var matches []AssignmentLog
+	for _, group := range groups {
+		if opts.Allow != nil && !opts.Allow(group) {
+			continue
+		}
+		records, err := queryGroupLog(ctx, group, q)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, records...)
+	}
+	// Each log is in order, but the groups are interleaved
+	if len(groups) > 1 {
+		times := make(map[string]time.Time, len(matches))
+		for _, m := range matches {
+			times[m.Timestamp], _ = time.Parse(time.RFC3339, m.Timestamp)
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			return times[matches[i].Timestamp].Before(times[matches[j].Timestamp])
+		})
+	}
+	if opts.Limit > 0 && len(matches) > opts.Limit {
+		matches = matches[len(matches)-opts.Limit:]
+	}
+	return matches, nil
+}
+
+// queryGroupLog returns the records of a group's assignment log matching q.
+// A group without a log has no records.
+func queryGroupLog(ctx context.Context, group string, q *history.Query) ([]AssignmentLog, error) {
+	f, err := os.Open(filepath.Join(config.Settings.Storage.DataDir, group, "assignments.log"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assignment log of %s: %w", group, err)
+	}
+	defer f.Close()
+
+	var matches []AssignmentLog
+	r := history.NewReader(f)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		record, err := r.Next()
+		if err == io.EOF {
+			return matches, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read assignment log of %s: %w", group, err)
+		}
+		if q.Match(record) {
+			matches = append(matches, *record)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// QueuedAssignment is an assignment deferred because it was requested during quiet hours.
+type QueuedAssignment struct {
+	ID           string            `json:"id"` // Becomes the ID of the assignment once it is made
+	Group        string            `json:"group"`
+	Priority     string            `json:"priority,omitempty"`
+	Seed         *int64            `json:"seed,omitempty"`
+	Strategy     string            `json:"strategy,omitempty"`     // Strategy override of the request
+	Availability string            `json:"availability,omitempty"` // Availability checker override of the request
+	QueuedAt     string            `json:"queued_at"`              // Time of the request in RFC 3339 format
+	NotBefore    string            `json:"not_before"`             // End of the quiet hours in RFC 3339 format
+	Actor        string            `json:"actor,omitempty"`
+	CallbackData map[string]string `json:"callback_data,omitempty"` // Passed to the group's callback when the assignment is made
+}
+
+// FlushResult reports the outcome of flushing one queued assignment.
+type FlushResult struct {
+	Assignment QueuedAssignment
+	Err        error // Nil when the assignment was made and removed from the queue
+}
+
+// timeNow returns the current time. Tests replace it to simulate quiet hours.
+var timeNow = time.Now
+
+// ListQueue returns the deferred assignments of every group in queue order.
+func ListQueue() ([]QueuedAssignment, error) {
+	return readQueue()
+}
+
+// Names the deferral queue is locked under with takeLock. They never clash
+// with groups, whose names don't start with a dot.
+const (
+	queueLockName = ".queue"       // Held from reading queue.json until it is written
+	flushLockName = ".queue-flush" // Held for the whole of a flush
+)
+
+// FlushQueue makes the queued assignments whose quiet hours have ended,
+// or every queued assignment when all is true. Assignments that fail stay
+// queued and are reported in the results; cancelling ctx stops the flush.
+// Flushes run one at a time, so no queued assignment is made twice, and
+// assignments deferred while one runs stay queued.
+func FlushQueue(ctx context.Context, all bool) ([]FlushResult, error) {
+	release, err := takeLock(ctx, flushLockName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	queue, err := readQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	now := timeNow()
+	var results []FlushResult
+	made := map[string]bool{}
+	for _, qa := range queue {
+		notBefore, err := time.Parse(time.RFC3339, qa.NotBefore)
+		if ctx.Err() != nil || (!all && err == nil && now.Before(notBefore)) {
+			continue
+		}
+
+		opts := AssignOptions{ID: qa.ID, Priority: qa.Priority, Strategy: qa.Strategy, Availability: qa.Availability, Seed: qa.Seed, IgnoreQuietHours: true, CallbackData: qa.CallbackData}
+		if err := AssignWithOptions(ctx, qa.Group, opts); err != nil {
+			results = append(results, FlushResult{Assignment: qa, Err: err})
+			continue
+		}
+		made[qa.ID] = true
+		results = append(results, FlushResult{Assignment: qa})
+	}
+	if len(made) == 0 {
+		return results, ctx.Err()
+	}
+
+	// The queue is read again, so the changes made to it during the flush are kept
+	err = updateQueue(context.WithoutCancel(ctx), func(queue []QueuedAssignment) ([]QueuedAssignment, bool) {
+		var remaining []QueuedAssignment
+		for _, qa := range queue {
+			if !made[qa.ID] {
+				remaining = append(remaining, qa)
+			}
+		}
+		return remaining, len(remaining) != len(queue)
+	})
+	if err != nil {
+		return results, err
+	}
+	recordStateChange("Flush deferral queue")
+	return results, ctx.Err()
+}
+
+// deferAssignment queues an assignment of group until the quiet hours end.
+func deferAssignment(ctx context.Context, group string, opts AssignOptions, notBefore time.Time) (*QueuedAssignment, error) {
+	now := timeNow()
+	if opts.ID == "" {
+		opts.ID = newULID(now)
+	}
+	qa := QueuedAssignment{
+		ID:           opts.ID,
+		Group:        group,
+		Priority:     opts.Priority,
+		Seed:         opts.Seed,
+		Strategy:     opts.Strategy,
+		Availability: opts.Availability,
+		QueuedAt:     now.Format(time.RFC3339),
+		NotBefore:    notBefore.Format(time.RFC3339),
+		Actor:        currentActor(),
+		CallbackData: opts.CallbackData,
+	}
+	err := updateQueue(ctx, func(queue []QueuedAssignment) ([]QueuedAssignment, bool) {
+		return append(queue, qa), true
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordStateChange(fmt.Sprintf("Defer assignment in %s", group))
+	return &qa, nil
+}
+
+// updateQueue replaces the deferral queue with the one edit returns when
+// it reports a change, holding the lock of the queue from reading it until
+// it is written.
+func updateQueue(ctx context.Context, edit func(queue []QueuedAssignment) ([]QueuedAssignment, bool)) error {
+	release, err := takeLock(ctx, queueLockName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	queue, err := readQueue()
+	if err != nil {
+		return err
+	}
+	queue, changed := edit(queue)
+	if !changed {
+		return nil
+	}
+	return writeQueue(queue)
+}
+
+// queuePath returns the path of the deferral queue shared by all groups.
+func queuePath() string {
+	return filepath.Join(config.Settings.Storage.DataDir, "queue.json")
+}
+
+// readQueue reads the deferral queue. A missing file is treated as empty.
+func readQueue() ([]QueuedAssignment, error) {
+	data, err := os.ReadFile(queuePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read queue: %w", err)
+	}
+
+	var queue []QueuedAssignment
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return nil, fmt.Errorf("failed to parse queue: %w", err)
+	}
+	return queue, nil
+}
+
+// writeQueue replaces the deferral queue.
+func writeQueue(queue []QueuedAssignment) error {
+	if queue == nil {
+		queue = []QueuedAssignment{}
+	}
+	data, err := json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue: %w", err)
+	}
+	if err := os.MkdirAll(config.Settings.Storage.DataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := writeFileAtomic(queuePath(), data); err != nil {
+		return fmt.Errorf("failed to write queue: %w", err)
+	}
+	return nil
+}
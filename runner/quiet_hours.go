@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a recurring window in which assignments are deferred
+// instead of made, e.g. nights and weekends.
+type QuietHours struct {
+	Start    string   `yaml:"start"`    // Start of the nightly window as HH:MM
+	End      string   `yaml:"end"`      // End of the nightly window as HH:MM; may be before Start to span midnight
+	Days     []string `yaml:"days"`     // Weekdays that are quiet all day, e.g. saturday
+	Timezone string   `yaml:"timezone"` // IANA time zone of the window, the group's time zone by default
+}
+
+// enabled reports whether any quiet time is configured.
+func (q QuietHours) enabled() bool {
+	return q.Start != "" || q.End != "" || len(q.Days) > 0
+}
+
+// quietSchedule is QuietHours parsed for evaluation.
+type quietSchedule struct {
+	start, end int // Minutes after midnight
+	days       map[time.Weekday]bool
+	loc        *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// parse validates the quiet hours and returns them ready for evaluation,
+// in loc unless they name their own time zone.
+func (q QuietHours) parse(loc *time.Location) (*quietSchedule, error) {
+	s := &quietSchedule{days: make(map[time.Weekday]bool), loc: loc}
+	if (q.Start == "") != (q.End == "") {
+		return nil, fmt.Errorf("quiet_hours needs both start and end")
+	}
+	if q.Start != "" {
+		var err error
+		if s.start, err = parseClock(q.Start); err != nil {
+			return nil, err
+		}
+		if s.end, err = parseClock(q.End); err != nil {
+			return nil, err
+		}
+	}
+	for _, day := range q.Days {
+		wd, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return nil, fmt.Errorf("unknown quiet_hours day: %s", day)
+		}
+		s.days[wd] = true
+	}
+	if len(s.days) == len(weekdays) {
+		return nil, fmt.Errorf("quiet_hours cannot cover every day of the week")
+	}
+	if q.Timezone != "" {
+		loc, err := time.LoadLocation(q.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet_hours timezone: %w", err)
+		}
+		s.loc = loc
+	}
+	return s, nil
+}
+
+// parseClock converts HH:MM into minutes after midnight.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quiet_hours time %q, want HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// quiet reports whether t falls within the quiet hours.
+func (s *quietSchedule) quiet(t time.Time) bool {
+	t = t.In(s.loc)
+	if s.days[t.Weekday()] {
+		return true
+	}
+	m := t.Hour()*60 + t.Minute()
+	if s.start < s.end {
+		return m >= s.start && m < s.end
+	}
+	if s.start > s.end {
+		return m >= s.start || m < s.end
+	}
+	return false
+}
+
+// nextOpen returns the first minute at or after t outside the quiet hours.
+func (s *quietSchedule) nextOpen(t time.Time) time.Time {
+	t = t.Truncate(time.Minute)
+	// A week is the longest a valid schedule can stay quiet
+	for i := 0; i <= 7*24*60 && s.quiet(t); i++ {
+		t = t.Add(time.Minute)
+	}
+	return t
+}
@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"autoassigner/selector"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// assignmentReason explains in a few words why user was assigned, for
+// recipients of the assignment: the strategy's reason, such as
+// "least_assigned count=3", or "fallback after 2 skips" when the users the
+// strategy chose first were unavailable. A chain gives the reason of the
+// strategy that decided, with the strategies that tied before it, such as
+// "round_robin next after least_assigned tie". counts are those before the
+// assignment.
+func assignmentReason(strategy AssignmentStrategy, name, user string, counts map[string]int, skipped int) string {
+	if skipped == 1 {
+		return "fallback after 1 skip"
+	}
+	if skipped > 1 {
+		return fmt.Sprintf("fallback after %d skips", skipped)
+	}
+	if debt, ok := strategy.(*selector.SkipDebt); ok {
+		if owed := debt.Debts[user]; owed > 0 {
+			return fmt.Sprintf("skip_debt owed=%d", owed)
+		}
+		strategy = debt.Inner
+	}
+	if chain, ok := strategy.(*selector.Composite); ok {
+		names := strategyNames(name)
+		decider := chain.Decider()
+		if decider < 0 || decider >= len(names) {
+			return fmt.Sprintf("%s tie, first listed", name)
+		}
+		reason := strategyReason(chain.Strategies[decider], names[decider], user, counts)
+		if decider == 0 {
+			return reason
+		}
+		return fmt.Sprintf("%s after %s tie", reason, strings.Join(names[:decider], ","))
+	}
+	return strategyReason(strategy, name, user, counts)
+}
+
+// strategyReason is the reason a single strategy gives for selecting user.
+func strategyReason(strategy AssignmentStrategy, name, user string, counts map[string]int) string {
+	switch name {
+	case "round_robin":
+		return "round_robin next"
+	case "least_assigned":
+		return fmt.Sprintf("least_assigned count=%d", counts[user])
+	case "open_load":
+		if load, ok := strategy.(*selector.OpenLoad); ok {
+			return fmt.Sprintf("open_load open=%d", load.Open[user])
+		}
+	case "least_recently_assigned":
+		if lra, ok := strategy.(*selector.LeastRecentlyAssigned); ok {
+			if last, ok := lra.Last[user]; ok {
+				return fmt.Sprintf("least_recently_assigned last=%s", last.Format(time.RFC3339))
+			}
+			return "least_recently_assigned never assigned"
+		}
+	case "random":
+		return "random pick"
+	}
+	return name
+}
@@ -0,0 +1,191 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// CountsRebuild holds the state of a group as currently stored and as
+// reconstructed from its assignment log.
+type CountsRebuild struct {
+	Group          string
+	CurrentCounts  map[string]int
+	RebuiltCounts  map[string]int
+	CurrentIndex   int
+	RebuiltIndex   int
+	LogRecordCount int
+
+	rebuiltDays map[string]map[string]int // Rebuilt counts per local date and user
+	reset       *stateReset               // Reset baseline kept with the rebuilt counts; nil clears it
+}
+
+// Differences describes every value that would change when the rebuild is applied.
+func (r *CountsRebuild) Differences() []string {
+	var users []string
+	seen := map[string]bool{}
+	for user := range r.CurrentCounts {
+		users = append(users, user)
+		seen[user] = true
+	}
+	for user := range r.RebuiltCounts {
+		if !seen[user] {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+
+	var diffs []string
+	for _, user := range users {
+		if r.CurrentCounts[user] != r.RebuiltCounts[user] {
+			diffs = append(diffs, fmt.Sprintf("count for %s: %d -> %d", user, r.CurrentCounts[user], r.RebuiltCounts[user]))
+		}
+	}
+	if r.CurrentIndex != r.RebuiltIndex {
+		diffs = append(diffs, fmt.Sprintf("last index: %d -> %d", r.CurrentIndex, r.RebuiltIndex))
+	}
+	return diffs
+}
+
+// RebuildCounts reconstructs the counts and last index of a group from its
+// assignment log, and the counts of the records pruned from it, without
+// modifying any state.
+// Counts start at zero for every configured user, so a previous --reset-counts
+// is not reflected in the rebuilt values, and applying them undoes it.
+func RebuildCounts(group string) (*CountsRebuild, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	records, err := history.ReadFile(filepath.Join(groupDir, "assignments.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assignment log: %w", err)
+	}
+
+	rebuild := rebuildFromRecords(group, groupConf, records)
+	pruned, err := readPrunedCounts(group)
+	if err != nil {
+		return nil, err
+	}
+	rebuild.addPruned(groupConf, pruned)
+	// A cursor set after the last assignment is kept
+	if _, cursor := readCursor(group); cursor != "" {
+		rebuild.RebuiltIndex = rebuild.CurrentIndex
+	}
+	return rebuild, nil
+}
+
+// rebuildFromRecords reconstructs the counts and last index of a group from log records.
+func rebuildFromRecords(group string, groupConf *AssigneeGroupConfig, records []history.Record) *CountsRebuild {
+	rebuilt := make(map[string]int)
+	for _, user := range groupConf.Users {
+		rebuilt[user] = 0
+	}
+	// An invalid time zone is reported by ValidateGroup
+	loc, err := groupConf.location()
+	if err != nil {
+		loc = time.Local
+	}
+	days := make(map[string]map[string]int)
+	rebuiltIndex := -1
+	for _, record := range records {
+		user := groupConf.canonicalUser(record.User)
+		rebuilt[user]++
+		rebuiltIndex = record.NextIndex
+
+		// Records without a valid timestamp are counted in the base
+		if t, err := time.Parse(time.RFC3339, record.Timestamp); err == nil {
+			date := dayOf(t.In(loc))
+			if days[date] == nil {
+				days[date] = make(map[string]int)
+			}
+			days[date][user]++
+		}
+	}
+
+	return &CountsRebuild{
+		Group:          group,
+		CurrentCounts:  readCounts(group),
+		RebuiltCounts:  rebuilt,
+		CurrentIndex:   readLastIndex(group),
+		RebuiltIndex:   rebuiltIndex,
+		LogRecordCount: len(records),
+		rebuiltDays:    days,
+	}
+}
+
+// edit returns the change of the rebuild, to apply to the shared state.
+func (r *CountsRebuild) edit() stateEdit {
+	return stateChange(r.CurrentIndex, r.CurrentCounts, r.RebuiltIndex, r.RebuiltCounts)
+}
+
+// ApplyRebuild rebuilds the counts and last index of a group under its lock,
+// so assignments made since a rebuild was reported are not undone, writes
+// them and returns the rebuild it applied.
+func ApplyRebuild(ctx context.Context, group string) (*CountsRebuild, error) {
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	r, err := RebuildCounts(group)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Differences()) == 0 {
+		return r, nil
+	}
+	if err := applyRebuild(r); err != nil {
+		return nil, err
+	}
+	if err := syncSharedState(group, r.edit()); err != nil {
+		return nil, err
+	}
+	recordStateChange(fmt.Sprintf("Rebuild counts of %s", group))
+	return r, nil
+}
+
+// applyRebuild writes the rebuilt counts and last index of a group to its files only.
+// The counts are bucketed by the days of the logged assignments. The reset
+// baseline is replaced by the rebuild's, so counts rebuilt from the whole
+// log no longer count as reset.
+func applyRebuild(r *CountsRebuild) error {
+	buckets := newCountBuckets()
+	for date, day := range r.rebuiltDays {
+		buckets.Days[date] = make(map[string]int, len(day))
+		for user, count := range day {
+			buckets.Days[date][user] = count
+		}
+	}
+	buckets.setTotals(r.RebuiltCounts)
+
+	s, err := readStoredState(r.Group)
+	if err != nil {
+		// Stored state that can't be read is rewritten entirely
+		s = newStoredState()
+	}
+	s.Counts = buckets
+	s.Reset = r.reset
+	if r.CurrentIndex != r.RebuiltIndex {
+		s.Cursor = &stateCursor{Index: r.RebuiltIndex, Updated: timeNow().UTC()}
+	}
+	if err := writeStoredState(r.Group, s); err != nil {
+		return fmt.Errorf("failed to write rebuilt state: %w", err)
+	}
+	return nil
+}
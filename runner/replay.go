@@ -0,0 +1,188 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReplayDivergence is a logged assignment that the current config and
+// strategy would have made differently.
+type ReplayDivergence struct {
+	Record   int    // Position of the record in the log, starting at 1
+	Recorded string // User the log records as assigned
+	Expected string // User the current strategy selects for the same state
+}
+
+// ReplayResult is the outcome of replaying an assignment log against a group.
+type ReplayResult struct {
+	LogPath      string
+	Rebuild      *CountsRebuild     // State reconstructed from the log
+	Divergences  []ReplayDivergence // Records the current strategy would not reproduce
+	UnknownUsers []string           // Logged users that are not in the current config
+}
+
+// Replay reconstructs the state of a group by replaying the assignment log
+// at logPath against the group's current config, without modifying anything.
+// Each record is compared with the selection the current strategy makes for
+// the replayed state, which verifies that a strategy still behaves the same
+// after an upgrade. Users skipped as unavailable at the time also show up
+// as divergences, since availability cannot be replayed, and so do
+// selections of the random strategy unless it is seeded.
+func Replay(ctx context.Context, group, logPath string) (*ReplayResult, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	// history.ReadFile treats a missing log as empty, which would replay nothing
+	if _, err := os.Stat(logPath); err != nil {
+		return nil, fmt.Errorf("failed to read assignment log: %w", err)
+	}
+	records, err := history.ReadFile(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assignment log: %w", err)
+	}
+
+	configured := make(map[string]bool, len(groupConf.Users))
+	for _, user := range groupConf.Users {
+		configured[user] = true
+	}
+
+	result := &ReplayResult{LogPath: logPath}
+	factory := &ComponentFactory{}
+	counts := make(map[string]int, len(groupConf.Users))
+	lastIndex := -1
+	last := map[string]time.Time{}
+	unknown := map[string]bool{}
+	for i, record := range records {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		user := groupConf.canonicalUser(record.User)
+		if !configured[user] {
+			if !unknown[user] {
+				unknown[user] = true
+				result.UnknownUsers = append(result.UnknownUsers, user)
+			}
+		} else if expected, err := replaySelection(ctx, factory, groupConf, record, lastIndex, counts, last); err != nil {
+			return nil, &ConfigError{Group: group, Err: err}
+		} else if expected != user {
+			result.Divergences = append(result.Divergences, ReplayDivergence{Record: i + 1, Recorded: record.User, Expected: expected})
+		}
+
+		counts[user]++
+		lastIndex = record.NextIndex
+		if t, err := time.Parse(time.RFC3339, record.Timestamp); err == nil {
+			last[user] = t
+		}
+	}
+
+	result.Rebuild = rebuildFromRecords(group, groupConf, records)
+	return result, nil
+}
+
+// replaySelection returns the user the current config selects for a logged
+// assignment, given the state replayed up to it.
+func replaySelection(ctx context.Context, factory *ComponentFactory, groupConf *AssigneeGroupConfig, record history.Record, lastIndex int, counts map[string]int, last map[string]time.Time) (string, error) {
+	// Priorities the group doesn't route were once assigned from the whole group
+	priority := record.Metadata["priority"]
+	if _, ok := groupConf.Priorities[priority]; !ok {
+		priority = ""
+	}
+	rt, err := routeAssignment(groupConf, priority)
+	if err != nil {
+		return "", err
+	}
+	// Assignments made with a strategy override are replayed with it
+	if record.Metadata["overridden_strategy"] != "" {
+		rt.strategy = record.Strategy
+	}
+	strategy, err := factory.CreateAssignmentStrategy(rt.strategy, groupConf.StrategyOptions)
+	if err != nil {
+		return "", err
+	}
+	setLastAssigned(strategy, last)
+	index, err := strategy.SelectNext(ctx, rt.users, rt.localIndex(lastIndex), counts)
+	if err != nil {
+		return "", err
+	}
+	return rt.users[index], nil
+}
+
+// ApplyReplay writes the replayed counts and last index of a group and makes
+// the replayed log its assignment log, under the lock of the group. Either
+// all changes are made or none.
+func ApplyReplay(ctx context.Context, r *ReplayResult) error {
+	group := r.Rebuild.Group
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	// The state replaced is the one read under the lock
+	r.Rebuild.CurrentCounts = readCounts(group)
+	r.Rebuild.CurrentIndex = readLastIndex(group)
+
+	tx, err := beginFileTransaction(group)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		if err := applyRebuild(r.Rebuild); err != nil {
+			return err
+		}
+		groupDir, err := config.GetGroupDataDir(group)
+		if err != nil {
+			return fmt.Errorf("failed to get group data directory: %w", err)
+		}
+		target := filepath.Join(groupDir, "assignments.log")
+		if same, _ := sameFile(r.LogPath, target); same {
+			return nil
+		}
+		// Replaced last and atomically, since rolling back the append-only log
+		// only truncates it to its original size
+		data, err := os.ReadFile(r.LogPath)
+		if err != nil {
+			return fmt.Errorf("failed to read assignment log: %w", err)
+		}
+		return writeFileAtomic(target, data)
+	}()
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if err := syncSharedState(group, r.Rebuild.edit()); err != nil {
+		return err
+	}
+	recordStateChange(fmt.Sprintf("Replay assignment log of %s", group))
+	return nil
+}
+
+// sameFile reports whether two paths refer to the same existing file.
+func sameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
@@ -0,0 +1,291 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultReservationTTL is how long a reservation is held when no TTL is given.
+const DefaultReservationTTL = 5 * time.Minute
+
+// Reservation holds the next assignee of a group until the caller commits
+// the assignment, once it has been made in the external system, or releases it.
+// Reserved users are not selected by other reservations or assignments of the
+// group, but the rotation and counts only change when the reservation is committed.
+type Reservation struct {
+	ID           string            `json:"id"`                                        // Becomes the ID of the assignment when committed
+	Group        string            `json:"group"`                                     // Group the user was reserved in
+	User         string            `json:"user"`                                      // Reserved user; empty when deferred
+	Priority     string            `json:"priority,omitempty"`                        // Priority the user was selected for
+	Strategy     string            `json:"strategy"`                                  // Strategy that selected the user
+	Overridden   string            `json:"overridden_strategy,omitempty"`             // Strategy of the group replaced by AssignOptions.Strategy
+	Checker      string            `json:"overridden_availability_checker,omitempty"` // Availability checker of the group replaced by AssignOptions.Availability
+	CheckedWith  string            `json:"checked_with,omitempty"`                    // Availability checker replacing it, named in the skips logged when committed
+	Index        int               `json:"index"`                                     // Position of the user in the group, stored as the last index when committed
+	OutOfTurn    bool              `json:"out_of_turn,omitempty"`                     // Committing leaves the rotation where it is
+	Skipped      []string          `json:"skipped,omitempty"`                         // Users passed over as unavailable, logged when committed
+	CheckFailed  []string          `json:"check_failed,omitempty"`                    // Users of Skipped whose availability check failed
+	Limited      map[string]string `json:"limited,omitempty"`                         // Users of Skipped who reached a limit, with the skip reason
+	CheckMs      int64             `json:"availability_check_ms"`                     // Duration of the availability checks
+	Reason       string            `json:"reason,omitempty"`                          // Why the user was selected, e.g. "round_robin next"
+	CallbackData map[string]string `json:"callback_data,omitempty"`                   // Passed to the group's callback when committed
+	ReservedAt   string            `json:"reserved_at"`                               // Time of the reservation in RFC 3339 format
+	ExpiresAt    string            `json:"expires_at"`                                // Time the reservation lapses in RFC 3339 format
+	Deferred     string            `json:"-"`                                         // End of the quiet hours when nobody could be reserved; nothing is held then
+}
+
+// expired reports whether the reservation has lapsed at the given time.
+func (r Reservation) expired(now time.Time) bool {
+	expires, err := time.Parse(time.RFC3339, r.ExpiresAt)
+	return err != nil || !now.Before(expires)
+}
+
+// Reserve selects the next available user of a group and holds them for ttl
+// without changing the rotation or counts. Users with an active reservation
+// in the group are not selected again. During quiet hours nothing is reserved
+// and the returned reservation only reports when they end.
+func Reserve(ctx context.Context, group string, ttl time.Duration, opts AssignOptions) (*Reservation, error) {
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+	factory := newStateFactory()
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	opts.DryRun = false
+	opts.NoQueue = true
+	sel, err := selectAssignee(ctx, factory, group, opts)
+	if err != nil {
+		return nil, err
+	}
+	if sel.deferred != "" {
+		return &Reservation{Group: group, Deferred: sel.deferred}, nil
+	}
+
+	now := timeNow()
+	id := opts.ID
+	if id == "" {
+		id = newAssignmentID()
+	}
+	r := Reservation{
+		ID:           id,
+		Group:        group,
+		User:         sel.user,
+		Priority:     opts.Priority,
+		Strategy:     sel.strategy,
+		Overridden:   sel.overridden,
+		Index:        sel.index,
+		OutOfTurn:    sel.outOfTurn,
+		Skipped:      sel.skipped,
+		CheckFailed:  sel.failed,
+		Limited:      sel.limited,
+		CheckMs:      sel.checkMs,
+		Reason:       sel.reason,
+		CallbackData: opts.CallbackData,
+		ReservedAt:   now.Format(time.RFC3339),
+		ExpiresAt:    now.Add(ttl).Format(time.RFC3339),
+	}
+	if sel.checker != "" {
+		r.Checker, r.CheckedWith = sel.checker, sel.conf.AvailabilityChecker
+	}
+	reservations, err := readReservations(group)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeReservations(group, append(reservations, r)); err != nil {
+		return nil, err
+	}
+	recordStateChange(fmt.Sprintf("Reserve %s in %s", r.User, group))
+	return &r, nil
+}
+
+// CommitReservation records a reservation as an assignment: the rotation,
+// counts and logs are updated as by Assign, and the group's callback runs.
+// The assignment has the ID of the reservation.
+func CommitReservation(ctx context.Context, group, id string) (*AssignResult, error) {
+	factory := newStateFactory()
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	r, err := findReservation(group, id)
+	if err != nil {
+		return nil, err
+	}
+	groupConf, err := factory.GetConfigLoader().LoadConfig(group)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	if groupConf.disabled() {
+		return nil, &GroupDisabledError{Group: group}
+	}
+	if r.Checker != "" {
+		groupConf = groupConf.clone()
+		groupConf.AvailabilityChecker = r.CheckedWith
+	}
+	sel := &selection{
+		group:      group,
+		conf:       groupConf,
+		strategy:   r.Strategy,
+		overridden: r.Overridden,
+		checker:    r.Checker,
+		user:       r.User,
+		index:      r.Index,
+		outOfTurn:  r.OutOfTurn,
+		skipped:    r.Skipped,
+		failed:     r.CheckFailed,
+		limited:    r.Limited,
+		checkMs:    r.CheckMs,
+		reason:     r.Reason,
+	}
+	if err := recordAssignment(ctx, factory, sel, r.ID, r.Priority, r.CallbackData, r.ID); err != nil {
+		return nil, err
+	}
+	return &AssignResult{User: r.User, ID: r.ID, Reason: r.Reason}, nil
+}
+
+// ReleaseReservation gives up a reservation without assigning anybody.
+func ReleaseReservation(ctx context.Context, group, id string) (*Reservation, error) {
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	r, err := findReservation(group, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := dropReservation(group, id); err != nil {
+		return nil, err
+	}
+	recordStateChange(fmt.Sprintf("Release reservation %s in %s", id, group))
+	return r, nil
+}
+
+// Reservations returns the active reservations of a group, oldest first.
+func Reservations(group string) ([]Reservation, error) {
+	if _, err := loadAssigneeGroupConfig(group); err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	return readReservations(group)
+}
+
+// newStateFactory returns a component factory using the configured state backend.
+func newStateFactory() *ComponentFactory {
+	storage, counts := newStateBackend()
+	return NewComponentFactory(&DefaultConfigLoader{}, storage, counts, &DefaultAssignmentLogger{})
+}
+
+// findReservation returns the active reservation with the given ID.
+func findReservation(group, id string) (*Reservation, error) {
+	if _, err := loadAssigneeGroupConfig(group); err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	reservations, err := readReservations(group)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reservations {
+		if r.ID == id {
+			return &r, nil
+		}
+	}
+	return nil, &ReservationNotFoundError{Group: group, ID: id}
+}
+
+// reservedUsers returns the users held by reservations.
+func reservedUsers(reservations []Reservation) []string {
+	users := make([]string, 0, len(reservations))
+	for _, r := range reservations {
+		users = append(users, r.User)
+	}
+	return users
+}
+
+// dropReservation removes a reservation from a group's reservations.
+func dropReservation(group, id string) error {
+	reservations, err := readReservations(group)
+	if err != nil {
+		return err
+	}
+	for i, r := range reservations {
+		if r.ID == id {
+			return writeReservations(group, append(reservations[:i:i], reservations[i+1:]...))
+		}
+	}
+	return nil
+}
+
+// readReservations reads reservations.json of a group, leaving out expired
+// reservations. A missing file is treated as empty.
+func readReservations(group string) ([]Reservation, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(groupDir, "reservations.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read reservations: %w", err)
+	}
+
+	var stored []Reservation
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse reservations: %w", err)
+	}
+	now := timeNow()
+	var active []Reservation
+	for _, r := range stored {
+		if !r.expired(now) {
+			active = append(active, r)
+		}
+	}
+	return active, nil
+}
+
+// writeReservations replaces reservations.json of a group.
+func writeReservations(group string, reservations []Reservation) error {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	if reservations == nil {
+		reservations = []Reservation{}
+	}
+	data, err := json.MarshalIndent(reservations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal reservations: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(groupDir, "reservations.json"), data); err != nil {
+		return fmt.Errorf("failed to write reservations: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// historyArchiveDir is the directory of the archive that pruned log records are moved to.
+const historyArchiveDir = "history"
+
+// historyRetention returns the age after which the log records of the group
+// are pruned: its history_retention, or maintenance.history_retention of
+// the config. Records are kept forever when it is zero.
+func (c *AssigneeGroupConfig) historyRetention() (time.Duration, error) {
+	retention := c.HistoryRetention
+	if retention == "" {
+		retention = config.Settings.Maintenance.HistoryRetention
+	}
+	if retention == "" || retention == "forever" {
+		return 0, nil
+	}
+	d, err := history.ParseWindow(retention)
+	if err != nil {
+		return 0, fmt.Errorf("invalid history_retention %q, want an age such as 365d or forever", retention)
+	}
+	return d, nil
+}
+
+// MaintainOptions controls Maintain.
+type MaintainOptions struct {
+	Archive bool // Move pruned records to <data_dir>/.archive/history/ instead of deleting them
+	DryRun  bool // Count the records that would be pruned without changing anything
+}
+
+// Maintenance describes the records of a group pruned by Maintain.
+type Maintenance struct {
+	Group   string         `json:"group"`
+	Before  string         `json:"before"`            // Time records were pruned before, in RFC 3339 format
+	Pruned  map[string]int `json:"pruned"`            // Records pruned per log
+	Archive string         `json:"archive,omitempty"` // Directory the pruned records were moved to
+}
+
+// Maintain prunes the records older than the history retention of every
+// group from its assignment, skip, decline and duration logs. Counts are
+// kept: the pruned assignments are recorded per day in pruned.json, which
+// RebuildCounts and CheckGroup add to the log, and the state shared
+// through Consul or DynamoDB holds only counts. The S3 mirror of the data
+// directory is updated, and archived records are written to its bucket too.
+//
+// It returns the groups records were pruned from; groups that failed are
+// joined in the error and don't keep the others from being maintained.
+func Maintain(ctx context.Context, now time.Time, opts MaintainOptions) ([]Maintenance, error) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	var maintained []Maintenance
+	var errs []error
+	for _, group := range groups {
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil {
+			errs = append(errs, &ConfigError{Group: group, Err: err})
+			continue
+		}
+		retention, err := groupConf.historyRetention()
+		if err != nil {
+			errs = append(errs, &ConfigError{Group: group, Err: err})
+			continue
+		}
+		if retention == 0 {
+			continue
+		}
+		m, err := pruneHistory(ctx, group, groupConf, now.Add(-retention), now, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to prune the history of %s: %w", group, err))
+			continue
+		}
+		if m != nil {
+			maintained = append(maintained, *m)
+		}
+	}
+	return maintained, errors.Join(errs...)
+}
+
+// pruneHistory prunes the log records of a group from before cutoff. It
+// returns nil when there were none.
+func pruneHistory(ctx context.Context, group string, groupConf *AssigneeGroupConfig, cutoff, now time.Time, opts MaintainOptions) (*Maintenance, error) {
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	loc, err := groupConf.location()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	pruned, err := readPrunedCounts(group)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Maintenance{Group: group, Before: cutoff.Format(time.RFC3339), Pruned: map[string]int{}}
+	// Archives of a run share its time, so runs never overwrite each other
+	archive := path.Join(archiveDirName, historyArchiveDir, group)
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, name := range userLogs {
+		logPath := filepath.Join(groupDir, name)
+		records, err := readLogRecords(logPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		var kept, old bytes.Buffer
+		for _, record := range records {
+			line, err := json.Marshal(record)
+			if err != nil {
+				return nil, err
+			}
+			var timestamp string
+			json.Unmarshal(record["timestamp"], &timestamp)
+			// Records without a valid timestamp are kept, like they are counted in the base
+			t, err := time.Parse(time.RFC3339, timestamp)
+			if err != nil || !t.Before(cutoff) {
+				kept.Write(line)
+				kept.WriteByte('\n')
+				continue
+			}
+			old.Write(line)
+			old.WriteByte('\n')
+			m.Pruned[name]++
+			if name == "assignments.log" {
+				var user string
+				json.Unmarshal(record["user"], &user)
+				pruned.increment(user, t.In(loc))
+			}
+		}
+		if m.Pruned[name] == 0 || opts.DryRun {
+			continue
+		}
+
+		if opts.Archive {
+			archived := path.Join(archive, strings.TrimSuffix(name, ".log")+"-"+stamp+".log")
+			file := filepath.Join(config.Settings.Storage.DataDir, filepath.FromSlash(archived))
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create archive directory: %w", err)
+			}
+			if err := writeFileAtomic(file, old.Bytes()); err != nil {
+				return nil, fmt.Errorf("failed to archive %s: %w", name, err)
+			}
+			if err := archiveObject(ctx, archived, old.Bytes()); err != nil {
+				return nil, err
+			}
+			m.Archive = filepath.Dir(file)
+		}
+		if name == "assignments.log" {
+			// Written first, so the counts of pruned records are never lost
+			if err := writePrunedCounts(group, pruned); err != nil {
+				return nil, err
+			}
+		}
+		if err := writeFileAtomic(logPath, kept.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	if len(m.Pruned) == 0 {
+		return nil, nil
+	}
+	if opts.DryRun {
+		return m, nil
+	}
+
+	if err := pushState(ctx, group); err != nil {
+		return nil, err
+	}
+	recordStateChange(fmt.Sprintf("Prune the history of %s before %s", group, m.Before))
+	return m, nil
+}
+
+// addPruned adds the counts of the records pruned from the log to the
+// rebuilt counts. The last index is kept when every record was pruned.
+func (r *CountsRebuild) addPruned(groupConf *AssigneeGroupConfig, pruned *countBuckets) {
+	if r.LogRecordCount == 0 && len(pruned.totals()) > 0 {
+		r.RebuiltIndex = r.CurrentIndex
+	}
+	for user, count := range pruned.Base {
+		r.RebuiltCounts[groupConf.canonicalUser(user)] += count
+	}
+	for date, day := range pruned.Days {
+		for user, count := range day {
+			user = groupConf.canonicalUser(user)
+			r.RebuiltCounts[user] += count
+			if r.rebuiltDays[date] == nil {
+				r.rebuiltDays[date] = make(map[string]int)
+			}
+			r.rebuiltDays[date][user] += count
+		}
+	}
+}
+
+// prunedCountsPath returns the path of the counts of the assignments pruned from the log of a group.
+func prunedCountsPath(group string) (string, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return "", fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	return filepath.Join(groupDir, "pruned.json"), nil
+}
+
+// readPrunedCounts reads the counts of the assignments pruned from the log
+// of a group, per day and user. A group without pruned records has none.
+func readPrunedCounts(group string) (*countBuckets, error) {
+	file, err := prunedCountsPath(group)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newCountBuckets(), nil
+		}
+		return nil, fmt.Errorf("failed to read pruned counts: %w", err)
+	}
+	b, err := parseCountBuckets(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pruned counts: %w", err)
+	}
+	return b, nil
+}
+
+// writePrunedCounts replaces the counts of the assignments pruned from the log of a group.
+func writePrunedCounts(group string, b *countBuckets) error {
+	file, err := prunedCountsPath(group)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pruned counts: %w", err)
+	}
+	if err := writeFileAtomic(file, data); err != nil {
+		return fmt.Errorf("failed to write pruned counts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package runner
+
+import (
+	"autoassigner/l10n"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Role is a sub-pool of a group that multi-role assignments select from,
+// for example the members doing QA:
+//
+//	roles:
+//	  reviewer: {users: [alice, bob, carol]}
+//	  qa: {tags: [qa]}
+//
+// Members listed in users and members with any of the tags are eligible.
+// A role without users and tags selects from the whole group.
+type Role struct {
+	Users []string `yaml:"users"` // Members eligible for the role
+	Tags  []string `yaml:"tags"`  // Members with any of these tags are eligible as well
+}
+
+// RoleRequest asks for a number of users in one role.
+type RoleRequest struct {
+	Role  string
+	Count int
+}
+
+// RoleSelection is a user selected for a role of a multi-role assignment.
+type RoleSelection struct {
+	Role   string          `json:"role"`
+	User   string          `json:"user"`
+	Reason string          `json:"reason,omitempty"` // Why the user was selected, e.g. "least_assigned count=3"
+	Trace  *SelectionTrace `json:"trace,omitempty"`  // How the user was selected, with AssignOptions.Explain or a callback with trace
+}
+
+// RolesResult describes the outcome of a multi-role assignment.
+type RolesResult struct {
+	ID         string          `json:"id,omitempty"`         // ID shared by the logged selections; empty for dry runs and deferred assignments
+	Selections []RoleSelection `json:"selections,omitempty"` // Selected users in the order of the requests
+	Deferred   string          `json:"deferred,omitempty"`   // End of the quiet hours when nobody was selected, in RFC 3339 format
+}
+
+// ParseRoleRequests parses role requests written as "reviewer:2,qa:1".
+// A role without a count asks for one user.
+func ParseRoleRequests(s string) ([]RoleRequest, error) {
+	var requests []RoleRequest
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, count, hasCount := strings.Cut(part, ":")
+		req := RoleRequest{Role: strings.TrimSpace(name), Count: 1}
+		if hasCount {
+			n, err := strconv.Atoi(strings.TrimSpace(count))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid count %q for role %s", count, req.Role)
+			}
+			req.Count = n
+		}
+		if req.Role == "" {
+			return nil, fmt.Errorf("invalid role request %q", part)
+		}
+		if seen[req.Role] {
+			return nil, fmt.Errorf("role %s is requested more than once", req.Role)
+		}
+		seen[req.Role] = true
+		requests = append(requests, req)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no roles requested")
+	}
+	return requests, nil
+}
+
+// AssignRoles selects users for several roles of a group in one assignment,
+// for example two reviewers and one QA engineer. Nobody is selected twice.
+// The selections are made one after another, each advancing the rotation and
+// counts like a single assignment, and are logged under one assignment ID
+// with their role. If any role can't be filled nothing is recorded.
+// During quiet hours nothing is selected and the result reports when they end.
+func AssignRoles(ctx context.Context, group string, requests []RoleRequest, opts AssignOptions) (*RolesResult, error) {
+	factory := newStateFactory()
+	if !opts.DryRun {
+		release, err := lockGroup(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := release(); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}()
+	}
+	return assignRoles(ctx, factory, group, requests, opts)
+}
+
+// assignRoles performs a multi-role assignment using the components of the given factory.
+func assignRoles(ctx context.Context, factory *ComponentFactory, group string, requests []RoleRequest, opts AssignOptions) (*RolesResult, error) {
+	groupConf, err := factory.GetConfigLoader().LoadConfig(group)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &InvalidGroupError{Group: group}
+		}
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	pools := make([][]string, len(requests))
+	for i, req := range requests {
+		if pools[i], err = groupConf.rolePool(req.Role); err != nil {
+			return nil, &ConfigError{Group: group, Err: err}
+		}
+	}
+
+	// Repeating a request with the same ID returns the logged selections
+	if opts.ID != "" && !opts.DryRun {
+		logged, err := loggedAssignment(group, opts.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(logged) > 0 {
+			result := &RolesResult{ID: opts.ID}
+			for _, record := range logged {
+				result.Selections = append(result.Selections, RoleSelection{Role: record.Role, User: record.User})
+				fmt.Println(l10n.T(l10n.MsgAssignedRole, "User", record.User, "Role", record.Role))
+			}
+			return result, nil
+		}
+	}
+
+	var tx StateTransaction
+	result := &RolesResult{}
+	if !opts.DryRun {
+		if tx, err = factory.GetStorageManager().BeginTransaction(ctx, group); err != nil {
+			return nil, fmt.Errorf("failed to begin state transaction: %w", err)
+		}
+		result.ID = opts.ID
+		if result.ID == "" {
+			result.ID = newAssignmentID()
+		}
+	}
+	fail := func(err error) (*RolesResult, error) {
+		if tx != nil {
+			return nil, rollbackWith(tx, err)
+		}
+		return nil, err
+	}
+
+	// Quiet hours apply to the whole assignment, so the first selection reports them
+	roleOpts := opts
+	roleOpts.NoQueue = true
+	roleOpts.Exclude = append([]string(nil), opts.Exclude...)
+	var written []assignmentChanges
+	for i, req := range requests {
+		roleOpts.Eligible = intersectUsers(groupConf, pools[i], opts.Eligible)
+		if len(roleOpts.Eligible) == 0 {
+			return fail(&NoAvailableAssigneeError{Group: group})
+		}
+		for n := 0; n < req.Count; n++ {
+			sel, err := selectAssignee(ctx, factory, group, roleOpts)
+			if err != nil {
+				return fail(err)
+			}
+			if sel.deferred != "" {
+				if tx != nil {
+					if err := tx.Rollback(); err != nil {
+						return nil, err
+					}
+				}
+				return &RolesResult{Deferred: sel.deferred}, nil
+			}
+			result.Selections = append(result.Selections, RoleSelection{Role: req.Role, User: sel.user, Reason: sel.reason, Trace: sel.trace})
+			roleOpts.Exclude = append(roleOpts.Exclude, sel.user)
+			if opts.DryRun {
+				continue
+			}
+
+			changes, err := prepareAssignment(ctx, factory, sel, result.ID, opts.Priority, opts.CallbackData)
+			if err != nil {
+				return fail(err)
+			}
+			changes.entry.Role = req.Role
+			if err := writeAssignment(ctx, factory, changes); err != nil {
+				return fail(err)
+			}
+			written = append(written, changes)
+		}
+	}
+
+	if !opts.DryRun {
+		if err := finishAssignment(ctx, tx, written...); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range result.Selections {
+		if opts.DryRun {
+			fmt.Println(l10n.T(l10n.MsgDryRunAssignedRole, "User", s.User, "Role", s.Role))
+		} else {
+			fmt.Println(l10n.T(l10n.MsgAssignedRole, "User", s.User, "Role", s.Role))
+		}
+	}
+	return result, nil
+}
+
+// rolePool returns the members eligible for a role, in group order.
+func (c *AssigneeGroupConfig) rolePool(name string) ([]string, error) {
+	role, ok := c.Roles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown role %s", name)
+	}
+	if len(role.Users) == 0 && len(role.Tags) == 0 {
+		return append([]string(nil), c.Users...), nil
+	}
+
+	listed := make(map[string]bool, len(role.Users))
+	for _, user := range role.Users {
+		listed[c.canonicalUser(user)] = true
+	}
+	tagged := make(map[string]bool, len(role.Tags))
+	for _, tag := range role.Tags {
+		tagged[tag] = true
+	}
+	var pool []string
+	for _, user := range c.Users {
+		eligible := listed[user]
+		delete(listed, user)
+		for _, tag := range c.Tags[user] {
+			eligible = eligible || tagged[tag]
+		}
+		if eligible {
+			pool = append(pool, user)
+		}
+	}
+	for _, user := range role.Users {
+		if listed[c.canonicalUser(user)] {
+			return nil, fmt.Errorf("role %s lists %s, who is not a member of the group", name, user)
+		}
+	}
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("no users found for role %s", name)
+	}
+	return pool, nil
+}
+
+// intersectUsers returns the users of pool that are also in eligible, or
+// pool itself when eligible is empty. Names in eligible may be aliases.
+func intersectUsers(c *AssigneeGroupConfig, pool, eligible []string) []string {
+	if len(eligible) == 0 {
+		return pool
+	}
+	allowed := make(map[string]bool, len(eligible))
+	for _, name := range eligible {
+		allowed[c.canonicalUser(name)] = true
+	}
+	var users []string
+	for _, user := range pool {
+		if allowed[user] {
+			users = append(users, user)
+		}
+	}
+	return users
+}
@@ -0,0 +1,266 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Periods of a rotation, the values of Rotation.Period.
+const (
+	RotationDay  = "day"
+	RotationWeek = "week"
+)
+
+// rotationStartLayout is the layout of Rotation.Start.
+const rotationStartLayout = "2006-01-02 15:04"
+
+// Rotation hands a duty, such as support engineer of the week, to the
+// members of a group in turns of a day or a week, in config order:
+//
+//	rotation:
+//	  period: week
+//	  start: 2024-05-20 09:00
+//	  title: support engineer
+//	  remind_hours: 24
+//
+// Turns don't change how assignments are made. ProjectRotation lists the
+// upcoming ones, and reminders.notifiers announce them remind_hours before
+// they start. A member paused at the start of their turn passes it to the
+// next member.
+type Rotation struct {
+	Period      string `yaml:"period" jsonschema:"enum=day|week"` // Length of a turn (default week)
+	Start       string `yaml:"start"`                             // Start of the first turn as YYYY-MM-DD HH:MM in the group's time zone; later turns start at the same time of day. No rotation when empty
+	Title       string `yaml:"title"`                             // Duty of the member on turn, named in reminders, e.g. support engineer
+	RemindHours int    `yaml:"remind_hours"`                      // Hours before their turn members are reminded; no reminders when 0
+}
+
+// enabled reports whether the group has a rotation.
+func (r Rotation) enabled() bool {
+	return r.Start != ""
+}
+
+// schedule returns the start of the first turn in loc and the days a turn lasts.
+func (r Rotation) schedule(loc *time.Location) (time.Time, int, error) {
+	days := 7
+	switch r.Period {
+	case "", RotationWeek:
+	case RotationDay:
+		days = 1
+	default:
+		return time.Time{}, 0, fmt.Errorf("unknown rotation period %q, want day or week", r.Period)
+	}
+	start, err := time.ParseInLocation(rotationStartLayout, r.Start, loc)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid rotation start %q, want YYYY-MM-DD HH:MM", r.Start)
+	}
+	if r.RemindHours < 0 {
+		return time.Time{}, 0, fmt.Errorf("rotation remind_hours must not be negative")
+	}
+	return start, days, nil
+}
+
+// RotationTurn is a turn of the rotation of a group.
+type RotationTurn struct {
+	Group   string    `json:"group"`
+	Turn    int       `json:"turn"`              // Number of the turn, counted from the first at 0
+	User    string    `json:"user"`              // Member on turn; empty when every member is paused
+	Start   time.Time `json:"start"`             // Start of the turn in the group's time zone
+	End     time.Time `json:"end"`               // End of the turn, the start of the next
+	Skipped []string  `json:"skipped,omitempty"` // Members whose turn it was, passed on as they are paused at its start
+	Title   string    `json:"title,omitempty"`   // Duty of the member on turn
+	Period  string    `json:"period"`            // day or week
+}
+
+// Reminder returns the message reminding the member on turn of it, e.g.
+// "alice, you're support engineer of team-alpha for the week starting Mon, May 20 09:00 CEST".
+func (t RotationTurn) Reminder() string {
+	duty := "on duty for"
+	if t.Title != "" {
+		duty = t.Title + " of"
+	}
+	msg := fmt.Sprintf("%s, you're %s %s for the %s starting %s", t.User, duty, t.Group, t.Period, t.Start.Format("Mon, Jan 2 15:04 MST"))
+	if len(t.Skipped) == 1 {
+		msg += fmt.Sprintf(", in place of %s, who is paused", t.Skipped[0])
+	} else if len(t.Skipped) > 1 {
+		msg += fmt.Sprintf(", in place of %d paused members", len(t.Skipped))
+	}
+	return msg
+}
+
+// ProjectRotation returns the turn of the rotation of a group in progress
+// at from, or its first turn when it hasn't started, and the turns after
+// it, in all the given number of turns. Turns are projected with the
+// pauses recorded now, including scheduled ones.
+func ProjectRotation(group string, from time.Time, turns int) ([]RotationTurn, error) {
+	if turns <= 0 {
+		return nil, fmt.Errorf("number of turns must be positive")
+	}
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, err
+	}
+	rotation := groupConf.Rotation
+	if !rotation.enabled() {
+		return nil, &ConfigError{Group: group, Err: fmt.Errorf("no rotation")}
+	}
+	if len(groupConf.Users) == 0 {
+		return nil, &ConfigError{Group: group, Err: fmt.Errorf("no users found")}
+	}
+	loc, err := groupConf.location()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	start, days, err := rotation.schedule(loc)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	pauses, err := readPauses()
+	if err != nil {
+		return nil, err
+	}
+	period := RotationWeek
+	if days == 1 {
+		period = RotationDay
+	}
+
+	turnStart := func(k int) time.Time { return start.AddDate(0, 0, k*days) }
+	// Guess the turn in progress from the elapsed time, then correct the
+	// guess for days that aren't 24 hours long
+	first := 0
+	if from.After(start) {
+		first = int(from.Sub(start).Hours() / float64(24*days))
+		for !turnStart(first + 1).After(from) {
+			first++
+		}
+		for first > 0 && turnStart(first).After(from) {
+			first--
+		}
+	}
+	projected := make([]RotationTurn, 0, turns)
+	for k := first; k < first+turns; k++ {
+		turn := RotationTurn{Group: group, Turn: k, Start: turnStart(k), End: turnStart(k + 1), Title: rotation.Title, Period: period}
+		for i := 0; i < len(groupConf.Users); i++ {
+			user := groupConf.Users[(k+i)%len(groupConf.Users)]
+			if pausedAt(pauses, groupConf, user, turn.Start) {
+				turn.Skipped = append(turn.Skipped, user)
+				continue
+			}
+			turn.User = user
+			break
+		}
+		projected = append(projected, turn)
+	}
+	return projected, nil
+}
+
+// pausedAt reports whether a pause of user, or of one of their aliases, covers t.
+func pausedAt(pauses []Pause, groupConf *AssigneeGroupConfig, user string, t time.Time) bool {
+	for _, p := range pauses {
+		if groupConf.canonicalUser(p.User) == user && p.Started(t) && p.until().After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// DueReminders returns the turns of the rotations of every group whose
+// reminder is due at now: turns starting within remind_hours that nobody
+// was reminded of yet. Call MarkReminded once a reminder was sent, so it
+// isn't due again. Groups whose config can't be loaded are left out; their
+// problems are reported by ValidateGroup.
+func DueReminders(now time.Time) ([]RotationTurn, error) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	reminded, err := readReminders()
+	if err != nil {
+		return nil, err
+	}
+	var due []RotationTurn
+	for _, group := range groups {
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil || !groupConf.Rotation.enabled() || groupConf.Rotation.RemindHours <= 0 {
+			continue
+		}
+		horizon := now.Add(time.Duration(groupConf.Rotation.RemindHours) * time.Hour)
+		turns, err := ProjectRotation(group, now, 2+groupConf.Rotation.RemindHours/24)
+		if err != nil {
+			continue
+		}
+		last, _ := time.Parse(time.RFC3339, reminded[group])
+		for _, turn := range turns {
+			if turn.Start.After(now) && !turn.Start.After(horizon) && turn.Start.After(last) && turn.User != "" {
+				due = append(due, turn)
+			}
+		}
+	}
+	return due, nil
+}
+
+// remindersLockName is the lock the reminders of all groups are changed under.
+const remindersLockName = ".reminders"
+
+// MarkReminded records that the member of a turn was reminded of it, and
+// of every turn of the group before it.
+func MarkReminded(ctx context.Context, turn RotationTurn) error {
+	release, err := takeLock(ctx, remindersLockName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	reminded, err := readReminders()
+	if err != nil {
+		return err
+	}
+	last, _ := time.Parse(time.RFC3339, reminded[turn.Group])
+	if !turn.Start.After(last) {
+		return nil
+	}
+	reminded[turn.Group] = turn.Start.Format(time.RFC3339)
+	data, err := json.MarshalIndent(reminded, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal reminders: %w", err)
+	}
+	if err := os.MkdirAll(config.Settings.Storage.DataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := writeFileAtomic(remindersPath(), data); err != nil {
+		return fmt.Errorf("failed to write reminders: %w", err)
+	}
+	return nil
+}
+
+// remindersPath returns the path of the starts of the last turns reminded
+// of, keyed by group.
+func remindersPath() string {
+	return filepath.Join(config.Settings.Storage.DataDir, "reminders.json")
+}
+
+// readReminders reads the starts of the last turns reminded of by group.
+// A missing file is treated as empty.
+func readReminders() (map[string]string, error) {
+	reminded := map[string]string{}
+	data, err := os.ReadFile(remindersPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reminded, nil
+		}
+		return nil, fmt.Errorf("failed to read reminders: %w", err)
+	}
+	if err := json.Unmarshal(data, &reminded); err != nil {
+		return nil, fmt.Errorf("failed to parse reminders: %w", err)
+	}
+	return reminded, nil
+}
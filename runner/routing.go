@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PriorityRoute narrows a group for assignments of one priority,
+// for example to let only senior members handle P1 incidents.
+type PriorityRoute struct {
+	Users    []string      `yaml:"users"`    // Group members eligible for the priority; every member when empty
+	Strategy StrategyChain `yaml:"strategy"` // Strategy or chain of strategies replacing the group's for the priority
+}
+
+// route is the set of users and the strategy an assignment is made with.
+// groupIndex maps each routed user back to their index in the group,
+// which is what the index log stores.
+type route struct {
+	users      []string
+	groupIndex []int
+	strategy   string
+}
+
+// routeAssignment applies the group's route for priority. The empty
+// priority uses the whole group, as does any priority of a group without
+// priorities; other priorities the group doesn't route are invalid options.
+// Routed users keep their order from the group, so round robin rotates
+// through them in the same order as through the group.
+func routeAssignment(groupConf *AssigneeGroupConfig, priority string) (*route, error) {
+	r := &route{strategy: string(groupConf.Strategy)}
+	pr, ok := groupConf.Priorities[priority]
+	if !ok && priority != "" && len(groupConf.Priorities) > 0 {
+		valid := make([]string, 0, len(groupConf.Priorities))
+		for name := range groupConf.Priorities {
+			valid = append(valid, name)
+		}
+		sort.Strings(valid)
+		return nil, &InvalidOptionError{Option: "priority", Value: priority, Err: fmt.Errorf("expected one of %s", strings.Join(valid, ", "))}
+	}
+	if !ok {
+		r.users = groupConf.Users
+		for i := range groupConf.Users {
+			r.groupIndex = append(r.groupIndex, i)
+		}
+		return r, nil
+	}
+
+	if pr.Strategy != "" {
+		r.strategy = string(pr.Strategy)
+	}
+	eligible := make(map[string]bool, len(pr.Users))
+	for _, user := range pr.Users {
+		eligible[user] = true
+	}
+	for i, user := range groupConf.Users {
+		if len(pr.Users) == 0 || eligible[user] {
+			r.users = append(r.users, user)
+			r.groupIndex = append(r.groupIndex, i)
+			delete(eligible, user)
+		}
+	}
+	for _, user := range pr.Users {
+		if eligible[user] {
+			return nil, fmt.Errorf("priority %s routes to %s, who is not a member of the group", priority, user)
+		}
+	}
+	if len(r.users) == 0 {
+		return nil, fmt.Errorf("no users found for priority %s", priority)
+	}
+	return r, nil
+}
+
+// override replaces the strategy of the route with strategy, unless it is
+// empty, and returns the strategy it replaced; empty when it is the same.
+// strategy may be a comma-separated chain.
+func (r *route) override(strategy string) (string, error) {
+	if strategy == "" || strategy == r.strategy {
+		return "", nil
+	}
+	for _, name := range strategyNames(strategy) {
+		known := false
+		for _, n := range StrategyNames {
+			known = known || n == name
+		}
+		if !known {
+			return "", &InvalidOptionError{Option: "strategy", Value: strategy, Err: fmt.Errorf("expected one of %s, or several separated by commas", strings.Join(StrategyNames, ", "))}
+		}
+	}
+	strategy = strings.Join(strategyNames(strategy), ",")
+	if strategy == r.strategy {
+		return "", nil
+	}
+	overridden := r.strategy
+	r.strategy = strategy
+	return overridden, nil
+}
+
+// localIndex converts a group index into an index into the routed users.
+// A group index of a user outside the route maps to the closest routed
+// user before it, so rotation continues after the last group assignment.
+func (r *route) localIndex(groupIndex int) int {
+	local := -1
+	for i, gi := range r.groupIndex {
+		if gi > groupIndex {
+			break
+		}
+		local = i
+	}
+	return local
+}
+
+// narrow removes the users any of filters rejects from the route and
+// returns who was removed by which filter.
+func (r *route) narrow(ctx context.Context, group string, filters []namedFilter) ([]TraceRejection, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	var users []string
+	var groupIndex []int
+	var removed []TraceRejection
+	for i, user := range r.users {
+		filter, reason, err := admit(ctx, filters, group, user)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			removed = append(removed, TraceRejection{User: user, Filter: filter, Reason: reason})
+			continue
+		}
+		users = append(users, user)
+		groupIndex = append(groupIndex, r.groupIndex[i])
+	}
+	r.users, r.groupIndex = users, groupIndex
+	return removed, nil
+}
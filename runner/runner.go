@@ -8,14 +8,23 @@ package runner
 
 import (
 	"autoassigner/config"
+	"autoassigner/history"
+	"autoassigner/l10n"
+	"autoassigner/selector"
+	"autoassigner/tracing"
+	"autoassigner/version"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -24,121 +33,657 @@ import (
 // AssigneeGroupConfig represents the configuration for a group of assignees.
 // It specifies the selection strategy, availability checker, and list of users.
 type AssigneeGroupConfig struct {
-	Strategy            string   `yaml:"strategy"`             // The strategy to use for selecting assignees
-	AvailabilityChecker string   `yaml:"availability_checker"` // The type of availability checker to use
-	Users               []string `yaml:"users"`                // List of users in the group
+	Enabled             *bool                    `yaml:"enabled"`                                                                                // Set to false to reject assignments, e.g. while a rotation is frozen (default true)
+	Strategy            StrategyChain            `yaml:"strategy" jsonschema:"required"`                                                         // The strategy to use for selecting assignees, or a list of strategies breaking each other's ties
+	AvailabilityChecker string                   `yaml:"availability_checker" jsonschema:"enum=inout|always_available|bamboohr|workday|zendesk"` // The type of availability checker to use
+	Users               UserList                 `yaml:"users" jsonschema:"required"`                                                            // List of users in the group, each a name or a name with inline settings
+	StrategyOptions     StrategyOptions          `yaml:"strategy_options"`                                                                       // Options passed to the strategy
+	DeclineBudget       DeclineBudget            `yaml:"decline_budget"`                                                                         // Limit on how often each user may decline
+	Priorities          map[string]PriorityRoute `yaml:"priorities"`                                                                             // Routes keyed by priority, e.g. P1, selected with AssignOptions.Priority
+	QuietHours          QuietHours               `yaml:"quiet_hours"`                                                                            // Window in which assignments are queued instead of made
+	Timezone            string                   `yaml:"timezone"`                                                                               // IANA time zone of the group's days, weeks and quiet hours, e.g. Europe/Berlin (default the host's)
+	TrackOpen           bool                     `yaml:"track_open"`                                                                             // Keep a ledger of assignments until they are closed
+	Aliases             map[string][]string      `yaml:"aliases"`                                                                                // Former or alternative names of users, merged when reading stored counts and logs
+	AvailabilityIDs     map[string]string        `yaml:"availability_ids"`                                                                       // Identifiers passed to the availability checker instead of the user names
+	Callback            Callback                 `yaml:"callback"`                                                                               // External program or endpoint every assignment is handed to
+	Tags                map[string][]string      `yaml:"tags"`                                                                                   // Tags of users, such as qa or backend, that roles can select by
+	Roles               map[string]Role          `yaml:"roles"`                                                                                  // Sub-pools keyed by role name, selected from with AssignRoles
+	OnAvailabilityError string                   `yaml:"on_availability_error" jsonschema:"enum=fail|assume_available|assume_unavailable"`       // What to do when an availability check fails (default fail)
+	AvailabilityBudget  string                   `yaml:"availability_budget"`                                                                    // Total time the availability checks of one assignment may take, e.g. 5s; then on_availability_error applies to the remaining users
+	AlwaysAvailable     []string                 `yaml:"always_available"`                                                                       // Users taken to be available without asking the availability checker
+	NeverAvailable      []string                 `yaml:"never_available"`                                                                        // Users taken to be unavailable without asking the availability checker, such as bot accounts
+	Limits              UserLimits               `yaml:"limits"`                                                                                 // Most assignments every user receives per day and week
+	UserLimits          map[string]UserLimits    `yaml:"user_limits"`                                                                            // Limits of single users, overriding the limits of the group
+	Fairness            Fairness                 `yaml:"fairness"`                                                                               // Guardrail against selections putting a user far above the mean of the group
+	LogSinks            []LogSink                `yaml:"log_sinks"`                                                                              // External systems every assignment is shipped to, such as syslog, Kafka or Elasticsearch
+	Webhooks            []GroupWebhook           `yaml:"webhooks"`                                                                               // Endpoints told about assignments, resets, pauses, config reloads and fallbacks, e.g. to mirror the rotation on a dashboard
+	Escalation          []EscalationStep         `yaml:"escalation"`                                                                             // Steps taken when an open assignment isn't acknowledged in time, such as notifying the team lead or reassigning it; requires track_open
+	Rotation            Rotation                 `yaml:"rotation"`                                                                               // Turns of a day or a week the members take on a duty, such as support engineer of the week, with reminders before they start
+	HistoryRetention    string                   `yaml:"history_retention"`                                                                      // Age after which log records are pruned by maintenance, e.g. 365d, overriding maintenance.history_retention of the config; "forever" keeps them
 }
 
-// AssignmentLog represents a single assignment entry in the log file.
-type AssignmentLog struct {
-	Timestamp  string `json:"timestamp"`
-	Group      string `json:"group"`
-	User       string `json:"user"`
-	Strategy   string `json:"strategy"`
-	LastIndex  int    `json:"last_index"`
-	NextIndex  int    `json:"next_index"`
-	TotalCount int    `json:"total_count"`
-	UserCount  int    `json:"user_count"`
+// StrategyOptions holds optional settings for the selection strategy.
+type StrategyOptions struct {
+	Seed     *int64 `yaml:"seed"`                                 // Seed for randomized strategies, making their selections reproducible
+	SkipDebt bool   `yaml:"skip_debt"`                            // Give users skipped as unavailable priority once they are available again
+	Workload string `yaml:"workload" jsonschema:"enum=open|jira"` // Source of the workload balanced by open_load: open (default, the open assignments) or jira
+}
+
+// AssignOptions controls a single call to AssignWithOptions.
+type AssignOptions struct {
+	ID               string            // Identifier of the assignment; a new ULID when empty. An ID already in the group's log is not assigned again
+	DryRun           bool              // Simulate the assignment without updating logs or counts
+	Seed             *int64            // Overrides the seed from the group's strategy options when set
+	Priority         string            // Selects a route from the group's priorities, e.g. "P1"
+	Strategy         string            // Replaces the strategy of the group or route for this call, e.g. "random"; see StrategyNames
+	Availability     string            // Replaces the availability checker of the group for this call, e.g. "always_available" during an outage of its backend; see AvailabilityCheckerNames
+	IgnoreQuietHours bool              // Assign immediately even during the group's quiet hours
+	RequireAllChecks bool              // Verify that the state storage accepts writes and the availability checker answers for every candidate before selecting
+	NoQueue          bool              // During quiet hours, report when they end instead of queueing the assignment
+	Exclude          []string          // Users never selected, such as the author of a pull request
+	Eligible         []string          // When not empty, only these users are selected, such as the code owners of a change
+	CallbackData     map[string]string // Passed to the group's callback, such as the ID of the ticket to assign
+	Silent           bool              // Don't print the assignee or deferral, for callers reporting the result in another format
+	Explain          bool              // Trace the selection in AssignResult.Trace, or in NoAvailableAssigneeError.Trace when nobody can be assigned
+}
+
+// AssignResult describes the outcome of an assignment.
+type AssignResult struct {
+	User     string          // The selected user; empty when the assignment was deferred
+	ID       string          // ID of the logged assignment, or of the queued one when deferred; empty for dry runs
+	Deferred string          // End of the quiet hours a deferred assignment waits for, in RFC 3339 format; empty unless deferred
+	Reason   string          // Why the user was selected, e.g. "least_assigned count=3"; empty unless a user was selected
+	Trace    *SelectionTrace // How the user was selected, with AssignOptions.Explain or a callback with trace; nil for deferred and repeated assignments
 }
 
+// AssignmentLog represents a single assignment entry in the log file.
+// The format is defined by the history package, which also provides a reader.
+type AssignmentLog = history.Record
+
 // Assign selects an available assignee from the specified group.
 // It uses the configured strategy to select a user and checks their availability.
 // If dryRun is true, it will simulate the assignment without updating any logs or counts.
 // Returns an error if no available assignee is found or if there are configuration issues.
 func Assign(group string, dryRun bool) error {
-	factory := NewComponentFactory(
-		&DefaultConfigLoader{},
-		&DefaultStorageManager{},
-		&DefaultCountManager{},
-		&DefaultAssignmentLogger{},
-	)
+	return AssignWithOptions(context.Background(), group, AssignOptions{DryRun: dryRun})
+}
+
+// AssignWithOptions is like Assign but accepts additional per-call options.
+// Cancelling ctx or reaching its deadline aborts availability checks and file operations.
+func AssignWithOptions(ctx context.Context, group string, opts AssignOptions) error {
+	_, err := AssignUser(ctx, group, opts)
+	return err
+}
+
+// AssignUser is like AssignWithOptions but also returns the outcome, for
+// callers that act on the selected user, such as the VCS integrations.
+func AssignUser(ctx context.Context, group string, opts AssignOptions) (*AssignResult, error) {
+	factory := newStateFactory()
+	if opts.DryRun {
+		return assign(ctx, factory, group, opts)
+	}
+
+	// Hold the group's lock from reading the state until it is written
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	return assign(ctx, factory, group, opts)
+}
+
+// assign performs an assignment using the components of the given factory.
+func assign(ctx context.Context, factory *ComponentFactory, group string, opts AssignOptions) (*AssignResult, error) {
+	// Repeating a request with the same ID, such as a retried webhook, returns the logged assignment
+	if opts.ID != "" && !opts.DryRun {
+		logged, err := replayedAssignment(factory, group, opts.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(logged) > 0 {
+			if !opts.Silent {
+				fmt.Println(l10n.T(l10n.MsgAssigned, "User", logged[0].User))
+			}
+			return &AssignResult{User: logged[0].User, ID: opts.ID, Reason: logged[0].Metadata["reason"]}, nil
+		}
+	}
+
+	sel, err := selectAssignee(ctx, factory, group, opts)
+	if err != nil {
+		return nil, err
+	}
+	if sel.deferred != "" {
+		return &AssignResult{ID: sel.queueID, Deferred: sel.deferred}, nil
+	}
+	if opts.DryRun {
+		if !opts.Silent {
+			fmt.Println(l10n.T(l10n.MsgDryRunAssigned, "User", sel.user))
+		}
+		return &AssignResult{User: sel.user, Reason: sel.reason, Trace: sel.trace}, nil
+	}
+
+	id := opts.ID
+	if id == "" {
+		id = newAssignmentID()
+	}
+	if err := recordAssignment(ctx, factory, sel, id, opts.Priority, opts.CallbackData, ""); err != nil {
+		return nil, err
+	}
+	if !opts.Silent {
+		fmt.Println(l10n.T(l10n.MsgAssigned, "User", sel.user))
+	}
+	return &AssignResult{User: sel.user, ID: id, Reason: sel.reason, Trace: sel.trace}, nil
+}
 
+// selection is the assignee chosen for a group, before it is recorded.
+type selection struct {
+	group      string
+	conf       *AssigneeGroupConfig
+	strategy   string            // Name of the strategy that chose the user
+	overridden string            // Strategy of the group or route replaced by AssignOptions.Strategy, empty without an override
+	checker    string            // Availability checker of the group replaced by AssignOptions.Availability, empty without an override
+	user       string            // Selected user; empty when the assignment was deferred
+	index      int               // Position of the user in the group, stored as the new last index
+	outOfTurn  bool              // The selection leaves the rotation where it was
+	reason     string            // Why the user was selected, see assignmentReason
+	skipped    []string          // Users passed over as unavailable before the user was found
+	failed     []string          // Users of skipped whose availability check failed
+	limited    map[string]string // Users of skipped with the reason the filter rejecting them gave
+	checkMs    int64             // Duration of the availability checks
+	deferred   string            // End of the quiet hours, in RFC 3339 format, when the assignment was deferred
+	queueID    string            // ID of the queued assignment when it was deferred
+	trace      *SelectionTrace   // How the user was selected, with AssignOptions.Explain
+}
+
+// replayedAssignment returns the log records of an assignment of a group
+// with the given ID, or nil when there is none or the group doesn't exist.
+func replayedAssignment(factory *ComponentFactory, group, id string) ([]AssignmentLog, error) {
+	if _, err := factory.GetConfigLoader().LoadConfig(group); err != nil {
+		// The selection reports the missing or invalid group
+		return nil, nil
+	}
+	return loggedAssignment(group, id)
+}
+
+// selectAssignee chooses the next available user of a group without recording the assignment.
+// During quiet hours the assignment is queued, or with opts.NoQueue only the end of the quiet hours reported.
+//
+// Users are selected in a pipeline. The candidate filters first take users out
+// of the route, so the strategy never sees them: users excluded by the request
+// or held by a reservation, and users outside the eligible ones, such as those
+// without the tags of a role. The strategy then picks among the remaining
+// users, and the admission filters are asked about its pick: pauses, daily and
+// weekly capacity, cool-downs, fairness, the filters added with RegisterFilter
+// and, last as it may ask an external service, availability. A user any of
+// them rejects is skipped for the next one in rotation order, so only the
+// users needed are checked.
+func selectAssignee(ctx context.Context, factory *ComponentFactory, group string, opts AssignOptions) (*selection, error) {
 	// Load group configuration
 	groupConf, err := factory.GetConfigLoader().LoadConfig(group)
 	if err != nil {
-		return &ConfigError{Group: group, Err: err}
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &InvalidGroupError{Group: group}
+		}
+		return nil, &ConfigError{Group: group, Err: err}
 	}
 
-	users := groupConf.Users
-	if len(users) == 0 {
-		return &ConfigError{Group: group, Err: fmt.Errorf("no users found")}
+	if groupConf.disabled() {
+		return nil, &GroupDisabledError{Group: group}
+	}
+	if len(groupConf.Users) == 0 {
+		return nil, &ConfigError{Group: group, Err: fmt.Errorf("no users found")}
+	}
+
+	// Narrow the group to the users and strategy for the requested priority
+	rt, err := routeAssignment(groupConf, opts.Priority)
+	if errors.Is(err, ErrInvalidOption) {
+		return nil, err
+	} else if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	overridden, err := rt.override(opts.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	groupConf, replacedChecker, err := overrideChecker(groupConf, opts.Availability)
+	if err != nil {
+		return nil, err
+	}
+	if replacedChecker != "" {
+		tracing.Printf(ctx, "Warning: checking availability in group %s with %s instead of %s", group, groupConf.AvailabilityChecker, replacedChecker)
+	}
+	// Users held by a reservation are not available until it is committed or released
+	reservations, err := readReservations(group)
+	if err != nil {
+		return nil, err
+	}
+	exclude := opts.Exclude
+	if len(reservations) > 0 {
+		exclude = append(append([]string(nil), exclude...), reservedUsers(reservations)...)
+	}
+	var trace *SelectionTrace
+	if opts.Explain || groupConf.Callback.Trace {
+		trace = &SelectionTrace{Strategy: rt.strategy, Candidates: append([]string(nil), rt.users...)}
+	}
+	removed, err := rt.narrow(ctx, group, candidateFilters(groupConf, exclude, opts.Eligible))
+	if err != nil {
+		return nil, err
+	}
+	if trace != nil {
+		trace.Removed = removed
+	}
+	if len(rt.users) == 0 {
+		return nil, &NoAvailableAssigneeError{Group: group, Trace: trace}
+	}
+	if opts.RequireAllChecks {
+		if err := preflight(ctx, factory, group, groupConf, rt.users, opts.DryRun); err != nil {
+			return nil, err
+		}
+	}
+	users := rt.users
+	if groupConf.Callback.enabled() {
+		if _, err := groupConf.Callback.timeout(); err != nil {
+			return nil, &ConfigError{Group: group, Err: err}
+		}
+	}
+
+	// Queue the assignment instead when it is requested during quiet hours
+	if groupConf.QuietHours.enabled() && !opts.DryRun && !opts.IgnoreQuietHours {
+		loc, err := groupConf.location()
+		if err != nil {
+			return nil, &ConfigError{Group: group, Err: err}
+		}
+		schedule, err := groupConf.QuietHours.parse(loc)
+		if err != nil {
+			return nil, &ConfigError{Group: group, Err: err}
+		}
+		if now := timeNow(); schedule.quiet(now) {
+			if opts.NoQueue {
+				return &selection{group: group, conf: groupConf, deferred: schedule.nextOpen(now).Format(time.RFC3339)}, nil
+			}
+			qa, err := deferAssignment(ctx, group, opts, schedule.nextOpen(now))
+			if err != nil {
+				return nil, fmt.Errorf("failed to queue assignment: %w", err)
+			}
+			if !opts.Silent {
+				fmt.Println(l10n.T(l10n.MsgDeferred, "Group", group, "Time", qa.NotBefore))
+			}
+			return &selection{group: group, conf: groupConf, deferred: qa.NotBefore, queueID: qa.ID}, nil
+		}
 	}
 
 	// Get last index and counts
-	lastIndex, err := factory.GetStorageManager().ReadLastIndex(group)
+	lastIndex, err := factory.GetStorageManager().ReadLastIndex(ctx, group)
 	if err != nil {
-		return fmt.Errorf("failed to read last index: %w", err)
+		return nil, fmt.Errorf("failed to read last index: %w", err)
 	}
-	counts, err := factory.GetCountManager().GetCounts(group)
+	counts, err := factory.GetCountManager().GetCounts(ctx, group)
 	if err != nil {
-		return fmt.Errorf("failed to get counts: %w", err)
+		return nil, fmt.Errorf("failed to get counts: %w", err)
 	}
 
 	// Create strategy
-	strategy, err := factory.CreateAssignmentStrategy(groupConf.Strategy)
+	strategyOpts := groupConf.StrategyOptions
+	if opts.Seed != nil {
+		strategyOpts.Seed = opts.Seed
+	}
+	strategy, err := factory.CreateAssignmentStrategy(rt.strategy, strategyOpts)
 	if err != nil {
-		return &ConfigError{Group: group, Err: err}
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	for _, s := range chainStrategies(strategy) {
+		load, ok := s.(*selector.OpenLoad)
+		if !ok {
+			continue
+		}
+		provider, err := factory.CreateWorkloadProvider(strategyOpts.Workload)
+		if err != nil {
+			return nil, &ConfigError{Group: group, Err: err}
+		}
+		open, err := provider.Workload(ctx, group, users)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get workload: %w", err)
+		}
+		load.Open = open
+	}
+	if chainUses(rt.strategy, "least_recently_assigned") {
+		last, err := readLastAssigned(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read last assignments: %w", err)
+		}
+		groupConf.mergeAliasTimes(last)
+		setLastAssigned(strategy, last)
+	}
+	if strategyOpts.SkipDebt {
+		debts, err := readDebts(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read skip debts: %w", err)
+		}
+		strategy = &selector.SkipDebt{Inner: strategy, Debts: debts}
 	}
 
 	// Create availability checker
 	availChecker, err := factory.CreateAvailabilityChecker(groupConf.AvailabilityChecker)
 	if err != nil {
-		return &ConfigError{Group: group, Err: err}
+		return nil, &ConfigError{Group: group, Err: err}
 	}
 
 	// Select next user
-	nextIndex, err := strategy.SelectNext(users, lastIndex, counts)
+	nextIndex, err := strategy.SelectNext(ctx, users, rt.localIndex(lastIndex), counts)
+	if err != nil {
+		return nil, &SelectionError{Group: group, Err: err}
+	}
+	if trace != nil {
+		trace.Ranking = traceRanking(strategy, rt.strategy, users, rt.localIndex(lastIndex), counts, nextIndex)
+		trace.Picked = users[nextIndex]
+	}
+
+	// Check the whole group in one call when the checker supports it
+	checkStart := time.Now()
+	check, err := newAvailabilityCheck(ctx, group, groupConf, availChecker, users)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := newAssignmentLimits(group, groupConf)
+	if err != nil {
+		return nil, err
+	}
+
+	paused, err := pausedUsers()
+	if err != nil {
+		return nil, err
+	}
+	fairness, err := newFairnessGuard(group, groupConf, counts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to find a user every admission filter admits, starting with the selected one
+	filters := admissionFilters(paused, limits, fairness, check)
+	limited := map[string]string{}
+	nextIndex, skipped, err := findAvailable(users, nextIndex, func(user string) (bool, error) {
+		filter, reason, err := admit(ctx, filters, group, user)
+		if reason != "" {
+			limited[user] = reason
+			if trace != nil {
+				trace.Skipped = append(trace.Skipped, TraceRejection{User: user, Filter: filter, Reason: reason})
+			}
+		}
+		return err == nil && reason == "", err
+	})
 	if err != nil {
-		return &SelectionError{Group: group, Err: err}
+		return nil, err
+	}
+	if nextIndex < 0 {
+		// Everyone was skipped; keep the record so misbehaving availability data can be audited
+		if !opts.DryRun {
+			if err := logSkips(group, skipRecords(group, groupConf, "", skipped, check.checkFailed(skipped), limited)); err != nil {
+				return nil, err
+			}
+			recordStateChange(fmt.Sprintf("Record skips in %s", group))
+			notifyGroup(ctx, group, groupConf.Webhooks, GroupEvent{Event: EventNoAssignee, Skipped: skipped})
+		}
+		return nil, &NoAvailableAssigneeError{Group: group, Trace: trace}
+	}
+	if trace != nil {
+		trace.Selected = users[nextIndex]
+	}
+
+	if above := fairness.exceeded(users[nextIndex]); above > 0 {
+		tracing.Printf(ctx, "Warning: assigning %s puts them %.1f assignments above the mean of group %s, more than fairness allows", users[nextIndex], above, group)
+	}
+
+	sel := &selection{
+		group:      group,
+		conf:       groupConf,
+		strategy:   rt.strategy,
+		overridden: overridden,
+		checker:    replacedChecker,
+		user:       users[nextIndex],
+		index:      rt.groupIndex[nextIndex],
+		skipped:    skipped,
+		failed:     check.checkFailed(skipped),
+		limited:    limited,
+		checkMs:    time.Since(checkStart).Milliseconds(),
+		reason:     assignmentReason(strategy, rt.strategy, users[nextIndex], counts, len(skipped)),
+		trace:      trace,
+	}
+	if oot, ok := strategy.(OutOfTurnStrategy); ok && oot.OutOfTurn(users, nextIndex) {
+		sel.outOfTurn = true
+	}
+	// A one-off selection by another strategy leaves the rotation where it was
+	if chainUses(overridden, "round_robin") {
+		sel.outOfTurn = true
+	}
+	return sel, nil
+}
+
+// recordAssignment records a selection as the assignment with the given ID.
+// The index and counts are read again, so a selection made earlier, such as a
+// reservation, is recorded against the current state. A non-empty reservation
+// is removed from the group's reservations in the same transaction.
+func recordAssignment(ctx context.Context, factory *ComponentFactory, sel *selection, id, priority string, callbackData map[string]string, reservation string) error {
+	// Update index, counts and log together so a failure leaves no partial state
+	tx, err := factory.GetStorageManager().BeginTransaction(ctx, sel.group)
+	if err != nil {
+		return fmt.Errorf("failed to begin state transaction: %w", err)
+	}
+	changes, err := prepareAssignment(ctx, factory, sel, id, priority, callbackData)
+	if err != nil {
+		return rollbackWith(tx, err)
+	}
+	changes.reservation = reservation
+	return commitAssignment(ctx, factory, tx, changes)
+}
+
+// prepareAssignment builds the changes recording a selection against the
+// current index, counts and skip debts of its group.
+func prepareAssignment(ctx context.Context, factory *ComponentFactory, sel *selection, id, priority string, callbackData map[string]string) (assignmentChanges, error) {
+	group, groupConf := sel.group, sel.conf
+	lastIndex, err := factory.GetStorageManager().ReadLastIndex(ctx, group)
+	if err != nil {
+		return assignmentChanges{}, fmt.Errorf("failed to read last index: %w", err)
+	}
+	counts, err := factory.GetCountManager().GetCounts(ctx, group)
+	if err != nil {
+		return assignmentChanges{}, fmt.Errorf("failed to get counts: %w", err)
+	}
+
+	// Out-of-turn assignments leave the rotation where it was
+	storedIndex := sel.index
+	if sel.outOfTurn {
+		storedIndex = lastIndex
+	}
+	entry := AssignmentLog{
+		ID:                  id,
+		Timestamp:           time.Now().Format(time.RFC3339),
+		Group:               group,
+		User:                sel.user,
+		Strategy:            sel.strategy,
+		LastIndex:           lastIndex,
+		NextIndex:           storedIndex,
+		TotalCount:          len(groupConf.Users),
+		UserCount:           counts[sel.user] + 1,
+		Actor:               currentActor(),
+		Metadata:            assignmentMetadata(ctx),
+		AvailabilityCheckMs: sel.checkMs,
+	}
+	if priority != "" {
+		entry.Metadata["priority"] = priority
+	}
+	if sel.overridden != "" {
+		entry.Metadata["overridden_strategy"] = sel.overridden
+	}
+	if sel.checker != "" {
+		entry.Metadata["overridden_availability_checker"] = sel.checker
+	}
+	if sel.reason != "" {
+		entry.Metadata["reason"] = sel.reason
+	}
+	changes := assignmentChanges{
+		entry:     entry,
+		trackOpen: groupConf.TrackOpen,
+		skips:     skipRecords(group, groupConf, entry.ID, sel.skipped, sel.failed, sel.limited),
+		sinks:     groupConf.LogSinks,
+		webhooks:  groupConf.Webhooks,
+	}
+	if groupConf.StrategyOptions.SkipDebt {
+		debts, err := readDebts(group)
+		if err != nil {
+			return assignmentChanges{}, fmt.Errorf("failed to read skip debts: %w", err)
+		}
+		changes.debts = settleDebts(debts, sel.skipped, sel.user)
+	}
+	if groupConf.Callback.enabled() {
+		changes.callback = &groupConf.Callback
+		changes.callbackData = callbackData
+		changes.trace = sel.trace
 	}
+	return changes, nil
+}
 
-	// Try to find an available user
-	attempts := 0
-	for attempts < len(users) {
-		user := users[nextIndex]
-		ok, err := availChecker.IsAvailable(user)
+// findAvailable returns the index of the first available user, checking
+// users in order from start and wrapping around, together with the users
+// skipped before it. The index is -1 when nobody is available.
+func findAvailable(users []string, start int, available func(user string) (bool, error)) (int, []string, error) {
+	var skipped []string
+	for attempts := 0; attempts < len(users); attempts++ {
+		index := (start + attempts) % len(users)
+		ok, err := available(users[index])
 		if err != nil {
-			return &AvailabilityError{User: user, Err: err}
+			return -1, nil, err
 		}
 		if ok {
-			if dryRun {
-				fmt.Printf("[DRY RUN] Would assign to: %s\n", user)
-			} else {
-				fmt.Println(user)
-
-				// Update indices and counts
-				if err := factory.GetStorageManager().WriteLastIndex(group, nextIndex); err != nil {
-					return fmt.Errorf("failed to write last index: %w", err)
-				}
-				if err := factory.GetCountManager().IncrementCount(group, user); err != nil {
-					return fmt.Errorf("failed to increment count: %w", err)
-				}
-
-				// Get updated counts
-				updatedCounts, err := factory.GetCountManager().GetCounts(group)
-				if err != nil {
-					return fmt.Errorf("failed to get updated counts: %w", err)
-				}
-
-				// Log the assignment
-				if err := factory.GetAssignmentLogger().LogAssignment(group, user, groupConf.Strategy, lastIndex, nextIndex, updatedCounts); err != nil {
-					return fmt.Errorf("failed to log assignment: %w", err)
-				}
-			}
-			return nil
+			return index, skipped, nil
+		}
+		skipped = append(skipped, users[index])
+	}
+	return -1, skipped, nil
+}
+
+// assignmentChanges is the state written for one assignment.
+type assignmentChanges struct {
+	entry        AssignmentLog
+	trackOpen    bool                 // Add the assignment to the open assignments
+	debts        map[string]int       // Skip debts to store, nil when skip_debt is disabled
+	skips        []history.SkipRecord // Users passed over before the assignee was found
+	callback     *Callback            // Callback run once the state is written, nil without one
+	callbackData map[string]string    // Data passed to the callback
+	trace        *SelectionTrace      // Trace of the selection passed to the callback, nil when not traced
+	reservation  string               // Reservation the assignment commits, removed with it
+	sinks        []LogSink            // Log sinks the assignment is shipped to once committed
+	webhooks     []GroupWebhook       // Webhooks told about the assignment once committed
+}
+
+// commitAssignment writes the changes of an assignment within tx, runs its callback and commits tx.
+// If any step fails the transaction is rolled back and the original error returned.
+func commitAssignment(ctx context.Context, factory *ComponentFactory, tx StateTransaction, changes assignmentChanges) error {
+	if err := writeAssignment(ctx, factory, changes); err != nil {
+		return rollbackWith(tx, err)
+	}
+	return finishAssignment(ctx, tx, changes)
+}
+
+// writeAssignment writes the index, count, log entry and remaining changes of an assignment.
+func writeAssignment(ctx context.Context, factory *ComponentFactory, changes assignmentChanges) error {
+	entry := changes.entry
+	if err := factory.GetStorageManager().WriteLastIndex(ctx, entry.Group, entry.NextIndex); err != nil {
+		return fmt.Errorf("failed to write last index: %w", err)
+	}
+	if err := factory.GetCountManager().IncrementCount(ctx, entry.Group, entry.User); err != nil {
+		return fmt.Errorf("failed to increment count: %w", err)
+	}
+	if err := factory.GetAssignmentLogger().LogAssignment(ctx, entry); err != nil {
+		return fmt.Errorf("failed to log assignment: %w", err)
+	}
+	if changes.trackOpen {
+		if err := openAssignment(entry); err != nil {
+			return fmt.Errorf("failed to record open assignment: %w", err)
 		}
-		nextIndex = (nextIndex + 1) % len(users)
-		attempts++
 	}
+	if changes.debts != nil {
+		if err := writeDebts(entry.Group, changes.debts); err != nil {
+			return fmt.Errorf("failed to write skip debts: %w", err)
+		}
+	}
+	if err := recordLastAssigned(entry.Group, entry.User, timeNow()); err != nil {
+		return fmt.Errorf("failed to record last assignment: %w", err)
+	}
+	if changes.reservation != "" {
+		if err := dropReservation(entry.Group, changes.reservation); err != nil {
+			return fmt.Errorf("failed to remove reservation: %w", err)
+		}
+	}
+	return logSkips(entry.Group, changes.skips)
+}
 
-	return &NoAvailableAssigneeError{Group: group}
+// finishAssignment runs the callbacks of the assignments written within tx
+// and commits it. The callbacks run before the commit so a failure can still
+// be rolled back; callbacks after a failed one are not run. Committed
+// assignments are shipped to the log sinks and webhooks of their group.
+func finishAssignment(ctx context.Context, tx StateTransaction, written ...assignmentChanges) error {
+	err := runCallbacks(ctx, tx, written)
+	var callbackErr *CallbackError
+	if err == nil || (errors.As(err, &callbackErr) && !callbackErr.RolledBack) {
+		shipAssignments(ctx, written)
+		notifyAssignments(ctx, written)
+	}
+	return err
+}
+
+// runCallbacks runs the callbacks of finishAssignment and commits tx, unless
+// a failed callback rolls the assignments back.
+func runCallbacks(ctx context.Context, tx StateTransaction, written []assignmentChanges) error {
+	for _, changes := range written {
+		if changes.callback == nil {
+			continue
+		}
+		entry := changes.entry
+		payload := CallbackPayload{
+			ID:        entry.ID,
+			Group:     entry.Group,
+			User:      entry.User,
+			Role:      entry.Role,
+			Timestamp: entry.Timestamp,
+			Priority:  entry.Metadata["priority"],
+			Reason:    entry.Metadata["reason"],
+			Data:      changes.callbackData,
+			Trace:     changes.trace,
+		}
+		cbErr := changes.callback.run(ctx, payload)
+		if cbErr == nil {
+			continue
+		}
+		callbackErr := &CallbackError{Group: entry.Group, User: entry.User, ID: entry.ID, RolledBack: changes.callback.Rollback, Err: cbErr}
+		if changes.callback.Rollback {
+			return rollbackWith(tx, callbackErr)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return callbackErr
+	}
+	return tx.Commit()
+}
+
+// rollbackWith rolls back tx after err and returns err, noting a failed rollback.
+func rollbackWith(tx StateTransaction, err error) error {
+	if rbErr := tx.Rollback(); rbErr != nil {
+		return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+	}
+	return err
 }
 
 // GetCounts retrieves the current assignment counts for a group.
 // Returns the counts in the same order as users are defined in the config file.
 func GetCounts(group string) (map[string]int, []string, error) {
-	// Validate group exists before proceeding
-	if _, err := loadAssigneeGroupConfig(group); err != nil {
+	// Validate group exists before proceeding; the config also gives the user order
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
 		return nil, nil, &InvalidGroupError{Group: group}
 	}
 
@@ -147,12 +692,6 @@ func GetCounts(group string) (map[string]int, []string, error) {
 		return nil, nil, fmt.Errorf("no counts found for group %s", group)
 	}
 
-	// Get the group configuration to get the user order
-	groupConf, err := loadAssigneeGroupConfig(group)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load group config: %w", err)
-	}
-
 	// Ensure all users from config have an entry in counts
 	for _, user := range groupConf.Users {
 		if _, exists := counts[user]; !exists {
@@ -163,13 +702,28 @@ func GetCounts(group string) (map[string]int, []string, error) {
 	return counts, groupConf.Users, nil
 }
 
-// ResetCounts resets the assignment counts for all users in a group to zero.
-func ResetCounts(group string) error {
+// ResetCounts resets the assignment counts for all users in a group to zero,
+// under the lock of the group. The assignments logged so far are recorded,
+// so fsck only compares the counts with the assignments logged after the reset.
+func ResetCounts(ctx context.Context, group string) error {
 	groupConf, err := loadAssigneeGroupConfig(group)
 	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &InvalidGroupError{Group: group}
+		}
 		return &ConfigError{Group: group, Err: err}
 	}
 
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
 	counts := make(map[string]int)
 	for _, user := range groupConf.Users {
 		counts[user] = 0
@@ -179,40 +733,38 @@ func ResetCounts(group string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get group data directory: %w", err)
 	}
-
-	path := filepath.Join(groupDir, "counts.json")
-	data, err := json.MarshalIndent(counts, "", "  ")
+	records, err := history.ReadFile(filepath.Join(groupDir, "assignments.log"))
 	if err != nil {
-		return fmt.Errorf("failed to marshal counts: %w", err)
+		return fmt.Errorf("failed to read assignment log: %w", err)
 	}
-
-	if err := ioutil.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("failed to write counts file: %w", err)
+	logged, err := loggedCounts(group, groupConf, records)
+	if err != nil {
+		return err
 	}
-
-	return nil
-}
-
-// logAssignment creates a log entry for the assignment.
-func logAssignment(group, user, strategy string, lastIndex, nextIndex int, counts map[string]int) error {
-	// Get the group configuration to get the total number of users
-	groupConf, err := loadAssigneeGroupConfig(group)
+	if err := writeResetCounts(group, counts, logged); err != nil {
+		return err
+	}
+	// The cursor is kept, since a reset only changes the counts
+	err = syncSharedState(group, func(lastIndex *int, shared map[string]int) {
+		replaceState(*lastIndex, counts)(lastIndex, shared)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to load group config for logging: %w", err)
+		return err
 	}
+	recordStateChange(fmt.Sprintf("Reset counts of %s", group))
+	notifyGroup(context.Background(), group, groupConf.Webhooks, GroupEvent{Event: EventReset})
+	return nil
+}
 
-	logEntry := AssignmentLog{
-		Timestamp:  time.Now().Format(time.RFC3339),
-		Group:      group,
-		User:       user,
-		Strategy:   strategy,
-		LastIndex:  lastIndex,
-		NextIndex:  nextIndex,
-		TotalCount: len(groupConf.Users), // Use actual number of users in group
-		UserCount:  counts[user],
+// logAssignment appends an entry for the assignment to the group's log file.
+// The schema version and timestamp are filled in when not already set.
+func logAssignment(logEntry AssignmentLog) error {
+	logEntry.SchemaVersion = history.CurrentSchemaVersion
+	if logEntry.Timestamp == "" {
+		logEntry.Timestamp = time.Now().Format(time.RFC3339)
 	}
 
-	groupDir, err := config.GetGroupDataDir(group)
+	groupDir, err := config.GetGroupDataDir(logEntry.Group)
 	if err != nil {
 		return fmt.Errorf("failed to get group data directory: %w", err)
 	}
@@ -236,111 +788,243 @@ func logAssignment(group, user, strategy string, lastIndex, nextIndex int, count
 	return nil
 }
 
+// currentActor returns who triggered the assignment.
+// AUTOASSIGNER_ACTOR takes precedence over the operating system user.
+func currentActor() string {
+	if actor := os.Getenv("AUTOASSIGNER_ACTOR"); actor != "" {
+		return actor
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// assignmentMetadata returns context recorded with every assignment, with
+// the IDs of the request to the API that triggered it, if any.
+func assignmentMetadata(ctx context.Context) map[string]string {
+	metadata := map[string]string{"version": version.Version}
+	if host, err := os.Hostname(); err == nil {
+		metadata["host"] = host
+	}
+	if ids, ok := tracing.FromContext(ctx); ok {
+		metadata["request_id"] = ids.RequestID
+		metadata["trace_id"] = ids.TraceID
+	}
+	return metadata
+}
+
 // loadAssigneeGroupConfig loads and parses the configuration for a group.
 // It reads the YAML file from the configured directory and unmarshals it into an AssigneeGroupConfig.
 func loadAssigneeGroupConfig(group string) (*AssigneeGroupConfig, error) {
-	confPath := filepath.Join(config.Settings.Storage.ConfDir, group+".yaml")
-	data, err := ioutil.ReadFile(confPath)
+	confPath, _ := config.GroupConfigPath(group)
+	data, err := os.ReadFile(confPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var groupConf AssigneeGroupConfig
-	if err := yaml.Unmarshal(data, &groupConf); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	// Reuse the parsed config while the file content is unchanged
+	groupConfigCache.Lock()
+	cached, ok := groupConfigCache.entries[confPath]
+	groupConfigCache.Unlock()
+	if ok && bytes.Equal(cached.data, data) {
+		return cached.conf.clone(), nil
 	}
-	return &groupConf, nil
-}
 
-// readLastIndex reads the last assigned index for a group from the index file.
-// Returns -1 if no previous assignment exists or if there's an error reading the file.
-func readLastIndex(group string) int {
-	groupDir, err := config.GetGroupDataDir(group)
+	groupConf, err := parseAssigneeGroupConfig(data)
 	if err != nil {
-		return -1
+		return nil, err
 	}
 
-	path := filepath.Join(groupDir, "index.log")
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return -1
+	groupConfigCache.Lock()
+	groupConfigCache.entries[confPath] = cachedGroupConfig{data: data, conf: groupConf.clone()}
+	groupConfigCache.Unlock()
+	if ok {
+		// The file changed since the process last loaded it, such as while a server runs;
+		// told in the background so loading doesn't wait for the webhooks
+		go notifyGroup(context.Background(), group, groupConf.Webhooks, GroupEvent{Event: EventConfigReloaded})
 	}
-	if len(data) == 0 {
-		return -1
+	return groupConf, nil
+}
+
+// parseAssigneeGroupConfig decodes a group configuration file.
+// Decoding is strict so typos such as "stratgy:" are reported instead of ignored.
+// Settings given inline in the users list are merged into Aliases, AvailabilityIDs and Tags.
+func parseAssigneeGroupConfig(data []byte) (*AssigneeGroupConfig, error) {
+	data, settings, err := inlineUserSettings(data)
+	if err != nil {
+		return nil, err
 	}
 
-	// Read the last line of the file
-	lines := strings.Split(string(data), "\n")
-	if len(lines) == 0 {
-		return -1
+	var groupConf AssigneeGroupConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&groupConf); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if err := groupConf.applyUserSettings(settings); err != nil {
+		return nil, err
 	}
+	return &groupConf, nil
+}
+
+// cachedGroupConfig is a parsed group config together with the file content it came from.
+type cachedGroupConfig struct {
+	data []byte
+	conf *AssigneeGroupConfig
+}
 
-	// Get the last non-empty line
-	lastLine := ""
-	for i := len(lines) - 1; i >= 0; i-- {
-		if lines[i] != "" {
-			lastLine = lines[i]
-			break
+// groupConfigCache holds parsed group configs keyed by file path, so the
+// several lookups made during one assignment parse the YAML only once.
+var groupConfigCache = struct {
+	sync.Mutex
+	entries map[string]cachedGroupConfig
+}{entries: make(map[string]cachedGroupConfig)}
+
+// clone returns a copy of the config that shares no pointers, slices or maps with the original.
+func (c *AssigneeGroupConfig) clone() *AssigneeGroupConfig {
+	cp := *c
+	if c.Enabled != nil {
+		enabled := *c.Enabled
+		cp.Enabled = &enabled
+	}
+	if c.StrategyOptions.Seed != nil {
+		seed := *c.StrategyOptions.Seed
+		cp.StrategyOptions.Seed = &seed
+	}
+	cp.Users = append([]string(nil), c.Users...)
+	if c.Priorities != nil {
+		cp.Priorities = make(map[string]PriorityRoute, len(c.Priorities))
+		for priority, pr := range c.Priorities {
+			pr.Users = append([]string(nil), pr.Users...)
+			cp.Priorities[priority] = pr
+		}
+	}
+	cp.QuietHours.Days = append([]string(nil), c.QuietHours.Days...)
+	cp.Callback.Command = append([]string(nil), c.Callback.Command...)
+	cp.Callback.Headers = cloneStringMap(c.Callback.Headers)
+	if c.Aliases != nil {
+		cp.Aliases = make(map[string][]string, len(c.Aliases))
+		for user, aliases := range c.Aliases {
+			cp.Aliases[user] = append([]string(nil), aliases...)
 		}
 	}
-	if lastLine == "" {
-		return -1
+	cp.AvailabilityIDs = cloneStringMap(c.AvailabilityIDs)
+	if c.Tags != nil {
+		cp.Tags = make(map[string][]string, len(c.Tags))
+		for user, tags := range c.Tags {
+			cp.Tags[user] = append([]string(nil), tags...)
+		}
 	}
-
-	parts := strings.Split(lastLine, "--")
-	if len(parts) == 2 {
-		idx := strings.TrimSpace(parts[1])
-		val, err := strconv.Atoi(idx)
-		if err != nil {
-			return -1
+	if c.Roles != nil {
+		cp.Roles = make(map[string]Role, len(c.Roles))
+		for name, role := range c.Roles {
+			role.Users = append([]string(nil), role.Users...)
+			role.Tags = append([]string(nil), role.Tags...)
+			cp.Roles[name] = role
 		}
-		return val
 	}
-	return -1
+	cp.AlwaysAvailable = append([]string(nil), c.AlwaysAvailable...)
+	cp.NeverAvailable = append([]string(nil), c.NeverAvailable...)
+	if c.UserLimits != nil {
+		cp.UserLimits = make(map[string]UserLimits, len(c.UserLimits))
+		for user, limits := range c.UserLimits {
+			cp.UserLimits[user] = limits
+		}
+	}
+	cp.LogSinks = append([]LogSink(nil), c.LogSinks...)
+	for i := range cp.LogSinks {
+		cp.LogSinks[i].Headers = cloneStringMap(cp.LogSinks[i].Headers)
+	}
+	cp.Webhooks = append([]GroupWebhook(nil), c.Webhooks...)
+	for i := range cp.Webhooks {
+		cp.Webhooks[i].Events = append([]string(nil), cp.Webhooks[i].Events...)
+		cp.Webhooks[i].Headers = cloneStringMap(cp.Webhooks[i].Headers)
+	}
+	cp.Escalation = append([]EscalationStep(nil), c.Escalation...)
+	return &cp
 }
 
-// writeLastIndex writes the last assigned index for a group to the index file.
-// The index is written with a timestamp for tracking purposes.
-func writeLastIndex(group string, index int) error {
-	groupDir, err := config.GetGroupDataDir(group)
-	if err != nil {
-		return fmt.Errorf("failed to get group data directory: %w", err)
+// cloneStringMap returns a copy of m; nil when m is nil.
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
 	}
+	cp := make(map[string]string, len(m))
+	for key, value := range m {
+		cp[key] = value
+	}
+	return cp
+}
+
+// readLastIndex reads the last assigned index for a group from its stored state.
+// Returns -1 if no previous assignment exists or if there's an error reading the state.
+func readLastIndex(group string) int {
+	index, _ := readCursor(group)
+	return index
+}
 
-	path := filepath.Join(groupDir, "index.log")
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// readLastLine returns the last non-empty line of a file.
+// Only the end of the file is read, so the cost does not grow with its history.
+func readLastLine(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to open index file: %w", err)
+		return "", err
 	}
 	defer f.Close()
 
-	_, err = fmt.Fprintf(f, "%s -- %d\n", time.Now().Format(time.RFC3339), index)
+	info, err := f.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to write index: %w", err)
+		return "", err
 	}
-	return nil
+
+	const chunk = 4096
+	size := info.Size()
+	var tail []byte
+	for offset := size; offset > 0; {
+		n := int64(chunk)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, offset); err != nil {
+			return "", err
+		}
+		tail = append(buf, tail...)
+
+		trimmed := strings.TrimRight(string(tail), "\n")
+		if i := strings.LastIndex(trimmed, "\n"); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+		if offset == 0 {
+			return trimmed, nil
+		}
+	}
+	return "", nil
 }
 
-// readCounts reads the assignment counts for all users from the counts file.
-// Returns an empty map if the file doesn't exist or if there's an error reading it.
+// writeLastIndex writes the last assigned index for a group to its stored state.
+// The index is stored with a timestamp for tracking purposes.
+func writeLastIndex(group string, index int) error {
+	return writeCursor(group, index, "")
+}
+
+// readCounts reads the assignment counts for all users from the stored state.
+// Returns an empty map if there is none or if there's an error reading it.
 func readCounts(group string) map[string]int {
 	counts := map[string]int{}
-	groupDir, err := config.GetGroupDataDir(group)
-	if err != nil {
-		return counts
-	}
-
-	path := filepath.Join(groupDir, "counts.json")
-	data, err := ioutil.ReadFile(path)
-	if err == nil {
-		if err := json.Unmarshal(data, &counts); err != nil {
-			log.Printf("Warning: failed to parse counts file: %v", err)
-		}
+	if b, err := readCountBuckets(group); err != nil {
+		log.Printf("Warning: failed to parse counts file: %v", err)
+	} else {
+		counts = b.totals()
 	}
 
 	// Initialize counts for all users in the group if they don't exist
 	groupConf, err := loadAssigneeGroupConfig(group)
 	if err == nil {
+		groupConf.mergeAliasCounts(counts)
 		for _, user := range groupConf.Users {
 			if _, exists := counts[user]; !exists {
 				counts[user] = 0
@@ -351,28 +1035,27 @@ func readCounts(group string) map[string]int {
 	return counts
 }
 
-// incrementCount increments the assignment count for a user and saves it to the counts file.
-// The counts are stored in a JSON file for persistence.
+// incrementCount increments the assignment count for a user in today's
+// bucket and saves it to the stored state.
 func incrementCount(group, user string) error {
-	counts := readCounts(group)
-
-	// Increment the count for the specific user
-	counts[user]++
-
-	groupDir, err := config.GetGroupDataDir(group)
+	b, err := readCountBuckets(group)
 	if err != nil {
-		return fmt.Errorf("failed to get group data directory: %w", err)
+		return fmt.Errorf("failed to read counts: %w", err)
 	}
+	b.increment(user, timeNow().In(groupLocation(group)))
+	return writeCountBuckets(group, b)
+}
 
-	path := filepath.Join(groupDir, "counts.json")
-	data, err := json.MarshalIndent(counts, "", "  ")
+// writeCounts replaces the lifetime counts of a group with the given counts,
+// keeping the daily buckets that are still consistent with them.
+func writeCounts(group string, counts map[string]int) error {
+	b, err := readCountBuckets(group)
 	if err != nil {
-		return fmt.Errorf("failed to marshal counts: %w", err)
+		// An unreadable file is replaced entirely
+		b = newCountBuckets()
 	}
-	if err := ioutil.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("failed to write counts file: %w", err)
-	}
-	return nil
+	b.setTotals(counts)
+	return writeCountBuckets(group, b)
 }
 
 // GetGroupDataDir returns the data directory for a specific group.
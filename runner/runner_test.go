@@ -1,10 +1,33 @@
 package runner
 
 import (
+	"autoassigner/availability"
 	"autoassigner/config"
+	"autoassigner/history"
+	"autoassigner/schema"
+	"autoassigner/selector"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,7 +41,7 @@ func TestAssign(t *testing.T) {
 	defer os.RemoveAll(testDir)
 
 	// Set up configuration
-	config.Settings.Storage.ConfDir = testDir
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
 	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
 
 	// Create test group config
@@ -74,3 +97,5253 @@ func TestAssign(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadAssigneeGroupConfigStrict(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "known fields",
+			content: "strategy: round_robin\nusers:\n  - alice\n",
+			wantErr: false,
+		},
+		{
+			name:    "empty file",
+			content: "",
+			wantErr: false,
+		},
+		{
+			name:    "misspelled field",
+			content: "stratgy: round_robin\nusers:\n  - alice\n",
+			wantErr: true,
+		},
+		{
+			name:    "inline user settings",
+			content: "strategy: round_robin\nusers:\n  - alice: {aliases: [asmith], availability_id: alice@example.com}\n  - bob\n",
+			wantErr: false,
+		},
+		{
+			name:    "misspelled inline user setting",
+			content: "strategy: round_robin\nusers:\n  - alice: {alias: [asmith]}\n",
+			wantErr: true,
+		},
+		{
+			name:    "misspelled field with inline user settings",
+			content: "stratgy: round_robin\nusers:\n  - alice: {aliases: [asmith]}\n",
+			wantErr: true,
+		},
+		{
+			name:    "alias of a member",
+			content: "strategy: round_robin\nusers:\n  - alice: {aliases: [bob]}\n  - bob\n",
+			wantErr: true,
+		},
+		{
+			name:    "alias of two members",
+			content: "strategy: round_robin\nusers: [alice, bob]\naliases:\n  alice: [ab]\n  bob: [ab]\n",
+			wantErr: true,
+		},
+		{
+			name:    "aliases of a non-member",
+			content: "strategy: round_robin\nusers: [alice]\naliases:\n  carol: [cc]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(testDir, "group.yaml"), []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+			_, err := loadAssigneeGroupConfig("group")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadAssigneeGroupConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserListSchema(t *testing.T) {
+	users := schema.Generate(AssigneeGroupConfig{}, "group", "yaml")["properties"].(map[string]interface{})["users"].(map[string]interface{})
+
+	// matches reports whether a decoded YAML value is valid against s,
+	// for the keywords the users schema uses
+	var matches func(v interface{}, s map[string]interface{}) bool
+	matches = func(v interface{}, s map[string]interface{}) bool {
+		if alternatives, ok := s["oneOf"].([]interface{}); ok {
+			n := 0
+			for _, alt := range alternatives {
+				if matches(v, alt.(map[string]interface{})) {
+					n++
+				}
+			}
+			return n == 1
+		}
+		switch s["type"] {
+		case "string":
+			_, ok := v.(string)
+			return ok
+		case "array":
+			list, ok := v.([]interface{})
+			for _, item := range list {
+				ok = ok && matches(item, s["items"].(map[string]interface{}))
+			}
+			return ok
+		case "object":
+			m, ok := v.(map[string]interface{})
+			if n, set := s["minProperties"].(int); set && len(m) < n {
+				return false
+			}
+			if n, set := s["maxProperties"].(int); set && len(m) > n {
+				return false
+			}
+			properties, _ := s["properties"].(map[string]interface{})
+			for key, value := range m {
+				if p, known := properties[key]; known {
+					ok = ok && matches(value, p.(map[string]interface{}))
+				} else if extra, isSchema := s["additionalProperties"].(map[string]interface{}); isSchema {
+					ok = ok && matches(value, extra)
+				} else {
+					ok = ok && s["additionalProperties"] != false
+				}
+			}
+			return ok
+		}
+		return true
+	}
+
+	tests := []struct {
+		name  string
+		users string
+		want  bool
+	}{
+		{"names", "[alice, bob]", true},
+		{"inline settings", "[{alice: {aliases: [asmith], availability_id: alice@example.com, tags: [qa]}}, bob]", true},
+		{"misspelled inline setting", "[{alice: {alias: [asmith]}}]", false},
+		{"two users in one entry", "[{alice: {tags: [qa]}, bob: {tags: [qa]}}]", false},
+		{"number", "[42]", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := yaml.Unmarshal([]byte(tt.users), &v); err != nil {
+				t.Fatalf("yaml.Unmarshal() error = %v", err)
+			}
+			if got := matches(v, users); got != tt.want {
+				t.Errorf("users %s valid = %v, want %v", tt.users, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloneGroupConfig(t *testing.T) {
+	// fill sets every field reachable from v, so each pointer, slice and map is non-nil
+	var fill func(v reflect.Value)
+	fill = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString("x")
+		case reflect.Bool:
+			v.SetBool(true)
+		case reflect.Int, reflect.Int64:
+			v.SetInt(1)
+		case reflect.Ptr:
+			v.Set(reflect.New(v.Type().Elem()))
+			fill(v.Elem())
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+			fill(v.Index(0))
+		case reflect.Map:
+			key, elem := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			fill(key)
+			fill(elem)
+			v.Set(reflect.MakeMap(v.Type()))
+			v.SetMapIndex(key, elem)
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).IsExported() {
+					fill(v.Field(i))
+				}
+			}
+		}
+	}
+	// shared reports the paths of pointers, slices and maps a and b have in common
+	var shared func(a, b reflect.Value, path string) []string
+	shared = func(a, b reflect.Value, path string) []string {
+		var paths []string
+		switch a.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			if a.IsNil() {
+				return []string{path + " is nil"}
+			}
+			if a.Pointer() == b.Pointer() {
+				paths = append(paths, path)
+			}
+		}
+		switch a.Kind() {
+		case reflect.Ptr:
+			paths = append(paths, shared(a.Elem(), b.Elem(), path)...)
+		case reflect.Slice:
+			for i := 0; i < a.Len(); i++ {
+				paths = append(paths, shared(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		case reflect.Map:
+			for _, key := range a.MapKeys() {
+				paths = append(paths, shared(a.MapIndex(key), b.MapIndex(key), fmt.Sprintf("%s[%v]", path, key))...)
+			}
+		case reflect.Struct:
+			for i := 0; i < a.NumField(); i++ {
+				if a.Type().Field(i).IsExported() {
+					paths = append(paths, shared(a.Field(i), b.Field(i), path+"."+a.Type().Field(i).Name)...)
+				}
+			}
+		}
+		return paths
+	}
+
+	var original AssigneeGroupConfig
+	fill(reflect.ValueOf(&original).Elem())
+	cp := original.clone()
+	if !reflect.DeepEqual(*cp, original) {
+		t.Errorf("clone() = %+v, want %+v", *cp, original)
+	}
+	for _, path := range shared(reflect.ValueOf(original), reflect.ValueOf(*cp), "AssigneeGroupConfig") {
+		t.Errorf("clone() shares %s with the original", path)
+	}
+}
+
+func TestRebuildCounts(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers:\n  - user1\n  - user2\n")
+	if err := os.WriteFile(filepath.Join(testDir, "rebuild-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := Assign("rebuild-group", false); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+	}
+
+	// Tamper with the stored state
+	if err := writeCounts("rebuild-group", map[string]int{"user1": 7, "user2": 0}); err != nil {
+		t.Fatalf("writeCounts() error = %v", err)
+	}
+	if err := writeLastIndex("rebuild-group", 1); err != nil {
+		t.Fatalf("writeLastIndex() error = %v", err)
+	}
+
+	rebuild, err := RebuildCounts("rebuild-group")
+	if err != nil {
+		t.Fatalf("RebuildCounts() error = %v", err)
+	}
+	if rebuild.RebuiltCounts["user1"] != 2 || rebuild.RebuiltCounts["user2"] != 1 || rebuild.RebuiltIndex != 0 {
+		t.Errorf("RebuildCounts() = %v index %d, want user1=2 user2=1 index 0", rebuild.RebuiltCounts, rebuild.RebuiltIndex)
+	}
+	if diffs := rebuild.Differences(); len(diffs) != 3 {
+		t.Errorf("Differences() = %v, want 3 entries", diffs)
+	}
+
+	// The rebuild is made again under the lock, so changes since are rebuilt too
+	if err := writeCounts("rebuild-group", map[string]int{"user1": 7, "user2": 9}); err != nil {
+		t.Fatalf("writeCounts() error = %v", err)
+	}
+	applied, err := ApplyRebuild(context.Background(), "rebuild-group")
+	if err != nil {
+		t.Fatalf("ApplyRebuild() error = %v", err)
+	}
+	if applied.CurrentCounts["user2"] != 9 {
+		t.Errorf("ApplyRebuild() current counts = %v, want the counts read under the lock", applied.CurrentCounts)
+	}
+	if counts := readCounts("rebuild-group"); counts["user1"] != 2 || counts["user2"] != 1 {
+		t.Errorf("counts after ApplyRebuild() = %v", counts)
+	}
+	if idx := readLastIndex("rebuild-group"); idx != 0 {
+		t.Errorf("last index after ApplyRebuild() = %d, want 0", idx)
+	}
+
+	if _, err := RebuildCounts("missing-group"); err == nil {
+		t.Error("RebuildCounts() on missing group should return error")
+	}
+}
+
+func TestSetCursor(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\naliases: {carol: [cjones]}\n")
+	if err := os.WriteFile(filepath.Join(testDir, "cursor-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := Assign("cursor-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+
+	tests := []struct {
+		user     string
+		last     bool
+		wantNext string
+		wantErr  bool
+	}{
+		{"carol", false, "carol", false},
+		{"alice", false, "alice", false},
+		{"cjones", true, "alice", false}, // by alias, wrapping around
+		{"bob", true, "carol", false},
+		{"dave", false, "", true},
+	}
+	for _, tt := range tests {
+		next, err := SetCursor(context.Background(), "cursor-group", tt.user, tt.last)
+		if (err != nil) != tt.wantErr || next != tt.wantNext {
+			t.Errorf("SetCursor(%s, %v) = %q, %v, want %q", tt.user, tt.last, next, err, tt.wantNext)
+		}
+	}
+
+	// The cursor survives fsck and rebuilds until the next assignment uses it
+	if issues, err := CheckGroup("cursor-group"); err != nil || len(issues) != 0 {
+		t.Errorf("CheckGroup() after SetCursor() = %v, %v, want no issues", issues, err)
+	}
+	if rebuild, err := RebuildCounts("cursor-group"); err != nil || rebuild.RebuiltIndex != 1 {
+		t.Errorf("RebuildCounts() after SetCursor() = %+v, %v, want the cursor's index 1", rebuild, err)
+	}
+	result, err := AssignUser(context.Background(), "cursor-group", AssignOptions{Silent: true})
+	if err != nil || result.User != "carol" {
+		t.Errorf("AssignUser() after SetCursor() = %+v, %v, want carol", result, err)
+	}
+	if _, err := SetCursor(context.Background(), "missing-group", "alice", false); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("SetCursor() of a missing group error = %v, want ErrInvalidGroup", err)
+	}
+
+	// The cursor isn't moved while an assignment holds the lock
+	release, err := lockGroup(context.Background(), "cursor-group")
+	if err != nil {
+		t.Fatalf("lockGroup() error = %v", err)
+	}
+	defer release()
+	if _, err := SetCursor(WithLockWait(context.Background(), 0), "cursor-group", "alice", false); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("SetCursor() while the group is locked error = %v, want ErrLockTimeout", err)
+	}
+}
+
+func TestCheckAndRepairGroup(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers:\n  - user1\n  - user2\n")
+	if err := os.WriteFile(filepath.Join(testDir, "fsck-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := Assign("fsck-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+
+	issues, err := CheckGroup("fsck-group")
+	if err != nil {
+		t.Fatalf("CheckGroup() error = %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("CheckGroup() on consistent state = %v, want no issues", issues)
+	}
+
+	// Orphaned user, wrong count and an index past the user list
+	if err := writeCounts("fsck-group", map[string]int{"user1": 3, "user2": 0, "gone": 2}); err != nil {
+		t.Fatalf("writeCounts() error = %v", err)
+	}
+	if err := writeLastIndex("fsck-group", 5); err != nil {
+		t.Fatalf("writeLastIndex() error = %v", err)
+	}
+
+	issues, err = CheckGroup("fsck-group")
+	if err != nil {
+		t.Fatalf("CheckGroup() error = %v", err)
+	}
+	if len(issues) != 3 {
+		t.Errorf("CheckGroup() = %v, want 3 issues", issues)
+	}
+
+	if err := RepairGroup(context.Background(), "fsck-group"); err != nil {
+		t.Fatalf("RepairGroup() error = %v", err)
+	}
+	issues, err = CheckGroup("fsck-group")
+	if err != nil {
+		t.Fatalf("CheckGroup() error = %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("CheckGroup() after repair = %v, want no issues", issues)
+	}
+
+	// Reset counts are compared with the assignments logged since, and kept by a repair
+	if err := ResetCounts(context.Background(), "fsck-group"); err != nil {
+		t.Fatalf("ResetCounts() error = %v", err)
+	}
+	if err := Assign("fsck-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if issues, err := CheckGroup("fsck-group"); err != nil || len(issues) != 0 {
+		t.Errorf("CheckGroup() after reset = %v, %v, want no issues", issues, err)
+	}
+	if err := writeCounts("fsck-group", map[string]int{"user1": 4, "user2": 4}); err != nil {
+		t.Fatalf("writeCounts() error = %v", err)
+	}
+	if issues, err := CheckGroup("fsck-group"); err != nil || len(issues) != 2 {
+		t.Errorf("CheckGroup() after reset = %v, %v, want 2 issues", issues, err)
+	}
+	if err := RepairGroup(context.Background(), "fsck-group"); err != nil {
+		t.Fatalf("RepairGroup() error = %v", err)
+	}
+	if counts := readCounts("fsck-group"); counts["user1"]+counts["user2"] != 1 {
+		t.Errorf("counts after repairing a reset group = %v, want only the assignment since the reset", counts)
+	}
+	if issues, err := CheckGroup("fsck-group"); err != nil || len(issues) != 0 {
+		t.Errorf("CheckGroup() after repairing a reset group = %v, %v, want no issues", issues, err)
+	}
+
+	// Nothing is repaired while an assignment holds the lock
+	release, err := lockGroup(context.Background(), "fsck-group")
+	if err != nil {
+		t.Fatalf("lockGroup() error = %v", err)
+	}
+	defer release()
+	if err := RepairGroup(WithLockWait(context.Background(), 0), "fsck-group"); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("RepairGroup() while the group is locked error = %v, want ErrLockTimeout", err)
+	}
+}
+
+func TestAssignWithSeed(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: random\navailability_checker: always_available\nusers: [u0, u1, u2, u3, u4, u5, u6, u7]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "seed-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	seed := int64(7)
+	var picks []int
+	for i := 0; i < 2; i++ {
+		if err := AssignWithOptions(context.Background(), "seed-group", AssignOptions{Seed: &seed}); err != nil {
+			t.Fatalf("AssignWithOptions() error = %v", err)
+		}
+		picks = append(picks, readLastIndex("seed-group"))
+	}
+	if picks[0] != picks[1] {
+		t.Errorf("seeded assignments picked %v, want the same index twice", picks)
+	}
+}
+
+// setupLargeGroup creates a group with the given number of users and an
+// index and assignment history of the given length.
+func setupLargeGroup(b *testing.B, users, history int) string {
+	b.Helper()
+	testDir := b.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	groupConfig := AssigneeGroupConfig{Strategy: "least_assigned", AvailabilityChecker: "always_available"}
+	for i := 0; i < users; i++ {
+		groupConfig.Users = append(groupConfig.Users, fmt.Sprintf("user%d", i))
+	}
+	configData, err := yaml.Marshal(groupConfig)
+	if err != nil {
+		b.Fatalf("Failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, "large-group.yaml"), configData, 0644); err != nil {
+		b.Fatalf("Failed to write config file: %v", err)
+	}
+
+	groupDir := filepath.Join(config.Settings.Storage.DataDir, "large-group")
+	if err := os.MkdirAll(groupDir, 0755); err != nil {
+		b.Fatalf("Failed to create data dir: %v", err)
+	}
+	var index, log strings.Builder
+	for i := 0; i < history; i++ {
+		fmt.Fprintf(&index, "2024-01-01T00:00:00Z -- %d\n", i%users)
+		fmt.Fprintf(&log, `{"schema_version":2,"group":"large-group","user":"user%d","next_index":%d}`+"\n", i%users, i%users)
+	}
+	if err := os.WriteFile(filepath.Join(groupDir, "index.log"), []byte(index.String()), 0644); err != nil {
+		b.Fatalf("Failed to write index: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(groupDir, "assignments.log"), []byte(log.String()), 0644); err != nil {
+		b.Fatalf("Failed to write log: %v", err)
+	}
+	return "large-group"
+}
+
+func BenchmarkAssignLargeGroup(b *testing.B) {
+	group := setupLargeGroup(b, 1000, 100000)
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	defer func() { os.Stdout = stdout }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Assign(group, false); err != nil {
+			b.Fatalf("Assign() error = %v", err)
+		}
+	}
+}
+
+func BenchmarkReadLastIndexLongHistory(b *testing.B) {
+	group := setupLargeGroup(b, 10, 100000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if idx := readLastIndex(group); idx != 9 {
+			b.Fatalf("readLastIndex() = %d, want 9", idx)
+		}
+	}
+}
+
+func BenchmarkGetCountsLargeGroup(b *testing.B) {
+	group := setupLargeGroup(b, 1000, 0)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := GetCounts(group); err != nil {
+			b.Fatalf("GetCounts() error = %v", err)
+		}
+	}
+}
+
+func TestReadLastLine(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("x", 5000)
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"single line", "a -- 1", "a -- 1"},
+		{"trailing newlines", "a -- 1\nb -- 2\n\n", "b -- 2"},
+		{"line longer than chunk", "a -- 1\n" + long + "\n", long},
+		{"last line after long line", long + "\nb -- 2\n", "b -- 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "index.log")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+			got, err := readLastLine(path)
+			if err != nil {
+				t.Fatalf("readLastLine() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("readLastLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingLogger is an AssignmentLogger that always fails.
+type failingLogger struct{}
+
+func (l *failingLogger) LogAssignment(ctx context.Context, entry AssignmentLog) error {
+	return fmt.Errorf("disk full")
+}
+
+func TestAssignRollsBackOnFailure(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers:\n  - user1\n  - user2\n")
+	if err := os.WriteFile(filepath.Join(testDir, "tx-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := Assign("tx-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+
+	factory := NewComponentFactory(
+		&DefaultConfigLoader{},
+		&DefaultStorageManager{},
+		&DefaultCountManager{},
+		&failingLogger{},
+	)
+	if _, err := assign(context.Background(), factory, "tx-group", AssignOptions{}); err == nil {
+		t.Fatal("assign() with failing logger should return error")
+	}
+
+	if idx := readLastIndex("tx-group"); idx != 0 {
+		t.Errorf("last index after rollback = %d, want 0", idx)
+	}
+	if counts := readCounts("tx-group"); counts["user1"] != 1 || counts["user2"] != 0 {
+		t.Errorf("counts after rollback = %v, want user1=1 user2=0", counts)
+	}
+	issues, err := CheckGroup("tx-group")
+	if err != nil {
+		t.Fatalf("CheckGroup() error = %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("CheckGroup() after rollback = %v, want no issues", issues)
+	}
+}
+
+func TestStateMigration(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n")
+	for _, group := range []string{"legacy-group", "migrated-group"} {
+		if err := os.WriteFile(filepath.Join(testDir, group+".yaml"), configData, 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+	writeLegacy := func(group string) string {
+		t.Helper()
+		groupDir, err := config.GetGroupDataDir(group)
+		if err != nil {
+			t.Fatalf("GetGroupDataDir() error = %v", err)
+		}
+		files := map[string]string{
+			"index.log":   "2024-05-14T10:00:00Z -- 2\n2024-05-15T10:00:00Z -- 0\n",
+			"counts.json": `{"alice": 3, "bob": 2}`,
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(groupDir, name), []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", name, err)
+			}
+		}
+		return groupDir
+	}
+	groupDir := writeLegacy("legacy-group")
+	writeLegacy("migrated-group")
+
+	// The files of layout version 1 are read until the state is written
+	if idx := readLastIndex("legacy-group"); idx != 0 {
+		t.Errorf("readLastIndex() of legacy files = %d, want 0", idx)
+	}
+	if counts := readCounts("legacy-group"); counts["alice"] != 3 || counts["bob"] != 2 {
+		t.Errorf("readCounts() of legacy files = %v, want alice=3 bob=2", counts)
+	}
+	legacy, err := FindLegacyState()
+	if err != nil || len(legacy) != 2 {
+		t.Fatalf("FindLegacyState() = %v, %v, want both groups", legacy, err)
+	}
+
+	// A failed assignment leaves the legacy files as they were
+	factory := NewComponentFactory(&DefaultConfigLoader{}, &DefaultStorageManager{}, &DefaultCountManager{}, &failingLogger{})
+	if _, err := assign(context.Background(), factory, "legacy-group", AssignOptions{}); err == nil {
+		t.Fatal("assign() with failing logger should return error")
+	}
+	if data, _ := os.ReadFile(filepath.Join(groupDir, "index.log")); !strings.HasSuffix(string(data), "-- 0\n") {
+		t.Errorf("index.log after rollback = %q, want it restored", data)
+	}
+	if _, err := os.Stat(filepath.Join(groupDir, "state.json")); !os.IsNotExist(err) {
+		t.Errorf("state.json exists after rollback: %v", err)
+	}
+
+	// The first assignment migrates the state
+	result, err := AssignUser(context.Background(), "legacy-group", AssignOptions{Silent: true})
+	if err != nil || result.User != "bob" {
+		t.Fatalf("AssignUser() = %+v, %v, want bob", result, err)
+	}
+	for _, name := range []string{"index.log", "counts.json"} {
+		if _, err := os.Stat(filepath.Join(groupDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after migration: %v", name, err)
+		}
+	}
+	var state storedState
+	data, err := os.ReadFile(filepath.Join(groupDir, "state.json"))
+	if err != nil || json.Unmarshal(data, &state) != nil {
+		t.Fatalf("Failed to read state.json: %v: %s", err, data)
+	}
+	if state.Version != stateLayoutVersion || state.Cursor == nil || state.Cursor.Index != 1 || state.Counts.totals()["bob"] != 3 || state.Counts.totals()["alice"] != 3 {
+		t.Errorf("state.json = %s, want version 2 with index 1 and counts alice=3 bob=3", data)
+	}
+
+	// Groups not assigned since are migrated explicitly
+	if migrated, err := MigrateState(context.Background(), "migrated-group"); err != nil || !migrated {
+		t.Errorf("MigrateState() = %v, %v, want true", migrated, err)
+	}
+	if migrated, err := MigrateState(context.Background(), "migrated-group"); err != nil || migrated {
+		t.Errorf("MigrateState() of a migrated group = %v, %v, want false", migrated, err)
+	}
+	if idx := readLastIndex("migrated-group"); idx != 0 {
+		t.Errorf("readLastIndex() after MigrateState() = %d, want 0", idx)
+	}
+	if legacy, err := FindLegacyState(); err != nil || len(legacy) != 0 {
+		t.Errorf("FindLegacyState() after migration = %v, %v, want none", legacy, err)
+	}
+
+	// State written by a newer layout is not misread
+	if err := os.WriteFile(filepath.Join(groupDir, "state.json"), []byte(`{"version": 3}`), 0644); err != nil {
+		t.Fatalf("Failed to write state: %v", err)
+	}
+	if _, err := readCountBuckets("legacy-group"); err == nil {
+		t.Error("readCountBuckets() of state version 3 succeeded, want an error")
+	}
+}
+
+func TestStrategyOverride(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "override-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	ctx := context.Background()
+	assign := func(strategy string) (string, error) {
+		result, err := AssignUser(ctx, "override-group", AssignOptions{Strategy: strategy, Silent: true})
+		if err != nil {
+			return "", err
+		}
+		return result.User, nil
+	}
+
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{"", "alice"},
+		{"least_assigned", "bob"}, // The rotation stays at alice
+		{"", "bob"},
+		{"round_robin", "carol"}, // Same as configured, no override
+		{"least_assigned", "alice"},
+	}
+	for i, tt := range tests {
+		if got, err := assign(tt.strategy); err != nil || got != tt.want {
+			t.Errorf("#%d assign with strategy %q = %s, %v, want %s", i, tt.strategy, got, err, tt.want)
+		}
+	}
+	if _, err := assign("coin_flip"); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("assign with unknown strategy error = %v, want ErrInvalidOption", err)
+	}
+
+	records, err := history.ReadFile(filepath.Join(testDir, "data", "override-group", "assignments.log"))
+	if err != nil || len(records) != len(tests) {
+		t.Fatalf("ReadFile() = %d records, %v, want %d", len(records), err, len(tests))
+	}
+	for i, tt := range tests {
+		wantStrategy, wantOverridden := "round_robin", ""
+		if tt.strategy == "least_assigned" {
+			wantStrategy, wantOverridden = "least_assigned", "round_robin"
+		}
+		if r := records[i]; r.Strategy != wantStrategy || r.Metadata["overridden_strategy"] != wantOverridden {
+			t.Errorf("record %d = strategy %s, overridden %q, want %s, %q", i, r.Strategy, r.Metadata["overridden_strategy"], wantStrategy, wantOverridden)
+		}
+	}
+
+	// Replaying the log selects what the overrides did
+	result, err := Replay(ctx, "override-group", filepath.Join(testDir, "data", "override-group", "assignments.log"))
+	if err != nil || len(result.Divergences) != 0 {
+		t.Errorf("Replay() = %+v, %v, want no divergences", result, err)
+	}
+}
+
+func TestAvailabilityCheckerOverride(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	// In/Out is down; the group can only be assigned from by bypassing it
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+
+	configData := []byte("strategy: round_robin\navailability_checker: inout\nusers: [alice, bob]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "flaky-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := AssignUser(ctx, "flaky-group", AssignOptions{Silent: true}); !errors.Is(err, ErrAvailability) {
+		t.Fatalf("AssignUser() error = %v, want ErrAvailability", err)
+	}
+	mu.Lock()
+	calls = 0
+	mu.Unlock()
+	result, err := AssignUser(ctx, "flaky-group", AssignOptions{Availability: "always_available", Silent: true})
+	if err != nil || result.User != "alice" {
+		t.Fatalf("AssignUser() with always_available = %+v, %v, want alice", result, err)
+	}
+	mu.Lock()
+	if calls != 0 {
+		t.Errorf("In/Out was called %d times despite the override", calls)
+	}
+	mu.Unlock()
+	if _, err := AssignUser(ctx, "flaky-group", AssignOptions{Availability: "crystal_ball", Silent: true}); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("AssignUser() with unknown checker error = %v, want ErrInvalidOption", err)
+	}
+
+	records, err := history.ReadFile(filepath.Join(testDir, "data", "flaky-group", "assignments.log"))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ReadFile() = %d records, %v, want 1", len(records), err)
+	}
+	if got := records[0].Metadata["overridden_availability_checker"]; got != "inout" {
+		t.Errorf("record overridden_availability_checker = %q, want inout", got)
+	}
+
+	// The override doesn't change the group
+	conf, err := loadAssigneeGroupConfig("flaky-group")
+	if err != nil || conf.AvailabilityChecker != "inout" {
+		t.Errorf("loadAssigneeGroupConfig() checker = %v, %v, want inout", conf, err)
+	}
+}
+
+func TestAssignmentReason(t *testing.T) {
+	counts := map[string]int{"alice": 3, "bob": 1}
+	tests := []struct {
+		strategy AssignmentStrategy
+		name     string
+		skipped  int
+		want     string
+	}{
+		{&selector.RoundRobin{}, "round_robin", 0, "round_robin next"},
+		{&selector.LeastAssigned{}, "least_assigned", 0, "least_assigned count=3"},
+		{&selector.OpenLoad{Open: map[string]int{"alice": 2}}, "open_load", 0, "open_load open=2"},
+		{&selector.Random{}, "random", 0, "random pick"},
+		{&selector.SkipDebt{Inner: &selector.RoundRobin{}, Debts: map[string]int{"alice": 2}}, "round_robin", 0, "skip_debt owed=2"},
+		{&selector.SkipDebt{Inner: &selector.LeastAssigned{}, Debts: map[string]int{"bob": 1}}, "least_assigned", 0, "least_assigned count=3"},
+		{&selector.RoundRobin{}, "round_robin", 1, "fallback after 1 skip"},
+		{&selector.LeastAssigned{}, "least_assigned", 2, "fallback after 2 skips"},
+	}
+	for _, tt := range tests {
+		if got := assignmentReason(tt.strategy, tt.name, "alice", counts, tt.skipped); got != tt.want {
+			t.Errorf("assignmentReason(%s, %d skipped) = %q, want %q", tt.name, tt.skipped, got, tt.want)
+		}
+	}
+
+	// The reason is returned and logged with the assignment
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\nnever_available: [alice, bob]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "reason-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	result, err := AssignUser(context.Background(), "reason-group", AssignOptions{Silent: true})
+	if err != nil || result.User != "carol" || result.Reason != "fallback after 2 skips" {
+		t.Fatalf("AssignUser() = %+v, %v, want carol as fallback after 2 skips", result, err)
+	}
+	records, err := history.ReadFile(filepath.Join(testDir, "data", "reason-group", "assignments.log"))
+	if err != nil || len(records) != 1 || records[0].Metadata["reason"] != result.Reason {
+		t.Errorf("ReadFile() = %+v, %v, want the reason in the metadata", records, err)
+	}
+}
+
+func TestAssignCancelledContext(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers:\n  - user1\n")
+	if err := os.WriteFile(filepath.Join(testDir, "ctx-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := AssignWithOptions(ctx, "ctx-group", AssignOptions{}); err == nil {
+		t.Error("AssignWithOptions() with cancelled context should return error")
+	}
+	if idx := readLastIndex("ctx-group"); idx != -1 {
+		t.Errorf("last index after cancelled assignment = %d, want -1", idx)
+	}
+}
+
+func TestErrorClasses(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		sentinel error
+		inner    error
+	}{
+		{"config", &ConfigError{Group: "g", Err: os.ErrPermission}, ErrConfig, os.ErrPermission},
+		{"selection", &SelectionError{Group: "g", Err: os.ErrInvalid}, ErrSelection, os.ErrInvalid},
+		{"availability", &AvailabilityError{User: "u", Err: context.DeadlineExceeded}, ErrAvailability, context.DeadlineExceeded},
+		{"no assignee", &NoAvailableAssigneeError{Group: "g"}, ErrNoAvailableAssignee, nil},
+		{"invalid group", &InvalidGroupError{Group: "g"}, ErrInvalidGroup, ErrConfig},
+		{"group disabled", &GroupDisabledError{Group: "g"}, ErrGroupDisabled, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := fmt.Errorf("outer: %w", tt.err)
+			if !errors.Is(wrapped, tt.sentinel) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", wrapped, tt.sentinel)
+			}
+			if tt.inner != nil && !errors.Is(wrapped, tt.inner) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", wrapped, tt.inner)
+			}
+			if errors.Is(wrapped, errors.New("other")) {
+				t.Errorf("errors.Is(%v, other) = true, want false", wrapped)
+			}
+		})
+	}
+
+	config.Settings.Storage.ConfDir = config.DirList{t.TempDir()}
+	err := Assign("missing-group", false)
+	var groupErr *InvalidGroupError
+	if !errors.As(err, &groupErr) || groupErr.Group != "missing-group" {
+		t.Errorf("Assign() on missing group error = %v, want *InvalidGroupError", err)
+	}
+}
+
+func TestComponentNames(t *testing.T) {
+	factory := NewComponentFactory(nil, nil, nil, nil)
+	for _, name := range StrategyNames {
+		if _, err := factory.CreateAssignmentStrategy(name, StrategyOptions{}); err != nil {
+			t.Errorf("CreateAssignmentStrategy(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range AvailabilityCheckerNames {
+		if _, err := factory.CreateAvailabilityChecker(name); err != nil {
+			t.Errorf("CreateAvailabilityChecker(%q) error = %v", name, err)
+		}
+	}
+}
+
+func TestCachedAvailabilityChecker(t *testing.T) {
+	saved := config.Settings.Availability.Cache
+	defer func() { config.Settings.Availability.Cache = saved }()
+	config.Settings.Availability.Cache = config.CheckerCacheConfig{TTLSeconds: 60, Checkers: map[string]int{"always_available": 0}}
+
+	factory := NewComponentFactory(nil, nil, nil, nil)
+	first, err := factory.CreateAvailabilityChecker("inout")
+	if err != nil {
+		t.Fatalf("CreateAvailabilityChecker() error = %v", err)
+	}
+	if _, ok := first.(interface{ Unwrap() availability.Checker }); !ok {
+		t.Errorf("CreateAvailabilityChecker(inout) = %T, want a cached checker", first)
+	}
+	// Every factory shares the cache
+	if second, _ := newStateFactory().CreateAvailabilityChecker("inout"); second != first {
+		t.Error("CreateAvailabilityChecker(inout) should return the same cached checker")
+	}
+	checker, _ := factory.CreateAvailabilityChecker("always_available")
+	if _, ok := checker.(*availability.AlwaysAvailable); !ok {
+		t.Errorf("CreateAvailabilityChecker(always_available) = %T, want it uncached", checker)
+	}
+}
+
+func TestDeclineBudget(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\nusers: [alice, bob]\ndecline_budget:\n  max: 2\n  period: week\n")
+	if err := os.WriteFile(filepath.Join(testDir, "decline-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	ctx := context.Background()
+	for i := 1; i <= 2; i++ {
+		status, err := Decline(ctx, "decline-group", "alice", "busy")
+		if err != nil {
+			t.Fatalf("Decline() #%d error = %v", i, err)
+		}
+		if status.Used["alice"] != i {
+			t.Errorf("Decline() #%d used = %d, want %d", i, status.Used["alice"], i)
+		}
+	}
+	if _, err := Decline(ctx, "decline-group", "alice", ""); !errors.Is(err, ErrDeclineBudget) {
+		t.Errorf("Decline() over budget error = %v, want ErrDeclineBudget", err)
+	}
+	if _, err := Decline(ctx, "decline-group", "bob", ""); err != nil {
+		t.Errorf("Decline() for bob error = %v", err)
+	}
+	if _, err := Decline(ctx, "decline-group", "carol", ""); !errors.Is(err, ErrConfig) {
+		t.Errorf("Decline() for non-member error = %v, want ErrConfig", err)
+	}
+
+	status, err := GetDeclineStatus(ctx, "decline-group")
+	if err != nil {
+		t.Fatalf("GetDeclineStatus() error = %v", err)
+	}
+	if status.Used["alice"] != 2 || status.Used["bob"] != 1 || status.Budget.Period != PeriodWeek {
+		t.Errorf("GetDeclineStatus() = %+v, want alice 2, bob 1 per week", status)
+	}
+
+	// Concurrent declines count against the budget one at a time
+	configData = []byte("strategy: round_robin\nusers: [alice]\ndecline_budget:\n  max: 3\n")
+	if err := os.WriteFile(filepath.Join(testDir, "busy-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	var wg sync.WaitGroup
+	var declined, rejected atomic.Int32
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Decline(ctx, "busy-group", "alice", "")
+			switch {
+			case err == nil:
+				declined.Add(1)
+			case errors.Is(err, ErrDeclineBudget):
+				rejected.Add(1)
+			default:
+				t.Errorf("concurrent Decline() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if declined.Load() != 3 || rejected.Load() != 37 {
+		t.Errorf("concurrent Decline() recorded %d and rejected %d, want 3 and 37", declined.Load(), rejected.Load())
+	}
+	if status, err := GetDeclineStatus(ctx, "busy-group"); err != nil || status.Used["alice"] != 3 {
+		t.Errorf("GetDeclineStatus() after concurrent declines = %+v, %v, want alice 3", status, err)
+	}
+
+	// Only missing groups are invalid; broken configs are reported as such
+	if err := os.WriteFile(filepath.Join(testDir, "broken-group.yaml"), []byte("stratgy: round_robin\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if _, err := GetDeclineStatus(ctx, "missing-group"); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("GetDeclineStatus() of a missing group error = %v, want ErrInvalidGroup", err)
+	}
+	if _, err := GetDeclineStatus(ctx, "broken-group"); !errors.Is(err, ErrConfig) || errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("GetDeclineStatus() of a broken group error = %v, want ErrConfig", err)
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2024, 5, 16, 15, 30, 0, 0, time.UTC) // a Thursday
+	tests := []struct {
+		period string
+		want   time.Time
+	}{
+		{PeriodDay, time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{PeriodWeek, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonth, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := periodStart(tt.period, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("periodStart(%q) = %v, %v, want %v", tt.period, got, err, tt.want)
+		}
+	}
+	if _, err := periodStart("year", now); err == nil {
+		t.Error("periodStart(\"year\") error = nil, want error")
+	}
+}
+
+func TestCountBuckets(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "bucket-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	groupDir, err := config.GetGroupDataDir("bucket-group")
+	if err != nil {
+		t.Fatalf("GetGroupDataDir() error = %v", err)
+	}
+
+	// Flat counts of earlier versions become the base
+	if err := os.WriteFile(filepath.Join(groupDir, "counts.json"), []byte(`{"alice": 5}`), 0644); err != nil {
+		t.Fatalf("Failed to write counts file: %v", err)
+	}
+	if counts := readCounts("bucket-group"); counts["alice"] != 5 || counts["bob"] != 0 {
+		t.Fatalf("readCounts() of flat file = %v, want alice=5 bob=0", counts)
+	}
+
+	increments := []struct {
+		user string
+		at   time.Time
+	}{
+		{"alice", time.Date(2024, 4, 30, 10, 0, 0, 0, time.Local)},
+		{"bob", time.Date(2024, 5, 13, 10, 0, 0, 0, time.Local)},
+		{"alice", time.Date(2024, 5, 15, 9, 0, 0, 0, time.Local)},
+		{"bob", time.Date(2024, 5, 15, 11, 0, 0, 0, time.Local)},
+	}
+	for _, inc := range increments {
+		timeNow = func() time.Time { return inc.at }
+		if err := incrementCount("bucket-group", inc.user); err != nil {
+			t.Fatalf("incrementCount() error = %v", err)
+		}
+	}
+	if counts := readCounts("bucket-group"); counts["alice"] != 7 || counts["bob"] != 2 {
+		t.Errorf("readCounts() = %v, want alice=7 bob=2", counts)
+	}
+
+	timeNow = func() time.Time { return time.Date(2024, 5, 15, 12, 0, 0, 0, time.Local) }
+	tests := []struct {
+		period string
+		want   map[string]int
+	}{
+		{PeriodDay, map[string]int{"alice": 1, "bob": 1}},
+		{PeriodWeek, map[string]int{"alice": 1, "bob": 2}},
+		{PeriodMonth, map[string]int{"alice": 1, "bob": 2}},
+	}
+	for _, tt := range tests {
+		got, err := PeriodCounts("bucket-group", tt.period)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("PeriodCounts(%q) = %v, %v, want %v", tt.period, got, err, tt.want)
+		}
+	}
+	if _, err := PeriodCounts("bucket-group", "year"); err == nil {
+		t.Error("PeriodCounts(\"year\") error = nil, want error")
+	}
+
+	// The file is rewritten in the bucketed format
+	buckets, err := readCountBuckets("bucket-group")
+	if err != nil || buckets.Version != countsSchemaVersion || buckets.Base["alice"] != 5 || len(buckets.Days) != 3 {
+		t.Errorf("readCountBuckets() = %+v, %v, want version %d with base alice=5 and 3 days", buckets, err, countsSchemaVersion)
+	}
+
+	// Lowering a count below the user's daily counts drops them
+	if err := writeCounts("bucket-group", map[string]int{"alice": 7, "bob": 0}); err != nil {
+		t.Fatalf("writeCounts() error = %v", err)
+	}
+	if got, _ := PeriodCounts("bucket-group", PeriodWeek); got["alice"] != 1 || got["bob"] != 0 {
+		t.Errorf("PeriodCounts(week) after writeCounts() = %v, want alice=1 bob=0", got)
+	}
+
+	// Counts aren't reset while an assignment holds the lock
+	release, err := lockGroup(context.Background(), "bucket-group")
+	if err != nil {
+		t.Fatalf("lockGroup() error = %v", err)
+	}
+	if err := ResetCounts(WithLockWait(context.Background(), 0), "bucket-group"); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("ResetCounts() while the group is locked error = %v, want ErrLockTimeout", err)
+	}
+	release()
+	if err := ResetCounts(context.Background(), "bucket-group"); err != nil {
+		t.Fatalf("ResetCounts() error = %v", err)
+	}
+	if got, _ := PeriodCounts("bucket-group", PeriodMonth); got["alice"] != 0 || got["bob"] != 0 {
+		t.Errorf("PeriodCounts(month) after ResetCounts() = %v, want zeros", got)
+	}
+	if counts := readCounts("bucket-group"); counts["alice"] != 0 {
+		t.Errorf("readCounts() after ResetCounts() = %v, want zeros", counts)
+	}
+}
+
+func TestValidateGroup(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status/alice" && r.URL.Path != "/status/bob.b" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"inOutLocation": "OFFICE"}`)
+	}))
+	defer server.Close()
+	savedAvailability, savedIdentity := config.Settings.Availability, config.Settings.Identity
+	defer func() { config.Settings.Availability, config.Settings.Identity = savedAvailability, savedIdentity }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+	config.Settings.Identity = config.IdentityConfig{Users: map[string]map[string]string{
+		"alice": {"github": "alice-gh"},
+		"bob":   {"github": "bob-gh"},
+	}}
+
+	groups := map[string]string{
+		"valid-group":     "strategy: round_robin\navailability_checker: inout\nusers: [alice, bob]\navailability_ids: {bob: bob.b}\n",
+		"typo-group":      "strategy: round_robin\navailability_checker: inout\nusers: [alice, alcie]\n",
+		"unknown-group":   "strategy: fastest\navailability_checker: always_available\nusers: [alice]\nroles:\n  qa: {tags: [qa]}\n",
+		"malformed-group": "stratgy: round_robin\nusers: [alice]\n",
+		"limits-group":    "strategy: round_robin\navailability_checker: always_available\nusers: [alice]\nlimits: {cooldown: soon}\nuser_limits: {alice: {max_per_day: -1}}\n",
+		"override-group":  "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bot]\nnever_available: [bot, carol]\nalways_available: [bot]\n",
+		"load-group":      "strategy: open_load\navailability_checker: always_available\nusers: [alice]\n",
+		"jira-group":      "strategy: open_load\nstrategy_options: {workload: jira}\navailability_checker: always_available\nusers: [alice]\n",
+		"workload-group":  "strategy: least_assigned\nstrategy_options: {workload: tickets}\navailability_checker: always_available\nusers: [alice]\n",
+	}
+	for name, data := range groups {
+		if err := os.WriteFile(filepath.Join(testDir, name+".yaml"), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		group      string
+		checkUsers bool
+		want       int
+	}{
+		{"valid-group", true, 0},
+		{"typo-group", false, 0},
+		{"typo-group", true, 2}, // unknown to In/Out and the identity mapping
+		{"unknown-group", false, 2},
+		{"malformed-group", false, 1},
+		{"limits-group", false, 1},   // validation stops at the first invalid limit
+		{"override-group", false, 2}, // carol is not in the group, bot is in both lists
+		{"load-group", false, 1},     // open_load without track_open
+		{"jira-group", false, 0},     // the workload comes from Jira instead
+		{"workload-group", false, 1}, // unknown workload provider
+	}
+	for _, tt := range tests {
+		issues, err := ValidateGroup(ctx, tt.group, tt.checkUsers)
+		if err != nil || len(issues) != tt.want {
+			t.Errorf("ValidateGroup(%s, %v) = %q, %v, want %d issues", tt.group, tt.checkUsers, issues, err, tt.want)
+		}
+	}
+	if _, err := ValidateGroup(ctx, "missing-group", false); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("ValidateGroup() of a missing group error = %v, want ErrInvalidGroup", err)
+	}
+}
+
+func TestLint(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	groups := map[string]string{
+		"clean":   "strategy: least_assigned\navailability_checker: always_available\nusers: [alice, bob]\nlimits: {max_per_day: 2, max_per_week: 5}\n",
+		"single":  "strategy: least_assigned\navailability_checker: always_available\nusers: [alice]\n",
+		"routed":  "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, bot]\nnever_available: [bot]\npriorities:\n  P1: {users: [alice], strategy: least_assigned}\n  P2: {users: [bot]}\n  P3: {users: [carol]}\nroles:\n  qa: {users: [bot]}\n",
+		"limited": "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\nlimits: {max_per_day: 3, max_per_week: 2}\nuser_limits:\n  bob: {max_per_day: 1, max_per_week: 10}\n  carol: {max_per_day: 1}\n",
+		"renamed": "strategy: round_robin\navailability_checker: always_available\nusers: [alice, robert]\n",
+		"invalid": "strategy: fastest\navailability_checker: always_available\nusers: [alice]\n",
+	}
+	for name, data := range groups {
+		if err := os.WriteFile(filepath.Join(testDir, name+".yaml"), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+	if err := writeCounts("renamed", map[string]int{"alice": 2, "robert": 1, "roberto": 4, "mallory": 1}); err != nil {
+		t.Fatalf("Failed to write counts: %v", err)
+	}
+
+	tests := []struct {
+		group string
+		want  []string // Rule and line of every finding
+	}{
+		{"clean", nil},
+		{"single", []string{"nothing-to-balance:1"}},
+		{"routed", []string{"nothing-to-balance:6", "nobody-available:7", "priority-route:8", "nobody-available:10"}},
+		{"limited", []string{"ineffective-limit:4", "ineffective-limit:6", "unknown-limit-user:7"}},
+		{"renamed", []string{"stale-counts:3", "stale-counts:3"}},
+		{"invalid", []string{"invalid-config:0"}},
+	}
+	for _, tt := range tests {
+		findings, err := LintGroup(tt.group)
+		var got []string
+		for _, finding := range findings {
+			got = append(got, fmt.Sprintf("%s:%d", finding.Rule, finding.Line))
+		}
+		if err != nil || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("LintGroup(%s) = %v, %v, want %v", tt.group, got, err, tt.want)
+		}
+	}
+	findings, _ := LintGroup("renamed")
+	if len(findings) != 2 || !strings.Contains(findings[1].Suggestion, "autoassigner user rename renamed roberto robert") || strings.Contains(findings[0].Suggestion, "rename") {
+		t.Errorf("LintGroup(renamed) suggestions = %+v, want a rename for roberto only", findings)
+	}
+	if _, err := LintGroup("missing"); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("LintGroup() of a missing group error = %v, want ErrInvalidGroup", err)
+	}
+
+	saved := config.Settings.Routes
+	defer func() { config.Settings.Routes = saved }()
+	config.Settings.Routes = []config.RouteConfig{
+		{Repo: "acme/api", Labels: []string{"security"}, Group: "single"},
+		{Repo: "acme/api", Labels: []string{"security", "urgent"}, Group: "clean"},
+		{Repo: "acme/*", Title: "hotfix", Group: "clean"},
+		{Repo: "acme/web", Title: "hotfix", Labels: []string{"ui"}, Group: "clean"},
+		{Repo: "acme/*", Group: "routd"},
+		{Repo: "acme/api", Paths: []string{"api/**"}, Group: "clean"},
+	}
+	findings, err := LintRoutes()
+	var got []string
+	for _, finding := range findings {
+		got = append(got, finding.Rule+" "+finding.Message[:7]+" "+finding.Suggestion)
+	}
+	want := []string{
+		"unreachable-route route 4 move route 4 before route 3 or remove it",
+		"unknown-route-group route 5 did you mean routed?",
+		"unreachable-route route 6 move route 6 before route 5 or remove it",
+	}
+	if err != nil || strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("LintRoutes() = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestSaveGroupConfig(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{filepath.Join(testDir, "conf")}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	valid := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	tests := []struct {
+		name    string
+		group   string
+		data    string
+		wantErr error
+		want    string // Issue the error must describe
+	}{
+		{"valid", "team", valid, nil, ""},
+		{"unknown strategy", "team", "strategy: fastest\nusers: [alice]\n", ErrConfig, "fastest"},
+		{"no users", "team", "strategy: round_robin\n", ErrConfig, "users is required"},
+		{"malformed", "team", "stratgy: round_robin\nusers: [alice]\n", ErrConfig, "stratgy"},
+		{"invalid name", "../team", valid, ErrInvalidGroup, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SaveGroupConfig(tt.group, []byte(tt.data))
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && (!errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.want)) {
+				t.Fatalf("SaveGroupConfig() error = %v, want %v with %q", err, tt.wantErr, tt.want)
+			}
+			// Invalid configs leave the saved one alone
+			data, err := os.ReadFile(filepath.Join(config.Settings.Storage.ConfDir[0], "team.yaml"))
+			if err != nil || string(data) != valid {
+				t.Errorf("config file = %q, %v, want the valid config", data, err)
+			}
+		})
+	}
+}
+
+func TestUpdateGroupUsers(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	ctx := context.Background()
+
+	original := `# Platform on-call
+strategy: round_robin
+availability_checker: always_available
+users:
+  - alice
+  - bob: {aliases: [bobby]}
+  - carol # part-time
+never_available: [carol]
+user_limits:
+  bob: {max_per_day: 2}
+`
+	if created, err := UpdateGroupConfig(ctx, "platform", []byte(original)); err != nil || !created {
+		t.Fatalf("UpdateGroupConfig() = %v, %v, want a created group", created, err)
+	}
+	if created, err := UpdateGroupConfig(ctx, "platform", []byte(original)); err != nil || created {
+		t.Fatalf("UpdateGroupConfig() of an existing group = %v, %v, want an updated group", created, err)
+	}
+
+	tests := []struct {
+		name        string
+		add, remove []string
+		want        *UsersUpdate
+		wantErr     error
+	}{
+		{"add", []string{"dave", "alice"}, nil, &UsersUpdate{Users: []string{"alice", "bob", "carol", "dave"}, Added: []string{"dave"}}, nil},
+		{"repeated", []string{"dave"}, nil, &UsersUpdate{Users: []string{"alice", "bob", "carol", "dave"}}, nil},
+		{"remove with settings", nil, []string{"bob", "carol", "erin"}, &UsersUpdate{Users: []string{"alice", "dave"}, Removed: []string{"bob", "carol"}}, nil},
+		{"add and remove", []string{"alice"}, []string{"alice"}, nil, ErrConfig},
+		{"remove everyone", nil, []string{"alice", "dave"}, nil, ErrConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UpdateGroupUsers(ctx, "platform", tt.add, tt.remove)
+			if !errors.Is(err, tt.wantErr) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UpdateGroupUsers(%v, %v) = %+v, %v, want %+v, %v", tt.add, tt.remove, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	// Other settings and comments are kept
+	data, err := os.ReadFile(filepath.Join(testDir, "platform.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	want := `# Platform on-call
+strategy: round_robin
+availability_checker: always_available
+users:
+  - alice
+  - dave
+never_available: []
+user_limits: {}
+`
+	if string(data) != want {
+		t.Errorf("config after updates =\n%s\nwant\n%s", data, want)
+	}
+	if _, err := UpdateGroupUsers(ctx, "missing", []string{"alice"}, nil); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("UpdateGroupUsers() of a missing group error = %v, want ErrInvalidGroup", err)
+	}
+}
+
+func TestAvailabilityErrorPolicy(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	// The status of alice can't be read
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status/alice" {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"inOutLocation": "OFFICE"}`)
+	}))
+	defer server.Close()
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+
+	tests := []struct {
+		policy  string
+		want    string
+		wantErr error
+	}{
+		{"", "", ErrAvailability},
+		{AvailabilityErrorFail, "", ErrAvailability},
+		{AvailabilityErrorAssumeAvailable, "alice", nil},
+		{AvailabilityErrorAssumeUnavailable, "bob", nil},
+		{"retry", "", ErrConfig},
+	}
+	for i, tt := range tests {
+		group := fmt.Sprintf("policy-group-%d", i)
+		configData := fmt.Sprintf("strategy: round_robin\navailability_checker: inout\nusers: [alice, bob]\non_availability_error: %q\n", tt.policy)
+		if err := os.WriteFile(filepath.Join(testDir, group+".yaml"), []byte(configData), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		result, err := AssignUser(context.Background(), group, AssignOptions{})
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("AssignUser() with policy %q error = %v, want %v", tt.policy, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || result.User != tt.want {
+			t.Errorf("AssignUser() with policy %q = %+v, %v, want %s", tt.policy, result, err, tt.want)
+		}
+	}
+
+	// Users skipped because their check failed are recorded as such
+	skips, err := ReadSkips(fmt.Sprintf("policy-group-%d", 3))
+	if err != nil || len(skips) != 1 || skips[0].User != "alice" || skips[0].Reason != skipCheckFailed {
+		t.Errorf("ReadSkips() = %+v, %v, want alice skipped as %q", skips, err, skipCheckFailed)
+	}
+}
+
+func TestAvailabilityOverrides(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	// alice is away and the bot is unknown to In/Out; neither should be asked about
+	var mu sync.Mutex
+	var asked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/batch" {
+			var req struct {
+				Users []string `json:"users"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			asked = append(asked, req.Users...)
+			fmt.Fprint(w, `{"bob": {"inOutLocation": "OFFICE"}}`)
+			return
+		}
+		user := strings.TrimPrefix(r.URL.Path, "/status/")
+		asked = append(asked, user)
+		switch user {
+		case "alice":
+			fmt.Fprint(w, `{"inOutLocation": "OOO"}`)
+		case "bob":
+			fmt.Fprint(w, `{"inOutLocation": "OFFICE"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+
+	for _, batch := range []bool{false, true} {
+		config.Settings.Availability.InOutBatchApiUrl = ""
+		if batch {
+			config.Settings.Availability.InOutBatchApiUrl = server.URL + "/batch"
+		}
+		group := fmt.Sprintf("override-group-%v", batch)
+		configData := "strategy: round_robin\navailability_checker: inout\nusers: [bot, alice, bob]\nnever_available: [bot]\nalways_available: [alice]\n"
+		if err := os.WriteFile(filepath.Join(testDir, group+".yaml"), []byte(configData), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		asked = nil
+
+		result, err := AssignUser(context.Background(), group, AssignOptions{})
+		if err != nil || result.User != "alice" {
+			t.Errorf("AssignUser() with batch %v = %+v, %v, want alice", batch, result, err)
+		}
+		for _, user := range asked {
+			if user != "bob" {
+				t.Errorf("AssignUser() with batch %v asked In/Out about %s", batch, user)
+			}
+		}
+		skips, err := ReadSkips(group)
+		if err != nil || len(skips) != 1 || skips[0].User != "bot" || skips[0].Reason != skipNever {
+			t.Errorf("ReadSkips() = %+v, %v, want bot skipped as %q", skips, err, skipNever)
+		}
+	}
+}
+
+func TestProbeAvailability(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	var mu sync.Mutex
+	var asked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		user := strings.TrimPrefix(r.URL.Path, "/status/")
+		asked = append(asked, user)
+		switch user {
+		case "alice":
+			fmt.Fprint(w, `{"inOutLocation": "OOO"}`)
+		case "c.arol":
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		default:
+			fmt.Fprint(w, `{"inOutLocation": "OFFICE"}`)
+		}
+	}))
+	defer server.Close()
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+	config.Settings.Availability.InOutUnavailableStatuses = []string{"OOO"}
+
+	configData := `strategy: round_robin
+availability_checker: inout
+on_availability_error: assume_available
+users: [alice, bob, {carol: {availability_id: c.arol, aliases: [caroline]}}, bot, dave]
+never_available: [bot]
+always_available: [dave]
+`
+	if err := os.WriteFile(filepath.Join(testDir, "probe-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := PauseUser(context.Background(), "bob", time.Now().Add(time.Hour), ""); err != nil {
+		t.Fatalf("PauseUser() error = %v", err)
+	}
+	ctx := context.Background()
+
+	report, err := ProbeAvailability(ctx, "probe-group", "", "")
+	if err != nil {
+		t.Fatalf("ProbeAvailability() error = %v", err)
+	}
+	if report.Checker != "inout" || report.Policy != AvailabilityErrorAssumeAvailable || report.Bulk == nil || report.Bulk.Error == "" {
+		t.Errorf("ProbeAvailability() = %+v, want inout with assume_available and a failed bulk check", report)
+	}
+	want := []struct {
+		user        string
+		asked       bool
+		available   bool
+		explanation string
+	}{
+		{"alice", true, false, "inout reports alice unavailable"},
+		{"bob", true, false, "inout reports bob available; paused until"},
+		{"carol", true, true, "check failed"},
+		{"bot", false, false, "listed in never_available"},
+		{"dave", false, true, "listed in always_available"},
+	}
+	if len(report.Users) != len(want) {
+		t.Fatalf("ProbeAvailability() users = %+v, want %d", report.Users, len(want))
+	}
+	for i, w := range want {
+		got := report.Users[i]
+		if got.User != w.user || got.Asked != w.asked || got.Available != w.available || !strings.HasPrefix(got.Explanation, w.explanation) {
+			t.Errorf("user %d = %+v, want %s asked %v available %v explained as %q", i, got, w.user, w.asked, w.available, w.explanation)
+		}
+	}
+	if report.Users[2].ID != "c.arol" || report.Users[2].Error == "" {
+		t.Errorf("carol = %+v, want the failed check of c.arol", report.Users[2])
+	}
+	if idx := readLastIndex("probe-group"); idx != -1 {
+		t.Errorf("last index after probing = %d, want -1", idx)
+	}
+
+	// A single user may be named by an alias; other checkers can be compared
+	asked = nil
+	report, err = ProbeAvailability(ctx, "probe-group", "caroline", "always_available")
+	if err != nil || len(report.Users) != 1 || report.Users[0].User != "carol" || !report.Users[0].Available || report.Checker != "always_available" {
+		t.Errorf("ProbeAvailability(caroline, always_available) = %+v, %v, want carol available", report, err)
+	}
+	if len(asked) != 0 {
+		t.Errorf("In/Out asked about %v, want nothing", asked)
+	}
+
+	if _, err := ProbeAvailability(ctx, "probe-group", "mallory", ""); !errors.Is(err, ErrConfig) {
+		t.Errorf("ProbeAvailability(mallory) error = %v, want ErrConfig", err)
+	}
+	if _, err := ProbeAvailability(ctx, "probe-group", "", "crystal_ball"); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("ProbeAvailability(crystal_ball) error = %v, want ErrInvalidOption", err)
+	}
+	if _, err := ProbeAvailability(ctx, "no-such-group", "", ""); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("ProbeAvailability(no-such-group) error = %v, want ErrInvalidGroup", err)
+	}
+}
+
+func TestUserLimits(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	monday := time.Date(2024, 5, 13, 9, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return monday.AddDate(0, 0, 2) } // Wednesday
+
+	configData := `strategy: round_robin
+availability_checker: always_available
+users: [alice, bob, carol]
+limits:
+  max_per_day: 1
+user_limits:
+  bob: {max_per_day: 2}
+  carol: {max_per_week: 2}
+`
+	if err := os.WriteFile(filepath.Join(testDir, "limit-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	// carol was assigned twice earlier this week, alice last week
+	if err := os.MkdirAll(filepath.Join(testDir, "data", "limit-group"), 0755); err != nil {
+		t.Fatalf("Failed to create data directory: %v", err)
+	}
+	b := newCountBuckets()
+	b.increment("carol", monday)
+	b.increment("carol", monday.AddDate(0, 0, 1))
+	b.increment("alice", monday.AddDate(0, 0, -1))
+	if err := writeCountBuckets("limit-group", b); err != nil {
+		t.Fatalf("writeCountBuckets() error = %v", err)
+	}
+
+	// alice and bob take turns until alice reaches her daily limit, carol is capped for the week
+	for i, want := range []string{"alice", "bob", "bob"} {
+		result, err := AssignUser(context.Background(), "limit-group", AssignOptions{})
+		if err != nil || result.User != want {
+			t.Fatalf("AssignUser() #%d = %+v, %v, want %s", i, result, err, want)
+		}
+	}
+	if _, err := AssignUser(context.Background(), "limit-group", AssignOptions{}); !errors.Is(err, ErrNoAvailableAssignee) {
+		t.Errorf("AssignUser() with everyone at their limit error = %v, want ErrNoAvailableAssignee", err)
+	}
+
+	skips, err := ReadSkips("limit-group")
+	if err != nil {
+		t.Fatalf("ReadSkips() error = %v", err)
+	}
+	reasons := map[string]string{}
+	for _, skip := range skips {
+		reasons[skip.User] = skip.Reason
+	}
+	want := map[string]string{"alice": skipDayLimit, "bob": skipDayLimit, "carol": skipWeekLimit}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("skip reasons = %v, want %v", reasons, want)
+	}
+
+	// The limits reset the next day, except for carol's weekly one
+	timeNow = func() time.Time { return monday.AddDate(0, 0, 3) }
+	if result, err := AssignUser(context.Background(), "limit-group", AssignOptions{}); err != nil || result.User == "carol" {
+		t.Errorf("AssignUser() the next day = %+v, %v, want alice or bob", result, err)
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	now := time.Date(2024, 5, 15, 9, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	configData := `strategy: round_robin
+availability_checker: always_available
+users: [alice, bob]
+limits:
+  cooldown: 2h
+user_limits:
+  bob: {cooldown: 0s}
+`
+	if err := os.WriteFile(filepath.Join(testDir, "cooldown-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	// alice cools down for two hours after her assignment, bob has no cool-down
+	steps := []struct {
+		after time.Duration
+		want  string
+	}{
+		{0, "alice"},
+		{time.Minute, "bob"},
+		{time.Minute, "bob"},
+		{2 * time.Hour, "alice"},
+	}
+	for i, step := range steps {
+		now = now.Add(step.after)
+		result, err := AssignUser(context.Background(), "cooldown-group", AssignOptions{})
+		if err != nil || result.User != step.want {
+			t.Fatalf("AssignUser() #%d = %+v, %v, want %s", i, result, err, step.want)
+		}
+	}
+
+	skips, err := ReadSkips("cooldown-group")
+	if err != nil || len(skips) != 1 || skips[0].User != "alice" || skips[0].Reason != skipCooldown {
+		t.Errorf("ReadSkips() = %+v, %v, want alice skipped as %q", skips, err, skipCooldown)
+	}
+	last, err := readLastAssigned("cooldown-group")
+	if err != nil || !last["alice"].Equal(now) {
+		t.Errorf("readLastAssigned() = %v, %v, want alice at %s", last, err, now)
+	}
+}
+
+func TestFairness(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	writeConfig := func(action string) {
+		t.Helper()
+		configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\nfairness: {max_above_mean: 1, action: " + action + "}\n"
+		if err := os.WriteFile(filepath.Join(testDir, "fair-group.yaml"), []byte(configData), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+	writeConfig("reject")
+
+	// Only alice is eligible, so every assignment puts her further above bob
+	ctx := context.Background()
+	opts := AssignOptions{Eligible: []string{"alice"}, Silent: true}
+	for i := 0; i < 2; i++ {
+		if result, err := AssignUser(ctx, "fair-group", opts); err != nil || result.User != "alice" {
+			t.Fatalf("AssignUser() #%d = %+v, %v, want alice", i, result, err)
+		}
+	}
+	// A third would put her 1.5 assignments above the mean of 1.5
+	if _, err := AssignUser(ctx, "fair-group", opts); !errors.Is(err, ErrNoAvailableAssignee) {
+		t.Fatalf("AssignUser() above the threshold error = %v, want ErrNoAvailableAssignee", err)
+	}
+	skips, err := ReadSkips("fair-group")
+	if err != nil || len(skips) != 1 || skips[0].User != "alice" || skips[0].Reason != skipFairness {
+		t.Errorf("ReadSkips() = %+v, %v, want alice skipped as %q", skips, err, skipFairness)
+	}
+	// Other users are still assigned
+	if result, err := AssignUser(ctx, "fair-group", AssignOptions{Silent: true}); err != nil || result.User != "bob" {
+		t.Errorf("AssignUser() = %+v, %v, want bob", result, err)
+	}
+
+	writeConfig("warn")
+	for i := 0; i < 2; i++ {
+		if result, err := AssignUser(ctx, "fair-group", opts); err != nil || result.User != "alice" {
+			t.Errorf("AssignUser() #%d with warn = %+v, %v, want alice", i, result, err)
+		}
+	}
+
+	writeConfig("ignore")
+	if _, err := AssignUser(ctx, "fair-group", opts); !errors.Is(err, ErrConfig) {
+		t.Errorf("AssignUser() with an unknown action error = %v, want ErrConfig", err)
+	}
+}
+
+func TestRegisterFilter(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n"
+	if err := os.WriteFile(filepath.Join(testDir, "filter-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	var asked []string
+	RegisterFilter("on-call", FilterFunc(func(ctx context.Context, group, user string) (string, error) {
+		asked = append(asked, user)
+		if group == "filter-group" && user == "alice" {
+			return "on call elsewhere", nil
+		}
+		return "", nil
+	}))
+	defer RegisterFilter("on-call", nil)
+
+	ctx := context.Background()
+	result, err := AssignUser(ctx, "filter-group", AssignOptions{Silent: true})
+	if err != nil || result.User != "bob" || result.Reason != "fallback after 1 skip" {
+		t.Fatalf("AssignUser() = %+v, %v, want bob after skipping alice", result, err)
+	}
+	// Only the users up to the one assigned are asked about
+	if !reflect.DeepEqual(asked, []string{"alice", "bob"}) {
+		t.Errorf("filter asked about %v, want alice, bob", asked)
+	}
+	skips, err := ReadSkips("filter-group")
+	if err != nil || len(skips) != 1 || skips[0].User != "alice" || skips[0].Reason != "on call elsewhere" {
+		t.Errorf("ReadSkips() = %+v, %v, want alice skipped as on call elsewhere", skips, err)
+	}
+
+	// Excluded users are taken out before the filters are asked
+	asked = nil
+	if result, err := AssignUser(ctx, "filter-group", AssignOptions{Exclude: []string{"carol"}, DryRun: true, Silent: true}); err != nil || result.User != "bob" {
+		t.Errorf("AssignUser() excluding carol = %+v, %v, want bob", result, err)
+	}
+	if !reflect.DeepEqual(asked, []string{"alice", "bob"}) {
+		t.Errorf("filter asked about %v, want alice, bob", asked)
+	}
+
+	// Errors of filters fail the assignment
+	RegisterFilter("on-call", FilterFunc(func(ctx context.Context, group, user string) (string, error) {
+		return "", fmt.Errorf("roster unreachable")
+	}))
+	if _, err := AssignUser(ctx, "filter-group", AssignOptions{Silent: true}); err == nil || !strings.Contains(err.Error(), "roster unreachable") {
+		t.Errorf("AssignUser() with a failing filter error = %v, want the filter's error", err)
+	}
+
+	RegisterFilter("on-call", nil)
+	if filters := customFilters(); len(filters) != 0 {
+		t.Errorf("customFilters() after removing = %d filters, want none", len(filters))
+	}
+}
+
+func TestSelectionTrace(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	var payloads []CallbackPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p CallbackPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		payloads = append(payloads, p)
+	}))
+	defer server.Close()
+
+	configData := fmt.Sprintf("strategy: [least_assigned, round_robin]\navailability_checker: always_available\nusers: [alice, bob, carol, dave]\nnever_available: [alice]\ncallback:\n  url: %s\n  trace: true\n", server.URL)
+	if err := os.WriteFile(filepath.Join(testDir, "trace-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	ctx := context.Background()
+
+	result, err := AssignUser(ctx, "trace-group", AssignOptions{Exclude: []string{"dave"}, Explain: true, Silent: true})
+	if err != nil || result.User != "bob" {
+		t.Fatalf("AssignUser() = %+v, %v, want bob", result, err)
+	}
+	want := &SelectionTrace{
+		Strategy:   "least_assigned,round_robin",
+		Candidates: []string{"alice", "bob", "carol", "dave"},
+		Removed:    []TraceRejection{{User: "dave", Filter: "exclude", Reason: "excluded"}},
+		Ranking: []TraceStep{
+			{Strategy: "least_assigned", Scores: map[string]string{"alice": "0", "bob": "0", "carol": "0"}, Kept: []string{"alice", "bob", "carol"}},
+			{Strategy: "round_robin", Scores: map[string]string{"alice": "1", "bob": "2", "carol": "3"}, Kept: []string{"alice"}},
+		},
+		Picked:   "alice",
+		Skipped:  []TraceRejection{{User: "alice", Filter: "availability", Reason: "never available"}},
+		Selected: "bob",
+	}
+	if !reflect.DeepEqual(result.Trace, want) {
+		t.Errorf("AssignUser() trace = %+v, want %+v", result.Trace, want)
+	}
+	if len(payloads) != 1 || !reflect.DeepEqual(payloads[0].Trace, want) {
+		t.Errorf("callback payloads = %+v, want the trace", payloads)
+	}
+
+	// Counts of the last assignment rank bob behind carol
+	result, err = AssignUser(ctx, "trace-group", AssignOptions{DryRun: true, Explain: true, Silent: true})
+	if err != nil || result.User != "carol" {
+		t.Fatalf("AssignUser() = %+v, %v, want carol", result, err)
+	}
+	if step := result.Trace.Ranking[0]; step.Scores["bob"] != "1" || !reflect.DeepEqual(step.Kept, []string{"alice", "carol", "dave"}) {
+		t.Errorf("least_assigned step = %+v, want bob at 1 and the others kept", step)
+	}
+
+	// Failed assignments carry the trace in their error
+	_, err = AssignUser(ctx, "trace-group", AssignOptions{Exclude: []string{"bob", "carol", "dave"}, DryRun: true, Explain: true, Silent: true})
+	var noneErr *NoAvailableAssigneeError
+	if !errors.As(err, &noneErr) || noneErr.Trace == nil || noneErr.Trace.Selected != "" || len(noneErr.Trace.Removed) != 3 || len(noneErr.Trace.Skipped) != 1 {
+		t.Errorf("AssignUser() with every candidate rejected error = %v, want a NoAvailableAssigneeError with the trace", err)
+	}
+}
+
+func TestGroupWebhooks(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	events := make(chan GroupEvent, 16)
+	var resets int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e GroupEvent
+		json.NewDecoder(r.Body).Decode(&e)
+		if r.URL.Path == "/resets" {
+			atomic.AddInt32(&resets, 1)
+			return
+		}
+		events <- e
+	}))
+	defer server.Close()
+
+	writeGroup := func(extra string) {
+		t.Helper()
+		configData := fmt.Sprintf("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\nnever_available: [alice]\nwebhooks:\n  - url: %s/all\n  - url: %s/resets\n    events: [reset]\n%s", server.URL, server.URL, extra)
+		if err := os.WriteFile(filepath.Join(testDir, "hook-group.yaml"), []byte(configData), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+	writeGroup("")
+	next := func() GroupEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no webhook event received")
+			return GroupEvent{}
+		}
+	}
+	ctx := context.Background()
+
+	result, err := AssignUser(ctx, "hook-group", AssignOptions{Silent: true})
+	if err != nil || result.User != "bob" {
+		t.Fatalf("AssignUser() = %+v, %v, want bob", result, err)
+	}
+	if e := next(); e.Event != EventAssigned || e.Group != "hook-group" || e.ID != result.ID || e.User != "bob" || e.Reason != "fallback after 1 skip" || e.State == nil || e.State.Counts["bob"] != 1 {
+		t.Errorf("first event = %+v, want bob assigned with the state after it", e)
+	}
+	if e := next(); e.Event != EventFallback || e.User != "bob" || !reflect.DeepEqual(e.Skipped, []string{"alice"}) {
+		t.Errorf("second event = %+v, want a fallback past alice", e)
+	}
+
+	if err := ResetCounts(context.Background(), "hook-group"); err != nil {
+		t.Fatalf("ResetCounts() error = %v", err)
+	}
+	if e := next(); e.Event != EventReset || e.State == nil || e.State.Counts["bob"] != 0 {
+		t.Errorf("event after reset = %+v, want reset with zero counts", e)
+	}
+	// Webhooks only receive the events they subscribed to
+	if n := atomic.LoadInt32(&resets); n != 1 {
+		t.Errorf("reset webhook received %d events, want 1", n)
+	}
+
+	until := timeNow().Add(48 * time.Hour)
+	if err := PauseUser(context.Background(), "bob", until, "slack:U1"); err != nil {
+		t.Fatalf("PauseUser() error = %v", err)
+	}
+	if e := next(); e.Event != EventPaused || e.User != "bob" || e.Until != until.Format(time.RFC3339) || e.Actor != "slack:U1" {
+		t.Errorf("event after pause = %+v, want bob paused", e)
+	}
+	if _, err := AssignUser(ctx, "hook-group", AssignOptions{Silent: true}); !errors.Is(err, ErrNoAvailableAssignee) {
+		t.Fatalf("AssignUser() while everyone is out error = %v, want ErrNoAvailableAssignee", err)
+	}
+	if e := next(); e.Event != EventNoAssignee || len(e.Skipped) != 2 {
+		t.Errorf("event without assignee = %+v, want no_assignee skipping alice and bob", e)
+	}
+	if _, err := ResumeUser(context.Background(), "bob"); err != nil {
+		t.Fatalf("ResumeUser() error = %v", err)
+	}
+	if e := next(); e.Event != EventResumed || e.User != "bob" {
+		t.Errorf("event after resume = %+v, want bob resumed", e)
+	}
+
+	// Loading a changed file is a reload
+	writeGroup("timezone: UTC\n")
+	if _, err := loadAssigneeGroupConfig("hook-group"); err != nil {
+		t.Fatalf("loadAssigneeGroupConfig() error = %v", err)
+	}
+	if e := next(); e.Event != EventConfigReloaded || e.Group != "hook-group" {
+		t.Errorf("event after changing the config = %+v, want config_reloaded", e)
+	}
+
+	conf := &AssigneeGroupConfig{Webhooks: []GroupWebhook{{URL: server.URL, Events: []string{"renamed"}}}}
+	if issues := conf.issues(); !slices.ContainsFunc(issues, func(issue string) bool { return strings.Contains(issue, `unknown webhook event "renamed"`) }) {
+		t.Errorf("issues() = %v, want the unknown event", issues)
+	}
+}
+
+func TestPauses(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	now := time.Date(2024, 5, 15, 9, 0, 0, 0, time.Local) // Wednesday
+	timeNow = func() time.Time { return now }
+
+	ends := []struct {
+		value string
+		want  time.Time
+	}{
+		{"tomorrow", time.Date(2024, 5, 16, 0, 0, 0, 0, time.Local)},
+		{"Monday", time.Date(2024, 5, 20, 0, 0, 0, 0, time.Local)},
+		{"wed", time.Date(2024, 5, 22, 0, 0, 0, 0, time.Local)},
+		{"2024-06-01", time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)},
+		{"2024-05-17T12:00:00Z", time.Date(2024, 5, 17, 12, 0, 0, 0, time.UTC)},
+		{"2w", now.Add(14 * 24 * time.Hour)},
+	}
+	for _, end := range ends {
+		got, err := ParsePauseEnd(end.value, now)
+		if err != nil || !got.Equal(end.want) {
+			t.Errorf("ParsePauseEnd(%q) = %s, %v, want %s", end.value, got, err, end.want)
+		}
+	}
+	if _, err := ParsePauseEnd("someday", now); err == nil {
+		t.Errorf("ParsePauseEnd(someday) succeeded, want error")
+	}
+
+	configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(testDir, "pause-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := PauseUser(context.Background(), "alice", now.Add(-time.Hour), ""); err == nil {
+		t.Errorf("PauseUser() with an end in the past succeeded, want error")
+	}
+	if err := PauseUser(context.Background(), "alice", now.Add(48*time.Hour), "slack:U1"); err != nil {
+		t.Fatalf("PauseUser() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		result, err := AssignUser(context.Background(), "pause-group", AssignOptions{})
+		if err != nil || result.User != "bob" {
+			t.Fatalf("AssignUser() #%d while alice is paused = %+v, %v, want bob", i, result, err)
+		}
+	}
+	skips, err := ReadSkips("pause-group")
+	if err != nil || len(skips) == 0 || skips[0].User != "alice" || skips[0].Reason != skipPaused {
+		t.Errorf("ReadSkips() = %+v, %v, want alice skipped as %q", skips, err, skipPaused)
+	}
+	state, err := GetGroupState(context.Background(), "pause-group")
+	if err != nil || state.PausedUntil["alice"] != now.Add(48*time.Hour).Format(time.RFC3339) {
+		t.Errorf("GetGroupState() = %+v, %v, want alice paused for two days", state, err)
+	}
+
+	// Pauses end on their own or when resumed
+	now = now.Add(72 * time.Hour)
+	if pauses, err := ListPauses(); err != nil || len(pauses) != 0 {
+		t.Errorf("ListPauses() after the end = %+v, %v, want none", pauses, err)
+	}
+	if err := PauseUser(context.Background(), "bob", now.Add(time.Hour), ""); err != nil {
+		t.Fatalf("PauseUser() error = %v", err)
+	}
+	if resumed, err := ResumeUser(context.Background(), "bob"); err != nil || !resumed {
+		t.Errorf("ResumeUser(bob) = %v, %v, want true", resumed, err)
+	}
+	if resumed, err := ResumeUser(context.Background(), "bob"); err != nil || resumed {
+		t.Errorf("ResumeUser(bob) again = %v, %v, want false", resumed, err)
+	}
+
+	// Scheduled pauses take effect once they start
+	if err := SchedulePause(context.Background(), "alice", now.Add(48*time.Hour), now.Add(24*time.Hour), ""); err == nil {
+		t.Errorf("SchedulePause() starting after its end succeeded, want error")
+	}
+	if err := SchedulePause(context.Background(), "alice", now.Add(24*time.Hour), now.Add(96*time.Hour), "ui:alice"); err != nil {
+		t.Fatalf("SchedulePause() error = %v", err)
+	}
+	if pauses, err := ListPauses(); err != nil || len(pauses) != 1 || pauses[0].From != now.Add(24*time.Hour).Format(time.RFC3339) {
+		t.Errorf("ListPauses() = %+v, %v, want the vacation of alice", pauses, err)
+	}
+	if state, err := GetGroupState(context.Background(), "pause-group"); err != nil || state.PausedUntil["alice"] != "" {
+		t.Errorf("GetGroupState() before the vacation = %+v, %v, want alice not paused", state, err)
+	}
+	now = now.Add(25 * time.Hour)
+	if state, err := GetGroupState(context.Background(), "pause-group"); err != nil || state.PausedUntil["alice"] == "" {
+		t.Errorf("GetGroupState() during the vacation = %+v, %v, want alice paused", state, err)
+	}
+
+	// Concurrent pauses and resumes of different users all take effect
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			if err := PauseUser(context.Background(), user, now.Add(time.Hour), ""); err != nil {
+				t.Errorf("PauseUser(%s) error = %v", user, err)
+			}
+		}(fmt.Sprintf("user%d", i))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := ResumeUser(context.Background(), "alice"); err != nil {
+			t.Errorf("ResumeUser(alice) error = %v", err)
+		}
+	}()
+	wg.Wait()
+	if pauses, err := ListPauses(); err != nil || len(pauses) != 20 {
+		t.Errorf("ListPauses() after concurrent pauses = %d pauses, %v, want 20", len(pauses), err)
+	}
+}
+
+func TestGroupDisabled(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	ctx := context.Background()
+
+	configData := "# Frozen during the reorg\nstrategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	confPath := filepath.Join(testDir, "frozen-group.yaml")
+	if err := os.WriteFile(confPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	reservation, err := Reserve(ctx, "frozen-group", time.Minute, AssignOptions{})
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	if err := SetGroupEnabled("frozen-group", false); err != nil {
+		t.Fatalf("SetGroupEnabled(false) error = %v", err)
+	}
+	data, _ := os.ReadFile(confPath)
+	if want := "enabled: false\n" + configData; string(data) != want {
+		t.Errorf("config after disabling = %q, want %q", data, want)
+	}
+	if _, err := AssignUser(ctx, "frozen-group", AssignOptions{}); !errors.Is(err, ErrGroupDisabled) {
+		t.Errorf("AssignUser() in disabled group error = %v, want ErrGroupDisabled", err)
+	}
+	if _, err := CommitReservation(ctx, "frozen-group", reservation.ID); !errors.Is(err, ErrGroupDisabled) {
+		t.Errorf("CommitReservation() in disabled group error = %v, want ErrGroupDisabled", err)
+	}
+	if idx := readLastIndex("frozen-group"); idx != -1 {
+		t.Errorf("last index of disabled group = %d, want -1", idx)
+	}
+
+	// Disabling twice keeps a single key, enabling restores the original config
+	if err := SetGroupEnabled("frozen-group", false); err != nil {
+		t.Fatalf("second SetGroupEnabled(false) error = %v", err)
+	}
+	if err := SetGroupEnabled("frozen-group", true); err != nil {
+		t.Fatalf("SetGroupEnabled(true) error = %v", err)
+	}
+	if data, _ := os.ReadFile(confPath); string(data) != configData {
+		t.Errorf("config after enabling = %q, want %q", data, configData)
+	}
+	if result, err := AssignUser(ctx, "frozen-group", AssignOptions{}); err != nil || result.User != "bob" {
+		t.Errorf("AssignUser() after enabling = %+v, %v, want bob", result, err)
+	}
+
+	if err := SetGroupEnabled("missing-group", false); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("SetGroupEnabled() on missing group error = %v, want ErrInvalidGroup", err)
+	}
+}
+
+// slowChecker reports users unavailable after a delay, checking them one by one.
+type slowChecker struct {
+	delay       time.Duration
+	unavailable map[string]bool
+}
+
+func (c *slowChecker) IsAvailable(ctx context.Context, user string) (bool, error) {
+	select {
+	case <-time.After(c.delay):
+		return !c.unavailable[user], nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// partialBulkChecker answers bulk checks for the users it knows only,
+// leaving the others out of the result.
+type partialBulkChecker struct {
+	available map[string]bool
+}
+
+func (c *partialBulkChecker) IsAvailable(ctx context.Context, user string) (bool, error) {
+	return c.available[user], nil
+}
+
+func (c *partialBulkChecker) AreAvailable(ctx context.Context, users []string) (map[string]bool, error) {
+	result := map[string]bool{}
+	for _, user := range users {
+		if available, ok := c.available[user]; ok {
+			result[user] = available
+		}
+	}
+	return result, nil
+}
+
+func TestBulkAvailabilityMissingUsers(t *testing.T) {
+	conf := &AssigneeGroupConfig{Users: []string{"alice", "bob", "carol"}, AlwaysAvailable: []string{"carol"}}
+	checker := &partialBulkChecker{available: map[string]bool{"alice": true}}
+	ctx := context.Background()
+	check, err := newAvailabilityCheck(ctx, "bulk-group", conf, checker, conf.Users)
+	if err != nil {
+		t.Fatalf("newAvailabilityCheck() error = %v", err)
+	}
+	// Users missing from the result are unavailable, as BulkAvailabilityChecker documents
+	for user, want := range map[string]bool{"alice": true, "bob": false, "carol": true} {
+		if got, err := check.available(ctx, user); err != nil || got != want {
+			t.Errorf("available(%s) = %v, %v, want %v", user, got, err, want)
+		}
+	}
+}
+
+func TestRequireAllChecks(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	// The status of bob can't be read, which the group's policy would tolerate
+	var asked []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		asked = append(asked, strings.TrimPrefix(r.URL.Path, "/status/"))
+		if r.URL.Path == "/status/bob" {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"inOutLocation": "OFFICE"}`)
+	}))
+	defer server.Close()
+	saved := config.Settings.Availability
+	defer func() { config.Settings.Availability = saved }()
+	config.Settings.Availability.InOutApiUrlPrefix = server.URL + "/status/"
+
+	configData := "strategy: round_robin\navailability_checker: inout\nusers: [alice, bob, bot]\nnever_available: [bot]\non_availability_error: assume_unavailable\n"
+	if err := os.WriteFile(filepath.Join(testDir, "checked-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	ctx := context.Background()
+
+	_, err := AssignUser(ctx, "checked-group", AssignOptions{RequireAllChecks: true})
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) || preflightErr.Check != PreflightAvailability || !errors.Is(err, ErrAvailability) || !errors.Is(err, ErrPreflight) {
+		t.Fatalf("AssignUser(RequireAllChecks) error = %v, want a failed pre-flight availability check", err)
+	}
+	if idx := readLastIndex("checked-group"); idx != -1 {
+		t.Errorf("last index after failed pre-flight = %d, want -1", idx)
+	}
+	if mu.Lock(); strings.Join(asked, ",") != "alice,bob" {
+		t.Errorf("In/Out asked about %v, want alice and bob", asked)
+	}
+	mu.Unlock()
+
+	// Without the checks the policy applies and alice is assigned
+	if result, err := AssignUser(ctx, "checked-group", AssignOptions{}); err != nil || result.User != "alice" {
+		t.Errorf("AssignUser() = %+v, %v, want alice", result, err)
+	}
+
+	// A state backend rejecting writes fails the storage check before anything is selected
+	consul := &fakeConsul{values: map[string][]byte{}, modifyIndex: map[string]uint64{}}
+	readOnly := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Permission denied", http.StatusForbidden)
+			return
+		}
+		consul.ServeHTTP(w, r)
+	}))
+	defer readOnly.Close()
+	config.Settings.Storage.Consul = config.ConsulConfig{Address: readOnly.URL}
+	defer func() { config.Settings.Storage.Consul = config.ConsulConfig{} }()
+	config.Settings.Availability.InOutApiUrlPrefix = ""
+	if err := os.WriteFile(filepath.Join(testDir, "checked-group.yaml"), []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	_, err = AssignUser(ctx, "checked-group", AssignOptions{RequireAllChecks: true})
+	if !errors.As(err, &preflightErr) || preflightErr.Check != PreflightStorage || errors.Is(err, ErrAvailability) || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("AssignUser(RequireAllChecks) error = %v, want a failed pre-flight storage check", err)
+	}
+	if idx := readLastIndex("checked-group"); idx != 0 {
+		t.Errorf("last index after failed pre-flight = %d, want 0", idx)
+	}
+	// Dry runs write nothing, so the storage isn't checked
+	if result, err := AssignUser(ctx, "checked-group", AssignOptions{DryRun: true, RequireAllChecks: true}); err != nil || result.User != "bob" {
+		t.Errorf("AssignUser(DryRun, RequireAllChecks) = %+v, %v, want bob", result, err)
+	}
+}
+
+func TestAvailabilityBudget(t *testing.T) {
+	users := []string{"alice", "bob", "carol"}
+	checker := &slowChecker{delay: 100 * time.Millisecond, unavailable: map[string]bool{"alice": true, "bob": true, "carol": true}}
+
+	// alice is checked in time, the check of bob runs out of budget
+	tests := []struct {
+		policy      string
+		wantIndex   int
+		wantSkipped []string
+		wantErr     bool
+	}{
+		{AvailabilityErrorFail, -1, nil, true},
+		{AvailabilityErrorAssumeAvailable, 1, []string{"alice"}, false},
+		{AvailabilityErrorAssumeUnavailable, -1, []string{"alice", "bob", "carol"}, false},
+	}
+	for _, tt := range tests {
+		conf := &AssigneeGroupConfig{Users: users, OnAvailabilityError: tt.policy, AvailabilityBudget: "150ms"}
+		check, err := newAvailabilityCheck(context.Background(), "budget-group", conf, checker, users)
+		if err != nil {
+			t.Fatalf("newAvailabilityCheck() error = %v", err)
+		}
+		start := time.Now()
+		index, skipped, err := findAvailable(users, 0, func(user string) (bool, error) {
+			return check.available(context.Background(), user)
+		})
+		if errors.Is(err, ErrAvailability) != tt.wantErr || index != tt.wantIndex || !reflect.DeepEqual(skipped, tt.wantSkipped) {
+			t.Errorf("findAvailable() with policy %s = %d, %v, %v, want %d, %v", tt.policy, index, skipped, err, tt.wantIndex, tt.wantSkipped)
+		}
+		if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+			t.Errorf("findAvailable() with policy %s took %s, want the budget respected", tt.policy, elapsed)
+		}
+		if tt.policy == AvailabilityErrorAssumeUnavailable {
+			if failed := check.checkFailed(skipped); !reflect.DeepEqual(failed, []string{"bob", "carol"}) {
+				t.Errorf("checkFailed() = %v, want bob and carol", failed)
+			}
+		}
+	}
+
+	conf := &AssigneeGroupConfig{Users: users, AvailabilityBudget: "soon"}
+	if _, err := newAvailabilityCheck(context.Background(), "budget-group", conf, checker, users); !errors.Is(err, ErrConfig) {
+		t.Errorf("newAvailabilityCheck() with an invalid budget error = %v, want ErrConfig", err)
+	}
+}
+
+func TestAssignWithPriority(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte(`strategy: round_robin
+availability_checker: always_available
+users: [junior1, senior1, junior2, senior2]
+priorities:
+  P1:
+    users: [senior1, senior2]
+  P2:
+    users: [nobody]
+`)
+	if err := os.WriteFile(filepath.Join(testDir, "priority-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		priority string
+		want     string
+		wantErr  error
+	}{
+		{priority: "", want: "junior1"},
+		{priority: "P1", want: "senior1"},
+		{priority: "P1", want: "senior2"},
+		{priority: "P1", want: "senior1"},
+		{priority: "P3", wantErr: ErrInvalidOption},
+		{priority: "", want: "junior2"},
+		{priority: "P2", wantErr: ErrConfig},
+	}
+	for i, tt := range tests {
+		err := AssignWithOptions(ctx, "priority-group", AssignOptions{Priority: tt.priority})
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("#%d AssignWithOptions(%q) error = %v, want %v", i, tt.priority, err, tt.wantErr)
+			}
+			if tt.wantErr == ErrInvalidOption && (err == nil || !strings.Contains(err.Error(), "expected one of P1, P2")) {
+				t.Errorf("#%d AssignWithOptions(%q) error = %v, want the valid priorities", i, tt.priority, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d AssignWithOptions(%q) error = %v", i, tt.priority, err)
+		}
+		groupConf, _ := loadAssigneeGroupConfig("priority-group")
+		if got := groupConf.Users[readLastIndex("priority-group")]; got != tt.want {
+			t.Errorf("#%d AssignWithOptions(%q) assigned %s, want %s", i, tt.priority, got, tt.want)
+		}
+	}
+}
+
+func TestAssignExcludeAndEligible(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte(`strategy: round_robin
+availability_checker: always_available
+users: [alice, bob, carol, dave]
+aliases:
+  carol: [csmith]
+`)
+	if err := os.WriteFile(filepath.Join(testDir, "narrow-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		exclude  []string
+		eligible []string
+		want     string
+		wantErr  error
+	}{
+		{exclude: []string{"alice"}, want: "bob"},
+		// The rotation continues after bob, skipping the excluded alias of carol
+		{exclude: []string{"csmith"}, want: "dave"},
+		{eligible: []string{"bob", "carol"}, want: "bob"},
+		{exclude: []string{"carol"}, eligible: []string{"bob", "carol"}, want: "bob"},
+		{exclude: []string{"bob"}, eligible: []string{"bob", "erin"}, wantErr: ErrNoAvailableAssignee},
+	}
+	for i, tt := range tests {
+		result, err := AssignUser(ctx, "narrow-group", AssignOptions{Exclude: tt.exclude, Eligible: tt.eligible})
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("#%d AssignUser() error = %v, want %v", i, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || result.User != tt.want || result.ID == "" {
+			t.Errorf("#%d AssignUser(exclude %v, eligible %v) = %+v, %v, want %s", i, tt.exclude, tt.eligible, result, err, tt.want)
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	schedule, err := QuietHours{Start: "22:00", End: "07:00", Days: []string{"Saturday", "sunday"}, Timezone: "UTC"}.parse(time.Local)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	tests := []struct {
+		now      time.Time
+		quiet    bool
+		nextOpen time.Time
+	}{
+		{time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC), false, time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 15, 23, 30, 0, 0, time.UTC), true, time.Date(2024, 5, 16, 7, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 16, 6, 59, 0, 0, time.UTC), true, time.Date(2024, 5, 16, 7, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 17, 22, 0, 0, 0, time.UTC), true, time.Date(2024, 5, 20, 7, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 18, 12, 0, 0, 0, time.UTC), true, time.Date(2024, 5, 20, 7, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := schedule.quiet(tt.now); got != tt.quiet {
+			t.Errorf("quiet(%v) = %v, want %v", tt.now, got, tt.quiet)
+		}
+		if got := schedule.nextOpen(tt.now); !got.Equal(tt.nextOpen) {
+			t.Errorf("nextOpen(%v) = %v, want %v", tt.now, got, tt.nextOpen)
+		}
+	}
+
+	invalid := []QuietHours{
+		{Start: "22:00"},
+		{Start: "25:00", End: "07:00"},
+		{Days: []string{"someday"}},
+		{Days: []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}},
+		{Start: "22:00", End: "07:00", Timezone: "Nowhere/City"},
+	}
+	for _, q := range invalid {
+		if _, err := q.parse(time.Local); err == nil {
+			t.Errorf("parse(%+v) error = nil, want error", q)
+		}
+	}
+}
+
+func TestQuietHoursQueue(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+
+	configData := []byte(`strategy: round_robin
+availability_checker: always_available
+users: [alice, bob]
+quiet_hours:
+  start: "22:00"
+  end: "07:00"
+  timezone: UTC
+`)
+	if err := os.WriteFile(filepath.Join(testDir, "quiet-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	ctx := context.Background()
+	timeNow = func() time.Time { return time.Date(2024, 5, 15, 23, 0, 0, 0, time.UTC) }
+	if err := AssignWithOptions(ctx, "quiet-group", AssignOptions{Priority: "P2"}); err != nil {
+		t.Fatalf("AssignWithOptions() during quiet hours error = %v", err)
+	}
+	if idx := readLastIndex("quiet-group"); idx != -1 {
+		t.Errorf("last index after deferred assignment = %d, want -1", idx)
+	}
+	queue, err := ListQueue()
+	if err != nil || len(queue) != 1 || queue[0].Group != "quiet-group" || queue[0].Priority != "P2" {
+		t.Fatalf("ListQueue() = %+v, %v, want one P2 entry for quiet-group", queue, err)
+	}
+	if queue[0].NotBefore != "2024-05-16T07:00:00Z" {
+		t.Errorf("NotBefore = %s, want 2024-05-16T07:00:00Z", queue[0].NotBefore)
+	}
+
+	// Callers that retry later themselves are told when the quiet hours end
+	result, err := AssignUser(ctx, "quiet-group", AssignOptions{NoQueue: true})
+	if err != nil || result.Deferred != "2024-05-16T07:00:00Z" || result.User != "" {
+		t.Errorf("AssignUser(NoQueue) = %+v, %v, want deferred to 2024-05-16T07:00:00Z", result, err)
+	}
+	if queue, _ := ListQueue(); len(queue) != 1 {
+		t.Errorf("ListQueue() after AssignUser(NoQueue) = %+v, want the one earlier entry", queue)
+	}
+
+	// Nothing is due before the quiet hours end
+	results, err := FlushQueue(ctx, false)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("FlushQueue() before end = %+v, %v, want no results", results, err)
+	}
+
+	timeNow = func() time.Time { return time.Date(2024, 5, 16, 7, 0, 0, 0, time.UTC) }
+	results, err = FlushQueue(ctx, false)
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("FlushQueue() after end = %+v, %v, want one successful result", results, err)
+	}
+	if idx := readLastIndex("quiet-group"); idx != 0 {
+		t.Errorf("last index after flush = %d, want 0", idx)
+	}
+	if queue, _ := ListQueue(); len(queue) != 0 {
+		t.Errorf("ListQueue() after flush = %+v, want empty", queue)
+	}
+
+	// Concurrent flushes make every assignment once and keep those deferred meanwhile
+	nightData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [carol]\nquiet_hours: {start: \"06:00\", end: \"08:00\", timezone: UTC}\n")
+	if err := os.WriteFile(filepath.Join(testDir, "night-group.yaml"), nightData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	timeNow = func() time.Time { return time.Date(2024, 5, 16, 23, 0, 0, 0, time.UTC) }
+	for i := 0; i < 6; i++ {
+		if err := AssignWithOptions(ctx, "quiet-group", AssignOptions{}); err != nil {
+			t.Fatalf("AssignWithOptions() during quiet hours error = %v", err)
+		}
+	}
+	timeNow = func() time.Time { return time.Date(2024, 5, 17, 7, 0, 0, 0, time.UTC) }
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	made := 0
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := FlushQueue(WithLockWait(ctx, -1), false)
+			if err != nil {
+				t.Errorf("concurrent FlushQueue() error = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range results {
+				if r.Err == nil {
+					made++
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := AssignWithOptions(WithLockWait(ctx, -1), "night-group", AssignOptions{}); err != nil {
+				t.Errorf("AssignWithOptions() during a flush error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	counts := readCounts("quiet-group")
+	if made != 6 || counts["alice"]+counts["bob"] != 7 {
+		t.Errorf("concurrent flushes made %d assignments, counts %v, want 6 and 7 in total", made, counts)
+	}
+	if queue, _ := ListQueue(); len(queue) != 10 {
+		t.Errorf("ListQueue() after concurrent flushes = %d entries, want the 10 deferred meanwhile", len(queue))
+	}
+}
+
+func TestGroupTimezone(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+
+	// Quiet hours without a time zone of their own are in the group's
+	configData := []byte(`strategy: round_robin
+availability_checker: always_available
+users: [alice, bob]
+timezone: Asia/Tokyo
+quiet_hours:
+  start: "22:00"
+  end: "07:00"
+`)
+	if err := os.WriteFile(filepath.Join(testDir, "tokyo.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	ctx := context.Background()
+
+	// 23:30 UTC is 08:30 of the next day in Tokyo
+	timeNow = func() time.Time { return time.Date(2024, 5, 15, 23, 30, 0, 0, time.UTC) }
+	if result, err := AssignUser(ctx, "tokyo", AssignOptions{}); err != nil || result.User != "alice" {
+		t.Fatalf("AssignUser() = %+v, %v, want alice", result, err)
+	}
+	b, err := readCountBuckets("tokyo")
+	if err != nil || b.Days["2024-05-16"]["alice"] != 1 {
+		t.Errorf("count buckets = %+v, %v, want alice counted on 2024-05-16", b, err)
+	}
+
+	timeNow = func() time.Time { return time.Date(2024, 5, 16, 14, 0, 0, 0, time.UTC) }
+	result, err := AssignUser(ctx, "tokyo", AssignOptions{NoQueue: true})
+	if err != nil || result.Deferred != "2024-05-16T22:00:00Z" {
+		t.Errorf("AssignUser() at 23:00 in Tokyo = %+v, %v, want deferred to 07:00 in Tokyo", result, err)
+	}
+
+	// Just after midnight in Tokyo, the day has turned while it hasn't in UTC
+	timeNow = func() time.Time { return time.Date(2024, 5, 16, 15, 1, 0, 0, time.UTC) }
+	if result, err := AssignUser(ctx, "tokyo", AssignOptions{IgnoreQuietHours: true}); err != nil || result.User != "bob" {
+		t.Fatalf("AssignUser() = %+v, %v, want bob", result, err)
+	}
+	for period, want := range map[string]map[string]int{
+		PeriodDay:  {"alice": 0, "bob": 1},
+		PeriodWeek: {"alice": 1, "bob": 1},
+	} {
+		if got, err := PeriodCounts("tokyo", period); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("PeriodCounts(%s) = %v, %v, want %v", period, got, err, want)
+		}
+	}
+
+	// The digest is due in the time zone of its groups
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	if got, err := NextDigest(config.DigestConfig{Groups: []string{"tokyo"}}, now); err != nil || !got.Equal(time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("NextDigest() = %v, %v, want 09:00 on Monday in Tokyo", got, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(testDir, "nowhere.yaml"), []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice]\ntimezone: Nowhere/City\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if issues, err := ValidateGroup(ctx, "nowhere", false); err != nil || len(issues) != 1 || !strings.Contains(issues[0], "invalid timezone") {
+		t.Errorf("ValidateGroup() = %q, %v, want the invalid time zone", issues, err)
+	}
+	if _, err := PeriodCounts("nowhere", PeriodDay); !errors.Is(err, ErrConfig) {
+		t.Errorf("PeriodCounts() with an invalid time zone error = %v, want ErrConfig", err)
+	}
+}
+
+func TestOpenAssignments(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\ntrack_open: true\n")
+	if err := os.WriteFile(filepath.Join(testDir, "open-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := Assign("open-group", false); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+	}
+	if err := Assign("open-group", true); err != nil {
+		t.Fatalf("Assign() dry run error = %v", err)
+	}
+
+	ledger, err := OpenAssignments("open-group")
+	if err != nil || len(ledger) != 2 || ledger[0].User != "alice" || ledger[1].User != "bob" {
+		t.Fatalf("OpenAssignments() = %+v, %v, want open assignments for alice and bob", ledger, err)
+	}
+	groupDir, _ := config.GetGroupDataDir("open-group")
+	records, _ := history.ReadFile(filepath.Join(groupDir, "assignments.log"))
+	if len(records) != 2 || records[0].ID != ledger[0].ID {
+		t.Errorf("assignments.log IDs = %+v, want the ledger IDs", records)
+	}
+
+	defer func() { timeNow = time.Now }()
+	start := time.Now()
+	timeNow = func() time.Time { return start.Add(10 * time.Minute) }
+	acked, err := AcknowledgeAssignment(context.Background(), "open-group", ledger[0].ID)
+	if err != nil || !acked.Acknowledged() {
+		t.Errorf("AcknowledgeAssignment() = %+v, %v, want acknowledged", acked, err)
+	}
+	if _, err := AcknowledgeAssignment(context.Background(), "open-group", ledger[0].ID); err != nil {
+		t.Errorf("AcknowledgeAssignment() twice error = %v", err)
+	}
+	timeNow = func() time.Time { return start.Add(time.Hour) }
+	if _, err := CloseAssignment(context.Background(), "open-group", ledger[1].ID); err != nil {
+		t.Errorf("CloseAssignment() error = %v", err)
+	}
+	if _, err := CloseAssignment(context.Background(), "open-group", ledger[1].ID); !errors.Is(err, ErrAssignmentNotFound) {
+		t.Errorf("CloseAssignment() twice error = %v, want ErrAssignmentNotFound", err)
+	}
+
+	ledger, err = OpenAssignments("open-group")
+	if err != nil || len(ledger) != 1 || !ledger[0].Acknowledged() {
+		t.Errorf("OpenAssignments() after close = %+v, %v, want only the acknowledged assignment", ledger, err)
+	}
+
+	// Acknowledging again records nothing
+	durations, err := ReadDurations("open-group")
+	if err != nil || len(durations) != 2 {
+		t.Fatalf("ReadDurations() = %+v, %v, want an acknowledgement and a closing", durations, err)
+	}
+	near := func(got float64, want time.Duration) bool {
+		return math.Abs(got-want.Seconds()) <= 1
+	}
+	if d := durations[0]; d.User != "alice" || d.Event != EventAcknowledged || !near(d.Seconds, 10*time.Minute) {
+		t.Errorf("durations[0] = %+v, want alice acknowledging after 10m", d)
+	}
+	if d := durations[1]; d.User != "bob" || d.Event != EventClosed || !near(d.Seconds, time.Hour) {
+		t.Errorf("durations[1] = %+v, want bob closing after 1h", d)
+	}
+
+	stats, err := GetWindowStats(context.Background(), "open-group", "1d")
+	if err != nil {
+		t.Fatalf("GetWindowStats() error = %v", err)
+	}
+	alice, bob := stats.Users[0], stats.Users[1]
+	if stats.Open != 1 || alice.Open != 1 || !near(alice.OldestOpenAgeSeconds, time.Hour) || !near(alice.MedianAckSeconds, 10*time.Minute) || !near(bob.MedianCloseSeconds, time.Hour) || !near(stats.MedianCloseSeconds, time.Hour) {
+		t.Errorf("GetWindowStats() = %+v, want alice's open assignment and the durations", stats)
+	}
+	userStats, err := GetStats(context.Background(), "open-group")
+	if err != nil || userStats[0].Open != 1 || userStats[0].OldestOpen != ledger[0].AssignedAt || userStats[1].MedianClose.Round(time.Minute) != time.Hour {
+		t.Errorf("GetStats() = %+v, %v, want alice's open assignment and bob's time to close", userStats, err)
+	}
+}
+
+func TestOpenLoadStrategy(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: open_load\navailability_checker: always_available\nusers: [alice, bob]\ntrack_open: true\n")
+	if err := os.WriteFile(filepath.Join(testDir, "load-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	ctx := context.Background()
+	assign := func() string {
+		t.Helper()
+		result, err := AssignUser(ctx, "load-group", AssignOptions{Silent: true})
+		if err != nil {
+			t.Fatalf("AssignUser() error = %v", err)
+		}
+		return result.User
+	}
+	if first, second := assign(), assign(); first != "alice" || second != "bob" {
+		t.Fatalf("first assignments = %s, %s, want alice, bob", first, second)
+	}
+	ledger, err := OpenAssignments("load-group")
+	if err != nil || len(ledger) != 2 {
+		t.Fatalf("OpenAssignments() = %+v, %v, want 2 open assignments", ledger, err)
+	}
+	// Both have 1 assignment; alice has nothing open once hers is closed
+	if _, err := CloseAssignment(context.Background(), "load-group", ledger[0].ID); err != nil {
+		t.Fatalf("CloseAssignment() error = %v", err)
+	}
+	if user := assign(); user != "alice" {
+		t.Errorf("assignment after closing = %s, want alice with no open assignments", user)
+	}
+	// alice and bob have 1 open assignment each, and alice more assignments
+	if user := assign(); user != "bob" {
+		t.Errorf("assignment on a tie of open assignments = %s, want bob with fewer assignments", user)
+	}
+}
+
+func TestStrategyChain(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	now := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	configData := []byte("strategy: [least_assigned, least_recently_assigned, round_robin]\navailability_checker: always_available\nusers: [alice, bob, carol]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "chain-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	groupConf, err := loadAssigneeGroupConfig("chain-group")
+	if err != nil || groupConf.Strategy != "least_assigned,least_recently_assigned,round_robin" {
+		t.Fatalf("loadAssigneeGroupConfig() strategy = %v, %v, want the chain", groupConf, err)
+	}
+	if out, err := yaml.Marshal(groupConf); err != nil || !strings.Contains(string(out), "- least_recently_assigned") {
+		t.Errorf("yaml.Marshal() = %s, %v, want the chain as a list", out, err)
+	}
+
+	ctx := context.Background()
+	steps := []struct {
+		strategy string
+		want     string
+		reason   string
+	}{
+		{"", "alice", "round_robin next after least_assigned,least_recently_assigned tie"},
+		{"", "bob", "round_robin next after least_assigned,least_recently_assigned tie"},
+		{"", "carol", "least_assigned count=0"},
+		// Everyone has one assignment; alice has waited longest
+		{"", "alice", "least_recently_assigned last=2024-05-15T09:01:00Z after least_assigned tie"},
+		{"least_assigned, round_robin", "bob", "round_robin next after least_assigned tie"},
+	}
+	for i, step := range steps {
+		now = now.Add(time.Minute)
+		result, err := AssignUser(ctx, "chain-group", AssignOptions{Strategy: step.strategy, Silent: true})
+		if err != nil || result.User != step.want || result.Reason != step.reason {
+			t.Fatalf("AssignUser() #%d = %+v, %v, want %s for %q", i, result, err, step.want, step.reason)
+		}
+	}
+
+	records, err := history.ReadFile(filepath.Join(testDir, "data", "chain-group", "assignments.log"))
+	if err != nil || len(records) != len(steps) {
+		t.Fatalf("ReadFile() = %d records, %v, want %d", len(records), err, len(steps))
+	}
+	if r := records[len(records)-1]; r.Strategy != "least_assigned,round_robin" || r.Metadata["overridden_strategy"] != "least_assigned,least_recently_assigned,round_robin" {
+		t.Errorf("record of the override = strategy %s, overridden %q, want the chains", r.Strategy, r.Metadata["overridden_strategy"])
+	}
+	if _, err := AssignUser(ctx, "chain-group", AssignOptions{Strategy: "least_assigned,coin_flip", DryRun: true}); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("assign with an unknown strategy in the chain error = %v, want ErrInvalidOption", err)
+	}
+
+	// Replaying the log takes the times of the last assignments from it
+	result, err := Replay(ctx, "chain-group", filepath.Join(testDir, "data", "chain-group", "assignments.log"))
+	if err != nil || len(result.Divergences) != 0 {
+		t.Errorf("Replay() = %+v, %v, want no divergences", result, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(testDir, "bad-chain.yaml"), []byte("strategy: [least_assigned, coin_flip]\navailability_checker: always_available\nusers: [alice]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if issues, err := ValidateGroup(ctx, "bad-chain", false); err != nil || len(issues) != 1 || !strings.Contains(issues[0], "coin_flip") {
+		t.Errorf("ValidateGroup() = %v, %v, want the unknown strategy", issues, err)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol, dave]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "sim-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	override := filepath.Join(testDir, "proposed.yaml")
+	overrideData := []byte("strategy: round_robin\nusers: [alice, bob, carol, dave]\nstrategy_options:\n  skip_debt: true\n")
+	if err := os.WriteFile(override, overrideData, 0644); err != nil {
+		t.Fatalf("Failed to write override file: %v", err)
+	}
+
+	ctx := context.Background()
+	seed := int64(1)
+	tests := []struct {
+		name string
+		opts SimulateOptions
+		want map[string]int
+	}{
+		{
+			name: "everyone available",
+			opts: SimulateOptions{Runs: 400},
+			want: map[string]int{"alice": 100, "bob": 100, "carol": 100, "dave": 100},
+		},
+		{
+			name: "never available user",
+			opts: SimulateOptions{Runs: 300, Availability: map[string]float64{"bob": 0}},
+			want: map[string]int{"alice": 100, "bob": 0, "carol": 100, "dave": 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Simulate(ctx, "sim-group", tt.opts)
+			if err != nil {
+				t.Fatalf("Simulate() error = %v", err)
+			}
+			for user, want := range tt.want {
+				if result.Assignments[user] != want {
+					t.Errorf("Simulate() assignments = %v, want %v", result.Assignments, tt.want)
+					break
+				}
+			}
+		})
+	}
+
+	// The proposed config with skip_debt gives a flaky user more of their share
+	flaky := map[string]float64{"bob": 0.5}
+	current, err := Simulate(ctx, "sim-group", SimulateOptions{Runs: 4000, Availability: flaky, Seed: &seed})
+	if err != nil {
+		t.Fatalf("Simulate() error = %v", err)
+	}
+	proposed, err := Simulate(ctx, "sim-group", SimulateOptions{Runs: 4000, ConfigPath: override, Availability: flaky, Seed: &seed})
+	if err != nil {
+		t.Fatalf("Simulate() with override error = %v", err)
+	}
+	if proposed.Assignments["bob"] <= current.Assignments["bob"]+200 {
+		t.Errorf("bob assigned %d times with skip_debt and %d without, want clearly more with skip_debt",
+			proposed.Assignments["bob"], current.Assignments["bob"])
+	}
+
+	if _, err := os.Stat(filepath.Join(testDir, "data", "sim-group", "state.json")); !os.IsNotExist(err) {
+		t.Errorf("Simulate() wrote state.json, want no stored state")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "replay-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	// alice, bob, then alice again where round robin selects carol, then a removed user
+	logPath := filepath.Join(testDir, "exported.log")
+	log := `{"schema_version":3,"group":"replay-group","user":"alice","next_index":0}
+{"schema_version":3,"group":"replay-group","user":"bob","next_index":1}
+{"schema_version":3,"group":"replay-group","user":"alice","next_index":0}
+{"schema_version":3,"group":"replay-group","user":"dave","next_index":1}
+`
+	if err := os.WriteFile(logPath, []byte(log), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+
+	result, err := Replay(context.Background(), "replay-group", logPath)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if len(result.Divergences) != 1 || result.Divergences[0].Record != 3 || result.Divergences[0].Expected != "carol" {
+		t.Errorf("Replay() divergences = %+v, want record 3 expecting carol", result.Divergences)
+	}
+	if len(result.UnknownUsers) != 1 || result.UnknownUsers[0] != "dave" {
+		t.Errorf("Replay() unknown users = %v, want [dave]", result.UnknownUsers)
+	}
+	if result.Rebuild.RebuiltCounts["alice"] != 2 || result.Rebuild.RebuiltIndex != 1 {
+		t.Errorf("Replay() rebuild = %+v, want alice 2 and index 1", result.Rebuild)
+	}
+
+	release, err := lockGroup(context.Background(), "replay-group")
+	if err != nil {
+		t.Fatalf("lockGroup() error = %v", err)
+	}
+	if err := ApplyReplay(WithLockWait(context.Background(), 0), result); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("ApplyReplay() while the group is locked error = %v, want ErrLockTimeout", err)
+	}
+	release()
+	if err := ApplyReplay(context.Background(), result); err != nil {
+		t.Fatalf("ApplyReplay() error = %v", err)
+	}
+	counts, _, err := GetCounts("replay-group")
+	if err != nil || counts["alice"] != 2 || counts["bob"] != 1 {
+		t.Errorf("GetCounts() after replay = %v, %v", counts, err)
+	}
+	if idx := readLastIndex("replay-group"); idx != 1 {
+		t.Errorf("last index after replay = %d, want 1", idx)
+	}
+	groupDir, _ := config.GetGroupDataDir("replay-group")
+	if data, _ := os.ReadFile(filepath.Join(groupDir, "assignments.log")); string(data) != log {
+		t.Errorf("assignments.log after replay = %q, want the replayed log", data)
+	}
+
+	if _, err := Replay(context.Background(), "replay-group", filepath.Join(testDir, "missing.log")); err == nil {
+		t.Error("Replay() with missing log error = nil, want error")
+	}
+}
+
+func TestGitState(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	config.Settings.Storage.Git = config.GitConfig{Enabled: true, AuthorEmail: "bot@example.com"}
+	defer func() { config.Settings.Storage.Git = config.GitConfig{} }()
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "git-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if err := Assign("git-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if err := Assign("git-group", true); err != nil {
+		t.Fatalf("Assign() dry run error = %v", err)
+	}
+	if err := ResetCounts(context.Background(), "git-group"); err != nil {
+		t.Fatalf("ResetCounts() error = %v", err)
+	}
+
+	out, err := runGit(config.Settings.Storage.DataDir, "log", "--format=%s <%ae>")
+	if err != nil {
+		t.Fatalf("git log error = %v", err)
+	}
+	want := "Reset counts of git-group <bot@example.com>\nRecord assignment in git-group <bot@example.com>"
+	if out != want {
+		t.Errorf("git log = %q, want %q", out, want)
+	}
+	status, err := runGit(config.Settings.Storage.DataDir, "status", "--porcelain")
+	if err != nil || status != "" {
+		t.Errorf("git status = %q, %v, want clean work tree", status, err)
+	}
+}
+
+func TestDiffGroupConfigs(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{filepath.Join(testDir, "etc")}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	if err := writeLastIndex("team", 1); err != nil {
+		t.Fatalf("writeLastIndex() error = %v", err)
+	}
+
+	old := map[string][]byte{
+		"team":  []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n"),
+		"same":  []byte("strategy: random\nusers: [alice]\n"),
+		"gone":  []byte("strategy: random\nusers: [alice]\n"),
+		"moved": []byte("strategy: least_assigned\navailability_checker: always_available\nusers: [alice, bob, carol]\n"),
+	}
+	new := map[string][]byte{
+		"team":    []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, dave, bob, carol]\nenabled: false\nlimits: {max_per_day: 2}\n"),
+		"same":    old["same"],
+		"moved":   []byte("strategy: least_assigned\navailability_checker: always_available\nusers: [carol, alice]\nstrategy_options: {workload: jira}\n"),
+		"added":   []byte("strategy: random\navailability_checker: always_available\nusers: [erin]\n"),
+		"invalid": []byte("strategy: fastest\navailability_checker: always_available\nusers: [alice]\n"),
+	}
+	diffs, err := DiffGroupConfigs(context.Background(), old, new)
+	if err != nil {
+		t.Fatalf("DiffGroupConfigs() error = %v", err)
+	}
+	var got []string
+	for _, d := range diffs {
+		got = append(got, fmt.Sprintf("%s %s +%v -%v %v %v", d.Group, d.Status, d.UsersAdded, d.UsersRemoved, d.Reordered, d.Settings))
+		if d.Cursor != nil {
+			got = append(got, fmt.Sprintf("  last %s, next %s -> %s", d.Cursor.LastUser, d.Cursor.NextBefore, d.Cursor.NextAfter))
+		}
+		if d.Invalid != "" {
+			got = append(got, "  invalid: "+d.Invalid)
+		}
+	}
+	want := []string{
+		"added added +[erin] -[] false [{availability_checker  always_available} {strategy  random}]",
+		"gone removed +[] -[alice] false [{strategy random }]",
+		"invalid added +[] -[] false []",
+		"  invalid: unknown strategy: fastest",
+		"moved changed +[] -[bob] true [{strategy_options.workload  jira}]",
+		"team changed +[dave] -[] false [{enabled  false} {limits.max_per_day  2}]",
+		"  last bob, next carol -> bob",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("DiffGroupConfigs() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+	repo := filepath.Join(testDir, "repo")
+	etc := filepath.Join(repo, "etc")
+	os.MkdirAll(filepath.Join(etc, "platform"), 0755)
+	os.MkdirAll(filepath.Join(etc, ".hidden"), 0755)
+	for path, data := range map[string]string{"team.yaml": "users: [alice]\n", "platform/oncall.yaml": "users: [bob]\n", ".hidden/x.yaml": "", "README.md": ""} {
+		if err := os.WriteFile(filepath.Join(etc, filepath.FromSlash(path)), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-qm", "init"}} {
+		if _, err := runGit(repo, args...); err != nil {
+			t.Fatalf("git %v error = %v", args, err)
+		}
+	}
+	os.WriteFile(filepath.Join(etc, "team.yaml"), []byte("users: [alice, bob]\n"), 0644)
+	files, err := ReadGitGroupFiles([]string{etc}, "HEAD")
+	if err != nil || len(files) != 2 || string(files["team"]) != "users: [alice]\n" || string(files["platform/oncall"]) != "users: [bob]\n" {
+		t.Errorf("ReadGitGroupFiles() = %q, %v, want team and platform/oncall as committed", files, err)
+	}
+}
+
+// fakeConsul is an in-memory Consul KV API supporting reads and check-and-set writes.
+type fakeConsul struct {
+	mu          sync.Mutex
+	values      map[string][]byte
+	modifyIndex map[string]uint64
+	index       uint64
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	switch r.Method {
+	case http.MethodGet:
+		value, ok := c.values[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]interface{}{{"Key": key, "Value": value, "ModifyIndex": c.modifyIndex[key]}})
+	case http.MethodPut:
+		cas, _ := strconv.ParseUint(r.URL.Query().Get("cas"), 10, 64)
+		if cas != c.modifyIndex[key] {
+			fmt.Fprint(w, "false")
+			return
+		}
+		value, _ := io.ReadAll(r.Body)
+		c.index++
+		c.values[key] = value
+		c.modifyIndex[key] = c.index
+		fmt.Fprint(w, "true")
+	case http.MethodDelete:
+		delete(c.values, key)
+		delete(c.modifyIndex, key)
+	}
+}
+
+// set stores the state of a key, as another replica would.
+func (c *fakeConsul) set(key string, state consulState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key], _ = json.Marshal(state)
+	c.index++
+	c.modifyIndex[key] = c.index
+}
+
+func (c *fakeConsul) state(key string) consulState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var state consulState
+	json.Unmarshal(c.values[key], &state)
+	return state
+}
+
+func TestConsulStorage(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	consul := &fakeConsul{values: map[string][]byte{}, modifyIndex: map[string]uint64{}}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+	config.Settings.Storage.Consul = config.ConsulConfig{Address: server.URL}
+	defer func() { config.Settings.Storage.Consul = config.ConsulConfig{} }()
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "consul-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := Assign("consul-group", false); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+	}
+	key := "autoassigner/consul-group/state"
+	state := consul.state(key)
+	if state.LastIndex != 1 || state.Counts["alice"] != 1 || state.Counts["bob"] != 1 || state.Counts["carol"] != 0 {
+		t.Fatalf("consul state = %+v, want last index 1 and one assignment each for alice and bob", state)
+	}
+
+	// The local files mirror the shared state; removing them must not affect the rotation
+	if err := os.RemoveAll(config.Settings.Storage.DataDir); err != nil {
+		t.Fatalf("Failed to remove data dir: %v", err)
+	}
+	if err := Assign("consul-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if state := consul.state(key); state.LastIndex != 2 || state.Counts["carol"] != 1 {
+		t.Errorf("consul state = %+v, want carol assigned from the shared state", state)
+	}
+
+	// A replica that commits from state another replica has since changed must fail
+	ctx := context.Background()
+	storage := NewConsulStorageManager(config.Settings.Storage.Consul)
+	if err := storage.CheckWritable(ctx, "consul-group"); err != nil {
+		t.Errorf("CheckWritable() error = %v", err)
+	}
+	if _, ok := consul.values["autoassigner/consul-group/preflight"]; ok {
+		t.Errorf("CheckWritable() left its probe key behind")
+	}
+	if _, err := storage.ReadLastIndex(ctx, "consul-group"); err != nil {
+		t.Fatalf("ReadLastIndex() error = %v", err)
+	}
+	if err := Assign("consul-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	tx, err := storage.BeginTransaction(ctx, "consul-group")
+	if err != nil {
+		t.Fatalf("BeginTransaction() error = %v", err)
+	}
+	if err := storage.WriteLastIndex(ctx, "consul-group", 2); err != nil {
+		t.Fatalf("WriteLastIndex() error = %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrStateConflict) {
+		t.Fatalf("Commit() error = %v, want ErrStateConflict", err)
+	}
+	if state := consul.state(key); state.LastIndex != 0 || state.Counts["alice"] != 2 {
+		t.Errorf("consul state = %+v, want the concurrent assignment of alice kept", state)
+	}
+	if got := readLastIndex("consul-group"); got != 0 {
+		t.Errorf("local last index = %d, want 0 after the conflicting commit was rolled back", got)
+	}
+
+	// Changes made outside of an assignment apply to the shared state, so a
+	// host whose local files lag behind doesn't roll back other replicas
+	shared := consul.state(key)
+	shared.Counts["bob"] += 5
+	consul.set(key, shared)
+	if _, err := SetCursor(ctx, "consul-group", "carol", true); err != nil {
+		t.Fatalf("SetCursor() error = %v", err)
+	}
+	if state := consul.state(key); state.LastIndex != 2 || state.Counts["bob"] != shared.Counts["bob"] {
+		t.Errorf("consul state after set-cursor = %+v, want last index 2 and bob's count %d kept", state, shared.Counts["bob"])
+	}
+	rebuild, err := RebuildCounts("consul-group")
+	if err != nil {
+		t.Fatalf("RebuildCounts() error = %v", err)
+	}
+	// Only alice's local count differs from the log
+	local := map[string]int{}
+	for user, count := range rebuild.RebuiltCounts {
+		local[user] = count
+	}
+	local["alice"]--
+	if err := writeCounts("consul-group", local); err != nil {
+		t.Fatalf("writeCounts() error = %v", err)
+	}
+	if _, err := ApplyRebuild(ctx, "consul-group"); err != nil {
+		t.Fatalf("ApplyRebuild() error = %v", err)
+	}
+	if state := consul.state(key); state.Counts["alice"] != shared.Counts["alice"]+1 || state.Counts["bob"] != shared.Counts["bob"] {
+		t.Errorf("consul counts after rebuild = %v, want alice's count raised by one and bob's kept", state.Counts)
+	}
+
+	if err := ResetCounts(context.Background(), "consul-group"); err != nil {
+		t.Fatalf("ResetCounts() error = %v", err)
+	}
+	if state := consul.state(key); state.Counts["alice"] != 0 {
+		t.Errorf("consul counts after reset = %v, want zero", state.Counts)
+	}
+}
+
+// fakeDynamoDB is an in-memory DynamoDB table supporting the queries and
+// transactions of DynamoDBStorageManager.
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	items map[[2]string]dynamoItem // By partition and sort key
+}
+
+func (d *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch r.Header.Get("X-Amz-Target") {
+	case "DynamoDB_20120810.Query":
+		var input struct {
+			ExpressionAttributeValues dynamoItem
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		items := []dynamoItem{}
+		for key, item := range d.items {
+			if key[0] == input.ExpressionAttributeValues[":pk"].S {
+				items = append(items, item)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Items": items})
+	case "DynamoDB_20120810.TransactWriteItems":
+		var input struct {
+			TransactItems []struct {
+				Update, Put, Delete *struct {
+					Key                       dynamoItem
+					Item                      dynamoItem
+					UpdateExpression          string
+					ConditionExpression       string
+					ExpressionAttributeNames  map[string]string
+					ExpressionAttributeValues dynamoItem
+				}
+			}
+		}
+		json.NewDecoder(r.Body).Decode(&input)
+		var reasons []map[string]string
+		failed := false
+		for _, action := range input.TransactItems {
+			reason := "None"
+			if u := action.Update; u != nil {
+				item, exists := d.items[[2]string{u.Key["pk"].S, u.Key["sk"].S}]
+				switch u.ConditionExpression {
+				case "attribute_not_exists(pk)":
+					if exists {
+						reason = "ConditionalCheckFailed"
+					}
+				case "#version = :version":
+					if item["version"] != u.ExpressionAttributeValues[":version"] {
+						reason = "ConditionalCheckFailed"
+					}
+				}
+			}
+			failed = failed || reason != "None"
+			reasons = append(reasons, map[string]string{"Code": reason})
+		}
+		if failed {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"__type":              "com.amazonaws.dynamodb.v20120810#TransactionCanceledException",
+				"message":             "Transaction cancelled",
+				"CancellationReasons": reasons,
+			})
+			return
+		}
+		for _, action := range input.TransactItems {
+			switch {
+			case action.Put != nil:
+				d.items[[2]string{action.Put.Item["pk"].S, action.Put.Item["sk"].S}] = action.Put.Item
+			case action.Delete != nil:
+				delete(d.items, [2]string{action.Delete.Key["pk"].S, action.Delete.Key["sk"].S})
+			case action.Update != nil:
+				u := action.Update
+				key := [2]string{u.Key["pk"].S, u.Key["sk"].S}
+				item := dynamoItem{"pk": u.Key["pk"], "sk": u.Key["sk"]}
+				for name, value := range d.items[key] {
+					item[name] = value
+				}
+				set, add, _ := strings.Cut(strings.TrimPrefix(u.UpdateExpression, "SET "), " ADD ")
+				for _, assignment := range strings.Split(set, ", ") {
+					name, value, _ := strings.Cut(assignment, " = ")
+					item[u.ExpressionAttributeNames[name]] = u.ExpressionAttributeValues[value]
+				}
+				if add != "" {
+					name, value, _ := strings.Cut(add, " ")
+					current, _ := strconv.Atoi(item[u.ExpressionAttributeNames[name]].N)
+					delta, _ := strconv.Atoi(u.ExpressionAttributeValues[value].N)
+					item[u.ExpressionAttributeNames[name]] = dynamoNumber(int64(current + delta))
+				}
+				d.items[key] = item
+			}
+		}
+		w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// attribute returns an attribute of an item as a string.
+func (d *fakeDynamoDB) attribute(pk, sk, name string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	value := d.items[[2]string{pk, sk}][name]
+	return value.S + value.N
+}
+
+func TestDynamoDBStorage(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+	table := &fakeDynamoDB{items: map[[2]string]dynamoItem{}}
+	server := httptest.NewServer(table)
+	defer server.Close()
+	config.Settings.Storage.DynamoDB = config.DynamoDBConfig{Table: "state", Endpoint: server.URL}
+	defer func() { config.Settings.Storage.DynamoDB = config.DynamoDBConfig{} }()
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "dynamo-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	pk := "autoassigner/dynamo-group"
+	state := func() string {
+		return fmt.Sprintf("index %s version %s alice %s bob %s carol %s",
+			table.attribute(pk, "cursor", "last_index"), table.attribute(pk, "cursor", "version"),
+			table.attribute(pk, "count#alice", "count"), table.attribute(pk, "count#bob", "count"), table.attribute(pk, "count#carol", "count"))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := Assign("dynamo-group", false); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+	}
+	if got, want := state(), "index 1 version 2 alice 1 bob 1 carol "; got != want {
+		t.Fatalf("dynamodb state = %q, want %q", got, want)
+	}
+
+	// The local files mirror the shared state; removing them must not affect the rotation
+	if err := os.RemoveAll(config.Settings.Storage.DataDir); err != nil {
+		t.Fatalf("Failed to remove data dir: %v", err)
+	}
+	if err := Assign("dynamo-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if got, want := state(), "index 2 version 3 alice 1 bob 1 carol 1"; got != want {
+		t.Errorf("dynamodb state = %q, want %q", got, want)
+	}
+
+	// A replica that commits from state another replica has since changed must fail
+	ctx := context.Background()
+	storage := NewDynamoDBStorageManager(config.Settings.Storage.DynamoDB)
+	if err := storage.CheckWritable(ctx, "dynamo-group"); err != nil {
+		t.Errorf("CheckWritable() error = %v", err)
+	}
+	if _, ok := table.items[[2]string{"autoassigner/dynamo-group", "preflight"}]; ok {
+		t.Errorf("CheckWritable() left its probe item behind")
+	}
+	if _, err := storage.ReadLastIndex(ctx, "dynamo-group"); err != nil {
+		t.Fatalf("ReadLastIndex() error = %v", err)
+	}
+	if err := Assign("dynamo-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	tx, err := storage.BeginTransaction(ctx, "dynamo-group")
+	if err != nil {
+		t.Fatalf("BeginTransaction() error = %v", err)
+	}
+	if err := storage.WriteLastIndex(ctx, "dynamo-group", 0); err != nil {
+		t.Fatalf("WriteLastIndex() error = %v", err)
+	}
+	if err := storage.IncrementCount(ctx, "dynamo-group", "alice"); err != nil {
+		t.Fatalf("IncrementCount() error = %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrStateConflict) {
+		t.Fatalf("Commit() error = %v, want ErrStateConflict", err)
+	}
+	if got, want := state(), "index 0 version 4 alice 2 bob 1 carol 1"; got != want {
+		t.Errorf("dynamodb state = %q, want %q with only the concurrent assignment of alice", got, want)
+	}
+	if got := readLastIndex("dynamo-group"); got != 0 {
+		t.Errorf("local last index = %d, want 0 after the conflicting commit was rolled back", got)
+	}
+
+	if err := ResetCounts(context.Background(), "dynamo-group"); err != nil {
+		t.Fatalf("ResetCounts() error = %v", err)
+	}
+	if got, want := state(), "index 0 version 5 alice 0 bob 0 carol 0"; got != want {
+		t.Errorf("dynamodb state after reset = %q, want %q", got, want)
+	}
+}
+
+// fakeRedis serves the Redis commands used by RedisLocker from memory.
+type fakeRedis struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time // Expiry of keys set with PX or PEXPIRE
+}
+
+// expire removes a key whose expiry passed.
+func (s *fakeRedis) expire(key string) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		delete(s.values, key)
+		delete(s.expires, key)
+	}
+}
+
+// setExpiry sets the expiry of a key in milliseconds from now.
+func (s *fakeRedis) setExpiry(key, ms string) {
+	if s.expires == nil {
+		s.expires = map[string]time.Time{}
+	}
+	n, _ := strconv.Atoi(ms)
+	s.expires[key] = time.Now().Add(time.Duration(n) * time.Millisecond)
+}
+
+func (s *fakeRedis) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				var n int
+				if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+					return
+				}
+				args := make([]string, n)
+				for i := range args {
+					var size int
+					fmt.Fscanf(r, "$%d\r\n", &size)
+					data := make([]byte, size+2)
+					io.ReadFull(r, data)
+					args[i] = string(data[:size])
+				}
+				fmt.Fprint(conn, s.reply(args))
+			}
+		}()
+	}
+}
+
+func (s *fakeRedis) reply(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		s.expire(args[1])
+		if _, ok := s.values[args[1]]; ok {
+			return "$-1\r\n"
+		}
+		s.values[args[1]] = args[2]
+		if len(args) == 6 && strings.ToUpper(args[4]) == "PX" {
+			s.setExpiry(args[1], args[5])
+		}
+		return "+OK\r\n"
+	case "GET":
+		s.expire(args[1])
+		value, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "PTTL":
+		s.expire(args[1])
+		if _, ok := s.values[args[1]]; !ok {
+			return ":-2\r\n"
+		}
+		return ":30000\r\n"
+	case "EVAL":
+		s.expire(args[3])
+		if s.values[args[3]] != args[4] {
+			return ":0\r\n"
+		}
+		if strings.Contains(args[1], "pexpire") {
+			s.setExpiry(args[3], args[5])
+		} else {
+			delete(s.values, args[3])
+			delete(s.expires, args[3])
+		}
+		return ":1\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func (s *fakeRedis) held(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(key)
+	_, ok := s.values[key]
+	return ok
+}
+
+func TestRedisLocker(t *testing.T) {
+	var _ GroupLocker = &RedisLocker{} // Verify RedisLocker implements GroupLocker
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	redis := &fakeRedis{values: map[string]string{}}
+	go redis.serve(ln)
+
+	ctx := context.Background()
+	first := NewRedisLocker(config.LockConfig{Backend: config.LockRedis, Address: ln.Addr().String()})
+	release, err := first.Lock(ctx, "locked-group")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	second := NewRedisLocker(config.LockConfig{Backend: config.LockRedis, Address: ln.Addr().String()})
+	second.Wait = 50 * time.Millisecond
+	if _, err := second.Lock(ctx, "locked-group"); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Lock() of a held lock error = %v, want ErrLockTimeout", err)
+	}
+	if _, err := second.Lock(ctx, "other-group"); err != nil {
+		t.Errorf("Lock() of another group error = %v", err)
+	}
+
+	// The wait of a context overrides the configured one
+	start := time.Now()
+	var timeoutErr *LockTimeoutError
+	if _, err := second.Lock(WithLockWait(ctx, 0), "locked-group"); !errors.As(err, &timeoutErr) || timeoutErr.Wait != 0 {
+		t.Errorf("Lock() without waiting error = %v, want LockTimeoutError after 0s", err)
+	}
+	waitCtx, cancel := context.WithTimeout(WithLockWait(ctx, -1), 200*time.Millisecond)
+	if _, err := second.Lock(waitCtx, "locked-group"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Lock() waiting without limit error = %v, want context.DeadlineExceeded", err)
+	}
+	cancel()
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Lock() waiting without limit returned after %s", elapsed)
+	}
+
+	status, err := second.Status(ctx, "locked-group")
+	host, _ := os.Hostname()
+	if err != nil || !status.Held || status.Holder != fmt.Sprintf("%s:%d", host, os.Getpid()) || status.ExpiresIn != 30*time.Second {
+		t.Errorf("Status() of a held lock = %+v, %v", status, err)
+	}
+	if status, err := second.Status(ctx, "free-group"); err != nil || status.Held {
+		t.Errorf("Status() of a free lock = %+v, %v", status, err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+	if _, err := second.Lock(ctx, "locked-group"); err != nil {
+		t.Errorf("Lock() after release error = %v", err)
+	}
+	// A stale holder must not release a lock another host has taken since
+	if err := release(); err != nil {
+		t.Fatalf("second release() error = %v", err)
+	}
+	if !redis.held("autoassigner:lock:locked-group") {
+		t.Error("stale release removed the lock held by another host")
+	}
+
+	// A lock held for longer than its TTL is renewed until it is released
+	slow := NewRedisLocker(config.LockConfig{Backend: config.LockRedis, Address: ln.Addr().String()})
+	slow.TTL = 60 * time.Millisecond
+	releaseSlow, err := slow.Lock(ctx, "slow-group")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	time.Sleep(4 * slow.TTL)
+	if !redis.held("autoassigner:lock:slow-group") {
+		t.Error("lock expired while it was held")
+	}
+	if err := releaseSlow(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+	if redis.held("autoassigner:lock:slow-group") {
+		t.Error("lock was still held after release")
+	}
+
+	// Assignments take and release the lock of their group
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	config.Settings.Storage.Lock = config.LockConfig{Backend: config.LockRedis, Address: ln.Addr().String(), WaitSeconds: 1}
+	defer func() { config.Settings.Storage.Lock = config.LockConfig{} }()
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "lock-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := Assign("lock-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if redis.held("autoassigner:lock:lock-group") {
+		t.Error("Assign() did not release the lock")
+	}
+	if err := Assign("locked-group", false); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("Assign() of a locked group error = %v, want ErrLockTimeout", err)
+	}
+	if status, err := GetLockStatus(ctx, "lock-group"); err != nil || status.Backend != config.LockRedis || status.Held || status.Wait != time.Second {
+		t.Errorf("GetLockStatus() = %+v, %v, want a free redis lock waited for 1s", status, err)
+	}
+	config.Settings.Storage.Lock = config.LockConfig{}
+	if status, err := GetLockStatus(ctx, "lock-group"); err != nil || status.Backend != "" {
+		t.Errorf("GetLockStatus() without a lock = %+v, %v, want no backend", status, err)
+	}
+}
+
+func TestLockGroup(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [a, b, c, d]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "busy.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	// Concurrent assignments, like those of the webhook server, are serialized without a lock backend
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := AssignUser(WithLockWait(context.Background(), -1), "busy", AssignOptions{}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("AssignUser() error = %v", err)
+	}
+	if counts := readCounts("busy"); !reflect.DeepEqual(counts, map[string]int{"a": 10, "b": 10, "c": 10, "d": 10}) {
+		t.Errorf("counts after concurrent assignments = %v, want 10 each", counts)
+	}
+
+	ctx := context.Background()
+	release, err := lockGroup(ctx, "busy")
+	if err != nil {
+		t.Fatalf("lockGroup() error = %v", err)
+	}
+	if _, err := lockGroup(WithLockWait(ctx, 0), "busy"); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("lockGroup() of a group locked in this process error = %v, want ErrLockTimeout", err)
+	}
+	if err := release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+
+	// Another process holding the lock file keeps the group locked
+	file, err := os.Open(filepath.Join(testDir, "data", ".locks", "busy.lock"))
+	if err != nil {
+		t.Fatalf("Failed to open lock file: %v", err)
+	}
+	defer file.Close()
+	if locked, err := tryLockFile(file); !locked || err != nil {
+		t.Fatalf("tryLockFile() = %v, %v", locked, err)
+	}
+	if _, err := lockGroup(WithLockWait(ctx, 50*time.Millisecond), "busy"); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("lockGroup() of a group locked by another process error = %v, want ErrLockTimeout", err)
+	}
+	unlockFile(file)
+	release, err = lockGroup(WithLockWait(ctx, 0), "busy")
+	if err != nil {
+		t.Fatalf("lockGroup() after the other process released it error = %v", err)
+	}
+	release()
+}
+
+func TestElector(t *testing.T) {
+	config.Settings.Server.Replicas = config.ReplicasConfig{}
+	if e, err := NewElector(); e != nil || err != nil {
+		t.Fatalf("NewElector() without replicas = %v, %v, want nil", e, err)
+	}
+	var standalone *Elector
+	if status := standalone.Status(context.Background()); status.Role != RoleStandalone || status.Replica != hostProcess() {
+		t.Errorf("Status() of a standalone replica = %+v", status)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	redis := &fakeRedis{values: map[string]string{}}
+	go redis.serve(ln)
+	setLeader := func(token string) {
+		redis.mu.Lock()
+		defer redis.mu.Unlock()
+		if token == "" {
+			delete(redis.values, "autoassigner:leader")
+		} else {
+			redis.values["autoassigner:leader"] = token
+		}
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	config.Settings.Storage.Lock = config.LockConfig{Backend: config.LockRedis, Address: ln.Addr().String()}
+	config.Settings.Server.Replicas = config.ReplicasConfig{Enabled: true}
+	defer func() {
+		config.Settings.Storage.Lock = config.LockConfig{}
+		config.Settings.Server.Replicas = config.ReplicasConfig{}
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	var electors []*Elector
+	var running sync.WaitGroup
+	leading := make(chan context.Context, 2)
+	for i := 0; i < 2; i++ {
+		e, err := NewElector()
+		if err != nil {
+			t.Fatalf("NewElector() error = %v", err)
+		}
+		e.lease = 150 * time.Millisecond
+		electors = append(electors, e)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			e.Run(ctx, func(ctx context.Context) { leading <- ctx })
+		}()
+		// The first replica leads before the second one campaigns
+		if i == 0 {
+			waitFor("the first leader", func() bool { return e.Status(ctx).Role == RoleLeader })
+		}
+	}
+	first := <-leading
+
+	follower := electors[1].Status(ctx)
+	if follower.Role != RoleFollower || follower.Leader != hostProcess() {
+		t.Errorf("Status() of the second replica = %+v, want a follower of %s", follower, hostProcess())
+	}
+
+	// A leader whose lease was taken over steps down and stops leading
+	setLeader("other-1:1/0123")
+	select {
+	case <-first.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("the context of a replica that lost the leadership was not cancelled")
+	}
+	for i, e := range electors {
+		if status := e.Status(ctx); status.Role != RoleFollower || status.Leader != "other-1:1" {
+			t.Errorf("Status() of replica %d after a takeover = %+v, want a follower of other-1:1", i+1, status)
+		}
+	}
+
+	// Once the lease expires, one of the replicas takes over
+	setLeader("")
+	<-leading
+	leaders := 0
+	for _, e := range electors {
+		if e.Status(ctx).Role == RoleLeader {
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("%d replicas lead after the lease expired, want 1", leaders)
+	}
+
+	cancel()
+	running.Wait()
+	if redis.held("autoassigner:leader") {
+		t.Error("Run() did not release the leadership when done")
+	}
+}
+
+func TestArchiveAndDeleteGroup(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC) }
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n")
+	for _, group := range []string{"archived", "deleted", "purged"} {
+		if err := os.WriteFile(filepath.Join(testDir, group+".yaml"), configData, 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		if err := Assign(group, false); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+	}
+	if err := writeQueue([]QueuedAssignment{{ID: "1", Group: "archived"}, {ID: "2", Group: "other"}}); err != nil {
+		t.Fatalf("writeQueue() error = %v", err)
+	}
+
+	dir, err := ArchiveGroup("archived")
+	if err != nil {
+		t.Fatalf("ArchiveGroup() error = %v", err)
+	}
+	if want := filepath.Join(config.Settings.Storage.DataDir, ".archive", "archived-20240515T120000Z"); dir != want {
+		t.Errorf("ArchiveGroup() dir = %s, want %s", dir, want)
+	}
+	for _, path := range []string{filepath.Join(dir, "group.yaml"), filepath.Join(dir, "data", "assignments.log")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("archived file %s missing: %v", path, err)
+		}
+	}
+	if queue, _ := ListQueue(); len(queue) != 1 || queue[0].Group != "other" {
+		t.Errorf("queue after archive = %+v, want only the other group's assignment", queue)
+	}
+
+	if err := DeleteGroup("deleted", false); err != nil {
+		t.Fatalf("DeleteGroup() error = %v", err)
+	}
+	if err := DeleteGroup("purged", true); err != nil {
+		t.Fatalf("DeleteGroup() with purge error = %v", err)
+	}
+
+	tests := []struct {
+		group      string
+		dataExists bool
+	}{
+		{"archived", false},
+		{"deleted", true},
+		{"purged", false},
+	}
+	for _, tt := range tests {
+		if _, err := os.Stat(filepath.Join(testDir, tt.group+".yaml")); !os.IsNotExist(err) {
+			t.Errorf("config of %s still exists", tt.group)
+		}
+		_, err := os.Stat(filepath.Join(config.Settings.Storage.DataDir, tt.group))
+		if exists := err == nil; exists != tt.dataExists {
+			t.Errorf("data directory of %s exists = %v, want %v", tt.group, exists, tt.dataExists)
+		}
+	}
+
+	for _, group := range []string{"archived", "missing", "../data", ".archive"} {
+		if err := DeleteGroup(group, true); !errors.Is(err, ErrInvalidGroup) {
+			t.Errorf("DeleteGroup(%q) error = %v, want ErrInvalidGroup", group, err)
+		}
+	}
+}
+
+func TestGarbageCollection(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "kept.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := Assign("kept", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if err := writeCounts("kept", map[string]int{"alice": 1, "bob": 0, "carol": 4}); err != nil {
+		t.Fatalf("writeCounts() error = %v", err)
+	}
+	if err := writeDebts("kept", map[string]int{"dave": 1, "bob": 1}); err != nil {
+		t.Fatalf("writeDebts() error = %v", err)
+	}
+	for _, dir := range []string{"renamed-team", ".archive/old-team", ".git"} {
+		if err := os.MkdirAll(filepath.Join(config.Settings.Storage.DataDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	report, err := FindGarbage()
+	if err != nil {
+		t.Fatalf("FindGarbage() error = %v", err)
+	}
+	if len(report.OrphanedDirs) != 1 || report.OrphanedDirs[0] != "renamed-team" {
+		t.Errorf("OrphanedDirs = %v, want [renamed-team]", report.OrphanedDirs)
+	}
+	if got := strings.Join(report.OrphanedUsers["kept"], ","); got != "carol,dave" {
+		t.Errorf("OrphanedUsers[kept] = %s, want carol,dave", got)
+	}
+
+	// Users aren't dropped while an assignment holds the lock of their group
+	release, err := lockGroup(context.Background(), "kept")
+	if err != nil {
+		t.Fatalf("lockGroup() error = %v", err)
+	}
+	if err := CollectGarbage(WithLockWait(context.Background(), 0), report); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("CollectGarbage() while the group is locked error = %v, want ErrLockTimeout", err)
+	}
+	release()
+	if err := CollectGarbage(context.Background(), report); err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+	if report, err := FindGarbage(); err != nil || !report.Empty() {
+		t.Errorf("FindGarbage() after collection = %+v, %v, want empty report", report, err)
+	}
+	counts, _ := readCountsFile("kept")
+	debts, _ := readDebts("kept")
+	if len(counts) != 2 || counts["alice"] != 1 || len(debts) != 1 || debts["bob"] != 1 {
+		t.Errorf("state after collection = %v, %v, want only configured users kept", counts, debts)
+	}
+	if _, err := os.Stat(filepath.Join(config.Settings.Storage.DataDir, ".archive", "old-team")); err != nil {
+		t.Errorf("archived group was removed: %v", err)
+	}
+}
+
+func TestNestedGroups(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n")
+	if err := SaveGroupConfig("platform/oncall", configData); err != nil {
+		t.Fatalf("SaveGroupConfig() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "platform", "oncall.yaml")); err != nil {
+		t.Errorf("config of platform/oncall not in a subdirectory: %v", err)
+	}
+	if err := Assign("platform/oncall", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "data", "platform", "oncall", "assignments.log")); err != nil {
+		t.Errorf("data of platform/oncall not in a subdirectory: %v", err)
+	}
+	groups, err := config.ListGroups()
+	if err != nil || len(groups) != 1 || groups[0] != "platform/oncall" {
+		t.Errorf("ListGroups() = %v, %v, want [platform/oncall]", groups, err)
+	}
+
+	for _, name := range []string{"platform", "platform/oncall/primary", "platform//oncall", "platform/.hidden", "/platform", "oncall-*"} {
+		if err := SaveGroupConfig(name, configData); err == nil {
+			t.Errorf("SaveGroupConfig(%s) succeeded, want an error", name)
+		}
+	}
+	if err := RenameGroup(context.Background(), "platform/oncall", "infra/oncall"); err != nil {
+		t.Fatalf("RenameGroup() error = %v", err)
+	}
+	if counts, _, err := GetCounts("infra/oncall"); err != nil || counts["alice"] != 1 {
+		t.Errorf("GetCounts() after rename = %v, %v, want alice's assignment", counts, err)
+	}
+	if err := SaveGroupConfig("platform", configData); err != nil {
+		t.Errorf("SaveGroupConfig(platform) once platform/oncall is gone error = %v", err)
+	}
+
+	// Namespace directories are not orphaned, unlike the directories of missing groups in them
+	os.MkdirAll(filepath.Join(testDir, "data", "infra", "gone"), 0755)
+	report, err := FindGarbage()
+	if err != nil || len(report.OrphanedDirs) != 1 || report.OrphanedDirs[0] != "infra/gone" {
+		t.Errorf("FindGarbage() = %+v, %v, want infra/gone orphaned", report, err)
+	}
+}
+
+func TestRenameGroup(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n")
+	for _, group := range []string{"old-team", "taken"} {
+		if err := os.WriteFile(filepath.Join(testDir, group+".yaml"), configData, 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+	if err := Assign("old-team", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if err := writeQueue([]QueuedAssignment{{ID: "1", Group: "old-team"}}); err != nil {
+		t.Fatalf("writeQueue() error = %v", err)
+	}
+
+	if err := RenameGroup(context.Background(), "old-team", "taken"); err == nil {
+		t.Error("RenameGroup() to an existing group error = nil, want error")
+	}
+	if err := RenameGroup(context.Background(), "old-team", "../escape"); err == nil {
+		t.Error("RenameGroup() to an invalid name error = nil, want error")
+	}
+	if err := RenameGroup(context.Background(), "missing", "new-team"); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("RenameGroup() of a missing group error = %v, want ErrInvalidGroup", err)
+	}
+
+	// A failed config step moves the data directory back
+	if err := os.WriteFile(filepath.Join(testDir, "blocked"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := RenameGroup(context.Background(), "old-team", "blocked/team"); err == nil {
+		t.Error("RenameGroup() with an unwritable config directory error = nil, want error")
+	}
+	if _, err := os.Stat(filepath.Join(config.Settings.Storage.DataDir, "blocked", "team")); !os.IsNotExist(err) {
+		t.Error("data directory of the failed rename exists")
+	}
+	records, err := history.ReadFile(filepath.Join(config.Settings.Storage.DataDir, "old-team", "assignments.log"))
+	if err != nil || len(records) != 1 || records[0].Group != "old-team" {
+		t.Errorf("assignment log after a failed rename = %+v, %v, want the assignment under old-team", records, err)
+	}
+
+	if err := RenameGroup(context.Background(), "old-team", "new-team"); err != nil {
+		t.Fatalf("RenameGroup() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "old-team.yaml")); !os.IsNotExist(err) {
+		t.Error("config of the old name still exists")
+	}
+	if _, err := os.Stat(filepath.Join(config.Settings.Storage.DataDir, "old-team")); !os.IsNotExist(err) {
+		t.Error("data directory of the old name still exists")
+	}
+
+	groupDir, _ := config.GetGroupDataDir("new-team")
+	records, err = history.ReadFile(filepath.Join(groupDir, "assignments.log"))
+	if err != nil || len(records) != 1 || records[0].Group != "new-team" || records[0].User != "alice" {
+		t.Errorf("assignment log after rename = %+v, %v, want alice's assignment under new-team", records, err)
+	}
+	if queue, _ := ListQueue(); len(queue) != 1 || queue[0].Group != "new-team" {
+		t.Errorf("queue after rename = %+v, want the assignment moved to new-team", queue)
+	}
+
+	// The rotation continues where it left off
+	if err := Assign("new-team", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	counts, _, err := GetCounts("new-team")
+	if err != nil || counts["alice"] != 1 || counts["bob"] != 1 {
+		t.Errorf("GetCounts() after rename = %v, %v, want one assignment each", counts, err)
+	}
+}
+
+func TestUserAliases(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: least_assigned\navailability_checker: always_available\nusers:\n  - alice: {aliases: [asmith], availability_id: alice@example.com}\n  - bob\n")
+	if err := os.WriteFile(filepath.Join(testDir, "alias-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	groupConf, err := loadAssigneeGroupConfig("alias-group")
+	if err != nil {
+		t.Fatalf("loadAssigneeGroupConfig() error = %v", err)
+	}
+	if strings.Join(groupConf.Users, ",") != "alice,bob" || groupConf.availabilityID("alice") != "alice@example.com" || groupConf.availabilityID("bob") != "bob" {
+		t.Errorf("group config = %+v, want inline settings of alice applied", groupConf)
+	}
+
+	// State written under the old name counts for alice
+	if err := writeCounts("alias-group", map[string]int{"asmith": 2, "bob": 1}); err != nil {
+		t.Fatalf("writeCounts() error = %v", err)
+	}
+	groupDir, _ := config.GetGroupDataDir("alias-group")
+	logData := `{"schema_version":3,"group":"alias-group","user":"asmith","next_index":0}` + "\n"
+	if err := os.WriteFile(filepath.Join(groupDir, "assignments.log"), []byte(logData), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+	if counts := readCounts("alias-group"); counts["alice"] != 2 || len(counts) != 2 {
+		t.Errorf("readCounts() = %v, want the count of asmith merged into alice", counts)
+	}
+	if err := Assign("alias-group", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if counts := readCounts("alias-group"); counts["alice"] != 2 || counts["bob"] != 2 {
+		t.Errorf("counts after Assign() = %v, want bob assigned as least assigned", counts)
+	}
+	rebuild, err := RebuildCounts("alias-group")
+	if err != nil || rebuild.RebuiltCounts["alice"] != 1 {
+		t.Errorf("RebuildCounts() = %+v, %v, want the logged assignment of asmith counted for alice", rebuild, err)
+	}
+	if report, err := FindGarbage(); err != nil || len(report.OrphanedUsers) != 0 {
+		t.Errorf("FindGarbage() = %+v, %v, want aliases not reported as orphaned", report, err)
+	}
+}
+
+func TestRenameUser(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	confPath := filepath.Join(testDir, "rename-group.yaml")
+	if err := os.WriteFile(confPath, []byte("strategy: round_robin\navailability_checker: always_available\nusers: [asmith, bob]\ntrack_open: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := Assign("rename-group", false); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+	}
+	if _, err := Decline(context.Background(), "rename-group", "asmith", ""); err != nil {
+		t.Fatalf("Decline() error = %v", err)
+	}
+
+	if err := RenameUser(context.Background(), "rename-group", "asmith", "alice"); !errors.Is(err, ErrConfig) {
+		t.Errorf("RenameUser() before the config was updated error = %v, want ErrConfig", err)
+	}
+	if err := os.WriteFile(confPath, []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\ntrack_open: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	// The logs aren't rewritten while an assignment holds the lock
+	release, err := lockGroup(context.Background(), "rename-group")
+	if err != nil {
+		t.Fatalf("lockGroup() error = %v", err)
+	}
+	if err := RenameUser(WithLockWait(context.Background(), 0), "rename-group", "asmith", "alice"); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("RenameUser() while the group is locked error = %v, want ErrLockTimeout", err)
+	}
+	release()
+	if err := RenameUser(context.Background(), "rename-group", "asmith", "alice"); err != nil {
+		t.Fatalf("RenameUser() error = %v", err)
+	}
+
+	counts, _, err := GetCounts("rename-group")
+	if err != nil || counts["alice"] != 2 || counts["bob"] != 1 || len(counts) != 2 {
+		t.Errorf("GetCounts() after rename = %v, %v, want the counts of asmith merged into alice", counts, err)
+	}
+	if issues, err := CheckGroup("rename-group"); err != nil || len(issues) != 0 {
+		t.Errorf("CheckGroup() after rename = %v, %v, want no issues", issues, err)
+	}
+	ledger, _ := OpenAssignments("rename-group")
+	if len(ledger) != 3 || ledger[0].User != "alice" {
+		t.Errorf("open assignments after rename = %+v, want alice's assignments renamed", ledger)
+	}
+	status, err := GetDeclineStatus(context.Background(), "rename-group")
+	if err != nil || status.Used["alice"] != 1 {
+		t.Errorf("GetDeclineStatus() after rename = %+v, %v, want the decline of asmith counted for alice", status, err)
+	}
+}
+
+func TestAnonymizeUser(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	ctx := context.Background()
+
+	confPath := filepath.Join(testDir, "anon-group.yaml")
+	if err := os.WriteFile(confPath, []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\ntrack_open: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := Assign("anon-group", false); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+	}
+	if _, err := Decline(ctx, "anon-group", "alice", ""); err != nil {
+		t.Fatalf("Decline() error = %v", err)
+	}
+	if err := PauseUser(context.Background(), "alice", time.Now().Add(24*time.Hour), "test"); err != nil {
+		t.Fatalf("PauseUser() error = %v", err)
+	}
+
+	if _, err := AnonymizeUser(ctx, "alice", AnonymizeOptions{}); !errors.Is(err, ErrConfig) {
+		t.Errorf("AnonymizeUser() of a member error = %v, want ErrConfig", err)
+	}
+	result, err := AnonymizeUser(ctx, "alice", AnonymizeOptions{Before: time.Now().Add(-time.Hour)})
+	if err != nil || len(result.Groups) != 0 {
+		t.Errorf("AnonymizeUser() before the first assignment = %+v, %v, want nothing anonymized", result, err)
+	}
+
+	if err := os.WriteFile(confPath, []byte("strategy: round_robin\navailability_checker: always_available\nusers: [bob]\ntrack_open: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	result, err = AnonymizeUser(ctx, "alice", AnonymizeOptions{Pseudonym: "anon-1", DryRun: true})
+	if err != nil || result.RecordCount() != 3 || len(result.Pauses) != 1 {
+		t.Fatalf("AnonymizeUser() dry run = %+v, %v, want 2 assignments and a decline and the pause", result, err)
+	}
+	if paused, _ := pausedUsers(); paused["alice"].IsZero() {
+		t.Errorf("AnonymizeUser() dry run dropped the pause of alice")
+	}
+
+	result, err = AnonymizeUser(ctx, "alice", AnonymizeOptions{Pseudonym: "anon-1"})
+	if err != nil || result.RecordCount() != 3 || len(result.Groups) != 1 || result.Groups[0].Count != 2 || len(result.Groups[0].Open) != 2 {
+		t.Fatalf("AnonymizeUser() = %+v, %v, want 3 records, 2 counts and 2 open assignments", result, err)
+	}
+	records, err := history.ReadFile(filepath.Join(testDir, "data", "anon-group", "assignments.log"))
+	if err != nil || len(records) != 4 {
+		t.Fatalf("history.ReadFile() = %d records, %v", len(records), err)
+	}
+	for _, record := range records {
+		if record.User == "alice" {
+			t.Errorf("assignment record %+v still names alice", record)
+		}
+	}
+	if records[0].User != "anon-1" || records[1].User != "bob" {
+		t.Errorf("assignment users = %s, %s, want anon-1, bob", records[0].User, records[1].User)
+	}
+	buckets, _ := readCountBuckets("anon-group")
+	if totals := buckets.totals(); totals["anon-1"] != 2 || totals["bob"] != 2 || len(totals) != 2 {
+		t.Errorf("counts after anonymizing = %v, want the counts of alice moved to anon-1", totals)
+	}
+	ledger, _ := OpenAssignments("anon-group")
+	for _, open := range ledger {
+		if open.User == "alice" {
+			t.Errorf("open assignment %+v still names alice", open)
+		}
+	}
+	if paused, _ := pausedUsers(); !paused["alice"].IsZero() {
+		t.Errorf("AnonymizeUser() kept the pause of alice")
+	}
+}
+
+func TestMaintain(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	ctx := context.Background()
+
+	for name, retention := range map[string]string{"kept-group": "", "pruned-group": "history_retention: 30d\n"} {
+		configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n" + retention
+		if err := os.WriteFile(filepath.Join(testDir, name+".yaml"), []byte(configData), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := Assign(name, false); err != nil {
+				t.Fatalf("Assign() error = %v", err)
+			}
+		}
+	}
+
+	maintained, err := Maintain(ctx, time.Now(), MaintainOptions{})
+	if err != nil || len(maintained) != 0 {
+		t.Errorf("Maintain() within the retention = %+v, %v, want nothing pruned", maintained, err)
+	}
+	later := time.Now().Add(60 * 24 * time.Hour)
+	maintained, err = Maintain(ctx, later, MaintainOptions{DryRun: true})
+	if err != nil || len(maintained) != 1 || maintained[0].Pruned["assignments.log"] != 3 {
+		t.Fatalf("Maintain() dry run = %+v, %v, want 3 assignments of pruned-group", maintained, err)
+	}
+
+	maintained, err = Maintain(ctx, later, MaintainOptions{Archive: true})
+	if err != nil || len(maintained) != 1 || maintained[0].Group != "pruned-group" || maintained[0].Archive == "" {
+		t.Fatalf("Maintain() = %+v, %v, want pruned-group archived", maintained, err)
+	}
+	records, err := history.ReadFile(filepath.Join(testDir, "data", "pruned-group", "assignments.log"))
+	if err != nil || len(records) != 0 {
+		t.Errorf("assignments.log after pruning = %d records, %v, want none", len(records), err)
+	}
+	archived, _ := filepath.Glob(filepath.Join(maintained[0].Archive, "assignments-*.log"))
+	if len(archived) != 1 {
+		t.Fatalf("archived logs = %v, want one", archived)
+	}
+	if records, err := history.ReadFile(archived[0]); err != nil || len(records) != 3 {
+		t.Errorf("archived assignments = %d records, %v, want 3", len(records), err)
+	}
+	if records, _ := history.ReadFile(filepath.Join(testDir, "data", "kept-group", "assignments.log")); len(records) != 3 {
+		t.Errorf("assignments.log of the group without retention = %d records, want 3", len(records))
+	}
+
+	counts, _, err := GetCounts("pruned-group")
+	if err != nil || counts["alice"] != 2 || counts["bob"] != 1 {
+		t.Errorf("GetCounts() after pruning = %v, %v, want the counts kept", counts, err)
+	}
+	if issues, err := CheckGroup("pruned-group"); err != nil || len(issues) != 0 {
+		t.Errorf("CheckGroup() after pruning = %v, %v, want the pruned records counted", issues, err)
+	}
+	rebuild, err := RebuildCounts("pruned-group")
+	if err != nil || len(rebuild.Differences()) != 0 {
+		t.Errorf("RebuildCounts() after pruning = %v, %v, want no differences", rebuild.Differences(), err)
+	}
+
+	if err := os.WriteFile(filepath.Join(testDir, "bad-group.yaml"), []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice]\nhistory_retention: soon\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if _, err := Maintain(ctx, later, MaintainOptions{}); !errors.Is(err, ErrConfig) {
+		t.Errorf("Maintain() with an invalid history_retention error = %v, want ErrConfig", err)
+	}
+}
+
+func TestAssignCallback(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	var payloads []CallbackPayload
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var p CallbackPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		payloads = append(payloads, p)
+		if fail {
+			http.Error(w, "ticket OPS-42 is closed", http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+
+	writeGroup := func(callback string) {
+		t.Helper()
+		configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\ncallback:\n" + callback
+		if err := os.WriteFile(filepath.Join(testDir, "callback-group.yaml"), []byte(configData), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+	ctx := context.Background()
+	data := map[string]string{"ticket": "OPS-42"}
+
+	writeGroup(fmt.Sprintf("  url: %s\n  headers: {Authorization: Bearer s3cr3t}\n  rollback: true\n", server.URL))
+	result, err := AssignUser(ctx, "callback-group", AssignOptions{CallbackData: data})
+	if err != nil || result.User != "alice" {
+		t.Fatalf("AssignUser() = %+v, %v, want alice", result, err)
+	}
+	want := CallbackPayload{ID: result.ID, Group: "callback-group", User: "alice", Timestamp: payloads[0].Timestamp, Reason: "round_robin next", Data: data}
+	if len(payloads) != 1 || !reflect.DeepEqual(payloads[0], want) {
+		t.Errorf("callback payloads = %+v, want %+v", payloads, want)
+	}
+
+	// A failed callback undoes the assignment, so bob is still next
+	fail = true
+	_, err = AssignUser(ctx, "callback-group", AssignOptions{CallbackData: data})
+	var cbErr *CallbackError
+	if !errors.As(err, &cbErr) || !cbErr.RolledBack || cbErr.User != "bob" || !strings.Contains(err.Error(), "ticket OPS-42 is closed") {
+		t.Fatalf("AssignUser() with failing callback error = %v, want a rolled back CallbackError", err)
+	}
+	if counts := readCounts("callback-group"); counts["alice"] != 1 || counts["bob"] != 0 {
+		t.Errorf("counts after rollback = %v, want alice=1 bob=0", counts)
+	}
+	if issues, err := CheckGroup("callback-group"); err != nil || len(issues) != 0 {
+		t.Errorf("CheckGroup() after rollback = %v, %v, want no issues", issues, err)
+	}
+
+	// Without rollback the assignment is kept
+	writeGroup(fmt.Sprintf("  url: %s\n  headers: {Authorization: Bearer s3cr3t}\n", server.URL))
+	if _, err := AssignUser(ctx, "callback-group", AssignOptions{}); !errors.Is(err, ErrCallback) || errors.As(err, &cbErr) && cbErr.RolledBack {
+		t.Errorf("AssignUser() with failing callback error = %v, want a kept CallbackError", err)
+	}
+	if counts := readCounts("callback-group"); counts["bob"] != 1 {
+		t.Errorf("counts after failed callback = %v, want bob=1", counts)
+	}
+
+	// Commands get the payload on stdin and fail with their stderr
+	out := filepath.Join(testDir, "payload.json")
+	writeGroup(fmt.Sprintf("  command: [sh, -c, 'cat > %s; echo \"assigned $AUTOASSIGNER_USER\" >&2; exit 3']\n", out))
+	_, err = AssignUser(ctx, "callback-group", AssignOptions{})
+	if !errors.Is(err, ErrCallback) || !strings.Contains(err.Error(), "assigned alice") {
+		t.Errorf("AssignUser() with failing command error = %v, want its stderr", err)
+	}
+	if got, _ := os.ReadFile(out); !strings.Contains(string(got), `"user":"alice"`) {
+		t.Errorf("command stdin = %s, want the payload", got)
+	}
+
+	writeGroup(fmt.Sprintf("  command: [true]\n  url: %s\n", server.URL))
+	if _, err := AssignUser(ctx, "callback-group", AssignOptions{}); !errors.Is(err, ErrConfig) {
+		t.Errorf("AssignUser() with command and url error = %v, want ErrConfig", err)
+	}
+}
+
+func TestReservations(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "reserve-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	ctx := context.Background()
+
+	// Concurrent reservations hold different users without moving the rotation
+	first, err := Reserve(ctx, "reserve-group", time.Minute, AssignOptions{})
+	if err != nil || first.User != "alice" {
+		t.Fatalf("Reserve() = %+v, %v, want alice", first, err)
+	}
+	second, err := Reserve(ctx, "reserve-group", time.Minute, AssignOptions{})
+	if err != nil || second.User != "bob" {
+		t.Fatalf("second Reserve() = %+v, %v, want bob", second, err)
+	}
+	if idx := readLastIndex("reserve-group"); idx != -1 {
+		t.Errorf("last index after reserving = %d, want -1", idx)
+	}
+	if counts := readCounts("reserve-group"); counts["alice"] != 0 || counts["bob"] != 0 {
+		t.Errorf("counts after reserving = %v, want none", counts)
+	}
+
+	// Assignments skip reserved users
+	result, err := AssignUser(ctx, "reserve-group", AssignOptions{DryRun: true})
+	if err != nil || result.User != "carol" {
+		t.Errorf("AssignUser() while alice and bob are reserved = %+v, %v, want carol", result, err)
+	}
+
+	// Committing records the assignment under the reservation's ID
+	committed, err := CommitReservation(ctx, "reserve-group", first.ID)
+	if err != nil || committed.User != "alice" || committed.ID != first.ID {
+		t.Fatalf("CommitReservation() = %+v, %v, want alice with ID %s", committed, err, first.ID)
+	}
+	if idx := readLastIndex("reserve-group"); idx != 0 {
+		t.Errorf("last index after commit = %d, want 0", idx)
+	}
+	if counts := readCounts("reserve-group"); counts["alice"] != 1 {
+		t.Errorf("count of alice after commit = %d, want 1", counts["alice"])
+	}
+	if _, err := CommitReservation(ctx, "reserve-group", first.ID); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("committing twice error = %v, want ErrReservationNotFound", err)
+	}
+
+	// Releasing gives the user back without counting
+	released, err := ReleaseReservation(ctx, "reserve-group", second.ID)
+	if err != nil || released.User != "bob" {
+		t.Fatalf("ReleaseReservation() = %+v, %v, want bob", released, err)
+	}
+	if counts := readCounts("reserve-group"); counts["bob"] != 0 {
+		t.Errorf("count of bob after release = %d, want 0", counts["bob"])
+	}
+	third, err := Reserve(ctx, "reserve-group", time.Minute, AssignOptions{})
+	if err != nil || third.User != "bob" {
+		t.Fatalf("Reserve() after release = %+v, %v, want bob", third, err)
+	}
+
+	// Expired reservations hold nobody and can't be committed
+	now = now.Add(2 * time.Minute)
+	if reservations, err := Reservations("reserve-group"); err != nil || len(reservations) != 0 {
+		t.Errorf("Reservations() after expiry = %+v, %v, want none", reservations, err)
+	}
+	if _, err := CommitReservation(ctx, "reserve-group", third.ID); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("committing an expired reservation error = %v, want ErrReservationNotFound", err)
+	}
+}
+
+func TestParseRoleRequests(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []RoleRequest
+		wantErr bool
+	}{
+		{"reviewer:2,qa:1", []RoleRequest{{"reviewer", 2}, {"qa", 1}}, false},
+		{" reviewer , qa:3 ", []RoleRequest{{"reviewer", 1}, {"qa", 3}}, false},
+		{"reviewer:0", nil, true},
+		{"reviewer:x", nil, true},
+		{"reviewer,reviewer:2", nil, true},
+		{":2", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRoleRequests(tt.input)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRoleRequests(%q) = %v, %v, want %v (error %v)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAssignRoles(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte(`strategy: round_robin
+availability_checker: always_available
+track_open: true
+users:
+  - alice
+  - bob
+  - carol: {tags: [qa]}
+  - dave
+tags:
+  dave: [qa]
+roles:
+  reviewer: {users: [alice, bob, carol]}
+  qa: {tags: [qa]}
+`)
+	if err := os.WriteFile(filepath.Join(testDir, "roles-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	ctx := context.Background()
+
+	result, err := AssignRoles(ctx, "roles-group", []RoleRequest{{"reviewer", 2}, {"qa", 1}}, AssignOptions{})
+	if err != nil {
+		t.Fatalf("AssignRoles() error = %v", err)
+	}
+	want := []RoleSelection{{"reviewer", "alice", "round_robin next", nil}, {"reviewer", "bob", "round_robin next", nil}, {"qa", "carol", "round_robin next", nil}}
+	if result.ID == "" || !reflect.DeepEqual(result.Selections, want) {
+		t.Errorf("AssignRoles() = %+v, want selections %v with an ID", result, want)
+	}
+	records, err := history.ReadFile(filepath.Join(testDir, "data", "roles-group", "assignments.log"))
+	if err != nil || len(records) != 3 {
+		t.Fatalf("assignment log = %+v, %v, want 3 records", records, err)
+	}
+	for i, record := range records {
+		if record.ID != result.ID || record.Role != want[i].Role || record.User != want[i].User {
+			t.Errorf("record %d = %+v, want %s as %s with ID %s", i, record, want[i].User, want[i].Role, result.ID)
+		}
+	}
+	if counts := readCounts("roles-group"); counts["alice"] != 1 || counts["bob"] != 1 || counts["carol"] != 1 {
+		t.Errorf("counts after AssignRoles() = %v, want one each for alice, bob and carol", counts)
+	}
+
+	// Closing the assignment closes it for every role
+	if _, err := CloseAssignment(context.Background(), "roles-group", result.ID); err != nil {
+		t.Fatalf("CloseAssignment() error = %v", err)
+	}
+	if open, _ := OpenAssignments("roles-group"); len(open) != 0 {
+		t.Errorf("open assignments after close = %+v, want none", open)
+	}
+
+	// A role that can't be filled leaves the state untouched
+	_, err = AssignRoles(ctx, "roles-group", []RoleRequest{{"reviewer", 1}, {"qa", 3}}, AssignOptions{})
+	if !errors.Is(err, ErrNoAvailableAssignee) {
+		t.Errorf("AssignRoles() with too few users error = %v, want ErrNoAvailableAssignee", err)
+	}
+	if idx := readLastIndex("roles-group"); idx != 2 {
+		t.Errorf("last index after failed AssignRoles() = %d, want 2", idx)
+	}
+	if records, _ := history.ReadFile(filepath.Join(testDir, "data", "roles-group", "assignments.log")); len(records) != 3 {
+		t.Errorf("assignment log after failed AssignRoles() has %d records, want 3", len(records))
+	}
+
+	if _, err := AssignRoles(ctx, "roles-group", []RoleRequest{{"security", 1}}, AssignOptions{}); !errors.Is(err, ErrConfig) {
+		t.Errorf("AssignRoles() with an unknown role error = %v, want ErrConfig", err)
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	ulidState.ms = 0 // Forget IDs of other tests, which were created later
+	at := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	first := newULID(at)
+	if len(first) != 26 || strings.Trim(first, crockford) != "" {
+		t.Fatalf("newULID() = %q, want 26 Crockford base32 characters", first)
+	}
+	// The first 10 characters encode the millisecond timestamp
+	var ms int64
+	for _, c := range first[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+	}
+	if ms != at.UnixMilli() {
+		t.Errorf("timestamp of %s = %d, want %d", first, ms, at.UnixMilli())
+	}
+
+	// IDs of the same millisecond, or of an earlier one, still sort in creation order
+	prev := first
+	for _, next := range []time.Time{at, at, at.Add(-time.Second), at.Add(time.Millisecond)} {
+		id := newULID(next)
+		if id <= prev {
+			t.Errorf("newULID() = %s after %s, want a greater ID", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestAssignmentIDs(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+
+	configData := []byte("strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n")
+	if err := os.WriteFile(filepath.Join(testDir, "id-group.yaml"), configData, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	ctx := context.Background()
+
+	result, err := AssignUser(ctx, "id-group", AssignOptions{})
+	if err != nil || len(result.ID) != 26 {
+		t.Fatalf("AssignUser() = %+v, %v, want a ULID", result, err)
+	}
+
+	// Repeating a request with a given ID returns the logged assignment
+	for i := 0; i < 2; i++ {
+		result, err = AssignUser(ctx, "id-group", AssignOptions{ID: "ticket-42"})
+		if err != nil || result.User != "bob" || result.ID != "ticket-42" {
+			t.Errorf("#%d AssignUser() with ID = %+v, %v, want bob with ID ticket-42", i, result, err)
+		}
+	}
+	if counts := readCounts("id-group"); counts["alice"] != 1 || counts["bob"] != 1 {
+		t.Errorf("counts after repeated request = %v, want one each", counts)
+	}
+	records, _ := history.ReadFile(filepath.Join(testDir, "data", "id-group", "assignments.log"))
+	if len(records) != 2 || records[1].ID != "ticket-42" {
+		t.Errorf("assignment log = %+v, want 2 records, the second with ID ticket-42", records)
+	}
+}
+
+func TestWindowStats(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC) }
+
+	configData := `strategy: round_robin
+availability_checker: always_available
+users: [alice, bob, carol]
+aliases:
+  bob: [robert]
+`
+	if err := os.WriteFile(filepath.Join(testDir, "stats-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	groupDir := filepath.Join(testDir, "data", "stats-group")
+	if err := os.MkdirAll(groupDir, 0755); err != nil {
+		t.Fatalf("Failed to create data dir: %v", err)
+	}
+	files := map[string]string{
+		"assignments.log": `{"schema_version":4,"id":"a0","timestamp":"2024-04-01T09:00:00Z","user":"alice","availability_check_ms":5}
+{"schema_version":4,"id":"a1","timestamp":"2024-05-01T09:00:00Z","user":"alice","availability_check_ms":10}
+{"schema_version":4,"id":"a2","timestamp":"2024-05-02T09:00:00Z","user":"alice","availability_check_ms":30}
+{"schema_version":4,"id":"a3","timestamp":"2024-05-03T09:00:00Z","user":"robert","availability_check_ms":200}
+{"schema_version":4,"id":"a4","timestamp":"2024-05-04T09:00:00Z","user":"dave","availability_check_ms":20}
+{"schema_version":4,"id":"r1","timestamp":"2024-05-05T09:00:00Z","user":"alice","role":"lead","availability_check_ms":50}
+{"schema_version":4,"id":"r1","timestamp":"2024-05-05T09:00:00Z","user":"bob","role":"backup","availability_check_ms":50}
+`,
+		"skips.log": `{"timestamp":"2024-03-01T09:00:00Z","user":"carol","reason":"unavailable"}
+{"timestamp":"2024-05-10T09:00:00Z","user":"carol","reason":"unavailable"}
+`,
+		"declines.log": `{"timestamp":"2024-05-11T09:00:00Z","user":"bob"}
+`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(groupDir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	got, err := GetWindowStats(context.Background(), "stats-group", "30d")
+	if err != nil {
+		t.Fatalf("GetWindowStats() error = %v", err)
+	}
+	want := &WindowStats{
+		Group: "stats-group", Window: "30d", Since: "2024-04-15T12:00:00Z",
+		Assignments: 6, Skips: 1, Declines: 1,
+		// Checks of r1 count once: 10, 20, 30, 50 and 200
+		P95LatencyMs: 200,
+		Users: []WindowUserStats{
+			{User: "alice", Assignments: 3, Share: float64(3) / 6},
+			{User: "bob", Assignments: 2, Share: float64(2) / 6, Declines: 1},
+			{User: "carol", Skips: 1},
+			{User: "dave", Assignments: 1, Share: float64(1) / 6},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetWindowStats() = %+v, want %+v", got, want)
+	}
+
+	if _, err := GetWindowStats(context.Background(), "missing-group", "30d"); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("GetWindowStats(missing-group) error = %v, want ErrInvalidGroup", err)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC) }
+
+	groups := map[string]map[string]string{
+		"team-a": {
+			"assignments.log": `{"schema_version":4,"id":"a0","timestamp":"2024-05-01T09:00:00Z","user":"bob"}
+{"schema_version":4,"id":"a1","timestamp":"2024-05-13T09:00:00Z","user":"alice"}
+{"schema_version":4,"id":"a2","timestamp":"2024-05-14T09:00:00Z","user":"bob"}
+{"schema_version":4,"id":"a3","timestamp":"2024-05-14T10:00:00Z","user":"alice"}
+{"schema_version":4,"id":"a4","timestamp":"2024-05-15T09:00:00Z","user":"alice"}
+`,
+			"skips.log": `{"timestamp":"2024-05-14T09:59:00Z","user":"carol","reason":"unavailable"}
+`,
+		},
+		"team-b": {},
+		"other":  {},
+	}
+	for group, files := range groups {
+		configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n"
+		if err := os.WriteFile(filepath.Join(testDir, group+".yaml"), []byte(configData), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		groupDir := filepath.Join(testDir, "data", group)
+		if err := os.MkdirAll(groupDir, 0755); err != nil {
+			t.Fatalf("Failed to create data dir: %v", err)
+		}
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(groupDir, name), []byte(data), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", name, err)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	digest, err := BuildDigest(ctx, []string{"team-*"})
+	if err != nil {
+		t.Fatalf("BuildDigest() error = %v", err)
+	}
+	if len(digest.Groups) != 2 || digest.Groups[0].Group != "team-a" || digest.Groups[1].Group != "team-b" {
+		t.Fatalf("BuildDigest(team-*) groups = %+v, want team-a and team-b", digest.Groups)
+	}
+	a := digest.Groups[0]
+	wantFairness := DigestFairness{Mean: 4.0 / 3, Spread: 3, Busiest: "alice", MaxAboveMean: 3 - 4.0/3}
+	if a.Assignments != 4 || a.Skips != 1 || a.Fairness != wantFairness {
+		t.Errorf("BuildDigest() team-a = %+v, want 4 assignments, 1 skip and fairness %+v", a, wantFairness)
+	}
+	if b := digest.Groups[1]; b.Assignments != 0 || b.Fairness != (DigestFairness{}) {
+		t.Errorf("BuildDigest() team-b = %+v, want nothing assigned", b)
+	}
+	if _, err := BuildDigest(ctx, []string{"missing"}); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("BuildDigest(missing) error = %v, want ErrInvalidGroup", err)
+	}
+	// Summarizing every group leaves out files that aren't groups
+	if err := os.WriteFile(filepath.Join(testDir, "broken.yaml"), []byte("kind: ConfigMap\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if all, err := BuildDigest(ctx, nil); err != nil || len(all.Groups) != 3 {
+		t.Errorf("BuildDigest() of every group = %+v, %v, want other, team-a and team-b", all, err)
+	}
+	if _, err := BuildDigest(ctx, []string{"broken"}); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("BuildDigest(broken) error = %v, want ErrInvalidGroup", err)
+	}
+
+	text, err := RenderDigest(digest, "")
+	if err != nil {
+		t.Fatalf("RenderDigest() error = %v", err)
+	}
+	want := `Assignments from Wed May 8 to Wed May 15
+
+team-a: 4 assigned, 1 skipped, 0 declined
+  alice: 3 (75%)
+  bob: 1 (25%)
+  carol: 0 (0%), skipped 1
+  Fairness: alice had 1.7 above the mean of 1.3, spread 3
+
+team-b: 0 assigned, 0 skipped, 0 declined
+`
+	if text != want {
+		t.Errorf("RenderDigest() =\n%s\nwant\n%s", text, want)
+	}
+
+	tmpl := filepath.Join(testDir, "digest.tmpl")
+	if err := os.WriteFile(tmpl, []byte(`{{range .Groups}}{{.Group}}={{.Assignments}} {{end}}`), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if text, err := RenderDigest(digest, tmpl); err != nil || text != "team-a=4 team-b=0 " {
+		t.Errorf("RenderDigest(%s) = %q, %v, want team-a=4 team-b=0", tmpl, text, err)
+	}
+	if err := os.WriteFile(tmpl, []byte(`{{.Missing}}`), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if _, err := RenderDigest(digest, tmpl); err == nil {
+		t.Error("RenderDigest() with an unknown field should fail")
+	}
+}
+
+func TestNextDigest(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC) // A Wednesday
+	tests := []struct {
+		conf    config.DigestConfig
+		want    time.Time
+		wantErr bool
+	}{
+		{config.DigestConfig{Timezone: "UTC"}, time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC), false},
+		{config.DigestConfig{Day: "Wednesday", Time: "10:00", Timezone: "UTC"}, now, false},
+		{config.DigestConfig{Day: "wednesday", Time: "09:30", Timezone: "UTC"}, time.Date(2024, 5, 22, 9, 30, 0, 0, time.UTC), false},
+		{config.DigestConfig{Day: "friday", Time: "17:00", Timezone: "Europe/Berlin"}, time.Date(2024, 5, 17, 15, 0, 0, 0, time.UTC), false},
+		{config.DigestConfig{Day: "caturday"}, time.Time{}, true},
+		{config.DigestConfig{Time: "9am"}, time.Time{}, true},
+		{config.DigestConfig{Timezone: "Mars/Olympus"}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := NextDigest(tt.conf, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("NextDigest(%+v) = %v, %v, want %v (error %v)", tt.conf, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestQueryHistory(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	logs := map[string]string{
+		"alpha": `{"schema_version":4,"id":"a1","timestamp":"2024-05-01T09:00:00Z","group":"alpha","user":"alice"}
+{"schema_version":4,"id":"a2","timestamp":"2024-05-03T09:00:00Z","group":"alpha","user":"bob"}
+`,
+		"beta": `{"schema_version":4,"id":"b1","timestamp":"2024-05-02T09:00:00Z","group":"beta","user":"alice"}
+{"schema_version":4,"id":"b2","timestamp":"2024-05-04T09:00:00+02:00","group":"beta","user":"alice"}
+`,
+		"gamma": "",
+	}
+	for group, data := range logs {
+		configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+		if err := os.WriteFile(filepath.Join(testDir, group+".yaml"), []byte(configData), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		if data == "" {
+			continue // No log yet
+		}
+		groupDir := filepath.Join(testDir, "data", group)
+		if err := os.MkdirAll(groupDir, 0755); err != nil {
+			t.Fatalf("Failed to create data dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(groupDir, "assignments.log"), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write log: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		opts  QueryOptions
+		want  []string
+	}{
+		{"every group in order", "", QueryOptions{}, []string{"a1", "b1", "a2", "b2"}},
+		{"user", "user=alice", QueryOptions{}, []string{"a1", "b1", "b2"}},
+		{"most recent", "user=alice", QueryOptions{Limit: 2}, []string{"b1", "b2"}},
+		{"group", "group=beta", QueryOptions{}, []string{"b1", "b2"}},
+		{"allowed groups", "", QueryOptions{Allow: func(group string) bool { return group == "alpha" }}, []string{"a1", "a2"}},
+		{"no matches", "user=carol", QueryOptions{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := history.ParseQuery(tt.query, time.Now())
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			records, err := QueryHistory(context.Background(), q, tt.opts)
+			if err != nil {
+				t.Fatalf("QueryHistory() error = %v", err)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, r.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryHistory(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	q, _ := history.ParseQuery("group=missing", time.Now())
+	if _, err := QueryHistory(context.Background(), q, QueryOptions{}); !errors.Is(err, ErrInvalidGroup) {
+		t.Errorf("QueryHistory(group=missing) error = %v, want ErrInvalidGroup", err)
+	}
+	if _, err := os.Stat(filepath.Join(testDir, "data", "gamma")); !os.IsNotExist(err) {
+		t.Errorf("QueryHistory() created the data directory of gamma: %v", err)
+	}
+}
+
+func TestLogSinks(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	t.Setenv("ES_AUTH", "ApiKey secret")
+
+	var mu sync.Mutex
+	requests := map[string][]string{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests[r.URL.Path] = append(requests[r.URL.Path], r.Header.Get("Content-Type")+" "+r.Header.Get("Authorization")+"\n"+string(body))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/_bulk":
+			fmt.Fprint(w, `{"errors":false,"items":[]}`)
+		case "/topics/assignments":
+			fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":1}]}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer collector.Close()
+	syslogServer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer syslogServer.Close()
+
+	configData := fmt.Sprintf(`strategy: round_robin
+availability_checker: always_available
+users: [alice, bob]
+log_sinks:
+  - type: kafka
+    url: %[1]s
+    topic: assignments
+  - type: http_bulk
+    url: %[1]s/
+    index: assignments
+    headers: {Authorization: "env:ES_AUTH"}
+  - type: http_bulk
+    url: %[1]s/broken
+  - type: syslog
+    address: %[2]s
+`, collector.URL, syslogServer.LocalAddr())
+	if err := os.WriteFile(filepath.Join(testDir, "sink-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if issues, err := ValidateGroup(context.Background(), "sink-group", false); err != nil || len(issues) > 0 {
+		t.Fatalf("ValidateGroup() = %v, %v, want no issues", issues, err)
+	}
+
+	// The broken sink is only logged
+	result, err := AssignUser(context.Background(), "sink-group", AssignOptions{ID: "a1", Silent: true})
+	if err != nil || result.User != "alice" {
+		t.Fatalf("AssignUser() = %+v, %v, want alice despite a failing sink", result, err)
+	}
+	if _, err := AssignUser(context.Background(), "sink-group", AssignOptions{DryRun: true, Silent: true}); err != nil {
+		t.Fatalf("AssignUser(dry run) error = %v", err)
+	}
+
+	kafka := requests["/topics/assignments"]
+	if len(kafka) != 1 || !strings.HasPrefix(kafka[0], "application/vnd.kafka.json.v2+json \n") || !strings.Contains(kafka[0], `{"records":[{"key":"a1","value":{"schema_version":4,"id":"a1",`) {
+		t.Errorf("kafka requests = %q, want one with the record of a1", kafka)
+	}
+	bulk := requests["/_bulk"]
+	if len(bulk) != 1 || !strings.HasPrefix(bulk[0], "application/x-ndjson ApiKey secret\n"+`{"index":{"_id":"a1-alice","_index":"assignments"}}`+"\n"+`{"schema_version":4,"id":"a1",`) {
+		t.Errorf("bulk requests = %q, want one indexing a1", bulk)
+	}
+	if broken := requests["/broken/_bulk"]; len(broken) != 1 {
+		t.Errorf("broken sink requests = %q, want 1", broken)
+	}
+	buf := make([]byte, 4096)
+	syslogServer.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := syslogServer.ReadFrom(buf)
+	if err != nil || !strings.HasPrefix(string(buf[:n]), "<14>1 ") || !strings.Contains(string(buf[:n]), `"id":"a1","timestamp"`) {
+		t.Errorf("syslog message = %q, %v, want the record of a1", buf[:n], err)
+	}
+
+	configData = "strategy: round_robin\navailability_checker: always_available\nusers: [alice]\nlog_sinks:\n  - type: kafka\n    url: http://localhost\n  - type: carrier_pigeon\n"
+	if err := os.WriteFile(filepath.Join(testDir, "bad-sink-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	issues, err := ValidateGroup(context.Background(), "bad-sink-group", false)
+	want := []string{"log_sinks[0]: kafka log sink needs url and topic", `log_sinks[1]: unknown log sink type: "carrier_pigeon"`}
+	if err != nil || !reflect.DeepEqual(issues, want) {
+		t.Errorf("ValidateGroup() = %q, %v, want %q", issues, err, want)
+	}
+}
+
+// fakeS3 is an S3 bucket serving the requests of the S3 mirror, with
+// conditional writes.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	version int
+	etags   map[string]string
+	signed  bool
+}
+
+func (s *fakeS3) set(key string, data []byte) {
+	s.version++
+	s.objects[key] = data
+	s.etags[key] = fmt.Sprintf(`"v%d"`, s.version) // Like the ETags of encrypted objects, not an MD5
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signed = s.signed || strings.Contains(r.Header.Get("Authorization"), "/us-east-1/s3/aws4_request") && r.Header.Get("X-Amz-Content-Sha256") != ""
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		fmt.Fprint(w, `<ListBucketResult>`)
+		for k := range s.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>%s</ETag></Contents>`, k, strings.ReplaceAll(s.etags[k], `"`, "&quot;"))
+			}
+		}
+		fmt.Fprint(w, `<IsTruncated>false</IsTruncated></ListBucketResult>`)
+	case r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", s.etags[key])
+		w.Write(data)
+	case r.Method == http.MethodPut:
+		_, exists := s.objects[key]
+		if match := r.Header.Get("If-Match"); match != "" && match != s.etags[key] || r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `<Error><Code>PreconditionFailed</Code></Error>`)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		s.set(key, data)
+		w.Header().Set("ETag", s.etags[key])
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Mirror(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+	bucket := &fakeS3{objects: map[string][]byte{}, etags: map[string]string{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+	config.Settings.Storage.S3 = config.S3Config{Bucket: "bucket", Endpoint: server.URL}
+	defer func() {
+		config.Settings.Storage.S3 = config.S3Config{}
+		s3Mirror.files = map[string]s3File{}
+	}()
+	group := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\n"
+	if err := os.WriteFile(filepath.Join(testDir, "s3-group.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("Failed to write group: %v", err)
+	}
+	ctx := context.Background()
+	assign := func() string {
+		t.Helper()
+		result, err := AssignUser(ctx, "s3-group", AssignOptions{Silent: true})
+		if err != nil {
+			t.Fatalf("AssignUser() error = %v", err)
+		}
+		return result.User
+	}
+
+	if got := assign(); got != "alice" {
+		t.Errorf("first assignee = %s, want alice", got)
+	}
+	if err := (&S3StorageManager{StorageManager: &DefaultStorageManager{}}).CheckWritable(ctx, "s3-group"); err != nil {
+		t.Errorf("CheckWritable() error = %v", err)
+	}
+	bucket.mu.Lock()
+	if _, ok := bucket.objects["autoassigner/s3-group/assignments.log"]; !ok || !bucket.signed {
+		t.Errorf("objects = %v, signed = %v, want a signed push of the assignment log", bucket.objects, bucket.signed)
+	}
+	for name := range bucket.objects {
+		if strings.Contains(name, ".preflight") {
+			t.Errorf("CheckWritable() left %s behind", name)
+		}
+	}
+	bucket.mu.Unlock()
+
+	// A host without the files pulls them, and another host's assignment is pulled before assigning
+	os.RemoveAll(config.Settings.Storage.DataDir)
+	s3Mirror.files = map[string]s3File{}
+	if got := assign(); got != "bob" {
+		t.Errorf("assignee on a fresh host = %s, want bob", got)
+	}
+	bucket.mu.Lock()
+	// Another host assigned carol
+	bucket.set("autoassigner/s3-group/state.json", bytes.Replace(bucket.objects["autoassigner/s3-group/state.json"], []byte(`"index": 1`), []byte(`"index": 2`), 1))
+	bucket.mu.Unlock()
+	if got := assign(); got != "alice" {
+		t.Errorf("assignee after another host's assignment = %s, want alice", got)
+	}
+
+	// Files changed remotely since they were pulled are not overwritten
+	bucket.mu.Lock()
+	bucket.set("autoassigner/s3-group/state.json", []byte(`{"version": 2, "counts": {"base": {"alice": 9}}}`))
+	bucket.mu.Unlock()
+	stateFile := filepath.Join(config.Settings.Storage.DataDir, "s3-group", "state.json")
+	if err := os.WriteFile(stateFile, []byte(`{"version": 2, "counts": {"base": {"alice": 3}}}`), 0644); err != nil {
+		t.Fatalf("Failed to write counts: %v", err)
+	}
+	if err := pushState(ctx, "s3-group"); !errors.Is(err, ErrStateConflict) {
+		t.Errorf("pushState() over a remote change error = %v, want a state conflict", err)
+	}
+
+	// Removed files are removed from the bucket, and then from other hosts
+	if err := PullState(ctx); err != nil {
+		t.Fatalf("PullState() error = %v", err)
+	}
+	if data, _ := os.ReadFile(stateFile); string(data) != `{"version": 2, "counts": {"base": {"alice": 9}}}` {
+		t.Errorf("pulled state = %s, want the remote change", data)
+	}
+	os.Remove(stateFile)
+	if err := pushState(ctx, ""); err != nil {
+		t.Fatalf("pushState() error = %v", err)
+	}
+	bucket.mu.Lock()
+	_, exists := bucket.objects["autoassigner/s3-group/state.json"]
+	bucket.set("autoassigner/s3-group/assignments.log", nil)
+	delete(bucket.objects, "autoassigner/s3-group/assignments.log")
+	bucket.mu.Unlock()
+	if exists {
+		t.Error("removed state.json is still in the bucket")
+	}
+	if err := PullState(ctx); err != nil {
+		t.Fatalf("PullState() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.Settings.Storage.DataDir, "s3-group", "assignments.log")); !os.IsNotExist(err) {
+		t.Errorf("assignments.log removed from the bucket still exists locally: %v", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	loc, _ := time.LoadLocation("Europe/Berlin")
+	now := time.Date(2024, 5, 22, 12, 0, 0, 0, loc) // Wednesday of the first turn
+	timeNow = func() time.Time { return now }
+
+	configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, carol]\ntimezone: Europe/Berlin\n" +
+		"rotation:\n  start: 2024-05-20 09:00\n  title: support engineer\n  remind_hours: 24\n"
+	if err := os.WriteFile(filepath.Join(testDir, "rotation-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, "plain-group.yaml"), []byte("strategy: round_robin\nusers: [alice]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := SchedulePause(context.Background(), "bob", time.Date(2024, 5, 25, 0, 0, 0, 0, loc), time.Date(2024, 6, 1, 0, 0, 0, 0, loc), ""); err != nil {
+		t.Fatalf("SchedulePause() error = %v", err)
+	}
+
+	turns, err := ProjectRotation("rotation-group", now, 5)
+	if err != nil {
+		t.Fatalf("ProjectRotation() error = %v", err)
+	}
+	var got []string
+	for _, turn := range turns {
+		got = append(got, fmt.Sprintf("%d %s %s %v", turn.Turn, turn.User, turn.Start.Format("2006-01-02 15:04"), turn.Skipped))
+	}
+	// bob is paused at the start of turn 1 and passes it on to carol
+	want := []string{
+		"0 alice 2024-05-20 09:00 []",
+		"1 carol 2024-05-27 09:00 [bob]",
+		"2 carol 2024-06-03 09:00 []",
+		"3 alice 2024-06-10 09:00 []",
+		"4 bob 2024-06-17 09:00 []",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ProjectRotation() = %q, want %q", got, want)
+	}
+	if turns, err := ProjectRotation("rotation-group", time.Date(2024, 5, 27, 9, 0, 0, 0, loc), 1); err != nil || turns[0].Turn != 1 || !turns[0].End.Equal(time.Date(2024, 6, 3, 9, 0, 0, 0, loc)) {
+		t.Errorf("ProjectRotation() at the start of turn 1 = %+v, %v, want turn 1", turns, err)
+	}
+	if _, err := ProjectRotation("plain-group", now, 1); !errors.Is(err, ErrConfig) {
+		t.Errorf("ProjectRotation() of a group without rotation = %v, want ErrConfig", err)
+	}
+	if msg := turns[1].Reminder(); msg != "carol, you're support engineer of rotation-group for the week starting Mon, May 27 09:00 CEST, in place of bob, who is paused" {
+		t.Errorf("Reminder() = %q", msg)
+	}
+
+	// Reminders are due within remind_hours of a turn, once
+	if due, err := DueReminders(now); err != nil || len(due) != 0 {
+		t.Errorf("DueReminders() three days before turn 1 = %+v, %v, want none", due, err)
+	}
+	now = time.Date(2024, 5, 26, 10, 0, 0, 0, loc)
+	due, err := DueReminders(now)
+	if err != nil || len(due) != 1 || due[0].User != "carol" || due[0].Turn != 1 {
+		t.Fatalf("DueReminders() a day before turn 1 = %+v, %v, want carol", due, err)
+	}
+	if err := MarkReminded(context.Background(), due[0]); err != nil {
+		t.Fatalf("MarkReminded() error = %v", err)
+	}
+	if due, err := DueReminders(now.Add(time.Hour)); err != nil || len(due) != 0 {
+		t.Errorf("DueReminders() after reminding = %+v, %v, want none", due, err)
+	}
+
+	if issues := (&AssigneeGroupConfig{Strategy: "round_robin", AvailabilityChecker: "always_available", Rotation: Rotation{Period: "month", Start: "2024-05-20"}}).issues(); len(issues) != 1 || !strings.Contains(issues[0], "rotation period") {
+		t.Errorf("issues() of an invalid rotation = %q, want the period", issues)
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	testDir := t.TempDir()
+	config.Settings.Storage.ConfDir = config.DirList{testDir}
+	config.Settings.Storage.DataDir = filepath.Join(testDir, "data")
+	defer func() { timeNow = time.Now }()
+	// Assignments are logged at the time of the clock
+	start := time.Now().Truncate(time.Second)
+	ctx := context.Background()
+
+	configData := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\ntrack_open: true\n" +
+		"escalation:\n  - after: 30m\n    contact: dave\n  - after: 1h\n    group: leads-group\n  - after: 2h\n    reassign: true\n"
+	if err := os.WriteFile(filepath.Join(testDir, "escalation-group.yaml"), []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, "leads-group.yaml"), []byte("strategy: round_robin\navailability_checker: always_available\nusers: [erin]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	first, err := AssignUser(ctx, "escalation-group", AssignOptions{Silent: true})
+	if err != nil || first.User != "alice" {
+		t.Fatalf("AssignUser() = %+v, %v, want alice", first, err)
+	}
+	acked, err := AssignUser(ctx, "escalation-group", AssignOptions{Silent: true})
+	if err != nil {
+		t.Fatalf("AssignUser() error = %v", err)
+	}
+	if _, err := AcknowledgeAssignment(context.Background(), "escalation-group", acked.ID); err != nil {
+		t.Fatalf("AcknowledgeAssignment() error = %v", err)
+	}
+
+	var sent []string
+	fail := false
+	send := func(e Escalation) error {
+		if fail {
+			return fmt.Errorf("notifier down")
+		}
+		sent = append(sent, e.Message())
+		return nil
+	}
+	escalate := func(after time.Duration) []Escalation {
+		t.Helper()
+		timeNow = func() time.Time { return start.Add(after) }
+		taken, err := Escalate(ctx, start.Add(after), send)
+		if err != nil && !fail {
+			t.Fatalf("Escalate() after %s error = %v", after, err)
+		}
+		return taken
+	}
+
+	if taken := escalate(10 * time.Minute); len(taken) != 0 {
+		t.Errorf("Escalate() after 10m = %+v, want nothing", taken)
+	}
+	fail = true
+	if taken := escalate(45 * time.Minute); len(taken) != 0 {
+		t.Errorf("Escalate() with a failing notifier = %+v, want nothing", taken)
+	}
+	fail = false
+	taken := escalate(45 * time.Minute)
+	if len(taken) != 1 || taken[0].Contact != "dave" || taken[0].ID != first.ID {
+		t.Fatalf("Escalate() after 45m = %+v, want alice's assignment escalated to dave", taken)
+	}
+	if taken := escalate(50 * time.Minute); len(taken) != 0 {
+		t.Errorf("Escalate() again = %+v, want nothing", taken)
+	}
+
+	// Both remaining steps are due: erin of leads-group is notified, then
+	// the assignment goes to bob
+	taken = escalate(3 * time.Hour)
+	if len(taken) != 2 || taken[0].Contact != "erin" || taken[0].Target != "leads-group" || taken[1].Reassigned != "bob" {
+		t.Fatalf("Escalate() after 3h = %+v, want erin notified and bob assigned", taken)
+	}
+	want := []string{
+		"Assignment " + first.ID + " of escalation-group to alice wasn't acknowledged within 30m, escalating to dave",
+		"Assignment " + first.ID + " of escalation-group to alice wasn't acknowledged within 1h, escalating to erin of leads-group",
+		"Assignment " + first.ID + " of escalation-group to alice wasn't acknowledged within 2h, reassigned to bob",
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent = %q, want %q", sent, want)
+	}
+	ledger, err := OpenAssignments("escalation-group")
+	if err != nil {
+		t.Fatalf("OpenAssignments() error = %v", err)
+	}
+	var users []string
+	for _, open := range ledger {
+		users = append(users, open.User)
+		if open.ID == first.ID {
+			t.Errorf("OpenAssignments() = %+v, want the reassigned assignment dropped", ledger)
+		}
+	}
+	if !reflect.DeepEqual(users, []string{"bob", "bob"}) {
+		t.Errorf("open assignments of %q, want the acknowledged one and the reassigned one of bob", users)
+	}
+
+	if err := (&AssigneeGroupConfig{Escalation: []EscalationStep{{After: "1h", Contact: "dave"}}}).validateEscalation(); err == nil {
+		t.Errorf("validateEscalation() without track_open succeeded, want error")
+	}
+	if err := (&AssigneeGroupConfig{TrackOpen: true, Escalation: []EscalationStep{{After: "1h", Contact: "dave"}, {After: "30m", Reassign: true}}}).validateEscalation(); err == nil {
+		t.Errorf("validateEscalation() with steps out of order succeeded, want error")
+	}
+}
@@ -0,0 +1,411 @@
+package runner
+
+import (
+	"autoassigner/aws"
+	"autoassigner/config"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3StorageManager decorates a StorageManager so that the data directory of
+// a group is pushed to the bucket of storage.s3 when a transaction commits.
+// The files are written with a condition on the version last pulled, so an
+// assignment racing one of another host fails with a StateConflictError
+// instead of overwriting it.
+type S3StorageManager struct {
+	StorageManager
+}
+
+// BeginTransaction begins a transaction of the decorated storage whose
+// Commit first pushes the group's files.
+func (m *S3StorageManager) BeginTransaction(ctx context.Context, group string) (StateTransaction, error) {
+	tx, err := m.StorageManager.BeginTransaction(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Transaction{StateTransaction: tx, ctx: ctx, group: group}, nil
+}
+
+// CheckWritable checks the decorated storage and writes and deletes a probe
+// object next to the files of the group in the bucket.
+func (m *S3StorageManager) CheckWritable(ctx context.Context, group string) error {
+	if err := checkWritable(ctx, m.StorageManager, group); err != nil {
+		return err
+	}
+	client, err := newS3Client(config.Settings.Storage.S3)
+	if err != nil {
+		return err
+	}
+	name := group + "/.preflight-" + newAssignmentID()
+	if _, err := client.put(ctx, name, []byte("preflight"), ""); err != nil {
+		return fmt.Errorf("failed to write to S3: %w", err)
+	}
+	if err := client.delete(ctx, name); err != nil {
+		return fmt.Errorf("failed to delete from S3: %w", err)
+	}
+	return nil
+}
+
+// s3Transaction pushes the files of a group before the wrapped transaction
+// commits, and rolls it back when they can't be pushed.
+type s3Transaction struct {
+	StateTransaction
+	ctx   context.Context
+	group string
+}
+
+func (tx *s3Transaction) Commit() error {
+	if err := pushState(tx.ctx, tx.group); err != nil {
+		if rbErr := tx.StateTransaction.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return tx.StateTransaction.Commit()
+}
+
+// s3Mirror remembers every mirrored file as last pulled or pushed, so only
+// changed files are transferred and writes are conditional on the version
+// they replace.
+var s3Mirror = struct {
+	sync.Mutex
+	files map[string]s3File // By path relative to the data directory
+}{files: map[string]s3File{}}
+
+// s3File is a version of a mirrored file.
+type s3File struct {
+	etag string   // ETag of the object
+	sum  [16]byte // MD5 of the contents; ETags of encrypted objects are not
+}
+
+// PullState updates the data directory with the files changed in the
+// bucket of storage.s3 since they were last pulled or pushed, and removes
+// the files removed from it. It does nothing unless storage.s3 is
+// configured.
+func PullState(ctx context.Context) error {
+	conf := config.Settings.Storage.S3
+	if conf.Bucket == "" {
+		return nil
+	}
+	client, err := newS3Client(conf)
+	if err != nil {
+		return err
+	}
+	objects, err := client.list(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list state in S3: %w", err)
+	}
+
+	s3Mirror.Lock()
+	defer s3Mirror.Unlock()
+	dataDir := config.Settings.Storage.DataDir
+	for name, etag := range objects {
+		if s3Mirror.files[name].etag == etag || !filepath.IsLocal(filepath.FromSlash(name)) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") || strings.Contains(name, "/.") {
+			// Archives are written to the bucket but not mirrored
+			continue
+		}
+		data, etag, err := client.get(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to pull %s from S3: %w", name, err)
+		}
+		file := filepath.Join(dataDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(file, data); err != nil {
+			return err
+		}
+		s3Mirror.files[name] = s3File{etag: etag, sum: md5.Sum(data)}
+	}
+	for name := range s3Mirror.files {
+		if _, ok := objects[name]; !ok {
+			os.Remove(filepath.Join(dataDir, filepath.FromSlash(name)))
+			delete(s3Mirror.files, name)
+		}
+	}
+	return nil
+}
+
+// pushState writes the files of dir, relative to the data directory, that
+// changed since they were last pulled or pushed to the bucket of
+// storage.s3, and removes the files removed from dir. The whole data
+// directory is pushed when dir is empty. It does nothing unless storage.s3
+// is configured.
+func pushState(ctx context.Context, dir string) error {
+	conf := config.Settings.Storage.S3
+	if conf.Bucket == "" {
+		return nil
+	}
+	client, err := newS3Client(conf)
+	if err != nil {
+		return err
+	}
+
+	s3Mirror.Lock()
+	defer s3Mirror.Unlock()
+	dataDir := config.Settings.Storage.DataDir
+	local := map[string]bool{}
+	err = filepath.WalkDir(filepath.Join(dataDir, dir), func(file string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Skip git metadata, temporary files and caches, like the state repository does
+		if strings.HasPrefix(d.Name(), ".") && file != filepath.Join(dataDir, dir) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || isCacheFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dataDir, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		local[name] = true
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(data)
+		previous, ok := s3Mirror.files[name]
+		if ok && previous.sum == sum {
+			return nil
+		}
+		etag, err := client.put(ctx, name, data, previous.etag)
+		if errors.Is(err, errS3Conflict) {
+			return &StateConflictError{Group: strings.SplitN(name, "/", 2)[0]}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to push %s to S3: %w", name, err)
+		}
+		s3Mirror.files[name] = s3File{etag: etag, sum: sum}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if dir != "" {
+		prefix = filepath.ToSlash(dir) + "/"
+	}
+	for name := range s3Mirror.files {
+		if strings.HasPrefix(name, prefix) && !local[name] {
+			if err := client.delete(ctx, name); err != nil {
+				return fmt.Errorf("failed to remove %s from S3: %w", name, err)
+			}
+			delete(s3Mirror.files, name)
+		}
+	}
+	return nil
+}
+
+// archiveObject writes a file of the archive of the data directory, such as
+// pruned history, to the bucket of storage.s3, where it outlives hosts
+// without a persistent disk. Hidden files aren't mirrored, so it is never
+// pulled or removed again. It does nothing unless storage.s3 is configured.
+func archiveObject(ctx context.Context, name string, data []byte) error {
+	conf := config.Settings.Storage.S3
+	if conf.Bucket == "" {
+		return nil
+	}
+	client, err := newS3Client(conf)
+	if err != nil {
+		return err
+	}
+	if _, err := client.put(ctx, name, data, ""); err != nil {
+		return fmt.Errorf("failed to archive %s to S3: %w", name, err)
+	}
+	return nil
+}
+
+// isCacheFile reports whether a file of the data directory is a cache,
+// which isn't mirrored.
+func isCacheFile(name string) bool {
+	matched, _ := path.Match("hr-cache-*.json", name)
+	return matched
+}
+
+// errS3Conflict is returned by s3Client.put when the object changed since
+// the version the write is conditional on.
+var errS3Conflict = errors.New("object was changed by another writer")
+
+// s3Client sends the requests of the S3 mirror.
+type s3Client struct {
+	creds   aws.Credentials
+	region  string
+	baseURL string // URL of the bucket
+	prefix  string
+}
+
+func newS3Client(conf config.S3Config) (*s3Client, error) {
+	creds, err := aws.CredentialsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	c := &s3Client{creds: creds, region: aws.Region(conf.Region), prefix: strings.Trim(conf.Prefix, "/")}
+	if c.region == "" {
+		return nil, fmt.Errorf("no aws region configured for storage.s3")
+	}
+	if c.prefix == "" {
+		c.prefix = "autoassigner"
+	}
+	if conf.Endpoint != "" {
+		c.baseURL = strings.TrimSuffix(conf.Endpoint, "/") + "/" + conf.Bucket
+	} else {
+		c.baseURL = "https://" + conf.Bucket + ".s3." + c.region + ".amazonaws.com"
+	}
+	return c, nil
+}
+
+// list returns the ETags of the mirrored files by name.
+func (c *s3Client) list(ctx context.Context) (map[string]string, error) {
+	objects := map[string]string{}
+	query := url.Values{"list-type": {"2"}, "prefix": {c.prefix + "/"}}
+	for {
+		resp, err := c.do(ctx, http.MethodGet, "/?"+query.Encode(), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				ETag string `xml:"ETag"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid listing: %w", err)
+		}
+		for _, object := range result.Contents {
+			objects[strings.TrimPrefix(object.Key, c.prefix+"/")] = object.ETag
+		}
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// get returns the contents and ETag of a file.
+func (c *s3Client) get(ctx context.Context, name string) ([]byte, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.key(name), nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.Header.Get("ETag"), err
+}
+
+// put writes a file unless the object changed since the version of etag,
+// or exists when etag is empty, and returns the ETag of the new version.
+func (c *s3Client) put(ctx context.Context, name string, data []byte, etag string) (string, error) {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	} else {
+		header.Set("If-None-Match", "*")
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.key(name), data, header)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (c *s3Client) delete(ctx context.Context, name string) error {
+	resp, err := c.do(ctx, http.MethodDelete, c.key(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// key returns the path of the object of a file within the bucket.
+func (c *s3Client) key(name string) string {
+	return "/" + (&url.URL{Path: c.prefix + "/" + name}).EscapedPath()
+}
+
+// do sends a signed request for path, relative to the bucket, and returns
+// the response when it succeeded.
+func (c *s3Client) do(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	aws.SignRequest(req, body, c.creds, c.region, "s3", time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	// Concurrent conditional writes may also fail with 409 ConditionalRequestConflict
+	if resp.StatusCode == http.StatusPreconditionFailed || (resp.StatusCode == http.StatusConflict && method == http.MethodPut) {
+		return nil, errS3Conflict
+	}
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096)); xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+		return nil, fmt.Errorf("S3 responded with %s: %s: %s", resp.Status, s3Err.Code, s3Err.Message)
+	}
+	return nil, fmt.Errorf("S3 responded with %s", resp.Status)
+}
+
+// cancelOnClose cancels the context of a response when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// logPushFailure logs a failed push of a change made outside of a
+// transaction, which already happened locally.
+func logPushFailure(err error) {
+	if err != nil {
+		log.Printf("Warning: failed to push state to S3: %v", err)
+	}
+}
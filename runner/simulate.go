@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"autoassigner/selector"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// SimulateOptions controls a call to Simulate.
+type SimulateOptions struct {
+	Runs         int                // Number of assignments to simulate
+	ConfigPath   string             // Group config file to simulate instead of the group's own
+	Availability map[string]float64 // Probability of each user being available; users not listed are always available
+	Priority     string             // Priority every simulated assignment is made with
+	Seed         *int64             // Seed for the strategy and the availability draws, making runs reproducible
+}
+
+// SimulationResult is the distribution produced by Simulate.
+type SimulationResult struct {
+	Users       []string       // Users of the simulated group in config order
+	Runs        int            // Number of simulated assignments
+	Assignments map[string]int // Assignments per user
+	Skips       map[string]int // Times each user was skipped as unavailable
+	Unassigned  int            // Runs in which nobody was available
+}
+
+// Simulate runs many assignments of a group in memory and reports how they
+// would be distributed, so strategy changes can be evaluated before they
+// are rolled out. The simulation starts from empty counts and never touches
+// the stored state.
+func Simulate(ctx context.Context, group string, opts SimulateOptions) (*SimulationResult, error) {
+	if opts.Runs <= 0 {
+		return nil, fmt.Errorf("number of runs must be positive")
+	}
+
+	groupConf, err := simulatedGroupConfig(group, opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(groupConf.Users) == 0 {
+		return nil, &ConfigError{Group: group, Err: fmt.Errorf("no users found")}
+	}
+	rt, err := routeAssignment(groupConf, opts.Priority)
+	if errors.Is(err, ErrInvalidOption) {
+		return nil, err
+	} else if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	for user, p := range opts.Availability {
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("availability of %s must be between 0 and 1", user)
+		}
+	}
+
+	strategyOpts := groupConf.StrategyOptions
+	if opts.Seed != nil {
+		strategyOpts.Seed = opts.Seed
+	}
+	strategy, err := (&ComponentFactory{}).CreateAssignmentStrategy(rt.strategy, strategyOpts)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	// Runs stand in for the times of the last assignments
+	last := map[string]time.Time{}
+	setLastAssigned(strategy, last)
+	var debt *selector.SkipDebt
+	if strategyOpts.SkipDebt {
+		debt = &selector.SkipDebt{Inner: strategy, Debts: map[string]int{}}
+		strategy = debt
+	}
+
+	seed := time.Now().UnixNano()
+	if opts.Seed != nil {
+		seed = *opts.Seed
+	}
+	draw := rand.New(rand.NewSource(seed))
+	available := func(user string) (bool, error) {
+		p, ok := opts.Availability[user]
+		return !ok || draw.Float64() < p, nil
+	}
+
+	result := &SimulationResult{
+		Users:       groupConf.Users,
+		Runs:        opts.Runs,
+		Assignments: make(map[string]int, len(groupConf.Users)),
+		Skips:       make(map[string]int, len(groupConf.Users)),
+	}
+	for _, user := range groupConf.Users {
+		result.Assignments[user] = 0
+		result.Skips[user] = 0
+	}
+
+	users := rt.users
+	lastIndex := -1
+	for run := 0; run < opts.Runs; run++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		selected, err := strategy.SelectNext(ctx, users, rt.localIndex(lastIndex), result.Assignments)
+		if err != nil {
+			return nil, &SelectionError{Group: group, Err: err}
+		}
+		index, skipped, _ := findAvailable(users, selected, available)
+		for _, user := range skipped {
+			result.Skips[user]++
+		}
+		if index < 0 {
+			result.Unassigned++
+			continue
+		}
+
+		user := users[index]
+		if oot, ok := strategy.(OutOfTurnStrategy); !ok || !oot.OutOfTurn(users, index) {
+			lastIndex = rt.groupIndex[index]
+		}
+		result.Assignments[user]++
+		last[user] = time.Unix(int64(run), 0)
+		if debt != nil {
+			debt.Debts = settleDebts(debt.Debts, skipped, user)
+		}
+	}
+	return result, nil
+}
+
+// simulatedGroupConfig returns the config of a group, or the config at path when set.
+func simulatedGroupConfig(group, path string) (*AssigneeGroupConfig, error) {
+	if path == "" {
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil {
+			return nil, &InvalidGroupError{Group: group}
+		}
+		return groupConf, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: fmt.Errorf("failed to read config override: %w", err)}
+	}
+	groupConf, err := parseAssigneeGroupConfig(data)
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	return groupConf, nil
+}
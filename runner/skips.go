@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Reasons recorded in skips.log.
+const (
+	skipUnavailable = "unavailable"               // The checker reported the user unavailable
+	skipCheckFailed = "availability check failed" // The check failed and the group assumes unavailable
+	skipNever       = "never available"           // The user is listed in never_available
+	skipDayLimit    = "daily limit reached"       // The user received max_per_day assignments today
+	skipWeekLimit   = "weekly limit reached"      // The user received max_per_week assignments this week
+	skipCooldown    = "cooling down"              // The user was assigned less than their cooldown ago
+	skipPaused      = "paused"                    // The user is paused with "autoassigner pause"
+	skipFairness    = "above fair share"          // Assigning the user would exceed fairness.max_above_mean
+)
+
+// skipRecords describes users passed over as unavailable by the checker of
+// a group while making the assignment with the given ID. Users also in
+// failed were skipped because their availability check failed, and users
+// in limited because a filter rejected them for the reason given.
+func skipRecords(group string, conf *AssigneeGroupConfig, assignmentID string, users, failed []string, limited map[string]string) []history.SkipRecord {
+	now := time.Now().Format(time.RFC3339)
+	records := make([]history.SkipRecord, 0, len(users))
+	for _, user := range users {
+		reason := skipUnavailable
+		for _, f := range failed {
+			if f == user {
+				reason = skipCheckFailed
+			}
+		}
+		if available, ok := conf.availabilityOverride(user); ok && !available {
+			reason = skipNever
+		}
+		if r, ok := limited[user]; ok {
+			reason = r
+		}
+		records = append(records, history.SkipRecord{
+			Timestamp:    now,
+			Group:        group,
+			User:         user,
+			Reason:       reason,
+			Checker:      conf.AvailabilityChecker,
+			AssignmentID: assignmentID,
+		})
+	}
+	return records
+}
+
+// logSkips appends records to the group's skips.log.
+func logSkips(group string, records []history.SkipRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(groupDir, "skips.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open skip log: %w", err)
+	}
+	defer f.Close()
+
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal skip record: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write skip log: %w", err)
+	}
+	return nil
+}
+
+// ReadSkips returns the skip history of a group, oldest first.
+func ReadSkips(group string) ([]history.SkipRecord, error) {
+	if _, err := loadAssigneeGroupConfig(group); err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	records, err := history.ReadSkipFile(filepath.Join(groupDir, "skips.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read skip log: %w", err)
+	}
+	return records, nil
+}
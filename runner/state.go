@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// GroupState is a snapshot of the state of a group, as shown by
+// "autoassigner status" and served at GET /state.
+type GroupState struct {
+	Group          string            `json:"group"`
+	Strategy       string            `json:"strategy,omitempty"`        // Strategy of the group
+	Users          []string          `json:"users,omitempty"`           // Members in config order
+	Disabled       bool              `json:"disabled,omitempty"`        // Whether the config sets enabled: false
+	LastIndex      int               `json:"last_index"`                // Position of the last assignee, the cursor of the rotation; -1 before the first assignment
+	LastAssignment *AssignmentLog    `json:"last_assignment,omitempty"` // Most recent assignment, nil before the first
+	Counts         map[string]int    `json:"counts,omitempty"`          // Lifetime assignment count per member
+	Paused         []string          `json:"paused,omitempty"`          // Members taken out of the rotation with never_available
+	PausedUntil    map[string]string `json:"paused_until,omitempty"`    // Members paused with "autoassigner pause", with the end of their pause; scheduled pauses are left out until they start
+	Reserved       []string          `json:"reserved,omitempty"`        // Members held by active reservations
+	LockBackend    string            `json:"lock_backend,omitempty"`    // Configured lock backend, empty when locking is disabled
+	Locked         bool              `json:"locked"`                    // Whether the lock of the group is held
+	LockHolder     string            `json:"lock_holder,omitempty"`     // Host and process ID holding the lock
+	LockExpiresMs  int64             `json:"lock_expires_ms,omitempty"` // Milliseconds until a held lock expires
+	Error          string            `json:"error,omitempty"`           // Why the state couldn't be read; the other fields may be incomplete
+}
+
+// GetGroupState returns a snapshot of the state of a group.
+func GetGroupState(ctx context.Context, group string) (*GroupState, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+
+	factory := newStateFactory()
+	state := &GroupState{
+		Group:    group,
+		Strategy: string(groupConf.Strategy),
+		Users:    groupConf.Users,
+		Disabled: groupConf.disabled(),
+		Paused:   groupConf.NeverAvailable,
+	}
+	if state.LastIndex, err = factory.GetStorageManager().ReadLastIndex(ctx, group); err != nil {
+		return nil, fmt.Errorf("failed to read last index: %w", err)
+	}
+	counts, err := factory.GetCountManager().GetCounts(ctx, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get counts: %w", err)
+	}
+	groupConf.mergeAliasCounts(counts)
+	state.Counts = make(map[string]int, len(groupConf.Users))
+	for _, user := range groupConf.Users {
+		state.Counts[user] = counts[user]
+	}
+	if state.LastAssignment, err = lastAssignment(group); err != nil {
+		return nil, err
+	}
+
+	pauses, err := ListPauses()
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow()
+	for _, p := range pauses {
+		if !p.Started(now) {
+			continue
+		}
+		for _, user := range groupConf.Users {
+			if user == p.User {
+				if state.PausedUntil == nil {
+					state.PausedUntil = map[string]string{}
+				}
+				state.PausedUntil[user] = p.Until
+			}
+		}
+	}
+
+	reservations, err := readReservations(group)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reservations {
+		if r.User != "" && !r.expired(now) {
+			state.Reserved = append(state.Reserved, r.User)
+		}
+	}
+
+	lock, err := GetLockStatus(ctx, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lock status: %w", err)
+	}
+	state.LockBackend = lock.Backend
+	state.Locked = lock.Held
+	state.LockHolder = lock.Holder
+	state.LockExpiresMs = lock.ExpiresIn.Milliseconds()
+	return state, nil
+}
+
+// GetState returns a snapshot of every group, sorted by name. Groups whose
+// state can't be read are included with the error, so one broken group
+// doesn't hide the others; only cancellation of ctx fails the snapshot.
+func GetState(ctx context.Context) ([]GroupState, error) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	sort.Strings(groups)
+
+	states := make([]GroupState, 0, len(groups))
+	for _, group := range groups {
+		state, err := GetGroupState(ctx, group)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			state = &GroupState{Group: group, LastIndex: -1, Error: err.Error()}
+		}
+		states = append(states, *state)
+	}
+	return states, nil
+}
+
+// lastAssignment returns the most recent record of a group's assignment
+// log, or nil when it is empty.
+func lastAssignment(group string) (*AssignmentLog, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	line, err := readLastLine(filepath.Join(groupDir, "assignments.log"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read last assignment: %w", err)
+	}
+	if line == "" {
+		return nil, nil
+	}
+	var entry AssignmentLog
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse last assignment: %w", err)
+	}
+	return &entry, nil
+}
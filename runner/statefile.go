@@ -0,0 +1,270 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stateLayoutVersion is the version of the on-disk layout of the rotation
+// state of a group written by this version. Version 1 kept the last index in
+// index.log and the counts in counts.json; version 2 keeps both in
+// state.json, so they are always replaced together.
+const stateLayoutVersion = 2
+
+// stateFileName is the file of a group's data directory holding its
+// rotation state in layout version 2.
+const stateFileName = "state.json"
+
+// legacyStateFiles are the files of layout version 1. They are still read
+// for groups without a state.json, and removed once it was written.
+var legacyStateFiles = []string{"index.log", "counts.json"}
+
+// storedState is the content of state.json:
+//
+//	{"version": 2, "cursor": {"index": 1, "updated": "2024-05-15T10:00:00Z"}, "counts": {"base": {}, "days": {"2024-05-15": {"bob": 1}}}}
+type storedState struct {
+	Version int           `json:"version"`
+	Cursor  *stateCursor  `json:"cursor,omitempty"` // nil before the first assignment
+	Counts  *countBuckets `json:"counts"`
+	Reset   *stateReset   `json:"reset,omitempty"` // nil unless the counts were reset
+	legacy  bool          // Read from the files of layout version 1
+}
+
+// stateReset records when the counts of a group were last reset, and how
+// many assignments of each user its log and pruned records held then, so
+// fsck compares the counts with the assignments logged since.
+type stateReset struct {
+	At     time.Time      `json:"at"`
+	Logged map[string]int `json:"logged"`
+}
+
+// renameUser moves the logged assignments of a user to a new name and
+// reports whether there were any.
+func (r *stateReset) renameUser(oldName, newName string) bool {
+	count, ok := r.Logged[oldName]
+	if !ok {
+		return false
+	}
+	r.Logged[newName] += count
+	delete(r.Logged, oldName)
+	return true
+}
+
+// stateCursor is the rotation position of a group.
+type stateCursor struct {
+	Index   int       `json:"index"`          // Index of the last assignee in the user list
+	User    string    `json:"user,omitempty"` // User the position was set at with SetCursor, until the next assignment
+	Updated time.Time `json:"updated"`
+}
+
+// newStoredState returns the state of a group before its first assignment.
+func newStoredState() *storedState {
+	return &storedState{Version: stateLayoutVersion, Counts: newCountBuckets()}
+}
+
+// readStoredState reads the rotation state of a group from state.json, or
+// from the files of layout version 1 when the group wasn't migrated yet. A
+// group without any of them has the empty state.
+func readStoredState(group string) (*storedState, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(groupDir, stateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return readLegacyState(groupDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := newStoredState()
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Version > stateLayoutVersion {
+		return nil, fmt.Errorf("unsupported state version %d", s.Version)
+	}
+	if s.Counts == nil {
+		s.Counts = newCountBuckets()
+	}
+	if s.Counts.Base == nil {
+		s.Counts.Base = map[string]int{}
+	}
+	if s.Counts.Days == nil {
+		s.Counts.Days = map[string]map[string]int{}
+	}
+	return s, nil
+}
+
+// readLegacyState reads the state of a group in layout version 1. Counts
+// that don't parse are an error; an unreadable index reads as no assignment,
+// as it always did.
+func readLegacyState(groupDir string) (*storedState, error) {
+	s := newStoredState()
+	data, err := os.ReadFile(filepath.Join(groupDir, "counts.json"))
+	if err == nil {
+		s.legacy = true
+		if s.Counts, err = parseCountBuckets(data); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	line, err := readLastLine(filepath.Join(groupDir, "index.log"))
+	if err == nil {
+		s.legacy = true
+	}
+	if index, user, ok := parseIndexLine(line); err == nil && ok {
+		s.Cursor = &stateCursor{Index: index, User: user}
+		if i := strings.Index(line, "--"); i > 0 {
+			s.Cursor.Updated, _ = time.Parse(time.RFC3339, strings.TrimSpace(line[:i]))
+		}
+	}
+	return s, nil
+}
+
+// parseIndexLine parses a line of index.log, "<time> -- <index>" or
+// "<time> -- <index> -- <user>" for a position set with SetCursor.
+func parseIndexLine(line string) (int, string, bool) {
+	parts := strings.SplitN(line, "--", 3)
+	if len(parts) < 2 {
+		return 0, "", false
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, "", false
+	}
+	if len(parts) == 3 {
+		return index, strings.TrimSpace(parts[2]), true
+	}
+	return index, "", true
+}
+
+// writeStoredState replaces the rotation state of a group with s, in the
+// current layout. The files of layout version 1 are removed only after
+// state.json was written, so a failure leaves the old state readable.
+func writeStoredState(group string, s *storedState) error {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	s.Version = stateLayoutVersion
+	s.Counts.Version = 0 // Versioned by the state
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(groupDir, stateFileName), data); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	for _, name := range legacyStateFiles {
+		if err := os.Remove(filepath.Join(groupDir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	s.legacy = false
+	return nil
+}
+
+// readCursor reads the rotation position of a group: the last index, -1
+// before the first assignment or when the state can't be read, and for a
+// position set with SetCursor, the user it was set at.
+func readCursor(group string) (int, string) {
+	s, err := readStoredState(group)
+	if err != nil || s.Cursor == nil {
+		return -1, ""
+	}
+	return s.Cursor.Index, s.Cursor.User
+}
+
+// writeCursor stores the rotation position of a group, naming the user it
+// was set at when user is not empty.
+func writeCursor(group string, index int, user string) error {
+	s, err := readStoredState(group)
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	s.Cursor = &stateCursor{Index: index, User: user, Updated: timeNow().UTC()}
+	if err := writeStoredState(group, s); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// writeResetCounts replaces the counts of a group with counts and records
+// logged as the assignments of each user in the log at the reset.
+func writeResetCounts(group string, counts, logged map[string]int) error {
+	s, err := readStoredState(group)
+	if err != nil {
+		// An unreadable file is replaced entirely
+		s = newStoredState()
+	}
+	s.Counts.setTotals(counts)
+	s.Reset = &stateReset{At: timeNow().UTC(), Logged: logged}
+	if err := writeStoredState(group, s); err != nil {
+		return fmt.Errorf("failed to write counts: %w", err)
+	}
+	return nil
+}
+
+// FindLegacyState returns the groups whose rotation state is still stored
+// in layout version 1, in the order of ListGroups.
+func FindLegacyState() ([]string, error) {
+	groups, err := config.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	var legacy []string
+	for _, group := range groups {
+		s, err := readStoredState(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state of group %s: %w", group, err)
+		}
+		if s.legacy {
+			legacy = append(legacy, group)
+		}
+	}
+	return legacy, nil
+}
+
+// MigrateState rewrites the rotation state of a group stored in layout
+// version 1 in the current layout. Groups are migrated by their next
+// change of state anyway; this migrates them ahead of it, e.g. before the
+// compatibility reader is dropped. It reports whether there was anything to
+// migrate.
+func MigrateState(ctx context.Context, group string) (bool, error) {
+	release, err := lockGroup(ctx, group)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+
+	s, err := readStoredState(group)
+	if err != nil {
+		return false, fmt.Errorf("failed to read state: %w", err)
+	}
+	if !s.legacy {
+		return false, nil
+	}
+	if err := writeStoredState(group, s); err != nil {
+		return false, err
+	}
+	recordStateChange(fmt.Sprintf("Migrate state of %s to layout version %d", group, stateLayoutVersion))
+	return true, nil
+}
@@ -0,0 +1,267 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// UserStats summarizes the assignment history of one user of a group.
+type UserStats struct {
+	User        string
+	Assignments int    // Assignment count, as shown by GetCounts
+	Today       int    // Assignments today
+	Week        int    // Assignments in the current week, starting Monday
+	Month       int    // Assignments in the current month
+	Skips       int    // Times the user was skipped as unavailable
+	LastSkipped string // Time of the most recent skip, empty if never skipped
+	Declines    int    // Declines in the current decline budget period
+	Open        int    // Open assignments, for groups with track_open
+	OldestOpen  string // Time of the oldest open assignment, empty without open assignments
+
+	MedianAck   time.Duration // Median time to acknowledge an assignment; 0 without acknowledgements
+	MedianClose time.Duration // Median time to close an assignment; 0 without closed assignments
+}
+
+// GetStats returns per-user statistics for a group in config order.
+func GetStats(ctx context.Context, group string) ([]UserStats, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+
+	skips, err := ReadSkips(group)
+	if err != nil {
+		return nil, err
+	}
+	declines, err := GetDeclineStatus(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	durations, err := readDurations(group)
+	if err != nil {
+		return nil, err
+	}
+	open, oldest, err := OpenWork(group)
+	if err != nil {
+		return nil, err
+	}
+	counts := readCounts(group)
+	buckets, err := readCountBuckets(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read counts: %w", err)
+	}
+	loc, err := groupConf.location()
+	if err != nil {
+		return nil, &ConfigError{Group: group, Err: err}
+	}
+	periods := make(map[string]map[string]int, 3)
+	for _, period := range []string{PeriodDay, PeriodWeek, PeriodMonth} {
+		start, err := periodStart(period, timeNow().In(loc))
+		if err != nil {
+			return nil, err
+		}
+		periods[period] = buckets.since(start)
+		groupConf.mergeAliasCounts(periods[period])
+	}
+
+	byUser := make(map[string]*UserStats, len(groupConf.Users))
+	stats := make([]UserStats, len(groupConf.Users))
+	for i, user := range groupConf.Users {
+		stats[i] = UserStats{
+			User:        user,
+			Assignments: counts[user],
+			Today:       periods[PeriodDay][user],
+			Week:        periods[PeriodWeek][user],
+			Month:       periods[PeriodMonth][user],
+			Declines:    declines.Used[user],
+			Open:        open[user],
+		}
+		if t, ok := oldest[user]; ok {
+			stats[i].OldestOpen = t.Format(time.RFC3339)
+		}
+		byUser[user] = &stats[i]
+	}
+	for _, skip := range skips {
+		if s, ok := byUser[groupConf.canonicalUser(skip.User)]; ok {
+			s.Skips++
+			s.LastSkipped = skip.Timestamp
+		}
+	}
+	ack, closed := durationsByUser(groupConf, durations, time.Time{})
+	for i := range stats {
+		stats[i].MedianAck = secondsDuration(medianSeconds(ack[stats[i].User]))
+		stats[i].MedianClose = secondsDuration(medianSeconds(closed[stats[i].User]))
+	}
+	return stats, nil
+}
+
+// WindowStats summarizes the assignments of a group within a time window,
+// as served by GET /groups/{group}/stats for dashboards.
+type WindowStats struct {
+	Group              string            `json:"group"`
+	Window             string            `json:"window"`                         // Window as requested, e.g. 30d
+	Since              string            `json:"since"`                          // Start of the window in RFC 3339 format
+	Assignments        int               `json:"assignments"`                    // Assignments in the window
+	Skips              int               `json:"skips"`                          // Skips in the window
+	Declines           int               `json:"declines"`                       // Declines in the window
+	P95LatencyMs       int64             `json:"p95_latency_ms"`                 // 95th percentile of the time the assignments spent checking availability
+	MedianAckSeconds   float64           `json:"median_ack_seconds,omitempty"`   // Median time to acknowledge of the assignments acknowledged in the window
+	MedianCloseSeconds float64           `json:"median_close_seconds,omitempty"` // Median time to close of the assignments closed in the window
+	Open               int               `json:"open,omitempty"`                 // Open assignments of groups with track_open, whenever they were made
+	Users              []WindowUserStats `json:"users"`                          // Users of the group in config order, followed by former users assigned in the window
+}
+
+// WindowUserStats summarizes the assignments of one user within a time window.
+type WindowUserStats struct {
+	User        string  `json:"user"`
+	Assignments int     `json:"assignments"`
+	Share       float64 `json:"share"` // Fraction of the assignments of the window, from 0 to 1
+	Skips       int     `json:"skips"`
+	Declines    int     `json:"declines"`
+
+	MedianAckSeconds     float64 `json:"median_ack_seconds,omitempty"`      // Median time to acknowledge of the user's assignments acknowledged in the window
+	MedianCloseSeconds   float64 `json:"median_close_seconds,omitempty"`    // Median time to close of the user's assignments closed in the window
+	Open                 int     `json:"open,omitempty"`                    // Open assignments of the user
+	OldestOpenAgeSeconds float64 `json:"oldest_open_age_seconds,omitempty"` // Age of the user's oldest open assignment in seconds, omitted without open assignments
+}
+
+// GetWindowStats returns the assignments, skips and declines of a group
+// logged within window, e.g. 30d, aggregated per user.
+func GetWindowStats(ctx context.Context, group, window string) (*WindowStats, error) {
+	d, err := history.ParseWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		return nil, &InvalidGroupError{Group: group}
+	}
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+	records, err := history.ReadFile(filepath.Join(groupDir, "assignments.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assignment log: %w", err)
+	}
+	skips, err := ReadSkips(group)
+	if err != nil {
+		return nil, err
+	}
+	declines, err := readDeclines(group)
+	if err != nil {
+		return nil, err
+	}
+	durations, err := readDurations(group)
+	if err != nil {
+		return nil, err
+	}
+	open, oldest, err := OpenWork(group)
+	if err != nil {
+		return nil, err
+	}
+
+	since := timeNow().Add(-d)
+	stats := &WindowStats{Group: group, Window: window, Since: since.Format(time.RFC3339), Users: []WindowUserStats{}}
+	byUser := make(map[string]int, len(groupConf.Users))
+	user := func(name string) *WindowUserStats {
+		name = groupConf.canonicalUser(name)
+		i, ok := byUser[name]
+		if !ok {
+			i = len(stats.Users)
+			byUser[name] = i
+			stats.Users = append(stats.Users, WindowUserStats{User: name})
+		}
+		return &stats.Users[i]
+	}
+	for _, name := range groupConf.Users {
+		user(name)
+	}
+	inWindow := func(timestamp string) bool {
+		t, err := time.Parse(time.RFC3339, timestamp)
+		return err == nil && !t.Before(since)
+	}
+
+	// Multi-role assignments log one record per role, but were checked once
+	var latencies []int64
+	checked := make(map[string]bool)
+	for _, record := range records {
+		if !inWindow(record.Timestamp) {
+			continue
+		}
+		user(record.User).Assignments++
+		stats.Assignments++
+		if record.ID == "" || !checked[record.ID] {
+			checked[record.ID] = true
+			latencies = append(latencies, record.AvailabilityCheckMs)
+		}
+	}
+	for _, skip := range skips {
+		if inWindow(skip.Timestamp) {
+			user(skip.User).Skips++
+			stats.Skips++
+		}
+	}
+	for _, decline := range declines {
+		if inWindow(decline.Timestamp) {
+			user(decline.User).Declines++
+			stats.Declines++
+		}
+	}
+	for name, n := range open {
+		user(name).Open += n
+		stats.Open += n
+	}
+	for name, t := range oldest {
+		if u := user(name); u.OldestOpenAgeSeconds < timeNow().Sub(t).Seconds() {
+			u.OldestOpenAgeSeconds = timeNow().Sub(t).Seconds()
+		}
+	}
+	ack, closed := durationsByUser(groupConf, durations, since)
+	var allAck, allClosed []float64
+	for i := range stats.Users {
+		if stats.Assignments > 0 {
+			stats.Users[i].Share = float64(stats.Users[i].Assignments) / float64(stats.Assignments)
+		}
+		stats.Users[i].MedianAckSeconds = medianSeconds(ack[stats.Users[i].User])
+		stats.Users[i].MedianCloseSeconds = medianSeconds(closed[stats.Users[i].User])
+		allAck = append(allAck, ack[stats.Users[i].User]...)
+		allClosed = append(allClosed, closed[stats.Users[i].User]...)
+	}
+	stats.MedianAckSeconds, stats.MedianCloseSeconds = medianSeconds(allAck), medianSeconds(allClosed)
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		// Nearest-rank percentile
+		stats.P95LatencyMs = latencies[(len(latencies)*95+99)/100-1]
+	}
+	return stats, nil
+}
+
+// durationsByUser returns the times to acknowledge and to close in seconds
+// of the records since the given time, keyed by the canonical user.
+func durationsByUser(groupConf *AssigneeGroupConfig, records []DurationRecord, since time.Time) (ack, closed map[string][]float64) {
+	ack, closed = make(map[string][]float64), make(map[string][]float64)
+	for _, record := range records {
+		if t, err := time.Parse(time.RFC3339, record.Timestamp); err != nil || t.Before(since) {
+			continue
+		}
+		user := groupConf.canonicalUser(record.User)
+		switch record.Event {
+		case EventAcknowledged:
+			ack[user] = append(ack[user], record.Seconds)
+		case EventClosed:
+			closed[user] = append(closed[user], record.Seconds)
+		}
+	}
+	return ack, closed
+}
+
+// secondsDuration converts seconds to a duration rounded to the second.
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second)
+}
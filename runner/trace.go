@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"autoassigner/selector"
+	"strconv"
+	"time"
+)
+
+// SelectionTrace explains how the selection pipeline chose the assignee of
+// an assignment, returned with AssignOptions.Explain: who the candidate
+// filters took out, how the strategy ranked the rest, and who the admission
+// filters skipped before the assignee was found.
+type SelectionTrace struct {
+	Strategy   string           `json:"strategy"`          // Strategy or chain of strategies of the assignment
+	Candidates []string         `json:"candidates"`        // Users of the route before any filter, in rotation order
+	Removed    []TraceRejection `json:"removed,omitempty"` // Users taken out by the candidate filters, so the strategy never saw them
+	Ranking    []TraceStep      `json:"ranking,omitempty"` // How each strategy ranked the candidates, in the order they were applied
+	Picked     string           `json:"picked,omitempty"`  // User the strategy picked
+	Skipped    []TraceRejection `json:"skipped,omitempty"` // Users rejected by the admission filters, in the order they were asked about
+	Selected   string           `json:"selected"`          // User assigned; empty when every candidate was rejected
+}
+
+// TraceRejection is a user a filter of the selection pipeline rejected.
+type TraceRejection struct {
+	User   string `json:"user"`
+	Filter string `json:"filter"` // Filter that rejected the user: exclude, eligible, pause, capacity, cooldown, fairness, availability, or the name a filter was registered with
+	Reason string `json:"reason"` // Reason the filter gave, as recorded in skips.log
+}
+
+// TraceStep is how one strategy ranked the candidates of an assignment.
+type TraceStep struct {
+	Strategy string            `json:"strategy"`
+	Scores   map[string]string `json:"scores,omitempty"` // What the strategy compared per candidate: counts, open assignments, last assignment times, or turns until the candidate's in rotation order; none for random
+	Kept     []string          `json:"kept"`             // Candidates the strategy ranked first; the next strategy of a chain chooses among them
+}
+
+// traceRanking describes how strategy, named name, ranked users before
+// picking users[picked]. A chain gives a step per strategy it applied, and
+// a skip debt repaid a step of its own.
+func traceRanking(strategy AssignmentStrategy, name string, users []string, lastIndex int, counts map[string]int, picked int) []TraceStep {
+	if debt, ok := strategy.(*selector.SkipDebt); ok {
+		if debt.OutOfTurn(users, picked) {
+			scores := map[string]string{}
+			for _, user := range users {
+				if owed := debt.Debts[user]; owed > 0 {
+					scores[user] = strconv.Itoa(owed)
+				}
+			}
+			return []TraceStep{{Strategy: "skip_debt", Scores: scores, Kept: []string{users[picked]}}}
+		}
+		strategy = debt.Inner
+	}
+	chain, ok := strategy.(*selector.Composite)
+	if !ok {
+		return []TraceStep{{Strategy: name, Scores: strategyScores(strategy, users, allIndexes(users), lastIndex, counts), Kept: []string{users[picked]}}}
+	}
+
+	var steps []TraceStep
+	names := strategyNames(name)
+	candidates := allIndexes(users)
+	for i, kept := range chain.Narrowed() {
+		step := TraceStep{Strategy: names[i], Scores: strategyScores(chain.Strategies[i], users, candidates, lastIndex, counts)}
+		for _, index := range kept {
+			step.Kept = append(step.Kept, users[index])
+		}
+		steps = append(steps, step)
+		candidates = kept
+	}
+	return steps
+}
+
+// strategyScores returns what strategy compares for each of the candidates,
+// indexes into users, or nil when it compares nothing.
+func strategyScores(strategy AssignmentStrategy, users []string, candidates []int, lastIndex int, counts map[string]int) map[string]string {
+	scores := make(map[string]string, len(candidates))
+	for _, i := range candidates {
+		user := users[i]
+		switch s := strategy.(type) {
+		case *selector.LeastAssigned:
+			scores[user] = strconv.Itoa(counts[user])
+		case *selector.OpenLoad:
+			scores[user] = strconv.Itoa(s.Open[user])
+		case *selector.LeastRecentlyAssigned:
+			scores[user] = "never"
+			if last, ok := s.Last[user]; ok {
+				scores[user] = last.Format(time.RFC3339)
+			}
+		case *selector.RoundRobin:
+			scores[user] = strconv.Itoa(((i-lastIndex-1)%len(users)+len(users))%len(users) + 1)
+		default:
+			return nil
+		}
+	}
+	return scores
+}
+
+// allIndexes returns the indexes of users.
+func allIndexes(users []string) []int {
+	indexes := make([]int, len(users))
+	for i := range users {
+		indexes[i] = i
+	}
+	return indexes
+}
@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateFiles lists the files of a group's data directory that an assignment mutates.
+// Append-only files are restored by truncating them to their original size,
+// so a rollback doesn't need to copy a long history. The files of state layout
+// version 1 are removed by the first assignment writing state.json, so they
+// are copied whole.
+var stateFiles = []struct {
+	name       string
+	appendOnly bool
+}{
+	{stateFileName, false},
+	{"index.log", false},
+	{"counts.json", false},
+	{"assignments.log", true},
+	{"open.json", false},
+	{"debts.json", false},
+	{"last_assigned.json", false},
+	{"skips.log", true},
+	{"reservations.json", false},
+}
+
+// fileSnapshot is the state of a file when a transaction began.
+type fileSnapshot struct {
+	path       string
+	exists     bool
+	appendOnly bool
+	size       int64
+	data       []byte
+}
+
+// fileTransaction implements StateTransaction for the filesystem storage by
+// snapshotting the state files and restoring them on rollback.
+type fileTransaction struct {
+	snapshots []fileSnapshot
+	done      bool
+}
+
+// beginFileTransaction snapshots the state files of a group.
+func beginFileTransaction(group string) (*fileTransaction, error) {
+	groupDir, err := config.GetGroupDataDir(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group data directory: %w", err)
+	}
+
+	tx := &fileTransaction{}
+	for _, file := range stateFiles {
+		snap := fileSnapshot{path: filepath.Join(groupDir, file.name), appendOnly: file.appendOnly}
+		info, err := os.Stat(snap.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", file.name, err)
+		}
+		if err == nil {
+			snap.exists = true
+			snap.size = info.Size()
+			if !file.appendOnly {
+				if snap.data, err = os.ReadFile(snap.path); err != nil {
+					return nil, fmt.Errorf("failed to snapshot %s: %w", file.name, err)
+				}
+			}
+		}
+		tx.snapshots = append(tx.snapshots, snap)
+	}
+	return tx, nil
+}
+
+func (tx *fileTransaction) Commit() error {
+	tx.done = true
+	return nil
+}
+
+// Rollback restores every state file to its snapshot. It is a no-op after Commit.
+func (tx *fileTransaction) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+
+	var firstErr error
+	for _, snap := range tx.snapshots {
+		var err error
+		switch {
+		case !snap.exists:
+			if rmErr := os.Remove(snap.path); rmErr != nil && !os.IsNotExist(rmErr) {
+				err = rmErr
+			}
+		case snap.appendOnly:
+			err = os.Truncate(snap.path, snap.size)
+		default:
+			err = writeFileAtomic(snap.path, snap.data)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to restore %s: %w", filepath.Base(snap.path), err)
+		}
+	}
+	return firstErr
+}
+
+// writeFileAtomic replaces a file by writing a temporary file and renaming it,
+// so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
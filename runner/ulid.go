@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet ULIDs are written in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidState keeps the last timestamp and random part handed out, so IDs
+// created within the same millisecond still sort in creation order.
+var ulidState struct {
+	sync.Mutex
+	ms      int64
+	entropy [10]byte
+}
+
+// newULID returns a ULID (https://github.com/ulid/spec) for time t: 26
+// characters encoding a millisecond timestamp and 80 random bits, which sort
+// lexically by time. IDs created within one millisecond, or while the clock
+// steps back, increment the random part of the previous ID instead.
+func newULID(t time.Time) string {
+	ms := t.UnixMilli()
+	ulidState.Lock()
+	if ms > ulidState.ms {
+		ulidState.ms = ms
+		if _, err := rand.Read(ulidState.entropy[:]); err != nil {
+			panic("failed to read random bytes: " + err.Error())
+		}
+	} else {
+		ms = ulidState.ms
+		for i := len(ulidState.entropy) - 1; i >= 0; i-- {
+			ulidState.entropy[i]++
+			if ulidState.entropy[i] != 0 {
+				break
+			}
+		}
+	}
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(id[6:], ulidState.entropy[:])
+	ulidState.Unlock()
+
+	n := new(big.Int).SetBytes(id[:])
+	mask := big.NewInt(31)
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 5)
+	}
+	return string(out[:])
+}
@@ -0,0 +1,187 @@
+package runner
+
+import (
+	"autoassigner/availability"
+	"autoassigner/config"
+	"autoassigner/identity"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ValidateGroup checks the config of a group and returns a description of
+// every problem found: a file that doesn't parse, an unknown strategy,
+// availability checker or on_availability_error policy, an invalid
+// availability_budget, negative limits, roles without members, invalid log
+// sinks, or always_available and never_available lists naming users outside
+// the group or each other's users.
+//
+// With checkUsers the availability backend is asked about every user, if its
+// checker can look users up, and users are looked up in the identity mapping,
+// if one is configured, so misspelled usernames are reported before they
+// make assignments fail.
+func ValidateGroup(ctx context.Context, group string, checkUsers bool) ([]string, error) {
+	groupConf, err := loadAssigneeGroupConfig(group)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &InvalidGroupError{Group: group}
+		}
+		return []string{err.Error()}, nil
+	}
+
+	issues := groupConf.issues()
+	if !checkUsers {
+		return issues, nil
+	}
+
+	// An unknown checker is reported by issues and leaves checker nil
+	checker, _ := newStateFactory().CreateAvailabilityChecker(groupConf.AvailabilityChecker)
+
+	if cached, ok := checker.(interface{ Unwrap() availability.Checker }); ok {
+		// Look users up in the backend rather than in the cache
+		checker = cached.Unwrap()
+	}
+	if validator, ok := checker.(availability.UserValidator); ok {
+		for _, user := range groupConf.Users {
+			if _, ok := groupConf.availabilityOverride(user); ok {
+				// The checker is never asked about them
+				continue
+			}
+			known, err := validator.KnowsUser(ctx, groupConf.availabilityID(user))
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				issues = append(issues, fmt.Sprintf("failed to look up %s with the %s availability checker: %v", user, groupConf.AvailabilityChecker, err))
+			} else if !known {
+				issues = append(issues, fmt.Sprintf("user %s is unknown to the %s availability checker", user, groupConf.AvailabilityChecker))
+			}
+		}
+	}
+
+	if conf := config.Settings.Identity; len(conf.Users) > 0 || conf.LookupURL != "" {
+		for _, user := range groupConf.Users {
+			ids, err := identity.All(ctx, user)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				issues = append(issues, fmt.Sprintf("failed to look up %s in the identity mapping: %v", user, err))
+			} else if len(ids) <= 1 {
+				// Only the username itself is known
+				issues = append(issues, fmt.Sprintf("user %s has no identities in the identity mapping", user))
+			}
+		}
+	}
+	return issues, nil
+}
+
+// issues describes the problems of a group config that are found without
+// asking external services, as reported by ValidateGroup.
+func (c *AssigneeGroupConfig) issues() []string {
+	var issues []string
+	factory := newStateFactory()
+	if _, err := factory.CreateAssignmentStrategy(string(c.Strategy), StrategyOptions{}); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if _, err := factory.CreateWorkloadProvider(c.StrategyOptions.Workload); err != nil {
+		issues = append(issues, err.Error())
+	} else if !c.TrackOpen && c.usesStrategy("open_load") && (c.StrategyOptions.Workload == "" || c.StrategyOptions.Workload == "open") {
+		issues = append(issues, "strategy open_load requires track_open")
+	}
+	if _, err := factory.CreateAvailabilityChecker(c.AvailabilityChecker); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if _, err := c.availabilityErrorPolicy(); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if _, err := c.availabilityBudget(); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if err := c.validateLimits(); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if _, err := c.location(); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if err := c.Fairness.validate(); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if _, err := c.historyRetention(); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if err := c.validateEscalation(); err != nil {
+		issues = append(issues, err.Error())
+	}
+	if c.Rotation.enabled() {
+		if _, _, err := c.Rotation.schedule(time.Local); err != nil {
+			issues = append(issues, err.Error())
+		}
+	} else if c.Rotation.Period != "" || c.Rotation.Title != "" || c.Rotation.RemindHours != 0 {
+		issues = append(issues, "rotation requires start")
+	}
+	roles := make([]string, 0, len(c.Roles))
+	for role := range c.Roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		if _, err := c.rolePool(role); err != nil {
+			issues = append(issues, err.Error())
+		}
+	}
+	for i, sink := range c.LogSinks {
+		if _, err := sink.validate(); err != nil {
+			issues = append(issues, fmt.Sprintf("log_sinks[%d]: %v", i, err))
+		}
+	}
+	for i, webhook := range c.Webhooks {
+		if _, err := webhook.validate(); err != nil {
+			issues = append(issues, fmt.Sprintf("webhooks[%d]: %v", i, err))
+		}
+	}
+	return append(issues, overrideIssues(c)...)
+}
+
+// usesStrategy reports whether the group or one of its priorities selects
+// assignees with the given strategy, alone or in a chain.
+func (c *AssigneeGroupConfig) usesStrategy(strategy string) bool {
+	if chainUses(string(c.Strategy), strategy) {
+		return true
+	}
+	for _, pr := range c.Priorities {
+		if chainUses(string(pr.Strategy), strategy) {
+			return true
+		}
+	}
+	return false
+}
+
+// overrideIssues describes the users of always_available and never_available
+// that aren't in the group or are in both lists.
+func overrideIssues(conf *AssigneeGroupConfig) []string {
+	members := make(map[string]bool, len(conf.Users))
+	for _, user := range conf.Users {
+		members[user] = true
+	}
+	never := make(map[string]bool, len(conf.NeverAvailable))
+	var issues []string
+	for _, user := range conf.NeverAvailable {
+		never[user] = true
+		if !members[user] {
+			issues = append(issues, fmt.Sprintf("never_available user %s is not in the group", user))
+		}
+	}
+	for _, user := range conf.AlwaysAvailable {
+		if !members[user] {
+			issues = append(issues, fmt.Sprintf("always_available user %s is not in the group", user))
+		}
+		if never[user] {
+			issues = append(issues, fmt.Sprintf("user %s is both always_available and never_available", user))
+		}
+	}
+	return issues
+}
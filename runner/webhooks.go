@@ -0,0 +1,218 @@
+package runner
+
+import (
+	"autoassigner/config"
+	"autoassigner/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Events sent to the webhooks of a group, the values of GroupEvent.Event.
+const (
+	EventAssigned       = "assigned"        // A user was assigned
+	EventFallback       = "fallback"        // A user was assigned after the users before them were skipped
+	EventNoAssignee     = "no_assignee"     // Every candidate was skipped, so nobody was assigned
+	EventReset          = "reset"           // The counts of the group were reset
+	EventPaused         = "paused"          // A member was paused
+	EventResumed        = "resumed"         // The pause of a member was ended
+	EventConfigReloaded = "config_reloaded" // A running server or bot loaded a changed config file of the group
+	EventEscalated      = "escalated"       // A step of the escalation chain was taken for an unacknowledged assignment
+)
+
+// webhookEvents lists every event a webhook can subscribe to.
+var webhookEvents = []string{EventAssigned, EventFallback, EventNoAssignee, EventReset, EventPaused, EventResumed, EventConfigReloaded, EventEscalated}
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// GroupWebhook is an endpoint told about the changes of a group's state,
+// such as a dashboard mirroring the rotation:
+//
+//	webhooks:
+//	  - url: https://dashboard.example.com/hooks/rotation
+//	    events: [reset, paused, resumed, fallback]
+//	    headers: {Authorization: "env:DASHBOARD_TOKEN"}
+type GroupWebhook struct {
+	URL     string            `yaml:"url" jsonschema:"required"` // Endpoint events are POSTed to as JSON
+	Events  []string          `yaml:"events"`                    // Events sent: assigned, fallback, no_assignee, reset, paused, resumed, config_reloaded and escalated; every event when empty
+	Headers map[string]string `yaml:"headers"`                   // Headers sent with every event; values may be secret references such as env:DASHBOARD_TOKEN
+	Timeout string            `yaml:"timeout"`                   // Time sending an event may take, e.g. 5s (default 10s)
+}
+
+// GroupEvent is the JSON document the webhooks of a group receive.
+type GroupEvent struct {
+	Event     string      `json:"event"`             // What happened, one of the Event constants
+	Group     string      `json:"group"`             // Group the event happened in
+	Timestamp string      `json:"timestamp"`         // Time of the event in RFC 3339 format
+	ID        string      `json:"id,omitempty"`      // ID of the assignment of assigned, fallback and escalated events
+	User      string      `json:"user,omitempty"`    // User assigned, paused or resumed, or who didn't acknowledge an escalated assignment
+	Role      string      `json:"role,omitempty"`    // Role the user was assigned for in a multi-role assignment
+	Reason    string      `json:"reason,omitempty"`  // Why the user was selected, e.g. "fallback after 2 skips"
+	Skipped   []string    `json:"skipped,omitempty"` // Users skipped by fallback and no_assignee events, in the order they were asked about
+	From      string      `json:"from,omitempty"`    // Start of a scheduled pause of paused events in RFC 3339 format; the pause started at once without it
+	Until     string      `json:"until,omitempty"`   // End of the pause of paused events in RFC 3339 format
+	Actor     string      `json:"actor,omitempty"`   // Who paused the user, when known
+	To        string      `json:"to,omitempty"`      // User an assignment was escalated or reassigned to
+	State     *GroupState `json:"state,omitempty"`   // State of the group after the event, as served at GET /state
+}
+
+// validate checks the settings of the webhook and returns its timeout.
+func (w GroupWebhook) validate() (time.Duration, error) {
+	if w.URL == "" {
+		return 0, fmt.Errorf("webhook needs url")
+	}
+	for _, event := range w.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return 0, fmt.Errorf("unknown webhook event %q, want one of %s", event, strings.Join(webhookEvents, ", "))
+		}
+	}
+	if w.Timeout == "" {
+		return defaultWebhookTimeout, nil
+	}
+	d, err := time.ParseDuration(w.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid webhook timeout: %s", w.Timeout)
+	}
+	return d, nil
+}
+
+// wants reports whether the webhook subscribed to event.
+func (w GroupWebhook) wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// send POSTs event to the webhook. An endpoint that answers with a status
+// other than 2xx fails, with the response body in the error.
+func (w GroupWebhook) send(ctx context.Context, event GroupEvent) error {
+	timeout, err := w.validate()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	headers, err := resolveHeaders(ctx, w.Headers)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return fmt.Errorf("unexpected status %s: %s", resp.Status, msg)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyGroup sends event to the webhooks of a group subscribed to it,
+// together with the state of the group. The event has already happened,
+// so webhooks that fail are logged as warnings rather than failing it.
+func notifyGroup(ctx context.Context, group string, webhooks []GroupWebhook, event GroupEvent) {
+	var subscribed []GroupWebhook
+	for _, w := range webhooks {
+		if w.wants(event.Event) {
+			subscribed = append(subscribed, w)
+		}
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+	event.Group = group
+	if event.Timestamp == "" {
+		event.Timestamp = timeNow().Format(time.RFC3339)
+	}
+	state, err := GetGroupState(ctx, group)
+	if err != nil {
+		tracing.Printf(ctx, "Warning: failed to read the state of %s for its webhooks: %v", group, err)
+	}
+	event.State = state
+	for _, w := range subscribed {
+		if err := w.send(ctx, event); err != nil {
+			tracing.Printf(ctx, "Warning: failed to send %s event of %s to webhook %s: %v", event.Event, group, w.URL, err)
+		}
+	}
+}
+
+// notifyAssignments sends the committed assignments of finishAssignment to
+// the webhooks of their group, as fallback events as well when users were
+// skipped before the assignee was found.
+func notifyAssignments(ctx context.Context, written []assignmentChanges) {
+	for _, changes := range written {
+		if len(changes.webhooks) == 0 {
+			continue
+		}
+		entry := changes.entry
+		event := GroupEvent{
+			Event:     EventAssigned,
+			ID:        entry.ID,
+			User:      entry.User,
+			Role:      entry.Role,
+			Timestamp: entry.Timestamp,
+			Reason:    entry.Metadata["reason"],
+		}
+		notifyGroup(ctx, entry.Group, changes.webhooks, event)
+		if len(changes.skips) > 0 {
+			event.Event = EventFallback
+			for _, skip := range changes.skips {
+				event.Skipped = append(event.Skipped, skip.User)
+			}
+			notifyGroup(ctx, entry.Group, changes.webhooks, event)
+		}
+	}
+}
+
+// notifyMember sends event about user to the webhooks of every group the
+// user is a member of, such as when they are paused in all of them.
+func notifyMember(ctx context.Context, user string, event GroupEvent) {
+	groups, err := MemberGroups(user)
+	if err != nil {
+		log.Printf("Warning: failed to list groups for their webhooks: %v", err)
+		return
+	}
+	for _, group := range groups {
+		groupConf, err := loadAssigneeGroupConfig(group)
+		if err != nil || len(groupConf.Webhooks) == 0 {
+			continue
+		}
+		event.User = groupConf.canonicalUser(user)
+		notifyGroup(ctx, group, groupConf.Webhooks, event)
+	}
+}
+
+// resolveHeaders returns headers with their secret references resolved;
+// group files are often kept in git.
+func resolveHeaders(ctx context.Context, headers map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(headers))
+	for name, value := range headers {
+		v, err := config.ResolveSecret(ctx, value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		resolved[name] = v
+	}
+	return resolved, nil
+}
@@ -0,0 +1,103 @@
+// Package schema generates JSON Schema documents from Go configuration structs.
+// Property names are taken from the json (or yaml) struct tags, and a
+// `jsonschema` tag can mark a field as required or restrict it to an enum:
+//
+//	Strategy string `yaml:"strategy" jsonschema:"required,enum=random|round_robin"`
+//
+// Types implementing Schemer describe themselves.
+package schema
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Draft is the JSON Schema dialect emitted by Generate.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Generate returns a JSON Schema describing the type of v.
+// The tag selects which struct tag ("json" or "yaml") provides property names.
+// Unknown properties are rejected so editors flag typos.
+func Generate(v interface{}, title, tag string) map[string]interface{} {
+	s := typeSchema(reflect.TypeOf(v), tag)
+	s["$schema"] = Draft
+	s["title"] = title
+	return s
+}
+
+// Schemer is implemented by types describing their own schema, such as
+// values accepting several JSON types.
+type Schemer interface {
+	JSONSchema() map[string]interface{}
+}
+
+var schemerType = reflect.TypeOf((*Schemer)(nil)).Elem()
+
+func typeSchema(t reflect.Type, tag string) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Implements(schemerType) {
+		return reflect.Zero(t).Interface().(Schemer).JSONSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), tag)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), tag)}
+	case reflect.Struct:
+		return structSchema(t, tag)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func structSchema(t reflect.Type, tag string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := typeSchema(field.Type, tag)
+		for _, opt := range strings.Split(field.Tag.Get("jsonschema"), ",") {
+			switch {
+			case opt == "required":
+				required = append(required, name)
+			case strings.HasPrefix(opt, "enum="):
+				prop["enum"] = strings.Split(strings.TrimPrefix(opt, "enum="), "|")
+			}
+		}
+		properties[name] = prop
+	}
+
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testGroup struct {
+	Strategy string            `yaml:"strategy" jsonschema:"required,enum=a|b"`
+	Users    []string          `yaml:"users"`
+	Weights  map[string]int    `yaml:"weights"`
+	Enabled  *bool             `yaml:"enabled"`
+	Ignored  string            `yaml:"-"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
+	internal string
+}
+
+func TestGenerate(t *testing.T) {
+	s := Generate(testGroup{}, "test", "yaml")
+
+	if s["$schema"] != Draft || s["title"] != "test" {
+		t.Errorf("Generate() header = %v, %v", s["$schema"], s["title"])
+	}
+	if s["additionalProperties"] != false {
+		t.Error("Generate() should reject unknown properties")
+	}
+	if !reflect.DeepEqual(s["required"], []string{"strategy"}) {
+		t.Errorf("Generate() required = %v, want [strategy]", s["required"])
+	}
+
+	props := s["properties"].(map[string]interface{})
+	if len(props) != 5 {
+		t.Errorf("Generate() has %d properties, want 5", len(props))
+	}
+
+	tests := []struct {
+		name string
+		want map[string]interface{}
+	}{
+		{"strategy", map[string]interface{}{"type": "string", "enum": []string{"a", "b"}}},
+		{"users", map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}},
+		{"weights", map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "integer"}}},
+		{"enabled", map[string]interface{}{"type": "boolean"}},
+		{"labels", map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(props[tt.name], tt.want) {
+				t.Errorf("property %s = %v, want %v", tt.name, props[tt.name], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Package selector provides different strategies for selecting team members for task assignment.
+package selector
+
+import (
+	"context"
+	"fmt"
+)
+
+// Composite implements the Selector interface by chaining strategies.
+// The first strategy narrows the team members to those it considers
+// equally good, each following strategy breaks the ties among them, and
+// the chain stops as soon as a single team member is left. When the last
+// strategy still leaves a tie, the first of the tied team members in list
+// order is selected. Every strategy of the chain must be a TieBreaker.
+type Composite struct {
+	Strategies []Selector // Strategies in the order they are applied
+
+	narrowed [][]int // Candidates each strategy kept in the last selection
+}
+
+// SelectNext narrows the team members with every strategy of the chain in
+// turn until one is left.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the selection
+//   - users: List of available team members
+//   - lastIndex: Index of the last assigned team member
+//   - counts: Map of assignment counts for each team member
+//
+// Returns:
+//   - int: Index of the selected team member
+//   - error: Any error that occurred during selection
+//
+// Example:
+//
+//	chain := &Composite{Strategies: []Selector{&LeastAssigned{}, &RoundRobin{}}}
+//	counts := map[string]int{"alice": 1, "bob": 2, "charlie": 1}
+//	index, err := chain.SelectNext(ctx, []string{"alice", "bob", "charlie"}, 0, counts)
+//	// index will be 2 (charlie): alice and charlie tie on counts, and charlie is next after alice
+func (c *Composite) SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error) {
+	if len(users) == 0 {
+		return -1, fmt.Errorf("empty users list")
+	}
+	candidates := make([]int, len(users))
+	for i := range users {
+		candidates[i] = i
+	}
+	best, err := c.Best(ctx, users, candidates, lastIndex, counts)
+	if err != nil {
+		return -1, err
+	}
+	return best[0], nil
+}
+
+// Best narrows the candidates with every strategy of the chain in turn
+// and returns those still tied after the last one, so chains can be nested.
+func (c *Composite) Best(ctx context.Context, users []string, candidates []int, lastIndex int, counts map[string]int) ([]int, error) {
+	if len(c.Strategies) == 0 {
+		return nil, fmt.Errorf("empty strategy chain")
+	}
+	c.narrowed = nil
+	for i, s := range c.Strategies {
+		tb, ok := s.(TieBreaker)
+		if !ok {
+			return nil, fmt.Errorf("strategy %d of the chain cannot break ties", i+1)
+		}
+		best, err := tb.Best(ctx, users, candidates, lastIndex, counts)
+		if err != nil {
+			return nil, err
+		}
+		if len(best) == 0 {
+			return nil, fmt.Errorf("strategy %d of the chain left no candidates", i+1)
+		}
+		candidates = best
+		c.narrowed = append(c.narrowed, best)
+		if len(candidates) == 1 {
+			break
+		}
+	}
+	return candidates, nil
+}
+
+// Decider returns the index in Strategies of the strategy that made the
+// last selection, or -1 when the team members were still tied after the
+// whole chain and the first of them was selected.
+func (c *Composite) Decider() int {
+	if n := len(c.narrowed); n > 0 && len(c.narrowed[n-1]) == 1 {
+		return n - 1
+	}
+	return -1
+}
+
+// Narrowed returns the candidates, as indexes into users, each strategy of
+// the chain kept in the last selection, up to the strategy that decided it.
+func (c *Composite) Narrowed() [][]int {
+	return c.narrowed
+}
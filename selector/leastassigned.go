@@ -2,6 +2,7 @@
 package selector
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -16,6 +17,7 @@ type LeastAssigned struct{}
 // the lowest assignment count.
 //
 // Parameters:
+//   - ctx: Context for cancellation of the selection
 //   - users: List of available team members
 //   - lastIndex: Index of the last assigned team member (not used in this strategy)
 //   - counts: Map of assignment counts for each team member
@@ -28,9 +30,9 @@ type LeastAssigned struct{}
 //
 //	users := []string{"alice", "bob", "charlie"}
 //	counts := map[string]int{"alice": 2, "bob": 1, "charlie": 3}
-//	index, err := leastAssigned.SelectNext(users, -1, counts)
+//	index, err := leastAssigned.SelectNext(ctx, users, -1, counts)
 //	// index will be 1 (bob) as they have the fewest assignments
-func (l *LeastAssigned) SelectNext(users []string, lastIndex int, counts map[string]int) (int, error) {
+func (l *LeastAssigned) SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error) {
 	if len(users) == 0 {
 		return -1, fmt.Errorf("empty users list")
 	}
@@ -44,3 +46,20 @@ func (l *LeastAssigned) SelectNext(users []string, lastIndex int, counts map[str
 	}
 	return index, nil
 }
+
+// Best returns the candidates with the lowest assignment count.
+func (l *LeastAssigned) Best(ctx context.Context, users []string, candidates []int, lastIndex int, counts map[string]int) ([]int, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("empty candidates list")
+	}
+	var best []int
+	for _, i := range candidates {
+		switch {
+		case len(best) == 0 || counts[users[i]] < counts[users[best[0]]]:
+			best = []int{i}
+		case counts[users[i]] == counts[users[best[0]]]:
+			best = append(best, i)
+		}
+	}
+	return best, nil
+}
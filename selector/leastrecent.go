@@ -0,0 +1,66 @@
+// Package selector provides different strategies for selecting team members for task assignment.
+package selector
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LeastRecentlyAssigned implements the Selector interface to choose the
+// team member who has waited longest since their last assignment. Team
+// members who were never assigned have waited longest of all. Ties are
+// broken by the order of the team members.
+type LeastRecentlyAssigned struct {
+	Last map[string]time.Time // Time each user was last assigned; missing for users never assigned
+}
+
+// SelectNext chooses the team member with the oldest last assignment.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the selection
+//   - users: List of available team members
+//   - lastIndex: Index of the last assigned team member (not used in this strategy)
+//   - counts: Map of assignment counts for each team member (not used in this strategy)
+//
+// Returns:
+//   - int: Index of the selected team member
+//   - error: Any error that occurred during selection
+//
+// Example:
+//
+//	lra := &LeastRecentlyAssigned{Last: map[string]time.Time{"alice": monday, "bob": sunday}}
+//	index, err := lra.SelectNext(ctx, []string{"alice", "bob", "charlie"}, -1, nil)
+//	// index will be 2 (charlie), who was never assigned
+func (l *LeastRecentlyAssigned) SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error) {
+	if len(users) == 0 {
+		return -1, fmt.Errorf("empty users list")
+	}
+	candidates := make([]int, len(users))
+	for i := range users {
+		candidates[i] = i
+	}
+	best, err := l.Best(ctx, users, candidates, lastIndex, counts)
+	if err != nil {
+		return -1, err
+	}
+	return best[0], nil
+}
+
+// Best returns the candidates with the oldest last assignment, which are
+// those never assigned when there are any.
+func (l *LeastRecentlyAssigned) Best(ctx context.Context, users []string, candidates []int, lastIndex int, counts map[string]int) ([]int, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("empty candidates list")
+	}
+	var best []int
+	for _, i := range candidates {
+		switch {
+		case len(best) == 0 || l.Last[users[i]].Before(l.Last[users[best[0]]]):
+			best = []int{i}
+		case l.Last[users[i]].Equal(l.Last[users[best[0]]]):
+			best = append(best, i)
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,67 @@
+// Package selector provides different strategies for selecting team members for task assignment.
+package selector
+
+import (
+	"context"
+	"fmt"
+)
+
+// OpenLoad implements the Selector interface to choose the team member
+// with the fewest open assignments, the work they have yet to close,
+// rather than the most assignments over time. Ties are broken like
+// LeastAssigned, by the number of previous assignments.
+type OpenLoad struct {
+	Open map[string]int // Open assignments per user, from the ledger of open assignments
+}
+
+// SelectNext chooses the team member with the fewest open assignments,
+// and among them the one with the lowest assignment count.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the selection
+//   - users: List of available team members
+//   - lastIndex: Index of the last assigned team member (not used in this strategy)
+//   - counts: Map of assignment counts for each team member
+//
+// Returns:
+//   - int: Index of the selected team member
+//   - error: Any error that occurred during selection
+//
+// Example:
+//
+//	load := &OpenLoad{Open: map[string]int{"alice": 2, "bob": 0, "charlie": 0}}
+//	counts := map[string]int{"alice": 1, "bob": 5, "charlie": 3}
+//	index, err := load.SelectNext(ctx, []string{"alice", "bob", "charlie"}, -1, counts)
+//	// index will be 2 (charlie), who has nothing open and fewer assignments than bob
+func (o *OpenLoad) SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error) {
+	if len(users) == 0 {
+		return -1, fmt.Errorf("empty users list")
+	}
+	index := 0
+	for i, u := range users {
+		best := users[index]
+		if o.Open[u] < o.Open[best] || (o.Open[u] == o.Open[best] && counts[u] < counts[best]) {
+			index = i
+		}
+	}
+	return index, nil
+}
+
+// Best returns the candidates with the fewest open assignments. Unlike
+// SelectNext it leaves ties to the next strategy of the chain rather than
+// breaking them by assignment count.
+func (o *OpenLoad) Best(ctx context.Context, users []string, candidates []int, lastIndex int, counts map[string]int) ([]int, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("empty candidates list")
+	}
+	var best []int
+	for _, i := range candidates {
+		switch {
+		case len(best) == 0 || o.Open[users[i]] < o.Open[users[best[0]]]:
+			best = []int{i}
+		case o.Open[users[i]] == o.Open[users[best[0]]]:
+			best = append(best, i)
+		}
+	}
+	return best, nil
+}
@@ -1,15 +1,40 @@
 package selector
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 )
 
-type Random struct{}
+// Random selects team members uniformly at random.
+// If Rand is nil the global math/rand source is used; set it (or use
+// NewRandom) to make selections reproducible.
+type Random struct {
+	Rand *rand.Rand
+}
+
+// NewRandom returns a Random strategy drawing from a source seeded with seed.
+func NewRandom(seed int64) *Random {
+	return &Random{Rand: rand.New(rand.NewSource(seed))}
+}
 
-func (r *Random) SelectNext(users []string, lastIndex int, counts map[string]int) (int, error) {
+func (r *Random) SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error) {
 	if len(users) == 0 {
 		return -1, fmt.Errorf("empty users list")
 	}
+	if r.Rand != nil {
+		return r.Rand.Intn(len(users)), nil
+	}
 	return rand.Intn(len(users)), nil
 }
+
+// Best returns one of the candidates picked at random, which never ties.
+func (r *Random) Best(ctx context.Context, users []string, candidates []int, lastIndex int, counts map[string]int) ([]int, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("empty candidates list")
+	}
+	if r.Rand != nil {
+		return []int{candidates[r.Rand.Intn(len(candidates))]}, nil
+	}
+	return []int{candidates[rand.Intn(len(candidates))]}, nil
+}
@@ -2,6 +2,7 @@
 package selector
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -15,6 +16,7 @@ type RoundRobin struct{}
 // lastIndex to determine the next member in the sequence.
 //
 // Parameters:
+//   - ctx: Context for cancellation of the selection
 //   - users: List of available team members
 //   - lastIndex: Index of the last assigned team member
 //   - counts: Map of assignment counts for each team member (not used in this strategy)
@@ -27,11 +29,30 @@ type RoundRobin struct{}
 //
 //	users := []string{"alice", "bob", "charlie"}
 //	lastIndex := 1
-//	index, err := roundRobin.SelectNext(users, lastIndex, nil)
+//	index, err := roundRobin.SelectNext(ctx, users, lastIndex, nil)
 //	// index will be 2 (charlie) as it's the next in the sequence
-func (r *RoundRobin) SelectNext(users []string, lastIndex int, counts map[string]int) (int, error) {
+func (r *RoundRobin) SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error) {
 	if len(users) == 0 {
 		return -1, fmt.Errorf("empty users list")
 	}
 	return (lastIndex + 1) % len(users), nil
 }
+
+// Best returns the first candidate after lastIndex in rotation order, which
+// never ties.
+func (r *RoundRobin) Best(ctx context.Context, users []string, candidates []int, lastIndex int, counts map[string]int) ([]int, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("empty candidates list")
+	}
+	in := make(map[int]bool, len(candidates))
+	for _, i := range candidates {
+		in[i] = true
+	}
+	for i := 1; i <= len(users); i++ {
+		index := ((lastIndex+i)%len(users) + len(users)) % len(users)
+		if in[index] {
+			return []int{index}, nil
+		}
+	}
+	return nil, fmt.Errorf("candidates out of range")
+}
@@ -3,18 +3,40 @@
 // - Round Robin: Cycles through team members in order
 // - Random: Randomly selects a team member
 // - Least Assigned: Selects the team member with the fewest assignments
+// - Least Recently Assigned: Selects the team member who waited longest since their last assignment
+// - Composite: Chains strategies, each breaking the ties of the ones before it
 package selector
 
+import "context"
+
 // Selector defines the interface for different selection strategies.
 // Each strategy must implement the SelectNext method to determine the next assignee.
 type Selector interface {
 	// SelectNext chooses the next team member to assign a task to.
 	// Parameters:
+	//   - ctx: Context for cancellation of the selection
 	//   - users: List of available team members
 	//   - lastIndex: Index of the last assigned team member
 	//   - counts: Map of assignment counts for each team member
 	// Returns:
 	//   - int: Index of the selected team member
 	//   - error: Any error that occurred during selection
-	SelectNext(users []string, lastIndex int, counts map[string]int) (int, error)
+	SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error)
+}
+
+// TieBreaker is implemented by strategies that can be chained in a Composite.
+// Rather than a single team member, it returns every candidate the strategy
+// considers equally good.
+type TieBreaker interface {
+	// Best narrows the candidates to those the strategy ranks first.
+	// Parameters:
+	//   - ctx: Context for cancellation of the selection
+	//   - users: List of available team members
+	//   - candidates: Indexes into users still in the running, in ascending order
+	//   - lastIndex: Index of the last assigned team member
+	//   - counts: Map of assignment counts for each team member
+	// Returns:
+	//   - []int: The best candidates, a non-empty subset of candidates in the same order
+	//   - error: Any error that occurred during selection
+	Best(ctx context.Context, users []string, candidates []int, lastIndex int, counts map[string]int) ([]int, error)
 }
@@ -1,7 +1,10 @@
 package selector
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 )
 
 func TestRoundRobin(t *testing.T) {
@@ -32,7 +35,7 @@ func TestRoundRobin(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := rr.SelectNext(users, tt.lastIndex, nil)
+			got, err := rr.SelectNext(context.Background(), users, tt.lastIndex, nil)
 			if err != nil {
 				t.Errorf("RoundRobin.SelectNext() error = %v", err)
 				return
@@ -51,7 +54,7 @@ func TestRandom(t *testing.T) {
 	// Test multiple selections to ensure we get different indices
 	seen := make(map[int]bool)
 	for i := 0; i < 100; i++ {
-		got, err := r.SelectNext(users, -1, nil)
+		got, err := r.SelectNext(context.Background(), users, -1, nil)
 		if err != nil {
 			t.Errorf("Random.SelectNext() error = %v", err)
 			return
@@ -97,7 +100,7 @@ func TestLeastAssigned(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := la.SelectNext(users, -1, tt.counts)
+			got, err := la.SelectNext(context.Background(), users, -1, tt.counts)
 			if err != nil {
 				t.Errorf("LeastAssigned.SelectNext() error = %v", err)
 				return
@@ -117,22 +120,168 @@ func TestSelectorEdgeCases(t *testing.T) {
 		{"RoundRobin", &RoundRobin{}},
 		{"Random", &Random{}},
 		{"LeastAssigned", &LeastAssigned{}},
+		{"OpenLoad", &OpenLoad{}},
 	}
 
 	for _, s := range selectors {
 		t.Run(s.name, func(t *testing.T) {
 			// Test empty users list
-			_, err := s.selector.SelectNext([]string{}, -1, nil)
+			_, err := s.selector.SelectNext(context.Background(), []string{}, -1, nil)
 			if err == nil {
 				t.Errorf("%s.SelectNext() with empty users list should return error", s.name)
 			}
 
 			// Test nil counts map
 			users := []string{"alice", "bob", "charlie"}
-			_, err = s.selector.SelectNext(users, -1, nil)
+			_, err = s.selector.SelectNext(context.Background(), users, -1, nil)
 			if err != nil {
 				t.Errorf("%s.SelectNext() with nil counts should not return error", s.name)
 			}
 		})
 	}
 }
+
+func TestRandomSeeded(t *testing.T) {
+	users := []string{"alice", "bob", "charlie", "dan", "eve"}
+	a, b := NewRandom(42), NewRandom(42)
+
+	for i := 0; i < 20; i++ {
+		got, err := a.SelectNext(context.Background(), users, -1, nil)
+		if err != nil {
+			t.Fatalf("Random.SelectNext() error = %v", err)
+		}
+		want, _ := b.SelectNext(context.Background(), users, -1, nil)
+		if got != want {
+			t.Fatalf("selection %d: seeded Random.SelectNext() = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func BenchmarkLeastAssignedLargeGroup(b *testing.B) {
+	users := make([]string, 1000)
+	counts := make(map[string]int, len(users))
+	for i := range users {
+		users[i] = fmt.Sprintf("user%d", i)
+		counts[users[i]] = 1000 - i
+	}
+	la := &LeastAssigned{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := la.SelectNext(context.Background(), users, -1, counts); err != nil {
+			b.Fatalf("LeastAssigned.SelectNext() error = %v", err)
+		}
+	}
+}
+
+func TestSkipDebt(t *testing.T) {
+	users := []string{"alice", "bob", "charlie"}
+	tests := []struct {
+		name      string
+		debts     map[string]int
+		lastIndex int
+		want      int
+		outOfTurn bool
+	}{
+		{"no debts uses inner strategy", nil, 0, 1, false},
+		{"debtor after last index", map[string]int{"alice": 1}, 1, 0, true},
+		{"first debtor in rotation order", map[string]int{"alice": 1, "charlie": 1}, 0, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SkipDebt{Inner: &RoundRobin{}, Debts: tt.debts}
+			got, err := s.SelectNext(context.Background(), users, tt.lastIndex, nil)
+			if err != nil || got != tt.want {
+				t.Fatalf("SelectNext() = %d, %v, want %d", got, err, tt.want)
+			}
+			if oot := s.OutOfTurn(users, got); oot != tt.outOfTurn {
+				t.Errorf("OutOfTurn() = %v, want %v", oot, tt.outOfTurn)
+			}
+		})
+	}
+}
+
+func TestOpenLoad(t *testing.T) {
+	users := []string{"alice", "bob", "charlie"}
+	tests := []struct {
+		name   string
+		open   map[string]int
+		counts map[string]int
+		want   int
+	}{
+		{"nothing open falls back to least assigned", nil, map[string]int{"alice": 2, "bob": 1, "charlie": 2}, 1},
+		{"fewest open despite more assignments", map[string]int{"alice": 1, "bob": 2}, map[string]int{"alice": 0, "bob": 0, "charlie": 9}, 2},
+		{"tie broken by assignments", map[string]int{"alice": 0, "bob": 1, "charlie": 0}, map[string]int{"alice": 3, "bob": 0, "charlie": 1}, 2},
+		{"full tie keeps config order", map[string]int{"alice": 1, "bob": 1, "charlie": 1}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&OpenLoad{Open: tt.open}).SelectNext(context.Background(), users, -1, tt.counts)
+			if err != nil || got != tt.want {
+				t.Errorf("OpenLoad.SelectNext() = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeastRecentlyAssigned(t *testing.T) {
+	users := []string{"alice", "bob", "charlie"}
+	monday := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		last map[string]time.Time
+		want int
+	}{
+		{"never assigned first", map[string]time.Time{"alice": monday, "bob": monday.Add(-time.Hour)}, 2},
+		{"oldest assignment", map[string]time.Time{"alice": monday, "bob": monday.Add(-time.Hour), "charlie": monday.Add(time.Hour)}, 1},
+		{"tie keeps config order", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&LeastRecentlyAssigned{Last: tt.last}).SelectNext(context.Background(), users, -1, nil)
+			if err != nil || got != tt.want {
+				t.Errorf("LeastRecentlyAssigned.SelectNext() = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestComposite(t *testing.T) {
+	users := []string{"alice", "bob", "charlie", "dave"}
+	monday := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	last := map[string]time.Time{"alice": monday, "bob": monday, "charlie": monday.Add(-time.Hour), "dave": monday}
+	tests := []struct {
+		name       string
+		strategies []Selector
+		lastIndex  int
+		counts     map[string]int
+		want       int
+		decider    int
+	}{
+		{"first strategy decides", []Selector{&LeastAssigned{}, &RoundRobin{}}, -1, map[string]int{"alice": 2, "bob": 1, "charlie": 2, "dave": 2}, 1, 0},
+		{"tie broken by next strategy", []Selector{&LeastAssigned{}, &RoundRobin{}}, 1, map[string]int{"alice": 1, "bob": 2, "charlie": 2, "dave": 1}, 3, 1},
+		{"tie broken by third strategy", []Selector{&LeastAssigned{}, &LeastRecentlyAssigned{Last: last}, &RoundRobin{}}, 2, map[string]int{"alice": 1, "bob": 1, "charlie": 2, "dave": 1}, 3, 2},
+		{"least recently assigned decides", []Selector{&LeastAssigned{}, &LeastRecentlyAssigned{Last: last}, &RoundRobin{}}, 0, map[string]int{"alice": 1, "bob": 1, "charlie": 1, "dave": 1}, 2, 1},
+		{"tie after the chain keeps config order", []Selector{&LeastAssigned{}, &OpenLoad{}}, 0, nil, 0, -1},
+		{"nested chain", []Selector{&Composite{Strategies: []Selector{&LeastAssigned{}}}, &RoundRobin{}}, 0, map[string]int{"alice": 1, "bob": 2, "charlie": 1, "dave": 2}, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Composite{Strategies: tt.strategies}
+			got, err := c.SelectNext(context.Background(), users, tt.lastIndex, tt.counts)
+			if err != nil || got != tt.want {
+				t.Fatalf("Composite.SelectNext() = %d, %v, want %d", got, err, tt.want)
+			}
+			if d := c.Decider(); d != tt.decider {
+				t.Errorf("Decider() = %d, want %d", d, tt.decider)
+			}
+		})
+	}
+
+	if _, err := (&Composite{}).SelectNext(context.Background(), users, -1, nil); err == nil {
+		t.Error("empty chain: expected error")
+	}
+	if _, err := (&Composite{Strategies: []Selector{&SkipDebt{Inner: &RoundRobin{}}}}).SelectNext(context.Background(), users, -1, nil); err == nil {
+		t.Error("strategy without Best: expected error")
+	}
+}
@@ -0,0 +1,53 @@
+// Package selector provides different strategies for selecting team members for task assignment.
+package selector
+
+import (
+	"context"
+	"fmt"
+)
+
+// SkipDebt wraps another Selector to repay users who lost their turn because
+// they were unavailable. Every skip adds to a user's debt, and users with
+// debt are selected ahead of the wrapped strategy until it is paid off.
+type SkipDebt struct {
+	Inner Selector       // Strategy used when nobody is owed a turn
+	Debts map[string]int // Turns owed per user, built from the skip history
+}
+
+// SelectNext chooses the first indebted team member after lastIndex,
+// in rotation order, or defers to the wrapped strategy when nobody
+// has debt.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the selection
+//   - users: List of available team members
+//   - lastIndex: Index of the last assigned team member
+//   - counts: Map of assignment counts for each team member
+//
+// Returns:
+//   - int: Index of the selected team member
+//   - error: Any error that occurred during selection
+//
+// Example:
+//
+//	debt := &SkipDebt{Inner: &RoundRobin{}, Debts: map[string]int{"alice": 1}}
+//	index, err := debt.SelectNext(ctx, []string{"alice", "bob", "charlie"}, 1, nil)
+//	// index will be 0 (alice), who was skipped earlier
+func (s *SkipDebt) SelectNext(ctx context.Context, users []string, lastIndex int, counts map[string]int) (int, error) {
+	if len(users) == 0 {
+		return -1, fmt.Errorf("empty users list")
+	}
+	for i := 1; i <= len(users); i++ {
+		index := ((lastIndex+i)%len(users) + len(users)) % len(users)
+		if s.Debts[users[index]] > 0 {
+			return index, nil
+		}
+	}
+	return s.Inner.SelectNext(ctx, users, lastIndex, counts)
+}
+
+// OutOfTurn reports whether assigning users[index] repays a debt.
+// Such assignments don't advance the rotation of the wrapped strategy.
+func (s *SkipDebt) OutOfTurn(users []string, index int) bool {
+	return s.Debts[users[index]] > 0
+}
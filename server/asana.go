@@ -0,0 +1,89 @@
+package server
+
+import (
+	"autoassigner/asana"
+	"autoassigner/config"
+	"autoassigner/tracing"
+	"net/http"
+	"sync"
+)
+
+// asanaHandshake holds the secret of the last webhook handshake, used to
+// verify events when asana.webhook_secret is not configured.
+var asanaHandshake struct {
+	sync.Mutex
+	secret string
+}
+
+// handleAsana assigns tasks added to projects watched by Asana webhooks.
+// Tasks that are already assigned or whose project is not mapped are
+// ignored. Asana sends several events at once; the response describes the
+// last task assigned.
+func handleAsana(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readPayload(w, r)
+	if !ok {
+		return
+	}
+	// Creating a webhook sends a handshake whose secret is echoed back
+	if secret := r.Header.Get("X-Hook-Secret"); secret != "" {
+		asanaHandshake.Lock()
+		asanaHandshake.secret = secret
+		asanaHandshake.Unlock()
+		w.Header().Set("X-Hook-Secret", secret)
+		respond(w, http.StatusOK, Response{Status: StatusIgnored})
+		return
+	}
+	secret := config.Settings.Asana.WebhookSecret
+	if secret == "" {
+		asanaHandshake.Lock()
+		secret = asanaHandshake.secret
+		asanaHandshake.Unlock()
+	}
+	if secret != "" && !asana.VerifySignature(secret, payload, r.Header.Get("X-Hook-Signature")) {
+		respond(w, http.StatusUnauthorized, Response{Status: StatusError, Error: "invalid signature"})
+		return
+	}
+	added, err := asana.AddedTasks(payload)
+	if err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+
+	resp, status := Response{Status: StatusIgnored}, http.StatusOK
+	for _, event := range added {
+		group := r.URL.Query().Get("group")
+		if group == "" {
+			if group, ok = config.Settings.Asana.Projects[event[1]]; !ok {
+				continue
+			}
+		}
+		// Events are retried as a whole, so tasks assigned by an earlier delivery are skipped
+		task, err := asana.GetTask(r.Context(), event[0])
+		if err != nil {
+			tracing.Printf(r.Context(), "%v", err)
+			respond(w, http.StatusBadGateway, Response{Status: StatusError, Group: group, Error: err.Error()})
+			return
+		}
+		if task.AssigneeGID != "" {
+			continue
+		}
+
+		resp, status = assignFrom(r.Context(), group, task, requestOptions(r))
+		if resp.Status == StatusError {
+			respond(w, status, resp)
+			return
+		}
+		if resp.Status != StatusAssigned {
+			continue
+		}
+		if resp.Login, err = asana.Assignee(r.Context(), resp.Assignee); err != nil {
+			writeBackFailed(w, task, resp, err)
+			return
+		}
+		if err := asana.Assign(r.Context(), *task, resp.Login); err != nil {
+			writeBackFailed(w, task, resp, err)
+			return
+		}
+	}
+	respond(w, status, resp)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"autoassigner/runner"
+	"autoassigner/tracing"
+	"net/http"
+)
+
+// Statuses reported in Response.Status by the routes of open assignments.
+const (
+	StatusAcknowledged = "acknowledged"
+	StatusClosed       = "closed"
+)
+
+// handleOpenAssignment acknowledges or closes an open assignment of a group
+// with track_open, like "autoassigner ack" and "autoassigner close":
+//
+//	POST /groups/{group}/assignments/{id}/ack
+//	POST /groups/{group}/assignments/{id}/close
+//
+// The response names the first user of the assignment. Acknowledging it
+// again keeps the original acknowledgement; closing it again answers 404.
+func handleOpenAssignment(w http.ResponseWriter, r *http.Request, group, id, action string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Group: group, Error: "method not allowed"})
+		return
+	}
+	if err := authorizeGroup(r.Context(), group); err != nil {
+		respond(w, http.StatusForbidden, Response{Status: StatusError, Group: group, Error: err.Error()})
+		return
+	}
+
+	var open *runner.OpenAssignment
+	var err error
+	status := StatusAcknowledged
+	if action == "close" {
+		open, err = runner.CloseAssignment(r.Context(), group, id)
+		status = StatusClosed
+	} else {
+		open, err = runner.AcknowledgeAssignment(r.Context(), group, id)
+	}
+	if err != nil {
+		code := errorStatus(err)
+		if code == http.StatusInternalServerError {
+			tracing.Printf(r.Context(), "Failed to %s assignment %s in %s: %v", action, id, group, err)
+		}
+		respond(w, code, Response{Status: StatusError, ID: id, Group: group, Error: err.Error()})
+		return
+	}
+	respond(w, http.StatusOK, Response{Status: status, ID: open.ID, Group: group, Assignee: open.User})
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AccessEntry is the structured record of a request to the API, written to
+// the access log and the audit sinks.
+type AccessEntry struct {
+	Time      time.Time         `json:"time"`                 // When the request was received
+	Method    string            `json:"method"`               // HTTP method, or kafka or nats for consumed requests
+	Path      string            `json:"path"`                 // Route called, without the query, or subject a request was consumed from
+	Group     string            `json:"group,omitempty"`      // Group assigned from or read
+	Actor     string            `json:"actor,omitempty"`      // Principal that made the request; empty when it couldn't be identified
+	Remote    string            `json:"remote"`               // Address of the client, or of the broker of consumed requests
+	Status    int               `json:"status"`               // HTTP status of the response
+	Result    string            `json:"result"`               // Status of the response body: assigned, deferred, ignored or error, or ok for other responses
+	ID        string            `json:"id,omitempty"`         // ID of the assignment
+	Assignee  string            `json:"assignee,omitempty"`   // Username of the assigned user
+	Added     []string          `json:"added,omitempty"`      // Users added to a group by PATCH /groups/{group}/users
+	Removed   []string          `json:"removed,omitempty"`    // Users removed from a group by PATCH /groups/{group}/users
+	Overrides map[string]string `json:"overrides,omitempty"`  // Settings of the group config replaced for an assignment, e.g. {"availability": "always_available"}
+	From      string            `json:"from,omitempty"`       // Start of a pause scheduled through the web UI
+	Until     string            `json:"until,omitempty"`      // End of a pause set through the web UI
+	Error     string            `json:"error,omitempty"`      // Why the request failed
+	RequestID string            `json:"request_id,omitempty"` // X-Request-ID of the request, or the ID generated for it
+	TraceID   string            `json:"trace_id,omitempty"`   // ID of the W3C trace of the request, from its traceparent or generated
+	LatencyMS float64           `json:"latency_ms"`           // Time taken to answer the request
+}
+
+// AuditSink receives an AccessEntry for every request to the API.
+type AuditSink interface {
+	// Record stores entry. Errors are logged and don't fail the request.
+	Record(ctx context.Context, entry AccessEntry) error
+}
+
+// Audit records every request to handler, including rejected ones, in sinks
+// once it was answered. Wrap the handler returned by Protect so the actor
+// of the requests is known.
+func Audit(handler http.Handler, sinks ...AuditSink) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := AccessEntry{Time: timeNow(), Method: r.Method, Path: r.URL.Path, Remote: r.RemoteAddr}
+		if ids, ok := tracing.FromContext(r.Context()); ok {
+			entry.RequestID, entry.TraceID = ids.RequestID, ids.TraceID
+		}
+		handler.ServeHTTP(&accessWriter{ResponseWriter: w, entry: &entry}, r)
+
+		entry.LatencyMS = float64(timeNow().Sub(entry.Time).Microseconds()) / 1000
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		if entry.Group == "" {
+			entry.Group = r.URL.Query().Get("group")
+		}
+		entry.Overrides = overrides(r.URL.Query().Get("strategy"), r.URL.Query().Get("availability"))
+		if entry.Result == "" {
+			entry.Result = "ok"
+			if entry.Status >= http.StatusBadRequest {
+				entry.Result = StatusError
+			}
+		}
+		record(r.Context(), sinks, entry)
+	})
+}
+
+// Trace gives every request to handler the correlation IDs of its
+// X-Request-ID and traceparent headers, or generated ones, which are
+// recorded in the access log and assignment records and passed on to the
+// systems called while handling it. The request ID is returned in the
+// X-Request-ID header of the response. Wrap the handler returned by Audit.
+func Trace(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := tracing.FromRequest(r)
+		w.Header().Set(tracing.HeaderRequestID, ids.RequestID)
+		handler.ServeHTTP(w, r.WithContext(tracing.NewContext(r.Context(), ids)))
+	})
+}
+
+// record records entry in sinks, logging those that fail.
+func record(ctx context.Context, sinks []AuditSink, entry AccessEntry) {
+	// The request may be canceled once answered, but the entry must be recorded
+	ctx = context.WithoutCancel(ctx)
+	for _, sink := range sinks {
+		if err := sink.Record(ctx, entry); err != nil {
+			log.Printf("Warning: failed to record audit entry: %v", err)
+		}
+	}
+}
+
+// timeNow is replaced in tests to measure latencies.
+var timeNow = time.Now
+
+// accessWriter is the ResponseWriter of an audited request, which records
+// the response in its AccessEntry.
+type accessWriter struct {
+	http.ResponseWriter
+	entry *AccessEntry
+}
+
+func (w *accessWriter) WriteHeader(status int) {
+	if w.entry.Status == 0 {
+		w.entry.Status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessWriter) Write(data []byte) (int, error) {
+	if w.entry.Status == 0 {
+		w.entry.Status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// recordAccess lets fill complete the AccessEntry of the request answered
+// by w, when it is audited.
+func recordAccess(w http.ResponseWriter, fill func(entry *AccessEntry)) {
+	if w, ok := w.(*accessWriter); ok {
+		fill(w.entry)
+	}
+}
+
+// NewAuditSinks returns the sinks of the config: the access log, unless it
+// is off, followed by the configured audit sinks.
+func NewAuditSinks(conf config.ServerConfig) ([]AuditSink, error) {
+	var sinks []AuditSink
+	switch conf.AccessLog {
+	case "", config.AccessLogStderr:
+		sinks = append(sinks, NewAccessLog(os.Stderr))
+	case config.AccessLogStdout:
+		sinks = append(sinks, NewAccessLog(os.Stdout))
+	case config.AccessLogOff:
+	default:
+		return nil, fmt.Errorf("unknown access_log: %s", conf.AccessLog)
+	}
+	for i, sinkConf := range conf.Audit {
+		sink, err := NewAuditSink(sinkConf)
+		if err != nil {
+			return nil, fmt.Errorf("audit sink %d: %w", i+1, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// NewAuditSink returns the audit sink of the type of conf.
+func NewAuditSink(conf config.AuditSinkConfig) (AuditSink, error) {
+	switch conf.Type {
+	case config.AuditFile:
+		return newFileSink(conf.Path)
+	case config.AuditSyslog:
+		return newSyslogSink(conf)
+	case config.AuditHTTP:
+		if conf.URL == "" {
+			return nil, fmt.Errorf("url is required for http audit sinks")
+		}
+		return &httpSink{url: conf.URL, headers: conf.Headers}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink type: %s", conf.Type)
+	}
+}
+
+// accessLog writes entries to a stream as JSON lines.
+type accessLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAccessLog returns a sink writing entries to w as JSON lines.
+func NewAccessLog(w io.Writer) AuditSink {
+	return &accessLog{w: w}
+}
+
+func (l *accessLog) Record(ctx context.Context, entry AccessEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(data, '\n'))
+	return err
+}
+
+// fileSink appends entries to a file as JSON lines. The file is opened for
+// every entry, so it can be rotated while the server runs.
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is required for file audit sinks")
+	}
+	// Fail at startup rather than with the first request
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{path: path}, f.Close()
+}
+
+func (s *fileSink) Record(ctx context.Context, entry AccessEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// httpSink posts every entry as JSON to a URL, such as the collector of a
+// SIEM.
+type httpSink struct {
+	url     string
+	headers map[string]string
+}
+
+func (s *httpSink) Record(ctx context.Context, entry AccessEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with %s", s.url, resp.Status)
+	}
+	return nil
+}
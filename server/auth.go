@@ -0,0 +1,243 @@
+package server
+
+import (
+	"autoassigner/config"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// Anonymous is the name of the principal of requests without credentials.
+const Anonymous = "anonymous"
+
+// Principal is the caller of the API, as identified by an Authorizer.
+type Principal struct {
+	Name   string // Name policies refer to, such as the name of a token, a claim of an OIDC token or the common name of a client certificate
+	Method string // How the caller was identified, e.g. token
+}
+
+// Authorizer identifies the callers of the API. Implementations can plug
+// in any single sign-on by wrapping the server handler with Protect.
+type Authorizer interface {
+	// Authorize returns the caller of r. Requests without credentials fail
+	// with an error matching ErrUnauthenticated, as do invalid credentials.
+	Authorize(r *http.Request) (*Principal, error)
+}
+
+// NewAuthorizer returns the Authorizer of the auth method of the config.
+func NewAuthorizer(conf config.ServerConfig) (Authorizer, error) {
+	switch conf.Auth.Method {
+	case "", config.AuthNone:
+		return AllowAll{}, nil
+	case config.AuthToken:
+		if len(conf.Auth.Tokens) == 0 {
+			return nil, fmt.Errorf("no tokens configured for the token method")
+		}
+		return settingsTokens{}, nil
+	case config.AuthOIDC:
+		return NewOIDCAuthorizer(conf.Auth.OIDC), nil
+	case config.AuthMTLS:
+		return MTLSAuthorizer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth method: %s", conf.Auth.Method)
+	}
+}
+
+// AllowAll lets every request in as Anonymous.
+type AllowAll struct{}
+
+func (AllowAll) Authorize(r *http.Request) (*Principal, error) {
+	return &Principal{Name: Anonymous, Method: config.AuthNone}, nil
+}
+
+// TokenAuthorizer identifies callers by the bearer token they send.
+type TokenAuthorizer struct {
+	Tokens map[string]string // Tokens keyed by the name of their principal
+}
+
+func (a TokenAuthorizer) Authorize(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	for name, t := range a.Tokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return &Principal{Name: name, Method: config.AuthToken}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown token", ErrUnauthenticated)
+}
+
+// settingsTokens is a TokenAuthorizer with the tokens of the current
+// settings, so tokens rotated by refreshing secrets take effect.
+type settingsTokens struct{}
+
+func (settingsTokens) Authorize(r *http.Request) (*Principal, error) {
+	return TokenAuthorizer{Tokens: config.Settings.Server.Auth.Tokens}.Authorize(r)
+}
+
+// MTLSAuthorizer identifies callers by the client certificate they
+// presented, which the TLS server verified against its client CAs. The
+// principal is the common name of the certificate, or else its first DNS
+// name or email address.
+type MTLSAuthorizer struct{}
+
+func (MTLSAuthorizer) Authorize(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrUnauthenticated
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	name := cert.Subject.CommonName
+	if name == "" && len(cert.DNSNames) > 0 {
+		name = cert.DNSNames[0]
+	}
+	if name == "" && len(cert.EmailAddresses) > 0 {
+		name = cert.EmailAddresses[0]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%w: client certificate names no principal", ErrUnauthenticated)
+	}
+	return &Principal{Name: name, Method: config.AuthMTLS}, nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// Policies decide which routes and groups principals may use. A request is
+// allowed when one of the policies matches it; empty Policies allow every
+// identified caller everything.
+type Policies []config.PolicyConfig
+
+// allows reports whether a policy lets principal call route, and when group
+// isn't empty, assign from group.
+func (p Policies) allows(principal, route, group string) bool {
+	if len(p) == 0 {
+		return true
+	}
+	for _, policy := range p {
+		if matchAny(policy.Routes, route) && (group == "" || matchAny(policy.Groups, group)) && principalAllowed(policy.Principals, principal) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsAnonymous reports whether a policy lets requests without credentials call route.
+func (p Policies) allowsAnonymous(route string) bool {
+	for _, policy := range p {
+		if matchAny(policy.Routes, route) && contains(policy.Principals, Anonymous) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether value matches one of patterns, or patterns is empty.
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// principalAllowed reports whether a policy's principals include principal.
+// Policies without principals apply to every identified caller, but not to
+// anonymous requests, which must be allowed explicitly.
+func principalAllowed(principals []string, principal string) bool {
+	if len(principals) == 0 {
+		return principal != Anonymous
+	}
+	return contains(principals, principal)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// authContextKey is the context key of the authorization of a request.
+type authContextKey struct{}
+
+// authorization is the caller of a request and the policies applying to it.
+type authorization struct {
+	principal *Principal
+	policies  Policies
+	route     string
+}
+
+// PrincipalFromContext returns the caller of the request of ctx, or nil
+// when the handler isn't protected.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	if auth, ok := ctx.Value(authContextKey{}).(*authorization); ok {
+		return auth.principal
+	}
+	return nil
+}
+
+// authorizeGroup returns an error matching ErrForbidden when the caller of
+// the request of ctx may not assign from or read group.
+func authorizeGroup(ctx context.Context, group string) error {
+	auth, ok := ctx.Value(authContextKey{}).(*authorization)
+	if !ok || auth.policies.allows(auth.principal.Name, auth.route, group) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s may not use group %s", ErrForbidden, auth.principal.Name, group)
+}
+
+// Protect lets requests through to handler only when authorizer identifies
+// their caller and policies allow the route. Requests without credentials
+// are let through as Anonymous on routes a policy allows anonymous callers.
+// Groups are checked by the handlers once they know the group.
+func Protect(handler http.Handler, authorizer Authorizer, policies Policies) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authorizer.Authorize(r)
+		if errors.Is(err, ErrUnauthenticated) && !hasCredentials(r) && policies.allowsAnonymous(r.URL.Path) {
+			principal, err = &Principal{Name: Anonymous}, nil
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respond(w, http.StatusUnauthorized, Response{Status: StatusError, Error: err.Error()})
+			return
+		}
+		recordAccess(w, func(entry *AccessEntry) { entry.Actor = principal.Name })
+		if !policies.allows(principal.Name, r.URL.Path, "") {
+			respond(w, http.StatusForbidden, Response{Status: StatusError, Error: fmt.Sprintf("%s: %s may not call %s", ErrForbidden, principal.Name, r.URL.Path)})
+			return
+		}
+		ctx := context.WithValue(r.Context(), authContextKey{}, &authorization{principal: principal, policies: policies, route: r.URL.Path})
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// hasCredentials reports whether r carries a bearer token or client
+// certificate, which must be valid rather than being treated as anonymous.
+func hasCredentials(r *http.Request) bool {
+	if _, ok := bearerToken(r); ok {
+		return true
+	}
+	return r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+}
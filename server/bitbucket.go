@@ -0,0 +1,44 @@
+package server
+
+import (
+	"autoassigner/bitbucket"
+	"autoassigner/config"
+	"autoassigner/identity"
+	"net/http"
+)
+
+// handleBitbucket adds a reviewer to pull requests opened on Bitbucket.
+func handleBitbucket(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readPayload(w, r)
+	if !ok {
+		return
+	}
+	if secret := config.Settings.Bitbucket.WebhookSecret; secret != "" && !bitbucket.VerifySignature(secret, payload, r.Header.Get("X-Hub-Signature")) {
+		respond(w, http.StatusUnauthorized, Response{Status: StatusError, Error: "invalid signature"})
+		return
+	}
+	change, ok, err := bitbucket.ParseEvent(r.Header.Get("X-Event-Key"), payload)
+	if err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+	if !ok {
+		respond(w, http.StatusOK, Response{Status: StatusIgnored})
+		return
+	}
+
+	resp, status := assignChange(r.Context(), r, *change, identity.Bitbucket, bitbucket.ChangedFiles)
+	if resp.Status != StatusAssigned {
+		respond(w, status, resp)
+		return
+	}
+	if resp.Login, err = bitbucket.Reviewer(r.Context(), resp.Assignee); err != nil {
+		writeBackFailed(w, *change, resp, err)
+		return
+	}
+	if err := bitbucket.AddReviewer(r.Context(), *change, resp.Login); err != nil {
+		writeBackFailed(w, *change, resp, err)
+		return
+	}
+	respond(w, status, resp)
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/kafka"
+	"autoassigner/nats"
+	"autoassigner/runner"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// AssignmentRequest is a message asking the consumer for an assignment.
+type AssignmentRequest struct {
+	ID           string            `json:"id,omitempty"`           // Identifier of the assignment; a request with the ID of a logged assignment returns it instead of assigning again
+	Group        string            `json:"group"`                  // Group to assign a user from
+	Priority     string            `json:"priority,omitempty"`     // Selects a route from the group's priorities, e.g. "P1"
+	Strategy     string            `json:"strategy,omitempty"`     // Replaces the strategy of the group for this assignment, e.g. "random"
+	Availability string            `json:"availability,omitempty"` // Replaces the availability checker of the group for this assignment, e.g. "always_available"
+	Exclude      []string          `json:"exclude,omitempty"`      // Users never selected, such as the reporter of a ticket
+	Metadata     map[string]string `json:"metadata,omitempty"`     // Context such as the ticket to assign, passed to the group's callback
+	Explain      bool              `json:"explain,omitempty"`      // Trace the selection in the result
+}
+
+// AssignmentResult is published for every AssignmentRequest consumed.
+type AssignmentResult struct {
+	Response
+	Metadata map[string]string `json:"metadata,omitempty"` // Metadata of the request, to match the result with it
+}
+
+// Consume receives assignment requests from the Kafka topic or NATS subject
+// of config.Settings.Server.Consumer until ctx is done, assigns a user for
+// each and publishes the results to the reply subject. Lost connections
+// are retried with a backoff, using the settings of the time. Requests are
+// handled while settings is locked, which keeps the config from being
+// replaced meanwhile, and recorded in sinks like requests to the API.
+func Consume(ctx context.Context, settings sync.Locker, sinks ...AuditSink) error {
+	backoff := minConsumerBackoff
+	for {
+		settings.Lock()
+		conf := config.Settings.Server.Consumer
+		settings.Unlock()
+		if conf.Group == "" {
+			conf.Group = "autoassigner"
+		}
+		c := &consumer{conf: conf, settings: settings, sinks: sinks}
+
+		connected := timeNow()
+		var err error
+		switch conf.Type {
+		case config.ConsumerKafka:
+			err = consumeKafka(ctx, c)
+		case config.ConsumerNATS:
+			err = consumeNATS(ctx, c)
+		default:
+			return fmt.Errorf("unknown consumer type: %s", conf.Type)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		// A consumer that ran for a while failed afresh rather than again
+		if timeNow().Sub(connected) > maxConsumerBackoff {
+			backoff = minConsumerBackoff
+		}
+		log.Printf("%s consumer of %s failed, retrying in %s: %v", conf.Type, conf.Subject, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxConsumerBackoff {
+			backoff = maxConsumerBackoff
+		}
+	}
+}
+
+// Delays between attempts to reconnect a consumer.
+var (
+	minConsumerBackoff = time.Second
+	maxConsumerBackoff = time.Minute
+)
+
+// consumerPollTimeout is how long a poll of the Kafka consumer waits for
+// records.
+const consumerPollTimeout = 5 * time.Second
+
+// consumer handles the requests of Consume.
+type consumer struct {
+	conf     config.ConsumerConfig
+	settings sync.Locker
+	sinks    []AuditSink
+}
+
+// consumeKafka handles the records of the topic until the consumer fails.
+// Offsets are committed once a record's result is published, so requests
+// are assigned at least once; requests without an ID are identified by
+// their offset, so a record delivered again isn't assigned again.
+func consumeKafka(ctx context.Context, c *consumer) error {
+	client := &kafka.Client{URL: c.conf.URL, Headers: c.conf.Headers}
+	kc, err := client.NewConsumer(ctx, c.conf.Group, c.conf.Subject)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Let the group rebalance right away rather than once the instance expires
+		closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		kc.Close(closeCtx)
+	}()
+	for {
+		records, err := kc.Poll(ctx, consumerPollTimeout)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			id := fmt.Sprintf("kafka-%s-%d-%d", record.Topic, record.Partition, record.Offset)
+			result, _ := c.handle(ctx, record.Value, id)
+			if c.conf.ReplySubject != "" {
+				if err := client.Produce(ctx, c.conf.ReplySubject, kafka.Message{Key: result.ID, Value: result}); err != nil {
+					return fmt.Errorf("failed to publish result of %s: %w", id, err)
+				}
+			}
+			if err := kc.Commit(ctx, record); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// consumeNATS handles the messages of the subject until the connection is
+// lost. NATS doesn't deliver messages again, so each is assigned at most
+// once.
+func consumeNATS(ctx context.Context, c *consumer) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := nats.Dial(dialCtx, c.conf.URL, c.conf.Token)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Subscribe(c.conf.Subject, c.conf.Group); err != nil {
+		return err
+	}
+	for {
+		msg, err := conn.Next(ctx)
+		if err != nil {
+			return err
+		}
+		result, _ := c.handle(ctx, msg.Data, "")
+		reply := msg.Reply
+		if reply == "" {
+			reply = c.conf.ReplySubject
+		}
+		if reply == "" {
+			continue
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		if err := conn.Publish(reply, data); err != nil {
+			return fmt.Errorf("failed to publish result to %s: %w", reply, err)
+		}
+	}
+}
+
+// handle assigns a user for the request in data and records it in the audit
+// sinks. id identifies the assignment when the request has no ID. The
+// status is that of the response to a webhook with the same result.
+func (c *consumer) handle(ctx context.Context, data []byte, id string) (AssignmentResult, int) {
+	entry := AccessEntry{Time: timeNow(), Method: c.conf.Type, Path: c.conf.Subject, Remote: brokerHost(c.conf.URL)}
+	result, status := c.assign(ctx, data, id)
+
+	entry.Status, entry.Group = status, result.Group
+	var req AssignmentRequest
+	if json.Unmarshal(data, &req) == nil {
+		entry.Overrides = overrides(req.Strategy, req.Availability)
+	}
+	entry.Result, entry.ID, entry.Assignee, entry.Error = result.Status, result.ID, result.Assignee, result.Error
+	entry.LatencyMS = float64(timeNow().Sub(entry.Time).Microseconds()) / 1000
+	record(ctx, c.sinks, entry)
+	return result, status
+}
+
+func (c *consumer) assign(ctx context.Context, data []byte, id string) (AssignmentResult, int) {
+	var req AssignmentRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return AssignmentResult{Response: Response{Status: StatusError, Error: fmt.Sprintf("invalid assignment request: %v", err)}}, http.StatusBadRequest
+	}
+	result := AssignmentResult{Metadata: req.Metadata}
+	if req.Group == "" {
+		result.Response = Response{Status: StatusError, Error: "group is required"}
+		return result, http.StatusBadRequest
+	}
+	if req.ID != "" {
+		id = req.ID
+	}
+	c.settings.Lock()
+	defer c.settings.Unlock()
+	opts := runner.AssignOptions{ID: id, Priority: req.Priority, Strategy: req.Strategy, Availability: req.Availability, Exclude: req.Exclude, CallbackData: req.Metadata, Explain: req.Explain}
+	var status int
+	result.Response, status = assignFrom(ctx, req.Group, assignmentRequest(req), opts)
+	return result, status
+}
+
+// assignmentRequest names a request in logs.
+type assignmentRequest AssignmentRequest
+
+func (r assignmentRequest) String() string {
+	if r.ID != "" {
+		return "request " + r.ID
+	}
+	return "request"
+}
+
+// brokerHost returns the host of a broker URL, recorded as the remote
+// address of requests.
+func brokerHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
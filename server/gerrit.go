@@ -0,0 +1,39 @@
+package server
+
+import (
+	"autoassigner/gerrit"
+	"autoassigner/identity"
+	"net/http"
+)
+
+// handleGerrit adds a reviewer to changes created on Gerrit.
+func handleGerrit(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readPayload(w, r)
+	if !ok {
+		return
+	}
+	change, ok, err := gerrit.ParseEvent(payload)
+	if err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+	if !ok {
+		respond(w, http.StatusOK, Response{Status: StatusIgnored})
+		return
+	}
+
+	resp, status := assignChange(r.Context(), r, *change, identity.Gerrit, gerrit.ChangedFiles)
+	if resp.Status != StatusAssigned {
+		respond(w, status, resp)
+		return
+	}
+	if resp.Login, err = gerrit.Reviewer(r.Context(), resp.Assignee); err != nil {
+		writeBackFailed(w, *change, resp, err)
+		return
+	}
+	if err := gerrit.AddReviewer(r.Context(), *change, resp.Login); err != nil {
+		writeBackFailed(w, *change, resp, err)
+		return
+	}
+	respond(w, status, resp)
+}
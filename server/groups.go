@@ -0,0 +1,168 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// GroupResponse is the JSON body answering PUT /groups/{group} and
+// PATCH /groups/{group}/users.
+type GroupResponse struct {
+	Status  string   `json:"status"`            // created or updated
+	Group   string   `json:"group"`             // Group whose config was changed
+	Users   []string `json:"users,omitempty"`   // Users of the group after PATCH /groups/{group}/users
+	Added   []string `json:"added,omitempty"`   // Users the request added
+	Removed []string `json:"removed,omitempty"` // Users the request removed
+}
+
+// Statuses reported in GroupResponse.Status.
+const (
+	StatusCreated = "created"
+	StatusUpdated = "updated"
+)
+
+// UsersRequest is the JSON body of PATCH /groups/{group}/users.
+type UsersRequest struct {
+	Add    []string `json:"add"`    // Users to add to the group
+	Remove []string `json:"remove"` // Users to remove from the group, with their settings
+}
+
+// handleGroups serves the routes of single groups:
+//
+//	GET   /groups/{group}/stats  Assignments of the group within a window
+//	PUT   /groups/{group}        Create or replace the group config with the YAML body
+//	PATCH /groups/{group}/users  Add and remove users of the group
+//	POST  /groups/{group}/assignments/{id}/ack    Acknowledge an open assignment
+//	POST  /groups/{group}/assignments/{id}/close  Close an open assignment
+//
+// Groups in subdirectories are named by their path, such as
+// /groups/platform/oncall/stats, so the route is told by the last segments.
+func handleGroups(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/groups/")
+	group, rest := path, ""
+	if i := strings.LastIndex(path, "/"); i >= 0 && (path[i+1:] == "stats" || path[i+1:] == "users") {
+		group, rest = path[:i], path[i+1:]
+	}
+	if parts := strings.Split(path, "/"); len(parts) >= 4 && parts[len(parts)-3] == "assignments" {
+		if action := parts[len(parts)-1]; (action == "ack" || action == "close") && parts[len(parts)-2] != "" {
+			group = strings.Join(parts[:len(parts)-3], "/")
+			if group != "" {
+				handleOpenAssignment(w, r, group, parts[len(parts)-2], action)
+				return
+			}
+		}
+	}
+	switch {
+	case group == "" || strings.HasSuffix(group, "/") || (rest == "" && r.Method != http.MethodPut && unknownSubpath(group)):
+		respond(w, http.StatusNotFound, Response{Status: StatusError, Error: "not found"})
+	case rest == "stats":
+		handleStats(w, r, group)
+	case rest == "":
+		handlePutGroup(w, r, group)
+	case rest == "users":
+		handlePatchUsers(w, r, group)
+	default:
+		respond(w, http.StatusNotFound, Response{Status: StatusError, Error: "not found"})
+	}
+}
+
+// unknownSubpath reports whether group is the path of an unknown route of
+// a group rather than a group in a subdirectory, such as support/counts.
+func unknownSubpath(group string) bool {
+	if !strings.Contains(group, "/") {
+		return false
+	}
+	_, ok := config.GroupConfigPath(group)
+	return !ok
+}
+
+// handlePutGroup creates or replaces the config of a group with the YAML
+// body of the request, once it passes validation.
+func handlePutGroup(w http.ResponseWriter, r *http.Request, group string) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Group: group, Error: "method not allowed"})
+		return
+	}
+	if err := authorizeGroup(r.Context(), group); err != nil {
+		respond(w, http.StatusForbidden, Response{Status: StatusError, Group: group, Error: err.Error()})
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayload))
+	if err != nil {
+		respond(w, http.StatusRequestEntityTooLarge, Response{Status: StatusError, Group: group, Error: err.Error()})
+		return
+	}
+
+	created, err := runner.UpdateGroupConfig(r.Context(), group, data)
+	if err != nil {
+		respondGroupError(w, group, err)
+		return
+	}
+	resp, status := GroupResponse{Status: StatusUpdated, Group: group}, http.StatusOK
+	if created {
+		resp.Status, status = StatusCreated, http.StatusCreated
+	}
+	respondGroup(w, status, resp)
+}
+
+// handlePatchUsers adds users to and removes users from a group.
+func handlePatchUsers(w http.ResponseWriter, r *http.Request, group string) {
+	if r.Method != http.MethodPatch {
+		w.Header().Set("Allow", http.MethodPatch)
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Group: group, Error: "method not allowed"})
+		return
+	}
+	if err := authorizeGroup(r.Context(), group); err != nil {
+		respond(w, http.StatusForbidden, Response{Status: StatusError, Group: group, Error: err.Error()})
+		return
+	}
+	var req UsersRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPayload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Group: group, Error: "invalid users request: " + err.Error()})
+		return
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Group: group, Error: "add or remove is required"})
+		return
+	}
+
+	update, err := runner.UpdateGroupUsers(r.Context(), group, req.Add, req.Remove)
+	if err != nil {
+		respondGroupError(w, group, err)
+		return
+	}
+	respondGroup(w, http.StatusOK, GroupResponse{Status: StatusUpdated, Group: group, Users: update.Users, Added: update.Added, Removed: update.Removed})
+}
+
+// respondGroup writes resp, recording the change in the access log.
+func respondGroup(w http.ResponseWriter, status int, resp GroupResponse) {
+	recordAccess(w, func(entry *AccessEntry) {
+		entry.Group, entry.Result, entry.Added, entry.Removed = resp.Group, resp.Status, resp.Added, resp.Removed
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// respondGroupError answers a request whose change of a group config failed:
+// with 404 for unknown groups, 422 for configs that don't pass validation
+// and 503 when the lock of the group couldn't be taken.
+func respondGroupError(w http.ResponseWriter, group string, err error) {
+	status := errorStatus(err)
+	if errors.Is(err, runner.ErrConfig) && !errors.Is(err, runner.ErrInvalidGroup) {
+		status = http.StatusUnprocessableEntity
+	}
+	if status == http.StatusInternalServerError {
+		log.Printf("Failed to update group %s: %v", group, err)
+	}
+	respond(w, status, Response{Status: StatusError, Group: group, Error: err.Error()})
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"autoassigner/runner"
+	"encoding/json"
+	"net/http"
+)
+
+// elector is the leader election of the replicas of the server, whose role
+// GET /healthz reports; nil for a standalone server.
+var elector *runner.Elector
+
+// SetElector sets the leader election reported by GET /healthz. It must be
+// called before the handler serves requests.
+func SetElector(e *runner.Elector) {
+	elector = e
+}
+
+// HealthResponse is the JSON body answering GET /healthz.
+type HealthResponse struct {
+	Status string `json:"status"` // Always ok; a server that can't answer is unhealthy
+	runner.ReplicaStatus
+}
+
+// handleHealth answers liveness and readiness probes with the role of the
+// replica, so operators can tell which replica leads.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Error: "method not allowed"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthResponse{Status: "ok", ReplicaStatus: *elector.Status(r.Context())})
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"autoassigner/history"
+	"autoassigner/runner"
+	"autoassigner/tracing"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HistoryResponse is the JSON body answering GET /history.
+type HistoryResponse struct {
+	Records []runner.AssignmentLog `json:"records"` // Matching records of the assignment logs, oldest first
+}
+
+// handleHistory serves the assignment log records matching a query, given
+// as the q parameter (e.g. q=user=alice AND since=90d) and as parameters
+// named after fields (e.g. user=alice&since=90d), which must all match.
+// limit returns only the most recent records.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Error: "method not allowed"})
+		return
+	}
+
+	params := r.URL.Query()
+	now := time.Now()
+	q, err := history.ParseQuery(params.Get("q"), now)
+	if err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+	var opts runner.QueryOptions
+	for field, values := range params {
+		if field == "q" || field == "limit" {
+			continue
+		}
+		for _, value := range values {
+			cond, err := history.NewCondition(field, false, value, now)
+			if err != nil {
+				respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: err.Error()})
+				return
+			}
+			q.Conditions = append(q.Conditions, cond)
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if opts.Limit, err = strconv.Atoi(limit); err != nil || opts.Limit < 0 {
+			respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: "invalid limit " + limit})
+			return
+		}
+	}
+
+	// Groups named by the query must be allowed, others are left out
+	if groups, ok := q.Groups(); ok {
+		for _, group := range groups {
+			if err := authorizeGroup(r.Context(), group); err != nil {
+				respond(w, http.StatusForbidden, Response{Status: StatusError, Group: group, Error: err.Error()})
+				return
+			}
+		}
+	}
+	opts.Allow = func(group string) bool { return authorizeGroup(r.Context(), group) == nil }
+
+	records, err := runner.QueryHistory(r.Context(), q, opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, runner.ErrInvalidGroup) {
+			status = http.StatusNotFound
+		} else {
+			tracing.Printf(r.Context(), "Failed to query history: %v", err)
+		}
+		respond(w, status, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+	if records == nil {
+		records = []runner.AssignmentLog{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HistoryResponse{Records: records})
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// LambdaHandler returns the handler of AWS Lambda invocations with events of
+// API Gateway REST APIs (payload version 1.0), HTTP APIs and function URLs
+// (payload version 2.0), which are served by handler like requests to the
+// server, and of SQS queues, whose messages are AssignmentRequests handled
+// like those of the consumer and recorded in sinks. The state mirrored to
+// S3 is pulled before every invocation.
+func LambdaHandler(handler http.Handler, sinks ...AuditSink) func(ctx context.Context, event json.RawMessage) (interface{}, error) {
+	var settings sync.Mutex
+	return func(ctx context.Context, event json.RawMessage) (interface{}, error) {
+		var shape struct {
+			Version    string `json:"version"`
+			HTTPMethod string `json:"httpMethod"`
+			Records    []struct {
+				EventSource string `json:"eventSource"`
+			} `json:"Records"`
+		}
+		if err := json.Unmarshal(event, &shape); err != nil {
+			return nil, fmt.Errorf("invalid event: %w", err)
+		}
+		if err := runner.PullState(ctx); err != nil {
+			return nil, fmt.Errorf("failed to pull state from S3: %w", err)
+		}
+		switch {
+		case shape.Version == "2.0":
+			return serveAPIGateway(ctx, handler, event, true)
+		case shape.HTTPMethod != "":
+			return serveAPIGateway(ctx, handler, event, false)
+		case len(shape.Records) > 0 && shape.Records[0].EventSource == "aws:sqs":
+			return handleSQS(ctx, event, &settings, sinks)
+		default:
+			return nil, fmt.Errorf("unsupported event: expected an API Gateway request or SQS messages")
+		}
+	}
+}
+
+// apiGatewayRequest holds the fields of both payload versions of API
+// Gateway requests.
+type apiGatewayRequest struct {
+	// Version 1.0
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	// Version 2.0
+	RawPath        string   `json:"rawPath"`
+	RawQueryString string   `json:"rawQueryString"`
+	Cookies        []string `json:"cookies"`
+
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	RequestContext  struct {
+		Stage    string `json:"stage"`
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+		HTTP struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+// apiGatewayResponse is the response of an API Gateway request, which both
+// payload versions accept.
+type apiGatewayResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// serveAPIGateway serves the request of an API Gateway event with handler.
+func serveAPIGateway(ctx context.Context, handler http.Handler, event json.RawMessage, v2 bool) (*apiGatewayResponse, error) {
+	var e apiGatewayRequest
+	if err := json.Unmarshal(event, &e); err != nil {
+		return nil, fmt.Errorf("invalid API Gateway event: %w", err)
+	}
+	body := []byte(e.Body)
+	if e.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(e.Body); err != nil {
+			return nil, fmt.Errorf("invalid API Gateway event body: %w", err)
+		}
+	}
+
+	method, path, remote := e.HTTPMethod, e.Path, e.RequestContext.Identity.SourceIP
+	query := url.Values(e.MultiValueQueryStringParameters).Encode()
+	if v2 {
+		method, path, remote, query = e.RequestContext.HTTP.Method, e.RawPath, e.RequestContext.HTTP.SourceIP, e.RawQueryString
+		// Paths of HTTP APIs include the stage unless it is the default one
+		if stage := e.RequestContext.Stage; stage != "" && stage != "$default" {
+			path = strings.TrimPrefix(path, "/"+stage)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, (&url.URL{Path: path, RawQuery: query}).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid API Gateway request: %w", err)
+	}
+	for name, values := range e.MultiValueHeaders {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	for name, value := range e.Headers {
+		if _, ok := e.MultiValueHeaders[name]; !ok {
+			req.Header.Set(name, value)
+		}
+	}
+	if len(e.Cookies) > 0 {
+		req.Header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+	req.RemoteAddr = remote
+	req.Host = req.Header.Get("Host")
+
+	w := &lambdaResponseWriter{header: http.Header{}}
+	handler.ServeHTTP(w, req)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	resp := &apiGatewayResponse{StatusCode: w.status, Body: w.body.String()}
+	if v2 {
+		resp.Headers = map[string]string{}
+		for name, values := range w.header {
+			resp.Headers[name] = strings.Join(values, ",")
+		}
+	} else {
+		resp.MultiValueHeaders = w.header
+	}
+	return resp, nil
+}
+
+// lambdaResponseWriter collects the response to an API Gateway request.
+type lambdaResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *lambdaResponseWriter) Header() http.Header { return w.header }
+
+func (w *lambdaResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *lambdaResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(data)
+}
+
+// sqsEvent is a batch of SQS messages.
+type sqsEvent struct {
+	Records []struct {
+		MessageID      string `json:"messageId"`
+		Body           string `json:"body"`
+		EventSourceARN string `json:"eventSourceARN"`
+	} `json:"Records"`
+}
+
+// sqsBatchResponse reports the messages of a batch that failed, so SQS
+// delivers them again (ReportBatchItemFailures).
+type sqsBatchResponse struct {
+	BatchItemFailures []sqsBatchItemFailure `json:"batchItemFailures"`
+}
+
+type sqsBatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// handleSQS assigns a user for every AssignmentRequest of an SQS batch.
+// Messages without an ID are identified by their message ID, so a message
+// delivered again isn't assigned again. Messages that failed for reasons
+// that may pass, such as an unreachable availability service, are reported
+// as batch item failures; invalid requests are not.
+func handleSQS(ctx context.Context, event json.RawMessage, settings sync.Locker, sinks []AuditSink) (*sqsBatchResponse, error) {
+	var e sqsEvent
+	if err := json.Unmarshal(event, &e); err != nil {
+		return nil, fmt.Errorf("invalid SQS event: %w", err)
+	}
+	resp := &sqsBatchResponse{BatchItemFailures: []sqsBatchItemFailure{}}
+	for _, message := range e.Records {
+		c := &consumer{conf: config.ConsumerConfig{Type: "sqs", Subject: message.EventSourceARN}, settings: settings, sinks: sinks}
+		result, status := c.handle(ctx, []byte(message.Body), message.MessageID)
+		if status >= http.StatusInternalServerError {
+			log.Printf("Failed to handle SQS message %s, retrying: %s", message.MessageID, result.Error)
+			resp.BatchItemFailures = append(resp.BatchItemFailures, sqsBatchItemFailure{ItemIdentifier: message.MessageID})
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/linear"
+	"net/http"
+)
+
+// handleLinear assigns issues created in Linear. Issues that are already
+// assigned or whose team is not mapped are ignored.
+func handleLinear(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readPayload(w, r)
+	if !ok {
+		return
+	}
+	if secret := config.Settings.Linear.WebhookSecret; secret != "" && !linear.VerifySignature(secret, payload, r.Header.Get("Linear-Signature")) {
+		respond(w, http.StatusUnauthorized, Response{Status: StatusError, Error: "invalid signature"})
+		return
+	}
+	issue, ok, err := linear.ParseEvent(payload)
+	if err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+	if !ok || issue.AssigneeID != "" {
+		respond(w, http.StatusOK, Response{Status: StatusIgnored})
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		if group, ok = linear.Group(*issue); !ok {
+			respond(w, http.StatusOK, Response{Status: StatusIgnored})
+			return
+		}
+	}
+
+	resp, status := assignFrom(r.Context(), group, issue, requestOptions(r))
+	if resp.Status != StatusAssigned {
+		respond(w, status, resp)
+		return
+	}
+	if resp.Login, err = linear.UserID(r.Context(), resp.Assignee); err != nil {
+		writeBackFailed(w, issue, resp, err)
+		return
+	}
+	if err := linear.Assign(r.Context(), *issue, resp.Login); err != nil {
+		writeBackFailed(w, issue, resp, err)
+		return
+	}
+	respond(w, status, resp)
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// durationBuckets are the upper bounds in seconds of the buckets of the
+// time to acknowledge and time to close histograms, from a minute to a week.
+var durationBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400, 259200, 604800}
+
+// handleMetrics serves GET /metrics in the Prometheus text format: the
+// histograms of the time to acknowledge and to close assignments, and the
+// open assignments of every user with the age of the oldest, for the groups
+// the caller may use. The histograms are computed from durations.log, so
+// every replica serves the same values.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Error: "method not allowed"})
+		return
+	}
+	groups, err := config.ListGroups()
+	if err != nil {
+		respond(w, http.StatusInternalServerError, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+
+	ack, closed := &histogramFamily{}, &histogramFamily{}
+	var open, age []sample
+	now := timeNow()
+	for _, group := range groups {
+		if authorizeGroup(r.Context(), group) != nil {
+			continue
+		}
+		durations, err := runner.ReadDurations(group)
+		if err != nil {
+			log.Printf("Failed to read durations of %s for metrics: %v", group, err)
+			continue
+		}
+		for _, record := range durations {
+			switch record.Event {
+			case runner.EventAcknowledged:
+				ack.observe(group, record.Seconds)
+			case runner.EventClosed:
+				closed.observe(group, record.Seconds)
+			}
+		}
+		counts, oldest, err := runner.OpenWork(group)
+		if err != nil {
+			log.Printf("Failed to read open assignments of %s for metrics: %v", group, err)
+			continue
+		}
+		for _, user := range sortedKeys(counts) {
+			open = append(open, sample{labels: labels("group", group, "user", user), value: float64(counts[user])})
+			if t, ok := oldest[user]; ok {
+				age = append(age, sample{labels: labels("group", group, "user", user), value: now.Sub(t).Seconds()})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	ack.write(w, "autoassigner_time_to_ack_seconds", "Time from an assignment to its acknowledgement.")
+	closed.write(w, "autoassigner_time_to_close_seconds", "Time from an assignment to its closing.")
+	writeGauge(w, "autoassigner_open_assignments", "Open assignments of a user, for groups with track_open.", open)
+	writeGauge(w, "autoassigner_oldest_open_assignment_age_seconds", "Age of the oldest open assignment of a user.", age)
+}
+
+// histogramFamily holds a histogram with durationBuckets per group.
+type histogramFamily struct {
+	groups []string
+	byName map[string]*histogram
+}
+
+type histogram struct {
+	buckets []uint64 // Observations up to each of durationBuckets
+	count   uint64
+	sum     float64
+}
+
+func (f *histogramFamily) observe(group string, value float64) {
+	if f.byName == nil {
+		f.byName = map[string]*histogram{}
+	}
+	h, ok := f.byName[group]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(durationBuckets))}
+		f.byName[group] = h
+		f.groups = append(f.groups, group)
+	}
+	for i, bound := range durationBuckets {
+		if value <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (f *histogramFamily) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, group := range f.groups {
+		h := f.byName[group]
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels("group", group, "le", formatFloat(bound)), h.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels("group", group, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, labels("group", group), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labels("group", group), h.count)
+	}
+}
+
+// sample is a value of a gauge with its labels.
+type sample struct {
+	labels string
+	value  float64
+}
+
+func writeGauge(w io.Writer, name, help string, samples []sample) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", name, s.labels, formatFloat(s.value))
+	}
+}
+
+// labelEscaper escapes label values for the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats label names and values as {name="value",...}.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i] + `="` + labelEscaper.Replace(pairs[i+1]) + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
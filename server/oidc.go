@@ -0,0 +1,250 @@
+package server
+
+import (
+	"autoassigner/config"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCAuthorizer identifies callers by a bearer token issued by an OpenID
+// Connect provider, such as the single sign-on of a company. Tokens signed
+// with RS256 or ES256 by a key of the provider are accepted while they are
+// valid for the configured audience.
+type OIDCAuthorizer struct {
+	conf config.OIDCConfig
+	now  func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey // Signing keys of the provider keyed by kid
+	fetched time.Time                   // When keys were last fetched
+}
+
+// oidcKeysMinAge limits how often unknown key IDs make the authorizer fetch
+// the keys of the provider again.
+const oidcKeysMinAge = time.Minute
+
+// oidcLeeway tolerates clock skew between the provider and the server.
+const oidcLeeway = time.Minute
+
+// NewOIDCAuthorizer returns an OIDCAuthorizer for the provider of conf. Its
+// keys are fetched with the first request.
+func NewOIDCAuthorizer(conf config.OIDCConfig) *OIDCAuthorizer {
+	return &OIDCAuthorizer{conf: conf, now: time.Now}
+}
+
+func (a *OIDCAuthorizer) Authorize(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	claims, err := a.verify(r.Context(), token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	claim := a.conf.Claim
+	if claim == "" {
+		claim = "sub"
+	}
+	name, _ := claims[claim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w: token has no %s claim", ErrUnauthenticated, claim)
+	}
+	return &Principal{Name: name, Method: config.AuthOIDC}, nil
+}
+
+// verify checks the signature and claims of a JWT and returns its claims.
+func (a *OIDCAuthorizer) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+	key, err := a.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, fmt.Errorf("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(signature) != 64 ||
+			!ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			return nil, fmt.Errorf("invalid token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing key")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	now := a.now()
+	if iss, _ := claims["iss"].(string); iss != strings.TrimSuffix(a.conf.Issuer, "/") && iss != a.conf.Issuer {
+		return nil, fmt.Errorf("token issued by %q", iss)
+	}
+	if a.conf.Audience != "" && !hasAudience(claims["aud"], a.conf.Audience) {
+		return nil, fmt.Errorf("token not issued for audience %s", a.conf.Audience)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcLeeway)) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("token not valid yet")
+	}
+	return claims, nil
+}
+
+// hasAudience reports whether the aud claim, a string or list, names audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a JWT.
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// key returns the signing key with the given ID, fetching the keys of the
+// provider when the key is unknown, such as after the provider rotated them.
+func (a *OIDCAuthorizer) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	if a.keys != nil && a.now().Sub(a.fetched) < oidcKeysMinAge {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	keys, err := a.fetchKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	a.keys, a.fetched = keys, a.now()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// fetchKeys reads the JSON Web Key Set of the provider, from jwks_url or
+// the jwks_uri of the issuer's discovery document.
+func (a *OIDCAuthorizer) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := a.conf.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := getJSON(ctx, strings.TrimSuffix(a.conf.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURL, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				return nil, fmt.Errorf("malformed RSA key %q", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				return nil, fmt.Errorf("malformed EC key %q", k.Kid)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	// Tokens without a kid are accepted from providers with a single key
+	if len(keys) == 1 {
+		for _, key := range keys {
+			keys[""] = key
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches a JSON document.
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
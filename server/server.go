@@ -0,0 +1,236 @@
+// Package server implements the webhook server started by "autoassigner
+// serve": it receives events from integrated systems, assigns a user from
+// the group routed to, and writes the assignment back to the system.
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"autoassigner/tracing"
+	"autoassigner/vcs"
+	"autoassigner/version"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// maxPayload limits the size of webhook payloads read into memory.
+const maxPayload = 5 << 20
+
+// Handler returns the handler serving the webhook endpoints:
+//
+//	POST /bitbucket  Bitbucket Cloud and Data Center pull request events
+//	POST /gerrit     Gerrit change events from the webhooks plugin
+//	POST /servicenow ServiceNow records sent by outbound REST messages
+//	POST /zendesk    Zendesk tickets sent by trigger webhooks
+//	POST /linear     Linear issue events
+//	POST /asana      Asana task events of project webhooks
+//	GET  /state      Snapshot of the state of every group
+//	GET  /groups/{group}/stats
+//	                 Assignments of a group within a window, for dashboards
+//	PUT  /groups/{group}
+//	                 Create or replace the config of a group
+//	PATCH /groups/{group}/users
+//	                 Add and remove users of a group
+//	POST /groups/{group}/assignments/{id}/ack
+//	POST /groups/{group}/assignments/{id}/close
+//	                 Acknowledge or close an open assignment of a group
+//	GET  /history    Assignment log records matching a query
+//	GET  /healthz    Health and role of the replica, for probes
+//	GET  /version    Build information and compiled-in backends, like "autoassigner version --json"
+//	GET  /metrics    Assignment durations and open work in the Prometheus format
+//
+// Every webhook endpoint accepts a group query parameter that assigns from
+// that group instead of the one chosen by the routes in the config; for
+// /state it limits the snapshot to that group. The strategy and
+// availability query parameters replace the strategy and availability
+// checker of the group for the assignment.
+//
+// The handler lets every request in; wrap it with Protect to identify
+// callers and restrict the routes and groups they may use, with Audit to
+// log requests and with Trace to correlate them with the assignments they
+// make.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bitbucket", handleBitbucket)
+	mux.HandleFunc("/gerrit", handleGerrit)
+	mux.HandleFunc("/servicenow", handleServiceNow)
+	mux.HandleFunc("/zendesk", handleZendesk)
+	mux.HandleFunc("/linear", handleLinear)
+	mux.HandleFunc("/asana", handleAsana)
+	mux.HandleFunc("/state", handleState)
+	mux.HandleFunc("/groups/", handleGroups)
+	mux.HandleFunc("/history", handleHistory)
+	mux.HandleFunc("/healthz", handleHealth)
+	mux.Handle("/version", versionHandler())
+	mux.HandleFunc("/metrics", handleMetrics)
+	return mux
+}
+
+// versionHandler serves the build information of the binary with its
+// compiled-in backends.
+func versionHandler() http.Handler {
+	info := version.Get()
+	info.Backends = runner.Backends()
+	return version.Handler(info)
+}
+
+// Response is the JSON body answering a webhook.
+type Response struct {
+	Status   string                 `json:"status"`             // assigned, deferred, ignored, acknowledged, closed or error
+	ID       string                 `json:"id,omitempty"`       // ID of the assignment, or of the queued one when deferred
+	Group    string                 `json:"group,omitempty"`    // Group the user was assigned from
+	Assignee string                 `json:"assignee,omitempty"` // Username of the assigned user
+	Login    string                 `json:"login,omitempty"`    // Identifier of the assigned user in the integrated system
+	Deferred string                 `json:"deferred,omitempty"` // End of the quiet hours a deferred assignment waits for
+	Reason   string                 `json:"reason,omitempty"`   // Why the user was selected, e.g. "round_robin next"
+	Error    string                 `json:"error,omitempty"`    // Why the webhook failed
+	Trace    *runner.SelectionTrace `json:"trace,omitempty"`    // How the user was selected, or everyone ruled out, with explain=true
+}
+
+// Statuses reported in Response.Status.
+const (
+	StatusAssigned = "assigned"
+	StatusDeferred = "deferred"
+	StatusIgnored  = "ignored"
+	StatusError    = "error"
+)
+
+// readPayload reads the body of a webhook request, answering requests that
+// are not POSTs or too large. It reports false when a response was written.
+func readPayload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Error: "method not allowed"})
+		return nil, false
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayload))
+	if err != nil {
+		respond(w, http.StatusRequestEntityTooLarge, Response{Status: StatusError, Error: err.Error()})
+		return nil, false
+	}
+	return payload, true
+}
+
+// assignChange assigns a user other than its author to a change from the
+// group given in the request or routed to, fetching the changed files with
+// files when routes need them. kind is the identity kind of logins in the
+// integrated system. The response is complete unless its status is
+// StatusAssigned, in which case the caller writes the assignment back.
+func assignChange(ctx context.Context, r *http.Request, c vcs.Change, kind string, files vcs.FilesFunc) (Response, int) {
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		var ok bool
+		var err error
+		if group, ok, err = vcs.RouteChange(ctx, config.Settings.Routes, &c, files); err != nil {
+			tracing.Printf(ctx, "%v", err)
+			return Response{Status: StatusError, Error: err.Error()}, http.StatusBadGateway
+		}
+		if !ok {
+			return Response{Status: StatusIgnored}, http.StatusOK
+		}
+	}
+
+	author, err := vcs.AuthorUser(ctx, c, kind)
+	if err != nil {
+		tracing.Printf(ctx, "%v", err)
+		return Response{Status: StatusError, Group: group, Error: err.Error()}, http.StatusBadGateway
+	}
+	opts := requestOptions(r)
+	opts.Exclude = []string{author}
+	return assignFrom(ctx, group, c, opts)
+}
+
+// requestOptions returns the options of an assignment requested by a
+// webhook: the overrides of the group config given as query parameters,
+// require_all_checks=true for the pre-flight checks and explain=true for a
+// trace of the selection.
+func requestOptions(r *http.Request) runner.AssignOptions {
+	query := r.URL.Query()
+	return runner.AssignOptions{Strategy: query.Get("strategy"), Availability: query.Get("availability"), RequireAllChecks: query.Get("require_all_checks") == "true", Explain: query.Get("explain") == "true"}
+}
+
+// overrides returns the overrides of the group config of an assignment, as
+// recorded in the audit log; nil without any.
+func overrides(strategy, availability string) map[string]string {
+	var o map[string]string
+	for key, value := range map[string]string{"strategy": strategy, "availability": availability} {
+		if value != "" {
+			if o == nil {
+				o = map[string]string{}
+			}
+			o[key] = value
+		}
+	}
+	return o
+}
+
+// assignFrom assigns a user from group to item, such as a ticket. Like
+// assignChange, it leaves writing back assignments to the caller.
+func assignFrom(ctx context.Context, group string, item fmt.Stringer, opts runner.AssignOptions) (Response, int) {
+	if err := authorizeGroup(ctx, group); err != nil {
+		return Response{Status: StatusError, Group: group, Error: err.Error()}, http.StatusForbidden
+	}
+	result, err := runner.AssignUser(ctx, group, opts)
+	if err != nil {
+		tracing.Printf(ctx, "Failed to assign %s from %s: %v", item, group, err)
+		resp := Response{Status: StatusError, Group: group, Error: err.Error()}
+		var none *runner.NoAvailableAssigneeError
+		if errors.As(err, &none) {
+			resp.Trace = none.Trace
+		}
+		return resp, errorStatus(err)
+	}
+	if result.Deferred != "" {
+		return Response{Status: StatusDeferred, ID: result.ID, Group: group, Deferred: result.Deferred}, http.StatusAccepted
+	}
+	resp := Response{Status: StatusAssigned, ID: result.ID, Group: group, Assignee: result.User, Reason: result.Reason}
+	if opts.Explain {
+		resp.Trace = result.Trace
+	}
+	return resp, http.StatusOK
+}
+
+// errorStatus maps an assignment error to the HTTP status answering the webhook.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, runner.ErrInvalidGroup), errors.Is(err, runner.ErrAssignmentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, runner.ErrInvalidOption):
+		return http.StatusBadRequest
+	case errors.Is(err, runner.ErrNoAvailableAssignee), errors.Is(err, runner.ErrGroupDisabled):
+		return http.StatusConflict
+	case errors.Is(err, runner.ErrAvailability), errors.Is(err, runner.ErrCallback):
+		return http.StatusBadGateway
+	case errors.Is(err, runner.ErrLockTimeout), errors.Is(err, context.DeadlineExceeded), errors.Is(err, runner.ErrPreflight):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeBackFailed completes a response for an assignment that was made but
+// could not be written back to the integrated system.
+func writeBackFailed(w http.ResponseWriter, item fmt.Stringer, resp Response, err error) {
+	log.Printf("Assigned %s to %s but failed to update it: %v", resp.Assignee, item, err)
+	resp.Status = StatusError
+	resp.Error = err.Error()
+	respond(w, http.StatusBadGateway, resp)
+}
+
+// respond writes resp as the JSON body of a response with the given status.
+func respond(w http.ResponseWriter, status int, resp Response) {
+	recordAccess(w, func(entry *AccessEntry) {
+		if resp.Group != "" {
+			entry.Group = resp.Group
+		}
+		entry.Result, entry.ID, entry.Assignee, entry.Error = resp.Status, resp.ID, resp.Assignee, resp.Error
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
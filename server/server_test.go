@@ -0,0 +1,1923 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/history"
+	"autoassigner/runner"
+	"autoassigner/slack"
+	"autoassigner/testutil"
+	"autoassigner/tracing"
+	"autoassigner/vcs"
+	"autoassigner/version"
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBitbucketWebhook(t *testing.T) {
+	var reviewers []string
+	bitbucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"title": "Pull request", "reviewers": []}`))
+			return
+		}
+		var body struct {
+			Reviewers []struct {
+				AccountID string `json:"account_id"`
+			} `json:"reviewers"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, reviewer := range body.Reviewers {
+			reviewers = append(reviewers, r.URL.Path+" "+reviewer.AccountID)
+		}
+	}))
+	defer bitbucket.Close()
+
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{
+		Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		Routes:  []config.RouteConfig{{Repo: "acme/*", Group: "reviewers"}},
+		Bitbucket: config.BitbucketConfig{
+			ApiUrl:        bitbucket.URL,
+			WebhookSecret: "secret",
+		},
+		Identity: config.IdentityConfig{Users: map[string]map[string]string{"alice": {"bitbucket": "557058:a1"}}},
+	}
+	group := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "reviewers.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	tests := []struct {
+		url        string
+		secret     string
+		repo       string
+		wantStatus int
+		want       Response
+	}{
+		{server.URL + "/bitbucket", "secret", "acme/api", http.StatusOK, Response{Status: StatusAssigned, Group: "reviewers", Assignee: "alice", Login: "557058:a1", Reason: "round_robin next"}},
+		{server.URL + "/bitbucket", "secret", "other/api", http.StatusOK, Response{Status: StatusIgnored}},
+		{server.URL + "/bitbucket?group=reviewers", "secret", "other/api", http.StatusOK, Response{Status: StatusAssigned, Group: "reviewers", Assignee: "bob", Login: "bob", Reason: "round_robin next"}},
+		{server.URL + "/bitbucket?group=missing", "secret", "acme/api", http.StatusNotFound, Response{Status: StatusError, Group: "missing", Error: "group missing does not exist"}},
+		{server.URL + "/bitbucket", "wrong", "acme/api", http.StatusUnauthorized, Response{Status: StatusError, Error: "invalid signature"}},
+	}
+	for i, tt := range tests {
+		resp, err := testutil.SendBitbucketPullRequest(tt.url, tt.secret, tt.repo, i+1, "carol")
+		if err != nil {
+			t.Fatalf("#%d SendBitbucketPullRequest() error = %v", i, err)
+		}
+		var got Response
+		json.NewDecoder(resp.Body).Decode(&got)
+		got = withoutID(t, got)
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus || got != tt.want {
+			t.Errorf("#%d webhook = %d %+v, want %d %+v", i, resp.StatusCode, got, tt.wantStatus, tt.want)
+		}
+	}
+
+	want := []string{
+		"/repositories/acme/api/pullrequests/1 557058:a1",
+		"/repositories/other/api/pullrequests/3 bob",
+	}
+	if len(reviewers) != len(want) || reviewers[0] != want[0] || reviewers[1] != want[1] {
+		t.Errorf("reviewers added = %v, want %v", reviewers, want)
+	}
+}
+
+func TestGerritWebhook(t *testing.T) {
+	var added []string
+	gerrit := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.EscapedPath() == "/a/changes/platform%2Fapi~42/revisions/current/files" {
+			w.Write([]byte(")]}'\n" + `{"/COMMIT_MSG": {}, "api/user.go": {"lines_inserted": 3}}`))
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		added = append(added, r.URL.EscapedPath()+" "+body["reviewer"])
+		w.Write([]byte(")]}'\n{}"))
+	}))
+	defer gerrit.Close()
+
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{
+		Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		Routes: []config.RouteConfig{
+			{Repo: "platform/*", Paths: []string{"docs/**"}, Group: "docs"},
+			{Repo: "platform/*", Paths: []string{"api/**"}, Group: "platform"},
+		},
+		Gerrit: config.GerritConfig{Url: gerrit.URL},
+	}
+	group := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "platform.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	for i, patchSet := range []int{1, 2} {
+		event := fmt.Sprintf(`{"type": "patchset-created", "change": {"project": "platform/api", "number": 42}, "patchSet": {"number": %d}}`, patchSet)
+		resp, err := http.Post(server.URL+"/gerrit", "application/json", strings.NewReader(event))
+		if err != nil {
+			t.Fatalf("#%d POST /gerrit error = %v", i, err)
+		}
+		var got Response
+		json.NewDecoder(resp.Body).Decode(&got)
+		got = withoutID(t, got)
+		resp.Body.Close()
+		want := Response{Status: StatusIgnored}
+		if patchSet == 1 {
+			want = Response{Status: StatusAssigned, Group: "platform", Assignee: "alice", Login: "alice", Reason: "round_robin next"}
+		}
+		if resp.StatusCode != http.StatusOK || got != want {
+			t.Errorf("#%d POST /gerrit = %d %+v, want %+v", i, resp.StatusCode, got, want)
+		}
+	}
+	if len(added) != 1 || added[0] != "/a/changes/platform%2Fapi~42/reviewers alice" {
+		t.Errorf("reviewers added = %v, want alice on platform/api~42", added)
+	}
+}
+
+func TestServiceNowWebhook(t *testing.T) {
+	var updates []string
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		updates = append(updates, r.Method+" "+r.URL.Path+" "+body["assigned_to"])
+		w.Write([]byte(`{"result": {}}`))
+	}))
+	defer instance.Close()
+
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{
+		Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		ServiceNow: config.ServiceNowConfig{
+			InstanceUrl:  instance.URL,
+			WebhookToken: "s3cret",
+			Groups:       map[string]string{"Service Desk": "desk"},
+		},
+	}
+	group := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "desk.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	tests := []struct {
+		token      string
+		record     string
+		wantStatus int
+		want       Response
+	}{
+		{
+			token:      "s3cret",
+			record:     `{"sys_id": "abc", "number": "INC0010001", "assignment_group": {"value": "d625", "display_value": "Service Desk"}}`,
+			wantStatus: http.StatusOK,
+			want:       Response{Status: StatusAssigned, Group: "desk", Assignee: "alice", Login: "alice", Reason: "round_robin next"},
+		},
+		{
+			token:      "wrong",
+			record:     `{"sys_id": "abc", "assignment_group": {"value": "d625", "display_value": "Service Desk"}}`,
+			wantStatus: http.StatusUnauthorized,
+			want:       Response{Status: StatusError, Error: "invalid token"},
+		},
+		// Unmapped groups and assigned records are left alone
+		{
+			token:      "s3cret",
+			record:     `{"sys_id": "def", "assignment_group": "e317"}`,
+			wantStatus: http.StatusOK,
+			want:       Response{Status: StatusIgnored},
+		},
+		{
+			token:      "s3cret",
+			record:     `{"sys_id": "ghi", "assignment_group": "Service Desk", "assigned_to": "6816f79c"}`,
+			wantStatus: http.StatusOK,
+			want:       Response{Status: StatusIgnored},
+		},
+	}
+	for i, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/servicenow", strings.NewReader(tt.record))
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("#%d POST /servicenow error = %v", i, err)
+		}
+		var got Response
+		json.NewDecoder(resp.Body).Decode(&got)
+		got = withoutID(t, got)
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus || got != tt.want {
+			t.Errorf("#%d POST /servicenow = %d %+v, want %d %+v", i, resp.StatusCode, got, tt.wantStatus, tt.want)
+		}
+	}
+	if want := []string{"PATCH /api/now/table/incident/abc alice"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+}
+
+func TestZendeskWebhook(t *testing.T) {
+	var updates []string
+	zendeskAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			status := map[string]string{"/api/v2/agent_availabilities/1001": "Away", "/api/v2/agent_availabilities/1002": "Online"}[r.URL.Path]
+			fmt.Fprintf(w, `{"data": {"attributes": {"agent_status": {"name": %q}}}}`, status)
+			return
+		}
+		var body struct {
+			Ticket map[string]interface{} `json:"ticket"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		updates = append(updates, fmt.Sprintf("%s %s %v", r.Method, r.URL.Path, body.Ticket["assignee_id"]))
+		w.Write([]byte(`{"ticket": {}}`))
+	}))
+	defer zendeskAPI.Close()
+
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{
+		Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		Zendesk: config.ZendeskConfig{
+			Url:           zendeskAPI.URL,
+			WebhookSecret: "s3cret",
+			Groups:        map[string]string{"360001234567": "support"},
+		},
+		Identity: config.IdentityConfig{Users: map[string]map[string]string{
+			"alice": {"zendesk": "1001"},
+			"bob":   {"zendesk": "1002"},
+		}},
+	}
+	group := "strategy: round_robin\navailability_checker: zendesk\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	post := func(ticket string, signed bool) (int, Response) {
+		t.Helper()
+		timestamp := "2026-10-18T10:00:00Z"
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(timestamp + ticket))
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/zendesk", strings.NewReader(ticket))
+		req.Header.Set("X-Zendesk-Webhook-Signature-Timestamp", timestamp)
+		if signed {
+			req.Header.Set("X-Zendesk-Webhook-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /zendesk error = %v", err)
+		}
+		defer resp.Body.Close()
+		var got Response
+		json.NewDecoder(resp.Body).Decode(&got)
+		got = withoutID(t, got)
+		return resp.StatusCode, got
+	}
+
+	// alice is away, so bob is assigned
+	status, got := post(`{"ticket": {"id": "35436", "group_id": "360001234567", "assignee_id": ""}}`, true)
+	if want := (Response{Status: StatusAssigned, Group: "support", Assignee: "bob", Login: "1002", Reason: "fallback after 1 skip"}); status != http.StatusOK || got != want {
+		t.Errorf("POST /zendesk = %d %+v, want %+v", status, got, want)
+	}
+	if status, _ := post(`{"ticket": {"id": "35437", "group_id": "360001234567"}}`, false); status != http.StatusUnauthorized {
+		t.Errorf("POST /zendesk without signature = %d, want %d", status, http.StatusUnauthorized)
+	}
+	status, got = post(`{"ticket": {"id": "35438", "group_id": "360009999999"}}`, true)
+	if status != http.StatusOK || got.Status != StatusIgnored {
+		t.Errorf("POST /zendesk for an unmapped group = %d %+v, want ignored", status, got)
+	}
+	if want := []string{"PUT /api/v2/tickets/35436.json 1002"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+}
+
+func TestLinearWebhook(t *testing.T) {
+	var updates []string
+	linearAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]string `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		updates = append(updates, req.Variables["id"]+" "+req.Variables["assigneeId"])
+		w.Write([]byte(`{"data": {"issueUpdate": {"success": true}}}`))
+	}))
+	defer linearAPI.Close()
+
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{
+		Storage:  config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		Linear:   config.LinearConfig{ApiUrl: linearAPI.URL, Teams: map[string]string{"ENG": "engineers"}},
+		Identity: config.IdentityConfig{Users: map[string]map[string]string{"alice": {"linear": "a11ce"}}},
+	}
+	group := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "engineers.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	tests := []struct {
+		event string
+		want  Response
+	}{
+		{
+			event: `{"action": "create", "type": "Issue", "data": {"id": "9cfb482a", "identifier": "ENG-1", "team": {"key": "ENG"}}}`,
+			want:  Response{Status: StatusAssigned, Group: "engineers", Assignee: "alice", Login: "a11ce", Reason: "round_robin next"},
+		},
+		{event: `{"action": "create", "type": "Issue", "data": {"id": "7e1d", "identifier": "ENG-2", "team": {"key": "ENG"}, "assigneeId": "b0b"}}`, want: Response{Status: StatusIgnored}},
+		{event: `{"action": "create", "type": "Issue", "data": {"id": "3c4f", "identifier": "OPS-1", "team": {"key": "OPS"}}}`, want: Response{Status: StatusIgnored}},
+	}
+	for i, tt := range tests {
+		resp, err := http.Post(server.URL+"/linear", "application/json", strings.NewReader(tt.event))
+		if err != nil {
+			t.Fatalf("#%d POST /linear error = %v", i, err)
+		}
+		var got Response
+		json.NewDecoder(resp.Body).Decode(&got)
+		got = withoutID(t, got)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || got != tt.want {
+			t.Errorf("#%d POST /linear = %d %+v, want %+v", i, resp.StatusCode, got, tt.want)
+		}
+	}
+	if want := []string{"9cfb482a a11ce"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+
+	// An unknown strategy override is rejected before anyone is assigned
+	event := `{"action": "create", "type": "Issue", "data": {"id": "5a6b", "identifier": "ENG-3", "team": {"key": "ENG"}}}`
+	resp, err := http.Post(server.URL+"/linear?strategy=coin_flip", "application/json", strings.NewReader(event))
+	if err != nil {
+		t.Fatalf("POST /linear error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || len(updates) != 1 {
+		t.Errorf("POST /linear?strategy=coin_flip = %d with updates %v, want 400 without an update", resp.StatusCode, updates)
+	}
+}
+
+func TestAsanaWebhook(t *testing.T) {
+	var updates []string
+	asanaAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			assignee := "null"
+			if r.URL.Path == "/tasks/222" {
+				assignee = `{"gid": "1200"}`
+			}
+			fmt.Fprintf(w, `{"data": {"gid": %q, "assignee": %s}}`, strings.TrimPrefix(r.URL.Path, "/tasks/"), assignee)
+			return
+		}
+		var body struct {
+			Data map[string]string `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		updates = append(updates, r.URL.Path+" "+body.Data["assignee"])
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer asanaAPI.Close()
+
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{
+		Storage:  config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		Asana:    config.AsanaConfig{ApiUrl: asanaAPI.URL, Projects: map[string]string{"900": "support"}},
+		Identity: config.IdentityConfig{Users: map[string]map[string]string{"alice": {"email": "alice@example.com"}}},
+	}
+	group := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	post := func(body, header, value string) (*http.Response, Response) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/asana", strings.NewReader(body))
+		req.Header.Set(header, value)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /asana error = %v", err)
+		}
+		defer resp.Body.Close()
+		var got Response
+		json.NewDecoder(resp.Body).Decode(&got)
+		got = withoutID(t, got)
+		return resp, got
+	}
+
+	// The handshake secret is echoed and then verifies events
+	if resp, _ := post("", "X-Hook-Secret", "hs3cret"); resp.StatusCode != http.StatusOK || resp.Header.Get("X-Hook-Secret") != "hs3cret" {
+		t.Fatalf("handshake = %d with secret %q, want 200 echoing the secret", resp.StatusCode, resp.Header.Get("X-Hook-Secret"))
+	}
+	events := `{"events": [
+		{"action": "added", "resource": {"gid": "111", "resource_type": "task"}, "parent": {"gid": "900", "resource_type": "project"}},
+		{"action": "added", "resource": {"gid": "222", "resource_type": "task"}, "parent": {"gid": "900", "resource_type": "project"}},
+		{"action": "added", "resource": {"gid": "333", "resource_type": "task"}, "parent": {"gid": "901", "resource_type": "project"}}
+	]}`
+	if resp, _ := post(events, "X-Hook-Signature", "invalid"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("POST /asana with an invalid signature = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	mac := hmac.New(sha256.New, []byte("hs3cret"))
+	mac.Write([]byte(events))
+	resp, got := post(events, "X-Hook-Signature", hex.EncodeToString(mac.Sum(nil)))
+	if want := (Response{Status: StatusAssigned, Group: "support", Assignee: "alice", Login: "alice@example.com", Reason: "round_robin next"}); resp.StatusCode != http.StatusOK || got != want {
+		t.Errorf("POST /asana = %d %+v, want %+v", resp.StatusCode, got, want)
+	}
+	// Only the unassigned task of the mapped project is assigned
+	if want := []string{"/tasks/111 alice@example.com"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+}
+
+// withoutID checks that assigned responses carry the assignment ID and
+// clears it, so responses can be compared with the expected ones.
+func withoutID(t *testing.T, resp Response) Response {
+	t.Helper()
+	if resp.Status == StatusAssigned && resp.ID == "" {
+		t.Errorf("assigned response %+v has no assignment ID", resp)
+	}
+	resp.ID = ""
+	return resp
+}
+
+func TestState(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+	groups := map[string]string{
+		"support": "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob, bot]\nnever_available: [bot]\n",
+		"broken":  "strategy: [\n",
+	}
+	for name, data := range groups {
+		if err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write group: %v", err)
+		}
+	}
+	if _, err := runner.AssignUser(context.Background(), "support", runner.AssignOptions{}); err != nil {
+		t.Fatalf("AssignUser() error = %v", err)
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	get := func(query string) (int, StateResponse) {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/state" + query)
+		if err != nil {
+			t.Fatalf("GET /state error = %v", err)
+		}
+		defer resp.Body.Close()
+		var got StateResponse
+		json.NewDecoder(resp.Body).Decode(&got)
+		return resp.StatusCode, got
+	}
+
+	status, got := get("")
+	if status != http.StatusOK || len(got.Groups) != 2 {
+		t.Fatalf("GET /state = %d %+v, want both groups", status, got)
+	}
+	if broken := got.Groups[0]; broken.Group != "broken" || broken.Error == "" {
+		t.Errorf("state of broken = %+v, want an error", broken)
+	}
+	support := got.Groups[1]
+	if support.LastIndex != 0 || support.LastAssignment == nil || support.LastAssignment.User != "alice" ||
+		!reflect.DeepEqual(support.Counts, map[string]int{"alice": 1, "bob": 0, "bot": 0}) ||
+		!reflect.DeepEqual(support.Paused, []string{"bot"}) || support.Locked {
+		t.Errorf("state of support = %+v", support)
+	}
+
+	if status, got := get("?group=support"); status != http.StatusOK || len(got.Groups) != 1 || got.Groups[0].Group != "support" {
+		t.Errorf("GET /state?group=support = %d %+v, want only support", status, got)
+	}
+	if status, _ := get("?group=missing"); status != http.StatusNotFound {
+		t.Errorf("GET /state?group=missing = %d, want %d", status, http.StatusNotFound)
+	}
+	resp, err := http.Post(server.URL+"/state", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /state error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /state = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz error = %v", err)
+	}
+	var got HealthResponse
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || got.Status != "ok" || got.Role != runner.RoleStandalone || got.Replica == "" || got.Leader != "" {
+		t.Errorf("GET /healthz = %d %+v, want ok from a standalone replica", resp.StatusCode, got)
+	}
+
+	resp, err = http.Post(server.URL+"/healthz", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /healthz error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /healthz status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/version")
+	if err != nil {
+		t.Fatalf("GET /version error = %v", err)
+	}
+	var got version.Info
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || got.Version != version.Version || got.GoVersion == "" || len(got.Backends["strategies"]) == 0 {
+		t.Errorf("GET /version = %d %+v, want the build information with backends", resp.StatusCode, got)
+	}
+
+	resp, err = http.Post(server.URL+"/version", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /version error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /version status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestProtect(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+	for _, name := range []string{"support", "ops"} {
+		data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+		if err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write group: %v", err)
+		}
+	}
+
+	authorizer := TokenAuthorizer{Tokens: map[string]string{"ci": "ci-token", "admin": "admin-token"}}
+	policies := Policies{
+		{Routes: []string{"/state"}, Groups: []string{"supp*"}, Principals: []string{"ci"}},
+		{Principals: []string{"admin"}},
+		{Routes: []string{"/bitbucket"}, Principals: []string{Anonymous}},
+	}
+	server := httptest.NewServer(Protect(Handler(), authorizer, policies))
+	defer server.Close()
+	call := func(method, path, token string) (int, StateResponse) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader("{}"))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s error = %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var got StateResponse
+		json.NewDecoder(resp.Body).Decode(&got)
+		return resp.StatusCode, got
+	}
+	groups := func(got StateResponse) []string {
+		var names []string
+		for _, state := range got.Groups {
+			names = append(names, state.Group)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+		wantGroups []string
+	}{
+		{"no token", http.MethodGet, "/state", "", http.StatusUnauthorized, nil},
+		{"unknown token", http.MethodGet, "/state", "other", http.StatusUnauthorized, nil},
+		{"ci sees its groups", http.MethodGet, "/state", "ci-token", http.StatusOK, []string{"support"}},
+		{"ci reads its group", http.MethodGet, "/state?group=support", "ci-token", http.StatusOK, []string{"support"}},
+		{"ci reads another group", http.MethodGet, "/state?group=ops", "ci-token", http.StatusForbidden, nil},
+		{"ci calls another route", http.MethodPost, "/gerrit", "ci-token", http.StatusForbidden, nil},
+		{"admin sees every group", http.MethodGet, "/state", "admin-token", http.StatusOK, []string{"ops", "support"}},
+		{"anonymous webhook", http.MethodPost, "/bitbucket?group=ops", "", http.StatusOK, nil},
+		{"webhook with unknown token", http.MethodPost, "/bitbucket?group=ops", "other", http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, got := call(tt.method, tt.path, tt.token)
+			if status != tt.wantStatus || !reflect.DeepEqual(groups(got), tt.wantGroups) {
+				t.Errorf("%s %s = %d %v, want %d %v", tt.method, tt.path, status, groups(got), tt.wantStatus, tt.wantGroups)
+			}
+		})
+	}
+
+	// Groups are checked once the handler knows them
+	policies = Policies{{Groups: []string{"support"}, Principals: []string{"ci"}}}
+	resp, code := assignFrom(contextWithAuth("ci", policies), "ops", vcs.Change{}, runner.AssignOptions{DryRun: true})
+	if code != http.StatusForbidden || resp.Status != StatusError {
+		t.Errorf("assignFrom(ops) = %+v, %d, want %d", resp, code, http.StatusForbidden)
+	}
+}
+
+// contextWithAuth returns a context carrying the authorization of a request by principal.
+func contextWithAuth(principal string, policies Policies) context.Context {
+	return context.WithValue(context.Background(), authContextKey{}, &authorization{principal: &Principal{Name: principal}, policies: policies, route: "/gerrit"})
+}
+
+func TestMTLSAuthorizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		want    string
+		wantErr bool
+	}{
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "deploy-bot"}, DNSNames: []string{"bot.example.com"}}, "deploy-bot", false},
+		{"DNS name", &x509.Certificate{DNSNames: []string{"bot.example.com"}}, "bot.example.com", false},
+		{"no name", &x509.Certificate{}, "", true},
+		{"no certificate", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/state", nil)
+			r.TLS = &tls.ConnectionState{}
+			if tt.cert != nil {
+				r.TLS.VerifiedChains = [][]*x509.Certificate{{tt.cert}}
+			}
+			principal, err := MTLSAuthorizer{}.Authorize(r)
+			if (err != nil) != tt.wantErr || (err == nil && principal.Name != tt.want) {
+				t.Errorf("Authorize() = %+v, %v, want %q", principal, err, tt.want)
+			}
+			if err != nil && !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("Authorize() error = %v, want ErrUnauthenticated", err)
+			}
+		})
+	}
+}
+
+func TestOIDCAuthorizer(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	keys := []map[string]string{{"kid": "rsa-1", "kty": "RSA", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())}}
+	var fetches int
+	var provider *httptest.Server
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": provider.URL, "jwks_uri": provider.URL + "/keys"})
+		case "/keys":
+			fetches++
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer provider.Close()
+
+	now := time.Now()
+	sign := func(alg, kid string, claims map[string]interface{}) string {
+		header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+		payload, _ := json.Marshal(claims)
+		input := b64(header) + "." + b64(payload)
+		digest := sha256.Sum256([]byte(input))
+		var signature []byte
+		if alg == "RS256" {
+			signature, _ = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		} else {
+			r, s, _ := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+		return input + "." + b64(signature)
+	}
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": provider.URL, "aud": []string{"autoassigner"}, "sub": "u-1", "email": "alice@example.com", "exp": now.Add(time.Hour).Unix()}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	authorizer := NewOIDCAuthorizer(config.OIDCConfig{Issuer: provider.URL, Audience: "autoassigner", Claim: "email"})
+	authorize := func(token string) (*Principal, error) {
+		r := httptest.NewRequest(http.MethodGet, "/state", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return authorizer.Authorize(r)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"valid", sign("RS256", "rsa-1", claims(nil)), "alice@example.com"},
+		{"expired", sign("RS256", "rsa-1", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})), ""},
+		{"other audience", sign("RS256", "rsa-1", claims(map[string]interface{}{"aud": "other"})), ""},
+		{"other issuer", sign("RS256", "rsa-1", claims(map[string]interface{}{"iss": "https://evil.example.com"})), ""},
+		{"tampered", sign("RS256", "rsa-1", claims(nil))[:20] + "x" + sign("RS256", "rsa-1", claims(nil))[21:], ""},
+		{"algorithm mismatch", sign("ES256", "rsa-1", claims(nil)), ""},
+		{"missing claim", sign("RS256", "rsa-1", claims(map[string]interface{}{"email": ""})), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := authorize(tt.token)
+			if tt.want == "" {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("Authorize() = %+v, %v, want ErrUnauthenticated", principal, err)
+				}
+				return
+			}
+			if err != nil || principal.Name != tt.want || principal.Method != config.AuthOIDC {
+				t.Errorf("Authorize() = %+v, %v, want %s", principal, err, tt.want)
+			}
+		})
+	}
+
+	// A key added by the provider is fetched once its kid shows up, at most once a minute
+	keys = append(keys, map[string]string{"kid": "ec-1", "kty": "EC", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))})
+	if _, err := authorize(sign("ES256", "ec-1", claims(nil))); !errors.Is(err, ErrUnauthenticated) || fetches != 1 {
+		t.Errorf("Authorize() with a new key within a minute = %v after %d fetches, want ErrUnauthenticated after 1", err, fetches)
+	}
+	authorizer.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if principal, err := authorize(sign("ES256", "ec-1", claims(nil))); err != nil || principal.Name != "alice@example.com" || fetches != 2 {
+		t.Errorf("Authorize() with a new key = %+v, %v after %d fetches, want alice after 2", principal, err, fetches)
+	}
+}
+
+// recordingSink is an AuditSink keeping the entries it receives.
+type recordingSink struct {
+	entries []AccessEntry
+}
+
+func (s *recordingSink) Record(ctx context.Context, entry AccessEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+	data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	start := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	calls := 0
+	savedNow := timeNow
+	defer func() { timeNow = savedNow }()
+	timeNow = func() time.Time {
+		calls++
+		return start.Add(time.Duration(calls) * 1500 * time.Microsecond)
+	}
+
+	var posted []AccessEntry
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entry AccessEntry
+		if r.Header.Get("Authorization") != "Bearer audit" || json.NewDecoder(r.Body).Decode(&entry) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		posted = append(posted, entry)
+	}))
+	defer collector.Close()
+	syslogServer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer syslogServer.Close()
+
+	recorder := &recordingSink{}
+	var sinks []AuditSink
+	for _, conf := range []config.AuditSinkConfig{
+		{Type: config.AuditFile, Path: filepath.Join(dir, "audit.log")},
+		{Type: config.AuditHTTP, URL: collector.URL, Headers: map[string]string{"Authorization": "Bearer audit"}},
+		{Type: config.AuditSyslog, Address: syslogServer.LocalAddr().String()},
+	} {
+		sink, err := NewAuditSink(conf)
+		if err != nil {
+			t.Fatalf("NewAuditSink(%s) error = %v", conf.Type, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	sinks = append(sinks, recorder)
+
+	policies := Policies{{Routes: []string{"/state"}, Groups: []string{"support"}, Principals: []string{"ci"}}}
+	protected := Audit(Protect(Handler(), TokenAuthorizer{Tokens: map[string]string{"ci": "ci-token"}}, policies), sinks...)
+	assigned := Audit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, Response{Status: StatusAssigned, ID: "01HXW3", Group: "support", Assignee: "alice"})
+	}), sinks...)
+	requests := []struct {
+		handler http.Handler
+		method  string
+		path    string
+		token   string
+	}{
+		{protected, http.MethodGet, "/state", ""},
+		{protected, http.MethodGet, "/state?group=support", "ci-token"},
+		{protected, http.MethodGet, "/state?group=ops", "ci-token"},
+		{assigned, http.MethodPost, "/zendesk?availability=always_available", ""},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.path, nil)
+		if req.token != "" {
+			r.Header.Set("Authorization", "Bearer "+req.token)
+		}
+		req.handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	entry := func(method, path, group, actor string, status int, result string) AccessEntry {
+		return AccessEntry{Method: method, Path: path, Group: group, Actor: actor, Remote: "192.0.2.1:1234", Status: status, Result: result, LatencyMS: 1.5}
+	}
+	want := []AccessEntry{
+		entry(http.MethodGet, "/state", "", "", http.StatusUnauthorized, StatusError),
+		entry(http.MethodGet, "/state", "support", "ci", http.StatusOK, "ok"),
+		entry(http.MethodGet, "/state", "ops", "ci", http.StatusForbidden, StatusError),
+		entry(http.MethodPost, "/zendesk", "support", "", http.StatusOK, StatusAssigned),
+	}
+	want[0].Error = ErrUnauthenticated.Error()
+	want[2].Error = "forbidden: ci may not use group ops"
+	want[3].ID, want[3].Assignee = "01HXW3", "alice"
+	want[3].Overrides = map[string]string{"availability": "always_available"}
+	got := recorder.entries
+	for i := range got {
+		if got[i].Time.IsZero() {
+			t.Errorf("entry %d has no time", i)
+		}
+		got[i].Time = time.Time{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries =\n%+v\nwant\n%+v", got, want)
+	}
+
+	lines, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil || strings.Count(string(lines), "\n") != len(want) {
+		t.Errorf("audit.log = %q, %v, want %d lines", lines, err, len(want))
+	}
+	if len(posted) != len(want) || posted[1].Actor != "ci" {
+		t.Errorf("posted entries = %+v, want %d", posted, len(want))
+	}
+	buf := make([]byte, 4096)
+	syslogServer.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := syslogServer.ReadFrom(buf)
+	if err != nil || !strings.HasPrefix(string(buf[:n]), "<109>1 ") || !strings.Contains(string(buf[:n]), ` autoassigner `) || !strings.HasSuffix(string(buf[:n]), `"latency_ms":1.5}`) {
+		t.Errorf("syslog message = %q, %v, want a notice of the rejected request", buf[:n], err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var forwarded []string
+	zendeskAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Header.Get(tracing.HeaderRequestID)+" "+r.Header.Get(tracing.HeaderTraceParent))
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"data": {"attributes": {"agent_status": {"name": "Online"}}}}`)
+			return
+		}
+		w.Write([]byte(`{"ticket": {}}`))
+	}))
+	defer zendeskAPI.Close()
+	savedTransport := http.DefaultClient.Transport
+	defer func() { http.DefaultClient.Transport = savedTransport }()
+	tracing.Install()
+
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{
+		Storage:  config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		Zendesk:  config.ZendeskConfig{Url: zendeskAPI.URL, Groups: map[string]string{"360001234567": "support"}},
+		Identity: config.IdentityConfig{Users: map[string]map[string]string{"alice": {"zendesk": "1001"}}},
+	}
+	group := "strategy: round_robin\navailability_checker: zendesk\nusers: [alice]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	recorder := &recordingSink{}
+	server := httptest.NewServer(Trace(Audit(Handler(), recorder)))
+	defer server.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0736"
+	tests := []struct {
+		name        string
+		requestID   string
+		traceParent string
+		wantRequest string // Request ID that is passed on, or empty for a generated one
+		wantTrace   string // Trace ID that is passed on, or empty for a generated one
+		wantFlags   string
+	}{
+		{"both", "delivery-1", "00-" + traceID + "aa-00f067aa0ba902b7-01", "delivery-1", traceID + "aa", "01"},
+		{"request ID only", "delivery-2", "", "delivery-2", "", "00"},
+		{"trace only", "", "00-" + traceID + "bb-00f067aa0ba902b7-00", traceID + "bb", traceID + "bb", "00"},
+		{"invalid", "bad id", "00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01", "", "", "00"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded, recorder.entries = nil, nil
+			ticket := fmt.Sprintf(`{"ticket": {"id": "%d", "group_id": "360001234567"}}`, 35000+i)
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/zendesk", strings.NewReader(ticket))
+			if tt.requestID != "" {
+				req.Header.Set(tracing.HeaderRequestID, tt.requestID)
+			}
+			if tt.traceParent != "" {
+				req.Header.Set(tracing.HeaderTraceParent, tt.traceParent)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("POST /zendesk error = %v", err)
+			}
+			resp.Body.Close()
+			requestID := resp.Header.Get(tracing.HeaderRequestID)
+			if resp.StatusCode != http.StatusOK || requestID == "" || (tt.wantRequest != "" && requestID != tt.wantRequest) {
+				t.Fatalf("POST /zendesk = %d with request ID %q, want 200 with %q", resp.StatusCode, requestID, tt.wantRequest)
+			}
+
+			if len(recorder.entries) != 1 || recorder.entries[0].RequestID != requestID || len(recorder.entries[0].TraceID) != 32 {
+				t.Fatalf("access entries = %+v, want one with request ID %s", recorder.entries, requestID)
+			}
+			trace := recorder.entries[0].TraceID
+			if tt.wantTrace != "" && trace != tt.wantTrace {
+				t.Errorf("trace ID = %s, want %s", trace, tt.wantTrace)
+			}
+			if tt.wantRequest == "" && requestID != trace {
+				t.Errorf("request ID = %s, want the trace ID %s", requestID, trace)
+			}
+			if len(forwarded) != 2 {
+				t.Fatalf("Zendesk requests = %q, want the availability check and the ticket update", forwarded)
+			}
+			for _, got := range forwarded {
+				if !strings.HasPrefix(got, requestID+" 00-"+trace+"-") || !strings.HasSuffix(got, "-"+tt.wantFlags) || strings.Contains(got, "00f067aa0ba902b7") {
+					t.Errorf("Zendesk request headers = %q, want request ID %s and a new span of trace %s", got, requestID, trace)
+				}
+			}
+
+			q, err := history.ParseQuery("metadata.request_id="+requestID, time.Now())
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			records, err := runner.QueryHistory(context.Background(), q, runner.QueryOptions{})
+			if err != nil || len(records) != 1 || records[0].Metadata["trace_id"] != trace {
+				t.Errorf("assignments of request %s = %+v, %v, want one with trace %s", requestID, records, err, trace)
+			}
+		})
+	}
+}
+
+func TestGroupStats(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+	data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	os.MkdirAll(filepath.Join(dir, "platform"), 0755)
+	if err := os.WriteFile(filepath.Join(dir, "platform", "oncall.yaml"), []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	record := fmt.Sprintf(`{"schema_version":4,"id":"a1","timestamp":%q,"user":"bob","availability_check_ms":12}`+"\n", time.Now().Add(-time.Hour).Format(time.RFC3339))
+	for _, groupDir := range []string{filepath.Join(dir, "data", "support"), filepath.Join(dir, "data", "platform", "oncall")} {
+		os.MkdirAll(groupDir, 0755)
+		if err := os.WriteFile(filepath.Join(groupDir, "assignments.log"), []byte(record), 0644); err != nil {
+			t.Fatalf("failed to write log: %v", err)
+		}
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantWindow string
+	}{
+		{"default window", "/groups/support/stats", http.StatusOK, "30d"},
+		{"window", "/groups/support/stats?window=2h", http.StatusOK, "2h"},
+		{"invalid window", "/groups/support/stats?window=forever", http.StatusBadRequest, ""},
+		{"unknown group", "/groups/missing/stats", http.StatusNotFound, ""},
+		{"unknown route", "/groups/support/counts", http.StatusNotFound, ""},
+		{"group in a subdirectory", "/groups/platform/oncall/stats?window=1d", http.StatusOK, "1d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatalf("GET %s error = %v", tt.path, err)
+			}
+			defer resp.Body.Close()
+			var got runner.WindowStats
+			json.NewDecoder(resp.Body).Decode(&got)
+			if resp.StatusCode != tt.wantStatus || got.Window != tt.wantWindow {
+				t.Errorf("GET %s = %d %+v, want %d with window %q", tt.path, resp.StatusCode, got, tt.wantStatus, tt.wantWindow)
+			}
+			if tt.wantStatus == http.StatusOK && (got.Assignments != 1 || len(got.Users) != 2 || got.Users[1].Share != 1 || got.P95LatencyMs != 12) {
+				t.Errorf("GET %s = %+v, want bob's assignment", tt.path, got)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+	data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\ntrack_open: true\n"
+	for _, group := range []string{"support", "billing"} {
+		if err := os.WriteFile(filepath.Join(dir, group+".yaml"), []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write group: %v", err)
+		}
+	}
+	groupDir := filepath.Join(dir, "data", "support")
+	os.MkdirAll(groupDir, 0755)
+	durations := `{"id":"a1","user":"alice","event":"acknowledged","seconds":120}
+{"id":"a1","user":"alice","event":"closed","seconds":3000}
+{"id":"a2","user":"bob","event":"closed","seconds":30}
+`
+	open := fmt.Sprintf(`[{"id":"a3","user":"bob","assigned_at":%q}]`, time.Now().Add(-2*time.Hour).Format(time.RFC3339))
+	os.WriteFile(filepath.Join(groupDir, "durations.log"), []byte(durations), 0644)
+	os.WriteFile(filepath.Join(groupDir, "open.json"), []byte(open), 0644)
+
+	// Callers only see the groups they may use
+	policies := Policies{{Routes: []string{"/metrics"}, Groups: []string{"support"}, Principals: []string{Anonymous}}}
+	server := httptest.NewServer(Protect(Handler(), AllowAll{}, policies))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		"# TYPE autoassigner_time_to_ack_seconds histogram\n",
+		`autoassigner_time_to_ack_seconds_bucket{group="support",le="60"} 0` + "\n",
+		`autoassigner_time_to_ack_seconds_bucket{group="support",le="300"} 1` + "\n",
+		`autoassigner_time_to_close_seconds_bucket{group="support",le="60"} 1` + "\n",
+		`autoassigner_time_to_close_seconds_bucket{group="support",le="3600"} 2` + "\n",
+		`autoassigner_time_to_close_seconds_bucket{group="support",le="+Inf"} 2` + "\n",
+		`autoassigner_time_to_close_seconds_sum{group="support"} 3030` + "\n",
+		`autoassigner_time_to_close_seconds_count{group="support"} 2` + "\n",
+		`autoassigner_open_assignments{group="support",user="bob"} 1` + "\n",
+		`autoassigner_oldest_open_assignment_age_seconds{group="support",user="bob"} 7`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("GET /metrics = %s, want %q", body, want)
+		}
+	}
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(body), "billing") {
+		t.Errorf("GET /metrics = %d, want 200 without billing", resp.StatusCode)
+	}
+}
+
+func TestGroupUpdates(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+
+	recorder := &recordingSink{}
+	server := httptest.NewServer(Audit(Handler(), recorder))
+	defer server.Close()
+	valid := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		want       GroupResponse
+	}{
+		{"create", http.MethodPut, "/groups/support", valid, http.StatusCreated, GroupResponse{Status: StatusCreated, Group: "support"}},
+		{"replace", http.MethodPut, "/groups/support", valid, http.StatusOK, GroupResponse{Status: StatusUpdated, Group: "support"}},
+		{"invalid config", http.MethodPut, "/groups/support", "strategy: fastest\nusers: [alice]\n", http.StatusUnprocessableEntity, GroupResponse{}},
+		{"add and remove", http.MethodPatch, "/groups/support/users", `{"add": ["carol"], "remove": ["bob"]}`, http.StatusOK,
+			GroupResponse{Status: StatusUpdated, Group: "support", Users: []string{"alice", "carol"}, Added: []string{"carol"}, Removed: []string{"bob"}}},
+		{"remove everyone", http.MethodPatch, "/groups/support/users", `{"remove": ["alice", "carol"]}`, http.StatusUnprocessableEntity, GroupResponse{}},
+		{"empty request", http.MethodPatch, "/groups/support/users", `{}`, http.StatusBadRequest, GroupResponse{}},
+		{"unknown field", http.MethodPatch, "/groups/support/users", `{"users": ["dave"]}`, http.StatusBadRequest, GroupResponse{}},
+		{"unknown group", http.MethodPatch, "/groups/missing/users", `{"add": ["dave"]}`, http.StatusNotFound, GroupResponse{}},
+		{"wrong method", http.MethodGet, "/groups/support", "", http.StatusMethodNotAllowed, GroupResponse{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s error = %v", tt.method, tt.path, err)
+			}
+			defer resp.Body.Close()
+			var got GroupResponse
+			json.NewDecoder(resp.Body).Decode(&got)
+			if resp.StatusCode != tt.wantStatus || tt.wantStatus < 300 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s %s = %d %+v, want %d %+v", tt.method, tt.path, resp.StatusCode, got, tt.wantStatus, tt.want)
+			}
+		})
+	}
+
+	// Changes of users are audited
+	entry := recorder.entries[3]
+	if entry.Group != "support" || entry.Result != StatusUpdated || !reflect.DeepEqual(entry.Added, []string{"carol"}) || !reflect.DeepEqual(entry.Removed, []string{"bob"}) {
+		t.Errorf("audit entry of PATCH = %+v, want carol added and bob removed", entry)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "support.yaml"))
+	if want := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, carol]\n"; string(data) != want {
+		t.Errorf("config = %q, want %q", data, want)
+	}
+}
+
+func TestOpenAssignmentRoutes(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+	if err := os.MkdirAll(filepath.Join(dir, "platform"), 0755); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	data := "strategy: round_robin\navailability_checker: always_available\ntrack_open: true\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "platform", "oncall.yaml"), []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	for _, id := range []string{"T-1", "T-2"} {
+		if _, err := runner.AssignUser(context.Background(), "platform/oncall", runner.AssignOptions{ID: id, Silent: true}); err != nil {
+			t.Fatalf("AssignUser() error = %v", err)
+		}
+	}
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		want       Response
+	}{
+		{"ack", http.MethodPost, "/groups/platform/oncall/assignments/T-1/ack", http.StatusOK, Response{Status: StatusAcknowledged, ID: "T-1", Group: "platform/oncall", Assignee: "alice"}},
+		{"ack again", http.MethodPost, "/groups/platform/oncall/assignments/T-1/ack", http.StatusOK, Response{Status: StatusAcknowledged, ID: "T-1", Group: "platform/oncall", Assignee: "alice"}},
+		{"close", http.MethodPost, "/groups/platform/oncall/assignments/T-2/close", http.StatusOK, Response{Status: StatusClosed, ID: "T-2", Group: "platform/oncall", Assignee: "bob"}},
+		{"close again", http.MethodPost, "/groups/platform/oncall/assignments/T-2/close", http.StatusNotFound, Response{}},
+		{"unknown assignment", http.MethodPost, "/groups/platform/oncall/assignments/T-3/ack", http.StatusNotFound, Response{}},
+		{"unknown group", http.MethodPost, "/groups/missing/assignments/T-1/ack", http.StatusNotFound, Response{}},
+		{"wrong method", http.MethodGet, "/groups/platform/oncall/assignments/T-1/ack", http.StatusMethodNotAllowed, Response{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL+tt.path, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s error = %v", tt.method, tt.path, err)
+			}
+			defer resp.Body.Close()
+			var got Response
+			json.NewDecoder(resp.Body).Decode(&got)
+			if resp.StatusCode != tt.wantStatus || tt.wantStatus < 300 && got != tt.want {
+				t.Errorf("%s %s = %d %+v, want %d %+v", tt.method, tt.path, resp.StatusCode, got, tt.wantStatus, tt.want)
+			}
+		})
+	}
+
+	open, err := runner.OpenAssignments("platform/oncall")
+	if err != nil || len(open) != 1 || open[0].ID != "T-1" || !open[0].Acknowledged() {
+		t.Errorf("OpenAssignments() = %+v, %v, want T-1 acknowledged", open, err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	logs := map[string]string{
+		"support": `{"schema_version":4,"id":"s1","timestamp":"2020-01-01T09:00:00Z","group":"support","user":"alice"}
+{"schema_version":4,"id":"s2","timestamp":"` + recent + `","group":"support","user":"alice"}
+{"schema_version":4,"id":"s3","timestamp":"` + recent + `","group":"support","user":"bob"}
+`,
+		"ops": `{"schema_version":4,"id":"o1","timestamp":"` + recent + `","group":"ops","user":"alice"}
+`,
+	}
+	for group, log := range logs {
+		data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+		if err := os.WriteFile(filepath.Join(dir, group+".yaml"), []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write group: %v", err)
+		}
+		os.MkdirAll(filepath.Join(dir, "data", group), 0755)
+		if err := os.WriteFile(filepath.Join(dir, "data", group, "assignments.log"), []byte(log), 0644); err != nil {
+			t.Fatalf("failed to write log: %v", err)
+		}
+	}
+
+	policies := Policies{{Groups: []string{"support"}, Principals: []string{"ci"}}}
+	server := httptest.NewServer(Protect(Handler(), TokenAuthorizer{Tokens: map[string]string{"ci": "ci-token", "admin": "admin-token"}}, append(policies, config.PolicyConfig{Principals: []string{"admin"}})))
+	defer server.Close()
+	tests := []struct {
+		name       string
+		query      string
+		token      string
+		wantStatus int
+		want       []string
+	}{
+		{"field parameters", "?user=alice&since=90d", "admin-token", http.StatusOK, []string{"o1", "s2"}},
+		{"query", "?q=" + url.QueryEscape("user=alice AND since=90d AND group=support"), "admin-token", http.StatusOK, []string{"s2"}},
+		{"limit", "?group=support&limit=1", "admin-token", http.StatusOK, []string{"s3"}},
+		{"allowed groups only", "?user=alice", "ci-token", http.StatusOK, []string{"s1", "s2"}},
+		{"forbidden group", "?group=ops", "ci-token", http.StatusForbidden, nil},
+		{"unknown group", "?group=missing", "admin-token", http.StatusNotFound, nil},
+		{"unknown field", "?name=alice", "admin-token", http.StatusBadRequest, nil},
+		{"invalid limit", "?limit=all", "admin-token", http.StatusBadRequest, nil},
+		{"no matches", "?user=carol", "admin-token", http.StatusOK, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/history"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET /history%s error = %v", tt.query, err)
+			}
+			defer resp.Body.Close()
+			var body HistoryResponse
+			json.NewDecoder(resp.Body).Decode(&body)
+			var got []string
+			if body.Records != nil {
+				got = []string{}
+			}
+			for _, r := range body.Records {
+				got = append(got, r.ID)
+			}
+			if resp.StatusCode != tt.wantStatus || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GET /history%s = %d %v, want %d %v", tt.query, resp.StatusCode, got, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsume(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	request := func(offset int64, value string) map[string]interface{} {
+		return map[string]interface{}{"topic": "requests", "partition": 0, "offset": offset, "key": nil, "value": base64.StdEncoding.EncodeToString([]byte(value))}
+	}
+
+	t.Run("kafka", func(t *testing.T) {
+		config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "kafka"), ConfDir: config.DirList{dir}}}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		polls := [][]map[string]interface{}{
+			{
+				request(0, `{"group": "support", "metadata": {"ticket": "T-1"}}`),
+				request(1, `{"id": "req-2", "group": "support"}`),
+				request(2, `not json`),
+				request(3, `{"group": "missing"}`),
+			},
+			// Delivered again, such as after a rebalance
+			{request(0, `{"group": "support", "metadata": {"ticket": "T-1"}}`)},
+		}
+		var mu sync.Mutex
+		var results []AssignmentResult
+		var committed []int64
+		var deleted bool
+		var proxy *httptest.Server
+		proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Header.Get("Authorization") != "Bearer kafka" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			instance := "/consumers/autoassigner/instances/i1"
+			switch {
+			case r.Method == http.MethodPost && r.URL.Path == "/consumers/autoassigner":
+				json.NewEncoder(w).Encode(map[string]string{"instance_id": "i1", "base_uri": proxy.URL + instance})
+			case r.URL.Path == instance+"/subscription":
+				w.WriteHeader(http.StatusNoContent)
+			case r.URL.Path == instance+"/records":
+				if r.Header.Get("Accept") != "application/vnd.kafka.binary.v2+json" {
+					w.WriteHeader(http.StatusNotAcceptable)
+					return
+				}
+				records := []map[string]interface{}{}
+				if len(polls) > 0 {
+					records, polls = polls[0], polls[1:]
+				}
+				json.NewEncoder(w).Encode(records)
+			case r.URL.Path == "/topics/results":
+				var body struct {
+					Records []struct {
+						Key   string           `json:"key"`
+						Value AssignmentResult `json:"value"`
+					} `json:"records"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				for _, record := range body.Records {
+					results = append(results, record.Value)
+				}
+				if len(results) == 5 {
+					cancel()
+				}
+				w.Write([]byte(`{"offsets": [{"partition": 0, "offset": 1}]}`))
+			case r.URL.Path == instance+"/offsets":
+				var body struct {
+					Offsets []struct {
+						Offset int64 `json:"offset"`
+					} `json:"offsets"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				for _, o := range body.Offsets {
+					committed = append(committed, o.Offset)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			case r.Method == http.MethodDelete && r.URL.Path == instance:
+				deleted = true
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer proxy.Close()
+		config.Settings.Server.Consumer = config.ConsumerConfig{
+			Type: config.ConsumerKafka, URL: proxy.URL, Subject: "requests", ReplySubject: "results",
+			Headers: map[string]string{"Authorization": "Bearer kafka"},
+		}
+
+		recorder := &recordingSink{}
+		if err := Consume(ctx, &sync.Mutex{}, recorder); err != nil {
+			t.Fatalf("Consume() error = %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		want := []AssignmentResult{
+			{Response: Response{Status: StatusAssigned, ID: "kafka-requests-0-0", Group: "support", Assignee: "alice", Reason: "round_robin next"}, Metadata: map[string]string{"ticket": "T-1"}},
+			{Response: Response{Status: StatusAssigned, ID: "req-2", Group: "support", Assignee: "bob", Reason: "round_robin next"}},
+			{Response: Response{Status: StatusError, Error: "invalid assignment request: invalid character 'o' in literal null (expecting 'u')"}},
+			{Response: Response{Status: StatusError, Group: "missing", Error: results[3].Error}},
+			{Response: Response{Status: StatusAssigned, ID: "kafka-requests-0-0", Group: "support", Assignee: "alice", Reason: "round_robin next"}, Metadata: map[string]string{"ticket": "T-1"}},
+		}
+		if !reflect.DeepEqual(results, want) {
+			t.Errorf("results = %+v, want %+v", results, want)
+		}
+		if !strings.Contains(results[3].Error, "missing") {
+			t.Errorf("error of unknown group = %q", results[3].Error)
+		}
+		// The result of the last record was published before the consumer stopped
+		if wantCommitted := []int64{0, 1, 2, 3}; !reflect.DeepEqual(committed, wantCommitted) {
+			t.Errorf("committed offsets = %v, want %v", committed, wantCommitted)
+		}
+		if !deleted {
+			t.Error("consumer instance was not deleted")
+		}
+		var statuses []int
+		for _, entry := range recorder.entries {
+			if entry.Method != config.ConsumerKafka || entry.Path != "requests" {
+				t.Errorf("audit entry = %+v, want kafka requests", entry)
+			}
+			statuses = append(statuses, entry.Status)
+		}
+		if want := []int{200, 200, 400, 404, 200}; !reflect.DeepEqual(statuses, want) {
+			t.Errorf("audited statuses = %v, want %v", statuses, want)
+		}
+	})
+
+	t.Run("nats", func(t *testing.T) {
+		config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "nats"), ConfDir: config.DirList{dir}}}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer listener.Close()
+		config.Settings.Server.Consumer = config.ConsumerConfig{
+			Type: config.ConsumerNATS, URL: "nats://" + listener.Addr().String(), Token: "s3cret",
+			Subject: "assign.requests", ReplySubject: "assign.results", Group: "workers",
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		published := make(chan string, 10)
+		serverErr := make(chan error, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"auth_required\":true}\r\n")
+			for _, prefix := range []string{"CONNECT ", "PING", "SUB assign.requests workers "} {
+				line, _ := r.ReadString('\n')
+				if !strings.HasPrefix(line, prefix) {
+					serverErr <- fmt.Errorf("got %q, want %s", line, prefix)
+					return
+				}
+				if prefix == "CONNECT " && !strings.Contains(line, `"auth_token":"s3cret"`) {
+					serverErr <- fmt.Errorf("CONNECT %q without token", line)
+					return
+				}
+				if prefix == "PING" {
+					fmt.Fprint(conn, "PONG\r\n")
+				}
+			}
+			for _, msg := range []string{
+				fmt.Sprintf("MSG assign.requests 1 _INBOX.abc %d\r\n%s\r\n", len(`{"group": "support"}`), `{"group": "support"}`),
+				"PING\r\n",
+				fmt.Sprintf("MSG assign.requests 1 %d\r\n%s\r\n", len(`{"group": "other"}`), `{"group": "other"}`),
+			} {
+				fmt.Fprint(conn, msg)
+			}
+			serverErr <- nil
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if subject, ok := strings.CutPrefix(strings.TrimSpace(line), "PUB "); ok {
+					payload, _ := r.ReadString('\n')
+					published <- strings.Fields(subject)[0] + " " + strings.TrimSpace(payload)
+				} else {
+					published <- strings.TrimSpace(line)
+				}
+			}
+		}()
+
+		done := make(chan error, 1)
+		go func() { done <- Consume(ctx, &sync.Mutex{}) }()
+		if err := <-serverErr; err != nil {
+			t.Fatalf("fake NATS server: %v", err)
+		}
+		var got []string
+		for len(got) < 3 {
+			select {
+			case line := <-published:
+				got = append(got, line)
+			case <-ctx.Done():
+				t.Fatalf("published %v before timing out", got)
+			}
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Consume() error = %v", err)
+		}
+		var results []string
+		for _, line := range got {
+			if line == "PONG" {
+				continue
+			}
+			subject, data, _ := strings.Cut(line, " ")
+			var result AssignmentResult
+			if err := json.Unmarshal([]byte(data), &result); err != nil {
+				t.Fatalf("invalid result %s: %v", data, err)
+			}
+			results = append(results, subject+" "+result.Status+" "+result.Assignee)
+		}
+		if want := []string{"_INBOX.abc assigned alice", "assign.results error "}; !reflect.DeepEqual(results, want) {
+			t.Errorf("published results = %q, want %q", results, want)
+		}
+	})
+}
+
+func TestSlackBot(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+
+	var posted []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			posted = append(posted, body["channel"]+" "+body["thread_ts"]+" "+body["text"])
+			w.Write([]byte(`{"ok": true}`))
+		case "/respond":
+			posted = append(posted, "respond "+body["response_type"]+" "+body["text"])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+	event := func(id, typ, channelType, user, text string) *slack.Envelope {
+		payload, _ := json.Marshal(map[string]interface{}{"event_id": id, "event": map[string]string{
+			"type": typ, "channel_type": channelType, "user": user, "text": text, "channel": "C1", "ts": "1.5",
+		}})
+		return &slack.Envelope{EnvelopeID: "env-" + id, Type: "events_api", Payload: payload}
+	}
+	command := func(user, text string) *slack.Envelope {
+		payload, _ := json.Marshal(slack.SlashCommand{Command: "/autoassigner", Text: text, UserID: user, TriggerID: "t-" + text, ResponseURL: api.URL + "/respond"})
+		return &slack.Envelope{EnvelopeID: "env-" + text, Type: "slash_commands", Payload: payload}
+	}
+
+	config.Settings = config.Config{
+		Storage:  config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		Identity: config.IdentityConfig{Users: map[string]map[string]string{"alice": {"slack": "U1"}, "bob": {"slack": "U2"}, "mallory": {"slack": "U3"}}},
+		Server: config.ServerConfig{Auth: config.AuthConfig{Policies: []config.PolicyConfig{
+			{Principals: []string{"alice", "bob"}, Routes: []string{"/slack"}, Groups: []string{"support"}},
+			{Principals: []string{"mallory"}, Routes: []string{"/state"}},
+		}}},
+	}
+	recorder := &recordingSink{}
+	bot := &slackBot{client: &slack.Client{URL: api.URL, BotToken: "xoxb-1"}, settings: &sync.Mutex{}, sinks: []AuditSink{recorder}}
+	ctx := context.Background()
+	steps := []struct {
+		env  *slack.Envelope
+		want string
+	}{
+		{event("Ev1", "app_mention", "channel", "U1", "<@UBOT> assign support for INC-123"), "C1 1.5 Assigned <@U1> from support for INC-123 (round_robin next)"},
+		// Delivered again
+		{event("Ev1", "app_mention", "channel", "U1", "<@UBOT> assign support for INC-123"), "C1 1.5 Assigned <@U1> from support for INC-123 (round_robin next)"},
+		{event("Ev2", "message", "im", "U2", "Who’s next on support?"), "C1  Next on support: <@U2> (round_robin next)"},
+		{command("U2", "pause me for 3d"), "respond in_channel Paused you in every group until <!date^"},
+		{event("Ev3", "message", "im", "U1", "next support"), "C1  Next on support: <@U1>"},
+		{command("U2", "resume me"), "respond in_channel Resumed you in every group"},
+		{event("Ev4", "app_mention", "channel", "U1", "<@UBOT> assign billing"), "C1 1.5 Failed to assign from billing: forbidden"},
+		{event("Ev5", "app_mention", "channel", "U3", "<@UBOT> next support"), "C1 1.5 forbidden: mallory may not use the Slack bot"},
+		{event("Ev6", "app_mention", "channel", "U9", "<@UBOT> next support"), "C1 1.5 unknown Slack user"},
+		{command("U1", "dance"), `respond in_channel unknown command "dance"`},
+		// Messages in channels without a mention are ignored
+		{event("Ev7", "message", "channel", "U1", "assign support"), ""},
+	}
+	for i, step := range steps {
+		posted = nil
+		bot.handleEnvelope(ctx, step.env)
+		if step.want == "" {
+			if len(posted) != 0 {
+				t.Errorf("step %d posted %q, want nothing", i, posted)
+			}
+			continue
+		}
+		if len(posted) != 1 || !strings.HasPrefix(posted[0], step.want) {
+			t.Errorf("step %d posted %q, want %q", i, posted, step.want)
+		}
+	}
+
+	if len(recorder.entries) != len(steps)-1 {
+		t.Fatalf("audit entries = %d, want %d", len(recorder.entries), len(steps)-1)
+	}
+	if entry := recorder.entries[0]; entry.Method != "slack" || entry.Path != "/slack" || entry.Actor != "alice" || entry.Assignee != "alice" || entry.ID != "slack-Ev1" || entry.Status != http.StatusOK {
+		t.Errorf("audit entry of assign = %+v, want alice assigned by alice", entry)
+	}
+	if entry := recorder.entries[7]; entry.Actor != "mallory" || entry.Status != http.StatusForbidden {
+		t.Errorf("audit entry of a forbidden user = %+v, want 403 for mallory", entry)
+	}
+}
+
+func TestLambdaHandler(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings = config.Config{Storage: config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}}}
+	data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Add("X-Echo", "a")
+		w.Header().Add("X-Echo", "b")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "%s %s %s %s %s", r.Method, r.URL.RequestURI(), r.Header.Get("X-Hub-Signature"), r.RemoteAddr, body)
+	})
+	recorder := &recordingSink{}
+	handler := LambdaHandler(echo, recorder)
+
+	tests := []struct {
+		name  string
+		event string
+		want  string
+	}{
+		{
+			name: "REST API",
+			event: `{"httpMethod": "POST", "path": "/zendesk", "multiValueQueryStringParameters": {"group": ["support"]},
+				"multiValueHeaders": {"X-Hub-Signature": ["sig"]}, "body": "e30=", "isBase64Encoded": true,
+				"requestContext": {"stage": "prod", "identity": {"sourceIp": "10.0.0.1"}}}`,
+			want: `{"statusCode":202,"multiValueHeaders":{"X-Echo":["a","b"]},"body":"POST /zendesk?group=support sig 10.0.0.1 {}","isBase64Encoded":false}`,
+		},
+		{
+			name: "HTTP API",
+			event: `{"version": "2.0", "rawPath": "/prod/state", "rawQueryString": "a=1", "headers": {"x-hub-signature": "sig"},
+				"requestContext": {"stage": "prod", "http": {"method": "GET", "sourceIp": "10.0.0.2"}}}`,
+			want: `{"statusCode":202,"headers":{"X-Echo":"a,b"},"body":"GET /state?a=1 sig 10.0.0.2 ","isBase64Encoded":false}`,
+		},
+		{
+			name: "function URL",
+			event: `{"version": "2.0", "rawPath": "/state", "rawQueryString": "",
+				"requestContext": {"stage": "$default", "http": {"method": "GET", "sourceIp": "10.0.0.3"}}}`,
+			want: `{"statusCode":202,"headers":{"X-Echo":"a,b"},"body":"GET /state  10.0.0.3 ","isBase64Encoded":false}`,
+		},
+		{
+			name: "SQS",
+			event: `{"Records": [
+				{"messageId": "m1", "eventSource": "aws:sqs", "eventSourceARN": "arn:aws:sqs:eu-west-1:1:requests", "body": "{\"group\": \"support\"}"},
+				{"messageId": "m2", "eventSource": "aws:sqs", "eventSourceARN": "arn:aws:sqs:eu-west-1:1:requests", "body": "not json"},
+				{"messageId": "m1", "eventSource": "aws:sqs", "eventSourceARN": "arn:aws:sqs:eu-west-1:1:requests", "body": "{\"group\": \"support\"}"}
+			]}`,
+			// Invalid requests fail again when delivered again, so they aren't retried
+			want: `{"batchItemFailures":[]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := handler(context.Background(), json.RawMessage(tt.event))
+			if err != nil {
+				t.Fatalf("handler() error = %v", err)
+			}
+			got, _ := json.Marshal(result)
+			if string(got) != tt.want {
+				t.Errorf("handler() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// A message delivered again returns its assignment rather than assigning again
+	var assignees []string
+	for _, entry := range recorder.entries {
+		if entry.Method != "sqs" || entry.Path != "arn:aws:sqs:eu-west-1:1:requests" {
+			t.Errorf("audit entry = %+v, want sqs with queue ARN", entry)
+		}
+		assignees = append(assignees, entry.ID+":"+entry.Assignee)
+	}
+	if want := []string{"m1:alice", ":", "m1:alice"}; !reflect.DeepEqual(assignees, want) {
+		t.Errorf("audited assignments = %v, want %v", assignees, want)
+	}
+
+	if _, err := handler(context.Background(), json.RawMessage(`{"source": "aws.events"}`)); err == nil {
+		t.Error("handler() of an unsupported event succeeded")
+	}
+}
+
+func TestUI(t *testing.T) {
+	dir := t.TempDir()
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	data := "strategy: round_robin\navailability_checker: always_available\nusers: [alice, bob]\n"
+	if err := os.WriteFile(filepath.Join(dir, "support.yaml"), []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	sign := func(claims map[string]interface{}) string {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+		payload, _ := json.Marshal(claims)
+		input := b64(header) + "." + b64(payload)
+		digest := sha256.Sum256([]byte(input))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return input + "." + b64(signature)
+	}
+	// codes maps the authorization codes the provider issued to the email
+	// and nonce of the ID token they are exchanged for.
+	codes := map[string][2]string{}
+	var provider *httptest.Server
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": provider.URL, "jwks_uri": provider.URL + "/keys",
+				"authorization_endpoint": provider.URL + "/authorize", "token_endpoint": provider.URL + "/token"})
+		case "/keys":
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{"kid": "k1", "kty": "RSA", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}}})
+		case "/token":
+			id, secret, _ := r.BasicAuth()
+			login, ok := codes[r.PostFormValue("code")]
+			if id != "autoassigner-ui" || secret != "ui-secret" || !ok || r.PostFormValue("grant_type") != "authorization_code" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			token := sign(map[string]interface{}{"iss": provider.URL, "aud": "autoassigner-ui", "sub": "u-" + login[0], "email": login[0],
+				"nonce": login[1], "exp": time.Now().Add(time.Hour).Unix()})
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": token})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer provider.Close()
+
+	recorder := &recordingSink{}
+	ui := NewUI()
+	mux := http.NewServeMux()
+	mux.Handle("/ui", ui)
+	mux.Handle("/ui/", ui)
+	server := httptest.NewServer(Audit(mux, recorder))
+	defer server.Close()
+
+	config.Settings = config.Config{
+		Storage:  config.StorageConfig{DataDir: filepath.Join(dir, "data"), ConfDir: config.DirList{dir}},
+		Identity: config.IdentityConfig{Users: map[string]map[string]string{"alice": {"email": "alice@example.com"}, "bob": {"email": "bob@example.com"}, "mallory": {"email": "mallory@example.com"}}},
+		Server: config.ServerConfig{
+			Auth: config.AuthConfig{
+				OIDC:     config.OIDCConfig{Issuer: provider.URL, Claim: "email"},
+				Policies: []config.PolicyConfig{{Principals: []string{"alice", "bob"}, Routes: []string{"/ui"}}, {Principals: []string{"mallory"}, Routes: []string{"/state"}}},
+			},
+			UI: config.UIConfig{ClientID: "autoassigner-ui", ClientSecret: "ui-secret", RedirectURL: server.URL + "/ui/callback",
+				SessionSecret: strings.Repeat("s", 32), IdentityKind: "email"},
+		},
+	}
+
+	// login logs in as email with a new browser, returning it and the
+	// response to the redirect back from the provider.
+	login := func(email string) (*http.Client, *http.Response) {
+		jar, _ := cookiejar.New(nil)
+		browser := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := browser.Get(server.URL + "/ui")
+		if err != nil || resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/ui/login" {
+			t.Fatalf("GET /ui before login = %v, %v, want a redirect to /ui/login", resp, err)
+		}
+		resp, err = browser.Get(server.URL + "/ui/login")
+		if err != nil || resp.StatusCode != http.StatusFound {
+			t.Fatalf("GET /ui/login = %v, %v, want a redirect", resp, err)
+		}
+		authorize, _ := url.Parse(resp.Header.Get("Location"))
+		query := authorize.Query()
+		if authorize.Path != "/authorize" || query.Get("client_id") != "autoassigner-ui" || query.Get("redirect_uri") != server.URL+"/ui/callback" || query.Get("state") == "" {
+			t.Fatalf("login redirected to %s, want the authorization endpoint", authorize)
+		}
+		code := "code-" + email
+		codes[code] = [2]string{email, query.Get("nonce")}
+		resp, err = browser.Get(server.URL + "/ui/callback?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode())
+		if err != nil {
+			t.Fatalf("GET /ui/callback failed: %v", err)
+		}
+		resp.Body.Close()
+		return browser, resp
+	}
+	page := func(browser *http.Client) string {
+		resp, err := browser.Get(server.URL + "/ui")
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /ui = %v, %v, want the page", resp, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	post := func(browser *http.Client, path string, form url.Values) int {
+		resp, err := browser.PostForm(server.URL+path, form)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if _, err := runner.AssignUser(context.Background(), "support", runner.AssignOptions{}); err != nil {
+		t.Fatalf("AssignUser() failed: %v", err)
+	}
+	browser, resp := login("alice@example.com")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/ui" {
+		t.Fatalf("callback of alice = %s, want a redirect to /ui", resp.Status)
+	}
+	body := page(browser)
+	if !strings.Contains(body, "alice") || !strings.Contains(body, "<td>support</td><td>1</td><td>100%</td>") {
+		t.Errorf("page of alice = %s, want the assignment of alice in support", body)
+	}
+	_, rest, _ := strings.Cut(body, `name="csrf" value="`)
+	csrf, _, _ := strings.Cut(rest, `"`)
+
+	if status := post(browser, "/ui/pause", url.Values{"until": {"2w"}}); status != http.StatusForbidden {
+		t.Errorf("POST /ui/pause without csrf = %d, want %d", status, http.StatusForbidden)
+	}
+	if status := post(browser, "/ui/pause", url.Values{"csrf": {csrf}, "until": {"someday"}}); status != http.StatusBadRequest {
+		t.Errorf("POST /ui/pause until someday = %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := post(browser, "/ui/pause", url.Values{"csrf": {csrf}, "from": {"3d"}, "until": {"2w"}}); status != http.StatusSeeOther {
+		t.Fatalf("POST /ui/pause = %d, want %d", status, http.StatusSeeOther)
+	}
+	pauses, err := runner.ListPauses()
+	if err != nil || len(pauses) != 1 || pauses[0].User != "alice" || pauses[0].From == "" || pauses[0].Actor != "ui:alice" {
+		t.Fatalf("ListPauses() after pausing = %+v, %v, want a vacation of alice", pauses, err)
+	}
+	if body := page(browser); !strings.Contains(body, "scheduled from") {
+		t.Errorf("page of alice = %s, want the scheduled pause of alice", body)
+	}
+	if status := post(browser, "/ui/resume", url.Values{"csrf": {csrf}}); status != http.StatusSeeOther {
+		t.Errorf("POST /ui/resume = %d, want %d", status, http.StatusSeeOther)
+	}
+	if pauses, err := runner.ListPauses(); err != nil || len(pauses) != 0 {
+		t.Errorf("ListPauses() after resuming = %+v, %v, want none", pauses, err)
+	}
+	if status := post(browser, "/ui/logout", url.Values{"csrf": {csrf}}); status != http.StatusOK {
+		t.Errorf("POST /ui/logout = %d, want %d", status, http.StatusOK)
+	}
+	if resp, err := browser.Get(server.URL + "/ui"); err != nil || resp.StatusCode != http.StatusFound {
+		t.Errorf("GET /ui after logout = %v, %v, want a redirect to log in", resp, err)
+	}
+
+	if _, resp := login("mallory@example.com"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("callback of mallory = %s, want %d", resp.Status, http.StatusForbidden)
+	}
+	if resp, err := browser.Get(server.URL + "/ui/callback?code=code-alice@example.com&state=forged"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("callback with a forged state = %v, %v, want %d", resp, err, http.StatusBadRequest)
+	}
+
+	var paused *AccessEntry
+	for i, entry := range recorder.entries {
+		if entry.Path == "/ui/pause" && entry.Status == http.StatusSeeOther {
+			paused = &recorder.entries[i]
+		}
+	}
+	if paused == nil || paused.Actor != "alice" || paused.From == "" || paused.Until == "" {
+		t.Errorf("audit entry of the pause = %+v, want alice with from and until", paused)
+	}
+
+	// Pauses of several users at once, next to the CLI and the Slack bot, all take effect
+	var wg sync.WaitGroup
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		browser, _ := login(email)
+		_, rest, _ := strings.Cut(page(browser), `name="csrf" value="`)
+		csrf, _, _ := strings.Cut(rest, `"`)
+		wg.Add(1)
+		go func(email string) {
+			defer wg.Done()
+			resp, err := browser.PostForm(server.URL+"/ui/pause", url.Values{"csrf": {csrf}, "until": {"2w"}})
+			if err != nil || resp.StatusCode != http.StatusSeeOther {
+				t.Errorf("concurrent POST /ui/pause of %s = %v, %v, want %d", email, resp, err, http.StatusSeeOther)
+				return
+			}
+			resp.Body.Close()
+		}(email)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := runner.PauseUser(context.Background(), "carol", time.Now().Add(time.Hour), ""); err != nil {
+			t.Errorf("PauseUser(carol) error = %v", err)
+		}
+	}()
+	wg.Wait()
+	if pauses, err := runner.ListPauses(); err != nil || len(pauses) != 3 {
+		t.Errorf("ListPauses() after concurrent pauses = %+v, %v, want alice, bob and carol", pauses, err)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/servicenow"
+	"crypto/subtle"
+	"net/http"
+)
+
+// handleServiceNow sets the assignee of records sent by ServiceNow. Records
+// that are already assigned or whose group is not mapped are ignored.
+func handleServiceNow(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readPayload(w, r)
+	if !ok {
+		return
+	}
+	if token := config.Settings.ServiceNow.WebhookToken; token != "" &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		respond(w, http.StatusUnauthorized, Response{Status: StatusError, Error: "invalid token"})
+		return
+	}
+	record, err := servicenow.ParseRecord(payload)
+	if err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+	if record.Assignee != "" {
+		respond(w, http.StatusOK, Response{Status: StatusIgnored})
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		if group, ok = servicenow.Group(*record); !ok {
+			respond(w, http.StatusOK, Response{Status: StatusIgnored})
+			return
+		}
+	}
+
+	resp, status := assignFrom(r.Context(), group, record, requestOptions(r))
+	if resp.Status != StatusAssigned {
+		respond(w, status, resp)
+		return
+	}
+	if resp.Login, err = servicenow.UserID(r.Context(), resp.Assignee); err != nil {
+		writeBackFailed(w, record, resp, err)
+		return
+	}
+	if err := servicenow.Assign(r.Context(), *record, resp.Login); err != nil {
+		writeBackFailed(w, record, resp, err)
+		return
+	}
+	respond(w, status, resp)
+}
@@ -0,0 +1,378 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"autoassigner/runner"
+	"autoassigner/slack"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slackRoute is the route of the Slack bot in server.auth policies and the
+// audit log.
+const slackRoute = "/slack"
+
+// slackHelp answers help and commands the bot doesn't understand.
+const slackHelp = "Commands:\n" +
+	"• `assign <group> [for <ticket>]` assigns the next user of a group\n" +
+	"• `who's next on <group>` shows who would be assigned, without assigning\n" +
+	"• `pause me until <when>` takes you out of every rotation, e.g. until monday, until 2024-05-20 or for 2w\n" +
+	"• `resume me` puts you back in the rotations"
+
+// ServeSlack runs the Slack bot of config.Settings.Slack until ctx is done:
+// it receives mentions, direct messages and slash commands in Socket Mode,
+// runs the commands they contain and replies in their thread or channel.
+// Slack users are mapped to usernames by the identity layer and are
+// restricted by server.auth policies like callers of the API, on the
+// route /slack. Lost connections are retried with a backoff, using the
+// settings of the time. Commands are run while settings is locked and
+// recorded in sinks like requests to the API.
+func ServeSlack(ctx context.Context, settings sync.Locker, sinks ...AuditSink) error {
+	backoff := minConsumerBackoff
+	for {
+		settings.Lock()
+		conf := config.Settings.Slack
+		settings.Unlock()
+		b := &slackBot{
+			client:   &slack.Client{URL: conf.ApiUrl, AppToken: conf.AppToken, BotToken: conf.BotToken},
+			settings: settings,
+			sinks:    sinks,
+		}
+
+		connected := timeNow()
+		err := b.serve(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// Slack asks to reconnect before refreshing a connection
+		if errors.Is(err, slack.ErrDisconnect) {
+			log.Printf("Reconnecting to Slack: %v", err)
+			continue
+		}
+		if timeNow().Sub(connected) > maxConsumerBackoff {
+			backoff = minConsumerBackoff
+		}
+		log.Printf("Slack bot failed, retrying in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxConsumerBackoff {
+			backoff = maxConsumerBackoff
+		}
+	}
+}
+
+// slackBot handles the envelopes of ServeSlack.
+type slackBot struct {
+	client   *slack.Client
+	settings sync.Locker
+	sinks    []AuditSink
+}
+
+// serve handles the envelopes of a connection until it is lost. Envelopes
+// are acknowledged before they are handled, since Slack delivers them again
+// when they aren't within 3 seconds, and handled concurrently.
+func (b *slackBot) serve(ctx context.Context) error {
+	conn, err := b.client.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		env, err := conn.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if err := conn.Ack(env.EnvelopeID); err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.handleEnvelope(ctx, env)
+		}()
+	}
+}
+
+// handleEnvelope runs the command of a mention of the bot, a direct message
+// or a slash command and posts the reply. Other envelopes are ignored.
+func (b *slackBot) handleEnvelope(ctx context.Context, env *slack.Envelope) {
+	switch env.Type {
+	case "events_api":
+		var callback slack.EventCallback
+		if err := json.Unmarshal(env.Payload, &callback); err != nil {
+			log.Printf("Invalid Slack event: %v", err)
+			return
+		}
+		ev := callback.Event
+		direct := ev.Type == "message" && ev.ChannelType == "im"
+		if (ev.Type != "app_mention" && !direct) || ev.BotID != "" || ev.Subtype != "" || ev.User == "" {
+			return
+		}
+		reply := b.handle(ctx, ev.User, ev.Text, "slack-"+callback.EventID)
+		// Mentions in channels are answered in a thread, direct messages in place
+		thread := ev.ThreadTS
+		if thread == "" && !direct {
+			thread = ev.TS
+		}
+		if err := b.client.PostMessage(ctx, slack.Message{Channel: ev.Channel, Text: reply, ThreadTS: thread}); err != nil {
+			log.Printf("Failed to reply to Slack event %s: %v", callback.EventID, err)
+		}
+	case "slash_commands":
+		var command slack.SlashCommand
+		if err := json.Unmarshal(env.Payload, &command); err != nil {
+			log.Printf("Invalid Slack slash command: %v", err)
+			return
+		}
+		reply := b.handle(ctx, command.UserID, command.Text, "slack-"+command.TriggerID)
+		if err := b.client.Respond(ctx, command.ResponseURL, reply); err != nil {
+			log.Printf("Failed to reply to Slack command %s: %v", command.Command, err)
+		}
+	}
+}
+
+// handle runs the command in text for the Slack user with the given member
+// ID, records it in the audit sinks and returns the reply. id identifies
+// the assignment made by the command, so a message delivered again isn't
+// assigned again.
+func (b *slackBot) handle(ctx context.Context, member, text, id string) string {
+	entry := AccessEntry{Time: timeNow(), Method: "slack", Path: slackRoute, Remote: brokerHost(b.client.URL)}
+	if entry.Remote == "" {
+		entry.Remote = brokerHost(slack.DefaultApiUrl)
+	}
+	b.settings.Lock()
+	reply, resp, status, actor := b.run(ctx, member, text, id)
+	b.settings.Unlock()
+
+	entry.Status, entry.Actor, entry.Group = status, actor, resp.Group
+	entry.Result, entry.ID, entry.Assignee, entry.Error = resp.Status, resp.ID, resp.Assignee, resp.Error
+	entry.LatencyMS = float64(timeNow().Sub(entry.Time).Microseconds()) / 1000
+	record(ctx, b.sinks, entry)
+	return reply
+}
+
+// run runs a command and returns the reply, the response and status of the
+// equivalent API request, and the username of the Slack user.
+func (b *slackBot) run(ctx context.Context, member, text, id string) (string, Response, int, string) {
+	failed := func(status int, err error) (string, Response, int, string) {
+		return err.Error(), Response{Status: StatusError, Error: err.Error()}, status, ""
+	}
+	user, err := identity.User(ctx, identity.Slack, member)
+	if err != nil {
+		return failed(http.StatusUnauthorized, fmt.Errorf("unknown Slack user: %w", err))
+	}
+	policies := Policies(config.Settings.Server.Auth.Policies)
+	if !policies.allows(user, slackRoute, "") {
+		err := fmt.Errorf("%w: %s may not use the Slack bot", ErrForbidden, user)
+		return err.Error(), Response{Status: StatusError, Error: err.Error()}, http.StatusForbidden, user
+	}
+	ctx = context.WithValue(ctx, authContextKey{}, &authorization{principal: &Principal{Name: user, Method: "slack"}, policies: policies, route: slackRoute})
+
+	reply, resp, status := b.runCommand(ctx, user, member, text, id)
+	return reply, resp, status, user
+}
+
+// runCommand runs a command of an identified and authorized user.
+func (b *slackBot) runCommand(ctx context.Context, user, member, text, id string) (string, Response, int) {
+	ok := Response{Status: "ok"}
+	command, err := parseSlackCommand(text)
+	if err != nil {
+		return err.Error() + "\n" + slackHelp, Response{Status: StatusError, Error: err.Error()}, http.StatusBadRequest
+	}
+
+	switch command.action {
+	case "assign":
+		opts := runner.AssignOptions{ID: id, Silent: true}
+		if command.ticket != "" {
+			opts.CallbackData = map[string]string{"ticket": command.ticket}
+		}
+		resp, status := assignFrom(ctx, command.group, command, opts)
+		switch resp.Status {
+		case StatusAssigned:
+			return fmt.Sprintf("Assigned %s from %s%s%s", b.mention(ctx, resp.Assignee), command.group, command.forTicket(), slackReason(resp.Reason)), resp, status
+		case StatusDeferred:
+			return fmt.Sprintf("Quiet hours for %s: the assignment%s is queued until %s", command.group, command.forTicket(), slackDate(resp.Deferred)), resp, status
+		default:
+			return fmt.Sprintf("Failed to assign from %s: %s", command.group, resp.Error), resp, status
+		}
+
+	case "next":
+		resp := Response{Status: "ok", Group: command.group}
+		if err := authorizeGroup(ctx, command.group); err != nil {
+			resp.Status, resp.Error = StatusError, err.Error()
+			return err.Error(), resp, http.StatusForbidden
+		}
+		result, err := runner.AssignUser(ctx, command.group, runner.AssignOptions{DryRun: true, Silent: true})
+		if err != nil {
+			resp.Status, resp.Error = StatusError, err.Error()
+			return fmt.Sprintf("Failed to find the next user of %s: %v", command.group, err), resp, errorStatus(err)
+		}
+		if result.Deferred != "" {
+			return fmt.Sprintf("Quiet hours for %s until %s", command.group, slackDate(result.Deferred)), resp, http.StatusOK
+		}
+		return fmt.Sprintf("Next on %s: %s%s", command.group, b.mention(ctx, result.User), slackReason(result.Reason)), resp, http.StatusOK
+
+	case "pause":
+		until, err := runner.ParsePauseEnd(command.until, timeNow())
+		if err != nil {
+			return err.Error(), Response{Status: StatusError, Error: err.Error()}, http.StatusBadRequest
+		}
+		if err := runner.PauseUser(ctx, user, until, "slack:"+member); err != nil {
+			return fmt.Sprintf("Failed to pause you: %v", err), Response{Status: StatusError, Error: err.Error()}, http.StatusInternalServerError
+		}
+		return fmt.Sprintf("Paused you in every group until %s", slackDate(until.Format(time.RFC3339))), ok, http.StatusOK
+
+	case "resume":
+		resumed, err := runner.ResumeUser(ctx, user)
+		if err != nil {
+			return fmt.Sprintf("Failed to resume you: %v", err), Response{Status: StatusError, Error: err.Error()}, http.StatusInternalServerError
+		}
+		if !resumed {
+			return "You are not paused", ok, http.StatusOK
+		}
+		return "Resumed you in every group", ok, http.StatusOK
+
+	default:
+		return slackHelp, ok, http.StatusOK
+	}
+}
+
+// mention returns the Slack mention of a user, or their username when they
+// have no Slack member ID.
+func (b *slackBot) mention(ctx context.Context, user string) string {
+	if member, err := identity.Lookup(ctx, user, identity.Slack); err == nil && member != "" {
+		return "<@" + member + ">"
+	}
+	return user
+}
+
+// slackDate formats a time in RFC 3339 format for Slack, which shows it in
+// the time zone of the reader.
+func slackDate(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), value)
+}
+
+// slackReason formats the reason of an assignment as the end of a reply,
+// or returns nothing for assignments logged without one.
+func slackReason(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return " (" + reason + ")"
+}
+
+// slackCommand is a command sent to the Slack bot.
+type slackCommand struct {
+	action string // assign, next, pause, resume or help
+	group  string // Group of assign and next
+	ticket string // Ticket of assign, passed to the group's callback
+	until  string // End of the pause of pause, as parsed by runner.ParsePauseEnd
+}
+
+// String names the assignment of a command in logs.
+func (c slackCommand) String() string {
+	if c.ticket != "" {
+		return "Slack request for " + c.ticket
+	}
+	return "Slack request"
+}
+
+// forTicket returns " for <ticket>" for an assignment with a ticket.
+func (c slackCommand) forTicket() string {
+	if c.ticket == "" {
+		return ""
+	}
+	return " for " + c.ticket
+}
+
+// slackMention matches mentions of users, such as of the bot in the
+// messages mentioning it.
+var slackMention = regexp.MustCompile(`<@[A-Z0-9]+(\|[^>]*)?>`)
+
+// parseSlackCommand parses the text of a message or slash command:
+//
+//	assign <group> [for <ticket>]
+//	who's next on <group>, or next <group>
+//	pause me until <when>, or pause me for <duration>
+//	resume me
+//	help
+func parseSlackCommand(text string) (slackCommand, error) {
+	text = slackMention.ReplaceAllString(text, " ")
+	text = strings.NewReplacer("’", "'", "?", " ").Replace(text)
+	words := strings.Fields(text)
+	lower := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 || lower[0] == "help" {
+		return slackCommand{action: "help"}, nil
+	}
+
+	switch {
+	case lower[0] == "assign":
+		if len(words) < 2 {
+			return slackCommand{}, fmt.Errorf("missing group: say \"assign <group> [for <ticket>]\"")
+		}
+		command := slackCommand{action: "assign", group: words[1]}
+		if len(words) > 2 {
+			if lower[2] != "for" || len(words) < 4 {
+				return slackCommand{}, fmt.Errorf("missing ticket: say \"assign <group> for <ticket>\"")
+			}
+			command.ticket = strings.Join(words[3:], " ")
+		}
+		return command, nil
+
+	case lower[0] == "next", hasPrefix(lower, "who's", "next"), hasPrefix(lower, "whos", "next"), hasPrefix(lower, "who", "is", "next"):
+		rest := words[1:]
+		for i, word := range lower {
+			if word == "next" {
+				rest = words[i+1:]
+				break
+			}
+		}
+		if len(rest) > 0 && (strings.EqualFold(rest[0], "on") || strings.EqualFold(rest[0], "in")) {
+			rest = rest[1:]
+		}
+		if len(rest) != 1 {
+			return slackCommand{}, fmt.Errorf("missing group: ask \"who's next on <group>\"")
+		}
+		return slackCommand{action: "next", group: rest[0]}, nil
+
+	case hasPrefix(lower, "pause", "me"):
+		if len(words) < 4 || (lower[2] != "until" && lower[2] != "till" && lower[2] != "for") {
+			return slackCommand{}, fmt.Errorf("missing end of the pause: say \"pause me until monday\" or \"pause me for 2w\"")
+		}
+		return slackCommand{action: "pause", until: strings.Join(words[3:], " ")}, nil
+
+	case hasPrefix(lower, "resume", "me"), hasPrefix(lower, "unpause", "me"):
+		return slackCommand{action: "resume"}, nil
+	}
+	return slackCommand{}, fmt.Errorf("unknown command %q", strings.Join(words, " "))
+}
+
+// hasPrefix reports whether words start with prefix.
+func hasPrefix(words []string, prefix ...string) bool {
+	if len(words) < len(prefix) {
+		return false
+	}
+	for i, word := range prefix {
+		if words[i] != word {
+			return false
+		}
+	}
+	return true
+}
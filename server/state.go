@@ -0,0 +1,60 @@
+package server
+
+import (
+	"autoassigner/runner"
+	"autoassigner/tracing"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// StateResponse is the JSON body answering GET /state.
+type StateResponse struct {
+	Groups []runner.GroupState `json:"groups"`
+}
+
+// handleState serves a snapshot of the state of every group, or of the
+// group given by the group query parameter, so dashboards need one call
+// instead of one per group.
+func handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Error: "method not allowed"})
+		return
+	}
+
+	var resp StateResponse
+	if group := r.URL.Query().Get("group"); group != "" {
+		if err := authorizeGroup(r.Context(), group); err != nil {
+			respond(w, http.StatusForbidden, Response{Status: StatusError, Group: group, Error: err.Error()})
+			return
+		}
+		state, err := runner.GetGroupState(r.Context(), group)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, runner.ErrInvalidGroup) {
+				status = http.StatusNotFound
+			}
+			respond(w, status, Response{Status: StatusError, Group: group, Error: err.Error()})
+			return
+		}
+		resp.Groups = []runner.GroupState{*state}
+	} else {
+		states, err := runner.GetState(r.Context())
+		if err != nil {
+			tracing.Printf(r.Context(), "Failed to get state: %v", err)
+			respond(w, http.StatusInternalServerError, Response{Status: StatusError, Error: err.Error()})
+			return
+		}
+		// Callers only see the groups they may use
+		resp.Groups = make([]runner.GroupState, 0, len(states))
+		for _, state := range states {
+			if authorizeGroup(r.Context(), state.Group) == nil {
+				resp.Groups = append(resp.Groups, state)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"autoassigner/history"
+	"autoassigner/runner"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// defaultStatsWindow is the window of GET /groups/{group}/stats without a
+// window query parameter.
+const defaultStatsWindow = "30d"
+
+// handleStats serves GET /groups/{group}/stats: the assignments, shares,
+// skips and declines of the users of a group within a window, such as
+// ?window=30d, aggregated for dashboards like the Grafana JSON datasource.
+func handleStats(w http.ResponseWriter, r *http.Request, group string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		respond(w, http.StatusMethodNotAllowed, Response{Status: StatusError, Error: "method not allowed"})
+		return
+	}
+	if err := authorizeGroup(r.Context(), group); err != nil {
+		respond(w, http.StatusForbidden, Response{Status: StatusError, Group: group, Error: err.Error()})
+		return
+	}
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = defaultStatsWindow
+	}
+	if _, err := history.ParseWindow(window); err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Group: group, Error: err.Error()})
+		return
+	}
+
+	stats, err := runner.GetWindowStats(r.Context(), group, window)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, runner.ErrInvalidGroup) {
+			status = http.StatusNotFound
+		}
+		respond(w, status, Response{Status: StatusError, Group: group, Error: err.Error()})
+		return
+	}
+	recordAccess(w, func(entry *AccessEntry) { entry.Group = group })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
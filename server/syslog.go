@@ -0,0 +1,36 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/syslog"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// syslogSink sends entries as RFC 5424 messages with a JSON body and the
+// facility "log audit" to a syslog server, or to the local syslog daemon
+// when no address is given.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink(conf config.AuditSinkConfig) (*syslogSink, error) {
+	writer, err := syslog.New(conf.Network, conf.Address, syslog.FacilityAudit, conf.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) Record(ctx context.Context, entry AccessEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	severity := syslog.SeverityInfo
+	if entry.Status == http.StatusUnauthorized || entry.Status == http.StatusForbidden {
+		severity = syslog.SeverityNotice
+	}
+	return s.writer.Send(ctx, severity, entry.Time, body)
+}
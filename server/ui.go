@@ -0,0 +1,515 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"autoassigner/runner"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uiRoute is the route of the web UI in server.auth policies; its pages
+// are below it, e.g. /ui/pause.
+const uiRoute = "/ui"
+
+const (
+	uiSessionCookie       = "autoassigner_session"
+	uiLoginCookie         = "autoassigner_login"
+	uiStatsWindow         = "30d"
+	defaultUISessionHours = 12
+	uiLoginTimeout        = 10 * time.Minute
+)
+
+// UI serves the self-service web UI of config.Settings.Server.UI:
+//
+//	GET  /ui          Pauses and stats of the logged in user, logging in first
+//	GET  /ui/login    Redirects to the provider to log in
+//	GET  /ui/callback Completes a login the provider redirected back from
+//	POST /ui/pause    Pauses the user, or schedules a pause with from
+//	POST /ui/resume   Ends or cancels the pause of the user
+//	POST /ui/logout   Ends the session
+//
+// People log in with the authorization code flow of the OpenID Connect
+// provider of server.auth.oidc. The claim of auth.oidc names them, mapped
+// to a username by the identity config when ui.identity_kind is set, and
+// server.auth policies must allow them the route /ui like callers of the
+// API. Browsers send no bearer tokens, so the UI isn't wrapped with
+// Protect; wrap it with Audit to record the changes people make, whose
+// entries name them as actor.
+type UI struct {
+	mu       sync.Mutex
+	verifier *OIDCAuthorizer // Verifies ID tokens, made again when the provider or client changes
+	client   string          // Issuer and client ID verifier was made for
+}
+
+// NewUI returns the web UI of the current settings.
+func NewUI() *UI {
+	return &UI{}
+}
+
+func (u *UI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conf := config.Settings.Server.UI
+	if conf.ClientID == "" {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.URL.Path {
+	case uiRoute, uiRoute + "/":
+		u.home(w, r, conf)
+	case uiRoute + "/login":
+		u.login(w, r, conf)
+	case uiRoute + "/callback":
+		u.callback(w, r, conf)
+	case uiRoute + "/pause", uiRoute + "/resume", uiRoute + "/logout":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		u.change(w, r, conf)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// uiSession is the content of the session cookie of a logged in user.
+type uiSession struct {
+	User    string `json:"user"`
+	Expires int64  `json:"exp"` // Unix time the session ends
+}
+
+// uiLogin is the content of the cookie of a login in progress, binding the
+// redirect back from the provider to the browser that started it.
+type uiLogin struct {
+	State   string `json:"state"`
+	Nonce   string `json:"nonce"`
+	Expires int64  `json:"exp"`
+}
+
+// session returns the user of the session of r, the session cookie value
+// and whether the session is valid. Users no longer allowed the UI by the
+// policies are logged out.
+func (u *UI) session(r *http.Request, conf config.UIConfig) (string, string, bool) {
+	cookie, err := r.Cookie(uiSessionCookie)
+	if err != nil {
+		return "", "", false
+	}
+	var s uiSession
+	if !openValue(conf.SessionSecret, cookie.Value, &s) || s.User == "" || timeNow().Unix() >= s.Expires {
+		return "", "", false
+	}
+	if !Policies(config.Settings.Server.Auth.Policies).allows(s.User, uiRoute, "") {
+		return "", "", false
+	}
+	return s.User, cookie.Value, true
+}
+
+// home shows the pause and stats of the logged in user, or sends others to log in.
+func (u *UI) home(w http.ResponseWriter, r *http.Request, conf config.UIConfig) {
+	user, value, ok := u.session(r, conf)
+	if !ok {
+		http.Redirect(w, r, uiRoute+"/login", http.StatusFound)
+		return
+	}
+	recordAccess(w, func(entry *AccessEntry) { entry.Actor = user })
+	u.render(w, r, conf, user, value, http.StatusOK, "")
+}
+
+// uiPage is the data of the page of a logged in user.
+type uiPage struct {
+	User  string
+	CSRF  string
+	Error string
+	Pause *runner.Pause  // Pause of the user, nil when they aren't paused
+	Stats []uiGroupStats // Groups of the user with their assignments in the window
+	Since string         // Start of the window of the stats
+}
+
+// uiGroupStats are the assignments of the user in one of their groups.
+type uiGroupStats struct {
+	Group string
+	runner.WindowUserStats
+}
+
+// render writes the page of user with status, showing problem when it isn't empty.
+func (u *UI) render(w http.ResponseWriter, r *http.Request, conf config.UIConfig, user, session string, status int, problem string) {
+	page := uiPage{User: user, CSRF: uiMAC(conf.SessionSecret, "csrf."+session), Error: problem}
+	pauses, err := runner.ListPauses()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range pauses {
+		if pauses[i].User == user {
+			page.Pause = &pauses[i]
+		}
+	}
+	groups, err := runner.MemberGroups(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, group := range groups {
+		stats, err := runner.GetWindowStats(r.Context(), group, uiStatsWindow)
+		if err != nil {
+			log.Printf("Warning: failed to read the stats of %s for the web UI: %v", group, err)
+			continue
+		}
+		page.Since = stats.Since
+		for _, s := range stats.Users {
+			if s.User == user {
+				page.Stats = append(page.Stats, uiGroupStats{Group: group, WindowUserStats: s})
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := uiTemplate.Execute(w, page); err != nil {
+		log.Printf("Failed to render the web UI: %v", err)
+	}
+}
+
+// login redirects to the authorization endpoint of the provider.
+func (u *UI) login(w http.ResponseWriter, r *http.Request, conf config.UIConfig) {
+	endpoints, err := discoverEndpoints(r.Context(), config.Settings.Server.Auth.OIDC.Issuer)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to reach the login provider: %v", err), http.StatusBadGateway)
+		return
+	}
+	login := uiLogin{State: randomToken(), Nonce: randomToken(), Expires: timeNow().Add(uiLoginTimeout).Unix()}
+	value, err := signValue(conf.SessionSecret, login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setCookie(w, conf, uiLoginCookie, value, uiLoginTimeout)
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {conf.ClientID},
+		"redirect_uri":  {conf.RedirectURL},
+		"scope":         {"openid profile email"},
+		"state":         {login.State},
+		"nonce":         {login.Nonce},
+	}
+	sep := "?"
+	if strings.Contains(endpoints.Authorization, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, endpoints.Authorization+sep+query.Encode(), http.StatusFound)
+}
+
+// callback completes a login: it exchanges the code the provider redirected
+// back with for an ID token, and starts a session for the user it names.
+func (u *UI) callback(w http.ResponseWriter, r *http.Request, conf config.UIConfig) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		http.Error(w, fmt.Sprintf("login failed: %s %s", e, query.Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+	var login uiLogin
+	cookie, err := r.Cookie(uiLoginCookie)
+	if err != nil || !openValue(conf.SessionSecret, cookie.Value, &login) || timeNow().Unix() >= login.Expires ||
+		!hmac.Equal([]byte(login.State), []byte(query.Get("state"))) {
+		http.Error(w, "login expired or started elsewhere, please log in again", http.StatusBadRequest)
+		return
+	}
+	setCookie(w, conf, uiLoginCookie, "", -1)
+
+	claims, err := u.exchange(r.Context(), conf, query.Get("code"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("login failed: %v", err), http.StatusUnauthorized)
+		return
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != login.Nonce {
+		http.Error(w, "login failed: the ID token is not for this login", http.StatusUnauthorized)
+		return
+	}
+	user, err := uiUser(r.Context(), conf, claims)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("login failed: %v", err), http.StatusUnauthorized)
+		return
+	}
+	recordAccess(w, func(entry *AccessEntry) { entry.Actor = user })
+	if !Policies(config.Settings.Server.Auth.Policies).allows(user, uiRoute, "") {
+		http.Error(w, fmt.Sprintf("%s: %s may not use the web UI", ErrForbidden, user), http.StatusForbidden)
+		return
+	}
+
+	hours := conf.SessionHours
+	if hours == 0 {
+		hours = defaultUISessionHours
+	}
+	lifetime := time.Duration(hours) * time.Hour
+	value, err := signValue(conf.SessionSecret, uiSession{User: user, Expires: timeNow().Add(lifetime).Unix()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setCookie(w, conf, uiSessionCookie, value, lifetime)
+	http.Redirect(w, r, uiRoute, http.StatusSeeOther)
+}
+
+// exchange trades an authorization code for an ID token at the token
+// endpoint of the provider and returns its verified claims.
+func (u *UI) exchange(ctx context.Context, conf config.UIConfig, code string) (map[string]interface{}, error) {
+	if code == "" {
+		return nil, fmt.Errorf("no authorization code")
+	}
+	oidc := config.Settings.Server.Auth.OIDC
+	endpoints, err := discoverEndpoints(ctx, oidc.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {conf.RedirectURL}}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.Token, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("malformed token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded with %s: %s %s", resp.Status, tokens.Error, tokens.Description)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	u.mu.Lock()
+	if client := oidc.Issuer + " " + conf.ClientID; u.verifier == nil || u.client != client {
+		u.verifier = NewOIDCAuthorizer(config.OIDCConfig{Issuer: oidc.Issuer, Audience: conf.ClientID, JWKSURL: oidc.JWKSURL})
+		u.client = client
+	}
+	verifier := u.verifier
+	u.mu.Unlock()
+	return verifier.verify(ctx, tokens.IDToken)
+}
+
+// uiUser returns the username named by the claim of auth.oidc, mapped by
+// the identity config when ui.identity_kind is set.
+func uiUser(ctx context.Context, conf config.UIConfig, claims map[string]interface{}) (string, error) {
+	claim := config.Settings.Server.Auth.OIDC.Claim
+	if claim == "" {
+		claim = "sub"
+	}
+	name, _ := claims[claim].(string)
+	if name == "" {
+		return "", fmt.Errorf("ID token has no %s claim", claim)
+	}
+	if conf.IdentityKind == "" {
+		return name, nil
+	}
+	user, err := identity.User(ctx, conf.IdentityKind, name)
+	if err != nil {
+		return "", fmt.Errorf("unknown user %s: %w", name, err)
+	}
+	return user, nil
+}
+
+// change pauses, resumes or logs out the logged in user, answering with
+// the page again.
+func (u *UI) change(w http.ResponseWriter, r *http.Request, conf config.UIConfig) {
+	user, session, ok := u.session(r, conf)
+	if !ok {
+		http.Error(w, "not logged in", http.StatusUnauthorized)
+		return
+	}
+	recordAccess(w, func(entry *AccessEntry) { entry.Actor = user })
+	if !hmac.Equal([]byte(r.PostFormValue("csrf")), []byte(uiMAC(conf.SessionSecret, "csrf."+session))) {
+		http.Error(w, "the form expired, please reload the page", http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case uiRoute + "/pause":
+		now := timeNow()
+		until, err := runner.ParsePauseEnd(r.PostFormValue("until"), now)
+		if err != nil {
+			u.render(w, r, conf, user, session, http.StatusBadRequest, err.Error())
+			return
+		}
+		var from time.Time
+		if value := strings.TrimSpace(r.PostFormValue("from")); value != "" && value != "now" {
+			if from, err = runner.ParsePauseEnd(value, now); err != nil {
+				u.render(w, r, conf, user, session, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if err := runner.SchedulePause(r.Context(), user, from, until, "ui:"+user); err != nil {
+			// Pauses another caller is writing answer 503 like busy groups; the rest are invalid
+			status := http.StatusBadRequest
+			if errors.Is(err, runner.ErrLockTimeout) {
+				status = http.StatusServiceUnavailable
+			}
+			u.render(w, r, conf, user, session, status, err.Error())
+			return
+		}
+		recordAccess(w, func(entry *AccessEntry) {
+			entry.Until = until.Format(time.RFC3339)
+			if from.After(now) {
+				entry.From = from.Format(time.RFC3339)
+			}
+		})
+	case uiRoute + "/resume":
+		if _, err := runner.ResumeUser(r.Context(), user); err != nil {
+			u.render(w, r, conf, user, session, errorStatus(err), err.Error())
+			return
+		}
+	default: // logout
+		setCookie(w, conf, uiSessionCookie, "", -1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!DOCTYPE html><html><head><meta charset="utf-8"><title>Autoassigner</title></head><body><p>Logged out. <a href="`+uiRoute+`">Log in again</a></p></body></html>`)
+		return
+	}
+	http.Redirect(w, r, uiRoute, http.StatusSeeOther)
+}
+
+// oidcEndpoints are the endpoints of the authorization code flow of a provider.
+type oidcEndpoints struct {
+	Authorization string `json:"authorization_endpoint"`
+	Token         string `json:"token_endpoint"`
+}
+
+// discoverEndpoints reads the endpoints of the issuer's discovery document.
+func discoverEndpoints(ctx context.Context, issuer string) (*oidcEndpoints, error) {
+	var endpoints oidcEndpoints
+	if err := getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &endpoints); err != nil {
+		return nil, err
+	}
+	if endpoints.Authorization == "" || endpoints.Token == "" {
+		return nil, fmt.Errorf("discovery document has no authorization_endpoint or token_endpoint")
+	}
+	return &endpoints, nil
+}
+
+// setCookie sets a cookie of the UI, or removes it with a negative maxAge.
+// Cookies are only sent over HTTPS when the UI is served over HTTPS.
+func setCookie(w http.ResponseWriter, conf config.UIConfig, name, value string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     uiRoute,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(conf.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(maxAge.Seconds()),
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// signValue encodes v as a cookie value signed with secret, so it can't be forged.
+func signValue(secret string, v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + uiMAC(secret, payload), nil
+}
+
+// openValue decodes a value of signValue into v and reports whether it was
+// signed with secret.
+func openValue(secret, value string, v interface{}) bool {
+	payload, mac, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(uiMAC(secret, payload))) {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	return err == nil && json.Unmarshal(data, v) == nil
+}
+
+// uiMAC returns the HMAC-SHA256 of value with secret.
+func uiMAC(secret, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// randomToken returns an unguessable token for the state and nonce of a login.
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// uiTemplate renders the page of a logged in user.
+var uiTemplate = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"percent": func(share float64) string { return fmt.Sprintf("%.0f%%", share*100) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Autoassigner</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+header { display: flex; justify-content: space-between; align-items: center; }
+form { display: inline; }
+fieldset { border: 1px solid #ccc; padding: 1rem; margin: 1rem 0; }
+label { margin-right: 1rem; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4rem .6rem; border-bottom: 1px solid #ddd; }
+.error { color: #a00; }
+</style>
+</head>
+<body>
+<header>
+<h1>Autoassigner</h1>
+<form method="post" action="/ui/logout"><input type="hidden" name="csrf" value="{{.CSRF}}"><span>{{.User}}</span> <button>Log out</button></form>
+</header>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<h2>Pause</h2>
+{{with .Pause}}{{if .From}}<p>Your pause is scheduled from {{.From}} until {{.Until}}.</p>{{else}}<p>You are paused in every group until {{.Until}}.</p>{{end}}
+<form method="post" action="/ui/resume"><input type="hidden" name="csrf" value="{{$.CSRF}}"><button>{{if .From}}Cancel the pause{{else}}Resume now{{end}}</button></form>
+{{else}}<p>You are in the rotation of every group you are a member of.</p>{{end}}
+<form method="post" action="/ui/pause">
+<fieldset>
+<legend>{{if .Pause}}Replace the pause{{else}}Pause yourself or schedule a vacation{{end}}</legend>
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+<label>From <input name="from" placeholder="now, or e.g. 2024-07-01"></label>
+<label>Until <input name="until" required placeholder="e.g. monday, 2024-07-15 or 2w"></label>
+<button>Pause</button>
+</fieldset>
+</form>
+<h2>Your assignments{{if .Since}} since {{.Since}}{{end}}</h2>
+{{if .Stats}}<table>
+<tr><th>Group</th><th>Assigned</th><th>Share</th><th>Skipped</th><th>Declined</th><th>Open</th></tr>
+{{range .Stats}}<tr><td>{{.Group}}</td><td>{{.Assignments}}</td><td>{{percent .Share}}</td><td>{{.Skips}}</td><td>{{.Declines}}</td><td>{{.Open}}</td></tr>
+{{end}}</table>{{else}}<p>You are not a member of any group.</p>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"autoassigner/config"
+	"autoassigner/zendesk"
+	"net/http"
+)
+
+// handleZendesk assigns tickets sent by Zendesk triggers to an agent.
+// Tickets that are already assigned or whose group is not mapped are ignored.
+func handleZendesk(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readPayload(w, r)
+	if !ok {
+		return
+	}
+	if secret := config.Settings.Zendesk.WebhookSecret; secret != "" && !zendesk.VerifySignature(secret,
+		r.Header.Get("X-Zendesk-Webhook-Signature-Timestamp"), payload, r.Header.Get("X-Zendesk-Webhook-Signature")) {
+		respond(w, http.StatusUnauthorized, Response{Status: StatusError, Error: "invalid signature"})
+		return
+	}
+	ticket, err := zendesk.ParseTicket(payload)
+	if err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: StatusError, Error: err.Error()})
+		return
+	}
+	if ticket.AssigneeID != "" {
+		respond(w, http.StatusOK, Response{Status: StatusIgnored})
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		if group, ok = zendesk.Group(*ticket); !ok {
+			respond(w, http.StatusOK, Response{Status: StatusIgnored})
+			return
+		}
+	}
+
+	resp, status := assignFrom(r.Context(), group, ticket, requestOptions(r))
+	if resp.Status != StatusAssigned {
+		respond(w, status, resp)
+		return
+	}
+	if resp.Login, err = zendesk.Agent(r.Context(), resp.Assignee); err != nil {
+		writeBackFailed(w, ticket, resp, err)
+		return
+	}
+	if err := zendesk.Assign(r.Context(), *ticket, resp.Login); err != nil {
+		writeBackFailed(w, ticket, resp, err)
+		return
+	}
+	respond(w, status, resp)
+}
@@ -0,0 +1,230 @@
+// Package servicenow integrates the autoassigner with ServiceNow: it reads
+// incident records sent by outbound REST messages or found by polling, and
+// sets their assignee through the Table API.
+package servicenow
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Record is a record to assign, usually an incident.
+type Record struct {
+	SysID     string // sys_id of the record
+	Number    string // Number of the record, e.g. INC0010001
+	Title     string // Value of the title field
+	Group     string // sys_id of the group field, or its value when it is not a reference
+	GroupName string // Display value of the group field
+	Assignee  string // Value of the assignee field, empty for unassigned records
+}
+
+// String returns the number of the record, or its sys_id when it has none.
+func (r Record) String() string {
+	if r.Number != "" {
+		return r.Number
+	}
+	return r.SysID
+}
+
+// field is the value of a record field. The Table API returns plain values,
+// or objects with value and display_value with sysparm_display_value=all.
+type field struct {
+	Value        string
+	DisplayValue string
+}
+
+func (f *field) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		var v struct {
+			Value        string `json:"value"`
+			DisplayValue string `json:"display_value"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		f.Value, f.DisplayValue = v.Value, v.DisplayValue
+		return nil
+	}
+	return json.Unmarshal(data, &f.Value)
+}
+
+// ParseRecord reads a record from the JSON object a webhook sends, holding
+// the record's fields by name.
+func ParseRecord(payload []byte) (*Record, error) {
+	var fields map[string]field
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse ServiceNow record: %w", err)
+	}
+	r := toRecord(fields)
+	if r.SysID == "" {
+		return nil, fmt.Errorf("ServiceNow record without a sys_id")
+	}
+	return r, nil
+}
+
+// toRecord picks the configured fields out of a record.
+func toRecord(fields map[string]field) *Record {
+	group := fields[groupField()]
+	return &Record{
+		SysID:     fields["sys_id"].Value,
+		Number:    fields["number"].Value,
+		Title:     fields[titleField()].Value,
+		Group:     group.Value,
+		GroupName: group.DisplayValue,
+		Assignee:  fields[assignedToField()].Value,
+	}
+}
+
+// Group returns the autoassigner group mapped to the group field of a
+// record, by sys_id or display value. It reports false for unmapped records.
+func Group(r Record) (string, bool) {
+	groups := config.Settings.ServiceNow.Groups
+	for _, key := range []string{r.Group, r.GroupName} {
+		if group, ok := groups[key]; ok && key != "" {
+			return group, true
+		}
+	}
+	return "", false
+}
+
+// UserID returns the ServiceNow sys_id of a user from the identity mapping.
+// Users without one are written by their username, which ServiceNow
+// resolves against the user_name of its users.
+func UserID(ctx context.Context, user string) (string, error) {
+	id, err := identity.Lookup(ctx, user, identity.ServiceNow)
+	if errors.Is(err, identity.ErrUnknown) {
+		return user, nil
+	}
+	return id, err
+}
+
+// Assign writes userID to the assignee field of a record, along with the
+// configured set_fields.
+func Assign(ctx context.Context, r Record, userID string) error {
+	conf := config.Settings.ServiceNow
+	body := map[string]string{}
+	for name, value := range conf.SetFields {
+		body[name] = value
+	}
+	body[assignedToField()] = userID
+	path := fmt.Sprintf("/api/now/table/%s/%s", table(), url.PathEscape(r.SysID))
+	return call(ctx, http.MethodPatch, path, body, nil)
+}
+
+// UnassignedRecords returns the records matching the poll query.
+func UnassignedRecords(ctx context.Context) ([]Record, error) {
+	query := config.Settings.ServiceNow.PollQuery
+	if query == "" {
+		query = "active=true^" + assignedToField() + "ISEMPTY"
+	}
+	params := url.Values{}
+	params.Set("sysparm_query", query)
+	params.Set("sysparm_fields", strings.Join([]string{"sys_id", "number", titleField(), groupField()}, ","))
+	params.Set("sysparm_display_value", "all")
+	params.Set("sysparm_limit", "100")
+
+	var result struct {
+		Result []map[string]field `json:"result"`
+	}
+	if err := call(ctx, http.MethodGet, "/api/now/table/"+table()+"?"+params.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(result.Result))
+	for _, fields := range result.Result {
+		records = append(records, *toRecord(fields))
+	}
+	return records, nil
+}
+
+func table() string {
+	if t := config.Settings.ServiceNow.Table; t != "" {
+		return t
+	}
+	return "incident"
+}
+
+func groupField() string {
+	if f := config.Settings.ServiceNow.GroupField; f != "" {
+		return f
+	}
+	return "assignment_group"
+}
+
+func assignedToField() string {
+	if f := config.Settings.ServiceNow.AssignedToField; f != "" {
+		return f
+	}
+	return "assigned_to"
+}
+
+func titleField() string {
+	if f := config.Settings.ServiceNow.TitleField; f != "" {
+		return f
+	}
+	return "short_description"
+}
+
+// call sends a request to the ServiceNow REST API, authenticated with the
+// access token or else basic auth, and decodes the response into result
+// unless it is nil.
+func call(ctx context.Context, method, path string, body, result interface{}) error {
+	conf := config.Settings.ServiceNow
+	if conf.InstanceUrl == "" {
+		return fmt.Errorf("instance_url is required in servicenow configuration")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(conf.InstanceUrl, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case conf.Token != "":
+		req.Header.Set("Authorization", "Bearer "+conf.Token)
+	case conf.Username != "":
+		req.SetBasicAuth(conf.Username, conf.Password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ServiceNow request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+				Detail  string `json:"detail"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Error.Message != "" {
+			return fmt.Errorf("ServiceNow request failed: %s: %s", resp.Status, apiErr.Error.Message)
+		}
+		return fmt.Errorf("ServiceNow request failed: unexpected status %s", resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,152 @@
+package servicenow
+
+import (
+	"autoassigner/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRecord(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    *Record
+		wantErr bool
+	}{
+		{
+			payload: `{"sys_id": "abc", "number": "INC0010001", "short_description": "VPN down", "assignment_group": "d625dccec0a8016700a222a0f7900d06"}`,
+			want:    &Record{SysID: "abc", Number: "INC0010001", Title: "VPN down", Group: "d625dccec0a8016700a222a0f7900d06"},
+		},
+		// Reference fields with display values
+		{
+			payload: `{"sys_id": "abc", "assignment_group": {"value": "d625", "display_value": "Service Desk"}, "assigned_to": {"value": "", "display_value": ""}}`,
+			want:    &Record{SysID: "abc", Group: "d625", GroupName: "Service Desk"},
+		},
+		{
+			payload: `{"sys_id": "abc", "assigned_to": "6816f79cc0a8016401c5a33be04be441"}`,
+			want:    &Record{SysID: "abc", Assignee: "6816f79cc0a8016401c5a33be04be441"},
+		},
+		{payload: `{"number": "INC0010001"}`, wantErr: true},
+		{payload: `{"sys_id": 42}`, wantErr: true},
+		{payload: `{`, wantErr: true},
+	}
+	for i, tt := range tests {
+		got, err := ParseRecord([]byte(tt.payload))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d ParseRecord() error = %v, wantErr %v", i, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d ParseRecord() = %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.ServiceNow.Groups = map[string]string{"Service Desk": "service-desk", "d625": "network"}
+
+	tests := []struct {
+		record Record
+		want   string
+		wantOK bool
+	}{
+		{record: Record{Group: "d625", GroupName: "Network"}, want: "network", wantOK: true},
+		{record: Record{Group: "e317", GroupName: "Service Desk"}, want: "service-desk", wantOK: true},
+		{record: Record{Group: "e317", GroupName: "Database"}},
+		{record: Record{}},
+	}
+	for i, tt := range tests {
+		if got, ok := Group(tt.record); got != tt.want || ok != tt.wantOK {
+			t.Errorf("#%d Group() = %q, %v, want %q, %v", i, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestTableAPI(t *testing.T) {
+	var updates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "bot" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"message": "User Not Authenticated", "detail": "Required to provide Auth information"}, "status": "failure"}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/now/table/sn_customerservice_case":
+			if q := r.URL.Query(); q.Get("sysparm_query") != "active=true^assigned_to_userISEMPTY" || q.Get("sysparm_display_value") != "all" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"result": [
+				{"sys_id": {"value": "abc", "display_value": "abc"}, "number": {"value": "CS0001", "display_value": "CS0001"}, "queue": {"value": "d625", "display_value": "Service Desk"}},
+				{"sys_id": {"value": "def", "display_value": "def"}, "number": {"value": "CS0002", "display_value": "CS0002"}, "queue": {"value": "", "display_value": ""}}
+			]}`))
+		case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/now/table/sn_customerservice_case/"):
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			updates = append(updates, r.URL.Path+" "+body["assigned_to_user"]+" "+body["state"])
+			w.Write([]byte(`{"result": {}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"message": "Invalid table"}, "status": "failure"}`))
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.ServiceNow = config.ServiceNowConfig{
+		InstanceUrl:     server.URL,
+		Username:        "bot",
+		Password:        "secret",
+		Table:           "sn_customerservice_case",
+		GroupField:      "queue",
+		AssignedToField: "assigned_to_user",
+		SetFields:       map[string]string{"state": "2"},
+	}
+	ctx := context.Background()
+
+	records, err := UnassignedRecords(ctx)
+	want := []Record{
+		{SysID: "abc", Number: "CS0001", Group: "d625", GroupName: "Service Desk"},
+		{SysID: "def", Number: "CS0002"},
+	}
+	if err != nil || !reflect.DeepEqual(records, want) {
+		t.Fatalf("UnassignedRecords() = %+v, %v, want %+v", records, err, want)
+	}
+
+	if err := Assign(ctx, records[0], "6816f79c"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if want := []string{"/api/now/table/sn_customerservice_case/abc 6816f79c 2"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+
+	config.Settings.ServiceNow.Table = "missing"
+	if err := Assign(ctx, records[0], "6816f79c"); err == nil || !strings.Contains(err.Error(), "Invalid table") {
+		t.Errorf("Assign() error = %v, want the instance's message", err)
+	}
+	config.Settings.ServiceNow.Password = "wrong"
+	if _, err := UnassignedRecords(ctx); err == nil || !strings.Contains(err.Error(), "User Not Authenticated") {
+		t.Errorf("UnassignedRecords() error = %v, want the instance's message", err)
+	}
+}
+
+func TestUserID(t *testing.T) {
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Identity = config.IdentityConfig{Users: map[string]map[string]string{
+		"alice": {"servicenow": "6816f79cc0a8016401c5a33be04be441"},
+	}}
+
+	for user, want := range map[string]string{"alice": "6816f79cc0a8016401c5a33be04be441", "bob": "bob"} {
+		if got, err := UserID(context.Background(), user); err != nil || got != want {
+			t.Errorf("UserID(%s) = %q, %v, want %q", user, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package slack is a minimal client of Slack for the bot of "autoassigner
+// serve": it receives events and slash commands in Socket Mode over a
+// WebSocket and posts messages with the Web API, which is all the bot needs
+// without a client library.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultApiUrl is the URL of the Web API used when Client.URL is empty.
+const DefaultApiUrl = "https://slack.com/api"
+
+// ErrDisconnect is matched by the error of Conn.Next when Slack asks the
+// client to reconnect, such as before the connection is refreshed.
+var ErrDisconnect = errors.New("disconnected by Slack")
+
+// Client calls the Web API and opens Socket Mode connections.
+type Client struct {
+	URL      string       // URL of the Web API; DefaultApiUrl when empty
+	AppToken string       // App-level token opening Socket Mode connections (xapp-...)
+	BotToken string       // Bot token posting messages (xoxb-...)
+	HTTP     *http.Client // Client to send requests with; http.DefaultClient when nil
+}
+
+// APIError is a response of the Web API with "ok": false.
+type APIError struct {
+	Method string // Method of the API called, e.g. chat.postMessage
+	Code   string // Error code from the response, e.g. invalid_auth
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("slack %s failed: %s", e.Method, e.Code)
+}
+
+// Envelope is a message of a Socket Mode connection, which is acknowledged
+// with Conn.Ack.
+type Envelope struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Type       string          `json:"type"`    // events_api, slash_commands or interactive
+	Payload    json.RawMessage `json:"payload"` // Event callback or slash command, depending on the type
+	Reason     string          `json:"reason"`  // Why a disconnect envelope was sent
+}
+
+// EventCallback is the payload of an events_api envelope.
+type EventCallback struct {
+	EventID string `json:"event_id"` // Identifier of the event, the same when it is delivered again
+	Event   Event  `json:"event"`
+}
+
+// Event is the part of a message or app_mention event the bot uses.
+type Event struct {
+	Type        string `json:"type"`         // message or app_mention
+	Subtype     string `json:"subtype"`      // Set for edits, joins and other messages not written by a user
+	User        string `json:"user"`         // Member ID of the author
+	BotID       string `json:"bot_id"`       // Set for messages of bots
+	Text        string `json:"text"`         // Text of the message, mentions written as <@U123>
+	Channel     string `json:"channel"`      // Channel the message was posted in
+	ChannelType string `json:"channel_type"` // im for direct messages
+	TS          string `json:"ts"`           // Timestamp identifying the message
+	ThreadTS    string `json:"thread_ts"`    // Timestamp of the parent message of a reply in a thread
+}
+
+// SlashCommand is the payload of a slash_commands envelope.
+type SlashCommand struct {
+	Command     string `json:"command"`      // Command invoked, e.g. /autoassigner
+	Text        string `json:"text"`         // Text after the command
+	UserID      string `json:"user_id"`      // Member ID of the user who invoked it
+	ChannelID   string `json:"channel_id"`   // Channel it was invoked in
+	ResponseURL string `json:"response_url"` // URL replies are posted to
+	TriggerID   string `json:"trigger_id"`   // Identifier of the invocation
+}
+
+// Message is a message posted with chat.postMessage.
+type Message struct {
+	Channel  string `json:"channel"`
+	Text     string `json:"text"`
+	ThreadTS string `json:"thread_ts,omitempty"` // Posts a reply in the thread of this message
+}
+
+// Conn is a Socket Mode connection.
+type Conn struct {
+	ws *wsConn
+}
+
+// Connect opens a Socket Mode connection with apps.connections.open. Slack
+// sends events to one of the open connections of the app.
+func (c *Client) Connect(ctx context.Context) (*Conn, error) {
+	var opened struct {
+		URL string `json:"url"`
+	}
+	if err := c.call(ctx, "apps.connections.open", c.AppToken, nil, &opened); err != nil {
+		return nil, err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	ws, err := dialWebSocket(dialCtx, opened.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Slack: %w", err)
+	}
+	return &Conn{ws: ws}, nil
+}
+
+// PostMessage posts msg as the bot.
+func (c *Client) PostMessage(ctx context.Context, msg Message) error {
+	return c.call(ctx, "chat.postMessage", c.BotToken, msg, nil)
+}
+
+// Respond posts a reply to the response URL of a slash command, visible to
+// everyone in the channel.
+func (c *Client) Respond(ctx context.Context, responseURL, text string) error {
+	body, err := json.Marshal(map[string]string{"response_type": "in_channel", "text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack response URL returned %s", resp.Status)
+	}
+	return nil
+}
+
+// call posts body as JSON to a method of the Web API authenticated with
+// token and decodes the response into result unless it is nil.
+func (c *Client) call(ctx context.Context, method, token string, body, result interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	base := c.URL
+	if base == "" {
+		base = DefaultApiUrl
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(base, "/")+"/"+method, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMessage))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack %s returned %s", method, resp.Status)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("invalid response from slack %s: %w", method, err)
+	}
+	if !status.OK {
+		return &APIError{Method: method, Code: status.Error}
+	}
+	if result != nil {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+// Next returns the next envelope to handle, skipping the hello sent once
+// connected. It fails with an error matching ErrDisconnect when Slack asks
+// to reconnect, once the connection is lost or when ctx is done.
+func (c *Conn) Next(ctx context.Context) (*Envelope, error) {
+	// Unblock the read once ctx is done
+	stop := context.AfterFunc(ctx, func() { c.ws.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	for {
+		data, err := c.ws.readMessage()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("connection to Slack lost: %w", err)
+		}
+		var env Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			return nil, fmt.Errorf("invalid message from Slack: %w", err)
+		}
+		switch env.Type {
+		case "hello":
+		case "disconnect":
+			return nil, fmt.Errorf("%w: %s", ErrDisconnect, env.Reason)
+		default:
+			return &env, nil
+		}
+	}
+}
+
+// Ack acknowledges an envelope, which Slack expects within 3 seconds or
+// delivers it again.
+func (c *Conn) Ack(envelopeID string) error {
+	data, err := json.Marshal(map[string]string{"envelope_id": envelopeID})
+	if err != nil {
+		return err
+	}
+	return c.ws.writeFrame(opText, data)
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.ws.close()
+}
@@ -0,0 +1,148 @@
+package slack
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeServerFrame writes an unmasked frame as a server does.
+func writeServerFrame(w io.Writer, fin bool, opcode byte, payload string) {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	w.Write(append([]byte{first, byte(len(payload))}, payload...))
+}
+
+// readClientFrame reads a masked frame of a client.
+func readClientFrame(r *bufio.Reader) (byte, string, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, "", err
+	}
+	if header[1]&0x80 == 0 {
+		return 0, "", errors.New("unmasked client frame")
+	}
+	data := make([]byte, 4+int(header[1]&0x7F))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, "", err
+	}
+	payload := data[4:]
+	for i := range payload {
+		payload[i] ^= data[i%4]
+	}
+	return header[0] & 0x0F, string(payload), nil
+}
+
+func TestClient(t *testing.T) {
+	var posted Message
+	frames := make(chan string, 8)
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apps.connections.open":
+			if r.Header.Get("Authorization") != "Bearer xapp-1" {
+				w.Write([]byte(`{"ok": false, "error": "invalid_auth"}`))
+				return
+			}
+			w.Write([]byte(`{"ok": true, "url": "ws://` + api.Listener.Addr().String() + `/link?ticket=1"}`))
+		case "/link":
+			if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + websocketGUID))
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Hijack() error = %v", err)
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+			writeServerFrame(rw, true, opText, `{"type": "hello"}`)
+			writeServerFrame(rw, false, opText, `{"envelope_id": "e1", "type": "events_api", `)
+			writeServerFrame(rw, true, opPing, "p")
+			writeServerFrame(rw, true, opContinuation, `"payload": {"event_id": "Ev1"}}`)
+			rw.Flush()
+			for i := 0; i < 2; i++ {
+				opcode, payload, err := readClientFrame(rw.Reader)
+				if err != nil {
+					t.Errorf("failed to read client frame: %v", err)
+					return
+				}
+				frames <- fmt.Sprintf("%#x %s", opcode, payload)
+			}
+			writeServerFrame(rw, true, opText, `{"type": "disconnect", "reason": "refresh_requested"}`)
+			rw.Flush()
+			// Wait for the client to close
+			readClientFrame(rw.Reader)
+		case "/chat.postMessage":
+			if r.Header.Get("Authorization") != "Bearer xoxb-1" || r.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+				w.Write([]byte(`{"ok": false, "error": "not_authed"}`))
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&posted)
+			w.Write([]byte(`{"ok": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var apiErr *APIError
+	if _, err := (&Client{URL: api.URL, AppToken: "xapp-2"}).Connect(ctx); !errors.As(err, &apiErr) || apiErr.Code != "invalid_auth" {
+		t.Errorf("Connect() with an invalid token error = %v, want invalid_auth", err)
+	}
+
+	client := &Client{URL: api.URL, AppToken: "xapp-1", BotToken: "xoxb-1"}
+	conn, err := client.Connect(ctx)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer conn.Close()
+	env, err := conn.Next(ctx)
+	if err != nil || env.EnvelopeID != "e1" || env.Type != "events_api" || string(env.Payload) != `{"event_id": "Ev1"}` {
+		t.Fatalf("Next() = %+v, %v, want the fragmented events_api envelope", env, err)
+	}
+	if err := conn.Ack(env.EnvelopeID); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	for _, want := range []string{"0xa p", `0x1 {"envelope_id":"e1"}`} {
+		if got := <-frames; got != want {
+			t.Errorf("client frame = %q, want %q", got, want)
+		}
+	}
+	if _, err := conn.Next(ctx); !errors.Is(err, ErrDisconnect) || !strings.Contains(err.Error(), "refresh_requested") {
+		t.Errorf("Next() after a disconnect error = %v, want ErrDisconnect", err)
+	}
+
+	msg := Message{Channel: "C1", Text: "hi", ThreadTS: "1.2"}
+	if err := client.PostMessage(ctx, msg); err != nil || posted != msg {
+		t.Errorf("PostMessage() = %v, posted %+v, want %+v", err, posted, msg)
+	}
+}
+
+func TestNextCancelled(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	conn := &Conn{ws: &wsConn{conn: client, r: bufio.NewReader(client)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := conn.Next(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Next() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,246 @@
+package slack
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes (RFC 6455, section 5.2).
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// websocketGUID is appended to the key of the handshake to compute the
+// accept header of the server.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessage limits the size of messages read from the server.
+const maxMessage = 8 << 20
+
+// errClosed is returned when the server closed the connection.
+var errClosed = errors.New("connection closed by Slack")
+
+// wsConn is the client end of a WebSocket connection. Only the parts of the
+// protocol Socket Mode uses are implemented: text messages, fragmentation,
+// pings and closing, without extensions.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // Guards writes to conn
+}
+
+// dialWebSocket opens a WebSocket connection to rawURL, a wss:// URL or a
+// ws:// one for tests.
+func dialWebSocket(ctx context.Context, rawURL string) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebSocket URL: %w", err)
+	}
+	var port string
+	switch u.Scheme {
+	case "wss":
+		port = "443"
+	case "ws":
+		port = "80"
+	default:
+		return nil, fmt.Errorf("invalid WebSocket URL %s: scheme must be wss or ws", rawURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	ws, err := upgrade(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ws, nil
+}
+
+// upgrade sends the opening handshake and checks the answer of the server.
+func upgrade(conn net.Conn, u *url.URL) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+			"User-Agent":            {"autoassigner"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WebSocket handshake: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("WebSocket handshake failed: %s", resp.Status)
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) || !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		return nil, fmt.Errorf("WebSocket handshake failed: invalid upgrade response")
+	}
+	return &wsConn{conn: conn, r: r}, nil
+}
+
+// readMessage returns the payload of the next text or binary message,
+// reassembling fragments. Pings are answered meanwhile; a close frame is
+// answered and reported as errClosed.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			c.writeFrame(opClose, payload)
+			if len(payload) > 2 {
+				return nil, fmt.Errorf("%w: %s", errClosed, payload[2:])
+			}
+			return nil, errClosed
+		case opText, opBinary, opContinuation:
+			if (opcode == opContinuation) != started {
+				return nil, fmt.Errorf("invalid WebSocket fragmentation")
+			}
+			started = true
+			if len(message)+len(payload) > maxMessage {
+				return nil, fmt.Errorf("WebSocket message exceeds %d bytes", maxMessage)
+			}
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %#x", opcode)
+		}
+	}
+}
+
+// readFrame reads a frame from the server, which must not be masked.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0F
+	if header[1]&0x80 != 0 {
+		return false, 0, nil, fmt.Errorf("masked WebSocket frame from server")
+	}
+	size := uint64(header[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > maxMessage {
+		return false, 0, nil, fmt.Errorf("WebSocket frame exceeds %d bytes", maxMessage)
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends payload in a single masked frame, as clients must.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch size := len(payload); {
+	case size < 126:
+		frame = append(frame, 0x80|byte(size))
+	case size <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(size))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(size))
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// close sends a normal closure and closes the connection without waiting
+// for the answer of the server.
+func (c *wsConn) close() error {
+	c.writeFrame(opClose, []byte{0x03, 0xE8})
+	return c.conn.Close()
+}
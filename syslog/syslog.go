@@ -0,0 +1,120 @@
+// Package syslog sends RFC 5424 messages to a syslog server, or to the local
+// syslog daemon. Unlike log/syslog it builds on every platform, sets the
+// timestamp of each message and frames messages sent over TCP.
+package syslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Facilities and severities of messages (RFC 5424).
+const (
+	FacilityUser  = 1
+	FacilityAudit = 13 // log audit
+
+	SeverityNotice = 5
+	SeverityInfo   = 6
+)
+
+// timeout limits connecting to the server and writing a message.
+const timeout = 5 * time.Second
+
+// Writer sends messages to one syslog server over a connection it keeps
+// open between messages. It is safe for concurrent use.
+type Writer struct {
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn // Connection of the last message; nil after a failure
+}
+
+// New returns a Writer sending messages of facility, with tag as app name
+// (default autoassigner), to address over network: udp (default), tcp,
+// unix or unixgram. Without an address messages go to the local syslog
+// daemon.
+func New(network, address string, facility int, tag string) (*Writer, error) {
+	w := &Writer{network: network, address: address, facility: facility, tag: tag}
+	if w.tag == "" {
+		w.tag = "autoassigner"
+	}
+	if w.address == "" {
+		w.network, w.address = "unixgram", "/dev/log"
+	} else if w.network == "" {
+		w.network = "udp"
+	}
+	switch w.network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("unknown syslog network: %s", w.network)
+	}
+	w.hostname, _ = os.Hostname()
+	if w.hostname == "" {
+		w.hostname = "-"
+	}
+	return w, nil
+}
+
+// Send sends msg with severity as the message of an event at t.
+func (w *Writer) Send(ctx context.Context, severity int, t time.Time, msg []byte) error {
+	line := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", w.facility*8+severity,
+		t.UTC().Format(time.RFC3339Nano), w.hostname, w.tag, os.Getpid(), msg)
+	if w.network == "tcp" {
+		// Octet counting framing (RFC 6587), as messages may contain newlines
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.send(ctx, line); err != nil {
+		// Reconnect once, e.g. after the syslog server was restarted
+		return w.send(ctx, line)
+	}
+	return nil
+}
+
+// send writes line to the connection, dialing the server when there is
+// none. The connection is dropped when writing fails.
+func (w *Writer) send(ctx context.Context, line string) error {
+	if w.conn != nil && w.closedByServer() {
+		w.conn.Close()
+		w.conn = nil
+	}
+	if w.conn == nil {
+		dialer := net.Dialer{Timeout: timeout}
+		conn, err := dialer.DialContext(ctx, w.network, w.address)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := w.conn.Write([]byte(line)); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+// closedByServer reports whether the server closed the stream connection,
+// which writes wouldn't notice before the message is lost. Servers don't
+// send anything, so a read either times out at once or fails.
+func (w *Writer) closedByServer() bool {
+	if w.network != "tcp" && w.network != "unix" {
+		return false
+	}
+	w.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	_, err := w.conn.Read(make([]byte, 1))
+	var netErr net.Error
+	return !(errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,84 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	at := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	hostname, _ := os.Hostname()
+	want := "<110>1 2024-05-15T10:00:00Z " + hostname + " audit " + strconv.Itoa(os.Getpid()) + " - - {\"user\":\"alice\"}"
+
+	t.Run("udp", func(t *testing.T) {
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer server.Close()
+		w, err := New("", server.LocalAddr().String(), FacilityAudit, "audit")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if err := w.Send(context.Background(), SeverityInfo, at, []byte(`{"user":"alice"}`)); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		buf := make([]byte, 1024)
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil || string(buf[:n]) != want {
+			t.Errorf("message = %q, %v, want %q", buf[:n], err, want)
+		}
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		server, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer server.Close()
+		received := make(chan string, 2)
+		go func() {
+			// The first connection is closed after one message, so the writer reconnects
+			for i := 0; i < 2; i++ {
+				conn, err := server.Accept()
+				if err != nil {
+					return
+				}
+				line, _ := bufio.NewReader(conn).ReadString('}')
+				received <- line
+				conn.Close()
+			}
+		}()
+		w, err := New("tcp", server.Addr().String(), FacilityAudit, "audit")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		framed := strconv.Itoa(len(want)) + " " + want
+		for i := 0; i < 2; i++ {
+			if err := w.Send(context.Background(), SeverityInfo, at, []byte(`{"user":"alice"}`)); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			select {
+			case got := <-received:
+				if got != framed {
+					t.Errorf("message %d = %q, want %q", i, got, framed)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("message %d not received", i)
+			}
+			// Give the server time to close the connection
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+
+	if _, err := New("sctp", "localhost:514", FacilityUser, ""); err == nil || !strings.Contains(err.Error(), "sctp") {
+		t.Errorf("New(sctp) error = %v, want unknown network", err)
+	}
+}
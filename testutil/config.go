@@ -0,0 +1,63 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigTree is a temporary autoassigner configuration: a config.json,
+// a directory of group files and a data directory.
+type ConfigTree struct {
+	Dir        string // Root of the tree
+	ConfigPath string // Path of config.json, suitable for --config
+	ConfDir    string // Directory holding the group YAML files
+	DataDir    string // Directory holding assignment state
+}
+
+// NewConfigTree writes a config.json below dir that points at the given In/Out API prefix.
+// Statuses "OOO" and "AWAY" are treated as unavailable.
+func NewConfigTree(dir, inOutURL string) (*ConfigTree, error) {
+	t := &ConfigTree{
+		Dir:        dir,
+		ConfigPath: filepath.Join(dir, "config.json"),
+		ConfDir:    filepath.Join(dir, "etc"),
+		DataDir:    filepath.Join(dir, "data"),
+	}
+	if err := os.MkdirAll(t.ConfDir, 0755); err != nil {
+		return nil, err
+	}
+
+	cfg := map[string]interface{}{
+		"storage": map[string]string{
+			"data_dir": t.DataDir,
+			"conf_dir": t.ConfDir,
+		},
+		"availability": map[string]interface{}{
+			"inout_api_url_prefix":       inOutURL,
+			"inout_unavailable_statuses": []string{"OOO", "AWAY"},
+		},
+	}
+	data, err := json.MarshalIndent(cfg, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(t.ConfigPath, data, 0644); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AddGroup writes a group file with the given strategy, availability checker and users.
+func (t *ConfigTree) AddGroup(name, strategy, checker string, users ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "strategy: %s\n", strategy)
+	fmt.Fprintf(&b, "availability_checker: %s\n", checker)
+	b.WriteString("users:\n")
+	for _, user := range users {
+		fmt.Fprintf(&b, "  - %s\n", user)
+	}
+	return os.WriteFile(filepath.Join(t.ConfDir, name+".yaml"), []byte(b.String()), 0644)
+}
@@ -0,0 +1,102 @@
+// Package testutil provides fakes for writing end-to-end tests against the
+// autoassigner: a fake In/Out status API, a temporary configuration tree
+// and senders for GitHub, GitLab and Bitbucket style webhooks.
+package testutil
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// InOutServer is a fake In/Out API serving GET /status/<user> and POST /batch.
+// Users without a status are reported as being in the office.
+type InOutServer struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	statuses map[string]string
+}
+
+// NewInOutServer starts a fake In/Out API on a random local port.
+func NewInOutServer(statuses map[string]string) *InOutServer {
+	s := newInOutServer(statuses)
+	s.server = httptest.NewServer(s.handler())
+	return s
+}
+
+// NewInOutServerAt starts a fake In/Out API listening on addr, such as "127.0.0.1:8080".
+func NewInOutServerAt(addr string, statuses map[string]string) (*InOutServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := newInOutServer(statuses)
+	s.server = &httptest.Server{Listener: listener, Config: &http.Server{Handler: s.handler()}}
+	s.server.Start()
+	return s, nil
+}
+
+func newInOutServer(statuses map[string]string) *InOutServer {
+	s := &InOutServer{statuses: make(map[string]string)}
+	for user, status := range statuses {
+		s.statuses[user] = status
+	}
+	return s
+}
+
+// URL returns the value to use as inout_api_url_prefix.
+func (s *InOutServer) URL() string {
+	return s.server.URL + "/status/"
+}
+
+// BatchURL returns the value to use as inout_batch_api_url.
+func (s *InOutServer) BatchURL() string {
+	return s.server.URL + "/batch"
+}
+
+// SetStatus changes the status reported for a user.
+func (s *InOutServer) SetStatus(user, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[user] = status
+}
+
+// Close shuts the server down.
+func (s *InOutServer) Close() {
+	s.server.Close()
+}
+
+func (s *InOutServer) status(user string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status, ok := s.statuses[user]; ok {
+		return status
+	}
+	return "OFFICE"
+}
+
+func (s *InOutServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		user := strings.TrimPrefix(r.URL.Path, "/status/")
+		json.NewEncoder(w).Encode(map[string]string{"inOutLocation": s.status(user)})
+	})
+	mux.HandleFunc("/batch", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Users []string `json:"users"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response := make(map[string]map[string]string, len(body.Users))
+		for _, user := range body.Users {
+			response[user] = map[string]string{"inOutLocation": s.status(user)}
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+	return mux
+}
@@ -0,0 +1,162 @@
+package testutil_test
+
+import (
+	"autoassigner/config"
+	"autoassigner/runner"
+	"autoassigner/testutil"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEndToEnd(t *testing.T) {
+	server := testutil.NewInOutServer(map[string]string{"alice": "OOO"})
+	defer server.Close()
+
+	tree, err := testutil.NewConfigTree(t.TempDir(), server.URL())
+	if err != nil {
+		t.Fatalf("NewConfigTree() error = %v", err)
+	}
+	if err := tree.AddGroup("e2e", "round_robin", "inout", "alice", "bob"); err != nil {
+		t.Fatalf("AddGroup() error = %v", err)
+	}
+	if err := config.LoadConfig(tree.ConfigPath); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	// alice is out of office, so bob is picked
+	if err := runner.Assign("e2e", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	counts, _, err := runner.GetCounts("e2e")
+	if err != nil {
+		t.Fatalf("GetCounts() error = %v", err)
+	}
+	if counts["alice"] != 0 || counts["bob"] != 1 {
+		t.Errorf("counts = %v, want bob assigned", counts)
+	}
+
+	skips, err := runner.ReadSkips("e2e")
+	if err != nil || len(skips) != 1 || skips[0].User != "alice" || skips[0].Checker != "inout" || skips[0].AssignmentID == "" {
+		t.Errorf("ReadSkips() = %+v, %v, want alice skipped by inout", skips, err)
+	}
+
+	server.SetStatus("alice", "OFFICE")
+	if err := runner.Assign("e2e", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	counts, _, _ = runner.GetCounts("e2e")
+	if counts["alice"] != 1 {
+		t.Errorf("counts = %v, want alice assigned once back in office", counts)
+	}
+
+	stats, err := runner.GetStats(context.Background(), "e2e")
+	if err != nil || len(stats) != 2 {
+		t.Fatalf("GetStats() = %+v, %v", stats, err)
+	}
+	if stats[0].User != "alice" || stats[0].Assignments != 1 || stats[0].Skips != 1 || stats[0].LastSkipped == "" || stats[1].Skips != 0 {
+		t.Errorf("GetStats() = %+v, want alice assigned and skipped once", stats)
+	}
+}
+
+func TestSkipDebt(t *testing.T) {
+	server := testutil.NewInOutServer(map[string]string{"bob": "OOO"})
+	defer server.Close()
+
+	tree, err := testutil.NewConfigTree(t.TempDir(), server.URL())
+	if err != nil {
+		t.Fatalf("NewConfigTree() error = %v", err)
+	}
+	group := "strategy: round_robin\navailability_checker: inout\nusers: [alice, bob, carol, dave]\nstrategy_options:\n  skip_debt: true\n"
+	if err := os.WriteFile(filepath.Join(tree.ConfDir, "debt.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	if err := config.LoadConfig(tree.ConfigPath); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	// bob is skipped on his turn, then repaid as soon as he is back,
+	// after which the rotation continues where it left off
+	want := []string{"alice", "carol", "bob", "dave", "alice"}
+	var got []string
+	for i := range want {
+		if i == 2 {
+			server.SetStatus("bob", "OFFICE")
+		}
+		before, _, _ := runner.GetCounts("debt")
+		if err := runner.Assign("debt", false); err != nil {
+			t.Fatalf("Assign() error = %v", err)
+		}
+		after, _, _ := runner.GetCounts("debt")
+		for user := range after {
+			if after[user] != before[user] {
+				got = append(got, user)
+			}
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("assignments = %v, want %v", got, want)
+	}
+}
+
+func TestAvailabilityIDs(t *testing.T) {
+	// The API knows alice by her email address, under which she is out of office
+	server := testutil.NewInOutServer(map[string]string{"alice@example.com": "OOO"})
+	defer server.Close()
+
+	tree, err := testutil.NewConfigTree(t.TempDir(), server.URL())
+	if err != nil {
+		t.Fatalf("NewConfigTree() error = %v", err)
+	}
+	group := "strategy: round_robin\navailability_checker: inout\nusers:\n  - alice: {availability_id: alice@example.com}\n  - bob\n"
+	if err := os.WriteFile(filepath.Join(tree.ConfDir, "ids.yaml"), []byte(group), 0644); err != nil {
+		t.Fatalf("failed to write group: %v", err)
+	}
+	if err := config.LoadConfig(tree.ConfigPath); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if err := runner.Assign("ids", false); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	counts, _, err := runner.GetCounts("ids")
+	if err != nil || counts["alice"] != 0 || counts["bob"] != 1 {
+		t.Errorf("counts = %v, %v, want alice skipped as unavailable", counts, err)
+	}
+}
+
+func TestWebhookSenders(t *testing.T) {
+	var events []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events = append(events, r.Header.Get("X-GitHub-Event")+r.Header.Get("X-Gitlab-Event"))
+		if r.Header.Get("X-GitHub-Event") != "" && r.Header.Get("X-Hub-Signature-256") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer receiver.Close()
+
+	resp, err := testutil.SendGitHubPullRequest(receiver.URL, "secret", "org/repo", 1, "alice")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("SendGitHubPullRequest() = %v, %v", resp, err)
+	}
+	resp.Body.Close()
+	resp, err = testutil.SendGitLabMergeRequest(receiver.URL, "token", "group/project", 2, "bob")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("SendGitLabMergeRequest() = %v, %v", resp, err)
+	}
+	resp.Body.Close()
+
+	if len(events) != 2 || events[0] != "pull_request" || events[1] != "Merge Request Hook" {
+		t.Errorf("received events = %v", events)
+	}
+}
@@ -0,0 +1,102 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SendGitHubPullRequest posts a GitHub "pull_request" opened event to url.
+// When secret is not empty the payload is signed with X-Hub-Signature-256.
+func SendGitHubPullRequest(url, secret, repo string, number int, author string) (*http.Response, error) {
+	payload := map[string]interface{}{
+		"action": "opened",
+		"number": number,
+		"pull_request": map[string]interface{}{
+			"number": number,
+			"user":   map[string]string{"login": author},
+		},
+		"repository": map[string]string{"full_name": repo},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	req.Header.Set("X-GitHub-Delivery", fmt.Sprintf("test-%s-%d", repo, number))
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// SendGitLabMergeRequest posts a GitLab "Merge Request Hook" open event to url.
+// When token is not empty it is sent as X-Gitlab-Token.
+func SendGitLabMergeRequest(url, token, project string, iid int, author string) (*http.Response, error) {
+	payload := map[string]interface{}{
+		"object_kind": "merge_request",
+		"user":        map[string]string{"username": author},
+		"project":     map[string]string{"path_with_namespace": project},
+		"object_attributes": map[string]interface{}{
+			"iid":    iid,
+			"action": "open",
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Event", "Merge Request Hook")
+	if token != "" {
+		req.Header.Set("X-Gitlab-Token", token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// SendBitbucketPullRequest posts a Bitbucket Cloud "pullrequest:created" event to url.
+// When secret is not empty the payload is signed with X-Hub-Signature.
+func SendBitbucketPullRequest(url, secret, repo string, id int, author string) (*http.Response, error) {
+	payload := map[string]interface{}{
+		"pullrequest": map[string]interface{}{
+			"id":     id,
+			"title":  fmt.Sprintf("Pull request %d", id),
+			"author": map[string]string{"account_id": author},
+		},
+		"repository": map[string]string{"full_name": repo},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Key", "pullrequest:created")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,127 @@
+// Package tracing carries the correlation IDs of a request to the API, its
+// X-Request-ID and W3C traceparent, through the context of its handling to
+// the log, the assignment records and the requests made to other systems,
+// so an assignment can be traced back to the webhook delivery that
+// triggered it.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Headers carrying the IDs.
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceParent = "traceparent"
+)
+
+// IDs are the correlation IDs of a request.
+type IDs struct {
+	RequestID string // X-Request-ID of the request, or its trace ID when it had none
+	TraceID   string // ID of the W3C trace the request is part of, 32 hex digits
+	SpanID    string // ID of the handling of the request within the trace, 16 hex digits
+	Flags     string // Trace flags, such as 01 when the caller samples the trace
+}
+
+// TraceParent returns the traceparent header of the requests made while
+// handling the request, which continue its trace.
+func (ids IDs) TraceParent() string {
+	return "00-" + ids.TraceID + "-" + ids.SpanID + "-" + ids.Flags
+}
+
+var (
+	// requestIDPattern restricts request IDs to what is safe to log and pass on
+	requestIDPattern   = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]{1,128}$`)
+	traceParentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+)
+
+// FromRequest returns the IDs of an incoming request: its X-Request-ID and
+// the trace of its traceparent, continued with a new span. A trace is
+// started when the request has no valid traceparent, and its ID is the
+// request ID when the request has no valid X-Request-ID.
+func FromRequest(r *http.Request) IDs {
+	ids := IDs{SpanID: randomHex(8), Flags: "00"}
+	if m := traceParentPattern.FindStringSubmatch(strings.TrimSpace(r.Header.Get(HeaderTraceParent))); m != nil && m[1] != "ff" &&
+		m[2] != strings.Repeat("0", 32) && m[3] != strings.Repeat("0", 16) {
+		ids.TraceID, ids.Flags = m[2], m[4]
+	} else {
+		ids.TraceID = randomHex(16)
+	}
+	ids.RequestID = strings.TrimSpace(r.Header.Get(HeaderRequestID))
+	if !requestIDPattern.MatchString(ids.RequestID) {
+		ids.RequestID = ids.TraceID
+	}
+	return ids
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand doesn't fail on supported platforms
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying ids.
+func NewContext(ctx context.Context, ids IDs) context.Context {
+	return context.WithValue(ctx, contextKey{}, ids)
+}
+
+// FromContext returns the IDs carried by ctx, if any.
+func FromContext(ctx context.Context) (IDs, bool) {
+	ids, ok := ctx.Value(contextKey{}).(IDs)
+	return ids, ok
+}
+
+// Printf logs like log.Printf, prefixed with the request ID carried by
+// ctx, e.g. "[request 5f3a...] Failed to assign ...".
+func Printf(ctx context.Context, format string, args ...interface{}) {
+	if ids, ok := FromContext(ctx); ok {
+		format = "[request " + ids.RequestID + "] " + format
+	}
+	log.Output(2, fmt.Sprintf(format, args...))
+}
+
+// Transport is an http.RoundTripper passing the IDs carried by the context
+// of every request on in its X-Request-ID and traceparent headers, unless
+// they are set already.
+type Transport struct {
+	Base http.RoundTripper // Transport sending the requests; http.DefaultTransport when nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ids, ok := FromContext(req.Context())
+	if !ok || (req.Header.Get(HeaderRequestID) != "" && req.Header.Get(HeaderTraceParent) != "") {
+		return base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	if req.Header.Get(HeaderRequestID) == "" {
+		req.Header.Set(HeaderRequestID, ids.RequestID)
+	}
+	if req.Header.Get(HeaderTraceParent) == "" {
+		req.Header.Set(HeaderTraceParent, ids.TraceParent())
+	}
+	return base.RoundTrip(req)
+}
+
+// Install makes http.DefaultClient, which the integrations send their
+// requests with, pass the IDs on. Installing it again has no effect.
+func Install() {
+	if _, ok := http.DefaultClient.Transport.(*Transport); !ok {
+		http.DefaultClient.Transport = &Transport{Base: http.DefaultClient.Transport}
+	}
+}
@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	const trace = "4bf92f3577b34da6a3ce929d0e0736ab"
+	tests := []struct {
+		name        string
+		requestID   string
+		traceParent string
+		wantRequest string // Empty when the trace ID is the request ID
+		wantTrace   string // Empty when a trace is started
+		wantFlags   string
+	}{
+		{"both", "delivery-1", "00-" + trace + "-00f067aa0ba902b7-01", "delivery-1", trace, "01"},
+		{"request ID only", "5f3a:9c/1", "", "5f3a:9c/1", "", "00"},
+		{"traceparent only", "", " 00-" + trace + "-00f067aa0ba902b7-00 ", "", trace, "00"},
+		{"none", "", "", "", "", "00"},
+		{"invalid request ID", "bad id", "00-" + trace + "-00f067aa0ba902b7-01", "", trace, "01"},
+		{"request ID too long", strings.Repeat("a", 129), "", "", "", "00"},
+		{"zero trace ID", "", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", "00"},
+		{"zero span ID", "", "00-" + trace + "-0000000000000000-01", "", "", "00"},
+		{"invalid version", "", "ff-" + trace + "-00f067aa0ba902b7-01", "", "", "00"},
+		{"upper case", "", "00-" + "4BF92F3577B34DA6A3CE929D0E0736AB" + "-00f067aa0ba902b7-01", "", "", "00"},
+	}
+	hex := regexp.MustCompile(`^[0-9a-f]+$`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/zendesk", nil)
+			if tt.requestID != "" {
+				r.Header.Set(HeaderRequestID, tt.requestID)
+			}
+			if tt.traceParent != "" {
+				r.Header.Set(HeaderTraceParent, tt.traceParent)
+			}
+			ids := FromRequest(r)
+			if tt.wantTrace != "" && ids.TraceID != tt.wantTrace {
+				t.Errorf("TraceID = %s, want %s", ids.TraceID, tt.wantTrace)
+			}
+			if tt.wantTrace == "" && (ids.TraceID == trace || len(ids.TraceID) != 32 || !hex.MatchString(ids.TraceID)) {
+				t.Errorf("TraceID = %s, want a new one", ids.TraceID)
+			}
+			wantRequest := tt.wantRequest
+			if wantRequest == "" {
+				wantRequest = ids.TraceID
+			}
+			if ids.RequestID != wantRequest {
+				t.Errorf("RequestID = %s, want %s", ids.RequestID, wantRequest)
+			}
+			if len(ids.SpanID) != 16 || !hex.MatchString(ids.SpanID) || ids.SpanID == "00f067aa0ba902b7" {
+				t.Errorf("SpanID = %s, want a new one", ids.SpanID)
+			}
+			if ids.Flags != tt.wantFlags {
+				t.Errorf("Flags = %s, want %s", ids.Flags, tt.wantFlags)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Clone())
+	}))
+	defer server.Close()
+
+	ids := IDs{RequestID: "delivery-1", TraceID: "4bf92f3577b34da6a3ce929d0e0736ab", SpanID: "00f067aa0ba902b7", Flags: "01"}
+	client := &http.Client{Transport: &Transport{}}
+	send := func(ctx context.Context, requestID string) {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if requestID != "" {
+			req.Header.Set(HeaderRequestID, requestID)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request error = %v", err)
+		}
+		resp.Body.Close()
+		if requestID != "" && req.Header.Get(HeaderTraceParent) != "" {
+			t.Errorf("request was modified: %v", req.Header)
+		}
+	}
+	send(NewContext(context.Background(), ids), "")
+	send(NewContext(context.Background(), ids), "own-id")
+	send(context.Background(), "")
+
+	want := []struct{ requestID, traceParent string }{
+		{"delivery-1", "00-4bf92f3577b34da6a3ce929d0e0736ab-00f067aa0ba902b7-01"},
+		{"own-id", "00-4bf92f3577b34da6a3ce929d0e0736ab-00f067aa0ba902b7-01"},
+		{"", ""},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Get(HeaderRequestID) != w.requestID || got[i].Get(HeaderTraceParent) != w.traceParent {
+			t.Errorf("request %d headers = %s, %s, want %s, %s", i, got[i].Get(HeaderRequestID), got[i].Get(HeaderTraceParent), w.requestID, w.traceParent)
+		}
+	}
+
+	saved := http.DefaultClient.Transport
+	defer func() { http.DefaultClient.Transport = saved }()
+	Install()
+	Install()
+	if tr, ok := http.DefaultClient.Transport.(*Transport); !ok || tr.Base != saved {
+		t.Errorf("DefaultClient.Transport = %#v, want one Transport wrapping the original", http.DefaultClient.Transport)
+	}
+}
@@ -0,0 +1,159 @@
+// Package vcs holds what the integrations with version control and issue
+// tracking systems have in common: the change being assigned and the routes
+// that choose the group assigning it.
+package vcs
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Change is a pull request, merge request or issue to assign a user to.
+type Change struct {
+	Repo        string   // Full name of the repository, e.g. acme/api
+	Number      int      // Number of the pull request or issue within the repository
+	Title       string   // Title of the change
+	Author      string   // Login of the author in the VCS
+	Base        string   // Branch a pull request merges into
+	Labels      []string // Labels carried by the change
+	Paths       []string // Files changed by a pull request; only filled in when a route matches on paths
+	PullRequest bool     // Whether the change is a pull or merge request rather than an issue
+}
+
+// String returns the change in the form repo#number.
+func (c Change) String() string {
+	return fmt.Sprintf("%s#%d", c.Repo, c.Number)
+}
+
+// Route returns the group of the first route matching the change.
+// It reports false when no route matches.
+func Route(routes []config.RouteConfig, c Change) (string, bool) {
+	for _, r := range routes {
+		if matches(r, c) {
+			return r.Group, true
+		}
+	}
+	return "", false
+}
+
+// AuthorUser returns the username of the author of a change, whose login in
+// the VCS is an identifier of the given kind. Authors without a mapping are
+// assumed to use their username as their login.
+func AuthorUser(ctx context.Context, c Change, kind string) (string, error) {
+	user, err := identity.User(ctx, kind, c.Author)
+	if errors.Is(err, identity.ErrUnknown) {
+		return c.Author, nil
+	}
+	return user, err
+}
+
+// FilesFunc returns the paths of the files changed by a change.
+type FilesFunc func(ctx context.Context, c Change) ([]string, error)
+
+// RouteChange is like Route, but first fills in the changed files of the
+// change with files when a route matches on them.
+func RouteChange(ctx context.Context, routes []config.RouteConfig, c *Change, files FilesFunc) (string, bool, error) {
+	if NeedsPaths(routes) && c.Paths == nil {
+		paths, err := files(ctx, *c)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to get changed files of %s: %w", c, err)
+		}
+		c.Paths = paths
+	}
+	group, ok := Route(routes, *c)
+	return group, ok, nil
+}
+
+// NeedsPaths reports whether any route matches on changed files, so the
+// integrations know to fetch them before routing.
+func NeedsPaths(routes []config.RouteConfig) bool {
+	for _, r := range routes {
+		if len(r.Paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a route applies to a change: every condition the
+// route sets must hold.
+func matches(r config.RouteConfig, c Change) bool {
+	// Patterns are checked when the config is loaded
+	if r.Repo != "" {
+		if ok, _ := path.Match(r.Repo, c.Repo); !ok {
+			return false
+		}
+	}
+	if r.Title != "" {
+		if ok, _ := regexp.MatchString(r.Title, c.Title); !ok {
+			return false
+		}
+	}
+	if len(r.Labels) > 0 && !anyLabel(r.Labels, c.Labels) {
+		return false
+	}
+	if len(r.Paths) > 0 && !anyPath(r.Paths, c.Paths) {
+		return false
+	}
+	return true
+}
+
+// anyLabel reports whether the change carries one of the wanted labels.
+func anyLabel(want, labels []string) bool {
+	for _, w := range want {
+		for _, label := range labels {
+			if label == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// anyPath reports whether a changed file matches one of the patterns.
+func anyPath(patterns, files []string) bool {
+	for _, pattern := range patterns {
+		for _, file := range files {
+			if MatchPath(pattern, file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchPath reports whether a file path matches a pattern. Patterns use the
+// syntax of path.Match for each slash-separated element, and an element of
+// ** matches any number of directories, so api/** matches every file below
+// api/ and **/*.go every Go file.
+func MatchPath(pattern, file string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+// matchElems matches the elements of a path against those of a pattern.
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
@@ -0,0 +1,65 @@
+package vcs
+
+import (
+	"autoassigner/config"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	routes := []config.RouteConfig{
+		{Repo: "acme/api", Labels: []string{"security", "auth"}, Group: "security"},
+		{Repo: "acme/api", Title: `(?i)^\[hotfix\]`, Group: "oncall"},
+		{Repo: "acme/mono", Paths: []string{"api/**", "**/*.proto"}, Group: "backend"},
+		{Repo: "acme/mono", Paths: []string{"web/**"}, Labels: []string{"ui"}, Group: "frontend"},
+		{Repo: "acme/api", Group: "backend"},
+		{Repo: "acme/*", Group: "acme"},
+		{Labels: []string{"docs"}, Group: "writers"},
+	}
+	tests := []struct {
+		change Change
+		want   string
+		ok     bool
+	}{
+		{Change{Repo: "acme/api", Labels: []string{"bug", "auth"}}, "security", true},
+		{Change{Repo: "acme/api", Labels: []string{"bug"}}, "backend", true},
+		{Change{Repo: "acme/api", Title: "[HOTFIX] Login loop"}, "oncall", true},
+		{Change{Repo: "acme/mono", Paths: []string{"README.md", "api/handlers/user.go"}}, "backend", true},
+		{Change{Repo: "acme/mono", Paths: []string{"proto/user.proto"}}, "backend", true},
+		{Change{Repo: "acme/mono", Paths: []string{"web/app.ts"}, Labels: []string{"ui"}}, "frontend", true},
+		{Change{Repo: "acme/mono", Paths: []string{"web/app.ts"}}, "acme", true},
+		{Change{Repo: "acme/web"}, "acme", true},
+		{Change{Repo: "other/site", Labels: []string{"docs"}}, "writers", true},
+		{Change{Repo: "other/site"}, "", false},
+	}
+	for i, tt := range tests {
+		got, ok := Route(routes, tt.change)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("#%d Route(%+v) = %q, %v, want %q, %v", i, tt.change, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{"api/**", "api/server.go", true},
+		{"api/**", "api/v1/handlers/user.go", true},
+		{"api/**", "apis/server.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/serve.go", true},
+		{"**/*.go", "cmd/serve.go.orig", false},
+		{"docs/*.md", "docs/index.md", true},
+		{"docs/*.md", "docs/guide/index.md", false},
+		{"api/**/test_*.py", "api/test_a.py", true},
+		{"api/**/test_*.py", "api/x/y/test_a.py", true},
+		{"Makefile", "Makefile", true},
+	}
+	for _, tt := range tests {
+		if got := MatchPath(tt.pattern, tt.file); got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.file, got, tt.want)
+		}
+	}
+}
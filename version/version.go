@@ -1,6 +1,12 @@
 package version
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+)
 
 var (
 	// Version is the current version of the application
@@ -11,7 +17,49 @@ var (
 	GitCommit = "unknown"
 )
 
+// Info is the machine-readable build and release metadata of the binary.
+type Info struct {
+	Version   string              `json:"version"`            // Version as set at build time, e.g. "v1.2.0-3-gabc123"
+	Semver    string              `json:"semver"`             // Version without a leading "v"
+	GitCommit string              `json:"git_commit"`         // Git commit the binary was built from
+	BuildTime string              `json:"build_time"`         // Time the binary was built
+	GoVersion string              `json:"go_version"`         // Go toolchain used for the build
+	Platform  string              `json:"platform"`           // Target OS and architecture, e.g. "linux/amd64"
+	Backends  map[string][]string `json:"backends,omitempty"` // Enabled components by kind, e.g. "strategies"
+}
+
+// Get returns the build information of the running binary.
+// Backends are left empty for the caller to fill in.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Semver:    strings.TrimPrefix(Version, "v"),
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
 // String returns the version information as a string
 func String() string {
 	return fmt.Sprintf("Version: %s\nBuild Time: %s\nGit Commit: %s", Version, BuildTime, GitCommit)
 }
+
+// JSON returns the information as indented JSON.
+func (i Info) JSON() ([]byte, error) {
+	return json.MarshalIndent(i, "", "  ")
+}
+
+// Handler returns an HTTP handler serving info as JSON, for mounting at /version.
+func Handler(info Info) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
+}
@@ -0,0 +1,47 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	saved := Version
+	defer func() { Version = saved }()
+	Version = "v1.2.3"
+
+	info := Get()
+	if info.Version != "v1.2.3" || info.Semver != "1.2.3" {
+		t.Errorf("Get() version = %q semver = %q, want v1.2.3 and 1.2.3", info.Version, info.Semver)
+	}
+	if info.GoVersion == "" || info.Platform == "" {
+		t.Errorf("Get() = %+v, want go version and platform", info)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	info := Get()
+	info.Backends = map[string][]string{"strategies": {"round_robin"}}
+	handler := Handler(info)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /version status = %d, want 200", rec.Code)
+	}
+	var got Info
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got.Semver != info.Semver || len(got.Backends["strategies"]) != 1 {
+		t.Errorf("GET /version = %+v, want %+v", got, info)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/version", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /version status = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,213 @@
+// Package zendesk integrates the autoassigner with Zendesk Support: it reads
+// tickets sent by trigger webhooks, assigns them to agents through the
+// Tickets API and reads the agents' availability status.
+package zendesk
+
+import (
+	"autoassigner/config"
+	"autoassigner/identity"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Ticket is a Zendesk ticket to assign.
+type Ticket struct {
+	ID         string // Ticket ID
+	Subject    string // Subject of the ticket
+	GroupID    string // ID of the Zendesk group the ticket is in
+	Group      string // Name of the Zendesk group the ticket is in
+	AssigneeID string // ID of the assigned agent, empty for unassigned tickets
+}
+
+// String returns the ticket ID prefixed with "#".
+func (t Ticket) String() string {
+	return "#" + t.ID
+}
+
+// text is a field sent by a trigger. Placeholders are rendered as strings,
+// but numbers are accepted as well.
+type text string
+
+func (t *text) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		*t = text(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = text(s)
+	return nil
+}
+
+// ParseTicket reads the ticket from the body of a trigger webhook:
+//
+//	{"ticket": {"id": "{{ticket.id}}", "subject": "{{ticket.title}}", "group_id": "{{ticket.group.id}}",
+//	            "group": "{{ticket.group.name}}", "assignee_id": "{{ticket.assignee.id}}"}}
+func ParseTicket(payload []byte) (*Ticket, error) {
+	var body struct {
+		Ticket struct {
+			ID         text `json:"id"`
+			Subject    text `json:"subject"`
+			GroupID    text `json:"group_id"`
+			Group      text `json:"group"`
+			AssigneeID text `json:"assignee_id"`
+		} `json:"ticket"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, fmt.Errorf("failed to parse Zendesk ticket: %w", err)
+	}
+	t := body.Ticket
+	if t.ID == "" {
+		return nil, fmt.Errorf("Zendesk webhook without a ticket id")
+	}
+	return &Ticket{
+		ID:         string(t.ID),
+		Subject:    string(t.Subject),
+		GroupID:    string(t.GroupID),
+		Group:      string(t.Group),
+		AssigneeID: string(t.AssigneeID),
+	}, nil
+}
+
+// VerifySignature reports whether signature, the X-Zendesk-Webhook-Signature
+// header, is the base64 HMAC-SHA256 of timestamp and payload under secret.
+func VerifySignature(secret, timestamp string, payload []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write(payload)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// Group returns the autoassigner group mapped to the Zendesk group of a
+// ticket, by ID or name. It reports false for unmapped tickets.
+func Group(t Ticket) (string, bool) {
+	groups := config.Settings.Zendesk.Groups
+	for _, key := range []string{t.GroupID, t.Group} {
+		if group, ok := groups[key]; ok && key != "" {
+			return group, true
+		}
+	}
+	return "", false
+}
+
+// Agent returns how a user is assigned in Zendesk: their user ID from the
+// identity mapping, or else their email address.
+func Agent(ctx context.Context, user string) (string, error) {
+	id, err := identity.Lookup(ctx, user, identity.Zendesk)
+	if !errors.Is(err, identity.ErrUnknown) {
+		return id, err
+	}
+	return identity.Lookup(ctx, user, identity.Email)
+}
+
+// Assign sets the assignee of a ticket to agent, a user ID or an email
+// address as returned by Agent.
+func Assign(ctx context.Context, t Ticket, agent string) error {
+	ticket := map[string]interface{}{"assignee_id": json.Number(agent)}
+	if strings.Contains(agent, "@") {
+		ticket = map[string]interface{}{"assignee_email": agent}
+	}
+	path := "/api/v2/tickets/" + url.PathEscape(t.ID) + ".json"
+	return call(ctx, http.MethodPut, path, map[string]interface{}{"ticket": ticket}, nil)
+}
+
+// AgentStatus returns the name of the current status of an agent, such as
+// "Online" or "Away", from the agent availability API.
+func AgentStatus(ctx context.Context, agentID string) (string, error) {
+	var result struct {
+		Data struct {
+			Attributes struct {
+				AgentStatus struct {
+					Name string `json:"name"`
+				} `json:"agent_status"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := call(ctx, http.MethodGet, "/api/v2/agent_availabilities/"+url.PathEscape(agentID), nil, &result); err != nil {
+		return "", err
+	}
+	return result.Data.Attributes.AgentStatus.Name, nil
+}
+
+// call sends a request to the Zendesk API, authenticated with the OAuth
+// token or else the API token, and decodes the response into result unless
+// it is nil.
+func call(ctx context.Context, method, path string, body, result interface{}) error {
+	conf := config.Settings.Zendesk
+	if conf.Url == "" {
+		return fmt.Errorf("url is required in zendesk configuration")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(conf.Url, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case conf.Token != "":
+		req.Header.Set("Authorization", "Bearer "+conf.Token)
+	case conf.ApiToken != "":
+		req.SetBasicAuth(conf.Email+"/token", conf.ApiToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Zendesk request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// Errors are {"error": "...", "description": "..."}, or {"error": {"title": "...", "message": "..."}}
+		var apiErr struct {
+			Error       json.RawMessage `json:"error"`
+			Description string          `json:"description"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		var detail struct {
+			Title   string `json:"title"`
+			Message string `json:"message"`
+		}
+		var message string
+		if json.Unmarshal(apiErr.Error, &message) != nil && json.Unmarshal(apiErr.Error, &detail) == nil {
+			message = detail.Message
+			if message == "" {
+				message = detail.Title
+			}
+		}
+		if apiErr.Description != "" {
+			message = apiErr.Description
+		}
+		if message != "" {
+			return fmt.Errorf("Zendesk request failed: %s: %s", resp.Status, message)
+		}
+		return fmt.Errorf("Zendesk request failed: unexpected status %s", resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
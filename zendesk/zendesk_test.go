@@ -0,0 +1,143 @@
+package zendesk
+
+import (
+	"autoassigner/config"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTicket(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    *Ticket
+		wantErr bool
+	}{
+		{
+			payload: `{"ticket": {"id": "35436", "subject": "Printer on fire", "group_id": "360001234567", "group": "Support", "assignee_id": ""}}`,
+			want:    &Ticket{ID: "35436", Subject: "Printer on fire", GroupID: "360001234567", Group: "Support"},
+		},
+		// Numbers are accepted as well as rendered placeholders
+		{
+			payload: `{"ticket": {"id": 35436, "group_id": 360001234567, "assignee_id": 1234}}`,
+			want:    &Ticket{ID: "35436", GroupID: "360001234567", AssigneeID: "1234"},
+		},
+		{payload: `{"ticket": {"subject": "No id"}}`, wantErr: true},
+		{payload: `{"ticket": {"id": true}}`, wantErr: true},
+		{payload: `{`, wantErr: true},
+	}
+	for i, tt := range tests {
+		got, err := ParseTicket([]byte(tt.payload))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d ParseTicket() error = %v, wantErr %v", i, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d ParseTicket() = %+v, want %+v", i, got, tt.want)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"ticket": {"id": "1"}}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("2026-10-18T10:00:00Z"))
+	mac.Write(payload)
+	valid := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		timestamp string
+		signature string
+		want      bool
+	}{
+		{timestamp: "2026-10-18T10:00:00Z", signature: valid, want: true},
+		{timestamp: "2026-10-18T10:00:01Z", signature: valid},
+		{timestamp: "2026-10-18T10:00:00Z", signature: "bm90IGEgc2lnbmF0dXJl"},
+		{timestamp: "2026-10-18T10:00:00Z"},
+	}
+	for i, tt := range tests {
+		if got := VerifySignature("secret", tt.timestamp, payload, tt.signature); got != tt.want {
+			t.Errorf("#%d VerifySignature() = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestAgent(t *testing.T) {
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Identity = config.IdentityConfig{Users: map[string]map[string]string{
+		"alice": {"zendesk": "1001", "email": "alice@example.com"},
+		"bob":   {"email": "bob@example.com"},
+	}}
+
+	for user, want := range map[string]string{"alice": "1001", "bob": "bob@example.com"} {
+		if got, err := Agent(context.Background(), user); err != nil || got != want {
+			t.Errorf("Agent(%s) = %q, %v, want %q", user, got, err, want)
+		}
+	}
+	if _, err := Agent(context.Background(), "carol"); err == nil {
+		t.Error("Agent(carol) error = nil, want an unknown identity")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	var updates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "bot@acme.com/token" || pass != "api-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "Couldn't authenticate you"}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/api/v2/tickets/35436.json":
+			data, _ := io.ReadAll(r.Body)
+			var body bytes.Buffer
+			json.Compact(&body, data)
+			updates = append(updates, body.String())
+			w.Write([]byte(`{"ticket": {}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/agent_availabilities/1001":
+			w.Write([]byte(`{"data": {"type": "agent_availabilities", "id": "1001", "attributes": {"agent_status": {"id": "online", "name": "Online"}}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "RecordNotFound", "description": "Not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	saved := config.Settings
+	defer func() { config.Settings = saved }()
+	config.Settings.Zendesk = config.ZendeskConfig{Url: server.URL, Email: "bot@acme.com", ApiToken: "api-token"}
+	ctx := context.Background()
+
+	ticket := Ticket{ID: "35436"}
+	if err := Assign(ctx, ticket, "1001"); err != nil {
+		t.Fatalf("Assign(1001) error = %v", err)
+	}
+	if err := Assign(ctx, ticket, "bob@example.com"); err != nil {
+		t.Fatalf("Assign(bob@example.com) error = %v", err)
+	}
+	want := []string{`{"ticket":{"assignee_id":1001}}`, `{"ticket":{"assignee_email":"bob@example.com"}}`}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+
+	if status, err := AgentStatus(ctx, "1001"); err != nil || status != "Online" {
+		t.Errorf("AgentStatus() = %q, %v, want Online", status, err)
+	}
+	if err := Assign(ctx, Ticket{ID: "1"}, "1001"); err == nil || !strings.Contains(err.Error(), "Not found") {
+		t.Errorf("Assign() error = %v, want the API's description", err)
+	}
+	config.Settings.Zendesk.ApiToken = "wrong"
+	if _, err := AgentStatus(ctx, "1001"); err == nil || !strings.Contains(err.Error(), "Couldn't authenticate you") {
+		t.Errorf("AgentStatus() error = %v, want the API's message", err)
+	}
+}